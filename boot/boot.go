@@ -48,11 +48,26 @@ const (
 	TryingStatus = "trying"
 )
 
+// RebootReason describes what makes a reboot required.
+type RebootReason string
+
+const (
+	// RebootReasonBase is used when the boot base changed.
+	RebootReasonBase RebootReason = "base"
+	// RebootReasonKernel is used when the kernel changed.
+	RebootReasonKernel RebootReason = "kernel"
+	// RebootReasonGadget is used when the gadget changed.
+	RebootReasonGadget RebootReason = "gadget"
+)
+
 // RebootInfo contains information about how to perform a reboot if
 // required.
 type RebootInfo struct {
 	// RebootRequired is true if we need to reboot after an update.
 	RebootRequired bool
+	// Reason is what makes the reboot required, it is only set if
+	// RebootRequired is true.
+	Reason RebootReason
 	// BootloaderOptions will be used to find the correct bootloader when
 	// checking for any set reboot arguments.
 	BootloaderOptions *bootloader.Options
@@ -259,6 +259,13 @@ func InsufficientSpace(dserr *snapstate.InsufficientSpaceError) *apiError {
 	if dserr.ChangeKind != "" {
 		value["change-kind"] = dserr.ChangeKind
 	}
+	if dserr.Required != 0 {
+		value["required-space"] = dserr.Required
+		value["available-space"] = dserr.Available
+	}
+	if dserr.MountPoint != "" {
+		value["mount-point"] = dserr.MountPoint
+	}
 	return &apiError{
 		Status:  507,
 		Message: dserr.Error(),
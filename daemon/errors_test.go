@@ -242,6 +242,30 @@ func (s *errorsSuite) TestErrToResponseInsufficentSpace(c *C) {
 	})
 }
 
+func (s *errorsSuite) TestErrToResponseInsufficentSpaceDetails(c *C) {
+	err := &snapstate.InsufficientSpaceError{
+		Snaps:      []string{"foo"},
+		ChangeKind: "install",
+		Path:       "/var/lib/snapd",
+		Required:   300,
+		Available:  100,
+		MountPoint: "/var",
+	}
+	rspe := daemon.ErrToResponse(err, nil, daemon.BadRequest, "%s: %v", "ERR")
+	c.Check(rspe, DeepEquals, &daemon.APIError{
+		Status:  507,
+		Message: `insufficient space in "/var/lib/snapd" to perform "install" change for the following snaps: foo`,
+		Kind:    client.ErrorKindInsufficientDiskSpace,
+		Value: map[string]any{
+			"snap-names":      []string{"foo"},
+			"change-kind":     "install",
+			"required-space":  uint64(300),
+			"available-space": uint64(100),
+			"mount-point":     "/var",
+		},
+	})
+}
+
 func (s *errorsSuite) TestAuthCancelled(c *C) {
 	c.Check(daemon.AuthCancelled("auth cancelled"), DeepEquals, &daemon.APIError{
 		Status:  403,
@@ -75,6 +75,8 @@ const (
 	ConfdbControl
 	// AppArmorPrompting enables AppArmor to prompt the user for permission when apps perform certain operations.
 	AppArmorPrompting
+	// URLInstall enables installing snaps from snap files downloaded from arbitrary HTTP(S) URLs.
+	URLInstall
 
 	// lastFeature is the final known feature, it is only used for testing.
 	lastFeature
@@ -124,6 +126,8 @@ var featureNames = map[SnapdFeature]string{
 	ConfdbControl: "confdb-control",
 
 	AppArmorPrompting: "apparmor-prompting",
+
+	URLInstall: "url-install",
 }
 
 // featuresEnabledWhenUnset contains a set of features that are enabled when not explicitly configured.
@@ -375,6 +375,8 @@ func newImageSeeder(tsto *tooling.ToolingStore, model *asserts.Model, opts *Opti
 		TestSkipCopyUnverifiedModel: osutil.GetenvBool("UBUNTU_IMAGE_SKIP_COPY_UNVERIFIED_MODEL"),
 
 		ExtraAssertions: opts.ExtraAssertions,
+
+		Architecture: s.architecture,
 	}
 	w, err := seedwriter.New(model, wOpts)
 	if err != nil {
@@ -455,25 +457,6 @@ func (s *imageSeeder) start(optSnaps []*seedwriter.OptionsSnap) error {
 	return s.w.Start(db, s.f)
 }
 
-func (s *imageSeeder) snapSupportsImageArch(sn *seedwriter.SeedSnap) bool {
-	for _, a := range sn.Info.Architectures {
-		if a == "all" || a == s.architecture {
-			return true
-		}
-	}
-	return false
-}
-
-func (s *imageSeeder) validateSnapArchs(snaps []*seedwriter.SeedSnap) error {
-	for _, sn := range snaps {
-		if !s.snapSupportsImageArch(sn) {
-			return fmt.Errorf("snap %q supported architectures (%s) are incompatible with the model architecture (%s)",
-				sn.Info.SnapName(), strings.Join(sn.Info.Architectures, ", "), s.architecture)
-		}
-	}
-	return nil
-}
-
 type localSnapRefs map[*seedwriter.SeedSnap][]*asserts.Ref
 
 func (s *imageSeeder) deriveInfoForLocalSnaps(localCompsPaths []string, f seedwriter.SeedAssertionFetcher, db *asserts.Database) (localSnapRefs, error) {
@@ -493,8 +476,13 @@ func (s *imageSeeder) deriveInfoForLocalSnaps(localCompsPaths []string, f seedwr
 
 	snaps := make(localSnapRefs)
 	for _, sn := range localSnaps {
+		snapFile, err := s.w.OpenSnap(sn.Path)
+		if err != nil {
+			return nil, err
+		}
+
 		assertedSnap := true
-		si, aRefs, err := seedwriter.DeriveSideInfo(sn.Path, s.model, f, db)
+		si, aRefs, err := seedwriter.DeriveSideInfoFromContainer(sn.Path, snapFile, s.model, f, db)
 		if err != nil {
 			if !errors.Is(err, &asserts.NotFoundError{}) {
 				return nil, err
@@ -502,10 +490,6 @@ func (s *imageSeeder) deriveInfoForLocalSnaps(localCompsPaths []string, f seedwr
 			assertedSnap = false
 		}
 
-		snapFile, err := snapfile.Open(sn.Path)
-		if err != nil {
-			return nil, err
-		}
 		info, err := snap.ReadInfoFromSnapFile(snapFile, si)
 		if err != nil {
 			return nil, err
@@ -558,10 +542,8 @@ func (s *imageSeeder) deriveInfoForLocalSnaps(localCompsPaths []string, f seedwr
 		return nil, fmt.Errorf("missing local snaps:%s", errMsg)
 	}
 
-	// derive info first before verifying the arch
-	if err := s.validateSnapArchs(localSnaps); err != nil {
-		return nil, err
-	}
+	// the architectures of the local snaps are checked against the one
+	// of the image by the writer
 	return snaps, s.w.InfoDerived()
 }
 
@@ -603,7 +585,7 @@ func (s *imageSeeder) validationSetKeysAndRevisionForSnap(snapName string) ([]sn
 func (s *imageSeeder) downloadSnaps(snapsToDownload []*seedwriter.SeedSnap, curSnaps []*tooling.CurrentSnap) (downloadedSnaps map[string]*tooling.DownloadedSnap, err error) {
 	byName := make(map[string]*seedwriter.SeedSnap, len(snapsToDownload))
 	revisions := make(map[string]snap.Revision)
-	beforeDownload := func(info *snap.Info, cinfos map[string]*snap.ComponentInfo) (string, map[string]string, error) {
+	beforeDownload := func(info *snap.Info, cinfos map[string]*snap.ComponentInfo, compDownloadInfos map[string]snap.DownloadInfo) (string, map[string]string, error) {
 		sn := byName[info.SnapName()]
 		if sn == nil {
 			return "", nil, fmt.Errorf("internal error: downloading unexpected snap %q", info.SnapName())
@@ -619,15 +601,13 @@ func (s *imageSeeder) downloadSnaps(snapsToDownload []*seedwriter.SeedSnap, curS
 				ComponentRef: ci.Component,
 				Path:         "",
 				Info:         ci,
+				DownloadInfo: compDownloadInfos[ci.Component.ComponentName],
 			}
 		}
 		fmt.Fprintf(Stdout, "Fetching %s (%s)\n", sn.SnapName(), rev)
 		if err := s.w.SetInfo(sn, info, seedComps); err != nil {
 			return "", nil, err
 		}
-		if err := s.validateSnapArchs([]*seedwriter.SeedSnap{sn}); err != nil {
-			return "", nil, err
-		}
 
 		compPaths := make(map[string]string, len(cinfos))
 		for _, comp := range sn.Components {
@@ -642,6 +622,10 @@ func (s *imageSeeder) downloadSnaps(snapsToDownload []*seedwriter.SeedSnap, curS
 		if err != nil {
 			return nil, err
 		}
+		if rev.Unset() {
+			// the revision can also be pinned by the snap options
+			rev = sn.Revision
+		}
 
 		var channel string
 		switch {
@@ -309,6 +309,22 @@ func ensureSymlinkFileState(filePath string, state FileState) error {
 	return AtomicSymlink(target, filePath)
 }
 
+// FileStateEqualTo returns whether the file exists in the expected state.
+// Unlike EnsureFileState it never modifies the file.
+func FileStateEqualTo(filePath string, state FileState) (bool, error) {
+	_, _, mode, err := state.State()
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case mode.IsRegular():
+		return regularFileStateEqualTo(filePath, state)
+	case mode.Type() == os.ModeSymlink:
+		return symlinkFileStateEqualTo(filePath, state)
+	}
+	return false, fmt.Errorf("internal error: FileStateEqualTo does not support type %q", mode.Type())
+}
+
 // EnsureFileState ensures that the file is in the expected state. It will not
 // attempt to remove the file if no content is provided.
 func EnsureFileState(filePath string, state FileState) error {
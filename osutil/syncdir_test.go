@@ -355,6 +355,48 @@ func (s *EnsureDirStateSuite) TestSameSymlink(c *C) {
 	c.Assert(link, Equals, "target")
 }
 
+func (s *EnsureDirStateSuite) TestFileStateEqualTo(c *C) {
+	filePath := filepath.Join(s.dir, "file.snap")
+	symlink := filepath.Join(s.dir, "symlink.snap")
+	blob := &osutil.MemoryFileState{Content: []byte("data"), Mode: 0644}
+	link := &osutil.SymlinkFileState{Target: "target"}
+
+	// missing files are not equal
+	equal, err := osutil.FileStateEqualTo(filePath, blob)
+	c.Assert(err, IsNil)
+	c.Check(equal, Equals, false)
+	equal, err = osutil.FileStateEqualTo(symlink, link)
+	c.Assert(err, IsNil)
+	c.Check(equal, Equals, false)
+
+	c.Assert(os.WriteFile(filePath, []byte("data"), 0644), IsNil)
+	c.Assert(os.Symlink("target", symlink), IsNil)
+
+	equal, err = osutil.FileStateEqualTo(filePath, blob)
+	c.Assert(err, IsNil)
+	c.Check(equal, Equals, true)
+	equal, err = osutil.FileStateEqualTo(symlink, link)
+	c.Assert(err, IsNil)
+	c.Check(equal, Equals, true)
+
+	// different content, mode or target are not equal
+	equal, err = osutil.FileStateEqualTo(filePath, &osutil.MemoryFileState{Content: []byte("other"), Mode: 0644})
+	c.Assert(err, IsNil)
+	c.Check(equal, Equals, false)
+	equal, err = osutil.FileStateEqualTo(filePath, &osutil.MemoryFileState{Content: []byte("data"), Mode: 0600})
+	c.Assert(err, IsNil)
+	c.Check(equal, Equals, false)
+	equal, err = osutil.FileStateEqualTo(symlink, &osutil.SymlinkFileState{Target: "other"})
+	c.Assert(err, IsNil)
+	c.Check(equal, Equals, false)
+
+	// nothing was modified
+	c.Check(filePath, testutil.FileEquals, "data")
+	target, err := os.Readlink(symlink)
+	c.Assert(err, IsNil)
+	c.Check(target, Equals, "target")
+}
+
 type mockFileState struct {
 	reader io.ReadCloser
 	size   int64
@@ -22,6 +22,7 @@ package assertstate
 import (
 	"errors"
 	"fmt"
+	"os"
 
 	"gopkg.in/tomb.v2"
 
@@ -30,6 +31,7 @@ import (
 	"github.com/snapcore/snapd/asserts/sysdb"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
 )
 
 // AssertManager is responsible for the enforcement of assertions in
@@ -257,3 +259,104 @@ func fetchAssertsAndValidateComponent(st *state.State, compsup *snapstate.Compon
 
 	return snapasserts.CheckComponentProvenanceWithVerifiedRevision(compPath, resRev)
 }
+
+// fetchAndSaveDownloadAssertions fetches the assertions of a snap downloaded
+// by snapstate.DownloadWithGoal and of its components, cross checks them
+// against the downloaded files and saves them into assertsPath, as done by
+// snap download. The assertions are not added to the system assertion
+// database.
+func fetchAndSaveDownloadAssertions(st *state.State, info *snap.Info, snapPath string, compsups []snapstate.ComponentSetup, assertsPath string, userID int, deviceCtx snapstate.DeviceContext) (err error) {
+	sha3_384, snapSize, err := asserts.SnapFileSHA3_384(snapPath)
+	if err != nil {
+		return err
+	}
+
+	user, err := userFromUserID(st, userID)
+	if err != nil {
+		return err
+	}
+	sto := snapstate.Store(st, deviceCtx)
+
+	db, err := asserts.OpenDatabase(&asserts.DatabaseConfig{
+		Backstore: asserts.NewMemoryBackstore(),
+		Trusted:   sysdb.Trusted(),
+	})
+	if err != nil {
+		return err
+	}
+
+	w, err := os.Create(assertsPath)
+	if err != nil {
+		return fmt.Errorf("cannot create assertions file: %v", err)
+	}
+	defer func() {
+		w.Close()
+		if err != nil {
+			os.Remove(assertsPath)
+		}
+	}()
+	enc := asserts.NewEncoder(w)
+
+	retrieve := func(ref *asserts.Ref) (asserts.Assertion, error) {
+		return sto.Assertion(ref.Type, ref.PrimaryKey, user)
+	}
+	save := func(a asserts.Assertion) error {
+		// for checking
+		if err := db.Add(a); err != nil {
+			if _, ok := err.(*asserts.RevisionError); ok {
+				return nil
+			}
+			return fmt.Errorf("cannot add assertion %v: %v", a.Ref(), err)
+		}
+		return enc.Encode(a)
+	}
+	f := asserts.NewFetcher(db, retrieve, save)
+
+	// the provenance of the snap is the expected provenance for the components
+	expectedProv := info.SnapProvenance
+	compHashes := make([]string, len(compsups))
+	compSizes := make([]uint64, len(compsups))
+	for i, compsup := range compsups {
+		compHashes[i], compSizes[i], err = asserts.SnapFileSHA3_384(compsup.CompPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	st.Unlock()
+	err = func() error {
+		if err := snapasserts.FetchSnapAssertions(f, sha3_384, expectedProv); err != nil {
+			return err
+		}
+		for i, compsup := range compsups {
+			if err := snapasserts.FetchComponentAssertions(f, &info.SideInfo, compsup.CompSideInfo, compHashes[i], expectedProv); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	st.Lock()
+	if err != nil {
+		return err
+	}
+
+	verifiedRev, err := snapasserts.CrossCheck(info.InstanceName(), sha3_384, expectedProv, snapSize, &info.SideInfo, nil, db)
+	if err != nil {
+		return err
+	}
+	if err := snapasserts.CheckProvenanceWithVerifiedRevision(snapPath, verifiedRev); err != nil {
+		return err
+	}
+
+	for i, compsup := range compsups {
+		resRev, err := snapasserts.CrossCheckResource(compsup.ComponentName(), compHashes[i], expectedProv, compSizes[i], compsup.CompSideInfo, &info.SideInfo, nil, db)
+		if err != nil {
+			return err
+		}
+		if err := snapasserts.CheckComponentProvenanceWithVerifiedRevision(compsup.CompPath, resRev); err != nil {
+			return err
+		}
+	}
+
+	return w.Close()
+}
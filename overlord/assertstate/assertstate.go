@@ -395,6 +395,10 @@ func delayedCrossMgrInit() {
 	snapstate.EnforceValidationSets = ApplyEnforcedValidationSets
 	// hook helper for enforcing already existing validation set assertions
 	snapstate.EnforceLocalValidationSets = ApplyLocalEnforcedValidationSets
+	// hook helper for looking up existing validation set assertions
+	snapstate.ResolveLocalValidationSets = resolveValidationSetPrimaryKeys
+	// hook fetching the assertions of snaps downloaded without installing them
+	snapstate.FetchAndSaveDownloadAssertions = fetchAndSaveDownloadAssertions
 }
 
 // AutoRefreshAssertions tries to refresh all assertions
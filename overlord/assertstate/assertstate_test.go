@@ -25,6 +25,7 @@ import (
 	"crypto"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
@@ -5567,6 +5568,83 @@ func (s *assertMgrSuite) testValidateComponent(c *C, opts testValidateComponentO
 	c.Assert(chg.IsReady(), Equals, true)
 }
 
+func (s *assertMgrSuite) TestFetchAndSaveDownloadAssertions(c *C) {
+	snapRev, compRev := snap.R(10), snap.R(20)
+
+	paths, digests := s.prereqSnapAssertions(c, nil, "", 10)
+	compPath, compDigest := s.prereqComponentAssertions(c, prereqComponentAssertionsOpts{
+		snapRev: snapRev,
+		compRev: compRev,
+	})
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	info := &snap.Info{SideInfo: snap.SideInfo{
+		RealName: "foo",
+		SnapID:   "snap-id-1",
+		Revision: snapRev,
+	}}
+	compsups := []snapstate.ComponentSetup{{
+		CompPath: compPath,
+		CompSideInfo: &snap.ComponentSideInfo{
+			Component: naming.NewComponentRef("foo", "standard-component"),
+			Revision:  compRev,
+		},
+	}}
+	assertsPath := filepath.Join(c.MkDir(), "foo_10.assert")
+
+	err := snapstate.FetchAndSaveDownloadAssertions(s.state, info, paths[10], compsups, assertsPath, 0, s.trivialDeviceCtx)
+	c.Assert(err, IsNil)
+
+	f, err := os.Open(assertsPath)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	found := make(map[string]asserts.Assertion)
+	dec := asserts.NewDecoder(f)
+	for {
+		a, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+		found[a.Type().Name] = a
+	}
+	c.Assert(found[asserts.SnapDeclarationType.Name], NotNil)
+	c.Check(found[asserts.SnapDeclarationType.Name].HeaderString("snap-id"), Equals, "snap-id-1")
+	c.Assert(found[asserts.SnapRevisionType.Name], NotNil)
+	c.Check(found[asserts.SnapRevisionType.Name].HeaderString("snap-sha3-384"), Equals, digests[10])
+	c.Assert(found[asserts.SnapResourceRevisionType.Name], NotNil)
+	c.Check(found[asserts.SnapResourceRevisionType.Name].HeaderString("resource-sha3-384"), Equals, compDigest)
+	c.Check(found[asserts.SnapResourcePairType.Name], NotNil)
+	c.Check(found[asserts.AccountKeyType.Name], NotNil)
+
+	// the system assertion database is left alone
+	_, err = assertstate.DB(s.state).Find(asserts.SnapRevisionType, map[string]string{
+		"snap-sha3-384": digests[10],
+	})
+	c.Check(errors.Is(err, &asserts.NotFoundError{}), Equals, true)
+}
+
+func (s *assertMgrSuite) TestFetchAndSaveDownloadAssertionsMismatch(c *C) {
+	paths, _ := s.prereqSnapAssertions(c, nil, "", 10)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	// the side info does not match the assertions of the blob
+	info := &snap.Info{SideInfo: snap.SideInfo{
+		RealName: "foo",
+		SnapID:   "snap-id-1",
+		Revision: snap.R(11),
+	}}
+	assertsPath := filepath.Join(c.MkDir(), "foo_11.assert")
+
+	err := snapstate.FetchAndSaveDownloadAssertions(s.state, info, paths[10], nil, assertsPath, 0, s.trivialDeviceCtx)
+	c.Assert(err, ErrorMatches, `snap "foo" does not have expected ID or revision according to assertions \(metadata is broken or tampered\): 11 / snap-id-1 != 10 / snap-id-1`)
+	c.Check(assertsPath, testutil.FileAbsent)
+}
+
 func (s *assertMgrSuite) TestValidateComponentNoDownload(c *C) {
 	const invalid = false
 	s.testValidateComponentNoDownload(c, invalid)
@@ -741,9 +741,6 @@ func (r *remodeler) installGoal(sn remodelSnapTarget, components []string) (snap
 			ValidationSets: r.vsets,
 		}
 
-		// TODO: snapstate for by-path installs doesn't verify validation sets.
-		// decide if we want to manually verify the given rules here or not.
-
 		return snapstatePathInstallGoal(snapstate.PathSnap{
 			Path:       ls.Path,
 			SideInfo:   ls.SideInfo,
@@ -867,9 +864,6 @@ func (r *remodeler) updateGoal(st *state.State, sn remodelSnapTarget, components
 			ValidationSets: r.vsets,
 		}
 
-		// TODO: snapstate for by-path installs doesn't verify validation sets.
-		// decide if we want to manually verify the given rules here or not.
-
 		return snapstatePathUpdateGoal(snapstate.PathSnap{
 			Path:       ls.Path,
 			SideInfo:   ls.SideInfo,
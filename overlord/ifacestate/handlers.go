@@ -43,6 +43,7 @@ import (
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snap/quota"
+	"github.com/snapcore/snapd/strutil"
 	"github.com/snapcore/snapd/timings"
 )
 
@@ -1461,6 +1462,12 @@ func (m *InterfaceManager) doAutoConnect(task *state.Task, _ *tomb.Tomb) error {
 	newconns := make(map[string]*interfaces.ConnRef, len(plugs)+len(slots))
 	var connOpts map[string]*connectOpts
 
+	// plugs and slots of interfaces whose auto-connections were
+	// suppressed at install time are left to be connected explicitly
+	if len(snapsup.SuppressedAutoConnectInterfaces) > 0 {
+		plugs, slots = withoutSuppressedInterfaces(plugs, slots, snapsup.SuppressedAutoConnectInterfaces)
+	}
+
 	conflictError := func(retry *state.Retry, err error) error {
 		if retry != nil {
 			task.Logf("Waiting for conflicting change in progress: %s", retry.Reason)
@@ -1561,6 +1568,26 @@ func (m *InterfaceManager) doAutoConnect(task *state.Task, _ *tomb.Tomb) error {
 	return nil
 }
 
+// withoutSuppressedInterfaces returns the given plugs and slots without
+// those of the listed interfaces. Plugs connecting to the slots of the system
+// snap are dropped as well, the interfaces were checked to be known and not
+// to be required by the snap when the suppression was requested.
+func withoutSuppressedInterfaces(plugs []*snap.PlugInfo, slots []*snap.SlotInfo, suppressed []string) ([]*snap.PlugInfo, []*snap.SlotInfo) {
+	var keptPlugs []*snap.PlugInfo
+	for _, plug := range plugs {
+		if !strutil.ListContains(suppressed, plug.Interface) {
+			keptPlugs = append(keptPlugs, plug)
+		}
+	}
+	var keptSlots []*snap.SlotInfo
+	for _, slot := range slots {
+		if !strutil.ListContains(suppressed, slot.Interface) {
+			keptSlots = append(keptSlots, slot)
+		}
+	}
+	return keptPlugs, keptSlots
+}
+
 // doAutoDisconnect creates tasks for disconnecting all interfaces of a snap and running its interface hooks.
 func (m *InterfaceManager) doAutoDisconnect(task *state.Task, _ *tomb.Tomb) error {
 	st := task.State()
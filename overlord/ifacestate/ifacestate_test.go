@@ -3031,6 +3031,102 @@ func (s *interfaceManagerSuite) TestDoSetupSnapSecurityAutoConnectsPlugs(c *C) {
 	c.Assert(ifaces.Connections, HasLen, 1) //FIXME add deep eq
 }
 
+// The auto-connect task will not auto-connect plugs of suppressed interfaces,
+// even to the slots of the system snap.
+func (s *interfaceManagerSuite) TestDoSetupSnapSecurityAutoConnectsPlugsSuppressed(c *C) {
+	s.MockModel(c, nil)
+
+	// Add an OS snap.
+	s.mockSnap(c, ubuntuCoreSnapYaml)
+
+	// Initialize the manager. This registers the OS snap.
+	mgr := s.manager(c)
+
+	// Add a sample snap with a "network" plug which would be auto-connected.
+	snapInfo := s.mockSnap(c, sampleSnapYaml)
+
+	// Run the setup-snap-security task and let it finish.
+	change := s.addSetupSnapSecurityChange(c, &snapstate.SnapSetup{
+		SideInfo: &snap.SideInfo{
+			RealName: snapInfo.SnapName(),
+			Revision: snapInfo.Revision,
+		},
+		SuppressedAutoConnectInterfaces: []string{"network"},
+	})
+	s.settle(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Assert(change.Status(), Equals, state.DoneStatus)
+
+	// no connect task was created for the suppressed interface
+	for _, t := range change.Tasks() {
+		c.Check(t.Kind(), Not(Equals), "connect")
+	}
+
+	var conns map[string]any
+	err := s.state.Get("conns", &conns)
+	c.Assert(err, testutil.ErrorIs, state.ErrNoState)
+
+	repo := mgr.Repository()
+	c.Check(repo.Interfaces().Connections, HasLen, 0)
+}
+
+// The auto-connect task will not auto-connect slots of suppressed interfaces,
+// other interfaces are still auto-connected.
+func (s *interfaceManagerSuite) TestDoSetupSnapSecurityAutoConnectsSlotsSuppressed(c *C) {
+	s.MockModel(c, nil)
+
+	s.mockIfaces(&ifacetest.TestInterface{InterfaceName: "test"}, &ifacetest.TestInterface{InterfaceName: "test2"})
+	s.mockSnap(c, ubuntuCoreSnapYaml)
+	s.mockSnap(c, consumerYaml)
+
+	mgr := s.manager(c)
+
+	snapInfo := s.mockSnap(c, `name: producer
+version: 1
+slots:
+ slot:
+  interface: test
+ slot2:
+  interface: test2
+`)
+
+	change := s.addSetupSnapSecurityChange(c, &snapstate.SnapSetup{
+		SideInfo: &snap.SideInfo{
+			RealName: snapInfo.SnapName(),
+			Revision: snapInfo.Revision,
+		},
+		SuppressedAutoConnectInterfaces: []string{"test"},
+	})
+	s.settle(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Assert(change.Status(), Equals, state.DoneStatus)
+
+	var connectTasks []*state.Task
+	for _, t := range change.Tasks() {
+		if t.Kind() == "connect" {
+			connectTasks = append(connectTasks, t)
+		}
+	}
+	c.Assert(connectTasks, HasLen, 1)
+	var plugRef interfaces.PlugRef
+	var slotRef interfaces.SlotRef
+	c.Assert(connectTasks[0].Get("plug", &plugRef), IsNil)
+	c.Assert(connectTasks[0].Get("slot", &slotRef), IsNil)
+	c.Check(plugRef, Equals, interfaces.PlugRef{Snap: "consumer", Name: "otherplug"})
+	c.Check(slotRef, Equals, interfaces.SlotRef{Snap: "producer", Name: "slot2"})
+
+	repo := mgr.Repository()
+	c.Check(repo.Interfaces().Connections, DeepEquals, []*interfaces.ConnRef{{
+		PlugRef: interfaces.PlugRef{Snap: "consumer", Name: "otherplug"},
+		SlotRef: interfaces.SlotRef{Snap: "producer", Name: "slot2"}}})
+}
+
 // The auto-connect task will auto-connect slots with viable candidates.
 func (s *interfaceManagerSuite) TestDoSetupSnapSecurityAutoConnectsSlots(c *C) {
 	s.MockModel(c, nil)
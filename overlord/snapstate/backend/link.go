@@ -26,14 +26,17 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/snapcore/snapd/boot"
 	"github.com/snapcore/snapd/cmd/snaplock/runinhibit"
+	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/progress"
 	"github.com/snapcore/snapd/sandbox/cgroup"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/quota"
 	"github.com/snapcore/snapd/timings"
 	"github.com/snapcore/snapd/wrappers"
 )
@@ -51,6 +54,20 @@ type LinkContext struct {
 	// ServiceOptions is used to configure services.
 	ServiceOptions *wrappers.SnapServiceOptions
 
+	// QuotaGroup, if set, is the quota group the services of the snap
+	// are placed into by LinkSnap, overriding the one of
+	// ServiceOptions. The slice units of the group are written along
+	// with the service units, and if LinkSnap fails the slice of the
+	// group is removed again if it was created by it.
+	QuotaGroup *quota.Group
+
+	// ServiceUnitMutator, if set, is used by LinkSnap to rewrite the
+	// generated .service units of the snap before they are written,
+	// overriding the one of ServiceOptions. The unit file names are
+	// unchanged, so the mutated units are removed as usual by UnlinkSnap
+	// or when LinkSnap is undone.
+	ServiceUnitMutator wrappers.ServiceUnitMutator
+
 	// RunInhibitHint is used only in Unlink snap, and can be used to
 	// establish run inhibition lock for refresh operations.
 	RunInhibitHint runinhibit.Hint
@@ -66,9 +83,83 @@ type LinkContext struct {
 	// icons and desktop files in UnlinkSnap
 	SkipBinaries bool
 
+	// SkipUserServices indicates that we should skip removing the user
+	// (daemon-scope: user) service units of the snap in UnlinkSnap, so
+	// that running user sessions are not disrupted
+	SkipUserServices bool
+
 	// HasOtherInstances indicates that other instances of the snap are
 	// already installed in the system.
 	HasOtherInstances bool
+
+	// ServiceStopTimeout is used only in UnlinkSnap. If set, the services
+	// of the snap are asked to stop and given up to this long to exit
+	// cleanly, services still running after that are killed with SIGKILL
+	// before their units are removed.
+	ServiceStopTimeout time.Duration
+
+	// SkipDBusActivation makes LinkSnap not generate the D-Bus
+	// activation files for the slots of the snap, files left by an
+	// earlier LinkSnap without this option are removed instead.
+	// UnlinkSnap and undoing LinkSnap always remove the activation
+	// files, regardless of this option.
+	SkipDBusActivation bool
+
+	// DesktopFilesDirOverride, if set, is the directory where the
+	// desktop files of the snap are put by LinkSnap and removed from by
+	// UnlinkSnap, instead of dirs.SnapDesktopFilesDir. This is useful
+	// when the latter is read-only.
+	DesktopFilesDirOverride string
+}
+
+// serviceOptions returns the options to configure the services of the snap
+// with.
+func (linkCtx LinkContext) serviceOptions() *wrappers.SnapServiceOptions {
+	if linkCtx.QuotaGroup == nil && linkCtx.ServiceUnitMutator == nil {
+		return linkCtx.ServiceOptions
+	}
+	var opts wrappers.SnapServiceOptions
+	if linkCtx.ServiceOptions != nil {
+		opts = *linkCtx.ServiceOptions
+	}
+	if linkCtx.QuotaGroup != nil {
+		opts.QuotaGroup = linkCtx.QuotaGroup
+	}
+	if linkCtx.ServiceUnitMutator != nil {
+		opts.ServiceUnitMutator = linkCtx.ServiceUnitMutator
+	}
+	return &opts
+}
+
+// newQuotaSlice returns the quota group of linkCtx if its slice unit does
+// not exist yet, i.e. if it is going to be created by LinkSnap.
+func newQuotaSlice(linkCtx LinkContext) *quota.Group {
+	grp := linkCtx.QuotaGroup
+	if grp == nil || osutil.FileExists(filepath.Join(dirs.SnapServicesDir, grp.SliceFileName())) {
+		return nil
+	}
+	return grp
+}
+
+// removeQuotaSlice removes the slice unit of the quota group created by a
+// failed LinkSnap, if any.
+func removeQuotaSlice(grp *quota.Group) {
+	// slices of groups with sub-groups are still in use by them
+	if grp == nil || len(grp.SubGroups) != 0 {
+		return
+	}
+	if err := wrappers.RemoveQuotaGroup(grp, progress.Null); err != nil {
+		logger.Noticef("Cannot remove slice of quota group %q: %v", grp.Name, err)
+	}
+}
+
+// desktopFilesDir returns the directory where the desktop files of the snap
+// are put.
+func (linkCtx LinkContext) desktopFilesDir() string {
+	if linkCtx.DesktopFilesDirOverride != "" {
+		return linkCtx.DesktopFilesDirOverride
+	}
+	return dirs.SnapDesktopFilesDir
 }
 
 func createSharedSnapDirForParallelInstance(s snap.PlaceInfo) error {
@@ -161,7 +252,28 @@ func (b Backend) MaybeSetNextBoot(info *snap.Info, dev snap.Device, isUndo bool)
 	}
 
 	bootCtx := boot.NextBootContext{BootWithoutTry: isUndo}
-	return boot.Participant(info, info.Type(), dev).SetNextBoot(bootCtx)
+	rebootInfo, err := boot.Participant(info, info.Type(), dev).SetNextBoot(bootCtx)
+	if err != nil {
+		return boot.RebootInfo{}, err
+	}
+	if rebootInfo.RebootRequired && rebootInfo.Reason == "" {
+		rebootInfo.Reason = rebootReason(info.Type())
+	}
+	return rebootInfo, nil
+}
+
+// rebootReason returns the reason for a reboot required when linking a snap
+// of the given type.
+func rebootReason(typ snap.Type) boot.RebootReason {
+	switch typ {
+	case snap.TypeOS, snap.TypeBase:
+		return boot.RebootReasonBase
+	case snap.TypeKernel:
+		return boot.RebootReasonKernel
+	case snap.TypeGadget:
+		return boot.RebootReasonGadget
+	}
+	return ""
 }
 
 // LinkSnap makes the snap available by generating wrappers and setting the current symlinks.
@@ -180,10 +292,12 @@ func (b Backend) LinkSnap(info *snap.Info, dev snap.Device, linkCtx LinkContext,
 
 	var err error
 	var restart wrappers.SnapdRestart
+	newSlice := newQuotaSlice(linkCtx)
 	timings.Run(tm, "generate-wrappers", fmt.Sprintf("generate wrappers for snap %s", info.InstanceName()), func(timings.Measurer) {
 		restart, err = b.generateWrappers(info, linkCtx)
 	})
 	if err != nil {
+		removeQuotaSlice(newSlice)
 		return err
 	}
 	defer func() {
@@ -192,6 +306,7 @@ func (b Backend) LinkSnap(info *snap.Info, dev snap.Device, linkCtx LinkContext,
 		}
 		timings.Run(tm, "remove-wrappers", fmt.Sprintf("remove wrappers of snap %s", info.InstanceName()), func(timings.Measurer) {
 			removeGeneratedWrappers(info, linkCtx, progress.Null)
+			removeQuotaSlice(newSlice)
 		})
 	}()
 
@@ -291,7 +406,7 @@ func (b Backend) generateWrappers(s *snap.Info, linkCtx LinkContext) (wrappers.S
 		RequireMountedSnapdSnap: linkCtx.RequireMountedSnapdSnap,
 	}
 	if err = wrappers.EnsureSnapServices(map[*snap.Info]*wrappers.SnapServiceOptions{
-		s: linkCtx.ServiceOptions,
+		s: linkCtx.serviceOptions(),
 	}, ensureOpts, nil, progress.Null); err != nil {
 		return nil, err
 	}
@@ -300,16 +415,27 @@ func (b Backend) generateWrappers(s *snap.Info, linkCtx LinkContext) (wrappers.S
 	})
 
 	// add D-Bus service activation files
-	if err = wrappers.AddSnapDBusActivationFiles(s); err != nil {
-		return nil, err
+	if linkCtx.SkipDBusActivation {
+		// drop the files that an earlier link without the option
+		// might have left behind
+		if err = wrappers.RemoveSnapDBusActivationFiles(s); err != nil {
+			return nil, err
+		}
+	} else {
+		if err = wrappers.AddSnapDBusActivationFiles(s); err != nil {
+			return nil, err
+		}
+		cleanupFuncs = append(cleanupFuncs, wrappers.RemoveSnapDBusActivationFiles)
 	}
-	cleanupFuncs = append(cleanupFuncs, wrappers.RemoveSnapDBusActivationFiles)
 
 	// add the desktop files
-	if err = wrappers.EnsureSnapDesktopFiles([]*snap.Info{s}); err != nil {
+	desktopFilesDir := linkCtx.desktopFilesDir()
+	if err = wrappers.EnsureSnapDesktopFilesInDir(desktopFilesDir, []*snap.Info{s}); err != nil {
 		return nil, err
 	}
-	cleanupFuncs = append(cleanupFuncs, wrappers.RemoveSnapDesktopFiles)
+	cleanupFuncs = append(cleanupFuncs, func(s *snap.Info) error {
+		return wrappers.RemoveSnapDesktopFilesFromDir(desktopFilesDir, s)
+	})
 
 	// add the desktop icons
 	if err = wrappers.EnsureSnapIcons(s); err != nil {
@@ -332,7 +458,7 @@ func removeGeneratedWrappers(s *snap.Info, linkCtx LinkContext, meter progress.M
 			logger.Noticef("Cannot remove binaries for %q: %v", s.InstanceName(), err1)
 		}
 
-		err2 = wrappers.RemoveSnapDesktopFiles(s)
+		err2 = wrappers.RemoveSnapDesktopFilesFromDir(linkCtx.desktopFilesDir(), s)
 		if err2 != nil {
 			logger.Noticef("Cannot remove desktop files for %q: %v", s.InstanceName(), err2)
 		}
@@ -343,12 +469,18 @@ func removeGeneratedWrappers(s *snap.Info, linkCtx LinkContext, meter progress.M
 		}
 	}
 
+	// the activation files are removed even if the snap is unlinked
+	// with SkipDBusActivation, as it might have been linked without
 	err4 := wrappers.RemoveSnapDBusActivationFiles(s)
 	if err4 != nil {
 		logger.Noticef("Cannot remove D-Bus activation for %q: %v", s.InstanceName(), err4)
 	}
 
-	err5 := wrappers.RemoveSnapServices(s, meter)
+	scope := wrappers.ServiceScopeAll
+	if linkCtx.SkipUserServices {
+		scope = wrappers.ServiceScopeSystem
+	}
+	err5 := wrappers.RemoveSnapServicesInScope(s, scope, meter)
 	if err5 != nil {
 		logger.Noticef("Cannot remove services for %q: %v", s.InstanceName(), err5)
 	}
@@ -396,6 +528,30 @@ func (b Backend) UnlinkSnap(info *snap.Info, linkCtx LinkContext, meter progress
 		err0 = runinhibit.LockWithHint(info.InstanceName(), hint, inhibitInfo, linkCtx.StateUnlocker)
 	}
 
+	// give services a chance to shut down gracefully
+	var errStop error
+	if linkCtx.ServiceStopTimeout > 0 && info.Type() != snap.TypeSnapd {
+		reason := snap.StopReasonRemove
+		if linkCtx.RunInhibitHint == runinhibit.HintInhibitedForRefresh {
+			reason = snap.StopReasonRefresh
+		}
+		// only the services still linked are stopped, making this a
+		// no-op when unlinking again
+		var svcs []*snap.AppInfo
+		for _, app := range info.Services() {
+			if osutil.FileExists(app.ServiceFile()) {
+				svcs = append(svcs, app)
+			}
+		}
+		if len(svcs) != 0 {
+			opts := &wrappers.StopServicesOptions{Timeout: linkCtx.ServiceStopTimeout}
+			errStop = wrappers.StopServices(svcs, opts, reason, meter, timings.New(nil))
+			if errStop != nil {
+				logger.Noticef("Cannot stop services for %q: %v", info.InstanceName(), errStop)
+			}
+		}
+	}
+
 	// remove generated services, binaries etc
 	err1 := removeGeneratedWrappers(info, linkCtx, meter)
 
@@ -407,7 +563,97 @@ func (b Backend) UnlinkSnap(info *snap.Info, linkCtx LinkContext, meter progress
 	// last phase of snap removal
 
 	// FIXME: aggregate errors instead
-	return firstErr(err0, err1, err2)
+	return firstErr(err0, errStop, err1, err2)
+}
+
+// VerifyWrappers regenerates in memory the wrappers of the linked snap and
+// compares them against what is on disk, returning the paths of the
+// missing or mismatched wrapper files. Nothing on disk is modified.
+func (b Backend) VerifyWrappers(info *snap.Info, linkCtx LinkContext) ([]string, error) {
+	return wrappers.VerifySnapWrappers(info, linkCtx.serviceOptions(), b.snapWrappersOptions(linkCtx))
+}
+
+// snapWrappersOptions returns the options to verify or plan the wrappers
+// generated by LinkSnap with the given link context.
+func (b Backend) snapWrappersOptions(linkCtx LinkContext) *wrappers.SnapWrappersOptions {
+	return &wrappers.SnapWrappersOptions{
+		EnsureSnapServicesOptions: wrappers.EnsureSnapServicesOptions{
+			Preseeding:              b.preseed,
+			RequireMountedSnapdSnap: linkCtx.RequireMountedSnapdSnap,
+		},
+		SkipDBusActivation: linkCtx.SkipDBusActivation,
+		DesktopFilesDir:    linkCtx.desktopFilesDir(),
+	}
+}
+
+// LinkPlan lists the paths of the wrapper files that LinkSnap would
+// create for a snap, grouped by kind.
+type LinkPlan struct {
+	Binaries     []string
+	Services     []string
+	UserServices []string
+	DBusSystem   []string
+	DBusSession  []string
+	Desktop      []string
+	Icons        []string
+}
+
+// PlanLink returns the paths of the wrapper files that LinkSnap would
+// generate for the snap with the given link context. Nothing on disk is
+// modified and systemd is not invoked.
+func (b Backend) PlanLink(info *snap.Info, dev snap.Device, linkCtx LinkContext) (LinkPlan, error) {
+	plan, err := wrappers.PlanSnapWrappers(info, linkCtx.serviceOptions(), b.snapWrappersOptions(linkCtx))
+	if err != nil {
+		return LinkPlan{}, err
+	}
+
+	linkPlan := LinkPlan{
+		Binaries:     plan.Binaries,
+		Services:     plan.Services,
+		UserServices: plan.UserServices,
+		DBusSystem:   plan.DBusSystem,
+		DBusSession:  plan.DBusSession,
+		Desktop:      plan.Desktop,
+		Icons:        plan.Icons,
+	}
+	return linkPlan, nil
+}
+
+// IsLinked returns whether the snap is already linked at the given revision
+// with the given link context, that is whether its current symlinks point
+// at the revision and its wrappers are in place as LinkSnap would generate
+// them with linkCtx, see VerifyWrappers, so that a further LinkSnap could
+// be skipped. A half linked snap, with some wrappers missing or
+// mismatching, is reported as not linked. The snapd snap is never reported
+// as linked, as its wrappers are not tracked here.
+func (b Backend) IsLinked(info *snap.Info, dev snap.Device, linkCtx LinkContext) (bool, error) {
+	if info.Revision.Unset() {
+		return false, fmt.Errorf("cannot check if snap %q with unset revision is linked", info.InstanceName())
+	}
+	if info.Type() == snap.TypeSnapd {
+		return false, nil
+	}
+
+	mountDir := info.MountDir()
+	dataDir := info.DataDir()
+	for _, dir := range []string{mountDir, dataDir} {
+		target, err := os.Readlink(filepath.Join(filepath.Dir(dir), "current"))
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if target != filepath.Base(dir) {
+			return false, nil
+		}
+	}
+
+	mismatched, err := b.VerifyWrappers(info, linkCtx)
+	if err != nil {
+		return false, err
+	}
+	return len(mismatched) == 0, nil
 }
 
 func (b Backend) QueryDisabledServices(info *snap.Info, pb progress.Meter) (*wrappers.DisabledServices, error) {
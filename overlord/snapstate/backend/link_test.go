@@ -28,6 +28,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	. "gopkg.in/check.v1"
 
@@ -157,6 +158,105 @@ apps:
 	c.Assert(l, HasLen, 0)
 }
 
+func (s *linkSuite) TestLinkDoUndoSkipDBusActivation(c *C) {
+	const yaml = `name: hello
+version: 1.0
+
+slots:
+  system-slot:
+    interface: dbus
+    bus: system
+    name: org.example.System
+  session-slot:
+    interface: dbus
+    bus: session
+    name: org.example.Session
+
+apps:
+ svc:
+   command: svc
+   daemon: simple
+ dbus-system:
+   daemon: simple
+   activates-on: [system-slot]
+ dbus-session:
+   daemon: simple
+   daemon-scope: user
+   activates-on: [session-slot]
+`
+	info := snaptest.MockSnap(c, yaml, &snap.SideInfo{Revision: snap.R(11)})
+
+	checkDBusFiles := func(n int) {
+		l, err := filepath.Glob(filepath.Join(dirs.SnapDBusSystemServicesDir, "*.service"))
+		c.Assert(err, IsNil)
+		c.Check(l, HasLen, n)
+		l, err = filepath.Glob(filepath.Join(dirs.SnapDBusSessionServicesDir, "*.service"))
+		c.Assert(err, IsNil)
+		c.Check(l, HasLen, n)
+	}
+
+	linkCtx := mockLinkContextWithStateUnlocker()
+	linkCtx.SkipDBusActivation = true
+	err := s.be.LinkSnap(info, mockDev, linkCtx, s.perfTimings)
+	c.Assert(err, IsNil)
+
+	// the services are generated, but not the activation files
+	l, err := filepath.Glob(filepath.Join(dirs.SnapServicesDir, "*.service"))
+	c.Assert(err, IsNil)
+	c.Check(l, HasLen, 2)
+	checkDBusFiles(0)
+
+	err = s.be.UnlinkSnap(info, backend.LinkContext{SkipDBusActivation: true}, progress.Null)
+	c.Assert(err, IsNil)
+	checkDBusFiles(0)
+
+	// files from a link without the option are dropped by a link with it
+	err = s.be.LinkSnap(info, mockDev, mockLinkContextWithStateUnlocker(), s.perfTimings)
+	c.Assert(err, IsNil)
+	checkDBusFiles(1)
+
+	err = s.be.LinkSnap(info, mockDev, linkCtx, s.perfTimings)
+	c.Assert(err, IsNil)
+	checkDBusFiles(0)
+
+	// and unlinking without the option copes with the missing files
+	err = s.be.UnlinkSnap(info, backend.LinkContext{}, progress.Null)
+	c.Assert(err, IsNil)
+	checkDBusFiles(0)
+	l, err = filepath.Glob(filepath.Join(dirs.SnapServicesDir, "*.service"))
+	c.Assert(err, IsNil)
+	c.Check(l, HasLen, 0)
+}
+
+func (s *linkSuite) TestUnlinkSkipDBusActivationRemovesFiles(c *C) {
+	const yaml = `name: hello
+version: 1.0
+
+slots:
+  system-slot:
+    interface: dbus
+    bus: system
+    name: org.example.System
+
+apps:
+ dbus-system:
+   daemon: simple
+   activates-on: [system-slot]
+`
+	info := snaptest.MockSnap(c, yaml, &snap.SideInfo{Revision: snap.R(11)})
+	activationFile := filepath.Join(dirs.SnapDBusSystemServicesDir, "org.example.System.service")
+
+	// linked without the option
+	err := s.be.LinkSnap(info, mockDev, mockLinkContextWithStateUnlocker(), s.perfTimings)
+	c.Assert(err, IsNil)
+	c.Check(activationFile, testutil.FilePresent)
+
+	// the activation files are removed when unlinking with it
+	err = s.be.UnlinkSnap(info, backend.LinkContext{SkipDBusActivation: true}, progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(activationFile, testutil.FileAbsent)
+}
+
 func (s *linkSuite) TestLinkDoUndoGenerateWrappersNoSkipBinaries(c *C) {
 	const yaml = `name: hello
 version: 1.0
@@ -270,6 +370,47 @@ Exec=foo
 	c.Check(l, HasLen, 2)
 }
 
+func (s *linkSuite) TestLinkDoUndoGenerateWrappersSkipUserServices(c *C) {
+	const yaml = `name: hello
+version: 1.0
+
+apps:
+ svc:
+   command: svc
+   daemon: simple
+ user-svc:
+   command: user-svc
+   daemon: simple
+   daemon-scope: user
+`
+	info := snaptest.MockSnap(c, yaml, &snap.SideInfo{Revision: snap.R(11)})
+
+	err := s.be.LinkSnap(info, mockDev, mockLinkContextWithStateUnlocker(), s.perfTimings)
+	c.Assert(err, IsNil)
+
+	svcFile := filepath.Join(dirs.SnapServicesDir, "snap.hello.svc.service")
+	userSvcFile := filepath.Join(dirs.SnapUserServicesDir, "snap.hello.user-svc.service")
+	c.Check(svcFile, testutil.FilePresent)
+	c.Check(userSvcFile, testutil.FilePresent)
+
+	// unlink should skip the user services, also when repeated
+	linkCtx := backend.LinkContext{
+		SkipUserServices: true,
+	}
+	for i := 0; i < 2; i++ {
+		err = s.be.UnlinkSnap(info, linkCtx, progress.Null)
+		c.Assert(err, IsNil)
+
+		c.Check(svcFile, testutil.FileAbsent)
+		c.Check(userSvcFile, testutil.FilePresent)
+	}
+
+	// a regular unlink removes them
+	err = s.be.UnlinkSnap(info, backend.LinkContext{}, progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(userSvcFile, testutil.FileAbsent)
+}
+
 func (s *linkSuite) TestLinkDoUndoCurrentSymlink(c *C) {
 	const yaml = `name: hello
 version: 1.0
@@ -381,7 +522,7 @@ type: base
 	isUndo := false
 	reboot, err := s.be.MaybeSetNextBoot(info, coreDev, isUndo)
 	c.Assert(err, IsNil)
-	c.Check(reboot, Equals, boot.RebootInfo{RebootRequired: true})
+	c.Check(reboot, Equals, boot.RebootInfo{RebootRequired: true, Reason: boot.RebootReasonBase})
 }
 
 func (s *linkSuite) TestLinkNoSetNextBootWhenPreseeding(c *C) {
@@ -537,6 +678,122 @@ apps:
 	c.Check(filepath.Join(runinhibit.InhibitDir, "hello.lock"), testutil.FileAbsent)
 }
 
+func (s *linkSuite) TestIsLinked(c *C) {
+	const yaml = `name: hello
+version: 1.0
+apps:
+ bin:
+   command: bin
+ svc:
+   command: svc
+   daemon: simple
+`
+	info := snaptest.MockSnap(c, yaml, &snap.SideInfo{Revision: snap.R(11)})
+	guiDir := filepath.Join(info.MountDir(), "meta", "gui")
+	c.Assert(os.MkdirAll(guiDir, 0755), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(guiDir, "bin.desktop"), []byte(`
+[Desktop Entry]
+Name=bin
+Exec=hello.bin
+`), 0644), IsNil)
+
+	linked, err := s.be.IsLinked(info, mockDev, backend.LinkContext{})
+	c.Assert(err, IsNil)
+	c.Check(linked, Equals, false)
+
+	err = s.be.LinkSnap(info, mockDev, mockLinkContextWithStateUnlocker(), s.perfTimings)
+	c.Assert(err, IsNil)
+
+	linked, err = s.be.IsLinked(info, mockDev, backend.LinkContext{})
+	c.Assert(err, IsNil)
+	c.Check(linked, Equals, true)
+
+	// another revision is not linked
+	otherInfo := snaptest.MockSnap(c, yaml, &snap.SideInfo{Revision: snap.R(12)})
+	linked, err = s.be.IsLinked(otherInfo, mockDev, backend.LinkContext{})
+	c.Assert(err, IsNil)
+	c.Check(linked, Equals, false)
+
+	// half linked, with a wrapper missing
+	desktopFile := filepath.Join(dirs.SnapDesktopFilesDir, "hello_bin.desktop")
+	c.Assert(os.Remove(desktopFile), IsNil)
+	linked, err = s.be.IsLinked(info, mockDev, backend.LinkContext{})
+	c.Assert(err, IsNil)
+	c.Check(linked, Equals, false)
+
+	// linking again fixes it
+	err = s.be.LinkSnap(info, mockDev, mockLinkContextWithStateUnlocker(), s.perfTimings)
+	c.Assert(err, IsNil)
+	linked, err = s.be.IsLinked(info, mockDev, backend.LinkContext{})
+	c.Assert(err, IsNil)
+	c.Check(linked, Equals, true)
+
+	err = s.be.UnlinkSnap(info, backend.LinkContext{}, progress.Null)
+	c.Assert(err, IsNil)
+	linked, err = s.be.IsLinked(info, mockDev, backend.LinkContext{})
+	c.Assert(err, IsNil)
+	c.Check(linked, Equals, false)
+}
+
+func (s *linkSuite) TestIsLinkedWithLinkContext(c *C) {
+	const yaml = `name: hello
+version: 1.0
+
+slots:
+  system-slot:
+    interface: dbus
+    bus: system
+    name: org.example.System
+
+apps:
+ bin:
+   command: bin
+ svc:
+   command: svc
+   daemon: simple
+   activates-on: [system-slot]
+`
+	info := snaptest.MockSnap(c, yaml, &snap.SideInfo{Revision: snap.R(11)})
+	guiDir := filepath.Join(info.MountDir(), "meta", "gui")
+	c.Assert(os.MkdirAll(guiDir, 0755), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(guiDir, "bin.desktop"), []byte(`
+[Desktop Entry]
+Name=bin
+Exec=hello.bin
+`), 0644), IsNil)
+
+	linkCtx := mockLinkContextWithStateUnlocker()
+	linkCtx.ServiceOptions = &wrappers.SnapServiceOptions{VitalityRank: 1}
+	linkCtx.SkipDBusActivation = true
+	linkCtx.DesktopFilesDirOverride = filepath.Join(c.MkDir(), "applications")
+	err := s.be.LinkSnap(info, mockDev, linkCtx, s.perfTimings)
+	c.Assert(err, IsNil)
+
+	linked, err := s.be.IsLinked(info, mockDev, linkCtx)
+	c.Assert(err, IsNil)
+	c.Check(linked, Equals, true)
+
+	// the wrappers generated with another link context do not match
+	linked, err = s.be.IsLinked(info, mockDev, backend.LinkContext{})
+	c.Assert(err, IsNil)
+	c.Check(linked, Equals, false)
+
+	// a tampered wrapper is reported as not linked
+	svcFile := filepath.Join(dirs.SnapServicesDir, "snap.hello.svc.service")
+	c.Assert(os.WriteFile(svcFile, []byte("[Service]\nExecStart=/bin/evil\n"), 0644), IsNil)
+	linked, err = s.be.IsLinked(info, mockDev, linkCtx)
+	c.Assert(err, IsNil)
+	c.Check(linked, Equals, false)
+}
+
+func (s *linkSuite) TestIsLinkedUnsetRevision(c *C) {
+	info := &snap.Info{
+		SuggestedName: "foo",
+	}
+	_, err := s.be.IsLinked(info, mockDev, backend.LinkContext{})
+	c.Assert(err, ErrorMatches, `cannot check if snap "foo" with unset revision is linked`)
+}
+
 func (s *linkSuite) TestLinkFailsForUnsetRevision(c *C) {
 	info := &snap.Info{
 		SuggestedName: "foo",
@@ -710,12 +967,114 @@ func (s *linkCleanupSuite) TestLinkCleanupOnDesktopFail(c *C) {
 	s.testLinkCleanupDirOnFail(c, dirs.SnapDesktopFilesDir)
 }
 
+func (s *linkCleanupSuite) TestLinkDesktopFilesDirOverride(c *C) {
+	// the default directory is read-only
+	c.Assert(os.Chmod(dirs.SnapDesktopFilesDir, 0555), IsNil)
+	defer os.Chmod(dirs.SnapDesktopFilesDir, 0755)
+
+	linkCtx := mockLinkContextWithStateUnlocker()
+	linkCtx.DesktopFilesDirOverride = filepath.Join(c.MkDir(), "applications")
+
+	err := s.be.LinkSnap(s.info, mockDev, linkCtx, s.perfTimings)
+	c.Assert(err, IsNil)
+
+	c.Check(filepath.Join(linkCtx.DesktopFilesDirOverride, "hello_bin.desktop"), testutil.FilePresent)
+	l, err := filepath.Glob(filepath.Join(dirs.SnapDesktopFilesDir, "*"))
+	c.Assert(err, IsNil)
+	c.Check(l, HasLen, 0)
+
+	err = s.be.UnlinkSnap(s.info, backend.LinkContext{DesktopFilesDirOverride: linkCtx.DesktopFilesDirOverride}, progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(filepath.Join(linkCtx.DesktopFilesDirOverride, "hello_bin.desktop"), testutil.FileAbsent)
+}
+
+func (s *linkCleanupSuite) TestLinkCleanupOnIconsFailDesktopFilesDirOverride(c *C) {
+	// icons are put in place after the desktop files, make that fail
+	c.Assert(os.MkdirAll(filepath.Dir(dirs.SnapDesktopIconsDir), 0755), IsNil)
+	c.Assert(os.WriteFile(dirs.SnapDesktopIconsDir, nil, 0644), IsNil)
+
+	linkCtx := mockLinkContextWithStateUnlocker()
+	linkCtx.DesktopFilesDirOverride = filepath.Join(c.MkDir(), "applications")
+
+	err := s.be.LinkSnap(s.info, mockDev, linkCtx, s.perfTimings)
+	c.Assert(err, NotNil)
+
+	// the partially written desktop files are removed from the override
+	for _, d := range []string{linkCtx.DesktopFilesDirOverride, dirs.SnapBinariesDir, dirs.SnapDesktopFilesDir, dirs.SnapServicesDir} {
+		l, err := filepath.Glob(filepath.Join(d, "*"))
+		c.Check(err, IsNil, Commentf(d))
+		c.Check(l, HasLen, 0, Commentf(d))
+	}
+}
+
+func (s *linkCleanupSuite) TestLinkCleanupQuotaGroupSlice(c *C) {
+	grp, err := quota.NewGroup("foogroup", quota.NewResourcesBuilder().WithMemoryLimit(quantity.SizeMiB).Build())
+	c.Assert(err, IsNil)
+
+	// make putting the icons in place, which comes after the services,
+	// fail
+	c.Assert(os.MkdirAll(filepath.Dir(dirs.SnapDesktopIconsDir), 0755), IsNil)
+	c.Assert(os.WriteFile(dirs.SnapDesktopIconsDir, nil, 0644), IsNil)
+
+	linkCtx := mockLinkContextWithStateUnlocker()
+	linkCtx.QuotaGroup = grp
+	err = s.be.LinkSnap(s.info, mockDev, linkCtx, s.perfTimings)
+	c.Assert(err, NotNil)
+
+	// the slice created for the group is removed along with the services
+	l, err := filepath.Glob(filepath.Join(dirs.SnapServicesDir, "*"))
+	c.Assert(err, IsNil)
+	c.Check(l, HasLen, 0)
+
+	// but a slice that existed before is left alone
+	sliceFile := filepath.Join(dirs.SnapServicesDir, "snap.foogroup.slice")
+	c.Assert(os.WriteFile(sliceFile, nil, 0644), IsNil)
+
+	err = s.be.LinkSnap(s.info, mockDev, linkCtx, s.perfTimings)
+	c.Assert(err, NotNil)
+	c.Check(sliceFile, testutil.FilePresent)
+	c.Check(filepath.Join(dirs.SnapServicesDir, "snap.hello.svc.service"), testutil.FileAbsent)
+}
+
 func (s *linkCleanupSuite) TestLinkCleanupOnBinariesFail(c *C) {
 	// this one is the trivial case _as the code stands today_,
 	// but nothing guarantees that ordering.
 	s.testLinkCleanupDirOnFail(c, dirs.SnapBinariesDir)
 }
 
+func (s *linkCleanupSuite) TestLinkCleanupOnServicesFailMidway(c *C) {
+	var sysdLog [][]string
+	restore := systemd.MockSystemctl(func(cmd ...string) ([]byte, error) {
+		sysdLog = append(sysdLog, cmd)
+		return []byte("ActiveState=inactive\n"), nil
+	})
+	defer restore()
+
+	// the units of the D-Bus activated services are written before the
+	// one of svc, make writing the latter fail
+	svcUnit := filepath.Join(dirs.SnapServicesDir, "snap.hello.svc.service")
+	c.Assert(os.MkdirAll(svcUnit, 0755), IsNil)
+
+	err := s.be.LinkSnap(s.info, mockDev, mockLinkContextWithStateUnlocker(), s.perfTimings)
+	c.Assert(err, NotNil)
+
+	// the units written before the failure are removed
+	c.Check(filepath.Join(dirs.SnapServicesDir, "snap.hello.dbus-system.service"), testutil.FileAbsent)
+	c.Check(filepath.Join(dirs.SnapUserServicesDir, "snap.hello.dbus-session.service"), testutil.FileAbsent)
+	c.Check(sysdLog, DeepEquals, [][]string{{"daemon-reload"}})
+
+	// as are the binaries generated in the previous step, while the
+	// wrappers of the following steps are never generated
+	for _, d := range []string{dirs.SnapBinariesDir, dirs.SnapDesktopFilesDir, dirs.SnapUserServicesDir, dirs.SnapDBusSystemServicesDir, dirs.SnapDBusSessionServicesDir, dirs.SnapDesktopIconsDir} {
+		l, err := filepath.Glob(filepath.Join(d, "*"))
+		c.Check(err, IsNil, Commentf(d))
+		c.Check(l, HasLen, 0, Commentf(d))
+	}
+	l, err := filepath.Glob(filepath.Join(dirs.SnapServicesDir, "*"))
+	c.Check(err, IsNil)
+	c.Check(l, DeepEquals, []string{svcUnit})
+}
+
 func (s *linkCleanupSuite) TestLinkCleanupOnServicesFail(c *C) {
 	s.testLinkCleanupDirOnFail(c, dirs.SnapServicesDir)
 }
@@ -1083,6 +1442,101 @@ apps:
 		"\nSlice=snap.foogroup.slice\n")
 }
 
+func (s *linkSuite) TestLinkQuotaGroup(c *C) {
+	const yaml = `name: hello
+version: 1.0
+
+apps:
+ svc:
+   command: svc
+   daemon: simple
+`
+	info := snaptest.MockSnap(c, yaml, &snap.SideInfo{Revision: snap.R(11)})
+
+	grp, err := quota.NewGroup("foogroup", quota.NewResourcesBuilder().WithMemoryLimit(quantity.SizeMiB).Build())
+	c.Assert(err, IsNil)
+
+	linkCtx := mockLinkContextWithStateUnlocker()
+	linkCtx.ServiceOptions = &wrappers.SnapServiceOptions{VitalityRank: 1}
+	linkCtx.QuotaGroup = grp
+	err = s.be.LinkSnap(info, mockDev, linkCtx, s.perfTimings)
+	c.Assert(err, IsNil)
+	svcFile := filepath.Join(dirs.SnapServicesDir, "snap.hello.svc.service")
+	c.Check(svcFile, testutil.FileContains, "\nSlice=snap.foogroup.slice\n")
+	c.Check(svcFile, testutil.FileContains, "\nOOMScoreAdjust=-899\n")
+	c.Check(filepath.Join(dirs.SnapServicesDir, "snap.foogroup.slice"), testutil.FilePresent)
+}
+
+func (s *linkSuite) TestLinkServiceUnitMutator(c *C) {
+	const yaml = `name: hello
+version: 1.0
+
+apps:
+ svc:
+   command: svc
+   daemon: simple
+`
+	info := snaptest.MockSnap(c, yaml, &snap.SideInfo{Revision: snap.R(11)})
+
+	var mutated []string
+	linkCtx := mockLinkContextWithStateUnlocker()
+	linkCtx.ServiceOptions = &wrappers.SnapServiceOptions{VitalityRank: 1}
+	linkCtx.ServiceUnitMutator = func(app *snap.AppInfo, unit string) (string, error) {
+		mutated = append(mutated, app.Name)
+		return strings.Replace(unit, "[Unit]\n", "[Unit]\nAfter=external.service\n", 1), nil
+	}
+	err := s.be.LinkSnap(info, mockDev, linkCtx, s.perfTimings)
+	c.Assert(err, IsNil)
+	c.Check(mutated, DeepEquals, []string{"svc"})
+	svcFile := filepath.Join(dirs.SnapServicesDir, "snap.hello.svc.service")
+	c.Check(svcFile, testutil.FileContains, "[Unit]\nAfter=external.service\n")
+	c.Check(svcFile, testutil.FileContains, "\nOOMScoreAdjust=-899\n")
+
+	// the mutated unit is considered up to date
+	missing, err := s.be.VerifyWrappers(info, linkCtx)
+	c.Assert(err, IsNil)
+	c.Check(missing, HasLen, 0)
+
+	err = s.be.UnlinkSnap(info, backend.LinkContext{}, progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(svcFile, testutil.FileAbsent)
+}
+
+func (s *linkSuite) TestLinkServiceUnitMutatorErrors(c *C) {
+	const yaml = `name: hello
+version: 1.0
+
+apps:
+ svc:
+   command: svc
+   daemon: simple
+`
+	info := snaptest.MockSnap(c, yaml, &snap.SideInfo{Revision: snap.R(11)})
+	svcFile := filepath.Join(dirs.SnapServicesDir, "snap.hello.svc.service")
+
+	for _, tc := range []struct {
+		mutate func(app *snap.AppInfo, unit string) (string, error)
+		err    string
+	}{{
+		mutate: func(app *snap.AppInfo, unit string) (string, error) {
+			return "", errors.New("boom")
+		},
+		err: `cannot rewrite service unit snap.hello.svc.service: boom`,
+	}, {
+		mutate: func(app *snap.AppInfo, unit string) (string, error) {
+			return strings.Replace(unit, "X-Snappy=yes\n", "", 1), nil
+		},
+		err: `cannot rewrite service unit snap.hello.svc.service: X-Snappy=yes marker missing from the \[Unit\] section`,
+	}} {
+		linkCtx := mockLinkContextWithStateUnlocker()
+		linkCtx.ServiceUnitMutator = tc.mutate
+		err := s.be.LinkSnap(info, mockDev, linkCtx, s.perfTimings)
+		c.Check(err, ErrorMatches, tc.err)
+		c.Check(svcFile, testutil.FileAbsent)
+		c.Check(filepath.Join(info.MountDir(), "..", "current"), testutil.FileAbsent)
+	}
+}
+
 type OverridenSnapdRestart struct {
 	callback func() error
 }
@@ -1279,3 +1733,362 @@ func (s *linkSuite) TestUnlinkSnapNilStateUnlockerError(c *C) {
 	err := s.be.UnlinkSnap(nil, backend.LinkContext{RunInhibitHint: "not-nil"}, nil)
 	c.Assert(err, ErrorMatches, "internal error: LinkContext.StateUnlocker cannot be nil if LinkContext.RunInhibitHint is set")
 }
+
+func (s *linkSuite) testUnlinkSnapServiceStopTimeout(c *C, timeout time.Duration) [][]string {
+	const yaml = `name: hello
+version: 1.0
+apps:
+ svc:
+   command: svc
+   daemon: simple
+`
+	info := snaptest.MockSnap(c, yaml, &snap.SideInfo{Revision: snap.R(11)})
+	err := s.be.LinkSnap(info, mockDev, mockLinkContextWithStateUnlocker(), s.perfTimings)
+	c.Assert(err, IsNil)
+
+	var sysdLog [][]string
+	restore := systemd.MockSystemctl(func(cmd ...string) ([]byte, error) {
+		sysdLog = append(sysdLog, cmd)
+		return []byte("ActiveState=inactive\n"), nil
+	})
+	defer restore()
+
+	err = s.be.UnlinkSnap(info, backend.LinkContext{ServiceStopTimeout: timeout}, progress.Null)
+	c.Assert(err, IsNil)
+
+	l, err := filepath.Glob(filepath.Join(dirs.SnapServicesDir, "*.service"))
+	c.Assert(err, IsNil)
+	c.Check(l, HasLen, 0)
+	return sysdLog
+}
+
+func (s *linkSuite) TestUnlinkSnapServiceStopTimeout(c *C) {
+	sysdLog := s.testUnlinkSnapServiceStopTimeout(c, 5*time.Second)
+	c.Assert(len(sysdLog) >= 2, Equals, true)
+	c.Check(sysdLog[:2], DeepEquals, [][]string{
+		{"stop", "--no-block", "snap.hello.svc.service"},
+		{"show", "--property=ActiveState", "snap.hello.svc.service"},
+	})
+}
+
+func (s *linkSuite) TestUnlinkSnapServiceStopTimeoutExceeded(c *C) {
+	const yaml = `name: hello
+version: 1.0
+apps:
+ svc:
+   command: svc
+   daemon: simple
+`
+	info := snaptest.MockSnap(c, yaml, &snap.SideInfo{Revision: snap.R(11)})
+	err := s.be.LinkSnap(info, mockDev, mockLinkContextWithStateUnlocker(), s.perfTimings)
+	c.Assert(err, IsNil)
+
+	// the service never exits on its own
+	var sysdLog [][]string
+	restore := systemd.MockSystemctl(func(cmd ...string) ([]byte, error) {
+		sysdLog = append(sysdLog, cmd)
+		return []byte("ActiveState=deactivating\n"), nil
+	})
+	defer restore()
+
+	err = s.be.UnlinkSnap(info, backend.LinkContext{ServiceStopTimeout: 10 * time.Millisecond}, progress.Null)
+	c.Assert(err, IsNil)
+
+	// the service is killed and stopped before its unit is removed
+	var ops [][]string
+	for _, cmd := range sysdLog {
+		if cmd[0] != "show" {
+			ops = append(ops, cmd)
+		}
+	}
+	c.Assert(len(ops) >= 3, Equals, true)
+	c.Check(ops[:3], DeepEquals, [][]string{
+		{"stop", "--no-block", "snap.hello.svc.service"},
+		{"kill", "snap.hello.svc.service", "-s", "KILL", "--kill-who=all"},
+		{"stop", "snap.hello.svc.service"},
+	})
+	c.Check(filepath.Join(dirs.SnapServicesDir, "snap.hello.svc.service"), testutil.FileAbsent)
+}
+
+func (s *linkSuite) TestUnlinkSnapServiceStopTimeoutStopFailedButInactive(c *C) {
+	const yaml = `name: hello
+version: 1.0
+apps:
+ svc:
+   command: svc
+   daemon: simple
+`
+	info := snaptest.MockSnap(c, yaml, &snap.SideInfo{Revision: snap.R(11)})
+	err := s.be.LinkSnap(info, mockDev, mockLinkContextWithStateUnlocker(), s.perfTimings)
+	c.Assert(err, IsNil)
+
+	restore := systemd.MockSystemctl(func(cmd ...string) ([]byte, error) {
+		if cmd[0] == "stop" {
+			return nil, errors.New("mock stop error")
+		}
+		return []byte(`Type=simple
+Id=snap.hello.svc.service
+Names=snap.hello.svc.service
+ActiveState=inactive
+UnitFileState=enabled
+NeedDaemonReload=no
+`), nil
+	})
+	defer restore()
+
+	// as without the timeout, a failure to stop a service that is not
+	// running does not fail the unlink
+	err = s.be.UnlinkSnap(info, backend.LinkContext{ServiceStopTimeout: 5 * time.Second}, progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(filepath.Join(dirs.SnapServicesDir, "snap.hello.svc.service"), testutil.FileAbsent)
+}
+
+func (s *linkSuite) TestUnlinkSnapNoServiceStopTimeout(c *C) {
+	sysdLog := s.testUnlinkSnapServiceStopTimeout(c, 0)
+	for _, cmd := range sysdLog {
+		c.Check(cmd[0], Not(Equals), "stop")
+	}
+}
+
+func (s *linkSuite) TestUnlinkSnapServiceStopTimeoutIdempotent(c *C) {
+	s.testUnlinkSnapServiceStopTimeout(c, 5*time.Second)
+
+	var sysdLog [][]string
+	restore := systemd.MockSystemctl(func(cmd ...string) ([]byte, error) {
+		sysdLog = append(sysdLog, cmd)
+		return nil, fmt.Errorf("unit not loaded")
+	})
+	defer restore()
+
+	info := snaptest.MockSnap(c, `name: hello
+version: 1.0
+apps:
+ svc:
+   command: svc
+   daemon: simple
+`, &snap.SideInfo{Revision: snap.R(11)})
+
+	// the services are gone already, nothing is stopped
+	err := s.be.UnlinkSnap(info, backend.LinkContext{ServiceStopTimeout: 5 * time.Second}, progress.Null)
+	c.Assert(err, IsNil)
+	for _, cmd := range sysdLog {
+		c.Check(cmd[0], Not(Equals), "stop")
+	}
+}
+
+func (s *linkSuite) TestVerifyWrappers(c *C) {
+	const yaml = `name: hello
+version: 1.0
+
+slots:
+  system-slot:
+    interface: dbus
+    bus: system
+    name: org.example.System
+
+apps:
+ bin:
+   command: bin
+ svc:
+   command: svc
+   daemon: simple
+ dbus-system:
+   daemon: simple
+   activates-on: [system-slot]
+`
+	info := snaptest.MockSnap(c, yaml, &snap.SideInfo{Revision: snap.R(11)})
+	guiDir := filepath.Join(info.MountDir(), "meta", "gui")
+	c.Assert(os.MkdirAll(filepath.Join(guiDir, "icons", "hicolor", "scalable", "apps"), 0755), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(guiDir, "bin.desktop"), []byte(`
+[Desktop Entry]
+Name=bin
+Exec=hello.bin
+`), 0644), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(guiDir, "icons", "hicolor", "scalable", "apps", "snap.hello.svg"), []byte("icon"), 0644), IsNil)
+
+	linkCtx := mockLinkContextWithStateUnlocker()
+	err := s.be.LinkSnap(info, mockDev, linkCtx, s.perfTimings)
+	c.Assert(err, IsNil)
+
+	mismatched, err := s.be.VerifyWrappers(info, linkCtx)
+	c.Assert(err, IsNil)
+	c.Check(mismatched, HasLen, 0)
+
+	// tamper with the service unit, and remove the binary, the desktop
+	// file, the icon and the D-Bus activation file
+	svcFile := filepath.Join(dirs.SnapServicesDir, "snap.hello.svc.service")
+	c.Assert(os.WriteFile(svcFile, []byte("[Service]\nExecStart=/bin/evil\n"), 0644), IsNil)
+	binFile := filepath.Join(dirs.SnapBinariesDir, "hello.bin")
+	desktopFile := filepath.Join(dirs.SnapDesktopFilesDir, "hello_bin.desktop")
+	iconFile := filepath.Join(dirs.SnapDesktopIconsDir, "hicolor", "scalable", "apps", "snap.hello.svg")
+	dbusFile := filepath.Join(dirs.SnapDBusSystemServicesDir, "org.example.System.service")
+	for _, fn := range []string{binFile, desktopFile, iconFile, dbusFile} {
+		c.Assert(os.Remove(fn), IsNil)
+	}
+
+	mismatched, err = s.be.VerifyWrappers(info, linkCtx)
+	c.Assert(err, IsNil)
+	c.Check(mismatched, DeepEquals, []string{
+		svcFile,
+		dbusFile,
+		desktopFile,
+		iconFile,
+		binFile,
+	})
+
+	// nothing was repaired
+	c.Check(svcFile, testutil.FileEquals, "[Service]\nExecStart=/bin/evil\n")
+	c.Check(binFile, testutil.FileAbsent)
+}
+
+func (s *linkSuite) TestVerifyWrappersSkipDBusActivation(c *C) {
+	const yaml = `name: hello
+version: 1.0
+
+slots:
+  system-slot:
+    interface: dbus
+    bus: system
+    name: org.example.System
+
+apps:
+ dbus-system:
+   daemon: simple
+   activates-on: [system-slot]
+`
+	info := snaptest.MockSnap(c, yaml, &snap.SideInfo{Revision: snap.R(11)})
+
+	linkCtx := mockLinkContextWithStateUnlocker()
+	linkCtx.SkipDBusActivation = true
+	err := s.be.LinkSnap(info, mockDev, linkCtx, s.perfTimings)
+	c.Assert(err, IsNil)
+
+	// the activation files are not expected
+	mismatched, err := s.be.VerifyWrappers(info, linkCtx)
+	c.Assert(err, IsNil)
+	c.Check(mismatched, HasLen, 0)
+}
+
+func (s *linkSuite) TestVerifyWrappersDesktopFilesDirOverride(c *C) {
+	const yaml = `name: hello
+version: 1.0
+
+apps:
+ bin:
+   command: bin
+`
+	info := snaptest.MockSnap(c, yaml, &snap.SideInfo{Revision: snap.R(11)})
+	guiDir := filepath.Join(info.MountDir(), "meta", "gui")
+	c.Assert(os.MkdirAll(guiDir, 0755), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(guiDir, "bin.desktop"), []byte(`
+[Desktop Entry]
+Name=bin
+Exec=hello.bin
+`), 0644), IsNil)
+
+	linkCtx := mockLinkContextWithStateUnlocker()
+	linkCtx.DesktopFilesDirOverride = filepath.Join(c.MkDir(), "applications")
+	err := s.be.LinkSnap(info, mockDev, linkCtx, s.perfTimings)
+	c.Assert(err, IsNil)
+
+	// the desktop file is expected in the override directory
+	mismatched, err := s.be.VerifyWrappers(info, linkCtx)
+	c.Assert(err, IsNil)
+	c.Check(mismatched, HasLen, 0)
+
+	desktopFile := filepath.Join(linkCtx.DesktopFilesDirOverride, "hello_bin.desktop")
+	c.Assert(os.Remove(desktopFile), IsNil)
+	mismatched, err = s.be.VerifyWrappers(info, linkCtx)
+	c.Assert(err, IsNil)
+	c.Check(mismatched, DeepEquals, []string{desktopFile})
+}
+
+func (s *linkSuite) TestVerifyWrappersSnapdSnap(c *C) {
+	info := snaptest.MockSnap(c, "name: snapd\nversion: 1\ntype: snapd\n", &snap.SideInfo{Revision: snap.R(11)})
+
+	_, err := s.be.VerifyWrappers(info, backend.LinkContext{})
+	c.Assert(err, ErrorMatches, "internal error: verifying wrappers of the snapd snap is unsupported")
+}
+
+func (s *linkSuite) TestPlanLink(c *C) {
+	const yaml = `name: hello
+version: 1.0
+
+slots:
+  system-slot:
+    interface: dbus
+    bus: system
+    name: org.example.System
+  session-slot:
+    interface: dbus
+    bus: session
+    name: org.example.Session
+
+apps:
+ bin:
+   command: bin
+ svc:
+   command: svc
+   daemon: simple
+   activates-on: [system-slot]
+ user-svc:
+   command: user-svc
+   daemon: simple
+   daemon-scope: user
+   activates-on: [session-slot]
+`
+	info := snaptest.MockSnap(c, yaml, &snap.SideInfo{Revision: snap.R(11)})
+	guiDir := filepath.Join(info.MountDir(), "meta", "gui")
+	c.Assert(os.MkdirAll(filepath.Join(guiDir, "icons", "hicolor", "scalable", "apps"), 0755), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(guiDir, "bin.desktop"), []byte(`
+[Desktop Entry]
+Name=bin
+Exec=hello.bin
+`), 0644), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(guiDir, "icons", "hicolor", "scalable", "apps", "snap.hello.svg"), []byte("icon"), 0644), IsNil)
+
+	var sysdLog [][]string
+	restore := systemd.MockSystemctl(func(cmd ...string) ([]byte, error) {
+		sysdLog = append(sysdLog, cmd)
+		return []byte("ActiveState=inactive\n"), nil
+	})
+	defer restore()
+
+	linkCtx := mockLinkContextWithStateUnlocker()
+	plan, err := s.be.PlanLink(info, mockDev, linkCtx)
+	c.Assert(err, IsNil)
+	c.Check(plan, DeepEquals, backend.LinkPlan{
+		Binaries:     []string{filepath.Join(dirs.SnapBinariesDir, "hello.bin")},
+		Services:     []string{filepath.Join(dirs.SnapServicesDir, "snap.hello.svc.service")},
+		UserServices: []string{filepath.Join(dirs.SnapUserServicesDir, "snap.hello.user-svc.service")},
+		DBusSystem:   []string{filepath.Join(dirs.SnapDBusSystemServicesDir, "org.example.System.service")},
+		DBusSession:  []string{filepath.Join(dirs.SnapDBusSessionServicesDir, "org.example.Session.service")},
+		Desktop:      []string{filepath.Join(dirs.SnapDesktopFilesDir, "hello_bin.desktop")},
+		Icons:        []string{filepath.Join(dirs.SnapDesktopIconsDir, "hicolor", "scalable", "apps", "snap.hello.svg")},
+	})
+
+	// nothing was written and systemd was not invoked
+	for _, paths := range [][]string{plan.Binaries, plan.Services, plan.UserServices, plan.DBusSystem, plan.DBusSession, plan.Desktop, plan.Icons} {
+		for _, path := range paths {
+			c.Check(path, testutil.FileAbsent)
+		}
+	}
+	c.Check(sysdLog, HasLen, 0)
+
+	// the link context is honoured
+	desktopDir := filepath.Join(c.MkDir(), "applications")
+	linkCtx.SkipDBusActivation = true
+	linkCtx.DesktopFilesDirOverride = desktopDir
+	plan, err = s.be.PlanLink(info, mockDev, linkCtx)
+	c.Assert(err, IsNil)
+	c.Check(plan.DBusSystem, HasLen, 0)
+	c.Check(plan.DBusSession, HasLen, 0)
+	c.Check(plan.Desktop, DeepEquals, []string{filepath.Join(desktopDir, "hello_bin.desktop")})
+}
+
+func (s *linkSuite) TestPlanLinkSnapdSnap(c *C) {
+	info := snaptest.MockSnap(c, "name: snapd\nversion: 1\ntype: snapd\n", &snap.SideInfo{Revision: snap.R(11)})
+
+	_, err := s.be.PlanLink(info, mockDev, backend.LinkContext{})
+	c.Assert(err, ErrorMatches, "internal error: planning wrappers of the snapd snap is unsupported")
+}
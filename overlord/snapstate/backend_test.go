@@ -211,6 +211,10 @@ type fakeStore struct {
 	idsToNames         map[string]string
 
 	mutateSnapInfo func(*snap.Info) error
+
+	// unavailableRevnos maps snap ids to a revision that is not available
+	// when requested on refresh
+	unavailableRevnos map[string]snap.Revision
 }
 
 func (f *fakeStore) registerID(name, id string) {
@@ -868,6 +872,10 @@ func (f *fakeStore) SnapAction(ctx context.Context, currentSnaps []*store.Curren
 			refreshErrors[cur.InstanceName] = err
 			continue
 		}
+		if !a.Revision.Unset() && a.Revision == f.unavailableRevnos[a.SnapID] {
+			refreshErrors[cur.InstanceName] = &store.RevisionNotAvailableError{}
+			continue
+		}
 		if err != nil {
 			return nil, nil, err
 		}
@@ -1368,7 +1376,19 @@ func (f *fakeSnappyBackend) MaybeSetNextBoot(
 			(f.linkSnapRebootFor != nil && f.linkSnapRebootFor[info.InstanceName()])
 	}
 
-	return boot.RebootInfo{RebootRequired: reboot}, nil
+	var reason boot.RebootReason
+	if reboot {
+		switch info.Type() {
+		case snap.TypeKernel:
+			reason = boot.RebootReasonKernel
+		case snap.TypeBase, snap.TypeOS:
+			reason = boot.RebootReasonBase
+		case snap.TypeGadget:
+			reason = boot.RebootReasonGadget
+		}
+	}
+
+	return boot.RebootInfo{RebootRequired: reboot, Reason: reason}, nil
 }
 
 func (f *fakeSnappyBackend) LinkSnap(info *snap.Info, dev snap.Device, linkCtx backend.LinkContext, tm timings.Measurer) (err error) {
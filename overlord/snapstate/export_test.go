@@ -78,6 +78,12 @@ func MockReadComponentInfo(mock func(compMntDir string, snapInfo *snap.Info, csi
 	return func() { readComponentInfoAt = old }
 }
 
+func MockURLInstallMaxSize(size int64) (restore func()) {
+	old := urlInstallMaxSize
+	urlInstallMaxSize = size
+	return func() { urlInstallMaxSize = old }
+}
+
 func MockMountPollInterval(intv time.Duration) (restore func()) {
 	old := mountPollInterval
 	mountPollInterval = intv
@@ -547,6 +553,14 @@ func MockEnforceValidationSets(f func(*state.State, map[string]*asserts.Validati
 	}
 }
 
+func MockResolveLocalValidationSets(f func(*state.State, map[string][]string) (map[string]*asserts.ValidationSet, error)) func() {
+	old := ResolveLocalValidationSets
+	ResolveLocalValidationSets = f
+	return func() {
+		ResolveLocalValidationSets = old
+	}
+}
+
 func MockEnforceLocalValidationSets(f func(*state.State, map[string][]string, map[string]int, []*snapasserts.InstalledSnap, map[string]bool) error) func() {
 	old := EnforceLocalValidationSets
 	EnforceLocalValidationSets = f
@@ -706,6 +706,21 @@ func sendOneInstallActionUnlocked(ctx context.Context, st *state.State, snaps St
 	return sendOneInstallAction(ctx, st, snaps, opts)
 }
 
+// downloadRateLimit returns the rate limit to use when downloading for
+// the given snap setup or 0 if there is no limit. When both the
+// auto-refresh rate limit and the one requested by the operation apply
+// the most restrictive one is used.
+func downloadRateLimit(st *state.State, snapsup *SnapSetup) int64 {
+	rate := snapsup.DownloadRateLimit
+	if snapsup.IsAutoRefresh {
+		// NOTE rate is never negative
+		if autoRate := autoRefreshRateLimited(st); autoRate != 0 && (rate == 0 || autoRate < rate) {
+			rate = autoRate
+		}
+	}
+	return rate
+}
+
 // autoRefreshRateLimited returns the rate limit of auto-refreshes or 0 if
 // there is no limit.
 func autoRefreshRateLimited(st *state.State) (rate int64) {
@@ -745,6 +760,34 @@ func downloadSnapParams(st *state.State, t *state.Task) (*SnapSetup, StoreServic
 	return snapsup, sto, user, nil
 }
 
+// cachedSnapBlob returns the path of the blob in the download cache that
+// matches the download info of the snap, if it prefers cached blobs. Blobs
+// whose digest or size don't match are not used, so that the snap is
+// downloaded again instead.
+func cachedSnapBlob(snapsup *SnapSetup) (string, bool) {
+	dlInfo := snapsup.DownloadInfo
+	if !snapsup.PreferCached || dlInfo.Sha3_384 == "" {
+		return "", false
+	}
+
+	path := filepath.Join(dirs.SnapDownloadCacheDir, dlInfo.Sha3_384)
+	if !osutil.FileExists(path) {
+		return "", false
+	}
+
+	digest, size, err := asserts.SnapFileSHA3_384(path)
+	if err != nil {
+		logger.Noticef("cannot use cached snap blob %q: %v", path, err)
+		return "", false
+	}
+	if digest != dlInfo.Sha3_384 || (dlInfo.Size != 0 && size != uint64(dlInfo.Size)) {
+		logger.Noticef("cannot use cached snap blob %q: digest or size mismatch", path)
+		return "", false
+	}
+
+	return path, true
+}
+
 func (m *SnapManager) doDownloadSnap(t *state.Task, tomb *tomb.Tomb) error {
 	st := t.State()
 	var rate int64
@@ -752,9 +795,8 @@ func (m *SnapManager) doDownloadSnap(t *state.Task, tomb *tomb.Tomb) error {
 	st.Lock()
 	perfTimings := state.TimingsForTask(t)
 	snapsup, theStore, user, err := downloadSnapParams(st, t)
-	if snapsup != nil && snapsup.IsAutoRefresh {
-		// NOTE rate is never negative
-		rate = autoRefreshRateLimited(st)
+	if snapsup != nil {
+		rate = downloadRateLimit(st, snapsup)
 	}
 	st.Unlock()
 	if err != nil {
@@ -804,6 +846,15 @@ func (m *SnapManager) doDownloadSnap(t *state.Task, tomb *tomb.Tomb) error {
 		if err != nil {
 			return err
 		}
+	} else if cached, ok := cachedSnapBlob(snapsup); ok {
+		// the blob matches what the store expects, there is no need to
+		// download it again
+		if err := os.MkdirAll(filepath.Dir(targetFn), 0755); err != nil {
+			return err
+		}
+		if err := osutil.CopyFile(cached, targetFn, osutil.CopyFlagOverwrite); err != nil {
+			return fmt.Errorf("cannot copy cached snap blob: %v", err)
+		}
 	} else {
 		ctx := tomb.Context(nil) // XXX: should this be a real context?
 		timings.Run(perfTimings, "download", fmt.Sprintf("download snap %q", snapsup.SnapName()), func(timings.Measurer) {
@@ -2492,6 +2543,15 @@ func (m *SnapManager) doLinkSnap(t *state.Task, _ *tomb.Tomb) (err error) {
 		}
 	}
 
+	// hold the newly installed snap from auto-refreshes if requested
+	if firstInstall && snapsup.RefreshHoldUntil != nil {
+		if holdDuration := snapsup.RefreshHoldUntil.Sub(timeNow()); holdDuration > 0 {
+			if _, err := HoldRefresh(st, HoldAutoRefresh, "system", holdDuration, snapsup.InstanceName()); err != nil {
+				return err
+			}
+		}
+	}
+
 	// abort any snap monitoring that may have started in a pre-download task
 	abortMonitoring(st, snapsup.InstanceName())
 
@@ -2517,6 +2577,9 @@ func (m *SnapManager) doLinkSnap(t *state.Task, _ *tomb.Tomb) (err error) {
 			return err
 		}
 		rebootInfo.RebootRequired = needsReboot
+		if needsReboot {
+			rebootInfo.Reason = boot.RebootReasonGadget
+		}
 	}
 
 	// if we just installed a core snap, request a restart
@@ -2587,6 +2650,9 @@ func (m *SnapManager) finishTaskWithMaybeRestart(t *state.Task, status state.Sta
 	st := t.State()
 
 	if restartPoss.RebootRequired {
+		if restartPoss.Reason != "" {
+			t.Logf("System restart required by %s snap %q", restartPoss.Reason, restartPoss.info.InstanceName())
+		}
 		return FinishTaskWithRestart(t, status, restart.RestartSystem, &restartPoss.RebootInfo)
 	}
 
@@ -2883,6 +2949,11 @@ func (m *SnapManager) undoLinkSnap(t *state.Task, _ *tomb.Tomb) error {
 		if err := m.removeSnapCookie(st, snapsup.InstanceName()); err != nil {
 			return fmt.Errorf("cannot remove snap cookie: %v", err)
 		}
+		if snapsup.RefreshHoldUntil != nil {
+			if err := pruneSnapsHold(st, snapsup.InstanceName()); err != nil {
+				return err
+			}
+		}
 	}
 
 	linkCtx := backend.LinkContext{
@@ -186,10 +186,7 @@ func (m *SnapManager) doDownloadComponent(t *state.Task, tomb *tomb.Tomb) error
 		return fmt.Errorf("cannot get user for user ID %d: %w", snapsup.UserID, err)
 	}
 
-	var rate int64
-	if snapsup.IsAutoRefresh {
-		rate = autoRefreshRateLimited(st)
-	}
+	rate := downloadRateLimit(st, snapsup)
 
 	target := compsup.BlobPath(snapsup.InstanceName())
 
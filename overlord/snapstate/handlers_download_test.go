@@ -20,6 +20,7 @@
 package snapstate_test
 
 import (
+	"os"
 	"path/filepath"
 	"time"
 
@@ -393,6 +394,76 @@ func (s *downloadSnapSuite) TestDoDownloadSnapNormal(c *C) {
 	})
 }
 
+func (s *downloadSnapSuite) testDoDownloadSnapPreferCached(c *C, cached []byte, preferCached, expectCached bool) {
+	s.state.Lock()
+
+	blob := filepath.Join(c.MkDir(), "blob")
+	c.Assert(os.WriteFile(blob, []byte("some-snap-blob"), 0644), IsNil)
+	digest, size, err := asserts.SnapFileSHA3_384(blob)
+	c.Assert(err, IsNil)
+
+	c.Assert(os.MkdirAll(dirs.SnapDownloadCacheDir, 0755), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dirs.SnapDownloadCacheDir, digest), cached, 0644), IsNil)
+
+	si := &snap.SideInfo{
+		RealName: "foo",
+		SnapID:   "mySnapID",
+		Revision: snap.R(11),
+	}
+	t := s.state.NewTask("download-snap", "test")
+	t.Set("snap-setup", &snapstate.SnapSetup{
+		SideInfo: si,
+		DownloadInfo: &snap.DownloadInfo{
+			DownloadURL: "http://some-url.com/snap",
+			Sha3_384:    digest,
+			Size:        int64(size),
+		},
+		PreferCached: preferCached,
+	})
+	chg := s.state.NewChange("sample", "...")
+	chg.AddTask(t)
+
+	s.state.Unlock()
+
+	s.se.Ensure()
+	s.se.Wait()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Assert(chg.Err(), IsNil)
+
+	target := filepath.Join(dirs.SnapBlobDir, "foo_11.snap")
+	var snapsup snapstate.SnapSetup
+	t.Get("snap-setup", &snapsup)
+	c.Check(snapsup.SnapPath, Equals, target)
+
+	if expectCached {
+		c.Check(s.fakeBackend.ops, HasLen, 0)
+		c.Check(target, testutil.FileEquals, "some-snap-blob")
+	} else {
+		c.Check(s.fakeBackend.ops, DeepEquals, fakeOps{
+			{
+				op:   "storesvc-download",
+				name: "foo",
+			},
+		})
+	}
+}
+
+func (s *downloadSnapSuite) TestDoDownloadSnapPreferCached(c *C) {
+	s.testDoDownloadSnapPreferCached(c, []byte("some-snap-blob"), true, true)
+}
+
+func (s *downloadSnapSuite) TestDoDownloadSnapPreferCachedNotRequested(c *C) {
+	s.testDoDownloadSnapPreferCached(c, []byte("some-snap-blob"), false, false)
+}
+
+func (s *downloadSnapSuite) TestDoDownloadSnapPreferCachedHashMismatch(c *C) {
+	// a corrupted blob in the cache falls back to downloading the snap
+	s.testDoDownloadSnapPreferCached(c, []byte("corrupted-blob"), true, false)
+}
+
 func (s *downloadSnapSuite) TestDoDownloadSnapWithDeviceContext(c *C) {
 	s.state.Lock()
 
@@ -477,6 +548,67 @@ func (s *downloadSnapSuite) TestDoUndoDownloadSnap(c *C) {
 
 }
 
+func (s *downloadSnapSuite) testDoDownloadRequestedRateLimit(c *C, autoRefresh bool, configured string, expectedRate int64) {
+	s.state.Lock()
+
+	if configured != "" {
+		tr := config.NewTransaction(s.state)
+		tr.Set("core", "refresh.rate-limit", configured)
+		tr.Commit()
+	}
+
+	si := &snap.SideInfo{
+		RealName: "foo",
+		SnapID:   "foo-id",
+		Revision: snap.R(11),
+	}
+	t := s.state.NewTask("download-snap", "test")
+	t.Set("snap-setup", &snapstate.SnapSetup{
+		SideInfo: si,
+		DownloadInfo: &snap.DownloadInfo{
+			DownloadURL: "http://some-url.com/snap",
+		},
+		Flags: snapstate.Flags{
+			IsAutoRefresh: autoRefresh,
+		},
+		DownloadRateLimit: 4096,
+	})
+	s.state.NewChange("sample", "...").AddTask(t)
+
+	s.state.Unlock()
+
+	s.se.Ensure()
+	s.se.Wait()
+
+	c.Assert(s.fakeStore.downloads, DeepEquals, []fakeDownload{
+		{
+			name:   "foo",
+			target: filepath.Join(dirs.SnapBlobDir, "foo_11.snap"),
+			opts: &store.DownloadOptions{
+				RateLimit: expectedRate,
+				Scheduled: autoRefresh,
+			},
+		},
+	})
+}
+
+func (s *downloadSnapSuite) TestDoDownloadRequestedRateLimit(c *C) {
+	// the auto-refresh rate limit does not apply to manual operations
+	s.testDoDownloadRequestedRateLimit(c, false, "1234B", 4096)
+}
+
+func (s *downloadSnapSuite) TestDoDownloadRequestedRateLimitAutoRefreshLower(c *C) {
+	s.testDoDownloadRequestedRateLimit(c, true, "1234B", 1234)
+}
+
+func (s *downloadSnapSuite) TestDoDownloadRequestedRateLimitAutoRefreshHigher(c *C) {
+	s.testDoDownloadRequestedRateLimit(c, true, "8192B", 4096)
+}
+
+func (s *downloadSnapSuite) TestDoDownloadRequestedRateLimitAutoRefreshUnset(c *C) {
+	s.testDoDownloadRequestedRateLimit(c, true, "", 4096)
+}
+
 func (s *downloadSnapSuite) TestDoDownloadRateLimitedIntegration(c *C) {
 	s.state.Lock()
 
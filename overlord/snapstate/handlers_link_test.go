@@ -1240,8 +1240,9 @@ func (s *linkSnapSuite) TestDoLinkSnapSuccessRebootForKernelClassicWithModes(c *
 	c.Check(restarting, Equals, false)
 	c.Check(t.Status(), Equals, state.WaitStatus)
 	c.Check(s.restartRequested, HasLen, 0)
-	c.Assert(t.Log(), HasLen, 1)
-	c.Check(t.Log()[0], Matches, `.* INFO Task set to wait until a system restart allows to continue`)
+	c.Assert(t.Log(), HasLen, 2)
+	c.Check(t.Log()[0], Matches, `.* INFO System restart required by kernel snap "kernel"`)
+	c.Check(t.Log()[1], Matches, `.* INFO Task set to wait until a system restart allows to continue`)
 }
 
 func (s *linkSnapSuite) TestDoLinkSnapSuccessRebootForCoreBaseSystemRestartImmediate(c *C) {
@@ -1391,7 +1392,8 @@ func (s *linkSnapSuite) TestDoLinkSnapSuccessGadgetDoesRequestsRestart(c *C) {
 	// Change enters wait-status, and a reboot has been requested
 	c.Check(t.Status(), Equals, state.WaitStatus)
 	c.Check(s.restartRequested, DeepEquals, []restart.RestartType{restart.RestartSystem})
-	c.Check(t.Log(), HasLen, 1)
+	c.Assert(t.Log(), HasLen, 2)
+	c.Check(t.Log()[0], Matches, `.* INFO System restart required by gadget snap "pc"`)
 }
 
 func (s *linkSnapSuite) TestDoLinkSnapFailGadgetDoesRequestsRestart(c *C) {
@@ -102,6 +102,9 @@ type SnapSetup struct {
 	Version string `json:"version,omitempty"`
 
 	CohortKey string `json:"cohort-key,omitempty"`
+	// CohortOverride is set if CohortKey was not used to install the
+	// snap because enforced validation sets pin it to a revision.
+	CohortOverride *CohortOverride `json:"cohort-override,omitempty"`
 
 	// FIXME: implement rename of this as suggested in
 	//  https://github.com/snapcore/snapd/pull/4103#discussion_r169569717
@@ -179,6 +182,23 @@ type SnapSetup struct {
 	// ComponentExclusiveOperation is set if this SnapSetup exists only to deal with
 	// components, and not the snap itself.
 	ComponentExclusiveOperation bool `json:"component-exclusive-operation,omitempty"`
+
+	// SuppressedAutoConnectInterfaces is a list of interfaces for which
+	// auto-connections of the snap must not be established by the
+	// auto-connect task.
+	SuppressedAutoConnectInterfaces []string `json:"suppressed-auto-connect-interfaces,omitempty"`
+
+	// RefreshHoldUntil is set if the snap should be held from
+	// auto-refreshes by the system until the given time once installed.
+	RefreshHoldUntil *time.Time `json:"refresh-hold-until,omitempty"`
+
+	// DownloadRateLimit is the rate limit in bytes per second requested
+	// for downloading the snap and its components, 0 means unlimited.
+	DownloadRateLimit int64 `json:"download-rate-limit,omitempty"`
+
+	// PreferCached is set if the snap blob should be taken from the
+	// download cache when a blob matching DownloadInfo is found there.
+	PreferCached bool `json:"prefer-cached,omitempty"`
 }
 
 // ConfdbSchemaID identifies a confdb schema.
@@ -139,6 +139,13 @@ type InsufficientSpaceError struct {
 	ChangeKind string
 	// Message is optional, otherwise one is composed from the other information
 	Message string
+	// Required is the disk space needed by the operation in bytes, if known
+	Required uint64
+	// Available is the disk space that was available at Path in bytes, if
+	// known
+	Available uint64
+	// MountPoint is the mount point of the filesystem holding Path, if known
+	MountPoint string
 }
 
 func (e *InsufficientSpaceError) Error() string {
@@ -1868,6 +1875,27 @@ func RefreshCandidates(st *state.State, user *auth.UserState) ([]*snap.Info, err
 	return plan.revisionChanges(st, opts)
 }
 
+// ConfinementChangeCandidates gets the list of candidates for update whose new
+// revision uses a different confinement than the installed revision.
+// Note that the state must be locked by the caller.
+func ConfinementChangeCandidates(st *state.State, user *auth.UserState) ([]*snap.Info, error) {
+	allSnaps, err := All(st)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := Options{
+		PrereqTracker: snap.SimplePrereqTracker{},
+	}
+
+	plan, err := storeUpdatePlan(context.TODO(), st, allSnaps, nil, user, nil, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return plan.confinementChanges(), nil
+}
+
 // ValidateRefreshes allows to hook validation into the handling of refresh candidates.
 var ValidateRefreshes func(st *state.State, refreshes []*snap.Info, ignoreValidation map[string]bool, userID int, deviceCtx DeviceContext) (validated []*snap.Info, err error)
 
@@ -2141,6 +2169,16 @@ func keys[K comparable, V any](m map[K]V) []K {
 // consider.
 type updateFilter = func(*snap.Info, *SnapState) bool
 
+// ConfinementChangeFilter returns an updateFilter that drops any update that
+// would change the confinement of an installed snap (for example, from strict
+// to classic). The snaps that are dropped by this filter can be found with
+// ConfinementChangeCandidates, so that they can be reviewed separately.
+func ConfinementChangeFilter() updateFilter {
+	return func(update *snap.Info, snapst *SnapState) bool {
+		return !confinementChanged(update, snapst)
+	}
+}
+
 func updateManyFiltered(ctx context.Context, st *state.State, names []string, revOpts []*RevisionOptions, userID int, filter updateFilter, flags *Flags, fromChange string) ([]string, *UpdateTaskSets, error) {
 	if flags == nil {
 		flags = &Flags{}
@@ -2281,7 +2319,29 @@ type UpdateTaskSets struct {
 	PreDownload []*state.TaskSet
 	// Refresh holds the refresh tasksets.
 	Refresh []*state.TaskSet
-}
+	// Skipped maps the instance names of the snaps that were left out of the
+	// refresh to the reason why, one of the SkipReason* constants. Snaps are
+	// left out because they are held or because of refresh control only when
+	// refreshing all snaps.
+	Skipped map[string]string
+	// NoUpdate lists, sorted, the requested snaps that have no update, that
+	// is neither a new revision nor a switch of channel or cohort, and that
+	// were not skipped either. It is always empty when refreshing all snaps.
+	NoUpdate []string
+}
+
+// Reasons for leaving a snap out of a refresh, as reported by
+// UpdateTaskSets.Skipped.
+const (
+	// SkipReasonHeld is used for snaps whose refreshes are held.
+	SkipReasonHeld = "held"
+	// SkipReasonRefreshControl is used for snaps whose refresh is not
+	// allowed by the refresh control of the snap declarations.
+	SkipReasonRefreshControl = "refresh-control"
+	// SkipReasonFiltered is used for snaps left out by the filter passed
+	// to UpdateWithGoal.
+	SkipReasonFiltered = "filtered"
+)
 
 // update contains the state of a snap before it is updated on the system and
 // the desired state of the snap.
@@ -2947,6 +3007,19 @@ type RevisionOptions struct {
 	ValidationSets *snapasserts.ValidationSets
 	CohortKey      string
 	LeaveCohort    bool
+	// MinRevision, if set, is the oldest revision that is acceptable when
+	// installing the snap from the store. The store has no notion of it,
+	// the revision it resolves is checked against it instead. It cannot be
+	// combined with Revision.
+	MinRevision snap.Revision
+	// MaxRevision, if set, is the newest revision that is acceptable when
+	// updating the snap from the store. If the store offers a newer revision,
+	// the maximum revision itself is requested instead, regardless of the
+	// tracked channel and dropping any cohort. If it isn't available, the
+	// newest local revision below it is used. The update is skipped if there
+	// is no such revision newer than the current one. It cannot be combined
+	// with Revision.
+	MaxRevision snap.Revision
 }
 
 func (r *RevisionOptions) setChannelIfUnset(channel string) {
@@ -3377,11 +3450,18 @@ func checkForAvailableSpace(totalSize uint64, infos []minimalInstallInfo, change
 		for i, up := range infos {
 			snaps[i] = up.InstanceName()
 		}
-		if _, ok := err.(*osutil.NotEnoughDiskSpaceError); ok {
+		if spaceErr, ok := err.(*osutil.NotEnoughDiskSpaceError); ok {
+			var available uint64
+			if spaceErr.Delta >= 0 && uint64(spaceErr.Delta) < requiredSpace {
+				available = requiredSpace - uint64(spaceErr.Delta)
+			}
 			return &InsufficientSpaceError{
 				Path:       rootDir,
 				Snaps:      snaps,
 				ChangeKind: changeKind,
+				Required:   requiredSpace,
+				Available:  available,
+				MountPoint: mountPointOf(rootDir),
 			}
 		}
 		return err
@@ -3389,6 +3469,27 @@ func checkForAvailableSpace(totalSize uint64, infos []minimalInstallInfo, change
 	return nil
 }
 
+// mountPointOf returns the mount point of the filesystem holding the given
+// path, or an empty string if it cannot be determined.
+func mountPointOf(path string) string {
+	entries, err := osutil.LoadMountInfo()
+	if err != nil {
+		return ""
+	}
+
+	var mountPoint string
+	for _, entry := range entries {
+		dir := entry.MountDir
+		if len(dir) <= len(mountPoint) {
+			continue
+		}
+		if path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/") {
+			mountPoint = dir
+		}
+	}
+	return mountPoint
+}
+
 // MigrateHome migrates a set of snaps to use a ~/Snap sub-directory as HOME.
 // The state must be locked by the caller.
 func MigrateHome(st *state.State, snaps []string) ([]*state.TaskSet, error) {
@@ -4388,80 +4489,17 @@ func RevertToRevision(st *state.State, name string, rev snap.Revision, flags Fla
 // - all interfaces are absolutely identical on both new and old
 // Do not use this as a general way to transition from snap A to snap B.
 func TransitionCore(st *state.State, oldName, newName string) ([]*state.TaskSet, error) {
-	var oldSnapst, newSnapst SnapState
-	err := Get(st, oldName, &oldSnapst)
-	if err != nil && !errors.Is(err, state.ErrNoState) {
+	var opts Options
+	if err := setDefaultSnapstateOptions(st, &opts); err != nil {
 		return nil, err
 	}
-	if !oldSnapst.IsInstalled() {
-		return nil, fmt.Errorf("cannot transition snap %q: not installed", oldName)
-	}
-
-	var all []*state.TaskSet
-	// install new core (if not already installed)
-	err = Get(st, newName, &newSnapst)
-	if err != nil && !errors.Is(err, state.ErrNoState) {
-		return nil, err
-	}
-	if !newSnapst.IsInstalled() {
-		enforced, err := EnforcedValidationSets(st)
-		if err != nil {
-			return nil, err
-		}
-
-		result, err := sendOneInstallAction(context.TODO(), st, StoreSnap{
-			InstanceName: newName,
-			RevOpts: RevisionOptions{
-				Channel:        oldSnapst.TrackingChannel,
-				ValidationSets: enforced,
-			},
-		}, Options{})
-		if err != nil {
-			return nil, err
-		}
-
-		newInfo := result.Info
-
-		// start by installing the new snap
-		tsInst, err := doInstall(st, &newSnapst, SnapSetup{
-			Channel:      oldSnapst.TrackingChannel,
-			DownloadInfo: &newInfo.DownloadInfo,
-			SideInfo:     &newInfo.SideInfo,
-			Type:         newInfo.Type(),
-			Version:      newInfo.Version,
-		}, nil, 0, "", nil, nil)
-		if err != nil {
-			return nil, err
-		}
-		all = append(all, tsInst)
-	}
-
-	// then transition the interface connections over
-	transIf := st.NewTask("transition-ubuntu-core", fmt.Sprintf(i18n.G("Transition security profiles from %q to %q"), oldName, newName))
-	transIf.Set("old-name", oldName)
-	transIf.Set("new-name", newName)
-	if len(all) > 0 {
-		transIf.WaitAll(all[0])
-	}
-	tsTrans := state.NewTaskSet(transIf)
-	all = append(all, tsTrans)
-
-	// FIXME: this is just here for the tests
-	transIf.Set("snap-setup", &SnapSetup{
-		SideInfo: &snap.SideInfo{
-			RealName: oldName,
-		},
-	})
 
-	// then remove the old snap
-	tsRm, err := Remove(st, oldName, snap.R(0), nil)
+	repl, err := TransitionGoal(oldName, newName).toReplace(context.TODO(), st, opts)
 	if err != nil {
 		return nil, err
 	}
-	tsRm.WaitFor(transIf)
-	all = append(all, tsRm)
 
-	return all, nil
+	return replaceTasks(st, repl, opts)
 }
 
 // State/info accessors
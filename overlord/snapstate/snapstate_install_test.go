@@ -4701,6 +4701,119 @@ func (s *validationSetsSuite) TestInstallSnapRequiredForValidationSetCohortIgnor
 	c.Assert(s.fakeBackend.ops[1], DeepEquals, expectedOp)
 }
 
+func (s *validationSetsSuite) installWithCohortReferencedByValidationSet(c *C, requiredRev, channel string) (*state.Task, *snapstate.SnapSetup) {
+	restore := snapstate.MockEnforcedValidationSets(func(st *state.State, extraVss ...*asserts.ValidationSet) (*snapasserts.ValidationSets, error) {
+		vs := snapasserts.NewValidationSets()
+		someSnap := map[string]any{
+			"id":       "yOqKhntON3vR7kwEbVPsILm7bUViPDzx",
+			"name":     "some-snap",
+			"presence": "required",
+		}
+		if requiredRev != "" {
+			someSnap["revision"] = requiredRev
+		}
+		vsa1 := s.mockValidationSetAssert(c, "bar", "1", someSnap)
+		vs.Add(vsa1.(*asserts.ValidationSet))
+		return vs, nil
+	})
+	defer restore()
+
+	tr := assertstate.ValidationSetTracking{
+		AccountID: "foo",
+		Name:      "bar",
+		Mode:      assertstate.Enforce,
+		Current:   1,
+	}
+	assertstate.UpdateValidationSet(s.state, &tr)
+
+	goal := snapstate.StoreInstallGoal(snapstate.StoreSnap{
+		InstanceName: "some-snap",
+		RevOpts: snapstate.RevisionOptions{
+			CohortKey: "cohortkey",
+			Channel:   channel,
+		},
+	})
+	_, tss, err := snapstate.InstallWithGoal(context.Background(), s.state, goal, snapstate.Options{})
+	c.Assert(err, IsNil)
+	c.Assert(tss, HasLen, 1)
+
+	first := tss[0].Tasks()[0]
+	snapsup, err := snapstate.TaskSnapSetup(first)
+	c.Assert(err, IsNil)
+	return first, snapsup
+}
+
+func (s *validationSetsSuite) TestInstallSnapRequiredForValidationSetCohortOverrideReported(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	first, snapsup := s.installWithCohortReferencedByValidationSet(c, "2", "")
+	c.Check(snapsup.Revision(), Equals, snap.R(2))
+	c.Check(snapsup.CohortOverride, DeepEquals, &snapstate.CohortOverride{
+		CohortKey:      "cohortkey",
+		ValidationSets: []snapasserts.ValidationSetKey{"16/foo/bar/1"},
+	})
+	c.Assert(first.Log(), HasLen, 1)
+	c.Check(first.Log()[0], Matches, `.* Cohort "cohortkey" of snap "some-snap" not used, revision pinned by validation sets: 16/foo/bar/1`)
+}
+
+func (s *validationSetsSuite) TestInstallSnapRequiredForValidationSetCohortNotOverridden(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	// the validation set doesn't pin a revision, the cohort is used
+	first, snapsup := s.installWithCohortReferencedByValidationSet(c, "", "")
+	c.Check(snapsup.CohortKey, Equals, "cohortkey")
+	c.Check(snapsup.CohortOverride, IsNil)
+	c.Check(first.Log(), HasLen, 0)
+}
+
+func (s *validationSetsSuite) TestInstallSnapRequiredForValidationSetCohortWithChannel(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	// both the cohort and the channel are sent to the store, so that the
+	// snap is installed from the cohort but restricted to the given risk
+	first, snapsup := s.installWithCohortReferencedByValidationSet(c, "", "candidate")
+	c.Check(snapsup.CohortKey, Equals, "cohortkey")
+	c.Check(snapsup.Channel, Equals, "candidate")
+	c.Check(snapsup.CohortOverride, IsNil)
+	c.Check(first.Log(), HasLen, 0)
+
+	c.Assert(s.fakeBackend.ops, HasLen, 2)
+	c.Check(s.fakeBackend.ops[1].action, DeepEquals, store.SnapAction{
+		Action:         "install",
+		InstanceName:   "some-snap",
+		Channel:        "candidate",
+		CohortKey:      "cohortkey",
+		ValidationSets: []snapasserts.ValidationSetKey{"16/foo/bar/1"},
+	})
+}
+
+func (s *validationSetsSuite) TestInstallSnapRequiredForValidationSetCohortWithChannelOverridden(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	// a revision pinned by the validation sets wins over both the cohort
+	// and the channel, dropping the cohort is reported
+	first, snapsup := s.installWithCohortReferencedByValidationSet(c, "2", "candidate")
+	c.Check(snapsup.Revision(), Equals, snap.R(2))
+	c.Check(snapsup.CohortOverride, DeepEquals, &snapstate.CohortOverride{
+		CohortKey:      "cohortkey",
+		ValidationSets: []snapasserts.ValidationSetKey{"16/foo/bar/1"},
+	})
+	c.Assert(first.Log(), HasLen, 1)
+	c.Check(first.Log()[0], Matches, `.* Cohort "cohortkey" of snap "some-snap" not used, revision pinned by validation sets: 16/foo/bar/1`)
+
+	c.Assert(s.fakeBackend.ops, HasLen, 2)
+	c.Check(s.fakeBackend.ops[1].action, DeepEquals, store.SnapAction{
+		Action:         "install",
+		InstanceName:   "some-snap",
+		Revision:       snap.R(2),
+		ValidationSets: []snapasserts.ValidationSetKey{"16/foo/bar/1"},
+	})
+}
+
 func (s *validationSetsSuite) TestInstallSnapReferencedByValidationSetWrongRevision(c *C) {
 	err := s.installSnapReferencedByValidationSet(c, "required", "3", snap.R(2), "", nil)
 	c.Assert(err, ErrorMatches, `cannot install snap "some-snap" at revision 2 without --ignore-validation, revision 3 is required by validation sets: 16/foo/bar/1`)
@@ -5133,6 +5246,84 @@ func (s *validationSetsSuite) TestInstallSnapInvalidByValidationSetIgnoreValidat
 	c.Assert(s.fakeBackend.ops[1], DeepEquals, expectedOp)
 }
 
+func (s *validationSetsSuite) installPathSnapReferencedByValidationSet(c *C, presence, requiredRev string, si *snap.SideInfo, flags snapstate.Flags) error {
+	restore := snapstate.MockEnforcedValidationSets(func(st *state.State, extraVss ...*asserts.ValidationSet) (*snapasserts.ValidationSets, error) {
+		vs := snapasserts.NewValidationSets()
+		someSnap := map[string]any{
+			"id":       "yOqKhntON3vR7kwEbVPsILm7bUViPDzx",
+			"name":     "some-snap",
+			"presence": presence,
+		}
+		if requiredRev != "" {
+			someSnap["revision"] = requiredRev
+		}
+		vsa1 := s.mockValidationSetAssert(c, "bar", "1", someSnap)
+		vs.Add(vsa1.(*asserts.ValidationSet))
+		return vs, nil
+	})
+	defer restore()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapPath := makeTestSnap(c, "name: some-snap\nversion: 1.0")
+	goal := snapstate.PathInstallGoal(snapstate.PathSnap{
+		Path:     snapPath,
+		SideInfo: si,
+	})
+
+	_, _, err := snapstate.InstallOne(context.Background(), s.state, goal, snapstate.Options{Flags: flags})
+	return err
+}
+
+func (s *validationSetsSuite) TestInstallPathSnapInvalidForValidationSetRefused(c *C) {
+	si := &snap.SideInfo{
+		RealName: "some-snap",
+		SnapID:   "yOqKhntON3vR7kwEbVPsILm7bUViPDzx",
+		Revision: snap.R(11),
+	}
+	err := s.installPathSnapReferencedByValidationSet(c, "invalid", "", si, snapstate.Flags{})
+	c.Assert(err, ErrorMatches, `cannot install snap "some-snap" due to enforcing rules of validation set 16/foo/bar/1`)
+
+	// but doesn't fail with ignore-validation flag
+	err = s.installPathSnapReferencedByValidationSet(c, "invalid", "", si, snapstate.Flags{IgnoreValidation: true})
+	c.Assert(err, IsNil)
+}
+
+func (s *validationSetsSuite) TestInstallPathSnapReferencedByValidationSetWrongRevision(c *C) {
+	si := &snap.SideInfo{
+		RealName: "some-snap",
+		SnapID:   "yOqKhntON3vR7kwEbVPsILm7bUViPDzx",
+		Revision: snap.R(11),
+	}
+	err := s.installPathSnapReferencedByValidationSet(c, "required", "3", si, snapstate.Flags{})
+	c.Assert(err, ErrorMatches, `cannot install snap "some-snap" at revision 11 without --ignore-validation, revision 3 is required by validation sets: 16/foo/bar/1`)
+
+	// but doesn't fail with ignore-validation flag
+	err = s.installPathSnapReferencedByValidationSet(c, "required", "3", si, snapstate.Flags{IgnoreValidation: true})
+	c.Assert(err, IsNil)
+}
+
+func (s *validationSetsSuite) TestInstallPathSnapRequiredForValidationSetAtRevision(c *C) {
+	si := &snap.SideInfo{
+		RealName: "some-snap",
+		SnapID:   "yOqKhntON3vR7kwEbVPsILm7bUViPDzx",
+		Revision: snap.R(3),
+	}
+	err := s.installPathSnapReferencedByValidationSet(c, "required", "3", si, snapstate.Flags{})
+	c.Assert(err, IsNil)
+}
+
+func (s *validationSetsSuite) TestInstallPathSnapUnassertedNotChecked(c *C) {
+	// unasserted snaps are not known to validation sets
+	si := &snap.SideInfo{
+		RealName: "some-snap",
+		Revision: snap.R(-1),
+	}
+	err := s.installPathSnapReferencedByValidationSet(c, "invalid", "", si, snapstate.Flags{})
+	c.Assert(err, IsNil)
+}
+
 func (s *validationSetsSuite) TestInstallSnapWithValidationSets(c *C) {
 	restore := snapstate.MockEnforcedValidationSets(func(st *state.State, extraVss ...*asserts.ValidationSet) (*snapasserts.ValidationSets, error) {
 		return nil, fmt.Errorf("unexpected")
@@ -358,6 +358,9 @@ SNAPD_APPARMOR_REEXEC=1
 	snapstate.AutoAliases = func(*state.State, *snap.Info) (map[string]string, error) {
 		return nil, nil
 	}
+	snapstate.FetchAndSaveDownloadAssertions = func(*state.State, *snap.Info, string, []snapstate.ComponentSetup, string, int, snapstate.DeviceContext) error {
+		return nil
+	}
 
 	s.AddCleanup(snapstate.MockSecurityProfilesDiscardLate(func(snapName string, rev snap.Revision, typ snap.Type) error {
 		return nil
@@ -377,6 +380,7 @@ func (s *snapmgrBaseTest) TearDownTest(c *C) {
 	snapstate.ValidateRefreshes = nil
 	snapstate.AutoAliases = nil
 	snapstate.CanAutoRefresh = nil
+	snapstate.FetchAndSaveDownloadAssertions = nil
 }
 
 type ForeignTaskTracker interface {
@@ -6585,6 +6585,53 @@ func (s *snapmgrTestSuite) TestStartSnapServicesCorrectlyKeepsDisabledByHooks(c
 	})
 }
 
+func (s *snapmgrTestSuite) TestUpdateKeepsDisabledServicesDisabled(c *C) {
+	si := snap.SideInfo{
+		RealName: "services-snap",
+		Revision: snap.R(7),
+		SnapID:   "services-snap-id",
+	}
+	snaptest.MockSnap(c, `name: services-snap`, &si)
+
+	// svc1 was disabled by the user
+	prevCurrentlyDisabled := s.fakeBackend.servicesCurrentlyDisabled
+	s.fakeBackend.servicesCurrentlyDisabled = []string{"svc1"}
+	defer func() {
+		s.fakeBackend.servicesCurrentlyDisabled = prevCurrentlyDisabled
+	}()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "services-snap", &snapstate.SnapState{
+		Active:          true,
+		Sequence:        snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{&si}),
+		Current:         si.Revision,
+		SnapType:        "app",
+		TrackingChannel: "latest/stable",
+	})
+
+	chg := s.state.NewChange("refresh", "refresh a snap")
+	ts, err := snapstate.Update(s.state, "services-snap", &snapstate.RevisionOptions{Channel: "some-channel"}, s.user.ID, snapstate.Flags{})
+	c.Assert(err, IsNil)
+	chg.AddAll(ts)
+
+	s.settle(c)
+
+	c.Assert(chg.Err(), IsNil)
+
+	// the services of the new revision are started without enabling the
+	// one that was disabled before the refresh
+	op := s.fakeBackend.ops.MustFindOp(c, "start-snap-services")
+	c.Check(op.path, Equals, filepath.Join(dirs.SnapMountDir, "services-snap/11"))
+	c.Check(op.disabledServices, DeepEquals, []string{"svc1"})
+
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.state, "services-snap", &snapst), IsNil)
+	c.Check(snapst.Current, Equals, snap.R(11))
+	c.Check(snapst.LastActiveDisabledServices, HasLen, 0)
+}
+
 func (s *snapmgrTestSuite) TestStopSnapServicesFirstSavesSnapSetupLastActiveDisabledServices(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
@@ -7365,6 +7412,138 @@ func (s *validationSetsSuite) TestUpdateSnapRequiredByValidationSetAnyRevision(c
 	c.Assert(s.fakeBackend.ops, DeepEquals, expectedOps)
 }
 
+func (s *validationSetsSuite) alignValidationSets(c *C, snaps ...any) *snapasserts.ValidationSets {
+	vsets := snapasserts.NewValidationSets()
+	vsa := s.mockValidationSetAssert(c, "bar", "1", snaps...)
+	c.Assert(vsets.Add(vsa.(*asserts.ValidationSet)), IsNil)
+	return vsets
+}
+
+func (s *validationSetsSuite) TestValidationSetAlignUpdateGoalDowngrade(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	si := &snap.SideInfo{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(12)}
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:          true,
+		Sequence:        snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{si}),
+		Current:         snap.R(12),
+		SnapType:        "app",
+		TrackingChannel: "latest/stable",
+	})
+	snaptest.MockSnap(c, `name: some-snap`, si)
+
+	// not constrained by the set, left alone
+	otherSi := &snap.SideInfo{RealName: "some-other-snap", SnapID: "some-other-snap-id", Revision: snap.R(1)}
+	snapstate.Set(s.state, "some-other-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{otherSi}),
+		Current:  snap.R(1),
+		SnapType: "app",
+	})
+
+	vsets := s.alignValidationSets(c, map[string]any{
+		"id":       "yOqKhntON3vR7kwEbVPsILm7bUViPDzx",
+		"name":     "some-snap",
+		"presence": "required",
+		"revision": "7",
+	})
+
+	updated, uts, err := snapstate.UpdateWithGoal(context.Background(), s.state, snapstate.ValidationSetAlignUpdateGoal(vsets), nil, snapstate.Options{})
+	c.Assert(err, IsNil)
+	c.Check(updated, DeepEquals, []string{"some-snap"})
+	// the refresh of the snap and the check-rerefresh task
+	c.Assert(uts.Refresh, HasLen, 2)
+	c.Check(uts.Refresh[1].Tasks()[0].Kind(), Equals, "check-rerefresh")
+
+	snapsup, err := snapstate.TaskSnapSetup(uts.Refresh[0].Tasks()[0])
+	c.Assert(err, IsNil)
+	// downgraded to the revision required by the set
+	c.Check(snapsup.Revision(), Equals, snap.R(7))
+
+	op := s.fakeBackend.ops.First("storesvc-snap-action:action")
+	c.Assert(op, NotNil)
+	c.Check(op.action, DeepEquals, store.SnapAction{
+		Action:         "refresh",
+		InstanceName:   "some-snap",
+		SnapID:         "some-snap-id",
+		Revision:       snap.R(7),
+		ValidationSets: []snapasserts.ValidationSetKey{"16/foo/bar/1"},
+	})
+}
+
+func (s *validationSetsSuite) TestValidationSetAlignUpdateGoalAlreadyAligned(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	si := &snap.SideInfo{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(7)}
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{si}),
+		Current:  snap.R(7),
+		SnapType: "app",
+	})
+
+	vsets := s.alignValidationSets(c, map[string]any{
+		"id":       "yOqKhntON3vR7kwEbVPsILm7bUViPDzx",
+		"name":     "some-snap",
+		"presence": "required",
+		"revision": "7",
+	})
+
+	updated, uts, err := snapstate.UpdateWithGoal(context.Background(), s.state, snapstate.ValidationSetAlignUpdateGoal(vsets), nil, snapstate.Options{})
+	c.Assert(err, IsNil)
+	c.Check(updated, HasLen, 0)
+	c.Check(uts.Refresh, HasLen, 0)
+	// the store was not asked for anything
+	c.Check(s.fakeBackend.ops.First("storesvc-snap-action"), IsNil)
+}
+
+func (s *validationSetsSuite) TestValidationSetAlignUpdateGoalInvalidSnap(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	si := &snap.SideInfo{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(7)}
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{si}),
+		Current:  snap.R(7),
+		SnapType: "app",
+	})
+
+	vsets := s.alignValidationSets(c, map[string]any{
+		"id":       "yOqKhntON3vR7kwEbVPsILm7bUViPDzx",
+		"name":     "some-snap",
+		"presence": "invalid",
+	})
+
+	_, _, err := snapstate.UpdateWithGoal(context.Background(), s.state, snapstate.ValidationSetAlignUpdateGoal(vsets), nil, snapstate.Options{})
+	c.Assert(err, ErrorMatches, `cannot update snap "some-snap" due to enforcing rules of validation set 16/foo/bar/1`)
+}
+
+func (s *validationSetsSuite) TestValidationSetAlignUpdateGoalNothingConstrained(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	si := &snap.SideInfo{RealName: "some-other-snap", SnapID: "some-other-snap-id", Revision: snap.R(1)}
+	snapstate.Set(s.state, "some-other-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{si}),
+		Current:  snap.R(1),
+		SnapType: "app",
+	})
+
+	vsets := s.alignValidationSets(c, map[string]any{
+		"id":       "yOqKhntON3vR7kwEbVPsILm7bUViPDzx",
+		"name":     "some-snap",
+		"presence": "optional",
+		"revision": "7",
+	})
+
+	_, _, err := snapstate.UpdateWithGoal(context.Background(), s.state, snapstate.ValidationSetAlignUpdateGoal(vsets), nil, snapstate.Options{})
+	c.Assert(err, ErrorMatches, `cannot align snaps: no installed snap is constrained by validation sets 16/foo/bar/1`)
+}
+
 func (s *validationSetsSuite) TestUpdateToRevisionSnapRequiredByValidationSetAnyRevision(c *C) {
 	restore := snapstate.MockEnforcedValidationSets(func(st *state.State, extraVss ...*asserts.ValidationSet) (*snapasserts.ValidationSets, error) {
 		vs := snapasserts.NewValidationSets()
@@ -17016,6 +17195,99 @@ func (s *snapmgrTestSuite) TestRefreshCandidates(c *C) {
 	c.Check(candidates[0].InstanceName(), Equals, "some-snap")
 }
 
+func (s *snapmgrTestSuite) TestConfinementChangeCandidates(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:          true,
+		TrackingChannel: "latest/stable",
+		Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{
+			{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(2)},
+		}),
+		Current:  snap.R(2),
+		SnapType: "app",
+	})
+
+	snapstate.Set(s.state, "some-snap-now-classic", &snapstate.SnapState{
+		Active:          true,
+		TrackingChannel: "latest/stable",
+		Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{
+			{RealName: "some-snap-now-classic", SnapID: "some-snap-now-classic-id", Revision: snap.R(7)},
+		}),
+		Current:  snap.R(7),
+		SnapType: "app",
+	})
+
+	candidates, err := snapstate.ConfinementChangeCandidates(s.state, nil)
+	c.Assert(err, IsNil)
+	c.Assert(candidates, HasLen, 1)
+	c.Check(candidates[0].InstanceName(), Equals, "some-snap-now-classic")
+	c.Check(candidates[0].Confinement, Equals, snap.ClassicConfinement)
+}
+
+func (s *snapmgrTestSuite) TestUpdateWithConfinementChangeFilter(c *C) {
+	restore := maybeMockClassicSupport(c)
+	defer restore()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:          true,
+		TrackingChannel: "latest/stable",
+		Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{
+			{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(2)},
+		}),
+		Current:  snap.R(2),
+		SnapType: "app",
+	})
+
+	snapstate.Set(s.state, "some-snap-now-classic", &snapstate.SnapState{
+		Active:          true,
+		TrackingChannel: "latest/stable",
+		Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{
+			{RealName: "some-snap-now-classic", SnapID: "some-snap-now-classic-id", Revision: snap.R(7)},
+		}),
+		Current:  snap.R(7),
+		SnapType: "app",
+	})
+
+	goal := snapstate.StoreUpdateGoal(
+		snapstate.StoreUpdate{InstanceName: "some-snap"},
+		snapstate.StoreUpdate{InstanceName: "some-snap-now-classic"},
+	)
+
+	updated, uts, err := snapstate.UpdateWithGoal(context.Background(), s.state, goal, snapstate.ConfinementChangeFilter(), snapstate.Options{
+		Flags: snapstate.Flags{Classic: true},
+	})
+	c.Assert(err, IsNil)
+	c.Check(updated, DeepEquals, []string{"some-snap"})
+	c.Check(uts.Refresh, Not(HasLen), 0)
+}
+
+func (s *snapmgrTestSuite) TestConfinementChangeFilter(c *C) {
+	// these work because we're mocking ReadInfo, which leaves the confinement
+	// of the installed revision unset (and thus strict)
+	snapst := &snapstate.SnapState{
+		Active: true,
+		Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{
+			{RealName: "some-snap", Revision: snap.R(7)},
+		}),
+		Current:  snap.R(7),
+		SnapType: "app",
+	}
+
+	filter := snapstate.ConfinementChangeFilter()
+	c.Check(filter(&snap.Info{Confinement: snap.StrictConfinement}, snapst), Equals, true)
+	c.Check(filter(&snap.Info{}, snapst), Equals, true)
+	c.Check(filter(&snap.Info{Confinement: snap.ClassicConfinement}, snapst), Equals, false)
+	c.Check(filter(&snap.Info{Confinement: snap.DevModeConfinement}, snapst), Equals, false)
+
+	// snaps that are not installed have nothing to change from
+	c.Check(filter(&snap.Info{Confinement: snap.ClassicConfinement}, &snapstate.SnapState{}), Equals, true)
+}
+
 func (s *snapmgrTestSuite) TestUpdateTasksWithComponentsRemoved(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
@@ -30,6 +30,7 @@ import (
 	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/naming"
 	"github.com/snapcore/snapd/store"
 	"github.com/snapcore/snapd/strutil"
 )
@@ -49,6 +50,11 @@ var EnforceLocalValidationSets func(*state.State, map[string][]string, map[strin
 // fetching them. It's hooked from assertstate.
 var EnforceValidationSets func(*state.State, map[string]*asserts.ValidationSet, map[string]int, []*snapasserts.InstalledSnap, map[string]bool, int) error
 
+// ResolveLocalValidationSets allows to hook looking up validation set
+// assertions by their primary keys in the current database, without fetching
+// them. It's hooked from assertstate.
+var ResolveLocalValidationSets func(*state.State, map[string][]string) (map[string]*asserts.ValidationSet, error)
+
 func userIDForSnap(st *state.State, snapst *SnapState, fallbackUserID int) (int, error) {
 	userID := snapst.UserID
 	_, err := auth.User(st, userID)
@@ -516,6 +522,11 @@ func storeUpdatePlanCore(
 		hasLocalRevision[name] = allSnaps[name]
 	}
 
+	sars, err = clampToMaxRevisions(ctx, st, allSnaps, updates, sars, current, hasLocalRevision, refreshOpts, opts, fallbackID)
+	if err != nil {
+		return updatePlan{}, err
+	}
+
 	for _, sar := range sars {
 		up, ok := updates[sar.InstanceName()]
 		if !ok {
@@ -551,6 +562,12 @@ func storeUpdatePlanCore(
 			return updatePlan{}, fmt.Errorf("cannot extract components from snap resources: %w", err)
 		}
 
+		if up.PreserveComponentRevisions {
+			if err := preserveCurrentComponentRevisions(snapst, sar.Info, compTargets, up.RevOpts.ValidationSets); err != nil {
+				return updatePlan{}, err
+			}
+		}
+
 		// if we still have no channel here, this means that we refreshed
 		// by-revision without specifying a channel. make sure we continue to
 		// track the channel that the snap is currently on
@@ -611,6 +628,12 @@ func storeUpdatePlanCore(
 			return updatePlan{}, err
 		}
 
+		if up.PreserveComponentRevisions {
+			if err := preserveCurrentComponentRevisions(snapst, info, compsups, up.RevOpts.ValidationSets); err != nil {
+				return updatePlan{}, err
+			}
+		}
+
 		// this must happen after the call to componentSetupsForInstall, since
 		// we can't set the channel to the tracking channel if we don't know
 		// that the requested revision is part of this channel
@@ -652,6 +675,144 @@ func storeUpdatePlanCore(
 	return plan, nil
 }
 
+// clampToMaxRevisions replaces the results offering a revision newer than
+// the MaxRevision of their update with the results for the maximum revision
+// itself, requested without a cohort. The updates of those snaps are changed
+// accordingly. Snaps with a local copy of the maximum revision are added to
+// hasLocalRevision instead, as are the ones whose maximum revision isn't newer
+// than the current revision, which are then kept at their current revision
+// like the snaps without a store update.
+//
+// The store can only be asked for an exact revision, which it resolves
+// regardless of the tracked channel, and not for the newest revision of the
+// channel below the maximum one. If the maximum revision isn't available, the
+// newest local revision between the current and the maximum one that isn't
+// blocked is used instead, and the snap is kept at its current revision if
+// there is none.
+func clampToMaxRevisions(
+	ctx context.Context,
+	st *state.State,
+	allSnaps map[string]*SnapState,
+	updates map[string]StoreUpdate,
+	sars []store.SnapActionResult,
+	current []*store.CurrentSnap,
+	hasLocalRevision map[string]*SnapState,
+	refreshOpts *store.RefreshOptions,
+	opts Options,
+	fallbackID int,
+) ([]store.SnapActionResult, error) {
+	allowed := make([]store.SnapActionResult, 0, len(sars))
+	actionsByUserID := make(map[int][]*store.SnapAction)
+	// clamped maps the snaps requested again to their original updates
+	clamped := make(map[string]StoreUpdate)
+	for _, sar := range sars {
+		up, ok := updates[sar.InstanceName()]
+		if !ok || up.RevOpts.MaxRevision.Unset() || sar.Info.Revision.N <= up.RevOpts.MaxRevision.N {
+			allowed = append(allowed, sar)
+			continue
+		}
+
+		snapst, ok := allSnaps[sar.InstanceName()]
+		if !ok {
+			return nil, fmt.Errorf("internal error: snap %q not found", sar.InstanceName())
+		}
+
+		maxRev := up.RevOpts.MaxRevision
+		if maxRev.N <= snapst.Current.N {
+			logger.Noticef("not refreshing snap %q: store offers revision %s, newer than the maximum revision %s", sar.InstanceName(), sar.Info.Revision, maxRev)
+			hasLocalRevision[sar.InstanceName()] = snapst
+			continue
+		}
+
+		orig := up
+		// the ceiling wins over the cohort, which might only offer
+		// revisions beyond it
+		up.RevOpts.Revision = maxRev
+		up.RevOpts.CohortKey = ""
+		updates[sar.InstanceName()] = up
+
+		if snapst.LastIndex(maxRev) != -1 {
+			hasLocalRevision[sar.InstanceName()] = snapst
+			continue
+		}
+
+		action := &store.SnapAction{
+			Action:       "refresh",
+			SnapID:       sar.Info.SnapID,
+			InstanceName: sar.InstanceName(),
+		}
+		if err := completeStoreAction(action, up.RevOpts, ignoreValidationSetsForRefresh(snapst, opts)); err != nil {
+			return nil, err
+		}
+
+		userID := snapst.UserID
+		if userID == 0 {
+			userID = fallbackID
+		}
+		actionsByUserID[userID] = append(actionsByUserID[userID], action)
+		clamped[sar.InstanceName()] = orig
+	}
+
+	if len(actionsByUserID) == 0 {
+		return allowed, nil
+	}
+
+	for _, cur := range current {
+		if _, ok := clamped[cur.InstanceName]; ok {
+			cur.CohortKey = ""
+		}
+	}
+
+	// a maximum revision that isn't available in the store means that
+	// there is no update for the snap
+	clampOpts := opts
+	clampOpts.ExpectOneSnap = false
+	clampedSars, unavailable, err := sendActionsByUserID(ctx, st, actionsByUserID, current, refreshOpts, clampOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range unavailable {
+		orig, ok := clamped[name]
+		if !ok {
+			return nil, fmt.Errorf("internal error: unexpected result for snap %q", name)
+		}
+		snapst := allSnaps[name]
+		if rev := newestLocalRevisionUpTo(snapst, orig.RevOpts.MaxRevision); !rev.Unset() {
+			up := updates[name]
+			up.RevOpts.Revision = rev
+			updates[name] = up
+		} else {
+			updates[name] = orig
+		}
+		hasLocalRevision[name] = snapst
+	}
+
+	return append(allowed, clampedSars...), nil
+}
+
+// newestLocalRevisionUpTo returns the newest store revision of the snap's
+// sequence that is newer than the current revision, not newer than maxRev and
+// not blocked, or an unset revision if there is none.
+func newestLocalRevisionUpTo(snapst *SnapState, maxRev snap.Revision) snap.Revision {
+	blocked := make(map[snap.Revision]bool)
+	for _, rev := range snapst.Block() {
+		blocked[rev] = true
+	}
+
+	var newest snap.Revision
+	for _, si := range snapst.Sequence.SideInfos() {
+		rev := si.Revision
+		if !rev.Store() || blocked[rev] || rev.N <= snapst.Current.N || rev.N > maxRev.N {
+			continue
+		}
+		if rev.N > newest.N {
+			newest = rev
+		}
+	}
+	return newest
+}
+
 func unique[T comparable](s []T) []T {
 	m := make(map[T]struct{}, len(s))
 	for _, v := range s {
@@ -660,6 +821,74 @@ func unique[T comparable](s []T) []T {
 	return keys(m)
 }
 
+// preserveCurrentComponentRevisions modifies the given component setups so
+// that components that are currently installed are kept at their current
+// revisions. Components that are not currently installed, or that are
+// constrained to a specific revision by the given validation sets, are left
+// untouched. A current component revision can only be kept if it is known to
+// go with the target snap revision, that is if the snap's sequence already
+// pairs it with that revision; otherwise an error is returned.
+func preserveCurrentComponentRevisions(snapst *SnapState, info *snap.Info, compsups []ComponentSetup, vsets *snapasserts.ValidationSets) error {
+	current, err := snapst.CurrentComponentInfos()
+	if err != nil {
+		return err
+	}
+
+	currentRevs := make(map[string]snap.Revision, len(current))
+	for _, comp := range current {
+		currentRevs[comp.Component.ComponentName] = comp.Revision
+	}
+
+	var constraints snapasserts.SnapPresenceConstraints
+	if vsets != nil {
+		constraints, err = vsets.Presence(info)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range compsups {
+		compName := compsups[i].ComponentName()
+		rev, ok := currentRevs[compName]
+		if !ok || rev == compsups[i].Revision() {
+			continue
+		}
+
+		// revisions required by validation sets win over preserving the
+		// current revision
+		if !constraints.Component(compName).Revision.Unset() {
+			continue
+		}
+
+		// component revisions are tied to snap revisions, only keep the
+		// current revision if it was already installed with the target one
+		if !componentRevisionInSequence(snapst, info.Revision, compsups[i].CompSideInfo.Component, rev) {
+			return fmt.Errorf("cannot preserve revision %s of component %q: revision %s of snap %q requires component revision %s",
+				rev, compsups[i].CompSideInfo.Component, info.Revision, info.InstanceName(), compsups[i].Revision())
+		}
+
+		csi := *compsups[i].CompSideInfo
+		csi.Revision = rev
+		compsups[i].CompSideInfo = &csi
+		// the component is already present on the system, there is nothing
+		// to download
+		compsups[i].DownloadInfo = nil
+	}
+
+	return nil
+}
+
+// componentRevisionInSequence returns true if the snap's sequence has the
+// given component revision installed alongside the given snap revision.
+func componentRevisionInSequence(snapst *SnapState, snapRev snap.Revision, cref naming.ComponentRef, compRev snap.Revision) bool {
+	idx := snapst.LastIndex(snapRev)
+	if idx < 0 {
+		return false
+	}
+	cs := snapst.Sequence.ComponentStateForRev(idx, cref)
+	return cs != nil && cs.SideInfo.Revision == compRev
+}
+
 func currentComponentsAvailableInRevision(snapst *SnapState, info *snap.Info) ([]string, error) {
 	if len(info.Components) == 0 {
 		return nil, nil
@@ -1003,7 +1232,7 @@ func sendInstallOrDownloadActions(ctx context.Context, st *state.State, action s
 			return nil, err
 		}
 
-		if len(sn.Components) > 0 {
+		if len(sn.Components) > 0 || len(sn.OptionalComponents) > 0 {
 			includeResources = true
 		}
 
@@ -23,17 +23,36 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/asserts/snapasserts"
 	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/features"
+	"github.com/snapcore/snapd/httputil"
+	"github.com/snapcore/snapd/i18n"
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/ifacestate/ifacerepo"
 	"github.com/snapcore/snapd/overlord/snapstate/backend"
 	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/progress"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/seed/seedwriter"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snap/naming"
 	"github.com/snapcore/snapd/store"
+	"github.com/snapcore/snapd/strutil"
+	"github.com/snapcore/snapd/timeutil"
 )
 
 // Options contains optional parameters for the snapstate operations. All of
@@ -50,7 +69,10 @@ type Options struct {
 	DeviceCtx DeviceContext
 	// PrereqTracker is an optional prereq tracker that will be used to keep
 	// track of all snaps (explicitly requested and implicitly required snaps)
-	// that might need to be installed during the operation.
+	// that might need to be installed during the operation. The same
+	// stateful tracker, e.g. a snap.CumulativePrereqTracker, can be passed
+	// across multiple operations so that prerequisites already tracked by
+	// earlier operations are not set up to be installed again.
 	PrereqTracker PrereqTracker
 	// FromChange is the change that triggered the operation.
 	FromChange string
@@ -65,6 +87,74 @@ type Options struct {
 	// pre-existing behavior of calling InstallMany with one snap vs calling
 	// Install.
 	ExpectOneSnap bool
+	// SuppressAutoConnect is a list of interface names whose
+	// auto-connections should not be established when installing the snaps.
+	// Connections for these interfaces must be made explicitly later on,
+	// this includes connections to the slots of the system snap.
+	// Connections specified by the gadget are not affected. The interfaces
+	// must be known, and neither the content connections to default
+	// providers nor the auto-connections of the system snap itself can be
+	// suppressed.
+	SuppressAutoConnect []string
+	// RefreshHoldUntil, if set, makes the installed snaps held from
+	// auto-refreshes by the system until the given time.
+	RefreshHoldUntil time.Time
+	// RefreshSchedule is an alternative to RefreshHoldUntil that uses the
+	// same format as the refresh.timer option. The installed snaps are
+	// then held from auto-refreshes until the start of the next window
+	// of the schedule.
+	RefreshSchedule string
+	// DownloadRateLimit, if set, limits the rate in bytes per second at
+	// which the snaps and their components are downloaded from the
+	// store. Zero means unlimited.
+	DownloadRateLimit int64
+	// OnlyRevisionChanges, if set, makes UpdateWithGoal leave out the snaps
+	// for which neither the revision of the snap nor the ones of its
+	// components would change, e.g. snaps that would only switch channel or
+	// cohort. It is ignored by all other operations.
+	OnlyRevisionChanges bool
+	// SkipChannelOnlySwitches, if set, makes UpdateWithGoal only switch the
+	// channel or cohort of the snaps requested by revision for which neither
+	// the revision of the snap nor the ones of its components would change,
+	// instead of putting them through the entire update. Such snaps are left
+	// out if there is nothing to switch either. It is ignored by all other
+	// operations.
+	SkipChannelOnlySwitches bool
+	// DownloadDir is the directory that DownloadWithGoal downloads the snaps
+	// and their components into. It is required by DownloadWithGoal and
+	// ignored by all other operations.
+	DownloadDir string
+}
+
+// refreshHold returns the time until which the installed snaps should be
+// held from auto-refreshes as specified by the options, or nil.
+func (opts *Options) refreshHold() (*time.Time, error) {
+	if opts.RefreshSchedule != "" && !opts.RefreshHoldUntil.IsZero() {
+		return nil, errors.New("cannot specify both a refresh hold time and a refresh schedule")
+	}
+
+	holdUntil := opts.RefreshHoldUntil
+	if opts.RefreshSchedule != "" {
+		sched, err := timeutil.ParseSchedule(opts.RefreshSchedule)
+		if err != nil {
+			return nil, fmt.Errorf("cannot use refresh schedule: %v", err)
+		}
+		now := timeNow()
+		for _, s := range sched {
+			start := s.Next(now).Start
+			if holdUntil.IsZero() || start.Before(holdUntil) {
+				holdUntil = start
+			}
+		}
+	}
+
+	if holdUntil.IsZero() {
+		return nil, nil
+	}
+	if !holdUntil.After(timeNow()) {
+		return nil, fmt.Errorf("cannot hold refreshes until %s: time is in the past", holdUntil.Format(time.RFC3339))
+	}
+	return &holdUntil, nil
 }
 
 func (opts *Options) setDefaultLane(st *state.State) error {
@@ -92,6 +182,35 @@ type target struct {
 	snapst SnapState
 	// components is a list of components to install with this snap.
 	components []ComponentSetup
+	// removeSnapPath indicates that the snap file at setup.SnapPath is owned
+	// by the operation and should be removed once it is no longer needed.
+	removeSnapPath bool
+	// after is a list of instance names of snaps that must be installed before
+	// this snap.
+	after []string
+	// componentsOnly, if set, is a list of components to install for a snap
+	// that is already installed. The snap itself, described by info, is left
+	// untouched.
+	componentsOnly []string
+	// laneGroup, if set, is the name of the group of targets whose tasks
+	// share a lane.
+	laneGroup string
+	// pinned indicates that the revision to install is the one required by
+	// the validation sets, rather than one resolved from a channel.
+	pinned bool
+}
+
+// resolvedChannel returns the channel that the target snap was resolved
+// from, or an empty string if its revision is pinned by validation sets.
+func (t *target) resolvedChannel() string {
+	switch {
+	case t.pinned:
+		return ""
+	case len(t.componentsOnly) > 0:
+		return t.snapst.TrackingChannel
+	default:
+		return t.setup.Channel
+	}
 }
 
 // setups returns the completed SnapSetup and slice of ComponentSetup structs
@@ -125,6 +244,9 @@ func (t *target) setups(st *state.State, opts Options) (SnapSetup, []ComponentSe
 	if err != nil {
 		return SnapSetup{}, nil, err
 	}
+	if t.removeSnapPath {
+		flags.RemoveSnapPath = true
+	}
 
 	// to match the behavior of the original Update and UpdateMany, we only
 	// allow updating ignoring validation sets if we are working with
@@ -149,12 +271,27 @@ func (t *target) setups(st *state.State, opts Options) (SnapSetup, []ComponentSe
 
 	providerContentAttrs := defaultProviderContentAttrs(st, t.info, opts.PrereqTracker)
 
+	// the content connections to the default providers are the reason the
+	// providers get installed as prerequisites, do not allow them to be
+	// left disconnected
+	if len(providerContentAttrs) > 0 && strutil.ListContains(opts.SuppressAutoConnect, "content") {
+		return SnapSetup{}, nil, fmt.Errorf("cannot suppress auto-connection of interface \"content\" for snap %q: required to connect its default providers", t.info.InstanceName())
+	}
+
+	// the slots of the system snap are what the connections of all other
+	// snaps rely on, they cannot be left to be connected explicitly
+	if typ := t.info.Type(); len(opts.SuppressAutoConnect) > 0 && (typ == snap.TypeOS || typ == snap.TypeSnapd) {
+		return SnapSetup{}, nil, fmt.Errorf("cannot suppress auto-connections for system snap %q", t.info.InstanceName())
+	}
+
 	return SnapSetup{
-		Channel:      t.setup.Channel,
-		CohortKey:    t.setup.CohortKey,
-		DownloadInfo: t.setup.DownloadInfo,
-		SnapPath:     t.setup.SnapPath,
-		AlwaysUpdate: t.setup.AlwaysUpdate,
+		Channel:        t.setup.Channel,
+		CohortKey:      t.setup.CohortKey,
+		CohortOverride: t.setup.CohortOverride,
+		DownloadInfo:   t.setup.DownloadInfo,
+		SnapPath:       t.setup.SnapPath,
+		AlwaysUpdate:   t.setup.AlwaysUpdate,
+		PreferCached:   t.setup.PreferCached,
 
 		Base:               t.info.Base,
 		Prereq:             keys(providerContentAttrs),
@@ -168,6 +305,10 @@ func (t *target) setups(st *state.State, opts Options) (SnapSetup, []ComponentSe
 		InstanceKey:        t.info.InstanceKey,
 		ExpectedProvenance: t.info.SnapProvenance,
 		PluggedConfdbIDs:   confdbSchemaIDs,
+
+		SuppressedAutoConnectInterfaces: opts.SuppressAutoConnect,
+		DownloadRateLimit:               opts.DownloadRateLimit,
+
 		AuxStoreInfo: backend.AuxStoreInfo{
 			Media:    t.info.Media,
 			StoreURL: t.info.StoreURL,
@@ -190,6 +331,10 @@ type storeInstallGoal struct {
 	// snap to install. It maintains the order of the snaps as they were
 	// provided.
 	snaps []StoreSnap
+	// componentsOnly is a slice of StoreSnap structs for snaps that are
+	// already installed and requested with SkipIfPresent, whose Components
+	// are the ones missing from the installed snap.
+	componentsOnly []StoreSnap
 }
 
 func (s *storeInstallGoal) snap(name string) (StoreSnap, bool) {
@@ -207,16 +352,58 @@ type StoreSnap struct {
 	InstanceName string
 	// Components is the list of components to install with this snap.
 	Components []string
+	// OptionalComponents is a list of components to install with this snap
+	// if the store has them for the revision being installed, the ones it
+	// doesn't have are skipped. Unlike Components, they are not considered
+	// for snaps that are already installed.
+	OptionalComponents []string
 	// RevOpts contains options that apply to the installation of this snap.
+	// A CohortKey can be combined with a Channel to install from the cohort
+	// while staying on that channel, e.g. only its stable risk. If the
+	// validation sets pin the snap to a revision both are ignored, dropping
+	// the cohort is then reported through SnapSetup.CohortOverride.
 	RevOpts RevisionOptions
-	// SkipIfPresent indicates that the snap should not be installed if it is already present.
+	// SkipIfPresent indicates that the snap should not be installed if it is
+	// already present. Any of the requested Components that are missing from
+	// the installed snap are still installed, for its current revision.
 	SkipIfPresent bool
+	// After is a list of instance names of snaps that must be installed before
+	// this snap. Each snap must either be part of the same goal or already be
+	// installed.
+	After []string
+	// LaneGroup, if set, puts the tasks of this snap in the same lane as the
+	// ones of the other snaps of the operation with the same LaneGroup, so
+	// that they are installed or undone together. Snaps without a LaneGroup
+	// follow Flags.Transaction. Lane groups are redundant when Flags.Transaction
+	// is "all-snaps", since all snaps then share a single lane.
+	LaneGroup string
+	// PreferCached indicates that the snap should be installed from the
+	// download cache if a blob matching the sha3-384 digest expected by the
+	// store is found there, instead of downloading it again. A cached blob
+	// that doesn't match the digest is ignored. The assertions of the snap
+	// are fetched and checked as for any other snap from the store.
+	PreferCached bool
+	// AutoProviders indicates that the default providers of the content
+	// plugs of the snap that are not installed yet are installed from the
+	// store as part of the same operation, before the snap itself. Default
+	// providers that are already installed are left as they are. Since
+	// this can add snaps to the operation, it cannot be used with
+	// InstallOne.
+	AutoProviders bool
 }
 
 // StoreInstallGoal creates a new InstallGoal to install snaps from the store.
 // If a snap is provided more than once in the list, the first instance of it
 // will be used to provide the installation options.
 func StoreInstallGoal(snaps ...StoreSnap) InstallGoal {
+	return &storeInstallGoal{
+		snaps: uniqueStoreSnaps(snaps),
+	}
+}
+
+// uniqueStoreSnaps returns the given snaps without the repeated instances of
+// any snap, keeping the first one and the original order.
+func uniqueStoreSnaps(snaps []StoreSnap) []StoreSnap {
 	seen := make(map[string]bool, len(snaps))
 	unique := make([]StoreSnap, 0, len(snaps))
 	for _, sn := range snaps {
@@ -227,10 +414,7 @@ func StoreInstallGoal(snaps ...StoreSnap) InstallGoal {
 		seen[sn.InstanceName] = true
 		unique = append(unique, sn)
 	}
-
-	return &storeInstallGoal{
-		snaps: unique,
-	}
+	return unique
 }
 
 func validateRevisionOpts(opts *RevisionOptions) error {
@@ -238,6 +422,15 @@ func validateRevisionOpts(opts *RevisionOptions) error {
 		return errors.New("cannot specify revision and cohort")
 	}
 
+	if !opts.MinRevision.Unset() {
+		if !opts.Revision.Unset() {
+			return errors.New("cannot specify revision and minimum revision")
+		}
+		if !opts.MinRevision.Store() {
+			return fmt.Errorf("cannot use local revision %s as minimum revision", opts.MinRevision)
+		}
+	}
+
 	// if we're leaving the cohort, clear out any provided cohort key
 	if opts.LeaveCohort {
 		opts.CohortKey = ""
@@ -264,12 +457,61 @@ func (s *storeInstallGoal) toInstall(ctx context.Context, st *state.State, opts
 		return nil, err
 	}
 
-	results, err := sendInstallActions(ctx, st, s.snaps, opts)
+	// only components are installed for the snaps that are already present,
+	// there is no need to ask the store for them here
+	var results []store.SnapActionResult
+	if len(s.snaps) > 0 || len(s.componentsOnly) == 0 {
+		results, err = sendInstallActions(ctx, st, s.snaps, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	installs, err := s.targetsFromResults(results, allSnaps, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	providers, err := s.autoProviderTargets(ctx, st, installs, allSnaps, opts)
 	if err != nil {
 		return nil, err
 	}
+	installs = append(installs, providers...)
+
+	for _, t := range installs {
+		sn, ok := s.snap(t.info.InstanceName())
+		if !ok {
+			return nil, fmt.Errorf("internal error: snap to install was not requested: %s", t.info.InstanceName())
+		}
+
+		if err := checkSnapAgainstValidationSets(t.info, t.components, "install", sn.RevOpts.ValidationSets); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, sn := range s.componentsOnly {
+		snapst := allSnaps[sn.InstanceName]
+		info, err := snapst.CurrentInfo()
+		if err != nil {
+			return nil, err
+		}
+
+		installs = append(installs, target{
+			info:           info,
+			snapst:         *snapst,
+			after:          sn.After,
+			componentsOnly: sn.Components,
+			laneGroup:      sn.LaneGroup,
+		})
+	}
+
+	return installs, err
+}
 
-	installs := make([]target, 0, len(results))
+// targetsFromResults returns the targets for the snaps of the goal resolved
+// by the given store install action results.
+func (s *storeInstallGoal) targetsFromResults(results []store.SnapActionResult, allSnaps map[string]*SnapState, opts Options) ([]target, error) {
+	installs := make([]target, 0, len(results)+len(s.componentsOnly))
 	for _, r := range results {
 		sn, ok := s.snap(r.InstanceName())
 		if !ok {
@@ -296,35 +538,112 @@ func (s *storeInstallGoal) toInstall(ctx context.Context, st *state.State, opts
 			channel = "stable"
 		}
 
-		comps, err := componentTargetsFromActionResult("install", r, sn.Components)
+		if !sn.RevOpts.MinRevision.Unset() && r.Info.Revision.N < sn.RevOpts.MinRevision.N {
+			return nil, fmt.Errorf("cannot install snap %q: store offers revision %s, older than the minimum revision %s", sn.InstanceName, r.Info.Revision, sn.RevOpts.MinRevision)
+		}
+
+		comps, err := storeSnapComponentTargets("install", r, sn)
 		if err != nil {
 			return nil, fmt.Errorf("cannot extract components from snap resources: %w", err)
 		}
 
+		override, err := cohortOverride(sn, opts.Flags.IgnoreValidation)
+		if err != nil {
+			return nil, err
+		}
+
+		pinned, err := pinnedByValidationSets(sn, opts.Flags.IgnoreValidation)
+		if err != nil {
+			return nil, err
+		}
+
 		installs = append(installs, target{
 			setup: SnapSetup{
-				DownloadInfo: &r.DownloadInfo,
-				Channel:      channel,
-				CohortKey:    sn.RevOpts.CohortKey,
+				DownloadInfo:   &r.DownloadInfo,
+				Channel:        channel,
+				CohortKey:      sn.RevOpts.CohortKey,
+				CohortOverride: override,
+				PreferCached:   sn.PreferCached,
 			},
 			info:       r.Info,
 			snapst:     *snapst,
 			components: comps,
+			after:      sn.After,
+			laneGroup:  sn.LaneGroup,
+			pinned:     pinned,
 		})
 	}
+	return installs, nil
+}
 
-	for _, t := range installs {
+// autoProviderTargets returns the targets for the default providers of the
+// content plugs of the snaps requested with AutoProviders that are neither
+// installed nor part of the goal yet. The snaps requesting them are ordered
+// after their providers. The providers are added to the snaps of the goal.
+func (s *storeInstallGoal) autoProviderTargets(ctx context.Context, st *state.State, installs []target, allSnaps map[string]*SnapState, opts Options) ([]target, error) {
+	var providers []StoreSnap
+	added := make(map[string]bool)
+	for i := range installs {
+		t := &installs[i]
 		sn, ok := s.snap(t.info.InstanceName())
-		if !ok {
-			return nil, fmt.Errorf("internal error: snap to install was not requested: %s", t.info.InstanceName())
+		if !ok || !sn.AutoProviders {
+			continue
 		}
 
-		if err := checkSnapAgainstValidationSets(t.info, t.components, "install", sn.RevOpts.ValidationSets); err != nil {
-			return nil, err
+		missing := defaultProviderContentAttrs(st, t.info, nil)
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		after := append([]string(nil), t.after...)
+		for _, name := range names {
+			if snapst, ok := allSnaps[name]; ok && snapst.IsInstalled() {
+				// the prerequisites task takes care of providers
+				// that are already installed
+				continue
+			}
+			if !strutil.ListContains(after, name) {
+				after = append(after, name)
+			}
+			if _, ok := s.snap(name); ok || added[name] {
+				continue
+			}
+			added[name] = true
+			providers = append(providers, StoreSnap{
+				InstanceName: name,
+				LaneGroup:    sn.LaneGroup,
+			})
 		}
+		t.after = after
 	}
 
-	return installs, err
+	if len(providers) == 0 {
+		return nil, nil
+	}
+
+	if opts.ExpectOneSnap {
+		return nil, ErrExpectedOneSnap
+	}
+
+	provGoal := &storeInstallGoal{snaps: providers}
+	if err := provGoal.validateAndPrune(st, allSnaps, opts); err != nil {
+		return nil, err
+	}
+
+	results, err := sendInstallActions(ctx, st, provGoal.snaps, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	targets, err := provGoal.targetsFromResults(results, allSnaps, opts)
+	if err != nil {
+		return nil, err
+	}
+	s.snaps = append(s.snaps, provGoal.snaps...)
+
+	return targets, nil
 }
 
 func checkSnapAgainstValidationSets(info *snap.Info, components []ComponentSetup, action string, vsets *snapasserts.ValidationSets) error {
@@ -431,6 +750,39 @@ func cachedEnforcedValidationSets(st *state.State) cachedValidationSets {
 	}
 }
 
+// storeSnapComponentTargets returns the setups of the components of the store
+// snap sn to install from the given store action result. All its Components
+// must be among the resources of the result, while its OptionalComponents that
+// are not are skipped.
+func storeSnapComponentTargets(action string, sar store.SnapActionResult, sn StoreSnap) ([]ComponentSetup, error) {
+	comps, err := componentTargetsFromActionResult(action, sar, sn.Components)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sn.OptionalComponents) == 0 {
+		return comps, nil
+	}
+
+	resources := make(map[string]bool, len(sar.Resources))
+	for _, res := range sar.Resources {
+		resources[res.Name] = true
+	}
+	optional := make([]string, 0, len(sn.OptionalComponents))
+	for _, comp := range sn.OptionalComponents {
+		if !resources[comp] || strutil.ListContains(sn.Components, comp) || strutil.ListContains(optional, comp) {
+			continue
+		}
+		optional = append(optional, comp)
+	}
+
+	optComps, err := componentTargetsFromActionResult(action, sar, optional)
+	if err != nil {
+		return nil, err
+	}
+	return append(comps, optComps...), nil
+}
+
 func componentTargetsFromActionResult(action string, sar store.SnapActionResult, requested []string) ([]ComponentSetup, error) {
 	mapping := make(map[string]store.SnapResourceResult, len(sar.Resources))
 	for _, res := range sar.Resources {
@@ -557,7 +909,8 @@ func completeStoreAction(action *store.SnapAction, revOpts RevisionOptions, igno
 		action.Revision = pres.Revision
 
 		// we ignore the cohort if a validation set requires that the
-		// snap is pinned to a specific revision
+		// snap is pinned to a specific revision, see cohortOverride for
+		// how this is reported back to the caller
 		action.CohortKey = ""
 
 		// since we're constraining this snap to a revision required by a
@@ -568,6 +921,56 @@ func completeStoreAction(action *store.SnapAction, revOpts RevisionOptions, igno
 	return nil
 }
 
+// CohortOverride records that the cohort requested for a snap was not
+// used because the enforced validation sets pin the snap to a revision.
+type CohortOverride struct {
+	// CohortKey is the cohort that was requested.
+	CohortKey string `json:"cohort-key"`
+	// ValidationSets are the validation sets that constrain the snap.
+	ValidationSets []snapasserts.ValidationSetKey `json:"validation-sets"`
+}
+
+// cohortOverride returns a CohortOverride if the cohort requested for the
+// given snap is dropped by completeStoreAction in favour of the revision
+// required by the enforced validation sets, or nil otherwise.
+func cohortOverride(sn StoreSnap, ignoreValidation bool) (*CohortOverride, error) {
+	if sn.RevOpts.CohortKey == "" {
+		return nil, nil
+	}
+
+	action := &store.SnapAction{
+		Action:       "install",
+		InstanceName: sn.InstanceName,
+	}
+	if err := completeStoreAction(action, sn.RevOpts, ignoreValidation); err != nil {
+		return nil, err
+	}
+	if action.CohortKey != "" {
+		return nil, nil
+	}
+
+	return &CohortOverride{
+		CohortKey:      sn.RevOpts.CohortKey,
+		ValidationSets: action.ValidationSets,
+	}, nil
+}
+
+// pinnedByValidationSets returns whether the validation sets of the given snap
+// require a specific revision of it, in which case completeStoreAction doesn't
+// send the requested channel to the store.
+func pinnedByValidationSets(sn StoreSnap, ignoreValidation bool) (bool, error) {
+	snapName, instanceKey := snap.SplitInstanceName(sn.InstanceName)
+	if ignoreValidation || instanceKey != "" || sn.RevOpts.ValidationSets == nil {
+		return false, nil
+	}
+
+	pres, err := sn.RevOpts.ValidationSets.Presence(naming.Snap(snapName))
+	if err != nil {
+		return false, err
+	}
+	return !pres.Revision.Unset(), nil
+}
+
 func invalidRevisionError(action, snapName string, sets []snapasserts.ValidationSetKey, requested, required snap.Revision) error {
 	verb := "install"
 	preposition := "at"
@@ -629,6 +1032,20 @@ func (s *storeInstallGoal) validateAndPrune(st *state.State, installedSnaps map[
 			if !sn.SkipIfPresent {
 				return &snap.AlreadyInstalledError{Snap: sn.InstanceName}
 			}
+
+			// the snap is kept as is, but the requested components that
+			// it is missing are still installed
+			missing := make([]string, 0, len(sn.Components))
+			snapName, _ := snap.SplitInstanceName(sn.InstanceName)
+			for _, comp := range sn.Components {
+				if snapst.CurrentComponentState(naming.NewComponentRef(snapName, comp)) == nil {
+					missing = append(missing, comp)
+				}
+			}
+			if len(missing) > 0 {
+				sn.Components = missing
+				s.componentsOnly = append(s.componentsOnly, sn)
+			}
 			continue
 		}
 
@@ -676,6 +1093,17 @@ func InstallOne(ctx context.Context, st *state.State, goal InstallGoal, opts Opt
 	return infos[0], tasksets[0], nil
 }
 
+// InstallResult describes a snap that is being installed by
+// InstallWithGoalResults.
+type InstallResult struct {
+	// Info is the snap.Info of the snap being installed.
+	Info *snap.Info
+	// Channel is the channel that the snap was resolved from, after any
+	// redirection by the store. It is empty if the revision to install is
+	// pinned by validation sets.
+	Channel string
+}
+
 func sortComponentsOnTargets(targets []target) {
 	for _, t := range targets {
 		sort.Slice(t.components, func(i, j int) bool {
@@ -698,10 +1126,44 @@ func sortComponentsOnTargets(targets []target) {
 // TODO: rename this to Install once the API is settled, and we can rename or
 // remove the old Install function.
 func InstallWithGoal(ctx context.Context, st *state.State, goal InstallGoal, opts Options) ([]*snap.Info, []*state.TaskSet, error) {
+	results, tasksets, err := InstallWithGoalResults(ctx, st, goal, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	infos := make([]*snap.Info, 0, len(results))
+	for _, r := range results {
+		infos = append(infos, r.Info)
+	}
+	return infos, tasksets, nil
+}
+
+// InstallWithGoalResults behaves like InstallWithGoal, but returns an
+// InstallResult for each snap that is being installed, which also carries the
+// channel that the snap was resolved from.
+func InstallWithGoalResults(ctx context.Context, st *state.State, goal InstallGoal, opts Options) (_ []InstallResult, _ []*state.TaskSet, err error) {
 	if err := opts.setDefaultLane(st); err != nil {
 		return nil, nil, err
 	}
 
+	if opts.DownloadRateLimit < 0 {
+		return nil, nil, fmt.Errorf("cannot use negative download rate limit: %d", opts.DownloadRateLimit)
+	}
+
+	if len(opts.SuppressAutoConnect) > 0 {
+		repo := ifacerepo.Get(st)
+		for _, iface := range opts.SuppressAutoConnect {
+			if repo.Interface(iface) == nil {
+				return nil, nil, fmt.Errorf("cannot suppress auto-connection: unknown interface %q", iface)
+			}
+		}
+	}
+
+	holdUntil, err := opts.refreshHold()
+	if err != nil {
+		return nil, nil, err
+	}
+
 	if err := setDefaultSnapstateOptions(st, &opts); err != nil {
 		return nil, nil, err
 	}
@@ -710,6 +1172,11 @@ func InstallWithGoal(ctx context.Context, st *state.State, goal InstallGoal, opt
 	if err != nil {
 		return nil, nil, err
 	}
+	defer func() {
+		if err != nil {
+			removeOwnedSnapFiles(targets)
+		}
+	}()
 
 	// this might be checked earlier in the implementation of InstallGoal, but
 	// we should check it here as well to be safe
@@ -717,10 +1184,18 @@ func InstallWithGoal(ctx context.Context, st *state.State, goal InstallGoal, opt
 		return nil, nil, ErrExpectedOneSnap
 	}
 
+	if err := checkInstallOrdering(st, targets); err != nil {
+		return nil, nil, err
+	}
+
 	sortComponentsOnTargets(targets)
 
 	installInfos := make([]minimalInstallInfo, 0, len(targets))
 	for _, t := range targets {
+		// TODO:COMPS: support checking for available space for components
+		if len(t.componentsOnly) > 0 {
+			continue
+		}
 		installInfos = append(installInfos, installSnapInfo{t.info})
 	}
 
@@ -728,9 +1203,25 @@ func InstallWithGoal(ctx context.Context, st *state.State, goal InstallGoal, opt
 		return nil, nil, err
 	}
 
+	groupLanes := make(map[string]int)
+
 	tasksets := make([]*state.TaskSet, 0, len(targets))
-	infos := make([]*snap.Info, 0, len(targets))
+	results := make([]InstallResult, 0, len(targets))
 	for _, t := range targets {
+		if len(t.componentsOnly) > 0 {
+			ts, err := installComponentsOnly(ctx, st, t, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			if lane := groupLane(st, t.laneGroup, groupLanes, opts); lane != 0 {
+				ts.JoinLane(lane)
+			}
+
+			tasksets = append(tasksets, ts)
+			results = append(results, InstallResult{Info: t.info, Channel: t.resolvedChannel()})
+			continue
+		}
+
 		if t.setup.SnapPath != "" && t.setup.DownloadInfo != nil {
 			return nil, nil, errors.New("internal error: target cannot specify both a path and a download info")
 		}
@@ -745,6 +1236,7 @@ func InstallWithGoal(ctx context.Context, st *state.State, goal InstallGoal, opt
 		if err != nil {
 			return nil, nil, err
 		}
+		snapsup.RefreshHoldUntil = holdUntil
 
 		var instFlags int
 		if opts.Flags.SkipConfigure {
@@ -756,13 +1248,160 @@ func InstallWithGoal(ctx context.Context, st *state.State, goal InstallGoal, opt
 			return nil, nil, err
 		}
 
-		ts.JoinLane(generateLane(st, opts))
+		if o := snapsup.CohortOverride; o != nil && len(ts.Tasks()) > 0 {
+			ts.Tasks()[0].Logf("Cohort %q of snap %q not used, revision pinned by validation sets: %s",
+				o.CohortKey, snapsup.InstanceName(), snapasserts.ValidationSetKeySlice(o.ValidationSets).CommaSeparated())
+		}
+
+		lane := groupLane(st, t.laneGroup, groupLanes, opts)
+		if lane == 0 {
+			lane = generateLane(st, opts)
+		}
+		ts.JoinLane(lane)
 
 		tasksets = append(tasksets, ts)
-		infos = append(infos, t.info)
+		results = append(results, InstallResult{Info: t.info, Channel: t.resolvedChannel()})
 	}
 
-	return infos, tasksets, nil
+	orderInstallTasks(targets, tasksets)
+
+	return results, tasksets, nil
+}
+
+// removeOwnedSnapFiles removes the snap files owned by the given targets,
+// for when no change takes ownership of them.
+func removeOwnedSnapFiles(targets []target) {
+	for _, t := range targets {
+		if !t.removeSnapPath {
+			continue
+		}
+		if err := os.Remove(t.setup.SnapPath); err != nil && !os.IsNotExist(err) {
+			logger.Noticef("Failed to cleanup %s: %s", t.setup.SnapPath, err)
+		}
+	}
+}
+
+// groupLane returns the lane shared by the targets of the given lane group,
+// allocating it on first use, or 0 if the targets should use the lane from
+// generateLane instead.
+func groupLane(st *state.State, group string, lanes map[string]int, opts Options) int {
+	if group == "" || opts.Flags.Transaction == client.TransactionAllSnaps {
+		return 0
+	}
+
+	lane, ok := lanes[group]
+	if !ok {
+		lane = st.NewLane()
+		lanes[group] = lane
+	}
+	return lane
+}
+
+// installComponentsOnly returns a single task set that installs the components
+// of the given target into its already installed snap.
+func installComponentsOnly(ctx context.Context, st *state.State, t target, opts Options) (*state.TaskSet, error) {
+	tss, err := InstallComponents(ctx, st, t.componentsOnly, t.info, nil, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := state.NewTaskSet()
+	for _, compTs := range tss {
+		ts.AddAll(compTs)
+	}
+
+	// the last task set holds the task that carries the snap setup for all of
+	// the components
+	if setup := tss[len(tss)-1].MaybeEdge(SnapSetupEdge); setup != nil {
+		ts.MarkEdge(setup, SnapSetupEdge)
+	}
+
+	return ts, nil
+}
+
+// checkInstallOrdering verifies that the ordering constraints of the given
+// targets can be satisfied. Every snap that a target must be installed after
+// must either be one of the targets or already be installed, and the
+// constraints between targets must not form a cycle.
+func checkInstallOrdering(st *state.State, targets []target) error {
+	byName := make(map[string]*target, len(targets))
+	for i := range targets {
+		byName[targets[i].info.InstanceName()] = &targets[i]
+	}
+
+	for _, t := range targets {
+		name := t.info.InstanceName()
+		for _, dep := range t.after {
+			if dep == name {
+				return fmt.Errorf("cannot order snap %q after itself", name)
+			}
+			if _, ok := byName[dep]; ok {
+				continue
+			}
+
+			var snapst SnapState
+			if err := Get(st, dep, &snapst); err != nil && !errors.Is(err, state.ErrNoState) {
+				return err
+			}
+			if !snapst.IsInstalled() {
+				return fmt.Errorf("cannot order snap %q after %q: snap is neither installed nor part of the operation", name, dep)
+			}
+		}
+	}
+
+	// snaps not visited yet have no mark
+	const (
+		visiting = iota + 1
+		visited
+	)
+	marks := make(map[string]int, len(targets))
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch marks[name] {
+		case visiting:
+			return fmt.Errorf("cannot order snaps: cyclic ordering constraint involving %q", name)
+		case visited:
+			return nil
+		}
+		marks[name] = visiting
+		for _, dep := range byName[name].after {
+			if _, ok := byName[dep]; !ok {
+				continue
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		marks[name] = visited
+		return nil
+	}
+
+	for _, t := range targets {
+		if err := visit(t.info.InstanceName()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// orderInstallTasks makes the tasks of each target wait for all the tasks of
+// the targets that it must be installed after. The tasksets are expected to
+// be in the same order as the targets. Constraints on snaps that are not part
+// of the targets are already satisfied and are ignored.
+func orderInstallTasks(targets []target, tasksets []*state.TaskSet) {
+	byName := make(map[string]*state.TaskSet, len(targets))
+	for i, t := range targets {
+		byName[t.info.InstanceName()] = tasksets[i]
+	}
+
+	for i, t := range targets {
+		for _, dep := range t.after {
+			if depTs, ok := byName[dep]; ok {
+				tasksets[i].WaitAll(depTs)
+			}
+		}
+	}
 }
 
 // generateLane returns the lane to use for the tasks that all operate on a
@@ -807,17 +1446,131 @@ func setDefaultSnapstateOptions(st *state.State, opts *Options) error {
 	return nil
 }
 
-// pathInstallGoal represents a single snap to be installed from a path on disk.
-type pathInstallGoal struct {
-	snap PathSnap
+// manifestInstallGoal represents the snaps listed by a seed manifest, to be
+// installed from the store at the revisions recorded there.
+type manifestInstallGoal struct {
+	storeInstallGoal
+	// validationSets are the validation sets listed by the manifest, they
+	// are enforced in addition to the ones already enforced on the system.
+	validationSets []*seedwriter.ManifestValidationSet
+	// componentRevisions are the revisions of the components listed by the
+	// manifest. The store resolves the component revisions from the snap
+	// revision, so they are checked against the ones it offers.
+	componentRevisions map[naming.ComponentRef]snap.Revision
 }
 
-// PathInstallGoal creates a new InstallGoal to install a snap from a given from
-// a path on disk. If instanceName is not provided, si.RealName will be used.
-func PathInstallGoal(sn PathSnap) InstallGoal {
-	if sn.InstanceName == "" {
-		sn.InstanceName = sn.SideInfo.RealName
-	}
+// ManifestInstallGoal creates a new InstallGoal to install the snaps listed
+// in the seed manifest at manifestPath from the store. Each snap is pinned to
+// the revision recorded in the manifest and is installed together with the
+// components listed for it, which must be offered by the store at the
+// revisions recorded in the manifest. The validation sets listed in the
+// manifest must be present in the assertions database already, they are
+// enforced for the installation on top of the ones enforced on the system, but
+// their tracking is not changed.
+func ManifestInstallGoal(manifestPath string) (InstallGoal, error) {
+	manifest, err := seedwriter.ReadManifest(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	comps := make(map[string][]string)
+	compRevs := make(map[naming.ComponentRef]snap.Revision)
+	for _, comp := range manifest.AllowedComponentRevisions() {
+		comps[comp.Component.SnapName] = append(comps[comp.Component.SnapName], comp.Component.ComponentName)
+		compRevs[comp.Component] = comp.Revision
+	}
+
+	revs := manifest.AllowedSnapRevisions()
+	snaps := make([]StoreSnap, 0, len(revs))
+	for _, rev := range revs {
+		snaps = append(snaps, StoreSnap{
+			InstanceName: rev.SnapName,
+			Components:   comps[rev.SnapName],
+			RevOpts: RevisionOptions{
+				Revision: rev.Revision,
+			},
+		})
+	}
+
+	return &manifestInstallGoal{
+		storeInstallGoal:   storeInstallGoal{snaps: snaps},
+		validationSets:     manifest.AllowedValidationSets(),
+		componentRevisions: compRevs,
+	}, nil
+}
+
+// toInstall enforces the validation sets of the manifest for the snaps and
+// returns the data needed to setup them from the store for installation. It
+// fails if the store offers components at revisions other than the ones
+// recorded in the manifest.
+func (m *manifestInstallGoal) toInstall(ctx context.Context, st *state.State, opts Options) ([]target, error) {
+	if len(m.validationSets) != 0 && !opts.Flags.IgnoreValidation {
+		vsets, err := m.resolveValidationSets(st)
+		if err != nil {
+			return nil, err
+		}
+		for i := range m.snaps {
+			m.snaps[i].RevOpts.ValidationSets = vsets
+		}
+	}
+
+	targets, err := m.storeInstallGoal.toInstall(ctx, st, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range targets {
+		for _, comp := range t.components {
+			csi := comp.CompSideInfo
+			if rev := m.componentRevisions[csi.Component]; rev != csi.Revision {
+				return nil, fmt.Errorf("cannot install component %q: store offers revision %s, manifest requires revision %s", csi.Component, csi.Revision, rev)
+			}
+		}
+	}
+
+	return targets, nil
+}
+
+// resolveValidationSets returns the validation sets enforced on the system
+// together with the ones listed in the manifest, looked up in the assertions
+// database.
+func (m *manifestInstallGoal) resolveValidationSets(st *state.State) (*snapasserts.ValidationSets, error) {
+	vsKeys := make(map[string][]string, len(m.validationSets))
+	for _, vs := range m.validationSets {
+		vsKeys[vs.Unique()] = []string{release.Series, vs.AccountID, vs.Name, strconv.Itoa(vs.Sequence)}
+	}
+
+	valsets, err := ResolveLocalValidationSets(st, vsKeys)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find validation sets of the manifest: %v", err)
+	}
+
+	extra := make([]*asserts.ValidationSet, 0, len(valsets))
+	for _, vs := range m.validationSets {
+		extra = append(extra, valsets[vs.Unique()])
+	}
+
+	vsets, err := EnforcedValidationSets(st, extra...)
+	if err != nil {
+		return nil, err
+	}
+	if err := vsets.Conflict(); err != nil {
+		return nil, err
+	}
+	return vsets, nil
+}
+
+// pathInstallGoal represents a single snap to be installed from a path on disk.
+type pathInstallGoal struct {
+	snap PathSnap
+}
+
+// PathInstallGoal creates a new InstallGoal to install a snap from a given from
+// a path on disk. If instanceName is not provided, si.RealName will be used.
+func PathInstallGoal(sn PathSnap) InstallGoal {
+	if sn.InstanceName == "" {
+		sn.InstanceName = sn.SideInfo.RealName
+	}
 
 	return &pathInstallGoal{
 		snap: sn,
@@ -831,13 +1584,158 @@ func (p *pathInstallGoal) toInstall(ctx context.Context, st *state.State, opts O
 		return nil, err
 	}
 
-	t, err := targetForPathSnap(p.snap, snapst, opts)
+	t, err := targetForPathSnap(st, p.snap, snapst, "install", opts)
 	if err != nil {
 		return nil, err
 	}
+	t.after = p.snap.After
 	return []target{t}, nil
 }
 
+// urlInstallGoal represents a single snap to be installed from a snap file
+// downloaded from an HTTP(S) URL.
+type urlInstallGoal struct {
+	url string
+	si  *snap.SideInfo
+}
+
+// URLInstallGoal creates a new InstallGoal to install a snap from a snap file
+// downloaded from the given HTTP(S) URL. Once downloaded into the blob
+// directory, the snap is installed as if it was installed from a path on disk.
+// No assertions are fetched for the snap, so it is always installed
+// unasserted, as with --dangerous, and si can only carry the name of the snap.
+// If si is nil or has no name set, the name from its snap.yaml is used. Since
+// this bypasses the store provenance of snaps, the experimental url-install
+// feature must be enabled.
+func URLInstallGoal(snapURL string, si *snap.SideInfo) InstallGoal {
+	return &urlInstallGoal{
+		url: snapURL,
+		si:  si,
+	}
+}
+
+// toInstall downloads the snap file and returns the data needed to setup the
+// snap from disk.
+func (u *urlInstallGoal) toInstall(ctx context.Context, st *state.State, opts Options) (targets []target, err error) {
+	tr := config.NewTransaction(st)
+	enabled, err := features.Flag(tr, features.URLInstall)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, fmt.Errorf("experimental feature disabled - test it by setting 'experimental.url-install' to true")
+	}
+
+	parsed, err := url.Parse(u.url)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, fmt.Errorf("cannot install snap from %q: only http and https URLs are supported", u.url)
+	}
+
+	var si snap.SideInfo
+	if u.si != nil {
+		si = *u.si
+	}
+	// nothing ties the downloaded blob to assertions, so the snap cannot
+	// claim the identity of an asserted one
+	if si.SnapID != "" || !si.Revision.Unset() {
+		return nil, fmt.Errorf("cannot install snap from %q: snaps downloaded from a URL are installed unasserted, snap-id and revision cannot be set", u.url)
+	}
+
+	path, err := downloadSnapFromURL(ctx, st, u.url)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+
+	if si.RealName == "" {
+		info, _, oerr := backend.OpenSnapFile(path, nil)
+		if oerr != nil {
+			return nil, fmt.Errorf("cannot open snap file downloaded from %q: %v", u.url, oerr)
+		}
+		si.RealName = info.SnapName()
+	}
+
+	var snapst SnapState
+	if err = Get(st, si.RealName, &snapst); err != nil && !errors.Is(err, state.ErrNoState) {
+		return nil, err
+	}
+
+	t, err := targetForPathSnap(st, PathSnap{
+		Path:         path,
+		InstanceName: si.RealName,
+		SideInfo:     &si,
+	}, snapst, "install", opts)
+	if err != nil {
+		return nil, err
+	}
+	t.removeSnapPath = true
+	return []target{t}, nil
+}
+
+var urlInstallHTTPClient = func() *http.Client {
+	return httputil.NewHTTPClient(nil)
+}
+
+// urlInstallMaxSize is the maximum size of a snap file downloaded from a URL.
+var urlInstallMaxSize int64 = 4 * 1024 * 1024 * 1024
+
+// downloadSnapFromURL downloads the snap file at the given URL into a
+// temporary file in the blob directory and returns its path. The file is
+// named like the files of local installs so that it is cleaned up with them
+// if no change ends up owning it. The state is unlocked during the download.
+func downloadSnapFromURL(ctx context.Context, st *state.State, snapURL string) (path string, err error) {
+	if err := os.MkdirAll(dirs.SnapBlobDir, 0755); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(dirs.SnapBlobDir, dirs.LocalInstallBlobTempPrefix+"*")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		f.Close()
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+
+	st.Unlock()
+	defer st.Lock()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", snapURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := urlInstallHTTPClient().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("cannot download snap from %q: %v", snapURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cannot download snap from %q: unexpected status %q", snapURL, resp.Status)
+	}
+	if resp.ContentLength > urlInstallMaxSize {
+		return "", fmt.Errorf("cannot download snap from %q: size %d exceeds the limit of %d bytes", snapURL, resp.ContentLength, urlInstallMaxSize)
+	}
+	// the content length is not to be trusted, read one byte past the limit
+	// to tell a file that is too large
+	n, err := io.Copy(f, io.LimitReader(resp.Body, urlInstallMaxSize+1))
+	if err != nil {
+		return "", fmt.Errorf("cannot download snap from %q: %v", snapURL, err)
+	}
+	if n > urlInstallMaxSize {
+		return "", fmt.Errorf("cannot download snap from %q: size exceeds the limit of %d bytes", snapURL, urlInstallMaxSize)
+	}
+	if err := f.Sync(); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
 func componentSetupsFromPaths(snapInfo *snap.Info, components []PathComponent) ([]ComponentSetup, error) {
 	setups := make([]ComponentSetup, 0, len(components))
 	for _, pc := range components {
@@ -867,9 +1765,258 @@ func validatedComponentInfo(path string, si *snap.Info, csi *snap.ComponentSideI
 	if err := snap.ValidateComponentContainer(cont, csi.Component.String(), logger.Noticef); err != nil {
 		return nil, err
 	}
+
+	// the side info overrides the identity read from the container, so check
+	// what the component file itself declares
+	declared, err := snap.ReadComponentInfoFromContainer(cont, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open snap file: %v", err)
+	}
+	if declared.Component != csi.Component {
+		return nil, fmt.Errorf("cannot install component file %q: %v != %v (component mismatch)", path, declared.Component, csi.Component)
+	}
 	return componentInfo, nil
 }
 
+// DownloadGoal represents a single snap or a group of snaps to be downloaded
+// without being installed.
+type DownloadGoal interface {
+	// toDownload returns the data needed to download the snaps.
+	toDownload(context.Context, *state.State, Options) ([]target, error)
+}
+
+// storeDownloadGoal implements the DownloadGoal interface and represents a
+// group of snaps that are to be downloaded from the store.
+type storeDownloadGoal storeInstallGoal
+
+// StoreDownloadGoal creates a new DownloadGoal to download snaps from the
+// store. If a snap is provided more than once in the list, the first instance
+// of it will be used to provide the download options. The SkipIfPresent and
+// After fields of the given snaps are ignored, snaps are downloaded whether
+// they are installed or not.
+func StoreDownloadGoal(snaps ...StoreSnap) DownloadGoal {
+	return &storeDownloadGoal{
+		snaps: uniqueStoreSnaps(snaps),
+	}
+}
+
+// toDownload returns the data needed to download the snaps from the store.
+func (s *storeDownloadGoal) toDownload(ctx context.Context, st *state.State, opts Options) ([]target, error) {
+	if opts.ExpectOneSnap && len(s.snaps) != 1 {
+		return nil, ErrExpectedOneSnap
+	}
+
+	enforcedSetsFunc := cachedEnforcedValidationSets(st)
+	for i := range s.snaps {
+		sn := &s.snaps[i]
+		if err := snap.ValidateInstanceName(sn.InstanceName); err != nil {
+			return nil, fmt.Errorf("invalid instance name: %v", err)
+		}
+
+		if err := validateRevisionOpts(&sn.RevOpts); err != nil {
+			return nil, fmt.Errorf("invalid revision options for snap %q: %w", sn.InstanceName, err)
+		}
+
+		// see storeInstallGoal.validateAndPrune on defaulting the channel
+		if sn.RevOpts.Channel == "" && sn.RevOpts.Revision.Unset() {
+			sn.RevOpts.Channel = "stable"
+		}
+
+		if err := sn.RevOpts.resolveChannel(sn.InstanceName, "stable", opts.DeviceCtx); err != nil {
+			return nil, err
+		}
+
+		if err := sn.RevOpts.initializeValidationSets(enforcedSetsFunc, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	results, err := sendInstallOrDownloadActions(ctx, st, "download", s.snaps, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	downloads := make([]target, 0, len(results))
+	for _, r := range results {
+		sn, ok := (*storeInstallGoal)(s).snap(r.InstanceName())
+		if !ok {
+			return nil, fmt.Errorf("store returned unsolicited snap action: %s", r.InstanceName())
+		}
+
+		channel := sn.RevOpts.Channel
+		if r.RedirectChannel != "" {
+			channel = r.RedirectChannel
+		}
+
+		comps, err := storeSnapComponentTargets("download", r, sn)
+		if err != nil {
+			return nil, fmt.Errorf("cannot extract components from snap resources: %w", err)
+		}
+
+		if err := checkSnapAgainstValidationSets(r.Info, comps, "download", sn.RevOpts.ValidationSets); err != nil {
+			return nil, err
+		}
+
+		downloads = append(downloads, target{
+			setup: SnapSetup{
+				DownloadInfo: &r.DownloadInfo,
+				Channel:      channel,
+				CohortKey:    sn.RevOpts.CohortKey,
+			},
+			info:       r.Info,
+			components: comps,
+		})
+	}
+
+	return downloads, nil
+}
+
+// DownloadedSnap describes a snap that was downloaded by DownloadWithGoal.
+type DownloadedSnap struct {
+	// Info is the snap.Info of the downloaded snap.
+	Info *snap.Info
+	// Path is the path of the downloaded snap file.
+	Path string
+	// ComponentPaths maps the names of the downloaded components of the snap
+	// to the paths of their files.
+	ComponentPaths map[string]string
+	// AssertionsPath is the path of the file with the assertions of the snap
+	// and of its components.
+	AssertionsPath string
+}
+
+// FetchAndSaveDownloadAssertions allows to hook fetching and cross checking
+// the assertions of a snap downloaded by DownloadWithGoal, and of the given
+// components of it, and saving them into assertsPath.
+var FetchAndSaveDownloadAssertions func(st *state.State, info *snap.Info, snapPath string, compsups []ComponentSetup, assertsPath string, userID int, deviceCtx DeviceContext) error
+
+// DownloadWithGoal downloads the snap/set of snaps specified by the given
+// DownloadGoal into opts.DownloadDir, without installing them.
+//
+// Unlike Download, the snaps and their components are downloaded directly
+// rather than by tasks. Their assertions are fetched, checked against the
+// downloaded files and saved next to them in a <snap>_<revision>.assert
+// file, as done by snap download. The snaps are checked against the enforced
+// validation sets, or the ones given in their revision options, before being
+// downloaded. If anything fails, the files downloaded so far are removed.
+//
+// The state must be locked by the caller, it is released while talking to the
+// store.
+func DownloadWithGoal(ctx context.Context, st *state.State, goal DownloadGoal, opts Options) (_ []DownloadedSnap, err error) {
+	if opts.DownloadDir == "" {
+		return nil, errors.New("internal error: must specify directory to download to")
+	}
+
+	if FetchAndSaveDownloadAssertions == nil {
+		return nil, errors.New("internal error: FetchAndSaveDownloadAssertions is unset")
+	}
+
+	if opts.DownloadRateLimit < 0 {
+		return nil, fmt.Errorf("cannot use negative download rate limit: %d", opts.DownloadRateLimit)
+	}
+
+	opts.DeviceCtx, err = DeviceCtxFromState(st, opts.DeviceCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	targets, err := goal.toDownload(ctx, st, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.ExpectOneSnap && len(targets) != 1 {
+		return nil, ErrExpectedOneSnap
+	}
+
+	sortComponentsOnTargets(targets)
+
+	infos := make([]minimalInstallInfo, 0, len(targets))
+	for _, t := range targets {
+		if opts.Flags.RequireTypeBase && t.info.Type() != snap.TypeBase && t.info.Type() != snap.TypeOS {
+			return nil, fmt.Errorf("unexpected snap type %q, instead of 'base'", t.info.Type())
+		}
+		infos = append(infos, installSnapInfo{t.info})
+	}
+
+	// TODO:COMPS: support checking for available space for components
+	if err := checkDiskSpaceDownload(infos, opts.DownloadDir); err != nil {
+		return nil, err
+	}
+
+	user, err := userFromUserID(st, opts.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	sto := Store(st, opts.DeviceCtx)
+	dlOpts := &store.DownloadOptions{RateLimit: opts.DownloadRateLimit}
+
+	// files downloaded so far, removed if anything fails
+	var paths []string
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, p := range paths {
+			if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+				logger.Noticef("cannot remove %q: %v", p, err)
+			}
+		}
+	}()
+
+	downloaded := make([]DownloadedSnap, 0, len(targets))
+	for _, t := range targets {
+		instanceName := t.info.InstanceName()
+		dl := DownloadedSnap{
+			Info: t.info,
+			Path: snap.MountFileInDir(opts.DownloadDir, instanceName, t.info.Revision),
+		}
+
+		paths = append(paths, dl.Path)
+		st.Unlock()
+		err := sto.Download(ctx, t.info.SnapName(), dl.Path, t.setup.DownloadInfo, progress.Null, user, dlOpts)
+		st.Lock()
+		if err != nil {
+			return nil, fmt.Errorf("cannot download snap %q: %w", instanceName, err)
+		}
+
+		if len(t.components) > 0 {
+			dl.ComponentPaths = make(map[string]string, len(t.components))
+		}
+		compsups := make([]ComponentSetup, 0, len(t.components))
+		for _, compsup := range t.components {
+			compsup.DownloadBlobDir = opts.DownloadDir
+			compsup.CompPath = compsup.BlobPath(instanceName)
+
+			paths = append(paths, compsup.CompPath)
+			st.Unlock()
+			err := sto.Download(ctx, compsup.CompSideInfo.Component.String(), compsup.CompPath, compsup.DownloadInfo, progress.Null, user, dlOpts)
+			st.Lock()
+			if err != nil {
+				return nil, fmt.Errorf("cannot download component %q: %w", compsup.ComponentName(), err)
+			}
+
+			dl.ComponentPaths[compsup.ComponentName()] = compsup.CompPath
+			compsups = append(compsups, compsup)
+		}
+
+		dl.AssertionsPath = strings.TrimSuffix(dl.Path, filepath.Ext(dl.Path)) + ".assert"
+		paths = append(paths, dl.AssertionsPath)
+		if err := FetchAndSaveDownloadAssertions(st, t.info, dl.Path, compsups, dl.AssertionsPath, opts.UserID, opts.DeviceCtx); err != nil {
+			return nil, fmt.Errorf("cannot fetch assertions for snap %q: %w", instanceName, err)
+		}
+
+		if opts.PrereqTracker != nil {
+			opts.PrereqTracker.Add(t.info)
+		}
+
+		downloaded = append(downloaded, dl)
+	}
+
+	return downloaded, nil
+}
+
 // updatePlan contains the data that describes an update, including a list of
 // target structs that represent the snaps that are to be updated.
 type updatePlan struct {
@@ -879,6 +2026,35 @@ type updatePlan struct {
 	// targets is the list of snaps that are to be updated. Note that this list
 	// does not necessarily match the list of snaps in requested.
 	targets []target
+	// skipped maps the instance names of the snaps that were removed from
+	// targets while refreshing all snaps to the reason why.
+	skipped map[string]string
+}
+
+// skip records that the given snap was removed from the targets for the given
+// reason.
+func (p *updatePlan) skip(name, reason string) {
+	if p.skipped == nil {
+		p.skipped = make(map[string]string)
+	}
+	p.skipped[name] = reason
+}
+
+// noUpdate returns, sorted, the requested snaps that are neither among the
+// given updated snaps nor skipped.
+func (p *updatePlan) noUpdate(updated []string) []string {
+	var noUpdate []string
+	for _, name := range p.requested {
+		if strutil.ListContains(updated, name) {
+			continue
+		}
+		if _, ok := p.skipped[name]; ok {
+			continue
+		}
+		noUpdate = append(noUpdate, name)
+	}
+	sort.Strings(noUpdate)
+	return noUpdate
 }
 
 // refreshAll returns true if all snaps on the system are being refreshed (could
@@ -957,6 +2133,43 @@ func (p *updatePlan) revisionChanges(st *state.State, opts Options) ([]*snap.Inf
 	return changes, nil
 }
 
+// confinementChanges returns the snaps that will have their confinement
+// changed by the updates in this plan, compared to the currently installed
+// revision of each snap.
+func (p *updatePlan) confinementChanges() []*snap.Info {
+	changes := make([]*snap.Info, 0, len(p.targets))
+	for _, t := range p.targets {
+		if confinementChanged(t.info, &t.snapst) {
+			changes = append(changes, t.info)
+		}
+	}
+	return changes
+}
+
+// confinementChanged returns true if the given update uses a different
+// confinement than the currently installed revision of the snap.
+func confinementChanged(update *snap.Info, snapst *SnapState) bool {
+	if !snapst.IsInstalled() {
+		return false
+	}
+
+	cur, err := snapst.CurrentInfo()
+	if err != nil {
+		return false
+	}
+
+	return effectiveConfinement(update) != effectiveConfinement(cur)
+}
+
+// effectiveConfinement returns the confinement of the given snap, taking into
+// account that snaps that do not specify a confinement are strictly confined.
+func effectiveConfinement(info *snap.Info) snap.ConfinementType {
+	if info.Confinement == "" {
+		return snap.StrictConfinement
+	}
+	return info.Confinement
+}
+
 // filter applies the given function to each target in the update plan and
 // removes any targets for which the function returns false.
 func (p *updatePlan) filter(f func(t target) (bool, error)) error {
@@ -971,7 +2184,53 @@ func (p *updatePlan) filter(f func(t target) (bool, error)) error {
 			filtered = append(filtered, t)
 		}
 	}
-	p.targets = filtered
+	p.targets = filtered
+	return nil
+}
+
+// filterUnchangedRevisions removes any targets from the update plan that would
+// change neither the revision of the snap nor the revision of any of its
+// components.
+func (p *updatePlan) filterUnchangedRevisions() error {
+	return p.filter(func(t target) (bool, error) {
+		up := update{
+			SnapState: t.snapst,
+			Setup: SnapSetup{
+				SideInfo:     &t.info.SideInfo,
+				AlwaysUpdate: t.setup.AlwaysUpdate,
+			},
+			Components: t.components,
+		}
+		satisfied, err := up.revisionSatisfied()
+		return !satisfied, err
+	})
+}
+
+// clearAlwaysUpdateOnUnchangedRevisions makes the targets that were requested
+// by revision, but that would change neither the revision of the snap nor the
+// revision of any of its components, go only through switching their metadata
+// rather than through the entire update.
+func (p *updatePlan) clearAlwaysUpdateOnUnchangedRevisions() error {
+	for i := range p.targets {
+		t := &p.targets[i]
+		if !t.setup.AlwaysUpdate {
+			continue
+		}
+		up := update{
+			SnapState: t.snapst,
+			Setup: SnapSetup{
+				SideInfo: &t.info.SideInfo,
+			},
+			Components: t.components,
+		}
+		satisfied, err := up.revisionSatisfied()
+		if err != nil {
+			return err
+		}
+		if satisfied {
+			t.setup.AlwaysUpdate = false
+		}
+	}
 	return nil
 }
 
@@ -996,8 +2255,11 @@ func (p *updatePlan) filterHeldSnaps(st *state.State, opts Options) error {
 	}
 
 	p.filter(func(t target) (bool, error) {
-		_, ok := heldSnaps[t.info.InstanceName()]
-		return !ok, nil
+		if _, ok := heldSnaps[t.info.InstanceName()]; ok {
+			p.skip(t.info.InstanceName(), SkipReasonHeld)
+			return false, nil
+		}
+		return true, nil
 	})
 
 	return nil
@@ -1034,8 +2296,11 @@ func (p *updatePlan) validateAndFilterTargets(st *state.State, opts Options) err
 	}
 
 	p.filter(func(t target) (bool, error) {
-		_, ok := validatedMap[t.info.InstanceName()]
-		return ok, nil
+		if _, ok := validatedMap[t.info.InstanceName()]; !ok {
+			p.skip(t.info.InstanceName(), SkipReasonRefreshControl)
+			return false, nil
+		}
+		return true, nil
 	})
 
 	return nil
@@ -1066,15 +2331,21 @@ func UpdateOne(ctx context.Context, st *state.State, goal UpdateGoal, filter upd
 	return uts.Refresh[0], nil
 }
 
-// UpdateWithGoal updates the snap/set of snaps specified by the given
-// UpdateGoal.
-func UpdateWithGoal(ctx context.Context, st *state.State, goal UpdateGoal, filter updateFilter, opts Options) ([]string, *UpdateTaskSets, error) {
-	if err := setDefaultSnapstateOptions(st, &opts); err != nil {
-		return nil, nil, err
+// planUpdateWithGoal validates the options, which it fills with their
+// defaults, and returns the plan to update the snaps specified by the given
+// UpdateGoal, with the targets left out by the filter and the held snaps
+// removed.
+func planUpdateWithGoal(ctx context.Context, st *state.State, goal UpdateGoal, filter updateFilter, opts *Options) (updatePlan, error) {
+	if err := setDefaultSnapstateOptions(st, opts); err != nil {
+		return updatePlan{}, err
 	}
 
 	if opts.ExpectOneSnap && opts.Flags.IsAutoRefresh {
-		return nil, nil, errors.New("internal error: auto-refresh is not supported when updating a single snap")
+		return updatePlan{}, errors.New("internal error: auto-refresh is not supported when updating a single snap")
+	}
+
+	if opts.DownloadRateLimit < 0 {
+		return updatePlan{}, fmt.Errorf("cannot use negative download rate limit: %d", opts.DownloadRateLimit)
 	}
 
 	// TODO: note that we cannot use opts.setDefaultLane here, since there is an
@@ -1084,27 +2355,54 @@ func UpdateWithGoal(ctx context.Context, st *state.State, goal UpdateGoal, filte
 	//
 	// can only specify a lane when running multiple operations transactionally
 	if opts.Flags.Transaction != client.TransactionAllSnaps && opts.Flags.Lane != 0 {
-		return nil, nil, errors.New("cannot specify a lane without setting transaction to \"all-snaps\"")
+		return updatePlan{}, errors.New("cannot specify a lane without setting transaction to \"all-snaps\"")
 	}
 
-	plan, err := goal.toUpdate(ctx, st, opts)
+	plan, err := goal.toUpdate(ctx, st, *opts)
 	if err != nil {
-		return nil, nil, err
+		return updatePlan{}, err
 	}
 
 	sortComponentsOnTargets(plan.targets)
 
 	if opts.ExpectOneSnap && len(plan.targets) != 1 {
-		return nil, nil, ErrExpectedOneSnap
+		return updatePlan{}, ErrExpectedOneSnap
 	}
 
 	if filter != nil {
 		plan.filter(func(t target) (bool, error) {
-			return filter(t.info, &t.snapst), nil
+			if !filter(t.info, &t.snapst) {
+				plan.skip(t.info.InstanceName(), SkipReasonFiltered)
+				return false, nil
+			}
+			return true, nil
 		})
 	}
 
-	if err := plan.filterHeldSnaps(st, opts); err != nil {
+	if opts.SkipChannelOnlySwitches {
+		if err := plan.clearAlwaysUpdateOnUnchangedRevisions(); err != nil {
+			return updatePlan{}, err
+		}
+	}
+
+	if opts.OnlyRevisionChanges {
+		if err := plan.filterUnchangedRevisions(); err != nil {
+			return updatePlan{}, err
+		}
+	}
+
+	if err := plan.filterHeldSnaps(st, *opts); err != nil {
+		return updatePlan{}, err
+	}
+
+	return plan, nil
+}
+
+// UpdateWithGoal updates the snap/set of snaps specified by the given
+// UpdateGoal.
+func UpdateWithGoal(ctx context.Context, st *state.State, goal UpdateGoal, filter updateFilter, opts Options) ([]string, *UpdateTaskSets, error) {
+	plan, err := planUpdateWithGoal(ctx, st, goal, filter, &opts)
+	if err != nil {
 		return nil, nil, err
 	}
 
@@ -1171,6 +2469,8 @@ func updateFromPlan(st *state.State, plan updatePlan, opts Options) ([]string, *
 	if err != nil {
 		return nil, nil, err
 	}
+	uts.Skipped = plan.skipped
+	uts.NoUpdate = plan.noUpdate(updated)
 
 	// if we're only updating one snap, flatten everything into one task set
 	if opts.ExpectOneSnap && len(uts.Refresh) > 1 {
@@ -1189,6 +2489,159 @@ func updateFromPlan(st *state.State, plan updatePlan, opts Options) ([]string, *
 	return updated, uts, nil
 }
 
+// UpdatePlanSummary summarizes what updating snaps with an UpdateGoal would
+// do.
+type UpdatePlanSummary struct {
+	// Updates describes the snaps that would be updated, sorted by instance
+	// name.
+	Updates []SnapUpdateSummary
+	// NoUpdate lists, sorted, the requested snaps that would not be updated.
+	NoUpdate []string
+	// Skipped maps the instance names of the snaps that would be left out of
+	// the update to the reason why.
+	Skipped map[string]string
+}
+
+// SnapUpdateSummary describes how updating a snap would change it.
+type SnapUpdateSummary struct {
+	// InstanceName is the instance name of the snap.
+	InstanceName string
+	// FromRevision is the current revision of the snap.
+	FromRevision snap.Revision
+	// ToRevision is the revision the snap would be updated to, it is the
+	// same as FromRevision if only the metadata of the snap, like its
+	// channel, would change.
+	ToRevision snap.Revision
+	// FromChannel is the channel the snap is currently tracking.
+	FromChannel string
+	// ToChannel is the channel the snap would track.
+	ToChannel string
+	// Components describes the components of the snap whose revisions would
+	// change, sorted by name.
+	Components []ComponentUpdateSummary
+}
+
+// ComponentUpdateSummary describes how updating a snap would change one of
+// its components.
+type ComponentUpdateSummary struct {
+	// Name is the name of the component.
+	Name string
+	// FromRevision is the current revision of the component, unset if the
+	// component would be installed.
+	FromRevision snap.Revision
+	// ToRevision is the revision the component would be updated to, unset if
+	// the component would be removed.
+	ToRevision snap.Revision
+}
+
+// PlanUpdate computes the update of the snap/set of snaps specified by the
+// given UpdateGoal, going through the same planning and filtering as
+// UpdateWithGoal, and returns a summary of it. No tasks are created and the
+// refresh candidates are not updated.
+func PlanUpdate(ctx context.Context, st *state.State, goal UpdateGoal, filter updateFilter, opts Options) (UpdatePlanSummary, error) {
+	plan, err := planUpdateWithGoal(ctx, st, goal, filter, &opts)
+	if err != nil {
+		return UpdatePlanSummary{}, err
+	}
+
+	if err := plan.validateAndFilterTargets(st, opts); err != nil {
+		return UpdatePlanSummary{}, err
+	}
+
+	updates, err := plan.updates(st, opts)
+	if err != nil {
+		return UpdatePlanSummary{}, err
+	}
+
+	summary := UpdatePlanSummary{
+		Skipped: plan.skipped,
+	}
+	updated := make([]string, 0, len(updates))
+	for _, up := range updates {
+		sum, ok, err := summarizeUpdate(up, opts)
+		if err != nil {
+			return UpdatePlanSummary{}, err
+		}
+		if !ok {
+			continue
+		}
+		summary.Updates = append(summary.Updates, sum)
+		updated = append(updated, sum.InstanceName)
+	}
+	sort.Slice(summary.Updates, func(i, j int) bool {
+		return summary.Updates[i].InstanceName < summary.Updates[j].InstanceName
+	})
+	summary.NoUpdate = plan.noUpdate(updated)
+
+	if opts.ExpectOneSnap && len(summary.Updates) == 0 {
+		return UpdatePlanSummary{}, store.ErrNoUpdateAvailable
+	}
+
+	return summary, nil
+}
+
+// summarizeUpdate returns the summary of the given update, and false if the
+// update would change nothing, mirroring what doUpdate does with it.
+func summarizeUpdate(up update, opts Options) (SnapUpdateSummary, bool, error) {
+	satisfied, err := up.revisionSatisfied()
+	if err != nil {
+		return SnapUpdateSummary{}, false, err
+	}
+
+	if satisfied {
+		switchChannel := up.SnapState.TrackingChannel != up.Setup.Channel
+		switchCohortKey := up.SnapState.CohortKey != up.Setup.CohortKey
+		toggleIgnoreValidation := (up.SnapState.IgnoreValidation != up.Setup.IgnoreValidation) && opts.ExpectOneSnap
+		if !switchChannel && !switchCohortKey && !toggleIgnoreValidation {
+			return SnapUpdateSummary{}, false, nil
+		}
+	}
+
+	current, err := up.SnapState.CurrentComponentInfos()
+	if err != nil {
+		return SnapUpdateSummary{}, false, err
+	}
+
+	currentRevs := make(map[string]snap.Revision, len(current))
+	for _, comp := range current {
+		currentRevs[comp.Component.ComponentName] = comp.Revision
+	}
+
+	var comps []ComponentUpdateSummary
+	for _, compsup := range up.Components {
+		name := compsup.ComponentName()
+		from := currentRevs[name]
+		delete(currentRevs, name)
+		if from == compsup.Revision() {
+			continue
+		}
+		comps = append(comps, ComponentUpdateSummary{
+			Name:         name,
+			FromRevision: from,
+			ToRevision:   compsup.Revision(),
+		})
+	}
+	// the components that are not part of the update are removed
+	for name, from := range currentRevs {
+		comps = append(comps, ComponentUpdateSummary{
+			Name:         name,
+			FromRevision: from,
+		})
+	}
+	sort.Slice(comps, func(i, j int) bool {
+		return comps[i].Name < comps[j].Name
+	})
+
+	return SnapUpdateSummary{
+		InstanceName: up.Setup.InstanceName(),
+		FromRevision: up.SnapState.Current,
+		ToRevision:   up.Setup.Revision(),
+		FromChannel:  up.SnapState.TrackingChannel,
+		ToChannel:    up.Setup.Channel,
+		Components:   comps,
+	}, true, nil
+}
+
 // storeInstallGoal implements the UpdateGoal interface and represents a group
 // of snaps that are to be updated from the store.
 type storeUpdateGoal struct {
@@ -1205,6 +2658,11 @@ type StoreUpdate struct {
 	// AdditionalComponents is a list of additional components to install during
 	// the refresh.
 	AdditionalComponents []string
+	// PreserveComponentRevisions indicates that components that are already
+	// installed should be kept at their current revisions during the refresh,
+	// rather than being refreshed alongside the snap. Revisions that are
+	// required by validation sets take precedence over this.
+	PreserveComponentRevisions bool
 }
 
 // StoreUpdateGoal creates a new UpdateGoal to update snaps from the store.
@@ -1259,6 +2717,15 @@ func validateAndInitStoreUpdates(st *state.State, allSnaps map[string]*SnapState
 			return snap.NotInstalledError{Snap: sn.InstanceName}
 		}
 
+		if !sn.RevOpts.MaxRevision.Unset() {
+			if !sn.RevOpts.Revision.Unset() {
+				return errors.New("cannot specify revision and maximum revision")
+			}
+			if !sn.RevOpts.MaxRevision.Store() {
+				return fmt.Errorf("cannot use local revision %s as maximum revision", sn.RevOpts.MaxRevision)
+			}
+		}
+
 		// default to existing cohort key if we don't have a provided one
 		if sn.RevOpts.CohortKey == "" && !sn.RevOpts.LeaveCohort {
 			sn.RevOpts.CohortKey = snapst.CohortKey
@@ -1317,6 +2784,85 @@ func initRefreshAllStoreUpdates(st *state.State, opts Options, allSnaps map[stri
 	return updates, nil
 }
 
+// validationSetAlignUpdateGoal implements the UpdateGoal interface and
+// represents updating the installed snaps to the revisions required by a
+// set of validation sets.
+type validationSetAlignUpdateGoal struct {
+	vsets *snapasserts.ValidationSets
+}
+
+// ValidationSetAlignUpdateGoal creates a new UpdateGoal to bring the installed
+// snaps into compliance with the given validation sets. Each installed snap
+// that the sets require at a specific revision is updated, or downgraded, to
+// that revision from the store. Snaps that are invalid in the sets cannot be
+// aligned and result in an error.
+func ValidationSetAlignUpdateGoal(vsets *snapasserts.ValidationSets) UpdateGoal {
+	return &validationSetAlignUpdateGoal{
+		vsets: vsets,
+	}
+}
+
+func (v *validationSetAlignUpdateGoal) toUpdate(ctx context.Context, st *state.State, opts Options) (updatePlan, error) {
+	if v.vsets == nil {
+		return updatePlan{}, errors.New("internal error: validation sets must be provided to align snaps")
+	}
+
+	allSnaps, err := All(st)
+	if err != nil {
+		return updatePlan{}, err
+	}
+
+	var constrained []string
+	var updates []StoreUpdate
+	for instanceName, snapst := range allSnaps {
+		snapName, instanceKey := snap.SplitInstanceName(instanceName)
+		if instanceKey != "" {
+			// validation sets do not apply to parallel instances
+			continue
+		}
+
+		pres, err := v.vsets.Presence(naming.Snap(snapName))
+		if err != nil {
+			return updatePlan{}, err
+		}
+		if !pres.Constrained() {
+			continue
+		}
+
+		// a snap that is invalid in the sets needs to be removed, which
+		// is beyond what an update can do
+		if err := checkSnapAgainstConstraints(instanceName, snap.Revision{}, pres, "refresh"); err != nil {
+			return updatePlan{}, err
+		}
+
+		constrained = append(constrained, instanceName)
+		if pres.Revision.Unset() || pres.Revision == snapst.Current {
+			continue
+		}
+
+		updates = append(updates, StoreUpdate{
+			InstanceName: instanceName,
+			RevOpts: RevisionOptions{
+				Revision:       pres.Revision,
+				ValidationSets: v.vsets,
+			},
+		})
+	}
+
+	if len(constrained) == 0 {
+		// an empty list of requested snaps would mean refreshing all snaps
+		return updatePlan{}, fmt.Errorf("cannot align snaps: no installed snap is constrained by validation sets %s", snapasserts.ValidationSetKeySlice(v.vsets.Keys()).CommaSeparated())
+	}
+
+	if len(updates) == 0 {
+		// already aligned, nothing to do
+		sort.Strings(constrained)
+		return updatePlan{requested: constrained}, nil
+	}
+
+	return StoreUpdateGoal(updates...).toUpdate(ctx, st, opts)
+}
+
 // PathComponent represents a component of a snap that is to be installed
 // alongside a PathSnap.
 type PathComponent struct {
@@ -1341,6 +2887,10 @@ type PathSnap struct {
 	// Components is a mapping of component side infos to paths that should be
 	// installed alongside this snap.
 	Components []PathComponent
+	// After is a list of instance names of snaps that must be installed before
+	// this snap. Each snap must either be part of the same goal or already be
+	// installed. This is only considered when installing.
+	After []string
 }
 
 // pathUpdateGoal implements the UpdateGoal interface and represents a group of
@@ -1371,6 +2921,69 @@ func PathUpdateGoal(snaps ...PathSnap) UpdateGoal {
 	}
 }
 
+// PathUpdateGoalFromDir creates a new UpdateGoal to update the snaps whose
+// files, with a .snap extension, are found in the given directory. Component
+// files, with a .comp extension, are updated alongside the snap they belong
+// to, which must also be in the directory. The snaps and components are read
+// from their files and are treated as unasserted.
+func PathUpdateGoalFromDir(dir string) (UpdateGoal, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read snaps from directory: %w", err)
+	}
+
+	var snaps []PathSnap
+	var comps []PathComponent
+	indexes := make(map[string]int)
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+
+		path := filepath.Join(dir, e.Name())
+		switch filepath.Ext(e.Name()) {
+		case ".snap":
+			info, _, err := backend.OpenSnapFile(path, nil)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read snap file %q: %v", path, err)
+			}
+
+			name := info.SnapName()
+			if _, ok := indexes[name]; ok {
+				return nil, fmt.Errorf("cannot update snap %q from directory %q: found more than one snap file for it", name, dir)
+			}
+
+			indexes[name] = len(snaps)
+			snaps = append(snaps, PathSnap{
+				Path:         path,
+				InstanceName: name,
+				SideInfo:     &snap.SideInfo{RealName: name},
+			})
+		case ".comp":
+			info, _, err := backend.OpenComponentFile(path, nil, nil)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read component file %q: %v", path, err)
+			}
+
+			comps = append(comps, PathComponent{
+				Path:     path,
+				SideInfo: snap.NewComponentSideInfo(info.Component, snap.Revision{}),
+			})
+		}
+	}
+
+	for _, comp := range comps {
+		cref := comp.SideInfo.Component
+		i, ok := indexes[cref.SnapName]
+		if !ok {
+			return nil, fmt.Errorf("cannot update component %q from directory %q: snap %q is missing", cref, dir, cref.SnapName)
+		}
+		snaps[i].Components = append(snaps[i].Components, comp)
+	}
+
+	return PathUpdateGoal(snaps...), nil
+}
+
 func (p *pathUpdateGoal) toUpdate(_ context.Context, st *state.State, opts Options) (updatePlan, error) {
 	targets := make([]target, 0, len(p.updates))
 	names := make([]string, 0, len(p.updates))
@@ -1381,7 +2994,7 @@ func (p *pathUpdateGoal) toUpdate(_ context.Context, st *state.State, opts Optio
 			return updatePlan{}, err
 		}
 
-		t, err := targetForPathSnap(sn, snapst, opts)
+		t, err := targetForPathSnap(st, sn, snapst, "refresh", opts)
 		if err != nil {
 			return updatePlan{}, err
 		}
@@ -1396,7 +3009,20 @@ func (p *pathUpdateGoal) toUpdate(_ context.Context, st *state.State, opts Optio
 	}, nil
 }
 
-func targetForPathSnap(update PathSnap, snapst SnapState, opts Options) (target, error) {
+// hasSnapID returns whether the current revision of the given snap, if it is
+// installed, is known to the store.
+func hasSnapID(snapst SnapState) bool {
+	if !snapst.IsInstalled() {
+		return false
+	}
+	return snapst.CurrentSideInfo().SnapID != ""
+}
+
+// targetForPathSnap returns the target for installing the given snap from disk.
+// Asserted snaps are checked against the given validation sets, or the
+// enforced ones if none are given, unless validation is explicitly ignored.
+// Unasserted snaps are not known to the validation sets and are not checked.
+func targetForPathSnap(st *state.State, update PathSnap, snapst SnapState, action string, opts Options) (target, error) {
 	si := update.SideInfo
 
 	if si.RealName == "" {
@@ -1435,7 +3061,13 @@ func targetForPathSnap(update PathSnap, snapst SnapState, opts Options) (target,
 		trackingChannel = snapst.TrackingChannel
 	}
 
-	if update.RevOpts.Channel == "" {
+	switch {
+	case si.SnapID == "" && !hasSnapID(snapst):
+		// a truly unasserted snap, that doesn't replace an asserted one,
+		// cannot be refreshed from the store, so there is no point in
+		// tracking the channel that was asked for
+		update.RevOpts.Channel = ""
+	case update.RevOpts.Channel == "":
 		update.RevOpts.Channel = update.SideInfo.Channel
 	}
 
@@ -1448,6 +3080,16 @@ func targetForPathSnap(update PathSnap, snapst SnapState, opts Options) (target,
 		return target{}, err
 	}
 
+	if si.SnapID != "" {
+		if err := update.RevOpts.initializeValidationSets(cachedEnforcedValidationSets(st), opts); err != nil {
+			return target{}, err
+		}
+
+		if err := checkSnapAgainstValidationSets(info, comps, action, update.RevOpts.ValidationSets); err != nil {
+			return target{}, err
+		}
+	}
+
 	return target{
 		setup: SnapSetup{
 			SnapPath:  update.Path,
@@ -1459,3 +3101,213 @@ func targetForPathSnap(update PathSnap, snapst SnapState, opts Options) (target,
 		components: comps,
 	}, nil
 }
+
+// ReplaceGoal represents the replacement of an installed snap with another
+// snap.
+type ReplaceGoal interface {
+	// toReplace returns the data needed to replace the installed snap.
+	toReplace(context.Context, *state.State, Options) (*replacement, error)
+}
+
+// replacement holds the data needed to replace an installed snap.
+type replacement struct {
+	from string
+	to   string
+	// install is the target to install the replacing snap from, nil if
+	// the replacing snap is already installed.
+	install *target
+}
+
+// transitionGoal implements the ReplaceGoal interface and represents the
+// transition from a core snap to another one, e.g. from ubuntu-core to core.
+type transitionGoal struct {
+	from string
+	to   string
+}
+
+// TransitionGoal creates a new ReplaceGoal to transition from the installed
+// core snap "from" to the core snap "to". The interface connections of the
+// old snap are transitioned over to the new one before the old one is
+// removed. The new snap is installed from the store, tracking the channel of
+// the old snap, if it is not installed already.
+func TransitionGoal(from, to string) ReplaceGoal {
+	return &transitionGoal{
+		from: from,
+		to:   to,
+	}
+}
+
+func (g *transitionGoal) toReplace(ctx context.Context, st *state.State, opts Options) (*replacement, error) {
+	if g.from == g.to {
+		return nil, fmt.Errorf("cannot transition snap %q to itself", g.from)
+	}
+
+	var fromSnapst SnapState
+	if err := Get(st, g.from, &fromSnapst); err != nil && !errors.Is(err, state.ErrNoState) {
+		return nil, err
+	}
+	if !fromSnapst.IsInstalled() {
+		return nil, fmt.Errorf("cannot transition snap %q: not installed", g.from)
+	}
+	fromType, err := fromSnapst.Type()
+	if err != nil {
+		return nil, err
+	}
+	// only the connections of core snaps can be transitioned over
+	if fromType != snap.TypeOS {
+		return nil, fmt.Errorf("cannot transition snap %q: only core snaps can be transitioned, not snaps of type %q", g.from, fromType)
+	}
+
+	repl := &replacement{
+		from: g.from,
+		to:   g.to,
+	}
+
+	var toSnapst SnapState
+	if err := Get(st, g.to, &toSnapst); err != nil && !errors.Is(err, state.ErrNoState) {
+		return nil, err
+	}
+
+	var toType snap.Type
+	if toSnapst.IsInstalled() {
+		toType, err = toSnapst.Type()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		goal := StoreInstallGoal(StoreSnap{
+			InstanceName: g.to,
+			RevOpts: RevisionOptions{
+				Channel: fromSnapst.TrackingChannel,
+			},
+		})
+		targets, err := goal.toInstall(ctx, st, opts)
+		if err != nil {
+			return nil, err
+		}
+		if len(targets) != 1 {
+			return nil, fmt.Errorf("internal error: expected one snap to transition to, got %d", len(targets))
+		}
+		repl.install = &targets[0]
+		toType = repl.install.info.Type()
+	}
+
+	if toType != fromType {
+		return nil, fmt.Errorf("cannot transition snap %q to %q: snap types differ (%s and %s)", g.from, g.to, fromType, toType)
+	}
+
+	return repl, nil
+}
+
+// ReplacePreview summarizes what replacing a snap with another one would do.
+type ReplacePreview struct {
+	// From is the name of the snap that would be removed.
+	From string
+	// To is the name of the replacing snap.
+	To string
+	// Install is the information about the replacing snap that would be
+	// installed, nil if the replacing snap is already installed.
+	Install *snap.Info
+}
+
+// PreviewReplaceWithGoal validates the replacement of a snap specified by
+// the given ReplaceGoal and returns what it would do, without creating any
+// task.
+func PreviewReplaceWithGoal(ctx context.Context, st *state.State, goal ReplaceGoal, opts Options) (*ReplacePreview, error) {
+	if err := setDefaultSnapstateOptions(st, &opts); err != nil {
+		return nil, err
+	}
+
+	repl, err := goal.toReplace(ctx, st, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &ReplacePreview{
+		From: repl.from,
+		To:   repl.to,
+	}
+	if repl.install != nil {
+		preview.Install = repl.install.info
+	}
+	return preview, nil
+}
+
+// ReplaceWithGoal replaces an installed snap with another one as specified
+// by the given ReplaceGoal. The returned task sets install the replacing
+// snap if needed, carry over what is applicable from the replaced snap and
+// then remove the replaced snap. They are all part of the same lane, so that
+// they are undone together.
+func ReplaceWithGoal(ctx context.Context, st *state.State, goal ReplaceGoal, opts Options) ([]*state.TaskSet, error) {
+	if err := opts.setDefaultLane(st); err != nil {
+		return nil, err
+	}
+
+	if err := setDefaultSnapstateOptions(st, &opts); err != nil {
+		return nil, err
+	}
+
+	repl, err := goal.toReplace(ctx, st, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := replaceTasks(st, repl, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	lane := opts.Flags.Lane
+	if lane == 0 {
+		lane = st.NewLane()
+	}
+	for _, ts := range all {
+		ts.JoinLane(lane)
+	}
+
+	return all, nil
+}
+
+// replaceTasks creates the task sets that install the replacing snap if
+// needed, transition the interface connections of the replaced snap over to
+// it and then remove the replaced snap.
+func replaceTasks(st *state.State, repl *replacement, opts Options) ([]*state.TaskSet, error) {
+	var all []*state.TaskSet
+	if t := repl.install; t != nil {
+		opts.PrereqTracker.Add(t.info)
+
+		snapsup, compsups, err := t.setups(st, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		tsInst, err := doInstall(st, &t.snapst, snapsup, compsups, 0, opts.FromChange, inUseFor(opts.DeviceCtx), opts.DeviceCtx)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, tsInst)
+	}
+
+	transIf := st.NewTask("transition-ubuntu-core", fmt.Sprintf(i18n.G("Transition security profiles from %q to %q"), repl.from, repl.to))
+	transIf.Set("old-name", repl.from)
+	transIf.Set("new-name", repl.to)
+	transIf.Set("snap-setup", &SnapSetup{
+		SideInfo: &snap.SideInfo{
+			RealName: repl.from,
+		},
+	})
+	if len(all) > 0 {
+		transIf.WaitAll(all[0])
+	}
+	tsTrans := state.NewTaskSet(transIf)
+	all = append(all, tsTrans)
+
+	tsRm, err := Remove(st, repl.from, snap.R(0), nil)
+	if err != nil {
+		return nil, err
+	}
+	tsRm.WaitFor(transIf)
+	all = append(all, tsRm)
+
+	return all, nil
+}
@@ -2,18 +2,36 @@ package snapstate_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
-
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/asserts/snapasserts"
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/interfaces/ifacetest"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/ifacestate/ifacerepo"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/snapstate/backend"
 	"github.com/snapcore/snapd/overlord/snapstate/sequence"
 	"github.com/snapcore/snapd/overlord/snapstate/snapstatetest"
+	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snap/naming"
 	"github.com/snapcore/snapd/snap/snaptest"
 	"github.com/snapcore/snapd/store"
+	"github.com/snapcore/snapd/testutil"
+	"github.com/snapcore/snapd/timeutil"
 	. "gopkg.in/check.v1"
 )
 
@@ -74,6 +92,97 @@ func (s *targetTestSuite) TestInstallWithComponents(c *C) {
 	c.Check(compsups[0].CompSideInfo.Component.ComponentName, Equals, compName)
 }
 
+func (s *targetTestSuite) TestInstallWithOptionalComponents(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	const (
+		snapName = "some-snap"
+		compName = "standard-component"
+		channel  = "channel-for-components"
+	)
+	s.fakeStore.snapResourcesFn = func(info *snap.Info) []store.SnapResourceResult {
+		c.Assert(info.SnapName(), DeepEquals, snapName)
+
+		return []store.SnapResourceResult{
+			{
+				DownloadInfo: snap.DownloadInfo{
+					DownloadURL: fmt.Sprintf("http://example.com/%s", snapName),
+				},
+				Name:      compName,
+				Revision:  1,
+				Type:      fmt.Sprintf("component/%s", snap.StandardComponent),
+				Version:   "1.0",
+				CreatedAt: "2024-01-01T00:00:00Z",
+			},
+		}
+	}
+
+	// the optional component that the store does not have is skipped, the
+	// one that is also required is installed once
+	goal := snapstate.StoreInstallGoal(snapstate.StoreSnap{
+		InstanceName:       snapName,
+		Components:         []string{compName},
+		OptionalComponents: []string{"kernel-modules-component", compName},
+		RevOpts: snapstate.RevisionOptions{
+			Channel: channel,
+		},
+	})
+
+	_, ts, err := snapstate.InstallOne(context.Background(), s.state, goal, snapstate.Options{})
+	c.Assert(err, IsNil)
+
+	verifyInstallTasksWithComponents(c, snap.TypeApp, 0, 0, []string{compName}, ts)
+
+	compsups, err := snapstate.TaskComponentSetups(ts.Tasks()[1])
+	c.Assert(err, IsNil)
+	c.Assert(compsups, HasLen, 1)
+	c.Check(compsups[0].CompSideInfo.Component.ComponentName, Equals, compName)
+}
+
+func (s *targetTestSuite) TestInstallWithOnlyOptionalComponents(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	const (
+		snapName = "some-snap"
+		compName = "standard-component"
+		channel  = "channel-for-components"
+	)
+	s.fakeStore.snapResourcesFn = func(info *snap.Info) []store.SnapResourceResult {
+		return []store.SnapResourceResult{
+			{
+				DownloadInfo: snap.DownloadInfo{
+					DownloadURL: fmt.Sprintf("http://example.com/%s", snapName),
+				},
+				Name:      compName,
+				Revision:  1,
+				Type:      fmt.Sprintf("component/%s", snap.StandardComponent),
+				Version:   "1.0",
+				CreatedAt: "2024-01-01T00:00:00Z",
+			},
+		}
+	}
+
+	goal := snapstate.StoreInstallGoal(snapstate.StoreSnap{
+		InstanceName:       snapName,
+		OptionalComponents: []string{compName, "kernel-modules-component"},
+		RevOpts: snapstate.RevisionOptions{
+			Channel: channel,
+		},
+	})
+
+	_, ts, err := snapstate.InstallOne(context.Background(), s.state, goal, snapstate.Options{})
+	c.Assert(err, IsNil)
+
+	verifyInstallTasksWithComponents(c, snap.TypeApp, 0, 0, []string{compName}, ts)
+
+	compsups, err := snapstate.TaskComponentSetups(ts.Tasks()[1])
+	c.Assert(err, IsNil)
+	c.Assert(compsups, HasLen, 1)
+	c.Check(compsups[0].CompSideInfo.Component.ComponentName, Equals, compName)
+}
+
 func (s *targetTestSuite) TestInstallWithComponentsMissingResource(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
@@ -285,6 +394,52 @@ version: 1.0
 	verifyInstallTasksWithComponents(c, snap.TypeKernel, localSnap|updatesGadgetAssets, 0, []string{compName}, ts)
 }
 
+func (s *targetTestSuite) TestInstallWithComponentsFromPathMismatch(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	const (
+		snapName = "some-snap"
+		snapYaml = `name: some-snap
+version: 1.0
+components:
+  standard-component:
+    type: standard
+  other-component:
+    type: standard
+`
+		componentYaml = `component: some-snap+other-component
+type: standard
+version: 1.0
+`
+	)
+
+	si := &snap.SideInfo{
+		RealName: snapName,
+		SnapID:   "some-snap-id",
+		Revision: snap.R(2),
+	}
+	snapPath := makeTestSnap(c, snapYaml)
+	compPath := snaptest.MakeTestComponent(c, componentYaml)
+
+	csi := snap.ComponentSideInfo{
+		Component: naming.NewComponentRef(snapName, "standard-component"),
+		Revision:  snap.R(3),
+	}
+
+	goal := snapstate.PathInstallGoal(snapstate.PathSnap{
+		Path:     snapPath,
+		SideInfo: si,
+		Components: []snapstate.PathComponent{{
+			SideInfo: &csi,
+			Path:     compPath,
+		}},
+	})
+
+	_, _, err := snapstate.InstallOne(context.Background(), s.state, goal, snapstate.Options{})
+	c.Assert(err, ErrorMatches, fmt.Sprintf(`cannot install component file "%s": some-snap\+other-component != some-snap\+standard-component \(component mismatch\)`, regexp.QuoteMeta(compPath)))
+}
+
 func (s *targetTestSuite) TestInstallWithComponentsMixedAssertedCompsAndUnassertedSnap(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
@@ -663,6 +818,64 @@ components:
 	c.Assert(err, ErrorMatches, `cannot install local snap "some-snap": edge != stable \(channel mismatch\)`)
 }
 
+func (s *targetTestSuite) TestInstallFromPathRevOptsChannelTracked(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapPath := makeTestSnap(c, `name: some-snap
+version: 1.0
+`)
+	si := &snap.SideInfo{
+		RealName: "some-snap",
+		SnapID:   "some-snap-id",
+		Revision: snap.R(1),
+	}
+
+	goal := snapstate.PathInstallGoal(snapstate.PathSnap{
+		Path:     snapPath,
+		SideInfo: si,
+		RevOpts:  snapstate.RevisionOptions{Channel: "edge"},
+	})
+
+	_, ts, err := snapstate.InstallOne(context.Background(), s.state, goal, snapstate.Options{})
+	c.Assert(err, IsNil)
+
+	chg := s.state.NewChange("install", "install a snap")
+	chg.AddAll(ts)
+
+	s.settle(c)
+
+	c.Assert(chg.Err(), IsNil)
+
+	// the sideloaded asserted snap tracks the requested channel
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.state, "some-snap", &snapst), IsNil)
+	c.Check(snapst.TrackingChannel, Equals, "latest/edge")
+}
+
+func (s *targetTestSuite) TestInstallFromPathRevOptsChannelUnasserted(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapPath := makeTestSnap(c, `name: some-snap
+version: 1.0
+`)
+
+	goal := snapstate.PathInstallGoal(snapstate.PathSnap{
+		Path:     snapPath,
+		SideInfo: &snap.SideInfo{RealName: "some-snap"},
+		RevOpts:  snapstate.RevisionOptions{Channel: "edge"},
+	})
+
+	_, ts, err := snapstate.InstallOne(context.Background(), s.state, goal, snapstate.Options{})
+	c.Assert(err, IsNil)
+
+	// an unasserted snap cannot track a channel
+	snapsup, err := snapstate.TaskSnapSetup(ts.Tasks()[0])
+	c.Assert(err, IsNil)
+	c.Check(snapsup.Channel, Equals, "")
+}
+
 func (s *targetTestSuite) TestInstallFromStoreRevisionAndChannel(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
@@ -687,6 +900,57 @@ func (s *targetTestSuite) TestInstallFromStoreRevisionAndChannel(c *C) {
 	c.Check(snapsup.Revision(), Equals, snap.R(7))
 }
 
+func (s *targetTestSuite) TestInstallFromStoreMinRevision(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	// the store resolves revision 11 for the stable channel
+	goal := snapstate.StoreInstallGoal(snapstate.StoreSnap{
+		InstanceName: "some-snap",
+		RevOpts: snapstate.RevisionOptions{
+			MinRevision: snap.R(11),
+		},
+	})
+
+	info, _, err := snapstate.InstallOne(context.Background(), s.state, goal, snapstate.Options{})
+	c.Assert(err, IsNil)
+	c.Check(info.Revision, Equals, snap.R(11))
+
+	goal = snapstate.StoreInstallGoal(snapstate.StoreSnap{
+		InstanceName: "some-snap",
+		RevOpts: snapstate.RevisionOptions{
+			MinRevision: snap.R(12),
+		},
+	})
+
+	_, _, err = snapstate.InstallOne(context.Background(), s.state, goal, snapstate.Options{})
+	c.Check(err, ErrorMatches, `cannot install snap "some-snap": store offers revision 11, older than the minimum revision 12`)
+}
+
+func (s *targetTestSuite) TestInstallFromStoreMinRevisionInvalid(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	for _, tc := range []struct {
+		revOpts snapstate.RevisionOptions
+		err     string
+	}{{
+		revOpts: snapstate.RevisionOptions{Revision: snap.R(7), MinRevision: snap.R(5)},
+		err:     `invalid revision options for snap "some-snap": cannot specify revision and minimum revision`,
+	}, {
+		revOpts: snapstate.RevisionOptions{MinRevision: snap.R(-1)},
+		err:     `invalid revision options for snap "some-snap": cannot use local revision x1 as minimum revision`,
+	}} {
+		goal := snapstate.StoreInstallGoal(snapstate.StoreSnap{
+			InstanceName: "some-snap",
+			RevOpts:      tc.revOpts,
+		})
+
+		_, _, err := snapstate.InstallOne(context.Background(), s.state, goal, snapstate.Options{})
+		c.Check(err, ErrorMatches, tc.err)
+	}
+}
+
 func (s *targetTestSuite) TestInstallFromStoreRevisionAndChannelWithRedirectChannel(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
@@ -860,7 +1124,7 @@ func (s *targetTestSuite) TestUpdateComponentsSameComponentRevision(c *C) {
 	c.Assert(storeAccessed, Equals, true)
 }
 
-func (s *targetTestSuite) TestUpdateComponentsFromPath(c *C) {
+func (s *targetTestSuite) TestUpdateComponentsPreserveComponentRevisions(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
 
@@ -869,35 +1133,40 @@ func (s *targetTestSuite) TestUpdateComponentsFromPath(c *C) {
 		snapID   = "some-snap-id"
 		compName = "standard-component"
 		channel  = "channel-for-components"
-		snapYaml = `name: some-snap
-type: kernel
-version: 1.0
-components:
-  standard-component:
-    type: standard
-  kernel-modules-component:
-    type: kernel-modules
-epoch: 1
-`
-		componentYaml = `component: some-snap+standard-component
-type: standard
-version: 1.0
-`
 	)
 
+	// revision 11, which the store refreshes to, was previously installed
+	// with the current revision of the component
 	seq := snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{{
+		RealName: snapName,
+		SnapID:   snapID,
+		Revision: snap.R(11),
+	}, {
 		RealName: snapName,
 		SnapID:   snapID,
 		Revision: snap.R(7),
 	}})
 
-	seq.AddComponentForRevision(snap.R(7), &sequence.ComponentState{
-		SideInfo: &snap.ComponentSideInfo{
-			Component: naming.NewComponentRef(snapName, compName),
-			Revision:  snap.R(1),
-		},
-		CompType: snap.StandardComponent,
-	})
+	for _, rev := range []snap.Revision{snap.R(11), snap.R(7)} {
+		seq.AddComponentForRevision(rev, &sequence.ComponentState{
+			SideInfo: &snap.ComponentSideInfo{
+				Component: naming.NewComponentRef(snapName, compName),
+				Revision:  snap.R(1),
+			},
+			CompType: snap.StandardComponent,
+		})
+	}
+
+	s.AddCleanup(snapstate.MockReadComponentInfo(func(
+		compMntDir string, info *snap.Info, csi *snap.ComponentSideInfo,
+	) (*snap.ComponentInfo, error) {
+		return &snap.ComponentInfo{
+			Component:         naming.NewComponentRef(info.SnapName(), compName),
+			Type:              snap.StandardComponent,
+			CompVersion:       "1.0",
+			ComponentSideInfo: *csi,
+		}, nil
+	}))
 
 	snapstate.Set(s.state, snapName, &snapstate.SnapState{
 		Active:          true,
@@ -907,26 +1176,189 @@ version: 1.0
 		SnapType:        "app",
 	})
 
-	si := &snap.SideInfo{
-		RealName: snapName,
-		SnapID:   snapID,
-		Revision: snap.R(9),
-	}
-	snapPath := makeTestSnap(c, snapYaml)
+	// the store has a newer revision of the component available
+	s.fakeStore.snapResourcesFn = func(info *snap.Info) []store.SnapResourceResult {
+		c.Assert(info.SnapName(), DeepEquals, snapName)
 
-	csi := snap.ComponentSideInfo{
-		Component: naming.NewComponentRef(snapName, compName),
-		Revision:  snap.R(2),
+		return []store.SnapResourceResult{
+			{
+				DownloadInfo: snap.DownloadInfo{
+					DownloadURL: fmt.Sprintf("http://example.com/%s", snapName),
+				},
+				Name:      compName,
+				Revision:  2,
+				Type:      fmt.Sprintf("component/%s", snap.StandardComponent),
+				Version:   "1.0",
+				CreatedAt: "2024-01-01T00:00:00Z",
+			},
+		}
 	}
 
-	components := []snapstate.PathComponent{{
-		SideInfo: &csi,
-		Path:     snaptest.MakeTestComponent(c, componentYaml),
-	}}
+	goal := snapstate.StoreUpdateGoal(snapstate.StoreUpdate{
+		InstanceName:               snapName,
+		PreserveComponentRevisions: true,
+	})
 
-	goal := snapstate.PathUpdateGoal(snapstate.PathSnap{
-		InstanceName: snapName,
-		Path:         snapPath,
+	ts, err := snapstate.UpdateOne(context.Background(), s.state, goal, nil, snapstate.Options{})
+	c.Assert(err, IsNil)
+
+	// the component is kept at the revision that is already installed, so
+	// nothing needs to be downloaded
+	verifyUpdateTasksWithComponents(c, snap.TypeApp, localRevision|doesReRefresh, compOptRevisionPresent, 0, []string{compName}, ts)
+
+	var compsup snapstate.ComponentSetup
+	for _, t := range ts.Tasks() {
+		if t.Kind() != "prepare-component" {
+			continue
+		}
+		c.Assert(t.Get("component-setup", &compsup), IsNil)
+	}
+	c.Check(compsup.CompSideInfo, DeepEquals, &snap.ComponentSideInfo{
+		Component: naming.NewComponentRef(snapName, compName),
+		Revision:  snap.R(1),
+	})
+	c.Check(compsup.DownloadInfo, IsNil)
+}
+
+func (s *targetTestSuite) TestUpdateComponentsPreserveComponentRevisionsIncompatible(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	const (
+		snapName = "some-snap"
+		snapID   = "some-snap-id"
+		compName = "standard-component"
+		channel  = "channel-for-components"
+	)
+
+	seq := snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{{
+		RealName: snapName,
+		SnapID:   snapID,
+		Revision: snap.R(7),
+	}})
+
+	seq.AddComponentForRevision(snap.R(7), &sequence.ComponentState{
+		SideInfo: &snap.ComponentSideInfo{
+			Component: naming.NewComponentRef(snapName, compName),
+			Revision:  snap.R(1),
+		},
+		CompType: snap.StandardComponent,
+	})
+
+	s.AddCleanup(snapstate.MockReadComponentInfo(func(
+		compMntDir string, info *snap.Info, csi *snap.ComponentSideInfo,
+	) (*snap.ComponentInfo, error) {
+		return &snap.ComponentInfo{
+			Component:         naming.NewComponentRef(info.SnapName(), compName),
+			Type:              snap.StandardComponent,
+			CompVersion:       "1.0",
+			ComponentSideInfo: *csi,
+		}, nil
+	}))
+
+	snapstate.Set(s.state, snapName, &snapstate.SnapState{
+		Active:          true,
+		TrackingChannel: channel,
+		Sequence:        seq,
+		Current:         snap.R(7),
+		SnapType:        "app",
+	})
+
+	// revision 11 of the snap goes with revision 2 of the component, which
+	// was never installed alongside it
+	s.fakeStore.snapResourcesFn = func(info *snap.Info) []store.SnapResourceResult {
+		c.Assert(info.SnapName(), DeepEquals, snapName)
+
+		return []store.SnapResourceResult{
+			{
+				DownloadInfo: snap.DownloadInfo{
+					DownloadURL: fmt.Sprintf("http://example.com/%s", snapName),
+				},
+				Name:      compName,
+				Revision:  2,
+				Type:      fmt.Sprintf("component/%s", snap.StandardComponent),
+				Version:   "1.0",
+				CreatedAt: "2024-01-01T00:00:00Z",
+			},
+		}
+	}
+
+	goal := snapstate.StoreUpdateGoal(snapstate.StoreUpdate{
+		InstanceName:               snapName,
+		PreserveComponentRevisions: true,
+	})
+
+	_, err := snapstate.UpdateOne(context.Background(), s.state, goal, nil, snapstate.Options{})
+	c.Assert(err, ErrorMatches, `cannot preserve revision 1 of component "some-snap\+standard-component": revision 11 of snap "some-snap" requires component revision 2`)
+}
+
+func (s *targetTestSuite) TestUpdateComponentsFromPath(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	const (
+		snapName = "some-snap"
+		snapID   = "some-snap-id"
+		compName = "standard-component"
+		channel  = "channel-for-components"
+		snapYaml = `name: some-snap
+type: kernel
+version: 1.0
+components:
+  standard-component:
+    type: standard
+  kernel-modules-component:
+    type: kernel-modules
+epoch: 1
+`
+		componentYaml = `component: some-snap+standard-component
+type: standard
+version: 1.0
+`
+	)
+
+	seq := snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{{
+		RealName: snapName,
+		SnapID:   snapID,
+		Revision: snap.R(7),
+	}})
+
+	seq.AddComponentForRevision(snap.R(7), &sequence.ComponentState{
+		SideInfo: &snap.ComponentSideInfo{
+			Component: naming.NewComponentRef(snapName, compName),
+			Revision:  snap.R(1),
+		},
+		CompType: snap.StandardComponent,
+	})
+
+	snapstate.Set(s.state, snapName, &snapstate.SnapState{
+		Active:          true,
+		TrackingChannel: channel,
+		Sequence:        seq,
+		Current:         snap.R(7),
+		SnapType:        "app",
+	})
+
+	si := &snap.SideInfo{
+		RealName: snapName,
+		SnapID:   snapID,
+		Revision: snap.R(9),
+	}
+	snapPath := makeTestSnap(c, snapYaml)
+
+	csi := snap.ComponentSideInfo{
+		Component: naming.NewComponentRef(snapName, compName),
+		Revision:  snap.R(2),
+	}
+
+	components := []snapstate.PathComponent{{
+		SideInfo: &csi,
+		Path:     snaptest.MakeTestComponent(c, componentYaml),
+	}}
+
+	goal := snapstate.PathUpdateGoal(snapstate.PathSnap{
+		InstanceName: snapName,
+		Path:         snapPath,
 		SideInfo:     si,
 		Components:   components,
 	})
@@ -937,6 +1369,94 @@ version: 1.0
 	verifyUpdateTasksWithComponents(c, snap.TypeApp, doesReRefresh|localSnap|updatesGadgetAssets, 0, 0, []string{compName}, ts)
 }
 
+func (s *targetTestSuite) TestPathUpdateGoalFromDir(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	const (
+		snapName = "some-snap"
+		compName = "standard-component"
+		snapYaml = `name: some-snap
+version: 1.0
+components:
+  standard-component:
+    type: standard
+epoch: 1*
+`
+		componentYaml = `component: some-snap+standard-component
+type: standard
+version: 1.0
+`
+	)
+
+	snapstate.Set(s.state, snapName, &snapstate.SnapState{
+		Active: true,
+		Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{{
+			RealName: snapName,
+			Revision: snap.R(-1),
+		}}),
+		Current:  snap.R(-1),
+		SnapType: "app",
+	})
+
+	dir := c.MkDir()
+	snapPath := filepath.Join(dir, "some-snap_1.snap")
+	compPath := filepath.Join(dir, "some-snap+standard-component_1.comp")
+	c.Assert(os.Rename(makeTestSnap(c, snapYaml), snapPath), IsNil)
+	c.Assert(os.Rename(snaptest.MakeTestComponent(c, componentYaml), compPath), IsNil)
+	// other files are ignored
+	c.Assert(os.WriteFile(filepath.Join(dir, "README"), nil, 0644), IsNil)
+	c.Assert(os.Mkdir(filepath.Join(dir, "other.snap"), 0755), IsNil)
+
+	goal, err := snapstate.PathUpdateGoalFromDir(dir)
+	c.Assert(err, IsNil)
+
+	ts, err := snapstate.UpdateOne(context.Background(), s.state, goal, nil, snapstate.Options{})
+	c.Assert(err, IsNil)
+
+	snapsup, err := snapstate.TaskSnapSetup(ts.Tasks()[0])
+	c.Assert(err, IsNil)
+	c.Check(snapsup.SnapPath, Equals, snapPath)
+	c.Check(snapsup.SideInfo.RealName, Equals, snapName)
+	c.Check(snapsup.SideInfo.SnapID, Equals, "")
+
+	var compsup snapstate.ComponentSetup
+	for _, t := range ts.Tasks() {
+		if t.Kind() != "prepare-component" {
+			continue
+		}
+		c.Assert(t.Get("component-setup", &compsup), IsNil)
+	}
+	c.Check(compsup.CompPath, Equals, compPath)
+	c.Check(compsup.CompSideInfo.Component, Equals, naming.NewComponentRef(snapName, compName))
+}
+
+func (s *targetTestSuite) TestPathUpdateGoalFromDirErrors(c *C) {
+	const componentYaml = `component: some-snap+standard-component
+type: standard
+version: 1.0
+`
+
+	_, err := snapstate.PathUpdateGoalFromDir(filepath.Join(c.MkDir(), "missing"))
+	c.Check(err, ErrorMatches, `cannot read snaps from directory: open .*/missing: no such file or directory`)
+
+	dir := c.MkDir()
+	c.Assert(os.Rename(snaptest.MakeTestComponent(c, componentYaml), filepath.Join(dir, "some-snap+standard-component.comp")), IsNil)
+	_, err = snapstate.PathUpdateGoalFromDir(dir)
+	c.Check(err, ErrorMatches, `cannot update component "some-snap\+standard-component" from directory ".*": snap "some-snap" is missing`)
+
+	dir = c.MkDir()
+	c.Assert(os.Rename(makeTestSnap(c, "name: some-snap\nversion: 1.0"), filepath.Join(dir, "some-snap_1.snap")), IsNil)
+	c.Assert(os.Rename(makeTestSnap(c, "name: some-snap\nversion: 2.0"), filepath.Join(dir, "some-snap_2.snap")), IsNil)
+	_, err = snapstate.PathUpdateGoalFromDir(dir)
+	c.Check(err, ErrorMatches, `cannot update snap "some-snap" from directory ".*": found more than one snap file for it`)
+
+	dir = c.MkDir()
+	c.Assert(os.WriteFile(filepath.Join(dir, "broken.snap"), []byte("not a snap"), 0644), IsNil)
+	_, err = snapstate.PathUpdateGoalFromDir(dir)
+	c.Check(err, ErrorMatches, `cannot read snap file ".*/broken.snap": .*`)
+}
+
 func (s *targetTestSuite) TestUpdateComponentsFromPathInvalidComponentFile(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
@@ -1158,3 +1678,2399 @@ version: 1.0
 	_, err := snapstate.UpdateOne(context.Background(), s.state, goal, nil, snapstate.Options{})
 	c.Assert(err, ErrorMatches, fmt.Sprintf(`.*"%s" is not a component for snap "%s"`, compName, snapName))
 }
+
+func (s *targetTestSuite) enableURLInstall(c *C) {
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("core", "experimental.url-install", true), IsNil)
+	tr.Commit()
+}
+
+func (s *targetTestSuite) TestInstallFromURL(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapPath := makeTestSnap(c, `name: some-snap
+version: 1.0
+`)
+	blob, err := os.ReadFile(snapPath)
+	c.Assert(err, IsNil)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, Equals, "/some-snap.snap")
+		w.Write(blob)
+	}))
+	defer server.Close()
+
+	s.enableURLInstall(c)
+
+	goal := snapstate.URLInstallGoal(server.URL+"/some-snap.snap", nil)
+	info, ts, err := snapstate.InstallOne(context.Background(), s.state, goal, snapstate.Options{})
+	c.Assert(err, IsNil)
+
+	c.Check(info.InstanceName(), Equals, "some-snap")
+	c.Check(info.Revision.Unset(), Equals, true)
+
+	snapsup, err := snapstate.TaskSnapSetup(ts.Tasks()[0])
+	c.Assert(err, IsNil)
+	c.Check(filepath.Dir(snapsup.SnapPath), Equals, dirs.SnapBlobDir)
+	c.Check(snapsup.Flags.RemoveSnapPath, Equals, true)
+
+	downloaded, err := os.ReadFile(snapsup.SnapPath)
+	c.Assert(err, IsNil)
+	c.Check(downloaded, DeepEquals, blob)
+}
+
+func (s *targetTestSuite) TestInstallFromURLWithSideInfo(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapPath := makeTestSnap(c, `name: some-snap
+version: 1.0
+`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, snapPath)
+	}))
+	defer server.Close()
+
+	s.enableURLInstall(c)
+
+	si := &snap.SideInfo{
+		RealName: "some-snap",
+	}
+	goal := snapstate.URLInstallGoal(server.URL+"/some-snap.snap", si)
+	info, ts, err := snapstate.InstallOne(context.Background(), s.state, goal, snapstate.Options{})
+	c.Assert(err, IsNil)
+
+	c.Check(info.InstanceName(), Equals, "some-snap")
+	c.Check(info.Revision.Unset(), Equals, true)
+
+	snapsup, err := snapstate.TaskSnapSetup(ts.Tasks()[0])
+	c.Assert(err, IsNil)
+	c.Check(snapsup.SideInfo.SnapID, Equals, "")
+	c.Check(snapsup.Flags.RemoveSnapPath, Equals, true)
+}
+
+func (s *targetTestSuite) TestInstallFromURLAssertedSideInfo(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected download")
+	}))
+	defer server.Close()
+
+	s.enableURLInstall(c)
+
+	for _, si := range []*snap.SideInfo{
+		{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(7)},
+		{RealName: "some-snap", Revision: snap.R(7)},
+	} {
+		goal := snapstate.URLInstallGoal(server.URL+"/some-snap.snap", si)
+		_, _, err := snapstate.InstallOne(context.Background(), s.state, goal, snapstate.Options{})
+		c.Check(err, ErrorMatches, `cannot install snap from ".*/some-snap.snap": snaps downloaded from a URL are installed unasserted, snap-id and revision cannot be set`)
+	}
+}
+
+func (s *targetTestSuite) TestInstallFromURLTooLarge(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapPath := makeTestSnap(c, `name: some-snap
+version: 1.0
+`)
+	blob, err := os.ReadFile(snapPath)
+	c.Assert(err, IsNil)
+	defer snapstate.MockURLInstallMaxSize(int64(len(blob) - 1))()
+
+	s.enableURLInstall(c)
+
+	for _, chunked := range []bool{false, true} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if chunked {
+				// no content length is sent
+				w.(http.Flusher).Flush()
+			}
+			w.Write(blob)
+		}))
+
+		goal := snapstate.URLInstallGoal(server.URL+"/some-snap.snap", nil)
+		_, _, err := snapstate.InstallOne(context.Background(), s.state, goal, snapstate.Options{})
+		c.Check(err, ErrorMatches, `cannot download snap from ".*/some-snap.snap": size .*exceeds the limit of [0-9]+ bytes`)
+		server.Close()
+
+		matches, err := filepath.Glob(filepath.Join(dirs.SnapBlobDir, dirs.LocalInstallBlobTempPrefix+"*"))
+		c.Assert(err, IsNil)
+		c.Check(matches, HasLen, 0)
+	}
+}
+
+func (s *targetTestSuite) TestInstallFromURLCleanupOnLaterError(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapPath := makeTestSnap(c, `name: some-snap
+version: 1.0
+`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, snapPath)
+	}))
+	defer server.Close()
+
+	s.enableURLInstall(c)
+
+	// the snap is downloaded, but not turned into a change
+	goal := snapstate.URLInstallGoal(server.URL+"/some-snap.snap", nil)
+	_, _, err := snapstate.InstallOne(context.Background(), s.state, goal, snapstate.Options{
+		Flags: snapstate.Flags{RequireTypeBase: true},
+	})
+	c.Assert(err, ErrorMatches, `unexpected snap type "app", instead of 'base'`)
+
+	matches, err := filepath.Glob(filepath.Join(dirs.SnapBlobDir, dirs.LocalInstallBlobTempPrefix+"*"))
+	c.Assert(err, IsNil)
+	c.Check(matches, HasLen, 0)
+}
+
+func (s *targetTestSuite) TestInstallFromURLFeatureDisabled(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	goal := snapstate.URLInstallGoal("http://example.com/some-snap.snap", nil)
+	_, _, err := snapstate.InstallOne(context.Background(), s.state, goal, snapstate.Options{})
+	c.Assert(err, ErrorMatches, `experimental feature disabled - test it by setting 'experimental.url-install' to true`)
+}
+
+func (s *targetTestSuite) TestInstallFromURLUnsupportedScheme(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.enableURLInstall(c)
+
+	goal := snapstate.URLInstallGoal("file:///some-snap.snap", nil)
+	_, _, err := snapstate.InstallOne(context.Background(), s.state, goal, snapstate.Options{})
+	c.Assert(err, ErrorMatches, `cannot install snap from "file:///some-snap.snap": only http and https URLs are supported`)
+}
+
+func (s *targetTestSuite) TestInstallFromURLBadStatus(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	s.enableURLInstall(c)
+
+	goal := snapstate.URLInstallGoal(server.URL+"/some-snap.snap", nil)
+	_, _, err := snapstate.InstallOne(context.Background(), s.state, goal, snapstate.Options{})
+	c.Assert(err, ErrorMatches, `cannot download snap from ".*/some-snap.snap": unexpected status "404 Not Found"`)
+
+	// the partially downloaded file is cleaned up
+	matches, err := filepath.Glob(filepath.Join(dirs.SnapBlobDir, dirs.LocalInstallBlobTempPrefix+"*"))
+	c.Assert(err, IsNil)
+	c.Check(matches, HasLen, 0)
+}
+
+func (s *targetTestSuite) TestInstallFromURLInvalidSnapFile(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not a snap"))
+	}))
+	defer server.Close()
+
+	s.enableURLInstall(c)
+
+	goal := snapstate.URLInstallGoal(server.URL+"/some-snap.snap", nil)
+	_, _, err := snapstate.InstallOne(context.Background(), s.state, goal, snapstate.Options{})
+	c.Assert(err, ErrorMatches, `cannot open snap file downloaded from ".*": .*`)
+
+	matches, err := filepath.Glob(filepath.Join(dirs.SnapBlobDir, dirs.LocalInstallBlobTempPrefix+"*"))
+	c.Assert(err, IsNil)
+	c.Check(matches, HasLen, 0)
+}
+
+func (s *targetTestSuite) TestInstallSharingPrereqTrackerAcrossCalls(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	installPath := func(yaml string, prqt snapstate.PrereqTracker) *snapstate.SnapSetup {
+		info, err := snap.InfoFromSnapYaml([]byte(yaml))
+		c.Assert(err, IsNil)
+		si := &snap.SideInfo{RealName: info.SnapName(), Revision: snap.R(1)}
+
+		goal := snapstate.PathInstallGoal(snapstate.PathSnap{
+			Path:     makeTestSnap(c, yaml),
+			SideInfo: si,
+		})
+		_, tss, err := snapstate.InstallWithGoal(context.Background(), s.state, goal, snapstate.Options{
+			PrereqTracker: prqt,
+		})
+		c.Assert(err, IsNil)
+		c.Assert(tss, HasLen, 1)
+
+		snapsup, err := snapstate.TaskSnapSetup(tss[0].Tasks()[0])
+		c.Assert(err, IsNil)
+		return snapsup
+	}
+
+	const baseYaml = `name: some-base
+version: 1.0
+type: base
+`
+	const providerYaml = `name: content-provider
+version: 1.0
+base: some-base
+slots:
+  shared:
+    interface: content
+    content: shared-content
+`
+	const consumerYaml = `name: content-consumer
+version: 1.0
+base: some-base
+plugs:
+  shared:
+    interface: content
+    content: shared-content
+    default-provider: content-provider
+`
+
+	prqt := snap.NewCumulativePrereqTracker()
+
+	installPath(baseYaml, prqt)
+	snapsup := installPath(providerYaml, prqt)
+	c.Check(snapsup.Base, Equals, "some-base")
+
+	// the provider tracked by the earlier install is not added again
+	snapsup = installPath(consumerYaml, prqt)
+	c.Check(snapsup.Base, Equals, "some-base")
+	c.Check(snapsup.Prereq, HasLen, 0)
+	c.Check(snapsup.PrereqContentAttrs, HasLen, 0)
+
+	var tracked []string
+	for _, info := range prqt.Snaps() {
+		tracked = append(tracked, info.SnapName())
+	}
+	c.Check(tracked, DeepEquals, []string{"some-base", "content-provider", "content-consumer"})
+
+	// without sharing the tracker the provider is a prerequisite
+	snapsup = installPath(strings.Replace(consumerYaml, "content-consumer", "other-consumer", 1), nil)
+	c.Check(snapsup.Prereq, DeepEquals, []string{"content-provider"})
+	c.Check(snapsup.PrereqContentAttrs, DeepEquals, map[string][]string{
+		"content-provider": {"shared-content"},
+	})
+}
+
+func (s *targetTestSuite) mockInterfaces(c *C, names ...string) {
+	repo := ifacerepo.Get(s.state)
+	for _, name := range names {
+		c.Assert(repo.AddInterface(&ifacetest.TestInterface{InterfaceName: name}), IsNil)
+	}
+}
+
+func (s *targetTestSuite) TestInstallSuppressAutoConnect(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockInterfaces(c, "network", "home")
+
+	goal := snapstate.StoreInstallGoal(snapstate.StoreSnap{InstanceName: "some-snap"})
+	_, tss, err := snapstate.InstallWithGoal(context.Background(), s.state, goal, snapstate.Options{
+		SuppressAutoConnect: []string{"network", "home"},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(tss, HasLen, 1)
+
+	snapsup, err := snapstate.TaskSnapSetup(tss[0].Tasks()[0])
+	c.Assert(err, IsNil)
+	c.Check(snapsup.SuppressedAutoConnectInterfaces, DeepEquals, []string{"network", "home"})
+
+	// the auto-connect task is still scheduled, it skips the suppressed
+	// interfaces when creating the connect tasks
+	c.Check(taskKinds(tss[0].Tasks()), testutil.Contains, "auto-connect")
+}
+
+func (s *targetTestSuite) TestInstallSuppressAutoConnectUnknownInterface(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockInterfaces(c, "network")
+
+	goal := snapstate.StoreInstallGoal(snapstate.StoreSnap{InstanceName: "some-snap"})
+	for _, iface := range []string{"Bad_Iface", "not-an-interface"} {
+		_, _, err := snapstate.InstallWithGoal(context.Background(), s.state, goal, snapstate.Options{
+			SuppressAutoConnect: []string{"network", iface},
+		})
+		c.Check(err, ErrorMatches, fmt.Sprintf(`cannot suppress auto-connection: unknown interface %q`, iface))
+	}
+}
+
+func (s *targetTestSuite) TestInstallSuppressAutoConnectSystemSnap(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockInterfaces(c, "network")
+
+	const osYaml = `name: some-os
+version: 1.0
+type: os
+slots:
+  network:
+`
+	goal := snapstate.PathInstallGoal(snapstate.PathSnap{
+		Path:     makeTestSnap(c, osYaml),
+		SideInfo: &snap.SideInfo{RealName: "some-os", Revision: snap.R(1)},
+	})
+	_, _, err := snapstate.InstallWithGoal(context.Background(), s.state, goal, snapstate.Options{
+		SuppressAutoConnect: []string{"network"},
+	})
+	c.Assert(err, ErrorMatches, `cannot suppress auto-connections for system snap "some-os"`)
+}
+
+func (s *targetTestSuite) TestInstallSuppressAutoConnectDefaultProviderContent(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockInterfaces(c, "content")
+
+	const consumerYaml = `name: content-consumer
+version: 1.0
+plugs:
+  shared:
+    interface: content
+    content: shared-content
+    default-provider: content-provider
+`
+	goal := snapstate.PathInstallGoal(snapstate.PathSnap{
+		Path:     makeTestSnap(c, consumerYaml),
+		SideInfo: &snap.SideInfo{RealName: "content-consumer", Revision: snap.R(1)},
+	})
+	_, _, err := snapstate.InstallWithGoal(context.Background(), s.state, goal, snapstate.Options{
+		SuppressAutoConnect: []string{"content"},
+	})
+	c.Assert(err, ErrorMatches, `cannot suppress auto-connection of interface "content" for snap "content-consumer": required to connect its default providers`)
+
+	// content connections of snaps without default providers can be suppressed
+	const plainYaml = `name: plain-consumer
+version: 1.0
+plugs:
+  shared:
+    interface: content
+    content: shared-content
+`
+	goal = snapstate.PathInstallGoal(snapstate.PathSnap{
+		Path:     makeTestSnap(c, plainYaml),
+		SideInfo: &snap.SideInfo{RealName: "plain-consumer", Revision: snap.R(1)},
+	})
+	_, _, err = snapstate.InstallWithGoal(context.Background(), s.state, goal, snapstate.Options{
+		SuppressAutoConnect: []string{"content"},
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *targetTestSuite) testInstallRefreshHold(c *C, opts snapstate.Options, now, expectedHold time.Time, undo bool) {
+	restore := snapstate.MockTimeNow(func() time.Time { return now })
+	defer restore()
+	restore = timeutil.MockTimeNow(func() time.Time { return now })
+	defer restore()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	goal := snapstate.StoreInstallGoal(snapstate.StoreSnap{InstanceName: "some-snap"})
+	_, ts, err := snapstate.InstallOne(context.Background(), s.state, goal, opts)
+	c.Assert(err, IsNil)
+
+	snapsup, err := snapstate.TaskSnapSetup(ts.Tasks()[0])
+	c.Assert(err, IsNil)
+	c.Assert(snapsup.RefreshHoldUntil, NotNil)
+	c.Check(snapsup.RefreshHoldUntil.Equal(expectedHold), Equals, true, Commentf("%s", snapsup.RefreshHoldUntil))
+
+	chg := s.state.NewChange("install", "install a snap")
+	chg.AddAll(ts)
+	if undo {
+		last := ts.Tasks()[len(ts.Tasks())-1]
+		terr := s.state.NewTask("error-trigger", "provoking total undo")
+		terr.WaitFor(last)
+		chg.AddTask(terr)
+	}
+
+	s.settle(c)
+
+	hold, err := snapstate.SystemHold(s.state, "some-snap")
+	c.Assert(err, IsNil)
+	if undo {
+		c.Assert(chg.Err(), NotNil)
+		c.Check(hold.IsZero(), Equals, true)
+		return
+	}
+	c.Assert(chg.Err(), IsNil)
+	c.Check(hold.Equal(expectedHold), Equals, true, Commentf("%s", hold))
+
+	held, err := snapstate.HeldSnaps(s.state, snapstate.HoldAutoRefresh)
+	c.Assert(err, IsNil)
+	c.Check(held, DeepEquals, map[string][]string{"some-snap": {"system"}})
+}
+
+func (s *targetTestSuite) TestInstallRefreshHoldUntil(c *C) {
+	now := time.Date(2025, time.January, 8, 9, 0, 0, 0, time.UTC)
+	holdUntil := now.Add(48 * time.Hour)
+	s.testInstallRefreshHold(c, snapstate.Options{RefreshHoldUntil: holdUntil}, now, holdUntil, false)
+}
+
+func (s *targetTestSuite) TestInstallRefreshSchedule(c *C) {
+	// a Wednesday
+	now := time.Date(2025, time.January, 8, 9, 0, 0, 0, time.UTC)
+	// held until the start of the next window on Friday
+	expected := time.Date(2025, time.January, 10, 23, 0, 0, 0, time.UTC)
+	s.testInstallRefreshHold(c, snapstate.Options{RefreshSchedule: "fri,23:00-01:00"}, now, expected, false)
+}
+
+func (s *targetTestSuite) TestInstallRefreshScheduleEarliestWindow(c *C) {
+	now := time.Date(2025, time.January, 8, 9, 0, 0, 0, time.UTC)
+	expected := time.Date(2025, time.January, 9, 4, 0, 0, 0, time.UTC)
+	s.testInstallRefreshHold(c, snapstate.Options{RefreshSchedule: "fri,23:00-01:00,,thu,04:00-05:00"}, now, expected, false)
+}
+
+func (s *targetTestSuite) TestInstallRefreshHoldUndo(c *C) {
+	now := time.Date(2025, time.January, 8, 9, 0, 0, 0, time.UTC)
+	holdUntil := now.Add(48 * time.Hour)
+	s.testInstallRefreshHold(c, snapstate.Options{RefreshHoldUntil: holdUntil}, now, holdUntil, true)
+}
+
+func (s *targetTestSuite) TestInstallRefreshHoldErrors(c *C) {
+	now := time.Date(2025, time.January, 8, 9, 0, 0, 0, time.UTC)
+	restore := snapstate.MockTimeNow(func() time.Time { return now })
+	defer restore()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	for _, t := range []struct {
+		opts snapstate.Options
+		err  string
+	}{{
+		opts: snapstate.Options{RefreshHoldUntil: now.Add(time.Hour), RefreshSchedule: "fri,23:00-01:00"},
+		err:  "cannot specify both a refresh hold time and a refresh schedule",
+	}, {
+		opts: snapstate.Options{RefreshSchedule: "bogus"},
+		err:  `cannot use refresh schedule: cannot parse "bogus": .*`,
+	}, {
+		opts: snapstate.Options{RefreshHoldUntil: now.Add(-time.Hour)},
+		err:  `cannot hold refreshes until 2025-01-08T08:00:00Z: time is in the past`,
+	}} {
+		goal := snapstate.StoreInstallGoal(snapstate.StoreSnap{InstanceName: "some-snap"})
+		_, _, err := snapstate.InstallOne(context.Background(), s.state, goal, t.opts)
+		c.Check(err, ErrorMatches, t.err)
+	}
+}
+
+func (s *targetTestSuite) TestInstallDownloadRateLimit(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	goal := snapstate.StoreInstallGoal(snapstate.StoreSnap{InstanceName: "some-snap"})
+	_, tss, err := snapstate.InstallWithGoal(context.Background(), s.state, goal, snapstate.Options{
+		DownloadRateLimit: 1024,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(tss, HasLen, 1)
+
+	for _, t := range tss[0].Tasks() {
+		if t.Kind() != "download-snap" {
+			continue
+		}
+		snapsup, err := snapstate.TaskSnapSetup(t)
+		c.Assert(err, IsNil)
+		c.Check(snapsup.DownloadRateLimit, Equals, int64(1024))
+		return
+	}
+	c.Fatalf("no download-snap task found")
+}
+
+func (s *targetTestSuite) TestUpdateDownloadRateLimit(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:          true,
+		TrackingChannel: "latest/stable",
+		Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{{
+			RealName: "some-snap",
+			SnapID:   "some-snap-id",
+			Revision: snap.R(7),
+		}}),
+		Current:  snap.R(7),
+		SnapType: "app",
+	})
+
+	goal := snapstate.StoreUpdateGoal(snapstate.StoreUpdate{InstanceName: "some-snap"})
+	ts, err := snapstate.UpdateOne(context.Background(), s.state, goal, nil, snapstate.Options{
+		DownloadRateLimit: 2048,
+	})
+	c.Assert(err, IsNil)
+
+	var found bool
+	for _, t := range ts.Tasks() {
+		if t.Kind() != "download-snap" {
+			continue
+		}
+		snapsup, err := snapstate.TaskSnapSetup(t)
+		c.Assert(err, IsNil)
+		c.Check(snapsup.DownloadRateLimit, Equals, int64(2048))
+		found = true
+	}
+	c.Check(found, Equals, true)
+}
+
+func (s *targetTestSuite) TestDownloadRateLimitNegative(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	opts := snapstate.Options{DownloadRateLimit: -1}
+
+	goal := snapstate.StoreInstallGoal(snapstate.StoreSnap{InstanceName: "some-snap"})
+	_, _, err := snapstate.InstallWithGoal(context.Background(), s.state, goal, opts)
+	c.Check(err, ErrorMatches, "cannot use negative download rate limit: -1")
+
+	update := snapstate.StoreUpdateGoal(snapstate.StoreUpdate{InstanceName: "some-snap"})
+	_, err = snapstate.UpdateOne(context.Background(), s.state, update, nil, opts)
+	c.Check(err, ErrorMatches, "cannot use negative download rate limit: -1")
+}
+
+func (s *targetTestSuite) setupUbuntuCore(c *C) {
+	snapstate.Set(s.state, "core", nil)
+	snapstate.Set(s.state, "ubuntu-core", &snapstate.SnapState{
+		Active:          true,
+		Sequence:        snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{{RealName: "ubuntu-core", SnapID: "ubuntu-core-snap-id", Revision: snap.R(1)}}),
+		Current:         snap.R(1),
+		SnapType:        "os",
+		TrackingChannel: "latest/beta",
+	})
+}
+
+func (s *targetTestSuite) TestReplaceWithGoalTransitionCore(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setupUbuntuCore(c)
+
+	tsl, err := snapstate.ReplaceWithGoal(context.Background(), s.state, snapstate.TransitionGoal("ubuntu-core", "core"), snapstate.Options{})
+	c.Assert(err, IsNil)
+
+	c.Assert(tsl, HasLen, 3)
+	// 1. install core
+	verifyInstallTasks(c, snap.TypeOS, runCoreConfigure, 0, tsl[0])
+	snapsup, err := snapstate.TaskSnapSetup(tsl[0].Tasks()[0])
+	c.Assert(err, IsNil)
+	c.Check(snapsup.InstanceName(), Equals, "core")
+	c.Check(snapsup.Channel, Equals, "latest/beta")
+	// 2. transition connections
+	verifyTransitionConnectionsTasks(c, tsl[1])
+	c.Check(tsl[1].Tasks()[0].WaitTasks(), testutil.Contains, tsl[0].Tasks()[len(tsl[0].Tasks())-1])
+	// 3. remove ubuntu-core
+	verifyCoreRemoveTasks(c, tsl[2])
+	c.Check(tsl[2].Tasks()[0].WaitTasks(), DeepEquals, tsl[1].Tasks())
+
+	// all in the same lane
+	lanes := tsl[0].Tasks()[0].Lanes()
+	c.Assert(lanes, HasLen, 1)
+	for _, ts := range tsl {
+		for _, t := range ts.Tasks() {
+			c.Check(t.Lanes(), DeepEquals, lanes, Commentf(t.Kind()))
+		}
+	}
+}
+
+func (s *targetTestSuite) TestReplaceWithGoalTransitionCoreAlreadyInstalled(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setupUbuntuCore(c)
+	snapstate.Set(s.state, "core", &snapstate.SnapState{
+		Active:   true,
+		Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{{RealName: "core", SnapID: "core-snap-id", Revision: snap.R(1)}}),
+		Current:  snap.R(1),
+		SnapType: "os",
+	})
+
+	tsl, err := snapstate.ReplaceWithGoal(context.Background(), s.state, snapstate.TransitionGoal("ubuntu-core", "core"), snapstate.Options{})
+	c.Assert(err, IsNil)
+
+	c.Assert(tsl, HasLen, 2)
+	verifyTransitionConnectionsTasks(c, tsl[0])
+	verifyCoreRemoveTasks(c, tsl[1])
+}
+
+func (s *targetTestSuite) TestReplaceWithGoalTransitionErrors(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setupUbuntuCore(c)
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(1)}}),
+		Current:  snap.R(1),
+		SnapType: "app",
+	})
+
+	for _, t := range []struct {
+		from, to string
+		err      string
+	}{
+		{"ubuntu-core", "ubuntu-core", `cannot transition snap "ubuntu-core" to itself`},
+		{"other-core", "core", `cannot transition snap "other-core": not installed`},
+		{"some-snap", "core", `cannot transition snap "some-snap": only core snaps can be transitioned, not snaps of type "app"`},
+		{"ubuntu-core", "some-snap", `cannot transition snap "ubuntu-core" to "some-snap": snap types differ \(os and app\)`},
+		{"ubuntu-core", "some-other-snap", `cannot transition snap "ubuntu-core" to "some-other-snap": snap types differ \(os and app\)`},
+	} {
+		goal := snapstate.TransitionGoal(t.from, t.to)
+		_, err := snapstate.ReplaceWithGoal(context.Background(), s.state, goal, snapstate.Options{})
+		c.Check(err, ErrorMatches, t.err)
+		_, err = snapstate.PreviewReplaceWithGoal(context.Background(), s.state, goal, snapstate.Options{})
+		c.Check(err, ErrorMatches, t.err)
+	}
+	c.Check(s.state.Tasks(), HasLen, 0)
+}
+
+func (s *targetTestSuite) TestPreviewReplaceWithGoalTransitionCore(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setupUbuntuCore(c)
+
+	preview, err := snapstate.PreviewReplaceWithGoal(context.Background(), s.state, snapstate.TransitionGoal("ubuntu-core", "core"), snapstate.Options{})
+	c.Assert(err, IsNil)
+	c.Check(preview.From, Equals, "ubuntu-core")
+	c.Check(preview.To, Equals, "core")
+	c.Assert(preview.Install, NotNil)
+	c.Check(preview.Install.InstanceName(), Equals, "core")
+	c.Check(preview.Install.Type(), Equals, snap.TypeOS)
+
+	// nothing was scheduled
+	c.Check(s.state.Tasks(), HasLen, 0)
+	c.Check(s.state.Changes(), HasLen, 0)
+}
+
+func (s *targetTestSuite) TestInstallWithGoalOrdering(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	goal := snapstate.StoreInstallGoal(
+		snapstate.StoreSnap{
+			InstanceName: "some-snap",
+			After:        []string{"some-other-snap"},
+		},
+		snapstate.StoreSnap{
+			InstanceName: "some-other-snap",
+		},
+	)
+
+	infos, tss, err := snapstate.InstallWithGoal(context.Background(), s.state, goal, snapstate.Options{})
+	c.Assert(err, IsNil)
+	c.Assert(infos, HasLen, 2)
+	c.Assert(tss, HasLen, 2)
+
+	tsByName := make(map[string]*state.TaskSet, len(infos))
+	for i, info := range infos {
+		tsByName[info.InstanceName()] = tss[i]
+	}
+	dependent, dep := tsByName["some-snap"], tsByName["some-other-snap"]
+	c.Assert(dependent, NotNil)
+	c.Assert(dep, NotNil)
+
+	// base prerequisites are still handled by the prerequisites task
+	first := dependent.Tasks()[0]
+	c.Check(first.Kind(), Equals, "prerequisites")
+
+	// the dependent snap only starts once the other snap is linked
+	depLink := dep.MaybeEdge(snapstate.MaybeRebootEdge)
+	c.Assert(depLink, NotNil)
+	c.Check(depLink.Kind(), Equals, "link-snap")
+	for _, t := range dependent.Tasks() {
+		c.Check(t.WaitTasks(), testutil.Contains, depLink)
+	}
+
+	// nothing in the other snap waits for the dependent snap
+	for _, t := range dep.Tasks() {
+		for _, wt := range t.WaitTasks() {
+			c.Check(dependent.Tasks(), Not(testutil.Contains), wt)
+		}
+	}
+}
+
+// mockContentConsumer makes some-snap in the store plug content with
+// some-other-snap as the default provider.
+func (s *targetTestSuite) mockContentConsumer() {
+	s.fakeStore.mutateSnapInfo = func(info *snap.Info) error {
+		if info.SnapName() != "some-snap" {
+			return nil
+		}
+		info.Plugs = map[string]*snap.PlugInfo{
+			"content-plug": {
+				Snap:      info,
+				Name:      "content-plug",
+				Interface: "content",
+				Attrs: map[string]any{
+					"content":          "some-content",
+					"default-provider": "some-other-snap",
+				},
+			},
+		}
+		return nil
+	}
+}
+
+func (s *targetTestSuite) TestInstallWithGoalAutoProviders(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockContentConsumer()
+
+	goal := snapstate.StoreInstallGoal(snapstate.StoreSnap{
+		InstanceName:  "some-snap",
+		AutoProviders: true,
+	})
+
+	infos, tss, err := snapstate.InstallWithGoal(context.Background(), s.state, goal, snapstate.Options{})
+	c.Assert(err, IsNil)
+	c.Assert(infos, HasLen, 2)
+	c.Assert(tss, HasLen, 2)
+	c.Check(infos[0].InstanceName(), Equals, "some-snap")
+	c.Check(infos[1].InstanceName(), Equals, "some-other-snap")
+
+	consumer, provider := tss[0], tss[1]
+
+	// the consumer only starts once the provider is linked
+	providerLink := provider.MaybeEdge(snapstate.MaybeRebootEdge)
+	c.Assert(providerLink, NotNil)
+	c.Check(providerLink.Kind(), Equals, "link-snap")
+	for _, t := range consumer.Tasks() {
+		c.Check(t.WaitTasks(), testutil.Contains, providerLink)
+	}
+}
+
+func (s *targetTestSuite) TestInstallWithGoalAutoProvidersAlreadyInstalled(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockContentConsumer()
+
+	snapstate.Set(s.state, "some-other-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{{RealName: "some-other-snap", SnapID: "some-other-snap-id", Revision: snap.R(1)}}),
+		Current:  snap.R(1),
+	})
+
+	goal := snapstate.StoreInstallGoal(snapstate.StoreSnap{
+		InstanceName:  "some-snap",
+		AutoProviders: true,
+	})
+
+	// the installed provider is not installed again
+	info, _, err := snapstate.InstallOne(context.Background(), s.state, goal, snapstate.Options{})
+	c.Assert(err, IsNil)
+	c.Check(info.InstanceName(), Equals, "some-snap")
+}
+
+func (s *targetTestSuite) TestInstallWithGoalAutoProvidersNotRequested(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockContentConsumer()
+
+	goal := snapstate.StoreInstallGoal(snapstate.StoreSnap{
+		InstanceName: "some-snap",
+	})
+
+	infos, _, err := snapstate.InstallWithGoal(context.Background(), s.state, goal, snapstate.Options{})
+	c.Assert(err, IsNil)
+	c.Assert(infos, HasLen, 1)
+	c.Check(infos[0].InstanceName(), Equals, "some-snap")
+}
+
+func (s *targetTestSuite) TestInstallOneAutoProviders(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockContentConsumer()
+
+	goal := snapstate.StoreInstallGoal(snapstate.StoreSnap{
+		InstanceName:  "some-snap",
+		AutoProviders: true,
+	})
+
+	_, _, err := snapstate.InstallOne(context.Background(), s.state, goal, snapstate.Options{})
+	c.Check(err, Equals, snapstate.ErrExpectedOneSnap)
+}
+
+func (s *targetTestSuite) TestInstallWithGoalOrderingAfterInstalledSnap(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-other-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{{RealName: "some-other-snap", SnapID: "some-other-snap-id", Revision: snap.R(1)}}),
+		Current:  snap.R(1),
+	})
+
+	goal := snapstate.StoreInstallGoal(snapstate.StoreSnap{
+		InstanceName: "some-snap",
+		After:        []string{"some-other-snap"},
+	})
+
+	_, tss, err := snapstate.InstallWithGoal(context.Background(), s.state, goal, snapstate.Options{})
+	c.Assert(err, IsNil)
+	c.Assert(tss, HasLen, 1)
+	c.Check(tss[0].Tasks()[0].WaitTasks(), HasLen, 0)
+}
+
+func (s *targetTestSuite) TestInstallWithGoalOrderingErrors(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	goal := snapstate.StoreInstallGoal(snapstate.StoreSnap{
+		InstanceName: "some-snap",
+		After:        []string{"some-other-snap"},
+	})
+	_, _, err := snapstate.InstallWithGoal(context.Background(), s.state, goal, snapstate.Options{})
+	c.Check(err, ErrorMatches, `cannot order snap "some-snap" after "some-other-snap": snap is neither installed nor part of the operation`)
+
+	goal = snapstate.StoreInstallGoal(snapstate.StoreSnap{
+		InstanceName: "some-snap",
+		After:        []string{"some-snap"},
+	})
+	_, _, err = snapstate.InstallWithGoal(context.Background(), s.state, goal, snapstate.Options{})
+	c.Check(err, ErrorMatches, `cannot order snap "some-snap" after itself`)
+
+	goal = snapstate.StoreInstallGoal(
+		snapstate.StoreSnap{
+			InstanceName: "some-snap",
+			After:        []string{"some-other-snap"},
+		},
+		snapstate.StoreSnap{
+			InstanceName: "some-other-snap",
+			After:        []string{"some-snap"},
+		},
+	)
+	_, _, err = snapstate.InstallWithGoal(context.Background(), s.state, goal, snapstate.Options{})
+	c.Check(err, ErrorMatches, `cannot order snaps: cyclic ordering constraint involving "some-(other-)?snap"`)
+}
+
+func (s *targetTestSuite) TestPathInstallGoalOrdering(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	si := &snap.SideInfo{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(7)}
+	goal := snapstate.PathInstallGoal(snapstate.PathSnap{
+		Path:     makeTestSnap(c, "name: some-snap\nversion: 1.0\n"),
+		SideInfo: si,
+		After:    []string{"some-other-snap"},
+	})
+
+	_, _, err := snapstate.InstallWithGoal(context.Background(), s.state, goal, snapstate.Options{})
+	c.Check(err, ErrorMatches, `cannot order snap "some-snap" after "some-other-snap": snap is neither installed nor part of the operation`)
+
+	snapstate.Set(s.state, "some-other-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{{RealName: "some-other-snap", SnapID: "some-other-snap-id", Revision: snap.R(1)}}),
+		Current:  snap.R(1),
+	})
+
+	_, tss, err := snapstate.InstallWithGoal(context.Background(), s.state, goal, snapstate.Options{})
+	c.Assert(err, IsNil)
+	c.Assert(tss, HasLen, 1)
+}
+
+func (s *targetTestSuite) TestDownloadWithGoal(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	const (
+		snapName = "some-snap"
+		compName = "standard-component"
+	)
+	s.fakeStore.snapResourcesFn = func(info *snap.Info) []store.SnapResourceResult {
+		c.Assert(info.SnapName(), DeepEquals, snapName)
+
+		return []store.SnapResourceResult{
+			{
+				DownloadInfo: snap.DownloadInfo{
+					DownloadURL: fmt.Sprintf("http://example.com/%s", compName),
+				},
+				Name:      compName,
+				Revision:  1,
+				Type:      fmt.Sprintf("component/%s", snap.StandardComponent),
+				Version:   "1.0",
+				CreatedAt: "2024-01-01T00:00:00Z",
+			},
+		}
+	}
+
+	s.fakeStore.mutateSnapInfo = func(info *snap.Info) error {
+		info.Components = map[string]*snap.Component{
+			compName: {
+				Type: snap.StandardComponent,
+				Name: compName,
+			},
+		}
+		return nil
+	}
+
+	downloadDir := c.MkDir()
+	goal := snapstate.StoreDownloadGoal(
+		snapstate.StoreSnap{
+			InstanceName: snapName,
+			Components:   []string{compName},
+		},
+		// repeated snaps are ignored
+		snapstate.StoreSnap{
+			InstanceName: snapName,
+		},
+	)
+
+	var fetched int
+	snapstate.FetchAndSaveDownloadAssertions = func(st *state.State, info *snap.Info, snapPath string, compsups []snapstate.ComponentSetup, assertsPath string, userID int, deviceCtx snapstate.DeviceContext) error {
+		fetched++
+		c.Check(info.InstanceName(), Equals, snapName)
+		c.Check(snapPath, Equals, filepath.Join(downloadDir, "some-snap_11.snap"))
+		c.Assert(compsups, HasLen, 1)
+		c.Check(compsups[0].ComponentName(), Equals, compName)
+		c.Check(compsups[0].CompPath, Equals, filepath.Join(downloadDir, "some-snap+standard-component_1.comp"))
+		c.Check(assertsPath, Equals, filepath.Join(downloadDir, "some-snap_11.assert"))
+		return nil
+	}
+
+	prqt := testPrereqTracker{}
+	downloaded, err := snapstate.DownloadWithGoal(context.Background(), s.state, goal, snapstate.Options{
+		DownloadDir:       downloadDir,
+		DownloadRateLimit: 1024,
+		PrereqTracker:     &prqt,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(downloaded, HasLen, 1)
+	c.Check(fetched, Equals, 1)
+
+	info := downloaded[0].Info
+	c.Check(info.InstanceName(), Equals, snapName)
+	c.Check(info.Revision, Equals, snap.R(11))
+
+	snapPath := filepath.Join(downloadDir, "some-snap_11.snap")
+	compPath := filepath.Join(downloadDir, "some-snap+standard-component_1.comp")
+	c.Check(downloaded[0].Path, Equals, snapPath)
+	c.Check(downloaded[0].ComponentPaths, DeepEquals, map[string]string{
+		compName: compPath,
+	})
+	c.Check(downloaded[0].AssertionsPath, Equals, filepath.Join(downloadDir, "some-snap_11.assert"))
+
+	dlOpts := &store.DownloadOptions{RateLimit: 1024}
+	c.Check(s.fakeStore.downloads, DeepEquals, []fakeDownload{
+		{name: snapName, target: snapPath, opts: dlOpts},
+		{name: "some-snap+standard-component", target: compPath, opts: dlOpts},
+	})
+	c.Check(prqt.infos, DeepEquals, []*snap.Info{info})
+
+	// nothing is set up to be installed
+	c.Check(s.state.Changes(), HasLen, 0)
+	c.Check(s.state.Tasks(), HasLen, 0)
+	var snapst snapstate.SnapState
+	c.Check(snapstate.Get(s.state, snapName, &snapst), testutil.ErrorIs, state.ErrNoState)
+}
+
+func (s *targetTestSuite) TestDownloadWithGoalValidationSets(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.fakeStore.registerID("some-snap", snaptest.AssertedSnapID("some-snap"))
+
+	signing := assertstest.NewStoreStack("can0nical", nil)
+	a, err := signing.Sign(asserts.ValidationSetType, map[string]any{
+		"type":         "validation-set",
+		"timestamp":    time.Now().Format(time.RFC3339),
+		"authority-id": "foo",
+		"series":       "16",
+		"account-id":   "foo",
+		"name":         "bar",
+		"sequence":     "3",
+		"snaps": []any{
+			map[string]any{
+				"name":     "some-snap",
+				"id":       snaptest.AssertedSnapID("some-snap"),
+				"presence": "required",
+				"revision": "12",
+			},
+		},
+	}, nil, "")
+	c.Assert(err, IsNil)
+
+	vsets := snapasserts.NewValidationSets()
+	c.Assert(vsets.Add(a.(*asserts.ValidationSet)), IsNil)
+
+	goal := snapstate.StoreDownloadGoal(snapstate.StoreSnap{
+		InstanceName: "some-snap",
+		RevOpts: snapstate.RevisionOptions{
+			Revision:       snap.R(11),
+			ValidationSets: vsets,
+		},
+	})
+
+	_, err = snapstate.DownloadWithGoal(context.Background(), s.state, goal, snapstate.Options{
+		DownloadDir: c.MkDir(),
+	})
+	c.Assert(err, ErrorMatches, `cannot download snap "some-snap" at revision 11 without --ignore-validation, revision 12 is required by validation sets: 16/foo/bar/3`)
+	c.Check(s.fakeStore.downloads, HasLen, 0)
+}
+
+func (s *targetTestSuite) TestDownloadWithGoalCleanupOnFailure(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	downloadDir := c.MkDir()
+	s.fakeStore.downloadCallback = func() {
+		// the fake store does not write the files
+		for _, name := range []string{"some-snap_11.snap", "some-other-snap_11.snap"} {
+			c.Assert(os.WriteFile(filepath.Join(downloadDir, name), nil, 0644), IsNil)
+		}
+	}
+	// some-other-snap is downloaded first
+	s.fakeStore.downloadError = map[string]error{
+		"some-snap": errors.New("boom"),
+	}
+	snapstate.FetchAndSaveDownloadAssertions = func(st *state.State, info *snap.Info, snapPath string, compsups []snapstate.ComponentSetup, assertsPath string, userID int, deviceCtx snapstate.DeviceContext) error {
+		return os.WriteFile(assertsPath, nil, 0644)
+	}
+
+	goal := snapstate.StoreDownloadGoal(snapstate.StoreSnap{InstanceName: "some-snap"}, snapstate.StoreSnap{InstanceName: "some-other-snap"})
+	_, err := snapstate.DownloadWithGoal(context.Background(), s.state, goal, snapstate.Options{
+		DownloadDir: downloadDir,
+	})
+	c.Assert(err, ErrorMatches, `cannot download snap "some-snap": boom`)
+	c.Check(s.fakeStore.downloads, HasLen, 2)
+
+	// nothing is left behind
+	entries, err := os.ReadDir(downloadDir)
+	c.Assert(err, IsNil)
+	c.Check(entries, HasLen, 0)
+}
+
+func (s *targetTestSuite) TestDownloadWithGoalFetchAssertionsError(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	downloadDir := c.MkDir()
+	s.fakeStore.downloadCallback = func() {
+		c.Assert(os.WriteFile(filepath.Join(downloadDir, "some-snap_11.snap"), nil, 0644), IsNil)
+	}
+	snapstate.FetchAndSaveDownloadAssertions = func(st *state.State, info *snap.Info, snapPath string, compsups []snapstate.ComponentSetup, assertsPath string, userID int, deviceCtx snapstate.DeviceContext) error {
+		return errors.New("cannot verify snap")
+	}
+
+	goal := snapstate.StoreDownloadGoal(snapstate.StoreSnap{InstanceName: "some-snap"})
+	_, err := snapstate.DownloadWithGoal(context.Background(), s.state, goal, snapstate.Options{
+		DownloadDir: downloadDir,
+	})
+	c.Assert(err, ErrorMatches, `cannot fetch assertions for snap "some-snap": cannot verify snap`)
+
+	entries, err := os.ReadDir(downloadDir)
+	c.Assert(err, IsNil)
+	c.Check(entries, HasLen, 0)
+}
+
+func (s *targetTestSuite) TestDownloadWithGoalErrors(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	goal := snapstate.StoreDownloadGoal(snapstate.StoreSnap{InstanceName: "some-snap"})
+
+	_, err := snapstate.DownloadWithGoal(context.Background(), s.state, goal, snapstate.Options{})
+	c.Check(err, ErrorMatches, "internal error: must specify directory to download to")
+
+	_, err = snapstate.DownloadWithGoal(context.Background(), s.state, goal, snapstate.Options{
+		DownloadDir:       c.MkDir(),
+		DownloadRateLimit: -1,
+	})
+	c.Check(err, ErrorMatches, "cannot use negative download rate limit: -1")
+
+	_, err = snapstate.DownloadWithGoal(context.Background(), s.state, goal, snapstate.Options{
+		DownloadDir: c.MkDir(),
+		Flags:       snapstate.Flags{RequireTypeBase: true},
+	})
+	c.Check(err, ErrorMatches, `unexpected snap type "app", instead of 'base'`)
+
+	goal = snapstate.StoreDownloadGoal(snapstate.StoreSnap{InstanceName: "some-snap"}, snapstate.StoreSnap{InstanceName: "some-other-snap"})
+	_, err = snapstate.DownloadWithGoal(context.Background(), s.state, goal, snapstate.Options{
+		DownloadDir:   c.MkDir(),
+		ExpectOneSnap: true,
+	})
+	c.Check(err, Equals, snapstate.ErrExpectedOneSnap)
+
+	c.Check(s.fakeStore.downloads, HasLen, 0)
+}
+
+func (s *targetTestSuite) setupSnapWithComponent(c *C, snapName, compName string) {
+	snapRev := snap.R(1)
+	si := &snap.SideInfo{
+		RealName: snapName,
+		Revision: snapRev,
+		SnapID:   snapName + "-id",
+	}
+	csi := snap.NewComponentSideInfo(naming.NewComponentRef(snapName, compName), snap.R(1))
+
+	info := snaptest.MockSnap(c, fmt.Sprintf("name: %s\nversion: 1\ncomponents:\n  %s:\n    type: standard\n  standard-component-extra:\n    type: standard\n", snapName, compName), si)
+	snaptest.MockComponent(c, fmt.Sprintf("component: %s+%s\ntype: standard\nversion: 1\n", snapName, compName), info, *csi)
+
+	snapstate.Set(s.state, snapName, &snapstate.SnapState{
+		Active: true,
+		Sequence: snapstatetest.NewSequenceFromRevisionSideInfos([]*sequence.RevisionSideState{
+			sequence.NewRevisionSideState(si, []*sequence.ComponentState{
+				sequence.NewComponentState(csi, snap.StandardComponent),
+			}),
+		}),
+		Current:         snapRev,
+		TrackingChannel: "channel-for-components",
+	})
+
+	s.fakeStore.snapResourcesFn = func(info *snap.Info) []store.SnapResourceResult {
+		c.Assert(info.InstanceName(), Equals, snapName)
+
+		var results []store.SnapResourceResult
+		for _, name := range []string{compName, "standard-component-extra"} {
+			results = append(results, store.SnapResourceResult{
+				DownloadInfo: snap.DownloadInfo{
+					DownloadURL: "http://example.com/" + name,
+				},
+				Name:      name,
+				Revision:  1,
+				Type:      fmt.Sprintf("component/%s", snap.StandardComponent),
+				Version:   "1.0",
+				CreatedAt: "2024-01-01T00:00:00Z",
+			})
+		}
+		return results
+	}
+}
+
+func (s *targetTestSuite) TestInstallWithGoalSkipIfPresentInstallsMissingComponents(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setupSnapWithComponent(c, "app-snap-with-components", "standard-component")
+
+	goal := snapstate.StoreInstallGoal(snapstate.StoreSnap{
+		InstanceName:  "app-snap-with-components",
+		Components:    []string{"standard-component", "standard-component-extra"},
+		SkipIfPresent: true,
+	})
+
+	info, ts, err := snapstate.InstallOne(context.Background(), s.state, goal, snapstate.Options{})
+	c.Assert(err, IsNil)
+	c.Check(info.InstanceName(), Equals, "app-snap-with-components")
+	c.Check(info.Revision, Equals, snap.R(1))
+
+	// only the missing component is installed, the snap is left untouched
+	var compNames []string
+	for _, t := range ts.Tasks() {
+		c.Check(t.Kind(), Not(Equals), "prepare-snap")
+		c.Check(t.Kind(), Not(Equals), "link-snap")
+
+		if t.Kind() != "download-component" {
+			continue
+		}
+		var compsup snapstate.ComponentSetup
+		c.Assert(t.Get("component-setup", &compsup), IsNil)
+		compNames = append(compNames, compsup.ComponentName())
+	}
+	c.Check(compNames, DeepEquals, []string{"standard-component-extra"})
+
+	setup, err := ts.Edge(snapstate.SnapSetupEdge)
+	c.Assert(err, IsNil)
+	c.Check(setup.Kind(), Equals, "setup-profiles")
+
+	// the existing snap revision was used to find the components
+	c.Assert(s.fakeBackend.ops, HasLen, 2)
+	c.Check(s.fakeBackend.ops[1].action.Action, Equals, "refresh")
+	c.Check(s.fakeBackend.ops[1].action.ResourceInstall, Equals, true)
+}
+
+func (s *targetTestSuite) TestInstallWithGoalSkipIfPresentComponentsPresent(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setupSnapWithComponent(c, "app-snap-with-components", "standard-component")
+
+	goal := snapstate.StoreInstallGoal(snapstate.StoreSnap{
+		InstanceName:  "app-snap-with-components",
+		Components:    []string{"standard-component"},
+		SkipIfPresent: true,
+	})
+
+	// the snap is skipped entirely, as if no components were requested, so
+	// nothing is left to install
+	_, _, err := snapstate.InstallWithGoal(context.Background(), s.state, goal, snapstate.Options{})
+	var actionErr *store.SnapActionError
+	c.Assert(errors.As(err, &actionErr), Equals, true)
+	c.Check(actionErr.NoResults, Equals, true)
+	c.Check(s.state.Tasks(), HasLen, 0)
+}
+
+func (s *targetTestSuite) testInstallWithGoalLaneGroups(c *C, transaction client.TransactionType) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	goal := snapstate.StoreInstallGoal(
+		snapstate.StoreSnap{
+			InstanceName: "some-snap",
+			LaneGroup:    "group",
+		},
+		snapstate.StoreSnap{
+			InstanceName: "some-other-snap",
+			LaneGroup:    "group",
+		},
+		snapstate.StoreSnap{
+			InstanceName: "some-epoch-snap",
+		},
+	)
+
+	opts := snapstate.Options{Flags: snapstate.Flags{Transaction: transaction}}
+	infos, tss, err := snapstate.InstallWithGoal(context.Background(), s.state, goal, opts)
+	c.Assert(err, IsNil)
+	c.Assert(infos, HasLen, 3)
+
+	lanesByName := make(map[string][]int, len(infos))
+	for i, info := range infos {
+		lanes := tss[i].Tasks()[0].Lanes()
+		for _, t := range tss[i].Tasks() {
+			c.Check(t.Lanes(), DeepEquals, lanes, Commentf(t.Kind()))
+		}
+		lanesByName[info.InstanceName()] = lanes
+	}
+
+	// the snaps of the group share a lane of their own
+	groupLanes := lanesByName["some-snap"]
+	c.Assert(groupLanes, HasLen, 1)
+	c.Check(lanesByName["some-other-snap"], DeepEquals, groupLanes)
+
+	// the other snap follows the transaction, which gives it a lane of its
+	// own or the default lane
+	c.Assert(lanesByName["some-epoch-snap"], HasLen, 1)
+	c.Check(lanesByName["some-epoch-snap"], Not(DeepEquals), groupLanes)
+	if transaction == "" {
+		c.Check(lanesByName["some-epoch-snap"], DeepEquals, []int{0})
+	}
+}
+
+func (s *targetTestSuite) TestInstallWithGoalLaneGroups(c *C) {
+	s.testInstallWithGoalLaneGroups(c, "")
+}
+
+func (s *targetTestSuite) TestInstallWithGoalLaneGroupsTransactionPerSnap(c *C) {
+	s.testInstallWithGoalLaneGroups(c, client.TransactionPerSnap)
+}
+
+func (s *targetTestSuite) TestInstallWithGoalLaneGroupsTransactionAllSnaps(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	goal := snapstate.StoreInstallGoal(
+		snapstate.StoreSnap{
+			InstanceName: "some-snap",
+			LaneGroup:    "group",
+		},
+		snapstate.StoreSnap{
+			InstanceName: "some-other-snap",
+		},
+	)
+
+	// all snaps share a single lane, the groups are redundant
+	opts := snapstate.Options{Flags: snapstate.Flags{Transaction: client.TransactionAllSnaps}}
+	_, tss, err := snapstate.InstallWithGoal(context.Background(), s.state, goal, opts)
+	c.Assert(err, IsNil)
+	c.Assert(tss, HasLen, 2)
+
+	lanes := tss[0].Tasks()[0].Lanes()
+	c.Assert(lanes, HasLen, 1)
+	for _, ts := range tss {
+		for _, t := range ts.Tasks() {
+			c.Check(t.Lanes(), DeepEquals, lanes, Commentf(t.Kind()))
+		}
+	}
+}
+
+func (s *targetTestSuite) TestInstallWithGoalResultsChannels(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	goal := snapstate.StoreInstallGoal(
+		snapstate.StoreSnap{
+			InstanceName: "some-snap",
+			RevOpts:      snapstate.RevisionOptions{Channel: "edge"},
+		},
+		snapstate.StoreSnap{
+			InstanceName: "some-snap-with-default-track",
+			RevOpts:      snapstate.RevisionOptions{Channel: "stable"},
+		},
+	)
+
+	results, tss, err := snapstate.InstallWithGoalResults(context.Background(), s.state, goal, snapstate.Options{})
+	c.Assert(err, IsNil)
+	c.Assert(tss, HasLen, 2)
+	c.Assert(results, HasLen, 2)
+
+	c.Check(results[0].Info.InstanceName(), Equals, "some-snap")
+	c.Check(results[0].Channel, Equals, "edge")
+	// the store redirected the snap to its default track
+	c.Check(results[1].Info.InstanceName(), Equals, "some-snap-with-default-track")
+	c.Check(results[1].Channel, Equals, "2.0/stable")
+}
+
+func (s *targetTestSuite) TestInstallWithGoalResultsChannelPinnedByValidationSets(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.fakeStore.registerID("some-snap", snaptest.AssertedSnapID("some-snap"))
+
+	signing := assertstest.NewStoreStack("can0nical", nil)
+	a, err := signing.Sign(asserts.ValidationSetType, map[string]any{
+		"type":         "validation-set",
+		"timestamp":    time.Now().Format(time.RFC3339),
+		"authority-id": "foo",
+		"series":       "16",
+		"account-id":   "foo",
+		"name":         "bar",
+		"sequence":     "3",
+		"snaps": []any{
+			map[string]any{
+				"name":     "some-snap",
+				"id":       snaptest.AssertedSnapID("some-snap"),
+				"presence": "required",
+				"revision": "11",
+			},
+		},
+	}, nil, "")
+	c.Assert(err, IsNil)
+
+	vsets := snapasserts.NewValidationSets()
+	c.Assert(vsets.Add(a.(*asserts.ValidationSet)), IsNil)
+
+	goal := snapstate.StoreInstallGoal(snapstate.StoreSnap{
+		InstanceName: "some-snap",
+		RevOpts: snapstate.RevisionOptions{
+			Channel:        "edge",
+			ValidationSets: vsets,
+		},
+	})
+
+	results, _, err := snapstate.InstallWithGoalResults(context.Background(), s.state, goal, snapstate.Options{})
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 1)
+	c.Check(results[0].Info.Revision, Equals, snap.R(11))
+	c.Check(results[0].Channel, Equals, "")
+
+	// the pinned revision is not considered when ignoring validation
+	results, _, err = snapstate.InstallWithGoalResults(context.Background(), s.state, goal, snapstate.Options{
+		Flags: snapstate.Flags{IgnoreValidation: true},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 1)
+	c.Check(results[0].Channel, Equals, "edge")
+}
+
+func (s *targetTestSuite) TestInstallWithManifestGoal(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.fakeStore.registerID("some-snap", snaptest.AssertedSnapID("some-snap"))
+
+	signing := assertstest.NewStoreStack("can0nical", nil)
+	a, err := signing.Sign(asserts.ValidationSetType, map[string]any{
+		"type":         "validation-set",
+		"timestamp":    time.Now().Format(time.RFC3339),
+		"authority-id": "foo",
+		"series":       "16",
+		"account-id":   "foo",
+		"name":         "bar",
+		"sequence":     "3",
+		"snaps": []any{
+			map[string]any{
+				"name":     "some-snap",
+				"id":       snaptest.AssertedSnapID("some-snap"),
+				"presence": "required",
+				"revision": "11",
+			},
+		},
+	}, nil, "")
+	c.Assert(err, IsNil)
+	vs := a.(*asserts.ValidationSet)
+
+	restore := snapstate.MockResolveLocalValidationSets(func(st *state.State, vsKeys map[string][]string) (map[string]*asserts.ValidationSet, error) {
+		c.Check(vsKeys, DeepEquals, map[string][]string{
+			"foo/bar": {"16", "foo", "bar", "3"},
+		})
+		return map[string]*asserts.ValidationSet{"foo/bar": vs}, nil
+	})
+	defer restore()
+
+	restore = snapstate.MockEnforcedValidationSets(func(st *state.State, extraVss ...*asserts.ValidationSet) (*snapasserts.ValidationSets, error) {
+		c.Check(extraVss, DeepEquals, []*asserts.ValidationSet{vs})
+		vsets := snapasserts.NewValidationSets()
+		for _, vs := range extraVss {
+			c.Assert(vsets.Add(vs), IsNil)
+		}
+		return vsets, nil
+	})
+	defer restore()
+
+	manifest := filepath.Join(c.MkDir(), "seed.manifest")
+	c.Assert(os.WriteFile(manifest, []byte(`# the seed of the device
+foo/bar 3
+some-snap 11
+some-other-snap 5
+`), 0644), IsNil)
+
+	goal, err := snapstate.ManifestInstallGoal(manifest)
+	c.Assert(err, IsNil)
+
+	results, _, err := snapstate.InstallWithGoalResults(context.Background(), s.state, goal, snapstate.Options{})
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 2)
+	c.Check(results[0].Info.InstanceName(), Equals, "some-other-snap")
+	c.Check(results[0].Info.Revision, Equals, snap.R(5))
+	c.Check(results[1].Info.InstanceName(), Equals, "some-snap")
+	c.Check(results[1].Info.Revision, Equals, snap.R(11))
+
+	var actions []store.SnapAction
+	for _, op := range s.fakeBackend.ops {
+		if op.op == "storesvc-snap-action:action" {
+			actions = append(actions, op.action)
+		}
+	}
+	c.Assert(actions, HasLen, 2)
+	c.Check(actions[0].Revision, Equals, snap.R(5))
+	c.Check(actions[0].ValidationSets, HasLen, 0)
+	c.Check(actions[1].Revision, Equals, snap.R(11))
+	c.Check(actions[1].ValidationSets, DeepEquals, []snapasserts.ValidationSetKey{"16/foo/bar/3"})
+}
+
+func (s *targetTestSuite) TestInstallWithManifestGoalValidationSetNotFound(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	restore := snapstate.MockResolveLocalValidationSets(func(st *state.State, vsKeys map[string][]string) (map[string]*asserts.ValidationSet, error) {
+		return nil, errors.New("validation-set assertion not found")
+	})
+	defer restore()
+
+	manifest := filepath.Join(c.MkDir(), "seed.manifest")
+	c.Assert(os.WriteFile(manifest, []byte("foo/bar=3\nsome-snap 11\n"), 0644), IsNil)
+
+	goal, err := snapstate.ManifestInstallGoal(manifest)
+	c.Assert(err, IsNil)
+
+	_, _, err = snapstate.InstallWithGoal(context.Background(), s.state, goal, snapstate.Options{})
+	c.Check(err, ErrorMatches, "cannot find validation sets of the manifest: validation-set assertion not found")
+
+	// the validation sets are not looked up when ignoring validation
+	_, tss, err := snapstate.InstallWithGoal(context.Background(), s.state, goal, snapstate.Options{
+		Flags: snapstate.Flags{IgnoreValidation: true},
+	})
+	c.Assert(err, IsNil)
+	c.Check(tss, HasLen, 1)
+}
+
+func (s *targetTestSuite) TestInstallWithManifestGoalComponentRevisions(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	const compName = "standard-component"
+	s.fakeStore.mutateSnapInfo = func(info *snap.Info) error {
+		info.Components = map[string]*snap.Component{
+			compName: {
+				Type: snap.StandardComponent,
+				Name: compName,
+			},
+		}
+		return nil
+	}
+	var compRev snap.Revision
+	s.fakeStore.snapResourcesFn = func(info *snap.Info) []store.SnapResourceResult {
+		return []store.SnapResourceResult{{
+			DownloadInfo: snap.DownloadInfo{
+				DownloadURL: "http://example.com/some-snap",
+			},
+			Name:      compName,
+			Revision:  compRev.N,
+			Type:      fmt.Sprintf("component/%s", snap.StandardComponent),
+			Version:   "1.0",
+			CreatedAt: "2024-01-01T00:00:00Z",
+		}}
+	}
+
+	manifest := filepath.Join(c.MkDir(), "seed.manifest")
+	c.Assert(os.WriteFile(manifest, []byte("some-snap 11\nsome-snap+standard-component 2\n"), 0644), IsNil)
+
+	goal, err := snapstate.ManifestInstallGoal(manifest)
+	c.Assert(err, IsNil)
+
+	// the store resolves the component revision from the snap revision, it
+	// must match the manifest
+	compRev = snap.R(3)
+	_, _, err = snapstate.InstallWithGoal(context.Background(), s.state, goal, snapstate.Options{})
+	c.Check(err, ErrorMatches, `cannot install component "some-snap\+standard-component": store offers revision 3, manifest requires revision 2`)
+
+	compRev = snap.R(2)
+	_, tss, err := snapstate.InstallWithGoal(context.Background(), s.state, goal, snapstate.Options{})
+	c.Assert(err, IsNil)
+	c.Assert(tss, HasLen, 1)
+
+	chg := s.state.NewChange("install", "...")
+	chg.AddAll(tss[0])
+	compsups, err := snapstate.TaskComponentSetups(tss[0].Tasks()[1])
+	c.Assert(err, IsNil)
+	c.Assert(compsups, HasLen, 1)
+	c.Check(compsups[0].CompSideInfo, DeepEquals, snap.NewComponentSideInfo(naming.NewComponentRef("some-snap", compName), snap.R(2)))
+}
+
+func (s *targetTestSuite) TestManifestInstallGoalErrors(c *C) {
+	_, err := snapstate.ManifestInstallGoal(filepath.Join(c.MkDir(), "missing.manifest"))
+	c.Check(err, ErrorMatches, `open .*/missing.manifest: no such file or directory`)
+
+	manifest := filepath.Join(c.MkDir(), "seed.manifest")
+	c.Assert(os.WriteFile(manifest, []byte("some-snap\n"), 0644), IsNil)
+	_, err = snapstate.ManifestInstallGoal(manifest)
+	c.Check(err, ErrorMatches, `cannot parse line: "some-snap"`)
+}
+
+func (s *targetTestSuite) testInstallWithGoalPreferCached(c *C, preferCached bool) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	goal := snapstate.StoreInstallGoal(snapstate.StoreSnap{
+		InstanceName: "some-snap",
+		PreferCached: preferCached,
+	})
+
+	_, ts, err := snapstate.InstallOne(context.Background(), s.state, goal, snapstate.Options{})
+	c.Assert(err, IsNil)
+
+	snapsup, err := snapstate.TaskSnapSetup(ts.Tasks()[0])
+	c.Assert(err, IsNil)
+	c.Check(snapsup.PreferCached, Equals, preferCached)
+	c.Check(snapsup.SnapPath, Equals, "")
+	c.Check(snapsup.DownloadInfo, NotNil)
+
+	// the snap goes through the store path, assertions included, whether
+	// the blob is taken from the cache or not
+	var kinds []string
+	for _, t := range ts.Tasks() {
+		kinds = append(kinds, t.Kind())
+	}
+	c.Check(kinds[1], Equals, "download-snap")
+	c.Check(kinds, testutil.Contains, "validate-snap")
+}
+
+func (s *targetTestSuite) TestInstallWithGoalPreferCached(c *C) {
+	s.testInstallWithGoalPreferCached(c, true)
+}
+
+func (s *targetTestSuite) TestInstallWithGoalPreferCachedNotRequested(c *C) {
+	s.testInstallWithGoalPreferCached(c, false)
+}
+
+func (s *targetTestSuite) TestUpdateWithGoalRefreshAllReportsSkipped(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	for _, name := range []string{"some-snap", "some-other-snap"} {
+		si := &snap.SideInfo{
+			RealName: name,
+			SnapID:   name + "-id",
+			Revision: snap.R(7),
+		}
+		snaptest.MockSnap(c, fmt.Sprintf("name: %s", name), si)
+		snapstate.Set(s.state, name, &snapstate.SnapState{
+			Active:          true,
+			TrackingChannel: "latest/stable",
+			Sequence:        snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{si}),
+			Current:         si.Revision,
+			SnapType:        "app",
+		})
+	}
+
+	c.Assert(snapstate.HoldRefreshesBySystem(s.state, snapstate.HoldGeneral, "forever", []string{"some-snap"}), IsNil)
+
+	// the last refresh time comes from the snap files, move past it so that
+	// the hold is the only thing keeping the snap from being refreshed
+	restore := snapstate.MockTimeNow(func() time.Time {
+		return time.Now().Add(365 * 24 * time.Hour)
+	})
+	defer restore()
+
+	snapstate.ValidateRefreshes = func(st *state.State, refreshes []*snap.Info, ignoreValidation map[string]bool, userID int, deviceCtx snapstate.DeviceContext) ([]*snap.Info, error) {
+		validated := make([]*snap.Info, 0, len(refreshes))
+		for _, info := range refreshes {
+			if info.InstanceName() != "some-other-snap" {
+				validated = append(validated, info)
+			}
+		}
+		return validated, nil
+	}
+
+	updated, uts, err := snapstate.UpdateWithGoal(context.Background(), s.state, snapstate.StoreUpdateGoal(), nil, snapstate.Options{})
+	c.Assert(err, IsNil)
+	c.Check(updated, HasLen, 0)
+	c.Check(uts.Skipped, DeepEquals, map[string]string{
+		"some-snap":       snapstate.SkipReasonHeld,
+		"some-other-snap": snapstate.SkipReasonRefreshControl,
+	})
+}
+
+func (s *targetTestSuite) TestUpdateWithGoalNoUpdate(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	for _, name := range []string{"some-snap", "some-other-snap"} {
+		snapstate.Set(s.state, name, &snapstate.SnapState{
+			Active:          true,
+			TrackingChannel: "latest/stable",
+			Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{{
+				RealName: name,
+				SnapID:   name + "-id",
+				Revision: snap.R(7),
+			}}),
+			Current:  snap.R(7),
+			SnapType: "app",
+		})
+	}
+
+	// some-snap has no new revision
+	s.fakeStore.refreshRevnos = map[string]snap.Revision{
+		"some-snap-id": snap.R(7),
+	}
+
+	goal := func() snapstate.UpdateGoal {
+		return snapstate.StoreUpdateGoal(
+			snapstate.StoreUpdate{InstanceName: "some-snap"},
+			snapstate.StoreUpdate{InstanceName: "some-other-snap"},
+		)
+	}
+
+	updated, uts, err := snapstate.UpdateWithGoal(context.Background(), s.state, goal(), nil, snapstate.Options{})
+	c.Assert(err, IsNil)
+	c.Check(updated, DeepEquals, []string{"some-other-snap"})
+	c.Check(uts.NoUpdate, DeepEquals, []string{"some-snap"})
+	c.Check(uts.Skipped, HasLen, 0)
+
+	for _, t := range s.state.Tasks() {
+		t.SetStatus(state.DoneStatus)
+	}
+
+	// the snaps left out by the filter are told apart
+	filter := func(info *snap.Info, _ *snapstate.SnapState) bool {
+		return info.InstanceName() != "some-other-snap"
+	}
+	updated, uts, err = snapstate.UpdateWithGoal(context.Background(), s.state, goal(), filter, snapstate.Options{})
+	c.Assert(err, IsNil)
+	c.Check(updated, HasLen, 0)
+	c.Check(uts.Refresh, HasLen, 0)
+	c.Check(uts.NoUpdate, DeepEquals, []string{"some-snap"})
+	c.Check(uts.Skipped, DeepEquals, map[string]string{
+		"some-other-snap": snapstate.SkipReasonFiltered,
+	})
+}
+
+func (s *targetTestSuite) mockInsufficientSpace(c *C, delta int64) (required *uint64) {
+	required = new(uint64)
+	s.AddCleanup(snapstate.MockOsutilCheckFreeSpace(func(path string, size uint64) error {
+		*required = size
+		return &osutil.NotEnoughDiskSpaceError{Path: path, Delta: delta}
+	}))
+
+	varDir := filepath.Join(dirs.GlobalRootDir, "/var")
+	s.AddCleanup(osutil.MockMountInfo(fmt.Sprintf(`26 1 8:3 / / rw,relatime shared:1 - ext4 /dev/sda3 rw
+27 26 8:4 / %s rw,relatime shared:2 - ext4 /dev/sda4 rw
+28 26 8:5 / %s rw,relatime shared:3 - ext4 /dev/sda5 rw
+`, varDir, filepath.Join(dirs.GlobalRootDir, "/var/lib/snapd-other"))))
+
+	tr := config.NewTransaction(s.state)
+	tr.Set("core", "experimental.check-disk-space-install", true)
+	tr.Set("core", "experimental.check-disk-space-refresh", true)
+	tr.Commit()
+
+	return required
+}
+
+func (s *targetTestSuite) TestInstallWithGoalInsufficientSpace(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	required := s.mockInsufficientSpace(c, 1)
+
+	goal := snapstate.StoreInstallGoal(
+		snapstate.StoreSnap{InstanceName: "some-snap"},
+		snapstate.StoreSnap{InstanceName: "some-other-snap"},
+	)
+	_, _, err := snapstate.InstallWithGoal(context.Background(), s.state, goal, snapstate.Options{})
+	c.Assert(err, ErrorMatches, `insufficient space in .* to perform "install" change for the following snaps: .*`)
+
+	var spaceErr *snapstate.InsufficientSpaceError
+	c.Assert(errors.As(err, &spaceErr), Equals, true)
+	c.Check(spaceErr.Snaps, testutil.DeepUnsortedMatches, []string{"some-snap", "some-other-snap"})
+	c.Check(spaceErr.Path, Equals, dirs.SnapdStateDir(dirs.GlobalRootDir))
+	c.Check(spaceErr.MountPoint, Equals, filepath.Join(dirs.GlobalRootDir, "/var"))
+	c.Check(spaceErr.Required, Equals, *required)
+	c.Check(spaceErr.Required, Not(Equals), uint64(0))
+	c.Check(spaceErr.Available, Equals, *required-1)
+}
+
+func (s *targetTestSuite) TestUpdateWithGoalInsufficientSpace(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:          true,
+		TrackingChannel: "latest/stable",
+		Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{{
+			RealName: "some-snap",
+			SnapID:   "some-snap-id",
+			Revision: snap.R(7),
+		}}),
+		Current:  snap.R(7),
+		SnapType: "app",
+	})
+
+	// more is missing than what is required, the available space is not
+	// reported as negative
+	required := s.mockInsufficientSpace(c, 1<<62)
+
+	_, _, err := snapstate.UpdateWithGoal(context.Background(), s.state, snapstate.StoreUpdateGoal(snapstate.StoreUpdate{
+		InstanceName: "some-snap",
+	}), nil, snapstate.Options{})
+
+	var spaceErr *snapstate.InsufficientSpaceError
+	c.Assert(errors.As(err, &spaceErr), Equals, true)
+	c.Check(spaceErr.ChangeKind, Equals, "refresh")
+	c.Check(spaceErr.Snaps, DeepEquals, []string{"some-snap"})
+	c.Check(spaceErr.MountPoint, Equals, filepath.Join(dirs.GlobalRootDir, "/var"))
+	c.Check(spaceErr.Required, Equals, *required)
+	c.Check(spaceErr.Available, Equals, uint64(0))
+}
+
+func (s *targetTestSuite) TestPlanUpdate(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	for _, name := range []string{"some-snap", "some-other-snap", "snap-c"} {
+		snapstate.Set(s.state, name, &snapstate.SnapState{
+			Active:          true,
+			TrackingChannel: "latest/stable",
+			Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{{
+				RealName: name,
+				SnapID:   name + "-id",
+				Revision: snap.R(7),
+			}}),
+			Current:  snap.R(7),
+			SnapType: "app",
+		})
+	}
+
+	// snap-c has no new revision
+	s.fakeStore.refreshRevnos = map[string]snap.Revision{
+		"snap-c-id": snap.R(7),
+	}
+
+	goal := snapstate.StoreUpdateGoal(
+		// gets a new revision
+		snapstate.StoreUpdate{InstanceName: "some-snap"},
+		// only switches channel
+		snapstate.StoreUpdate{
+			InstanceName: "some-other-snap",
+			RevOpts:      snapstate.RevisionOptions{Channel: "channel-for-7/stable"},
+		},
+		snapstate.StoreUpdate{InstanceName: "snap-c"},
+	)
+
+	summary, err := snapstate.PlanUpdate(context.Background(), s.state, goal, nil, snapstate.Options{})
+	c.Assert(err, IsNil)
+	c.Check(summary, DeepEquals, snapstate.UpdatePlanSummary{
+		Updates: []snapstate.SnapUpdateSummary{{
+			InstanceName: "some-other-snap",
+			FromRevision: snap.R(7),
+			ToRevision:   snap.R(7),
+			FromChannel:  "latest/stable",
+			ToChannel:    "channel-for-7/stable",
+		}, {
+			InstanceName: "some-snap",
+			FromRevision: snap.R(7),
+			ToRevision:   snap.R(11),
+			FromChannel:  "latest/stable",
+			ToChannel:    "latest/stable",
+		}},
+		NoUpdate: []string{"snap-c"},
+	})
+
+	// nothing was scheduled
+	c.Check(s.state.Tasks(), HasLen, 0)
+
+	// the snaps left out by the filter are reported as skipped
+	filter := func(info *snap.Info, _ *snapstate.SnapState) bool {
+		return info.InstanceName() != "some-snap"
+	}
+	summary, err = snapstate.PlanUpdate(context.Background(), s.state, goal, filter, snapstate.Options{
+		OnlyRevisionChanges: true,
+	})
+	c.Assert(err, IsNil)
+	c.Check(summary.Updates, HasLen, 0)
+	c.Check(summary.NoUpdate, DeepEquals, []string{"snap-c", "some-other-snap"})
+	c.Check(summary.Skipped, DeepEquals, map[string]string{
+		"some-snap": snapstate.SkipReasonFiltered,
+	})
+
+	// a single snap without an update
+	_, err = snapstate.PlanUpdate(context.Background(), s.state, snapstate.StoreUpdateGoal(snapstate.StoreUpdate{
+		InstanceName: "snap-c",
+	}), nil, snapstate.Options{ExpectOneSnap: true})
+	c.Check(err, Equals, store.ErrNoUpdateAvailable)
+}
+
+func (s *targetTestSuite) TestPlanUpdateAutoRefreshKeepsRefreshCandidates(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:          true,
+		TrackingChannel: "latest/stable",
+		Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{{
+			RealName: "some-snap",
+			SnapID:   "some-snap-id",
+			Revision: snap.R(7),
+		}}),
+		Current:  snap.R(7),
+		SnapType: "app",
+	})
+
+	summary, err := snapstate.PlanUpdate(context.Background(), s.state, snapstate.StoreUpdateGoal(), nil, snapstate.Options{
+		Flags: snapstate.Flags{IsAutoRefresh: true},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(summary.Updates, HasLen, 1)
+	c.Check(summary.Updates[0].InstanceName, Equals, "some-snap")
+	c.Check(summary.Updates[0].ToRevision, Equals, snap.R(11))
+
+	var candidates map[string]any
+	c.Check(s.state.Get("refresh-candidates", &candidates), testutil.ErrorIs, state.ErrNoState)
+	c.Check(s.state.Tasks(), HasLen, 0)
+}
+
+func (s *targetTestSuite) TestPlanUpdateComponents(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	const (
+		snapName = "some-snap"
+		snapID   = "some-snap-id"
+		channel  = "channel-for-components"
+	)
+
+	seq := snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{{
+		RealName: snapName,
+		SnapID:   snapID,
+		Revision: snap.R(7),
+	}})
+
+	for _, compName := range []string{"standard-component", "old-component"} {
+		seq.AddComponentForRevision(snap.R(7), &sequence.ComponentState{
+			SideInfo: &snap.ComponentSideInfo{
+				Component: naming.NewComponentRef(snapName, compName),
+				Revision:  snap.R(1),
+			},
+			CompType: snap.StandardComponent,
+		})
+	}
+
+	s.AddCleanup(snapstate.MockReadComponentInfo(func(
+		compMntDir string, info *snap.Info, csi *snap.ComponentSideInfo,
+	) (*snap.ComponentInfo, error) {
+		return &snap.ComponentInfo{
+			Component:         csi.Component,
+			Type:              snap.StandardComponent,
+			CompVersion:       "1.0",
+			ComponentSideInfo: *csi,
+		}, nil
+	}))
+
+	snapstate.Set(s.state, snapName, &snapstate.SnapState{
+		Active:          true,
+		TrackingChannel: channel,
+		Sequence:        seq,
+		Current:         snap.R(7),
+		SnapType:        "app",
+	})
+
+	s.fakeStore.snapResourcesFn = func(info *snap.Info) []store.SnapResourceResult {
+		return []store.SnapResourceResult{
+			{
+				DownloadInfo: snap.DownloadInfo{
+					DownloadURL: fmt.Sprintf("http://example.com/%s", snapName),
+				},
+				Name:      "standard-component",
+				Revision:  2,
+				Type:      fmt.Sprintf("component/%s", snap.StandardComponent),
+				Version:   "1.0",
+				CreatedAt: "2024-01-01T00:00:00Z",
+			},
+			{
+				DownloadInfo: snap.DownloadInfo{
+					DownloadURL: fmt.Sprintf("http://example.com/%s", snapName),
+				},
+				Name:      "standard-component-extra",
+				Revision:  3,
+				Type:      fmt.Sprintf("component/%s", snap.StandardComponent),
+				Version:   "1.0",
+				CreatedAt: "2024-01-01T00:00:00Z",
+			},
+		}
+	}
+
+	goal := snapstate.StoreUpdateGoal(snapstate.StoreUpdate{
+		InstanceName:         snapName,
+		AdditionalComponents: []string{"standard-component-extra"},
+	})
+
+	summary, err := snapstate.PlanUpdate(context.Background(), s.state, goal, nil, snapstate.Options{})
+	c.Assert(err, IsNil)
+	c.Assert(summary.Updates, HasLen, 1)
+	c.Check(summary.Updates[0].ToRevision, Equals, snap.R(11))
+	c.Check(summary.Updates[0].Components, DeepEquals, []snapstate.ComponentUpdateSummary{
+		{Name: "old-component", FromRevision: snap.R(1)},
+		{Name: "standard-component", FromRevision: snap.R(1), ToRevision: snap.R(2)},
+		{Name: "standard-component-extra", ToRevision: snap.R(3)},
+	})
+	c.Check(s.state.Tasks(), HasLen, 0)
+}
+
+func (s *targetTestSuite) TestUpdateWithGoalMaxRevision(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	for _, name := range []string{"some-snap", "some-other-snap"} {
+		snapstate.Set(s.state, name, &snapstate.SnapState{
+			Active:          true,
+			TrackingChannel: "latest/stable",
+			CohortKey:       "some-cohort",
+			Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{{
+				RealName: name,
+				SnapID:   name + "-id",
+				Revision: snap.R(7),
+			}}),
+			Current:  snap.R(7),
+			SnapType: "app",
+		})
+	}
+
+	// the store offers revision 11 of both snaps
+	goal := snapstate.StoreUpdateGoal(
+		// clamped to its maximum revision
+		snapstate.StoreUpdate{
+			InstanceName: "some-snap",
+			RevOpts:      snapstate.RevisionOptions{MaxRevision: snap.R(9)},
+		},
+		// within its maximum revision
+		snapstate.StoreUpdate{
+			InstanceName: "some-other-snap",
+			RevOpts:      snapstate.RevisionOptions{MaxRevision: snap.R(11)},
+		},
+	)
+
+	updated, uts, err := snapstate.UpdateWithGoal(context.Background(), s.state, goal, nil, snapstate.Options{})
+	c.Assert(err, IsNil)
+	c.Check(updated, testutil.DeepUnsortedMatches, []string{"some-snap", "some-other-snap"})
+
+	setups := make(map[string]*snapstate.SnapSetup)
+	for _, ts := range uts.Refresh {
+		t := ts.MaybeEdge(snapstate.BeginEdge)
+		if t == nil {
+			continue
+		}
+		snapsup, err := snapstate.TaskSnapSetup(t)
+		c.Assert(err, IsNil)
+		setups[snapsup.InstanceName()] = snapsup
+	}
+	c.Assert(setups, HasLen, 2)
+	c.Check(setups["some-snap"].Revision(), Equals, snap.R(9))
+	c.Check(setups["some-snap"].Channel, Equals, "latest/stable")
+	// the cohort offers revisions beyond the maximum one, it is dropped
+	c.Check(setups["some-snap"].CohortKey, Equals, "")
+	c.Check(setups["some-other-snap"].Revision(), Equals, snap.R(11))
+	c.Check(setups["some-other-snap"].CohortKey, Equals, "some-cohort")
+
+	var actions []store.SnapAction
+	for _, op := range s.fakeBackend.ops {
+		if op.op == "storesvc-snap-action:action" && op.action.InstanceName == "some-snap" {
+			actions = append(actions, op.action)
+		}
+	}
+	c.Assert(actions, HasLen, 2)
+	c.Check(actions[0].Revision.Unset(), Equals, true)
+	c.Check(actions[1].Revision, Equals, snap.R(9))
+	c.Check(actions[1].CohortKey, Equals, "")
+}
+
+func (s *targetTestSuite) TestUpdateWithGoalMaxRevisionLocal(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:          true,
+		TrackingChannel: "latest/stable",
+		Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{{
+			RealName: "some-snap",
+			SnapID:   "some-snap-id",
+			Revision: snap.R(9),
+		}, {
+			RealName: "some-snap",
+			SnapID:   "some-snap-id",
+			Revision: snap.R(7),
+		}}),
+		Current:  snap.R(7),
+		SnapType: "app",
+	})
+	snaptest.MockSnap(c, `name: some-snap`, &snap.SideInfo{
+		RealName: "some-snap",
+		SnapID:   "some-snap-id",
+		Revision: snap.R(9),
+	})
+
+	ts, err := snapstate.UpdateOne(context.Background(), s.state, snapstate.StoreUpdateGoal(snapstate.StoreUpdate{
+		InstanceName: "some-snap",
+		RevOpts:      snapstate.RevisionOptions{MaxRevision: snap.R(9)},
+	}), nil, snapstate.Options{})
+	c.Assert(err, IsNil)
+
+	snapsup, err := snapstate.TaskSnapSetup(ts.Tasks()[0])
+	c.Assert(err, IsNil)
+	c.Check(snapsup.Revision(), Equals, snap.R(9))
+	c.Check(snapsup.DownloadInfo, IsNil)
+	c.Check(snapsup.SnapPath, Equals, filepath.Join(dirs.SnapBlobDir, "some-snap_9.snap"))
+}
+
+func (s *targetTestSuite) TestUpdateWithGoalMaxRevisionUnavailable(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	// the store offers revision 11, but not the maximum revision 9
+	s.fakeStore.unavailableRevnos = map[string]snap.Revision{"some-snap-id": snap.R(9)}
+
+	si7 := &snap.SideInfo{
+		RealName: "some-snap",
+		SnapID:   "some-snap-id",
+		Revision: snap.R(7),
+	}
+	si8 := &snap.SideInfo{
+		RealName: "some-snap",
+		SnapID:   "some-snap-id",
+		Revision: snap.R(8),
+	}
+	snaptest.MockSnap(c, `name: some-snap`, si8)
+
+	for _, tc := range []struct {
+		sequence []*snap.SideInfo
+		expected snap.Revision
+	}{
+		// an older allowed revision is around, it is used instead
+		{[]*snap.SideInfo{si8, si7}, snap.R(8)},
+		// the older allowed revision was reverted from, it is blocked
+		{[]*snap.SideInfo{si7, si8}, snap.Revision{}},
+		// there is no older allowed revision, the update is skipped
+		{[]*snap.SideInfo{si7}, snap.Revision{}},
+	} {
+		snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+			Active:          true,
+			TrackingChannel: "latest/stable",
+			Sequence:        snapstatetest.NewSequenceFromSnapSideInfos(tc.sequence),
+			Current:         snap.R(7),
+			SnapType:        "app",
+		})
+
+		goal := snapstate.StoreUpdateGoal(snapstate.StoreUpdate{
+			InstanceName: "some-snap",
+			RevOpts:      snapstate.RevisionOptions{MaxRevision: snap.R(9)},
+		})
+		updated, uts, err := snapstate.UpdateWithGoal(context.Background(), s.state, goal, nil, snapstate.Options{})
+		c.Assert(err, IsNil)
+
+		if tc.expected.Unset() {
+			c.Check(updated, HasLen, 0)
+			c.Check(uts.NoUpdate, DeepEquals, []string{"some-snap"})
+			continue
+		}
+
+		c.Check(updated, DeepEquals, []string{"some-snap"})
+		var snapsup *snapstate.SnapSetup
+		for _, ts := range uts.Refresh {
+			if t := ts.MaybeEdge(snapstate.BeginEdge); t != nil {
+				snapsup, err = snapstate.TaskSnapSetup(t)
+				c.Assert(err, IsNil)
+			}
+		}
+		c.Assert(snapsup, NotNil)
+		c.Check(snapsup.Revision(), Equals, tc.expected)
+		c.Check(snapsup.DownloadInfo, IsNil)
+		c.Check(snapsup.SnapPath, Equals, filepath.Join(dirs.SnapBlobDir, "some-snap_8.snap"))
+	}
+
+	// the maximum revision was requested once for each case
+	var requested []snap.Revision
+	for _, op := range s.fakeBackend.ops {
+		if op.op == "storesvc-snap-action:action" && !op.action.Revision.Unset() {
+			requested = append(requested, op.action.Revision)
+		}
+	}
+	c.Check(requested, DeepEquals, []snap.Revision{snap.R(9), snap.R(9), snap.R(9)})
+}
+
+func (s *targetTestSuite) TestUpdateWithGoalMaxRevisionNotNewer(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:          true,
+		TrackingChannel: "latest/stable",
+		Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{{
+			RealName: "some-snap",
+			SnapID:   "some-snap-id",
+			Revision: snap.R(7),
+		}}),
+		Current:  snap.R(7),
+		SnapType: "app",
+	})
+
+	goal := func(maxRev snap.Revision) snapstate.UpdateGoal {
+		return snapstate.StoreUpdateGoal(snapstate.StoreUpdate{
+			InstanceName: "some-snap",
+			RevOpts:      snapstate.RevisionOptions{MaxRevision: maxRev},
+		})
+	}
+
+	for _, maxRev := range []snap.Revision{snap.R(7), snap.R(5)} {
+		updated, uts, err := snapstate.UpdateWithGoal(context.Background(), s.state, goal(maxRev), nil, snapstate.Options{})
+		c.Assert(err, IsNil)
+		c.Check(updated, HasLen, 0)
+		c.Check(uts.NoUpdate, DeepEquals, []string{"some-snap"})
+
+		_, err = snapstate.UpdateOne(context.Background(), s.state, goal(maxRev), nil, snapstate.Options{})
+		c.Check(err, Equals, store.ErrNoUpdateAvailable)
+	}
+}
+
+func (s *targetTestSuite) TestUpdateWithGoalMaxRevisionErrors(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:          true,
+		TrackingChannel: "latest/stable",
+		Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{{
+			RealName: "some-snap",
+			SnapID:   "some-snap-id",
+			Revision: snap.R(7),
+		}}),
+		Current:  snap.R(7),
+		SnapType: "app",
+	})
+
+	for _, tc := range []struct {
+		revOpts snapstate.RevisionOptions
+		err     string
+	}{
+		{snapstate.RevisionOptions{Revision: snap.R(8), MaxRevision: snap.R(9)}, "cannot specify revision and maximum revision"},
+		{snapstate.RevisionOptions{MaxRevision: snap.R(-1)}, "cannot use local revision x1 as maximum revision"},
+	} {
+		_, err := snapstate.UpdateOne(context.Background(), s.state, snapstate.StoreUpdateGoal(snapstate.StoreUpdate{
+			InstanceName: "some-snap",
+			RevOpts:      tc.revOpts,
+		}), nil, snapstate.Options{})
+		c.Check(err, ErrorMatches, tc.err)
+	}
+}
+
+func (s *targetTestSuite) TestUpdateWithGoalOnlyRevisionChanges(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	for _, name := range []string{"some-snap", "some-other-snap"} {
+		snapstate.Set(s.state, name, &snapstate.SnapState{
+			Active:          true,
+			TrackingChannel: "latest/stable",
+			Sequence: snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{{
+				RealName: name,
+				SnapID:   name + "-id",
+				Revision: snap.R(7),
+			}}),
+			Current:  snap.R(7),
+			SnapType: "app",
+		})
+	}
+
+	goal := snapstate.StoreUpdateGoal(
+		// only switches channel
+		snapstate.StoreUpdate{
+			InstanceName: "some-snap",
+			RevOpts:      snapstate.RevisionOptions{Channel: "channel-for-7/stable"},
+		},
+		// gets a new revision
+		snapstate.StoreUpdate{
+			InstanceName: "some-other-snap",
+		},
+	)
+
+	updated, uts, err := snapstate.UpdateWithGoal(context.Background(), s.state, goal, nil, snapstate.Options{
+		OnlyRevisionChanges: true,
+	})
+	c.Assert(err, IsNil)
+	c.Check(updated, DeepEquals, []string{"some-other-snap"})
+
+	for _, ts := range uts.Refresh {
+		for _, t := range ts.Tasks() {
+			c.Check(t.Kind(), Not(Equals), "switch-snap-channel")
+		}
+	}
+
+	// a single snap that would only switch channel has no update
+	_, err = snapstate.UpdateOne(context.Background(), s.state, snapstate.StoreUpdateGoal(snapstate.StoreUpdate{
+		InstanceName: "some-snap",
+		RevOpts:      snapstate.RevisionOptions{Channel: "channel-for-7/stable"},
+	}), nil, snapstate.Options{OnlyRevisionChanges: true})
+	c.Check(err, Equals, store.ErrNoUpdateAvailable)
+}
+
+func (s *targetTestSuite) TestUpdateWithGoalSkipChannelOnlySwitches(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	si := &snap.SideInfo{
+		RealName: "some-snap",
+		SnapID:   "some-snap-id",
+		Revision: snap.R(7),
+	}
+	snaptest.MockSnap(c, "name: some-snap\nversion: 1", si)
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:          true,
+		TrackingChannel: "latest/stable",
+		Sequence:        snapstatetest.NewSequenceFromSnapSideInfos([]*snap.SideInfo{si}),
+		Current:         si.Revision,
+		SnapType:        "app",
+	})
+
+	taskKinds := func(ts *state.TaskSet) []string {
+		var kinds []string
+		for _, t := range ts.Tasks() {
+			kinds = append(kinds, t.Kind())
+		}
+		return kinds
+	}
+
+	goal := func(channel string) snapstate.UpdateGoal {
+		return snapstate.StoreUpdateGoal(snapstate.StoreUpdate{
+			InstanceName: "some-snap",
+			RevOpts: snapstate.RevisionOptions{
+				Revision: snap.R(7),
+				Channel:  channel,
+			},
+		})
+	}
+
+	// by default the snap goes through the entire update
+	ts, err := snapstate.UpdateOne(context.Background(), s.state, goal("latest/edge"), nil, snapstate.Options{})
+	c.Assert(err, IsNil)
+	c.Check(taskKinds(ts), testutil.Contains, "link-snap")
+	for _, t := range s.state.Tasks() {
+		t.SetStatus(state.DoneStatus)
+	}
+
+	// only the channel is switched
+	ts, err = snapstate.UpdateOne(context.Background(), s.state, goal("latest/edge"), nil, snapstate.Options{
+		SkipChannelOnlySwitches: true,
+	})
+	c.Assert(err, IsNil)
+	c.Check(taskKinds(ts), DeepEquals, []string{"switch-snap-channel"})
+	for _, t := range s.state.Tasks() {
+		t.SetStatus(state.DoneStatus)
+	}
+
+	// nothing to do if the channel is the same
+	_, err = snapstate.UpdateOne(context.Background(), s.state, goal("latest/stable"), nil, snapstate.Options{
+		SkipChannelOnlySwitches: true,
+	})
+	c.Check(err, Equals, store.ErrNoUpdateAvailable)
+}
+
+func (s *targetTestSuite) TestUpdateWithGoalOnlyRevisionChangesComponents(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	const (
+		snapName = "app-snap-with-components"
+		compName = "standard-component"
+		channel  = "channel-for-components-only-component-refresh"
+	)
+	snapID := snapName + "-id"
+
+	si := &snap.SideInfo{
+		RealName: snapName,
+		SnapID:   snapID,
+		Revision: snap.R(7),
+		Channel:  channel,
+	}
+	csi := snap.NewComponentSideInfo(naming.NewComponentRef(snapName, compName), snap.R(1))
+	info := snaptest.MockSnap(c, fmt.Sprintf("name: %s\nversion: 1\ncomponents:\n  %s:\n    type: standard\n", snapName, compName), si)
+	snaptest.MockComponent(c, fmt.Sprintf("component: %s+%s\ntype: standard\nversion: 1\n", snapName, compName), info, *csi)
+
+	snapstate.Set(s.state, snapName, &snapstate.SnapState{
+		Active: true,
+		Sequence: snapstatetest.NewSequenceFromRevisionSideInfos([]*sequence.RevisionSideState{
+			sequence.NewRevisionSideState(si, []*sequence.ComponentState{
+				sequence.NewComponentState(csi, snap.StandardComponent),
+			}),
+		}),
+		Current:         si.Revision,
+		TrackingChannel: channel,
+		SnapType:        "app",
+	})
+
+	// the snap revision stays the same, but the component gets a new one
+	s.fakeStore.refreshRevnos = map[string]snap.Revision{
+		snapID: si.Revision,
+	}
+	s.fakeStore.snapResourcesFn = func(info *snap.Info) []store.SnapResourceResult {
+		return []store.SnapResourceResult{{
+			DownloadInfo: snap.DownloadInfo{
+				DownloadURL: "http://example.com/" + compName,
+			},
+			Name:      compName,
+			Revision:  2,
+			Type:      fmt.Sprintf("component/%s", snap.StandardComponent),
+			Version:   "1.0",
+			CreatedAt: "2024-01-01T00:00:00Z",
+		}}
+	}
+
+	goal := snapstate.StoreUpdateGoal(snapstate.StoreUpdate{InstanceName: snapName})
+	ts, err := snapstate.UpdateOne(context.Background(), s.state, goal, nil, snapstate.Options{
+		OnlyRevisionChanges: true,
+	})
+	c.Assert(err, IsNil)
+
+	var compNames []string
+	for _, t := range ts.Tasks() {
+		if t.Kind() != "download-component" {
+			continue
+		}
+		var compsup snapstate.ComponentSetup
+		c.Assert(t.Get("component-setup", &compsup), IsNil)
+		c.Check(compsup.Revision(), Equals, snap.R(2))
+		compNames = append(compNames, compsup.ComponentName())
+	}
+	c.Check(compNames, DeepEquals, []string{compName})
+}
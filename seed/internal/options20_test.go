@@ -72,6 +72,18 @@ snaps:
 	c.Assert(err, ErrorMatches, `cannot read grade dangerous options yaml: empty snaps element`)
 }
 
+func (s *options20Suite) TestNoSnaps(c *C) {
+	for _, content := range []string{"", "snaps: []\n"} {
+		fn := filepath.Join(c.MkDir(), "options.yaml")
+		err := os.WriteFile(fn, []byte(content), 0644)
+		c.Assert(err, IsNil)
+
+		options20, err := internal.ReadOptions20(fn)
+		c.Assert(err, IsNil)
+		c.Check(options20.Snaps, HasLen, 0)
+	}
+}
+
 func (s *options20Suite) TestNoPathAllowed(c *C) {
 	fn := filepath.Join(c.MkDir(), "options.yaml")
 	err := os.WriteFile(fn, []byte(`
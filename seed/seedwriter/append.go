@@ -0,0 +1,338 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package seedwriter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/seed/internal"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/naming"
+)
+
+// existingSystem holds what was found in the system the Writer is
+// appending extra snaps to.
+type existingSystem struct {
+	// refs are the unique references of the assertions already in
+	// the system
+	refs map[string]bool
+	// options are the content of options.yaml if present
+	options *internal.Options20
+
+	modelSnaps []*SeedSnap
+	extraSnaps []*SeedSnap
+}
+
+// existingAssertions indexes the snap assertions of an existing system.
+type existingAssertions struct {
+	declsByName map[string]*asserts.SnapDeclaration
+	revisions   map[string]snap.Revision
+	// resourceRevisions are indexed by snap-id and then by resource name
+	resourceRevisions map[string]map[string]snap.Revision
+}
+
+func checkAppendOptions(opts *Options) error {
+	if len(opts.ExtraAssertions) != 0 || len(opts.SystemUserAssertions) != 0 {
+		return fmt.Errorf("cannot add extra assertions when appending to an existing system")
+	}
+	if opts.EmitPerModeSnapDirs {
+		return fmt.Errorf("cannot emit per-mode snap directories when appending to an existing system")
+	}
+	return nil
+}
+
+// checkAppendable checks that the snap can be appended to the
+// existing system, if any.
+func (w *Writer) checkAppendable(ref naming.SnapRef) error {
+	if w.existing == nil {
+		return nil
+	}
+	modSnaps, err := w.modSnaps()
+	if err != nil {
+		return err
+	}
+	for _, modSnap := range modSnaps {
+		if naming.SameSnap(modSnap, ref) {
+			return fmt.Errorf("cannot append snap %q to system %q: snaps of the model cannot be changed", ref.SnapName(), w.opts.Label)
+		}
+	}
+	return nil
+}
+
+func (w *Writer) systemDir() string {
+	return filepath.Join(w.opts.SeedDir, "systems", w.opts.Label)
+}
+
+func (w *Writer) loadExistingAssertions() (*existingAssertions, error) {
+	systemDir := w.systemDir()
+
+	mf, err := os.Open(filepath.Join(systemDir, "model"))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read model of system %q: %v", w.opts.Label, err)
+	}
+	defer mf.Close()
+	model, err := asserts.NewDecoder(mf).Decode()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read model of system %q: %v", w.opts.Label, err)
+	}
+	if !bytes.Equal(asserts.Encode(model), asserts.Encode(w.model)) {
+		return nil, fmt.Errorf("cannot append to system %q: system was created for a different model", w.opts.Label)
+	}
+
+	assertFiles, err := filepath.Glob(filepath.Join(systemDir, "assertions", "*"))
+	if err != nil {
+		return nil, err
+	}
+	ea := &existingAssertions{
+		declsByName:       make(map[string]*asserts.SnapDeclaration),
+		revisions:         make(map[string]snap.Revision),
+		resourceRevisions: make(map[string]map[string]snap.Revision),
+	}
+	w.existing.refs = make(map[string]bool)
+	for _, fn := range assertFiles {
+		if err := w.loadExistingAssertionsFile(fn, ea); err != nil {
+			return nil, fmt.Errorf("cannot read assertions of system %q: %v", w.opts.Label, err)
+		}
+	}
+	return ea, nil
+}
+
+func (w *Writer) loadExistingAssertionsFile(fn string, ea *existingAssertions) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := asserts.NewDecoder(f)
+	for {
+		a, err := dec.Decode()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		w.existing.refs[a.Ref().Unique()] = true
+		switch a := a.(type) {
+		case *asserts.SnapDeclaration:
+			ea.declsByName[a.SnapName()] = a
+		case *asserts.SnapRevision:
+			ea.revisions[a.SnapID()] = snap.R(a.SnapRevision())
+		case *asserts.SnapResourceRevision:
+			resRevs := ea.resourceRevisions[a.SnapID()]
+			if resRevs == nil {
+				resRevs = make(map[string]snap.Revision)
+				ea.resourceRevisions[a.SnapID()] = resRevs
+			}
+			resRevs[a.ResourceName()] = snap.R(a.ResourceRevision())
+		}
+	}
+}
+
+// loadExistingSystem loads the content of the system with the label
+// from the options, in order to append extra snaps to it.
+func (w *Writer) loadExistingSystem() error {
+	ea, err := w.loadExistingAssertions()
+	if err != nil {
+		return err
+	}
+
+	optionsFn := filepath.Join(w.systemDir(), "options.yaml")
+	optEntries := make(map[string]*internal.Snap20)
+	if osutil.FileExists(optionsFn) {
+		options, err := internal.ReadOptions20(optionsFn)
+		if err != nil {
+			return err
+		}
+		w.existing.options = options
+		for _, entry := range options.Snaps {
+			optEntries[entry.Name] = entry
+		}
+	}
+
+	modSnaps, err := w.modSnaps()
+	if err != nil {
+		return err
+	}
+	modelSnapNames := make(map[string]bool, len(modSnaps))
+	for _, modSnap := range modSnaps {
+		modelSnapNames[modSnap.SnapName()] = true
+		entry := optEntries[modSnap.SnapName()]
+		sn, err := w.existingSeedSnap(modSnap, modSnap, entry, ea)
+		if err == errSkipOptional {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		sn.modelSnap = modSnap
+		sn.Channel = modSnap.DefaultChannel
+		if entry != nil && entry.Channel != "" {
+			sn.Channel = entry.Channel
+		}
+		w.existing.modelSnaps = append(w.existing.modelSnaps, sn)
+	}
+
+	if w.existing.options == nil {
+		return nil
+	}
+	for _, entry := range w.existing.options.Snaps {
+		if modelSnapNames[entry.Name] {
+			continue
+		}
+		sn, err := w.existingSeedSnap(naming.NewSnapRef(entry.Name, entry.SnapID), nil, entry, ea)
+		if err != nil {
+			return err
+		}
+		sn.Channel = entry.Channel
+		w.existing.extraSnaps = append(w.existing.extraSnaps, sn)
+	}
+	return nil
+}
+
+// existingSeedSnap builds the SeedSnap for a snap already in the
+// system. modSnap is nil for extra snaps, entry is the options.yaml
+// entry for the snap if any.
+func (w *Writer) existingSeedSnap(ref naming.SnapRef, modSnap *asserts.ModelSnap, entry *internal.Snap20, ea *existingAssertions) (*SeedSnap, error) {
+	snapName := ref.SnapName()
+	systemSnapsDir := filepath.Join(w.systemDir(), "snaps")
+
+	si := &snap.SideInfo{RealName: snapName}
+	sn := &SeedSnap{
+		SnapRef:  ref,
+		existing: true,
+	}
+	if entry != nil && entry.Unasserted != "" {
+		si.Revision = snap.R(-1)
+		sn.local = true
+		sn.Path = filepath.Join(systemSnapsDir, entry.Unasserted)
+	} else {
+		decl := ea.declsByName[snapName]
+		if decl == nil {
+			if modSnap != nil && modSnap.Presence == "optional" {
+				return nil, errSkipOptional
+			}
+			return nil, fmt.Errorf("cannot find snap %q in system %q", snapName, w.opts.Label)
+		}
+		rev, ok := ea.revisions[decl.SnapID()]
+		if !ok {
+			return nil, fmt.Errorf("cannot find revision of snap %q in system %q", snapName, w.opts.Label)
+		}
+		si.SnapID = decl.SnapID()
+		si.Revision = rev
+		snapsDir := systemSnapsDir
+		if modSnap != nil {
+			snapsDir = filepath.Join(w.opts.SeedDir, "snaps")
+		}
+		sn.Path = filepath.Join(snapsDir, fmt.Sprintf("%s_%s.snap", snapName, rev))
+	}
+
+	snapf, err := w.opts.openSnap(sn.Path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open snap %q of system %q: %v", snapName, w.opts.Label, err)
+	}
+	info, err := snap.ReadInfoFromSnapFile(snapf, si)
+	if err != nil {
+		return nil, err
+	}
+	sn.Info = info
+
+	for compName, rev := range ea.resourceRevisions[si.SnapID] {
+		compsDir := systemSnapsDir
+		if modSnap != nil {
+			if _, ok := modSnap.Components[compName]; ok {
+				compsDir = filepath.Join(w.opts.SeedDir, "snaps")
+			}
+		}
+		cpi := snap.MinimalComponentContainerPlaceInfo(compName, rev, snapName)
+		sc, err := w.existingSeedComponent(info, compName, rev, filepath.Join(compsDir, cpi.Filename()))
+		if err != nil {
+			return nil, err
+		}
+		sn.Components = append(sn.Components, *sc)
+	}
+	if entry != nil {
+		for _, comp := range entry.Components {
+			if comp.Unasserted == "" {
+				continue
+			}
+			sc, err := w.existingSeedComponent(info, comp.Name, snap.Revision{}, filepath.Join(systemSnapsDir, comp.Unasserted))
+			if err != nil {
+				return nil, err
+			}
+			sn.Components = append(sn.Components, *sc)
+		}
+	}
+	return sn, nil
+}
+
+func (w *Writer) existingSeedComponent(info *snap.Info, compName string, rev snap.Revision, compPath string) (*SeedComponent, error) {
+	cref := naming.NewComponentRef(info.SnapName(), compName)
+	compf, err := w.opts.openSnap(compPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open component %s of system %q: %v", cref, w.opts.Label, err)
+	}
+	compInfo, err := snap.ReadComponentInfoFromContainer(compf, info, snap.NewComponentSideInfo(cref, rev))
+	if err != nil {
+		return nil, err
+	}
+	return &SeedComponent{
+		ComponentRef: cref,
+		Path:         compPath,
+		Info:         compInfo,
+	}, nil
+}
+
+// existingSnapsToDownload sets up the Writer with the snaps of the
+// existing system instead of the ones to download for the model.
+func (w *Writer) existingSnapsToDownload() ([]*SeedSnap, error) {
+	existing := naming.NewSnapSet(nil)
+	for _, snaps := range [][]*SeedSnap{w.existing.modelSnaps, w.existing.extraSnaps} {
+		for _, sn := range snaps {
+			existing.Add(sn)
+		}
+	}
+	for _, optSnap := range w.optionsSnaps {
+		var snapRef naming.SnapRef = optSnap
+		if sn := w.localSnaps[optSnap]; sn != nil {
+			snapRef = sn
+		}
+		if existing.Contains(snapRef) {
+			return nil, fmt.Errorf("cannot append snap %q to system %q: snap is already part of the system", snapRef.SnapName(), w.opts.Label)
+		}
+	}
+
+	w.snapsFromModel = w.existing.modelSnaps
+	w.extraSnaps = append([]*SeedSnap(nil), w.existing.extraSnaps...)
+	w.toDownloadConsideredNum = len(w.snapsFromModel)
+	w.extraSnapsGuessNum = len(w.optionsSnaps)
+	if w.extraSnapsGuessNum > 0 {
+		if err := w.policy.allowsDangerousFeatures(); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,60 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package seedwriter
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/snapcore/snapd/asserts"
+)
+
+// singleAssertionStreamFile is the name of the file under the
+// assertions directory of a Core 16/18 seed holding all of its
+// assertions with Options.SingleAssertionStream.
+const singleAssertionStreamFile = "all"
+
+// ReadSingleAssertionStream reads the assertions of the Core 16/18 seed
+// at seedDir written with Options.SingleAssertionStream, in the order
+// they were written, which is such that prerequisites come first.
+// Note that seed.Open loads such a seed as any other.
+func ReadSingleAssertionStream(seedDir string) ([]asserts.Assertion, error) {
+	f, err := os.Open(filepath.Join(seedDir, "assertions", singleAssertionStreamFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var as []asserts.Assertion
+	dec := asserts.NewDecoder(f)
+	for {
+		a, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read assertion stream: %v", err)
+		}
+		as = append(as, a)
+	}
+	return as, nil
+}
@@ -0,0 +1,103 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package seedwriter_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/seed/seedtest"
+	"github.com/snapcore/snapd/seed/seedwriter"
+)
+
+func (s *writerSuite) TestSingleAssertionStreamCore18(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"cont-consumer", "cont-producer"},
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "cont-producer", "developerid")
+	s.makeSnap(c, "cont-consumer", "developerid")
+
+	s.opts.SingleAssertionStream = true
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	c.Assert(w.SeedSnaps(nil), IsNil)
+	c.Assert(w.WriteMeta(), IsNil)
+
+	// only the combined file is written
+	seedAssertsDir := filepath.Join(s.opts.SeedDir, "assertions")
+	l, err := os.ReadDir(seedAssertsDir)
+	c.Assert(err, IsNil)
+	c.Assert(l, HasLen, 1)
+	c.Check(l[0].Name(), Equals, "all")
+
+	as, err := seedwriter.ReadSingleAssertionStream(s.opts.SeedDir)
+	c.Assert(err, IsNil)
+
+	// each assertion is written once and after its prerequisites
+	seen := make(map[string]bool)
+	var models, revs int
+	for _, a := range as {
+		c.Check(seen[a.Ref().Unique()], Equals, false)
+		seen[a.Ref().Unique()] = true
+		for _, pre := range a.Prerequisites() {
+			if pre.Type == asserts.AccountType && pre.PrimaryKey[0] == "canonical" {
+				// trusted
+				continue
+			}
+			c.Check(seen[pre.Unique()], Equals, true, Commentf("%v before %v", a.Ref(), pre))
+		}
+		switch a.Type() {
+		case asserts.ModelType:
+			models++
+		case asserts.SnapRevisionType:
+			revs++
+		}
+	}
+	c.Check(models, Equals, 1)
+	c.Check(revs, Equals, 6)
+
+	// the seed can be loaded
+	const usesSnapd = true
+	seedtest.ValidateSeed(c, s.opts.SeedDir, "", usesSnapd, s.StoreSigning.Trusted)
+}
+
+func (s *writerSuite) TestSingleAssertionStreamCore20Unsupported(c *C) {
+	model := s.appendModel()
+
+	s.opts.Label = "20191122"
+	s.opts.SingleAssertionStream = true
+	_, err := seedwriter.New(model, s.opts)
+	c.Check(err, ErrorMatches, `cannot write a single assertion stream for a UC20\+ system`)
+}
@@ -0,0 +1,140 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package seedwriter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"path/filepath"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/osutil"
+)
+
+// blobChecksum is the entry of the checksum manifest for one seed blob.
+type blobChecksum struct {
+	sha3_384 string
+	path     string
+}
+
+// recordChecksums records for the checksum manifest the digests of
+// the blobs of the seed snap sn and of its components. The digests
+// from the snap-revision and snap-resource-revision assertions are
+// used when available, otherwise they are computed from the blobs.
+func (w *Writer) recordChecksums(sn *SeedSnap) error {
+	digest, err := w.assertedDigest(sn, asserts.SnapRevisionType, "")
+	if err != nil {
+		return err
+	}
+	if digest == "" && !sn.local {
+		digest = sn.Info.Sha3_384
+	}
+	if err := w.recordChecksum(sn.Path, digest); err != nil {
+		return err
+	}
+	for _, comp := range sn.Components {
+		digest, err := w.assertedDigest(sn, asserts.SnapResourceRevisionType, comp.ComponentRef.ComponentName)
+		if err != nil {
+			return err
+		}
+		if err := w.recordChecksum(comp.Path, digest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assertedBlob returns the digest, encoded as in assertions, and the
+// size recorded in the assertion of type assertType among the ones of
+// sn, for snap-resource-revision ones the one for the resource resName.
+// It returns "" if there is no such assertion.
+func (w *Writer) assertedBlob(sn *SeedSnap, assertType *asserts.AssertionType, resName string) (sha3_384 string, size uint64, err error) {
+	for _, ref := range sn.aRefs {
+		if ref.Type != assertType {
+			continue
+		}
+		a, err := ref.Resolve(w.db.Find)
+		if err != nil {
+			return "", 0, err
+		}
+		switch a := a.(type) {
+		case *asserts.SnapRevision:
+			return a.SnapSHA3_384(), a.SnapSize(), nil
+		case *asserts.SnapResourceRevision:
+			if a.ResourceName() != resName {
+				continue
+			}
+			return a.ResourceSHA3_384(), a.ResourceSize(), nil
+		}
+	}
+	return "", 0, nil
+}
+
+// assertedDigest returns as hex the digest recorded in the assertion
+// of type assertType among the ones of sn, for snap-resource-revision
+// ones the one for the resource resName. It returns "" if there is
+// no such assertion.
+func (w *Writer) assertedDigest(sn *SeedSnap, assertType *asserts.AssertionType, resName string) (string, error) {
+	encoded, _, err := w.assertedBlob(sn, assertType, resName)
+	if err != nil {
+		// not in the database, e.g. for snaps of an
+		// existing system, compute the digest instead
+		return "", nil
+	}
+	if encoded == "" {
+		return "", nil
+	}
+	dgst, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("cannot decode digest of %s for %q: %v", assertType.Name, sn.SnapName(), err)
+	}
+	return fmt.Sprintf("%x", dgst), nil
+}
+
+func (w *Writer) recordChecksum(path, digest string) error {
+	if digest == "" {
+		var err error
+		digest, err = fileSha3_384(path)
+		if err != nil {
+			return fmt.Errorf("cannot compute checksum of %q: %v", path, err)
+		}
+	}
+	relPath, err := filepath.Rel(w.opts.SeedDir, path)
+	if err != nil {
+		return err
+	}
+	w.checksums = append(w.checksums, blobChecksum{
+		sha3_384: digest,
+		path:     relPath,
+	})
+	return nil
+}
+
+// writeChecksumManifest writes the checksum manifest to path, one
+// "<sha3-384>  <path relative to the seed directory>" line per seed
+// blob, the format understood by sha3sum -c and similar tools.
+func (w *Writer) writeChecksumManifest(path string) error {
+	var buf bytes.Buffer
+	for _, c := range w.checksums {
+		fmt.Fprintf(&buf, "%s  %s\n", c.sha3_384, c.path)
+	}
+	return osutil.AtomicWriteFile(path, buf.Bytes(), 0644, 0)
+}
@@ -0,0 +1,60 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package seedwriter
+
+import (
+	"os"
+)
+
+// withCopyProgress wraps seedBlob to report the progress of seeding
+// each blob through Options.CopyProgress, if set.
+func (w *Writer) withCopyProgress(seedBlob func(name, src, dst string) error) func(name, src, dst string) error {
+	progress := w.opts.CopyProgress
+	if progress == nil {
+		return seedBlob
+	}
+	return func(name, src, dst string) error {
+		st, err := os.Stat(src)
+		if err != nil {
+			return err
+		}
+		progress(name, 0, st.Size())
+		if err := seedBlob(name, src, dst); err != nil {
+			return err
+		}
+		progress(name, st.Size(), st.Size())
+		return nil
+	}
+}
+
+// blobInPlace reports through Options.CopyProgress, if set, the blob
+// of the given snap or component as fully in place at path.
+func (w *Writer) blobInPlace(name, path string) error {
+	progress := w.opts.CopyProgress
+	if progress == nil {
+		return nil
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	progress(name, st.Size(), st.Size())
+	return nil
+}
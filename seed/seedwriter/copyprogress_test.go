@@ -0,0 +1,102 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package seedwriter_test
+
+import (
+	"fmt"
+	"os"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/seed/seedwriter"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snapfile"
+)
+
+func (s *writerSuite) TestSeedSnapsCopyProgressCore20(c *C) {
+	model := s.appendModel()
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	localFn := s.makeLocalSnap(c, "bare-app")
+	st, err := os.Stat(localFn)
+	c.Assert(err, IsNil)
+	localSize := st.Size()
+
+	var events []string
+	s.opts.Label = "20260101"
+	s.opts.CopyProgress = func(snapOrComp string, bytesCopied, total int64) {
+		c.Check(total > 0, Equals, true)
+		done := "0"
+		if bytesCopied == total {
+			done = "total"
+		}
+		events = append(events, fmt.Sprintf("%s:%s", snapOrComp, done))
+		if snapOrComp == "bare-app" {
+			c.Check(total, Equals, localSize)
+		}
+	}
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+	c.Assert(w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Path: localFn}}), IsNil)
+	c.Assert(w.Start(s.db, s.rf), IsNil)
+
+	localSnaps, err := w.LocalSnaps()
+	c.Assert(err, IsNil)
+	c.Assert(localSnaps, HasLen, 1)
+	f, err := snapfile.Open(localSnaps[0].Path)
+	c.Assert(err, IsNil)
+	info, err := snap.ReadInfoFromSnapFile(f, nil)
+	c.Assert(err, IsNil)
+	c.Assert(w.SetInfo(localSnaps[0], info, nil), IsNil)
+	c.Assert(w.InfoDerived(), IsNil)
+
+	for complete := false; !complete; {
+		snaps, err := w.SnapsToDownload()
+		c.Assert(err, IsNil)
+		for _, sn := range snaps {
+			s.fillDownloadedSnap(c, w, sn)
+		}
+		complete, err = w.Downloaded(s.fetchAsserts(c))
+		c.Assert(err, IsNil)
+	}
+
+	// events are reported while copying
+	copySnap := func(name, src, dst string) error {
+		events = append(events, "copy:"+name)
+		return osutil.CopyFile(src, dst, 0)
+	}
+	c.Assert(w.SeedSnaps(copySnap), IsNil)
+
+	// the snaps fetched into place are reported once, the copied
+	// local snap before and after copying
+	c.Check(events, DeepEquals, []string{
+		"snapd:total",
+		"pc-kernel:total",
+		"core20:total",
+		"pc:total",
+		"bare-app:0",
+		"copy:bare-app",
+		"bare-app:total",
+	})
+}
@@ -0,0 +1,155 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package seedwriter
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/snapcore/snapd/snap/naming"
+)
+
+// DownloadSnap describes a snap to download in the JSON output of
+// Writer.SnapsToDownloadJSON.
+type DownloadSnap struct {
+	Name   string `json:"name"`
+	SnapID string `json:"snap-id,omitempty"`
+	// Channel is the channel to download the snap from
+	Channel string `json:"channel"`
+	// Components are the references (<snap>+<component>) of the
+	// components to download together with the snap
+	Components []string `json:"components,omitempty"`
+	// Essential is set for the essential snaps of the model
+	Essential bool `json:"essential"`
+}
+
+type downloadSnaps struct {
+	Snaps []*DownloadSnap `json:"snaps"`
+}
+
+// SnapsToDownloadJSON is like SnapsToDownload but returns the snaps to
+// download serialized as JSON, an object with a "snaps" list of
+// DownloadSnap entries. This is meant for driving the downloads from a
+// separate process, the SeedSnaps to pass to SetInfo can then be
+// retrieved with SeedSnapForDownload.
+func (w *Writer) SnapsToDownloadJSON() ([]byte, error) {
+	snaps, err := w.SnapsToDownload()
+	if err != nil {
+		return nil, err
+	}
+
+	ds := downloadSnaps{Snaps: make([]*DownloadSnap, 0, len(snaps))}
+	for _, sn := range snaps {
+		var comps []string
+		for _, comp := range sn.Components {
+			comps = append(comps, comp.ComponentRef.String())
+		}
+		ds.Snaps = append(ds.Snaps, &DownloadSnap{
+			Name:       sn.SnapName(),
+			SnapID:     sn.ID(),
+			Channel:    sn.Channel,
+			Components: comps,
+			Essential:  w.isEssential(sn),
+		})
+	}
+	return json.Marshal(&ds)
+}
+
+// ParseSnapsToDownloadJSON parses the output of
+// Writer.SnapsToDownloadJSON.
+func ParseSnapsToDownloadJSON(data []byte) ([]*DownloadSnap, error) {
+	var ds downloadSnaps
+	if err := json.Unmarshal(data, &ds); err != nil {
+		return nil, fmt.Errorf("cannot parse snaps to download: %v", err)
+	}
+	for _, d := range ds.Snaps {
+		if err := naming.ValidateSnap(d.Name); err != nil {
+			return nil, fmt.Errorf("cannot parse snaps to download: %v", err)
+		}
+		for _, comp := range d.Components {
+			snapName, compName, err := naming.SplitFullComponentName(comp)
+			if err == nil {
+				err = naming.NewComponentRef(snapName, compName).Validate()
+			}
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse snaps to download: %v", err)
+			}
+			if snapName != d.Name {
+				return nil, fmt.Errorf("cannot parse snaps to download: component %q does not belong to snap %q", comp, d.Name)
+			}
+		}
+	}
+	return ds.Snaps, nil
+}
+
+// SeedSnapForDownload returns the SeedSnap matching the given entry
+// among the ones returned by the last call to SnapsToDownloadJSON.
+func (w *Writer) SeedSnapForDownload(d *DownloadSnap) (*SeedSnap, error) {
+	ref := naming.NewSnapRef(d.Name, d.SnapID)
+	for _, sn := range w.pendingDownloads {
+		if naming.SameSnap(sn, ref) {
+			return sn, nil
+		}
+	}
+	return nil, fmt.Errorf("snap %q is not pending download", d.Name)
+}
+
+// EstimatedDownloadSize returns the total size in bytes of the snaps
+// and components returned by the last call to SnapsToDownload, as per
+// their DownloadInfo. It can be invoked only after SetInfo was called
+// for all of them and before Downloaded, it errors if any of the sizes
+// is unknown.
+func (w *Writer) EstimatedDownloadSize() (int64, error) {
+	if w.expectedStep != downloadedStep {
+		return 0, fmt.Errorf("internal error: seedwriter.Writer cannot estimate the download size before SnapsToDownload or after Downloaded")
+	}
+	var total int64
+	for _, sn := range w.pendingDownloads {
+		if sn.Info == nil || sn.Info.Size == 0 {
+			return 0, fmt.Errorf("cannot estimate download size: size of snap %q is unknown", sn.SnapName())
+		}
+		total += sn.Info.Size
+		for _, comp := range sn.Components {
+			if comp.DownloadInfo.Size == 0 {
+				return 0, fmt.Errorf("cannot estimate download size: size of component %q is unknown", comp.ComponentRef)
+			}
+			total += comp.DownloadInfo.Size
+		}
+	}
+	return total, nil
+}
+
+// isEssential returns whether the seed snap is one of the essential
+// snaps of the model, including the implicit system snap.
+func (w *Writer) isEssential(sn *SeedSnap) bool {
+	if sn.modelSnap == nil {
+		return false
+	}
+	switch sn.modelSnap.SnapType {
+	case "snapd", "core":
+		return true
+	}
+	for _, modSnap := range w.model.EssentialSnaps() {
+		if modSnap == sn.modelSnap {
+			return true
+		}
+	}
+	return false
+}
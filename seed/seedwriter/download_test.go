@@ -0,0 +1,212 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package seedwriter_test
+
+import (
+	"fmt"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/seed/seedtest"
+	"github.com/snapcore/snapd/seed/seedwriter"
+	"github.com/snapcore/snapd/snap"
+)
+
+func (s *writerSuite) TestSnapsToDownloadJSON(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core20",
+		"grade":        "dangerous",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name": "required20",
+				"id":   s.AssertedSnapID("required20"),
+				"components": map[string]any{
+					"comp1": "required",
+				},
+			},
+		},
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.MakeAssertedSnapWithComps(c, seedtest.SampleSnapYaml["required20"], nil,
+		snap.R(21), map[string]snap.Revision{"comp1": snap.R(22), "comp2": snap.R(33)}, "canonical", s.StoreSigning.Database)
+
+	s.opts.Label = "20260101"
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+	c.Assert(w.Start(s.db, s.rf), IsNil)
+	_, err = w.LocalSnaps()
+	c.Assert(err, IsNil)
+	c.Assert(w.InfoDerived(), IsNil)
+
+	data, err := w.SnapsToDownloadJSON()
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, fmt.Sprintf(`{"snaps":[`+
+		`{"name":"snapd","snap-id":%q,"channel":"latest/stable","essential":true},`+
+		`{"name":"pc-kernel","snap-id":%q,"channel":"20","essential":true},`+
+		`{"name":"core20","snap-id":%q,"channel":"latest/stable","essential":true},`+
+		`{"name":"pc","snap-id":%q,"channel":"20","essential":true},`+
+		`{"name":"required20","snap-id":%q,"channel":"latest/stable","components":["required20+comp1"],"essential":false}]}`,
+		s.AssertedSnapID("snapd"), s.AssertedSnapID("pc-kernel"), s.AssertedSnapID("core20"),
+		s.AssertedSnapID("pc"), s.AssertedSnapID("required20")))
+
+	toDownload, err := seedwriter.ParseSnapsToDownloadJSON(data)
+	c.Assert(err, IsNil)
+	c.Assert(toDownload, HasLen, 5)
+	c.Check(toDownload[4], DeepEquals, &seedwriter.DownloadSnap{
+		Name:       "required20",
+		SnapID:     s.AssertedSnapID("required20"),
+		Channel:    "latest/stable",
+		Components: []string{"required20+comp1"},
+	})
+
+	// the entries are matched back to the seed snaps of the writer
+	for _, d := range toDownload {
+		sn, err := w.SeedSnapForDownload(d)
+		c.Assert(err, IsNil)
+		c.Check(sn.SnapName(), Equals, d.Name)
+		s.fillDownloadedSnap(c, w, sn)
+	}
+
+	complete, err := w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	_, err = w.SeedSnapForDownload(&seedwriter.DownloadSnap{Name: "other"})
+	c.Check(err, ErrorMatches, `snap "other" is not pending download`)
+}
+
+func (s *writerSuite) TestParseSnapsToDownloadJSONErrors(c *C) {
+	tests := []struct {
+		data string
+		err  string
+	}{
+		{`{"snaps":`, `cannot parse snaps to download: unexpected end of JSON input`},
+		{`{"snaps":[{"name":"-foo"}]}`, `cannot parse snaps to download: invalid snap name: "-foo"`},
+		{`{"snaps":[{"name":"foo","components":["foo"]}]}`, `cannot parse snaps to download: incorrect component name "foo"`},
+		{`{"snaps":[{"name":"foo","components":["bar+comp"]}]}`, `cannot parse snaps to download: component "bar\+comp" does not belong to snap "foo"`},
+	}
+	for _, t := range tests {
+		_, err := seedwriter.ParseSnapsToDownloadJSON([]byte(t.data))
+		c.Check(err, ErrorMatches, t.err, Commentf(t.data))
+	}
+}
+
+func (s *writerSuite) TestEstimatedDownloadSize(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core20",
+		"grade":        "dangerous",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name": "required20",
+				"id":   s.AssertedSnapID("required20"),
+				"components": map[string]any{
+					"comp1": "required",
+				},
+			},
+		},
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.MakeAssertedSnapWithComps(c, seedtest.SampleSnapYaml["required20"], nil,
+		snap.R(21), map[string]snap.Revision{"comp1": snap.R(22), "comp2": snap.R(33)}, "canonical", s.StoreSigning.Database)
+
+	s.opts.Label = "20260101"
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+	c.Assert(w.Start(s.db, s.rf), IsNil)
+	_, err = w.LocalSnaps()
+	c.Assert(err, IsNil)
+	c.Assert(w.InfoDerived(), IsNil)
+
+	_, err = w.EstimatedDownloadSize()
+	c.Check(err, ErrorMatches, `internal error: seedwriter.Writer cannot estimate the download size before SnapsToDownload or after Downloaded`)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 5)
+
+	// nothing is known before SetInfo
+	_, err = w.EstimatedDownloadSize()
+	c.Check(err, ErrorMatches, `cannot estimate download size: size of snap "snapd" is unknown`)
+
+	var expected int64
+	for _, sn := range snaps {
+		info := *s.AssertedSnapInfo(sn.SnapName())
+		info.Size = int64(len(sn.SnapName())) * 1000
+		expected += info.Size
+		seedComps := make(map[string]*seedwriter.SeedComponent)
+		for i, res := range s.AssertedSnapComponents(sn.SnapName()) {
+			cinfo := s.AssertedComponentInfos(sn.SnapName())[i]
+			seedComps[res.Name] = &seedwriter.SeedComponent{
+				ComponentRef: cinfo.Component,
+				Info:         cinfo,
+				DownloadInfo: res.DownloadInfo,
+			}
+			if res.Name == "comp1" {
+				expected += res.DownloadInfo.Size
+			}
+		}
+		c.Assert(w.SetInfo(sn, &info, seedComps), IsNil)
+	}
+
+	size, err := w.EstimatedDownloadSize()
+	c.Assert(err, IsNil)
+	c.Check(size, Equals, expected)
+
+	// a component with an unknown size
+	snaps[4].Components[0].DownloadInfo.Size = 0
+	_, err = w.EstimatedDownloadSize()
+	c.Check(err, ErrorMatches, `cannot estimate download size: size of component "required20\+comp1" is unknown`)
+}
@@ -20,6 +20,8 @@
 package seedwriter
 
 import (
+	"time"
+
 	"github.com/snapcore/snapd/seed/internal"
 )
 
@@ -32,3 +34,11 @@ var (
 	InternalReadSeedYaml  = internal.ReadSeedYaml
 	InternalReadOptions20 = internal.ReadOptions20
 )
+
+func MockTimeNow(f func() time.Time) (restore func()) {
+	old := timeNow
+	timeNow = f
+	return func() {
+		timeNow = old
+	}
+}
@@ -37,6 +37,7 @@ type SeedAssertionFetcher interface {
 	Refs() []*asserts.Ref
 	ResetRefs()
 	AddExtraAssertions(extraAssertions []asserts.Assertion)
+	AddPrefetchedAssertions(prefetched []asserts.Assertion)
 }
 
 type assertionFetcher struct {
@@ -44,9 +45,17 @@ type assertionFetcher struct {
 	refs    []*asserts.Ref
 
 	extraAssertions []asserts.Assertion
+	// prefetched holds assertions available without a round-trip to
+	// the store, keyed by their unique reference
+	prefetched map[string]asserts.Assertion
 }
 
 func (af *assertionFetcher) Fetch(ref *asserts.Ref) error {
+	// use a prefetched assertion if there is one, it is still
+	// verified when saved
+	if a := af.prefetched[ref.Unique()]; a != nil {
+		return af.Save(a)
+	}
 	return af.fetcher.Fetch(ref)
 }
 
@@ -78,6 +87,14 @@ func (af *assertionFetcher) Save(a asserts.Assertion) error {
 			}
 		}
 	}
+	// Likewise prefer prefetched assertions for the prerequisites
+	for _, prerequisite := range a.Prerequisites() {
+		if prefetched := af.prefetched[prerequisite.Unique()]; prefetched != nil {
+			if err := af.Save(prefetched); err != nil {
+				return fmt.Errorf("prerequisite prefetched assertion: %s", err)
+			}
+		}
+	}
 
 	return af.fetcher.Save(a)
 }
@@ -94,6 +111,15 @@ func (af *assertionFetcher) AddExtraAssertions(extraAssertions []asserts.Asserti
 	af.extraAssertions = append(af.extraAssertions, extraAssertions...)
 }
 
+func (af *assertionFetcher) AddPrefetchedAssertions(prefetched []asserts.Assertion) {
+	if af.prefetched == nil {
+		af.prefetched = make(map[string]asserts.Assertion, len(prefetched))
+	}
+	for _, a := range prefetched {
+		af.prefetched[a.Ref().Unique()] = a
+	}
+}
+
 // A NewFetcherFunc can build a Fetcher saving to an (implicit)
 // database and also calling the given additional save function.
 type NewFetcherFunc func(save func(asserts.Assertion) error) asserts.Fetcher
@@ -20,6 +20,8 @@
 package seedwriter_test
 
 import (
+	"errors"
+	"strings"
 	"time"
 
 	. "gopkg.in/check.v1"
@@ -221,3 +223,106 @@ func (s *fetcherSuite) TestAssertFetcherSaveExtraAssertions(c *C) {
 	c.Check(af.Refs()[2].String(), Equals, "account (other-brand)")
 	c.Check(af.Refs()[3].String(), Equals, "store (my-proxy-store)")
 }
+
+func (s *fetcherSuite) signSnapAssertions(c *C, signing assertstest.SignerDB) (snapDecl, snapRev asserts.Assertion) {
+	snapDecl, err := signing.Sign(asserts.SnapDeclarationType, map[string]any{
+		"series":       "16",
+		"snap-id":      "foo-id",
+		"snap-name":    "foo",
+		"publisher-id": "can0nical",
+		"timestamp":    time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	snapRev, err = signing.Sign(asserts.SnapRevisionType, map[string]any{
+		"snap-sha3-384": strings.Repeat("a", 64),
+		"snap-id":       "foo-id",
+		"snap-size":     "1000",
+		"snap-revision": "1",
+		"developer-id":  "can0nical",
+		"timestamp":     time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	return snapDecl, snapRev
+}
+
+func (s *fetcherSuite) TestAssertFetcherPrefetchedAssertions(c *C) {
+	db, err := asserts.OpenDatabase(&asserts.DatabaseConfig{
+		Backstore: asserts.NewMemoryBackstore(),
+		Trusted:   s.storeSigning.Trusted,
+	})
+	c.Assert(err, IsNil)
+
+	var retrieved []string
+	retrieve := func(ref *asserts.Ref) (asserts.Assertion, error) {
+		retrieved = append(retrieved, ref.Type.Name)
+		return ref.Resolve(s.storeSigning.Find)
+	}
+	newFetcher := func(save func(asserts.Assertion) error) asserts.Fetcher {
+		save2 := func(a asserts.Assertion) error {
+			// this verifies the assertion
+			if err := db.Add(a); err != nil {
+				return err
+			}
+			return save(a)
+		}
+		return asserts.NewFetcher(db, retrieve, save2)
+	}
+
+	// the snap assertions are not available from the store
+	snapDecl, snapRev := s.signSnapAssertions(c, s.storeSigning)
+
+	af := seedwriter.MakeSeedAssertionFetcher(newFetcher)
+	af.AddPrefetchedAssertions([]asserts.Assertion{snapDecl, snapRev})
+
+	err = af.Fetch(snapRev.Ref())
+	c.Assert(err, IsNil)
+	c.Check(retrieved, Not(testutil.Contains), "snap-declaration")
+	c.Check(retrieved, Not(testutil.Contains), "snap-revision")
+
+	var refs []string
+	for _, ref := range af.Refs() {
+		refs = append(refs, ref.Type.Name)
+	}
+	c.Check(refs, DeepEquals, []string{"account-key", "snap-declaration", "snap-revision"})
+
+	_, err = snapRev.Ref().Resolve(db.Find)
+	c.Check(err, IsNil)
+}
+
+func (s *fetcherSuite) TestAssertFetcherPrefetchedAssertionsUntrusted(c *C) {
+	db, err := asserts.OpenDatabase(&asserts.DatabaseConfig{
+		Backstore: asserts.NewMemoryBackstore(),
+		Trusted:   s.storeSigning.Trusted,
+	})
+	c.Assert(err, IsNil)
+
+	retrieve := func(ref *asserts.Ref) (asserts.Assertion, error) {
+		return ref.Resolve(s.storeSigning.Find)
+	}
+	newFetcher := func(save func(asserts.Assertion) error) asserts.Fetcher {
+		save2 := func(a asserts.Assertion) error {
+			// this verifies the assertion
+			if err := db.Add(a); err != nil {
+				return err
+			}
+			return save(a)
+		}
+		return asserts.NewFetcher(db, retrieve, save2)
+	}
+
+	// signed by keys that are not trusted
+	otherKey, _ := assertstest.GenerateKey(752)
+	otherSigning := assertstest.NewSigningDB("can0nical", otherKey)
+	snapDecl, snapRev := s.signSnapAssertions(c, otherSigning)
+
+	af := seedwriter.MakeSeedAssertionFetcher(newFetcher)
+	af.AddPrefetchedAssertions([]asserts.Assertion{snapDecl, snapRev})
+
+	err = af.Fetch(snapRev.Ref())
+	c.Assert(err, NotNil)
+
+	_, err = snapRev.Ref().Resolve(db.Find)
+	c.Check(errors.Is(err, &asserts.NotFoundError{}), Equals, true)
+	_, err = snapDecl.Ref().Resolve(db.Find)
+	c.Check(errors.Is(err, &asserts.NotFoundError{}), Equals, true)
+}
@@ -0,0 +1,117 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package seedwriter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/snapcore/snapd/gadget"
+	"github.com/snapcore/snapd/snap"
+)
+
+// GadgetDefaults returns the default configuration from the gadget.yaml
+// of the gadget snap of the seed, keyed by "system" or by the snap-id of
+// the snap it applies to, each value being a map of configuration
+// options. It returns nil if the seed has no gadget snap or the gadget
+// has no defaults. It can be invoked only after Downloaded returns
+// complete == true.
+func (w *Writer) GadgetDefaults() (map[string]any, error) {
+	if err := w.checkSnapsAccessor(); err != nil {
+		return nil, err
+	}
+	defaults, err := w.readGadgetDefaults()
+	if err != nil {
+		return nil, err
+	}
+	if len(defaults) == 0 {
+		return nil, nil
+	}
+	res := make(map[string]any, len(defaults))
+	for key, dflt := range defaults {
+		res[key] = dflt
+	}
+	return res, nil
+}
+
+// readGadgetDefaults reads, once, the defaults from the gadget.yaml of
+// the gadget snap of the seed if any.
+func (w *Writer) readGadgetDefaults() (map[string]map[string]any, error) {
+	if w.gadgetDefaultsRead {
+		return w.gadgetDefaults, nil
+	}
+
+	var gadgetSnap *SeedSnap
+	for _, sn := range w.snapsFromModel {
+		if sn.Info.Type() == snap.TypeGadget {
+			gadgetSnap = sn
+			break
+		}
+	}
+	if gadgetSnap != nil {
+		path := gadgetSnap.Path
+		if w.opts.SnapPoolDir != "" && !gadgetSnap.local {
+			path = w.poolPath(path)
+		}
+		cont, err := w.opts.openSnap(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read defaults of gadget %q: %v", gadgetSnap.SnapName(), err)
+		}
+		// only the defaults are of interest, volumes are checked
+		// elsewhere against the model
+		ginfo, err := gadget.ReadInfoFromSnapFileNoValidate(cont, nil)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read defaults of gadget %q: %v", gadgetSnap.SnapName(), err)
+		}
+		w.gadgetDefaults = ginfo.Defaults
+	}
+	w.gadgetDefaultsRead = true
+	return w.gadgetDefaults, nil
+}
+
+// checkGadgetDefaults checks that the snaps the gadget defaults are for
+// are part of the seed.
+func (w *Writer) checkGadgetDefaults() error {
+	defaults, err := w.readGadgetDefaults()
+	if err != nil {
+		return err
+	}
+	seeded := make(map[string]bool)
+	for _, snaps := range [][]*SeedSnap{w.snapsFromModel, w.extraSnaps} {
+		for _, sn := range snaps {
+			if id := sn.Info.ID(); id != "" {
+				seeded[id] = true
+			}
+		}
+	}
+	var missing []string
+	for key := range defaults {
+		if key == "system" || seeded[key] {
+			continue
+		}
+		missing = append(missing, key)
+	}
+	if len(missing) != 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("gadget defaults are for snaps that are not part of the seed: snap-ids %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -85,6 +85,22 @@ func checkType(sn *SeedSnap, model *asserts.Model) error {
 	return nil
 }
 
+// checkArchitecture checks that the snap supports the given seed
+// architecture, independently of the architecture of the host writing
+// the seed. Nothing is checked if the architecture is unknown.
+func checkArchitecture(sn *SeedSnap, seedArch string) error {
+	if seedArch == "" {
+		return nil
+	}
+	for _, a := range sn.Info.Architectures {
+		if a == "all" || a == seedArch {
+			return nil
+		}
+	}
+	return fmt.Errorf("snap %q supported architectures (%s) are incompatible with the model architecture (%s)",
+		sn.SnapName(), strings.Join(sn.Info.Architectures, ", "), seedArch)
+}
+
 func errorMsgForModesSuffix(modes []string) string {
 	if len(modes) == 1 && modes[0] == "run" {
 		return ""
@@ -106,16 +122,24 @@ func (s seedSnapsByType) Less(i, j int) bool {
 // model is used to cross check that the found snap-revision is applicable
 // on the device.
 func DeriveSideInfo(snapPath string, model *asserts.Model, sf SeedAssertionFetcher, db asserts.RODatabase) (*snap.SideInfo, []*asserts.Ref, error) {
-	digest, size, err := asserts.SnapFileSHA3_384(snapPath)
-	if err != nil {
-		return nil, nil, err
-	}
 	// XXX assume that the input to the writer is trusted or the whole
 	// build is isolated
 	snapf, err := snapfile.Open(snapPath)
 	if err != nil {
 		return nil, nil, err
 	}
+	return DeriveSideInfoFromContainer(snapPath, snapf, model, sf, db)
+}
+
+// DeriveSideInfoFromContainer is like DeriveSideInfo but uses the given
+// already opened snapf to read the snap metadata, e.g. as returned by
+// Writer.OpenSnap. The digest is still computed over the file at
+// snapPath.
+func DeriveSideInfoFromContainer(snapPath string, snapf snap.Container, model *asserts.Model, sf SeedAssertionFetcher, db asserts.RODatabase) (*snap.SideInfo, []*asserts.Ref, error) {
+	digest, size, err := asserts.SnapFileSHA3_384(snapPath)
+	if err != nil {
+		return nil, nil, err
+	}
 	info, err := snap.ReadInfoFromSnapFile(snapf, nil)
 	if err != nil {
 		return nil, nil, err
@@ -169,3 +193,17 @@ func DeriveComponentSideInfo(compPath string, compInfo *snap.ComponentInfo, info
 
 	return csi, sf.Refs()[prev:], nil
 }
+
+// checkPinnedComponents checks that the components of a seed snap that
+// are pinned to a revision were fetched at that revision.
+func checkPinnedComponents(sn *SeedSnap) error {
+	for _, comp := range sn.Components {
+		if comp.Revision.Unset() || comp.Info == nil {
+			continue
+		}
+		if comp.Info.Revision != comp.Revision {
+			return fmt.Errorf("cannot use component %s revision %s: pinned to revision %s", comp.ComponentRef, comp.Info.Revision, comp.Revision)
+		}
+	}
+	return nil
+}
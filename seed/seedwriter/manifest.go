@@ -32,6 +32,7 @@ import (
 	"github.com/snapcore/snapd/asserts/snapasserts"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/naming"
 	"github.com/snapcore/snapd/strutil"
 )
 
@@ -46,6 +47,17 @@ func (s *ManifestSnapRevision) String() string {
 	return fmt.Sprintf("%s %s", s.SnapName, s.Revision)
 }
 
+// ManifestComponentRevision represents a component revision as noted
+// in the seed manifest.
+type ManifestComponentRevision struct {
+	Component naming.ComponentRef
+	Revision  snap.Revision
+}
+
+func (c *ManifestComponentRevision) String() string {
+	return fmt.Sprintf("%s %s", c.Component, c.Revision)
+}
+
 // ManifestValidationSet represents a validation set as noted
 // in the seed manifest. A validation set can optionally be pinned,
 // but the sequence will always be set to the sequence that was used
@@ -92,19 +104,25 @@ func (vs *ManifestValidationSet) hasSnap(snapName string) bool {
 // <account-id>/<name>=<sequence>
 // <account-id>/<name> <sequence>
 // <snap-name> <snap-revision>
+// <snap-name>+<component-name> <component-revision>
+// Components are grouped immediately under the snap they belong to.
 type Manifest struct {
-	revsAllowed map[string]*ManifestSnapRevision
-	revsSeeded  map[string]*ManifestSnapRevision
-	vsAllowed   map[string]*ManifestValidationSet
-	vsSeeded    map[string]*ManifestValidationSet
+	revsAllowed  map[string]*ManifestSnapRevision
+	revsSeeded   map[string]*ManifestSnapRevision
+	compsAllowed map[string]*ManifestComponentRevision
+	compsSeeded  map[string]*ManifestComponentRevision
+	vsAllowed    map[string]*ManifestValidationSet
+	vsSeeded     map[string]*ManifestValidationSet
 }
 
 func NewManifest() *Manifest {
 	return &Manifest{
-		revsAllowed: make(map[string]*ManifestSnapRevision),
-		revsSeeded:  make(map[string]*ManifestSnapRevision),
-		vsAllowed:   make(map[string]*ManifestValidationSet),
-		vsSeeded:    make(map[string]*ManifestValidationSet),
+		revsAllowed:  make(map[string]*ManifestSnapRevision),
+		revsSeeded:   make(map[string]*ManifestSnapRevision),
+		compsAllowed: make(map[string]*ManifestComponentRevision),
+		compsSeeded:  make(map[string]*ManifestComponentRevision),
+		vsAllowed:    make(map[string]*ManifestValidationSet),
+		vsSeeded:     make(map[string]*ManifestValidationSet),
 	}
 }
 
@@ -128,6 +146,19 @@ func MockManifest(revsAllowed, revsSeeded map[string]*ManifestSnapRevision, vsAl
 	return sm
 }
 
+// MockManifestComponents is stricly for unit tests, do not use for non-test
+// code. It sets the allowed and seeded component revisions of the manifest.
+func MockManifestComponents(sm *Manifest, compsAllowed, compsSeeded map[string]*ManifestComponentRevision) {
+	osutil.MustBeTestBinary("MockManifestComponents can only be used in unit tests")
+
+	if compsAllowed != nil {
+		sm.compsAllowed = compsAllowed
+	}
+	if compsSeeded != nil {
+		sm.compsSeeded = compsSeeded
+	}
+}
+
 func (sm *Manifest) isControlledByValidationSet(snapName string) bool {
 	for _, vs := range sm.vsSeeded {
 		if vs.hasSnap(snapName) {
@@ -159,6 +190,25 @@ func (sm *Manifest) SetAllowedSnapRevision(snapName string, revision snap.Revisi
 	return nil
 }
 
+// SetAllowedComponentRevision adds a revision rule for the given component
+// of the given snap, meaning that any component marked seeded through
+// MarkComponentRevisionSeeded will be validated against this rule. As for
+// snaps, only the first rule for a given component is kept.
+func (sm *Manifest) SetAllowedComponentRevision(snapName, compName string, revision snap.Revision) error {
+	cref := naming.NewComponentRef(snapName, compName)
+	if revision.Unset() {
+		return fmt.Errorf("component revision for %q in manifest cannot be 0 (unset)", cref)
+	}
+
+	if _, ok := sm.compsAllowed[cref.String()]; !ok {
+		sm.compsAllowed[cref.String()] = &ManifestComponentRevision{
+			Component: cref,
+			Revision:  revision,
+		}
+	}
+	return nil
+}
+
 // SetAllowedValidationSet adds a sequence rule for the given validation set, meaning
 // that any validation set marked for use through MarkValidationSetUsed must match the
 // given parameters. The manifest will only allow one sequence per validation set,
@@ -206,6 +256,34 @@ func (sm *Manifest) MarkSnapRevisionSeeded(snapName string, revision snap.Revisi
 	return nil
 }
 
+// MarkComponentRevisionSeeded attempts to mark a revision of the given
+// component of the given snap as seeded in the manifest. The seeded revision
+// will be validated against any previously allowed revision for the
+// component.
+func (sm *Manifest) MarkComponentRevisionSeeded(snapName, compName string, revision snap.Revision) error {
+	cref := naming.NewComponentRef(snapName, compName)
+	key := cref.String()
+	if rev, ok := sm.compsAllowed[key]; ok {
+		// Allowed revision specified, it must match.
+		if rev.Revision != revision {
+			return fmt.Errorf("component %q (%s) does not match the allowed revision %s",
+				key, revision, rev.Revision)
+		}
+	}
+
+	if rev, ok := sm.compsSeeded[key]; ok {
+		// Already marked as seeding.
+		return fmt.Errorf("cannot mark %q (%s) as seeded, it has already been marked seeded for revision %s",
+			key, revision, rev.Revision)
+	}
+
+	sm.compsSeeded[key] = &ManifestComponentRevision{
+		Component: cref,
+		Revision:  revision,
+	}
+	return nil
+}
+
 // MarkValidationSetSeeded marks a validation-set as seeded. It verifies against any previously
 // set rules by SetAllowedValidationSet, and sets up new rules based on the snaps defined in the
 // validation set.
@@ -263,6 +341,41 @@ func (sm *Manifest) AllowedSnapRevision(snapName string) snap.Revision {
 	return snap.Revision{}
 }
 
+// AllowedComponentRevision retrieves any specified revision rule for the
+// component.
+func (sm *Manifest) AllowedComponentRevision(cref naming.ComponentRef) snap.Revision {
+	if rev, ok := sm.compsAllowed[cref.String()]; ok {
+		return rev.Revision
+	}
+	return snap.Revision{}
+}
+
+// AllowedSnapRevisions returns the snap revisions specified as allowed,
+// sorted by snap name.
+func (sm *Manifest) AllowedSnapRevisions() []*ManifestSnapRevision {
+	revs := make([]*ManifestSnapRevision, 0, len(sm.revsAllowed))
+	for _, rev := range sm.revsAllowed {
+		revs = append(revs, rev)
+	}
+	sort.Slice(revs, func(i, j int) bool {
+		return revs[i].SnapName < revs[j].SnapName
+	})
+	return revs
+}
+
+// AllowedComponentRevisions returns the component revisions specified as
+// allowed, sorted by component.
+func (sm *Manifest) AllowedComponentRevisions() []*ManifestComponentRevision {
+	revs := make([]*ManifestComponentRevision, 0, len(sm.compsAllowed))
+	for _, rev := range sm.compsAllowed {
+		revs = append(revs, rev)
+	}
+	sort.Slice(revs, func(i, j int) bool {
+		return revs[i].Component.String() < revs[j].Component.String()
+	})
+	return revs
+}
+
 // AllowedValidationSets returns the validation sets specified as allowed.
 func (sm *Manifest) AllowedValidationSets() []*ManifestValidationSet {
 	var vss []*ManifestValidationSet
@@ -309,6 +422,23 @@ func parseSnapRevision(sm *Manifest, sn, revStr string) error {
 	return sm.SetAllowedSnapRevision(sn, rev)
 }
 
+func parseComponentRevision(sm *Manifest, comp, revStr string) error {
+	snapName, compName, err := naming.SplitFullComponentName(comp)
+	if err != nil {
+		return err
+	}
+	cref := naming.NewComponentRef(snapName, compName)
+	if err := cref.Validate(); err != nil {
+		return err
+	}
+
+	rev, err := snap.ParseRevision(revStr)
+	if err != nil {
+		return err
+	}
+	return sm.SetAllowedComponentRevision(snapName, compName, rev)
+}
+
 // ReadManifest reads a seed.manifest previously generated by Manifest.Write
 // and returns a new Manifest structure reflecting the contents.
 func ReadManifest(manifestFile string) (*Manifest, error) {
@@ -342,6 +472,11 @@ func ReadManifest(manifestFile string) (*Manifest, error) {
 			if err := parseUnpinnedValidationSet(sm, tokens[0], tokens[1]); err != nil {
 				return nil, err
 			}
+		case len(tokens) == 2 && strings.Contains(tokens[0], "+"):
+			// Component revision: <snap>+<component> <revision>
+			if err := parseComponentRevision(sm, tokens[0], tokens[1]); err != nil {
+				return nil, err
+			}
 		case len(tokens) == 2:
 			// Snap revision: <snap> <revision>
 			if err := parseSnapRevision(sm, tokens[0], tokens[1]); err != nil {
@@ -360,8 +495,11 @@ func ReadManifest(manifestFile string) (*Manifest, error) {
 
 // Write generates the seed.manifest contents from the provided map of
 // snaps and their revisions, and stores them in the given file path.
+// Validation sets are written first, followed by the snaps sorted by
+// name, each immediately followed by its components sorted by component
+// name.
 func (sm *Manifest) Write(filePath string) error {
-	if len(sm.revsSeeded) == 0 && len(sm.vsSeeded) == 0 {
+	if len(sm.revsSeeded) == 0 && len(sm.compsSeeded) == 0 && len(sm.vsSeeded) == 0 {
 		return nil
 	}
 
@@ -371,23 +509,43 @@ func (sm *Manifest) Write(filePath string) error {
 	}
 	sort.Strings(vsKeys)
 
-	// Get the keys for the seeded snap revision map, and also
-	// sort them by name for consistent output. At this stage we
-	// also filter out snaps that are controlled by validation-sets.
-	revisionKeys := make([]string, 0, len(sm.revsSeeded))
+	// Group the seeded components by their snap, sorted by
+	// component name for consistent output.
+	compsBySnap := make(map[string][]*ManifestComponentRevision)
+	for _, c := range sm.compsSeeded {
+		compsBySnap[c.Component.SnapName] = append(compsBySnap[c.Component.SnapName], c)
+	}
+	for _, comps := range compsBySnap {
+		sort.Slice(comps, func(i, j int) bool {
+			return comps[i].Component.ComponentName < comps[j].Component.ComponentName
+		})
+	}
+
+	// Get the names of all snaps with a seeded revision or seeded
+	// components, and sort them by name for consistent output.
+	snapNames := make([]string, 0, len(sm.revsSeeded))
 	for k := range sm.revsSeeded {
-		if !sm.isControlledByValidationSet(k) {
-			revisionKeys = append(revisionKeys, k)
+		snapNames = append(snapNames, k)
+	}
+	for k := range compsBySnap {
+		if _, ok := sm.revsSeeded[k]; !ok {
+			snapNames = append(snapNames, k)
 		}
 	}
-	sort.Strings(revisionKeys)
+	sort.Strings(snapNames)
 
 	buf := bytes.NewBuffer(nil)
 	for _, key := range vsKeys {
 		fmt.Fprintf(buf, "%s\n", sm.vsSeeded[key])
 	}
-	for _, key := range revisionKeys {
-		fmt.Fprintf(buf, "%s\n", sm.revsSeeded[key])
+	for _, name := range snapNames {
+		// Filter out snaps that are controlled by validation-sets.
+		if rev, ok := sm.revsSeeded[name]; ok && !sm.isControlledByValidationSet(name) {
+			fmt.Fprintf(buf, "%s\n", rev)
+		}
+		for _, c := range compsBySnap[name] {
+			fmt.Fprintf(buf, "%s\n", c)
+		}
 	}
 	return os.WriteFile(filePath, buf.Bytes(), 0755)
 }
@@ -31,6 +31,7 @@ import (
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/seed/seedwriter"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/naming"
 	"github.com/snapcore/snapd/testutil"
 )
 
@@ -99,6 +100,9 @@ func (s *manifestSuite) TestReadManifestParseFails(c *C) {
 		{"core\n", `cannot parse line: "core"`},
 		{" test\n", `line cannot start with any spaces: " test"`},
 		{"core 14 14\n", `cannot parse line: "core 14 14"`},
+		{"core+comp+x 3\n", `incorrect component name "core\+comp\+x"`},
+		{"core+Comp 3\n", `invalid snap name: "Comp"`},
+		{"core+comp 0\n", `invalid snap revision: "0"`},
 	}
 
 	for _, t := range tests {
@@ -108,6 +112,53 @@ func (s *manifestSuite) TestReadManifestParseFails(c *C) {
 	}
 }
 
+func (s *manifestSuite) TestReadManifestComponents(c *C) {
+	manifestFile := s.writeManifest(c, `core22 275
+one-snap 12
+one-snap+comp-a 4
+one-snap+comp-b x2
+pc 128
+`)
+	manifest, err := seedwriter.ReadManifest(manifestFile)
+	c.Assert(err, IsNil)
+	expected := seedwriter.MockManifest(map[string]*seedwriter.ManifestSnapRevision{
+		"core22":   {SnapName: "core22", Revision: snap.R(275)},
+		"one-snap": {SnapName: "one-snap", Revision: snap.R(12)},
+		"pc":       {SnapName: "pc", Revision: snap.R(128)},
+	}, nil, nil, nil)
+	seedwriter.MockManifestComponents(expected, map[string]*seedwriter.ManifestComponentRevision{
+		"one-snap+comp-a": {Component: naming.NewComponentRef("one-snap", "comp-a"), Revision: snap.R(4)},
+		"one-snap+comp-b": {Component: naming.NewComponentRef("one-snap", "comp-b"), Revision: snap.R(-2)},
+	}, nil)
+	c.Check(manifest, DeepEquals, expected)
+	c.Check(manifest.AllowedComponentRevision(naming.NewComponentRef("one-snap", "comp-a")), Equals, snap.R(4))
+	c.Check(manifest.AllowedComponentRevision(naming.NewComponentRef("one-snap", "comp-c")), Equals, snap.Revision{})
+}
+
+func (s *manifestSuite) TestAllowedSnapAndComponentRevisions(c *C) {
+	manifestFile := s.writeManifest(c, `pc 128
+one-snap 12
+one-snap+comp-b x2
+one-snap+comp-a 4
+core22 275
+`)
+	manifest, err := seedwriter.ReadManifest(manifestFile)
+	c.Assert(err, IsNil)
+	c.Check(manifest.AllowedSnapRevisions(), DeepEquals, []*seedwriter.ManifestSnapRevision{
+		{SnapName: "core22", Revision: snap.R(275)},
+		{SnapName: "one-snap", Revision: snap.R(12)},
+		{SnapName: "pc", Revision: snap.R(128)},
+	})
+	c.Check(manifest.AllowedComponentRevisions(), DeepEquals, []*seedwriter.ManifestComponentRevision{
+		{Component: naming.NewComponentRef("one-snap", "comp-a"), Revision: snap.R(4)},
+		{Component: naming.NewComponentRef("one-snap", "comp-b"), Revision: snap.R(-2)},
+	})
+
+	empty := seedwriter.NewManifest()
+	c.Check(empty.AllowedSnapRevisions(), HasLen, 0)
+	c.Check(empty.AllowedComponentRevisions(), HasLen, 0)
+}
+
 func (s *manifestSuite) TestReadManifestNoFile(c *C) {
 	snapRevs, err := seedwriter.ReadManifest("noexists.manifest")
 	c.Assert(err, NotNil)
@@ -157,6 +208,71 @@ test x4
 `)
 }
 
+func (s *manifestSuite) TestWriteManifestComponentsGrouped(c *C) {
+	manifestFile := filepath.Join(s.root, "seed.manifest")
+	manifest := seedwriter.MockManifest(nil, map[string]*seedwriter.ManifestSnapRevision{
+		"zed":  {SnapName: "zed", Revision: snap.R(3)},
+		"core": {SnapName: "core", Revision: snap.R(12)},
+		"test": {SnapName: "test", Revision: snap.R(-4)},
+	}, nil, nil)
+	seedwriter.MockManifestComponents(manifest, nil, map[string]*seedwriter.ManifestComponentRevision{
+		"zed+comp-b": {Component: naming.NewComponentRef("zed", "comp-b"), Revision: snap.R(7)},
+		"test+foo":   {Component: naming.NewComponentRef("test", "foo"), Revision: snap.R(-1)},
+		"zed+comp-a": {Component: naming.NewComponentRef("zed", "comp-a"), Revision: snap.R(8)},
+		"test+bar":   {Component: naming.NewComponentRef("test", "bar"), Revision: snap.R(2)},
+	})
+	err := manifest.Write(manifestFile)
+	c.Assert(err, IsNil)
+
+	contents, err := os.ReadFile(manifestFile)
+	c.Assert(err, IsNil)
+	c.Check(string(contents), Equals, `core 12
+test x4
+test+bar 2
+test+foo x1
+zed 3
+zed+comp-a 8
+zed+comp-b 7
+`)
+
+	// and it reads back to the same revisions
+	read, err := seedwriter.ReadManifest(manifestFile)
+	c.Assert(err, IsNil)
+	c.Check(read.AllowedSnapRevision("test"), Equals, snap.R(-4))
+	c.Check(read.AllowedComponentRevision(naming.NewComponentRef("test", "bar")), Equals, snap.R(2))
+	c.Check(read.AllowedComponentRevision(naming.NewComponentRef("zed", "comp-a")), Equals, snap.R(8))
+}
+
+func (s *manifestSuite) TestManifestMarkComponentRevisionSeeded(c *C) {
+	manifest := seedwriter.NewManifest()
+	err := manifest.SetAllowedComponentRevision("core", "comp", snap.R(2))
+	c.Assert(err, IsNil)
+	// only the first rule is kept
+	err = manifest.SetAllowedComponentRevision("core", "comp", snap.R(4))
+	c.Assert(err, IsNil)
+	c.Check(manifest.AllowedComponentRevision(naming.NewComponentRef("core", "comp")), Equals, snap.R(2))
+	err = manifest.SetAllowedComponentRevision("core", "comp", snap.Revision{})
+	c.Check(err, ErrorMatches, `component revision for "core\+comp" in manifest cannot be 0 \(unset\)`)
+
+	err = manifest.MarkComponentRevisionSeeded("core", "comp", snap.R(3))
+	c.Check(err, ErrorMatches, `component "core\+comp" \(3\) does not match the allowed revision 2`)
+	err = manifest.MarkComponentRevisionSeeded("core", "comp", snap.R(2))
+	c.Assert(err, IsNil)
+	err = manifest.MarkComponentRevisionSeeded("core", "comp", snap.R(2))
+	c.Check(err, ErrorMatches, `cannot mark "core\+comp" \(2\) as seeded, it has already been marked seeded for revision 2`)
+
+	// components without a rule can be marked with any revision
+	err = manifest.MarkComponentRevisionSeeded("core", "other", snap.R(7))
+	c.Assert(err, IsNil)
+
+	manifestFile := filepath.Join(s.root, "seed.manifest")
+	err = manifest.Write(manifestFile)
+	c.Assert(err, IsNil)
+	c.Check(manifestFile, testutil.FileEquals, `core+comp 2
+core+other 7
+`)
+}
+
 func (s *manifestSuite) TestManifestSetAllowedSnapRevisionInvalidRevision(c *C) {
 	manifest := seedwriter.NewManifest()
 	err := manifest.SetAllowedSnapRevision("core", snap.R(0))
@@ -0,0 +1,134 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package seedwriter
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/snapcore/snapd/asserts"
+)
+
+// MultiSystemWriter writes several UC20+ systems, each with its own
+// model and label, into one seed directory. The systems share the
+// asserted snaps and components in the snaps/ directory of the seed:
+// a blob that was put in place for one system is neither fetched nor
+// written again for the following ones. Each system still gets its
+// own options.yaml, assertions and aux-info.json listing only its own
+// snaps.
+//
+// The Writer for each system is obtained with AddSystem and is driven
+// as usual, except that the blobs for which InPlace returns true must
+// not be fetched and that SeedSnaps must be invoked through the
+// MultiSystemWriter. The systems are expected to be written one after
+// the other.
+type MultiSystemWriter struct {
+	seedDir string
+
+	writers map[string]*Writer
+	// inPlace tracks the shared blobs already put in place for a
+	// previous system, by path
+	inPlace map[string]bool
+}
+
+// NewMultiSystemWriter returns a MultiSystemWriter for the given seed
+// directory.
+func NewMultiSystemWriter(seedDir string) *MultiSystemWriter {
+	return &MultiSystemWriter{
+		seedDir: seedDir,
+		writers: make(map[string]*Writer),
+		inPlace: make(map[string]bool),
+	}
+}
+
+// AddSystem returns a Writer for a new system of the seed, for the
+// given model with grade and the label set in opts. opts.SeedDir is
+// set to the seed directory of the MultiSystemWriter if empty.
+func (mw *MultiSystemWriter) AddSystem(model *asserts.Model, opts *Options) (*Writer, error) {
+	if model.Grade() == asserts.ModelGradeUnset {
+		return nil, fmt.Errorf("cannot add system for a model without a grade")
+	}
+	if opts.Label == "" {
+		return nil, fmt.Errorf("cannot add system without a label")
+	}
+	if mw.writers[opts.Label] != nil {
+		return nil, fmt.Errorf("cannot add system %q more than once", opts.Label)
+	}
+	if opts.AppendToSystem || opts.Resume {
+		return nil, fmt.Errorf("cannot add system %q: appending to or resuming a system is not supported", opts.Label)
+	}
+	if opts.SnapPoolDir != "" {
+		return nil, fmt.Errorf("cannot add system %q: snap pool directories are not supported", opts.Label)
+	}
+	if opts.SeedDir == "" {
+		opts.SeedDir = mw.seedDir
+	} else if filepath.Clean(opts.SeedDir) != filepath.Clean(mw.seedDir) {
+		return nil, fmt.Errorf("cannot add system %q with seed directory %q to seed %q", opts.Label, opts.SeedDir, mw.seedDir)
+	}
+
+	w, err := New(model, opts)
+	if err != nil {
+		return nil, err
+	}
+	mw.writers[opts.Label] = w
+	return w, nil
+}
+
+// InPlace returns whether the blob of the seed snap sn and of all its
+// components were already put in place for a previous system, in
+// which case they must not be fetched again.
+// It can be invoked only after SetInfo was called for sn.
+func (mw *MultiSystemWriter) InPlace(sn *SeedSnap) bool {
+	if sn.local || sn.Path == "" || !mw.inPlace[sn.Path] {
+		return false
+	}
+	for _, comp := range sn.Components {
+		if !mw.inPlace[comp.Path] {
+			return false
+		}
+	}
+	return true
+}
+
+// SeedSnaps invokes SeedSnaps on the Writer w for a system of the seed
+// and then records its shared blobs as in place for the following
+// systems.
+func (mw *MultiSystemWriter) SeedSnaps(w *Writer, copySnap func(name, src, dst string) error) error {
+	if mw.writers[w.opts.Label] != w {
+		return fmt.Errorf("internal error: writer for system %q is not part of the seed", w.opts.Label)
+	}
+	if err := w.SeedSnaps(copySnap); err != nil {
+		return err
+	}
+
+	sharedDir := filepath.Join(mw.seedDir, "snaps")
+	for _, snaps := range [][]*SeedSnap{w.snapsFromModel, w.extraSnaps} {
+		for _, sn := range snaps {
+			if sn.local || filepath.Dir(sn.Path) != sharedDir {
+				continue
+			}
+			mw.inPlace[sn.Path] = true
+			for _, comp := range sn.Components {
+				mw.inPlace[comp.Path] = true
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package seedwriter_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/seed/seedtest"
+	"github.com/snapcore/snapd/seed/seedwriter"
+)
+
+func (s *writerSuite) writeMultiSystem(c *C, mw *seedwriter.MultiSystemWriter, model *asserts.Model, label string) (fetched []string) {
+	w, err := mw.AddSystem(model, &seedwriter.Options{Label: label})
+	c.Assert(err, IsNil)
+	// each system collects its own assertions
+	c.Assert(w.Start(s.db, s.createFetcher(s.db, c)), IsNil)
+
+	for complete := false; !complete; {
+		snaps, err := w.SnapsToDownload()
+		c.Assert(err, IsNil)
+		for _, sn := range snaps {
+			s.doFillMetaDownloadedSnap(c, w, sn)
+			if mw.InPlace(sn) {
+				continue
+			}
+			fetched = append(fetched, sn.SnapName())
+			c.Assert(os.Rename(s.AssertedSnap(sn.SnapName()), sn.Path), IsNil)
+		}
+		complete, err = w.Downloaded(s.fetchAsserts(c))
+		c.Assert(err, IsNil)
+	}
+
+	c.Assert(mw.SeedSnaps(w, nil), IsNil)
+	c.Assert(w.WriteMeta(), IsNil)
+	return fetched
+}
+
+func (s *writerSuite) TestMultiSystemWriterSharedSnaps(c *C) {
+	model1 := s.appendModel()
+	model2 := s.Brands.Model("my-brand", "my-other-model", map[string]any{
+		"display-name": "my other model",
+		"architecture": "amd64",
+		"base":         "core20",
+		"grade":        "dangerous",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name": "core18",
+				"id":   s.AssertedSnapID("core18"),
+				"type": "base",
+			},
+		},
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "core18", "")
+
+	mw := seedwriter.NewMultiSystemWriter(s.opts.SeedDir)
+
+	fetched := s.writeMultiSystem(c, mw, model1, "20260101")
+	c.Check(fetched, DeepEquals, []string{"snapd", "pc-kernel", "core20", "pc"})
+
+	// only the snap not shared with the first system is fetched
+	fetched = s.writeMultiSystem(c, mw, model2, "20260102")
+	c.Check(fetched, DeepEquals, []string{"core18"})
+
+	blobs, err := filepath.Glob(filepath.Join(s.opts.SeedDir, "snaps", "*"))
+	c.Assert(err, IsNil)
+	c.Check(blobs, HasLen, 5)
+
+	// each system has its own model and snap assertions
+	for _, sys := range []struct {
+		label string
+		model *asserts.Model
+		snaps int
+	}{
+		{"20260101", model1, 4},
+		{"20260102", model2, 5},
+	} {
+		systemDir := filepath.Join(s.opts.SeedDir, "systems", sys.label)
+		models := seedtest.ReadAssertions(c, filepath.Join(systemDir, "model"))
+		c.Assert(models, HasLen, 1)
+		c.Check(models[0].(*asserts.Model).Model(), Equals, sys.model.Model())
+
+		var revs int
+		for _, a := range seedtest.ReadAssertions(c, filepath.Join(systemDir, "assertions", "snaps")) {
+			if a.Type() == asserts.SnapRevisionType {
+				revs++
+			}
+		}
+		c.Check(revs, Equals, sys.snaps)
+	}
+}
+
+func (s *writerSuite) TestMultiSystemWriterErrors(c *C) {
+	mw := seedwriter.NewMultiSystemWriter(s.opts.SeedDir)
+	model := s.appendModel()
+
+	_, err := mw.AddSystem(model, &seedwriter.Options{})
+	c.Check(err, ErrorMatches, `cannot add system without a label`)
+
+	_, err = mw.AddSystem(model, &seedwriter.Options{Label: "20260101", SeedDir: "/other"})
+	c.Check(err, ErrorMatches, `cannot add system "20260101" with seed directory "/other" to seed ".*/seed"`)
+
+	_, err = mw.AddSystem(model, &seedwriter.Options{Label: "20260101", Resume: true})
+	c.Check(err, ErrorMatches, `cannot add system "20260101": appending to or resuming a system is not supported`)
+
+	_, err = mw.AddSystem(model, &seedwriter.Options{Label: "20260101"})
+	c.Assert(err, IsNil)
+	_, err = mw.AddSystem(model, &seedwriter.Options{Label: "20260101"})
+	c.Check(err, ErrorMatches, `cannot add system "20260101" more than once`)
+
+	w, err := seedwriter.New(model, &seedwriter.Options{Label: "20260102", SeedDir: s.opts.SeedDir})
+	c.Assert(err, IsNil)
+	c.Check(mw.SeedSnaps(w, nil), ErrorMatches, `internal error: writer for system "20260102" is not part of the seed`)
+
+	model16 := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"gadget":       "pc",
+		"kernel":       "pc-kernel",
+	})
+	_, err = mw.AddSystem(model16, &seedwriter.Options{Label: "20260103"})
+	c.Check(err, ErrorMatches, `cannot add system for a model without a grade`)
+}
@@ -0,0 +1,181 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package seedwriter
+
+import (
+	"fmt"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/snap"
+)
+
+// Plan describes the snaps and assertions written, or that would be
+// written in dry-run mode, into the seed.
+type Plan struct {
+	Snaps []*PlanSnap
+	// AssertionRefs are the references to the model, the extra
+	// assertions and then the snap assertions of the seed, each
+	// preceded by its prerequisites
+	AssertionRefs []*asserts.Ref
+}
+
+// PlanSnap describes a snap of a Plan.
+type PlanSnap struct {
+	Name     string
+	SnapID   string
+	Channel  string
+	Revision snap.Revision
+	// Path is the destination of the snap blob in the seed, once
+	// SeedSnaps was invoked
+	Path string
+	// Components are the references (<snap>+<component>) of the
+	// components of the snap
+	Components []string
+	// Unasserted is set for local snaps without assertions
+	Unasserted bool
+	// Extra is set for snaps not coming from the model
+	Extra bool
+}
+
+// Plan returns the snaps and the references to the assertions that are
+// or would be written into the seed, this is mostly useful in dry-run
+// mode.
+// It can be invoked only after Downloaded returns complete == true.
+func (w *Writer) Plan() (*Plan, error) {
+	if err := w.checkSnapsAccessor(); err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{}
+	seen := make(map[string]bool)
+	addRefs := func(refs []*asserts.Ref) {
+		for _, ref := range refs {
+			if seen[ref.Unique()] || w.opts.omitRef(ref) {
+				continue
+			}
+			seen[ref.Unique()] = true
+			plan.AssertionRefs = append(plan.AssertionRefs, ref)
+		}
+	}
+	addRefs(w.modelRefs)
+	addRefs(w.extraRefs)
+
+	for _, snaps := range [][]*SeedSnap{w.snapsFromModel, w.extraSnaps} {
+		for _, sn := range snaps {
+			var comps []string
+			for _, comp := range sn.Components {
+				comps = append(comps, comp.ComponentRef.String())
+			}
+			plan.Snaps = append(plan.Snaps, &PlanSnap{
+				Name:       sn.SnapName(),
+				SnapID:     sn.Info.ID(),
+				Channel:    sn.Channel,
+				Revision:   sn.Info.Revision,
+				Path:       sn.Path,
+				Components: comps,
+				Unasserted: sn.Info.ID() == "",
+				Extra:      sn.modelSnap == nil,
+			})
+			addRefs(sn.aRefs)
+		}
+	}
+	return plan, nil
+}
+
+// RequiredAssertionsFetcher provides to RequiredAssertions the snap
+// metadata and the assertions needed to go through the seed writing
+// flow.
+type RequiredAssertionsFetcher struct {
+	// OptionsSnaps are the options-referred snaps of the seed, see
+	// Writer.SetOptionsSnaps. Local snaps are not supported.
+	OptionsSnaps []*OptionsSnap
+	// Fetcher is used to fetch the model, store and validation-set
+	// assertions, see Writer.Start.
+	Fetcher SeedAssertionFetcher
+	// SetInfo must invoke Writer.SetInfo for the snap to download sn
+	// with the metadata of the snap from the store, without
+	// downloading the snap.
+	SetInfo func(w *Writer, sn *SeedSnap) error
+	// FetchAsserts fetches the assertions for the snaps, see
+	// Writer.Downloaded.
+	FetchAsserts AssertsFetchFunc
+}
+
+// RequiredAssertions returns the references to the assertions, that is the
+// model, store, validation-set, snap-declaration, snap-revision and
+// account-key ones among others, that a seed for the given model and
+// options would require. It goes through the seed writing flow in
+// dry-run mode using only the metadata of the snaps provided via rf, no
+// snap blobs are fetched or placed. This is useful to populate an
+// assertion store for a model.
+func RequiredAssertions(model *asserts.Model, opts *Options, db asserts.RODatabase, rf *RequiredAssertionsFetcher) ([]*asserts.Ref, error) {
+	if opts == nil {
+		return nil, fmt.Errorf("internal error: Writer *Options is nil")
+	}
+	if rf == nil || rf.Fetcher == nil || rf.SetInfo == nil || rf.FetchAsserts == nil {
+		return nil, fmt.Errorf("internal error: incomplete RequiredAssertionsFetcher")
+	}
+
+	dryRunOpts := *opts
+	dryRunOpts.DryRun = true
+	// this needs to read the gadget snap
+	dryRunOpts.CheckGadgetDefaults = false
+	w, err := New(model, &dryRunOpts)
+	if err != nil {
+		return nil, err
+	}
+	if len(rf.OptionsSnaps) != 0 {
+		if err := w.SetOptionsSnaps(rf.OptionsSnaps); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Start(db, rf.Fetcher); err != nil {
+		return nil, err
+	}
+	localSnaps, err := w.LocalSnaps()
+	if err != nil {
+		return nil, err
+	}
+	if len(localSnaps) != 0 {
+		return nil, fmt.Errorf("cannot determine the required assertions of a seed with local snaps")
+	}
+
+	for complete := false; !complete; {
+		snaps, err := w.SnapsToDownload()
+		if err != nil {
+			return nil, err
+		}
+		for _, sn := range snaps {
+			if err := rf.SetInfo(w, sn); err != nil {
+				return nil, err
+			}
+		}
+		complete, err = w.Downloaded(rf.FetchAsserts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	plan, err := w.Plan()
+	if err != nil {
+		return nil, err
+	}
+	return plan.AssertionRefs, nil
+}
@@ -0,0 +1,251 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package seedwriter_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/seed/seedwriter"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snapfile"
+)
+
+func (s *writerSuite) TestDryRunCore20(c *C) {
+	model := s.appendModel()
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	localFn := s.makeLocalSnap(c, "bare-app")
+
+	s.opts.Label = "20260101"
+	s.opts.DryRun = true
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+	c.Assert(w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Path: localFn}}), IsNil)
+	c.Assert(w.Start(s.db, s.rf), IsNil)
+
+	// the info of local snaps is still derived
+	localSnaps, err := w.LocalSnaps()
+	c.Assert(err, IsNil)
+	c.Assert(localSnaps, HasLen, 1)
+	f, err := snapfile.Open(localSnaps[0].Path)
+	c.Assert(err, IsNil)
+	info, err := snap.ReadInfoFromSnapFile(f, nil)
+	c.Assert(err, IsNil)
+	c.Assert(w.SetInfo(localSnaps[0], info, nil), IsNil)
+	c.Assert(w.InfoDerived(), IsNil)
+
+	for complete := false; !complete; {
+		snaps, err := w.SnapsToDownload()
+		c.Assert(err, IsNil)
+		for _, sn := range snaps {
+			s.fillMetaDownloadedSnap(c, w, sn)
+		}
+		complete, err = w.Downloaded(s.fetchAsserts(c))
+		c.Assert(err, IsNil)
+	}
+
+	copySnap := func(name, src, dst string) error {
+		c.Fatalf("unexpected copy of %s", name)
+		return nil
+	}
+	c.Assert(w.SeedSnaps(copySnap), IsNil)
+	c.Assert(w.WriteMeta(), IsNil)
+
+	// nothing was written
+	entries, err := os.ReadDir(s.opts.SeedDir)
+	c.Assert(err, IsNil)
+	c.Check(entries, HasLen, 0)
+
+	plan, err := w.Plan()
+	c.Assert(err, IsNil)
+	snapsDir := filepath.Join(s.opts.SeedDir, "snaps")
+	c.Check(plan.Snaps, DeepEquals, []*seedwriter.PlanSnap{
+		{Name: "snapd", SnapID: s.AssertedSnapID("snapd"), Channel: "latest/stable", Revision: snap.R(1), Path: filepath.Join(snapsDir, "snapd_1.snap")},
+		{Name: "pc-kernel", SnapID: s.AssertedSnapID("pc-kernel"), Channel: "20", Revision: snap.R(1), Path: filepath.Join(snapsDir, "pc-kernel_1.snap")},
+		{Name: "core20", SnapID: s.AssertedSnapID("core20"), Channel: "latest/stable", Revision: snap.R(1), Path: filepath.Join(snapsDir, "core20_1.snap")},
+		{Name: "pc", SnapID: s.AssertedSnapID("pc"), Channel: "20", Revision: snap.R(1), Path: filepath.Join(snapsDir, "pc_1.snap")},
+		{Name: "bare-app", Channel: "latest/stable", Revision: snap.R(-1), Path: filepath.Join(s.opts.SeedDir, "systems", "20260101", "snaps", "bare-app_1.0.snap"), Unasserted: true, Extra: true},
+	})
+
+	var models int
+	var revs []string
+	for _, ref := range plan.AssertionRefs {
+		switch ref.Type {
+		case asserts.ModelType:
+			models++
+		case asserts.SnapRevisionType:
+			revs = append(revs, ref.PrimaryKey[0])
+		}
+	}
+	c.Check(models, Equals, 1)
+	c.Check(revs, DeepEquals, []string{
+		s.AssertedSnapRevision("snapd").SnapSHA3_384(),
+		s.AssertedSnapRevision("pc-kernel").SnapSHA3_384(),
+		s.AssertedSnapRevision("core20").SnapSHA3_384(),
+		s.AssertedSnapRevision("pc").SnapSHA3_384(),
+	})
+}
+
+func (s *writerSuite) TestDryRunErrors(c *C) {
+	model := s.appendModel()
+	s.opts.Label = "20260101"
+	s.opts.DryRun = true
+
+	s.opts.Resume = true
+	_, err := seedwriter.New(model, s.opts)
+	c.Check(err, ErrorMatches, `cannot use dry-run mode to append to or resume writing a system`)
+	s.opts.Resume = false
+
+	// an existing system is still detected
+	c.Assert(os.MkdirAll(filepath.Join(s.opts.SeedDir, "systems", "20260101"), 0755), IsNil)
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+	c.Check(w.Start(s.db, s.rf), ErrorMatches, `system "20260101" already exists`)
+
+	_, err = w.Plan()
+	c.Check(err, ErrorMatches, `internal error: seedwriter.Writer cannot query seed snaps before Downloaded signaled complete`)
+}
+
+func (s *writerSuite) TestRequiredAssertionsCore20(c *C) {
+	model := s.appendModel()
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "cont-producer", "developerid")
+
+	s.opts.Label = "20260101"
+	var setInfo []string
+	rf := &seedwriter.RequiredAssertionsFetcher{
+		OptionsSnaps: []*seedwriter.OptionsSnap{{Name: "core18"}, {Name: "cont-producer"}},
+		Fetcher:      s.rf,
+		SetInfo: func(w *seedwriter.Writer, sn *seedwriter.SeedSnap) error {
+			setInfo = append(setInfo, sn.SnapName())
+			s.fillMetaDownloadedSnap(c, w, sn)
+			return nil
+		},
+		FetchAsserts: s.fetchAsserts(c),
+	}
+	refs, err := seedwriter.RequiredAssertions(model, s.opts, s.db, rf)
+	c.Assert(err, IsNil)
+	c.Check(setInfo, DeepEquals, []string{"snapd", "pc-kernel", "core20", "pc", "core18", "cont-producer"})
+	// the options are left untouched
+	c.Check(s.opts.DryRun, Equals, false)
+
+	// nothing was written
+	entries, err := os.ReadDir(s.opts.SeedDir)
+	c.Assert(err, IsNil)
+	c.Check(entries, HasLen, 0)
+
+	seen := make(map[string]bool)
+	var models int
+	var decls, revs []string
+	for _, ref := range refs {
+		c.Check(seen[ref.Unique()], Equals, false, Commentf("duplicated %v", ref))
+		seen[ref.Unique()] = true
+		switch ref.Type {
+		case asserts.ModelType:
+			models++
+		case asserts.SnapDeclarationType:
+			decls = append(decls, ref.PrimaryKey[1])
+		case asserts.SnapRevisionType:
+			revs = append(revs, ref.PrimaryKey[0])
+		}
+		// all the refs can be resolved
+		_, err := ref.Resolve(s.db.Find)
+		c.Check(err, IsNil)
+	}
+	c.Check(models, Equals, 1)
+	c.Check(decls, DeepEquals, []string{
+		s.AssertedSnapID("snapd"),
+		s.AssertedSnapID("pc-kernel"),
+		s.AssertedSnapID("core20"),
+		s.AssertedSnapID("pc"),
+		s.AssertedSnapID("core18"),
+		s.AssertedSnapID("cont-producer"),
+	})
+	c.Check(revs, DeepEquals, []string{
+		s.AssertedSnapRevision("snapd").SnapSHA3_384(),
+		s.AssertedSnapRevision("pc-kernel").SnapSHA3_384(),
+		s.AssertedSnapRevision("core20").SnapSHA3_384(),
+		s.AssertedSnapRevision("pc").SnapSHA3_384(),
+		s.AssertedSnapRevision("core18").SnapSHA3_384(),
+		s.AssertedSnapRevision("cont-producer").SnapSHA3_384(),
+	})
+	// the account-key of the developer of cont-producer is required
+	c.Check(seen[(&asserts.Ref{Type: asserts.AccountType, PrimaryKey: []string{"developerid"}}).Unique()], Equals, true)
+}
+
+func (s *writerSuite) TestRequiredAssertionsErrors(c *C) {
+	model := s.appendModel()
+	s.opts.Label = "20260101"
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+
+	_, err := seedwriter.RequiredAssertions(model, s.opts, s.db, &seedwriter.RequiredAssertionsFetcher{Fetcher: s.rf})
+	c.Check(err, ErrorMatches, `internal error: incomplete RequiredAssertionsFetcher`)
+
+	setInfo := func(w *seedwriter.Writer, sn *seedwriter.SeedSnap) error {
+		s.fillMetaDownloadedSnap(c, w, sn)
+		return nil
+	}
+
+	// local snaps are not supported
+	localFn := s.makeLocalSnap(c, "bare-app")
+	_, err = seedwriter.RequiredAssertions(model, s.opts, s.db, &seedwriter.RequiredAssertionsFetcher{
+		OptionsSnaps: []*seedwriter.OptionsSnap{{Path: localFn}},
+		Fetcher:      s.rf,
+		SetInfo:      setInfo,
+		FetchAsserts: s.fetchAsserts(c),
+	})
+	c.Check(err, ErrorMatches, `cannot determine the required assertions of a seed with local snaps`)
+
+	// errors from the callbacks are returned
+	_, err = seedwriter.RequiredAssertions(model, s.opts, s.db, &seedwriter.RequiredAssertionsFetcher{
+		Fetcher: s.rf,
+		SetInfo: func(w *seedwriter.Writer, sn *seedwriter.SeedSnap) error {
+			return fmt.Errorf("cannot get info of %s", sn.SnapName())
+		},
+		FetchAsserts: s.fetchAsserts(c),
+	})
+	c.Check(err, ErrorMatches, `cannot get info of snapd`)
+
+	_, err = seedwriter.RequiredAssertions(model, s.opts, s.db, &seedwriter.RequiredAssertionsFetcher{
+		Fetcher: s.rf,
+		SetInfo: setInfo,
+		FetchAsserts: func(sn, sysSn, kSn *seedwriter.SeedSnap) ([]*asserts.Ref, error) {
+			return nil, fmt.Errorf("cannot fetch assertions of %s", sn.SnapName())
+		},
+	})
+	c.Check(err, ErrorMatches, `cannot fetch assertions of snapd`)
+}
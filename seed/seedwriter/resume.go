@@ -0,0 +1,144 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package seedwriter
+
+import (
+	"crypto"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/snapcore/snapd/osutil"
+)
+
+func fileSha3_384(path string) (string, error) {
+	dgst, _, err := osutil.FileDigest(path, crypto.SHA3_384)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", dgst), nil
+}
+
+// checkResumedSnapFile checks with checkBlob that the blobs of the
+// asserted seed snap sn and of its components left in place by a
+// previous attempt are the asserted ones.
+func (w *Writer) checkResumedSnapFile(sn *SeedSnap) error {
+	if err := w.checkBlob(sn, nil, "", sn.Path); err != nil {
+		return fmt.Errorf("cannot resume seed: snap file %v, remove it and download it again", err)
+	}
+	for i := range sn.Components {
+		comp := &sn.Components[i]
+		if err := w.checkBlob(sn, comp, "", comp.Path); err != nil {
+			return fmt.Errorf("cannot resume seed: component file %v, remove it and download it again", err)
+		}
+	}
+	return nil
+}
+
+// resumeCopySnap copies the blob src to dst with copySnap unless an
+// identical copy is already at dst, any partial copy is removed first.
+func resumeCopySnap(copySnap func(name, src, dst string) error, name, src, dst string) error {
+	if osutil.FileExists(dst) {
+		srcSha3_384, err := fileSha3_384(src)
+		if err != nil {
+			return err
+		}
+		dstSha3_384, err := fileSha3_384(dst)
+		if err == nil && dstSha3_384 == srcSha3_384 {
+			// already copied
+			return nil
+		}
+		if err := os.Remove(dst); err != nil {
+			return err
+		}
+	}
+	return copySnap(name, src, dst)
+}
+
+// removeStaleSystemSnaps removes from the system snaps directory the
+// blobs left behind by a previous attempt that are no longer part of
+// the system.
+func (w *Writer) removeStaleSystemSnaps() error {
+	inUse := make(map[string]bool)
+	for _, snaps := range [][]*SeedSnap{w.snapsFromModel, w.extraSnaps} {
+		for _, sn := range snaps {
+			inUse[sn.Path] = true
+			for _, comp := range sn.Components {
+				inUse[comp.Path] = true
+			}
+		}
+	}
+
+	blobs, err := filepath.Glob(filepath.Join(w.systemDir(), "snaps", "*"))
+	if err != nil {
+		return err
+	}
+	for _, blob := range blobs {
+		if inUse[blob] {
+			continue
+		}
+		if !strings.HasSuffix(blob, ".snap") && !strings.HasSuffix(blob, ".comp") {
+			continue
+		}
+		if err := os.Remove(blob); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanupForResume removes from the existing system directory
+// everything that will be written again, keeping only the snap and
+// component blobs.
+func (tr *tree20) cleanupForResume() error {
+	entries, err := os.ReadDir(tr.systemDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name() == "snaps" && entry.IsDir() {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(tr.systemDir, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	snapsDir := filepath.Join(tr.systemDir, "snaps")
+	entries, err = os.ReadDir(snapsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && (strings.HasSuffix(name, ".snap") || strings.HasSuffix(name, ".comp")) {
+			continue
+		}
+		// aux-info.json, leftover temporary files etc
+		if err := os.RemoveAll(filepath.Join(snapsDir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
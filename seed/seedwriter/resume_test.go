@@ -0,0 +1,247 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package seedwriter_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/seed/seedtest"
+	"github.com/snapcore/snapd/seed/seedwriter"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snapfile"
+	"github.com/snapcore/snapd/testutil"
+)
+
+// writeSeedForResume goes through all the Writer steps for the model and
+// the local snap at localFn up to SeedSnaps, using fill for the snaps to
+// download, it returns the names of the blobs that were copied.
+func (s *writerSuite) writeSeedForResume(c *C, model *asserts.Model, localFn string, fill func(c *C, w *seedwriter.Writer, sn *seedwriter.SeedSnap)) (*seedwriter.Writer, []string, error) {
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+	c.Assert(w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Path: localFn}}), IsNil)
+	c.Assert(w.Start(s.db, s.rf), IsNil)
+
+	localSnaps, err := w.LocalSnaps()
+	c.Assert(err, IsNil)
+	for _, sn := range localSnaps {
+		f, err := snapfile.Open(sn.Path)
+		c.Assert(err, IsNil)
+		info, err := snap.ReadInfoFromSnapFile(f, nil)
+		c.Assert(err, IsNil)
+		w.SetInfo(sn, info, nil)
+	}
+	c.Assert(w.InfoDerived(), IsNil)
+
+	for complete := false; !complete; {
+		snaps, err := w.SnapsToDownload()
+		c.Assert(err, IsNil)
+		for _, sn := range snaps {
+			fill(c, w, sn)
+		}
+		complete, err = w.Downloaded(s.fetchAsserts(c))
+		c.Assert(err, IsNil)
+	}
+
+	var copied []string
+	copySnap := func(name, src, dst string) error {
+		copied = append(copied, name)
+		return osutil.CopyFile(src, dst, 0)
+	}
+	return w, copied, w.SeedSnaps(copySnap)
+}
+
+func (s *writerSuite) TestResumeCore20(c *C) {
+	model := s.appendModel()
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	localFn := s.makeLocalSnap(c, "bare-app")
+
+	s.opts.Label = "20260101"
+	_, copied, err := s.writeSeedForResume(c, model, localFn, s.fillDownloadedSnap)
+	c.Assert(err, IsNil)
+	c.Check(copied, DeepEquals, []string{"bare-app"})
+
+	// the process was interrupted before WriteMeta could complete,
+	// leaving behind a partial copy of the local snap, a stale blob
+	// and half-written metadata
+	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
+	localCopy := filepath.Join(systemDir, "snaps", "bare-app_1.0.snap")
+	c.Assert(os.Truncate(localCopy, 10), IsNil)
+	staleBlob := filepath.Join(systemDir, "snaps", "stale_1.snap")
+	c.Assert(os.WriteFile(staleBlob, nil, 0644), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(systemDir, "options.yaml"), []byte("snaps:\n  - name: ba"), 0644), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(systemDir, "model"), []byte("type: mo"), 0644), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(systemDir, "snaps", "aux-info.json"), []byte("{"), 0644), IsNil)
+
+	// without resuming the existing system is an error
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+	c.Check(w.Start(s.db, s.rf), ErrorMatches, `system "20260101" already exists`)
+
+	s.opts.Resume = true
+	w, copied, err = s.writeSeedForResume(c, model, localFn, s.fillMetaDownloadedSnap)
+	c.Assert(err, IsNil)
+	// only the partial copy was done again
+	c.Check(copied, DeepEquals, []string{"bare-app"})
+	c.Assert(w.WriteMeta(), IsNil)
+
+	c.Check(staleBlob, testutil.FileAbsent)
+	c.Check(filepath.Join(systemDir, "snaps", "aux-info.json"), testutil.FileAbsent)
+	c.Check(localCopy, testutil.FileEquals, testutil.FileContentRef(localFn))
+
+	options20, err := seedwriter.InternalReadOptions20(filepath.Join(systemDir, "options.yaml"))
+	c.Assert(err, IsNil)
+	c.Check(options20.Snaps, DeepEquals, []*seedwriter.InternalSnap20{
+		{
+			Name:       "bare-app",
+			Unasserted: "bare-app_1.0.snap",
+		},
+	})
+	models := seedtest.ReadAssertions(c, filepath.Join(systemDir, "model"))
+	c.Assert(models, HasLen, 1)
+	c.Check(models[0].Type(), Equals, asserts.ModelType)
+
+	// resuming again a complete system redoes no copy
+	w, copied, err = s.writeSeedForResume(c, model, localFn, s.fillMetaDownloadedSnap)
+	c.Assert(err, IsNil)
+	c.Check(copied, HasLen, 0)
+	c.Assert(w.WriteMeta(), IsNil)
+}
+
+func (s *writerSuite) TestResumeCore20CorruptedDownload(c *C) {
+	model := s.appendModel()
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	localFn := s.makeLocalSnap(c, "bare-app")
+
+	s.opts.Label = "20260101"
+	_, _, err := s.writeSeedForResume(c, model, localFn, s.fillDownloadedSnap)
+	c.Assert(err, IsNil)
+
+	pcBlob := filepath.Join(s.opts.SeedDir, "snaps", "pc_1.snap")
+	c.Assert(os.Truncate(pcBlob, 10), IsNil)
+
+	s.opts.Resume = true
+	_, _, err = s.writeSeedForResume(c, model, localFn, s.fillMetaDownloadedSnap)
+	c.Check(err, ErrorMatches, `cannot resume seed: snap file ".*/snaps/pc_1.snap" does not have the expected digest and size, remove it and download it again`)
+}
+
+func (s *writerSuite) TestResumeCore20CorruptedComponent(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core20",
+		"grade":        "dangerous",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name": "required20",
+				"id":   s.AssertedSnapID("required20"),
+				"components": map[string]any{
+					"comp1": "required",
+				},
+			},
+		},
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.SeedSnaps.MakeAssertedSnapWithComps(c, seedtest.SampleSnapYaml["required20"], nil,
+		snap.R(21), map[string]snap.Revision{"comp1": snap.R(22), "comp2": snap.R(33)}, "canonical", s.StoreSigning.Database)
+	localFn := s.makeLocalSnap(c, "bare-app")
+
+	s.opts.Label = "20260101"
+	_, _, err := s.writeSeedForResume(c, model, localFn, s.fillDownloadedSnap)
+	c.Assert(err, IsNil)
+
+	compBlob := filepath.Join(s.opts.SeedDir, "snaps", "required20+comp1_22.comp")
+	c.Assert(os.Truncate(compBlob, 10), IsNil)
+
+	s.opts.Resume = true
+	_, _, err = s.writeSeedForResume(c, model, localFn, s.fillMetaDownloadedSnap)
+	c.Check(err, ErrorMatches, `cannot resume seed: component file ".*/snaps/required20\+comp1_22.comp" does not have the expected digest and size, remove it and download it again`)
+}
+
+func (s *writerSuite) TestResumeCore20SnapPoolCorrupted(c *C) {
+	model := s.appendModel()
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	localFn := s.makeLocalSnap(c, "bare-app")
+
+	poolDir := c.MkDir()
+	c.Assert(osutil.CopyFile(localFn, filepath.Join(poolDir, "bare-app_1.0.snap"), 0), IsNil)
+	s.opts.SnapPoolDir = poolDir
+	s.opts.Label = "20260101"
+	_, _, err := s.writeSeedForResume(c, model, localFn, s.fillPoolSnap(poolDir))
+	c.Assert(err, IsNil)
+
+	// the blob in the pool got corrupted in between
+	c.Assert(os.Truncate(filepath.Join(poolDir, "pc_1.snap"), 10), IsNil)
+
+	s.opts.Resume = true
+	_, _, err = s.writeSeedForResume(c, model, localFn, s.fillMetaDownloadedSnap)
+	c.Check(err, ErrorMatches, `cannot use "pc" from snap pool: ".*/pc_1.snap" does not have the expected digest and size`)
+}
+
+func (s *writerSuite) TestResumeErrors(c *C) {
+	model := s.appendModel()
+	s.opts.Label = "20260101"
+	s.opts.Resume = true
+	s.opts.AppendToSystem = true
+	_, err := seedwriter.New(model, s.opts)
+	c.Check(err, ErrorMatches, `cannot both resume writing and append to an existing system`)
+
+	s.opts.AppendToSystem = false
+	model = s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"gadget":       "pc",
+		"kernel":       "pc-kernel",
+	})
+	_, err = seedwriter.New(model, s.opts)
+	c.Check(err, ErrorMatches, `cannot resume writing a seed for a model without a grade`)
+}
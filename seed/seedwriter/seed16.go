@@ -20,6 +20,7 @@
 package seedwriter
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"os"
@@ -39,7 +40,7 @@ type policy16 struct {
 	model *asserts.Model
 	opts  *Options
 
-	warningf func(format string, a ...any)
+	warnf func(kind WarningKind, snapName, format string, a ...any)
 
 	needsCore   []string
 	needsCore16 []string
@@ -71,11 +72,29 @@ func makeSystemSnap(snapName string) *asserts.ModelSnap {
 	return internal.MakeSystemSnap(snapName, "", []string{"run"})
 }
 
+// checkNoSeparateSnapd checks that the model allows to omit the snapd
+// snap as requested by Options.NoSeparateSnapd.
+func checkNoSeparateSnapd(model *asserts.Model) error {
+	if model.Classic() || model.Base() == "" {
+		return fmt.Errorf("cannot omit the snapd snap from the seed of a model without a base or a classic one")
+	}
+	for _, modSnap := range model.AllSnaps() {
+		if modSnap.SnapType == "snapd" || modSnap.SnapName() == "snapd" {
+			return fmt.Errorf("cannot omit the snapd snap from the seed, it is listed by the model")
+		}
+	}
+	return nil
+}
+
 func (pol *policy16) systemSnap() *asserts.ModelSnap {
 	if pol.model.Classic() {
 		// no predefined system snap, infer later
 		return nil
 	}
+	if pol.opts.NoSeparateSnapd {
+		// the base carries snapd, it is listed by the model
+		return nil
+	}
 	snapName := "core"
 	if pol.model.Base() != "" {
 		snapName = "snapd"
@@ -123,7 +142,7 @@ func (pol *policy16) needsImplicitSnaps(availableByMode map[string]*naming.SnapS
 	hasCore := availableSnaps.Contains(naming.Snap("core"))
 	if len(pol.needsCore) != 0 && !hasCore {
 		if pol.model.Base() != "" {
-			pol.warningf("model has base %q but some snaps (%s) require \"core\" as base as well, for compatibility it was added implicitly, adding \"core\" explicitly is recommended", pol.model.Base(), strutil.Quoted(pol.needsCore))
+			pol.warnf(WarningImplicitCore, "core", "model has base %q but some snaps (%s) require \"core\" as base as well, for compatibility it was added implicitly, adding \"core\" explicitly is recommended", pol.model.Base(), strutil.Quoted(pol.needsCore))
 		}
 		return true, nil
 	}
@@ -175,6 +194,9 @@ func (pol *policy16) isSystemSnapCandidate(sn *SeedSnap) bool {
 		if sn.modelSnap.SnapType == "snapd" {
 			return true
 		}
+		if pol.opts.NoSeparateSnapd && sn.modelSnap.SnapType == "base" {
+			return true
+		}
 	}
 	if pol.model.Classic() {
 		if pol.snapdUsedOnClassic {
@@ -200,6 +222,9 @@ type tree16 struct {
 
 func (tr *tree16) mkFixedDirs() error {
 	tr.snapsDirPath = filepath.Join(tr.opts.SeedDir, "snaps")
+	if tr.opts.DryRun {
+		return nil
+	}
 	return os.MkdirAll(tr.snapsDirPath, 0755)
 }
 
@@ -225,8 +250,17 @@ func (tr *tree16) writeAssertions(db asserts.RODatabase, modelRefs []*asserts.Re
 		return err
 	}
 
+	// with a single stream the assertions are written in the order
+	// they were fetched, which puts prerequisites first
+	var stream bytes.Buffer
+	enc := asserts.NewEncoder(&stream)
+	seen := make(map[string]bool)
+
 	writeByRefs := func(aRefs []*asserts.Ref) error {
 		for _, aRef := range aRefs {
+			if tr.opts.omitRef(aRef) {
+				continue
+			}
 			var afn string
 			// the names don't matter in practice as long as they don't conflict
 			if aRef.Type == asserts.ModelType {
@@ -238,6 +272,19 @@ func (tr *tree16) writeAssertions(db asserts.RODatabase, modelRefs []*asserts.Re
 			if err != nil {
 				return fmt.Errorf("internal error: lost saved assertion")
 			}
+			if tr.opts.SingleAssertionStream && seen[aRef.Unique()] {
+				continue
+			}
+			if err := tr.opts.onAssertion(a); err != nil {
+				return err
+			}
+			if tr.opts.SingleAssertionStream {
+				seen[aRef.Unique()] = true
+				if err := enc.Encode(a); err != nil {
+					return err
+				}
+				continue
+			}
 			if err = os.WriteFile(filepath.Join(seedAssertsDir, afn), asserts.Encode(a), 0644); err != nil {
 				return err
 			}
@@ -265,6 +312,9 @@ func (tr *tree16) writeAssertions(db asserts.RODatabase, modelRefs []*asserts.Re
 		}
 	}
 
+	if tr.opts.SingleAssertionStream {
+		return os.WriteFile(filepath.Join(seedAssertsDir, singleAssertionStreamFile), stream.Bytes(), 0644)
+	}
 	return nil
 }
 
@@ -27,10 +27,12 @@ import (
 	"path/filepath"
 
 	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/seed/internal"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snap/channel"
 	"github.com/snapcore/snapd/snap/naming"
+	"github.com/snapcore/snapd/strutil"
 )
 
 type policy20 struct {
@@ -169,6 +171,8 @@ func (pol *policy20) ignoreUndeterminedSystemSnap() bool {
 type tree20 struct {
 	grade asserts.ModelGrade
 	opts  *Options
+	// existing is set when appending to an existing system
+	existing *existingSystem
 
 	snapsDirPath string
 	systemDir    string
@@ -180,6 +184,15 @@ func (tr *tree20) mkFixedDirs() error {
 	tr.snapsDirPath = filepath.Join(tr.opts.SeedDir, "snaps")
 	tr.systemDir = filepath.Join(tr.opts.SeedDir, "systems", tr.opts.Label)
 
+	if tr.opts.DryRun {
+		if osutil.IsDirectory(tr.systemDir) {
+			return &SystemAlreadyExistsError{
+				label: tr.opts.Label,
+			}
+		}
+		return nil
+	}
+
 	if err := os.MkdirAll(tr.snapsDirPath, 0755); err != nil {
 		return err
 	}
@@ -187,7 +200,16 @@ func (tr *tree20) mkFixedDirs() error {
 	if err := os.MkdirAll(filepath.Dir(tr.systemDir), 0755); err != nil {
 		return err
 	}
+	if tr.existing != nil {
+		if !osutil.IsDirectory(tr.systemDir) {
+			return fmt.Errorf("cannot append to system %q: system does not exist", tr.opts.Label)
+		}
+		return nil
+	}
 	if err := os.Mkdir(tr.systemDir, 0755); err != nil {
+		if os.IsExist(err) && tr.opts.Resume {
+			return tr.cleanupForResume()
+		}
 		if os.IsExist(err) {
 			return &SystemAlreadyExistsError{
 				label: tr.opts.Label,
@@ -200,7 +222,7 @@ func (tr *tree20) mkFixedDirs() error {
 
 func (tr *tree20) ensureSystemSnapsDir() (string, error) {
 	snapsDir := filepath.Join(tr.systemDir, "snaps")
-	if tr.systemSnapsDirEnsured {
+	if tr.systemSnapsDirEnsured || tr.opts.DryRun {
 		return snapsDir, nil
 	}
 	if err := os.MkdirAll(snapsDir, 0755); err != nil {
@@ -271,6 +293,10 @@ func (tr *tree20) localComponentPath(sc *SeedComponent, snapVersion string) (str
 }
 
 func (tr *tree20) writeAssertions(db asserts.RODatabase, modelRefs []*asserts.Ref, extraRefs []*asserts.Ref, snapsFromModel []*SeedSnap, extraSnaps []*SeedSnap) error {
+	if tr.existing != nil {
+		return tr.appendAssertions(db, extraSnaps)
+	}
+
 	assertsDir := filepath.Join(tr.systemDir, "assertions")
 	if err := os.MkdirAll(assertsDir, 0755); err != nil {
 		return err
@@ -293,10 +319,16 @@ func (tr *tree20) writeAssertions(db asserts.RODatabase, modelRefs []*asserts.Re
 			if aRef == nil {
 				break
 			}
+			if tr.opts.omitRef(aRef) {
+				continue
+			}
 			a, err := aRef.Resolve(db.Find)
 			if err != nil {
 				return fmt.Errorf("internal error: lost saved assertion")
 			}
+			if err := tr.opts.onAssertion(a); err != nil {
+				return err
+			}
 			if err := enc.Encode(a); err != nil {
 				return err
 			}
@@ -401,6 +433,113 @@ func (tr *tree20) writeAssertions(db asserts.RODatabase, modelRefs []*asserts.Re
 	return nil
 }
 
+// appendAssertions appends the assertions of the extra snaps being
+// added to an existing system to its extra-snaps assertions file,
+// skipping the ones already in the system.
+func (tr *tree20) appendAssertions(db asserts.RODatabase, extraSnaps []*SeedSnap) error {
+	var aRefs []*asserts.Ref
+	for _, sn := range extraSnaps {
+		if sn.existing {
+			continue
+		}
+		for _, aRef := range sn.aRefs {
+			u := aRef.Unique()
+			if tr.existing.refs[u] || tr.opts.omitRef(aRef) {
+				continue
+			}
+			tr.existing.refs[u] = true
+			aRefs = append(aRefs, aRef)
+		}
+	}
+	if len(aRefs) == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(filepath.Join(tr.systemDir, "assertions", "extra-snaps"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() != 0 {
+		// separate from the assertions already in the stream
+		if _, err := f.Write([]byte("\n")); err != nil {
+			return err
+		}
+	}
+
+	enc := asserts.NewEncoder(f)
+	for _, aRef := range aRefs {
+		a, err := aRef.Resolve(db.Find)
+		if err != nil {
+			return fmt.Errorf("internal error: lost saved assertion")
+		}
+		if err := tr.opts.onAssertion(a); err != nil {
+			return err
+		}
+		if err := enc.Encode(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// perModeSnapDirsModes are the modes for which per-mode snap
+// directories are created.
+var perModeSnapDirsModes = []string{"run", "install", "recover", "factory-reset"}
+
+// snapModesInclude returns whether the given mode is covered by the
+// snap modes, which can use the "ephemeral" alias for all modes but run.
+func snapModesInclude(snapModes []string, mode string) bool {
+	if strutil.ListContains(snapModes, mode) {
+		return true
+	}
+	if mode == "run" {
+		return false
+	}
+	return strutil.ListContains(snapModes, "ephemeral")
+}
+
+// writePerModeSnapDirs creates systems/<label>/<mode>/snaps directories
+// holding relative symlinks to the snaps and components used in each
+// mode, the blobs themselves are not duplicated.
+func (tr *tree20) writePerModeSnapDirs(snapsFromModel []*SeedSnap, extraSnaps []*SeedSnap) error {
+	link := func(dir, blobPath string) error {
+		target, err := filepath.Rel(dir, blobPath)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, filepath.Join(dir, filepath.Base(blobPath)))
+	}
+
+	for _, mode := range perModeSnapDirsModes {
+		modeSnapsDir := filepath.Join(tr.systemDir, mode, "snaps")
+		if err := os.MkdirAll(modeSnapsDir, 0755); err != nil {
+			return err
+		}
+		for _, snaps := range [][]*SeedSnap{snapsFromModel, extraSnaps} {
+			for _, sn := range snaps {
+				if !snapModesInclude(sn.modes(), mode) {
+					continue
+				}
+				if err := link(modeSnapsDir, sn.Path); err != nil {
+					return err
+				}
+				for _, comp := range sn.Components {
+					if err := link(modeSnapsDir, comp.Path); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
 func seedSnapComponentsForOptions(sn *SeedSnap) []internal.Component20 {
 	compOpts := make([]internal.Component20, 0, len(sn.Components))
 	for _, comp := range sn.Components {
@@ -425,7 +564,28 @@ func seedSnapComponentsForOptions(sn *SeedSnap) []internal.Component20 {
 	return compOpts
 }
 
+func extraSnapOptions(sn *SeedSnap) *internal.Snap20 {
+	channel := sn.Channel
+	unasserted := ""
+	if sn.Info.ID() == "" {
+		unasserted = filepath.Base(sn.Path)
+		channel = ""
+	}
+
+	return &internal.Snap20{
+		Name:       sn.SnapName(),
+		SnapID:     sn.Info.ID(),
+		Unasserted: unasserted,
+		Channel:    channel,
+		Components: seedSnapComponentsForOptions(sn),
+	}
+}
+
 func (tr *tree20) writeMeta(snapsFromModel []*SeedSnap, extraSnaps []*SeedSnap) error {
+	if tr.existing != nil {
+		return tr.appendMeta(extraSnaps)
+	}
+
 	var optionsSnaps []*internal.Snap20
 
 	for _, sn := range snapsFromModel {
@@ -462,24 +622,11 @@ func (tr *tree20) writeMeta(snapsFromModel []*SeedSnap, extraSnaps []*SeedSnap)
 	}
 
 	for _, sn := range extraSnaps {
-		channel := sn.Channel
-		unasserted := ""
-		if sn.Info.ID() == "" {
-			unasserted = filepath.Base(sn.Path)
-			channel = ""
-		}
-
-		optionsSnaps = append(optionsSnaps, &internal.Snap20{
-			Name:       sn.SnapName(),
-			SnapID:     sn.Info.ID(),
-			Unasserted: unasserted,
-			Channel:    channel,
-			Components: seedSnapComponentsForOptions(sn),
-		})
+		optionsSnaps = append(optionsSnaps, extraSnapOptions(sn))
 	}
 
-	if len(optionsSnaps) != 0 {
-		if tr.grade != asserts.ModelDangerous {
+	if len(optionsSnaps) != 0 || tr.opts.AlwaysWriteOptions {
+		if len(optionsSnaps) != 0 && tr.grade != asserts.ModelDangerous {
 			return fmt.Errorf("internal error: unexpected non-model snap overrides with grade %s", tr.grade)
 		}
 		options20 := &internal.Options20{Snaps: optionsSnaps}
@@ -488,25 +635,69 @@ func (tr *tree20) writeMeta(snapsFromModel []*SeedSnap, extraSnaps []*SeedSnap)
 		}
 	}
 
-	auxInfos := make(map[string]*internal.AuxInfo20)
+	if tr.opts.EmitPerModeSnapDirs {
+		if err := tr.writePerModeSnapDirs(snapsFromModel, extraSnaps); err != nil {
+			return err
+		}
+	}
+
+	auxInfos := make(map[string]any)
+	tr.addAuxInfos(auxInfos, snapsFromModel)
+	tr.addAuxInfos(auxInfos, extraSnaps)
 
-	addAuxInfos := func(seedSnaps []*SeedSnap) {
-		for _, sn := range seedSnaps {
-			if sn.Info.ID() != "" {
-				if len(sn.Info.Links()) != 0 || sn.Info.Private {
-					auxInfos[sn.Info.ID()] = &internal.AuxInfo20{
-						Private: sn.Info.Private,
-						Links:   sn.Info.Links(),
-						Contact: sn.Info.Contact(),
-					}
-				}
+	return tr.writeAuxInfos(auxInfos, os.O_EXCL)
+}
+
+// addAuxInfos adds to auxInfos the auxiliary information of the
+// asserted seedSnaps, as derived from their info and then passed
+// through Options.AuxInfoHook if set.
+func (tr *tree20) addAuxInfos(auxInfos map[string]any, seedSnaps []*SeedSnap) {
+	for _, sn := range seedSnaps {
+		snapID := sn.Info.ID()
+		if snapID == "" {
+			continue
+		}
+		var auxInfo *internal.AuxInfo20
+		if len(sn.Info.Links()) != 0 || sn.Info.Private {
+			auxInfo = &internal.AuxInfo20{
+				Private: sn.Info.Private,
+				Links:   sn.Info.Links(),
+				Contact: sn.Info.Contact(),
 			}
 		}
+		if tr.opts.AuxInfoHook == nil {
+			if auxInfo != nil {
+				auxInfos[snapID] = auxInfo
+			}
+			continue
+		}
+
+		aux := make(map[string]any)
+		if auxInfo != nil {
+			if auxInfo.Private {
+				aux["private"] = true
+			}
+			if len(auxInfo.Links) != 0 {
+				aux["links"] = auxInfo.Links
+			}
+			if auxInfo.Contact != "" {
+				aux["contact"] = auxInfo.Contact
+			}
+		}
+		aux = tr.opts.AuxInfoHook(snapID, aux)
+		if len(aux) == 0 {
+			delete(auxInfos, snapID)
+			continue
+		}
+		auxInfos[snapID] = aux
 	}
+}
 
-	addAuxInfos(snapsFromModel)
-	addAuxInfos(extraSnaps)
+func (tr *tree20) auxInfoPath() string {
+	return filepath.Join(tr.systemDir, "snaps", "aux-info.json")
+}
 
+func (tr *tree20) writeAuxInfos(auxInfos map[string]any, flag int) error {
 	if len(auxInfos) == 0 {
 		// nothing to do
 		return nil
@@ -516,7 +707,7 @@ func (tr *tree20) writeMeta(snapsFromModel []*SeedSnap, extraSnaps []*SeedSnap)
 		return err
 	}
 
-	f, err := os.OpenFile(filepath.Join(tr.systemDir, "snaps", "aux-info.json"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	f, err := os.OpenFile(tr.auxInfoPath(), os.O_WRONLY|os.O_CREATE|flag, 0644)
 	if err != nil {
 		return err
 	}
@@ -529,3 +720,44 @@ func (tr *tree20) writeMeta(snapsFromModel []*SeedSnap, extraSnaps []*SeedSnap)
 
 	return nil
 }
+
+// appendMeta extends options.yaml and aux-info.json of an existing
+// system with the extra snaps being appended to it.
+func (tr *tree20) appendMeta(extraSnaps []*SeedSnap) error {
+	var newSnaps []*SeedSnap
+	for _, sn := range extraSnaps {
+		if !sn.existing {
+			newSnaps = append(newSnaps, sn)
+		}
+	}
+	if len(newSnaps) == 0 {
+		// nothing to do
+		return nil
+	}
+
+	var optionsSnaps []*internal.Snap20
+	if tr.existing.options != nil {
+		optionsSnaps = tr.existing.options.Snaps
+	}
+	for _, sn := range newSnaps {
+		optionsSnaps = append(optionsSnaps, extraSnapOptions(sn))
+	}
+	options20 := &internal.Options20{Snaps: optionsSnaps}
+	if err := options20.Write(filepath.Join(tr.systemDir, "options.yaml")); err != nil {
+		return err
+	}
+
+	auxInfos := make(map[string]any)
+	data, err := os.ReadFile(tr.auxInfoPath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &auxInfos); err != nil {
+			return fmt.Errorf("cannot read aux-info.json of system %q: %v", tr.opts.Label, err)
+		}
+	}
+	tr.addAuxInfos(auxInfos, newSnaps)
+
+	return tr.writeAuxInfos(auxInfos, os.O_TRUNC)
+}
@@ -0,0 +1,83 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package seedwriter
+
+import (
+	"fmt"
+)
+
+// WarningKind identifies the kind of a Warning.
+type WarningKind int
+
+const (
+	// WarningOther is the kind of warnings without a more specific kind.
+	WarningOther WarningKind = iota
+	// WarningImplicitCore is the kind of the warning about the core
+	// snap being added implicitly because some snaps require it as
+	// base while the model has a different base.
+	WarningImplicitCore
+	// WarningContentProvider is the kind of the warnings about a
+	// content plug whose default-provider is not the only candidate
+	// slot available in the seed.
+	WarningContentProvider
+	// WarningValidationSet is the kind of the warnings about snaps
+	// required by validation sets in prefer-enforce mode that are
+	// not part of the seed.
+	WarningValidationSet
+)
+
+func (k WarningKind) String() string {
+	switch k {
+	case WarningImplicitCore:
+		return "implicit-core"
+	case WarningContentProvider:
+		return "content-provider"
+	case WarningValidationSet:
+		return "validation-set"
+	default:
+		return "other"
+	}
+}
+
+// Warning is a warning produced by the Writer.
+type Warning struct {
+	Kind WarningKind
+	// SnapName is the name of the snap the warning is about, if any
+	SnapName string
+	// Message is the formatted message of the warning
+	Message string
+}
+
+// warnf adds a warning of the given kind about the given snap that can
+// be later retrieved via StructuredWarnings or Warnings.
+func (w *Writer) warnf(kind WarningKind, snapName, format string, a ...any) {
+	w.warnings = append(w.warnings, Warning{
+		Kind:     kind,
+		SnapName: snapName,
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+// StructuredWarnings returns the warnings produced so far. No warnings
+// should be generated after Downloaded signaled complete, except by
+// CheckValidationSets.
+func (w *Writer) StructuredWarnings() []Warning {
+	return w.warnings
+}
@@ -23,16 +23,21 @@ package seedwriter
 import (
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/asserts/snapasserts"
+	"github.com/snapcore/snapd/gadget/quantity"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snap/channel"
 	"github.com/snapcore/snapd/snap/naming"
-	"github.com/snapcore/snapd/snap/squashfs"
+	"github.com/snapcore/snapd/snap/snapfile"
 	"github.com/snapcore/snapd/strutil"
 )
 
@@ -56,6 +61,11 @@ type Options struct {
 	// ManifestPath if set, specifies the file path where the
 	// seed.manifest file should be written.
 	ManifestPath string
+	// ChecksumManifestPath if set, specifies the file path where
+	// SeedSnaps writes the hex sha3-384 digests of the snap and
+	// component blobs of the seed, one "<digest>  <path>" line per
+	// blob with the path relative to SeedDir.
+	ChecksumManifestPath string
 
 	// IgnoreOptionFileExtentions if set, snaps and components will not be
 	// required to end in .snap or .comp, respectively.
@@ -63,6 +73,146 @@ type Options struct {
 
 	// Assertions to inject into the built image
 	ExtraAssertions []asserts.Assertion
+
+	// PrefetchedSnapAssertions holds, keyed by snap-id, assertions
+	// for snaps, e.g. snap-declaration and snap-revision ones, that
+	// are used instead of fetching them when present. They are still
+	// verified against the trusted keys.
+	PrefetchedSnapAssertions map[string][]asserts.Assertion
+
+	// AlwaysWriteOptions if set makes WriteMeta write the options.yaml
+	// of UC20+ seeds even when there are no snap overrides, with an
+	// empty list of snaps, instead of omitting it.
+	AlwaysWriteOptions bool
+
+	// Architecture if set overrides the architecture of the model
+	// as the one the local snaps of the seed must support. The
+	// architecture of the host writing the seed is never relevant.
+	Architecture string
+
+	// SystemUserAssertions are system-user assertions to embed into
+	// the seed so that the users can be created offline at first
+	// boot. They must apply to the model and be signed by one of the
+	// authorities it accepts for system-user assertions.
+	SystemUserAssertions []asserts.Assertion
+
+	// MaxSeedSize if set is the budget for the total size of the
+	// snap and component blobs of the seed, SeedSnaps fails if it
+	// would be exceeded.
+	MaxSeedSize quantity.Size
+
+	// EmitPerModeSnapDirs if set makes the Writer additionally create
+	// per-mode directories (systems/<label>/<mode>/snaps) holding
+	// symlinks to the seed snaps and components used in that mode,
+	// as an index for recovery tooling. It is only supported for
+	// UC20+ models.
+	EmitPerModeSnapDirs bool
+
+	// MaxAssertionAge if set makes Downloaded produce a warning for
+	// each assertion to be embedded in the seed that is older than it.
+	MaxAssertionAge time.Duration
+
+	// SnapPoolDir if set is an external directory holding the snap
+	// and component blobs of the seed under their seed filenames.
+	// SeedSnaps then checks the blobs in the pool against their
+	// assertions and creates relative symlinks to them in the seed
+	// instead of copying them, this supports read-only layered images
+	// where the pool is mounted separately at the same location
+	// relative to the seed. Snaps to download do not need to be
+	// downloaded into the seed in this case.
+	SnapPoolDir string
+
+	// EnforceTrackAlignment if set makes the Writer check that numeric
+	// tracks of the channels of the gadget and kernel snaps match the
+	// version of the base of the model, e.g. track 22 for core22.
+	EnforceTrackAlignment bool
+
+	// OnAssertion if set is invoked by WriteMeta with each assertion
+	// right before it is written into the seed. Returning an error
+	// vetoes the assertion and aborts writing the seed metadata.
+	OnAssertion func(a asserts.Assertion) error
+
+	// SnapOpener if set is used instead of snapfile.Open to open the
+	// snap files of the seed, see Writer.OpenSnap. This allows to seed
+	// snaps using custom container formats during development.
+	SnapOpener func(path string) (snap.Container, error)
+
+	// AppendToSystem if set makes the Writer append the extra snaps
+	// from the options snaps to the existing UC20+ system with Label
+	// instead of creating a new system. The snaps already in the
+	// system, in particular the model snaps, are not processed again
+	// and cannot be changed. Only options.yaml, the extra-snaps
+	// assertions and aux-info.json of the system are extended.
+	AppendToSystem bool
+
+	// Resume if set allows the Writer to continue writing the UC20+
+	// system with Label left behind by an interrupted previous
+	// attempt. The metadata and assertions of the system are written
+	// again, the snap and component blobs already in place, or in
+	// SnapPoolDir if set, are verified against their assertions and
+	// reused and the ones no longer part of the system are removed.
+	Resume bool
+
+	// RequireConnectableContentProviders if set makes Downloaded fail
+	// instead of warning when a content plug has no default-provider
+	// slot in the seed but only alternative slots, which would not be
+	// auto-connected on first boot.
+	RequireConnectableContentProviders bool
+
+	// DryRun if set makes the Writer go through all the steps and
+	// checks without writing anything to disk: SeedSnaps neither
+	// copies nor checks the snap blobs and WriteMeta writes nothing.
+	// What would have been written can be retrieved with Plan.
+	DryRun bool
+
+	// AuxInfoHook if set is called for each asserted snap of a UC20+
+	// system with the auxiliary information derived for it, the
+	// returned map is then written into aux-info.json instead. The
+	// snap is omitted from aux-info.json if nil or an empty map is
+	// returned.
+	AuxInfoHook func(snapID string, aux map[string]any) map[string]any
+
+	// CopyProgress if set is called by SeedSnaps for each snap or
+	// component blob, named by its snap name or <snap>+<component>
+	// reference: with zero bytes copied before a blob is copied and
+	// with bytesCopied equal to total once it is in place. Blobs that
+	// were already fetched into place are reported only once.
+	CopyProgress func(snapOrComp string, bytesCopied, total int64)
+
+	// SingleAssertionStream if set makes WriteMeta write all the
+	// assertions of a Core 16/18 seed concatenated, prerequisites
+	// first, into the single assertions/all file instead of one file
+	// per assertion. See ReadSingleAssertionStream.
+	SingleAssertionStream bool
+
+	// OmitTrustedKeyChains if set makes WriteMeta not write into the
+	// seed the account and account-key assertions that are part of
+	// Trusted, for seeds targeting devices that already trust them.
+	OmitTrustedKeyChains bool
+
+	// Trusted holds the account and account-key assertions that the
+	// devices the seed targets already trust, see OmitTrustedKeyChains.
+	Trusted []asserts.Assertion
+
+	// NoSeparateSnapd if set makes the Writer not add the snapd snap
+	// to the seed of a Core 18+ model (with a base but without a
+	// grade) for appliance images whose base already carries snapd.
+	// The base is then considered the snap carrying snapd. The model
+	// must not list snapd itself. Beware that snapd loads such seeds
+	// only if it is told the same.
+	NoSeparateSnapd bool
+
+	// SortSnapsAlphabetically if set makes WriteMeta list the snaps
+	// in seed.yaml or options.yaml sorted by name instead of in
+	// resolution order. The essential snaps keep their boot order
+	// ahead of the others and model snaps still precede extra snaps.
+	// On Core 16/18 the snaps also remain grouped by type.
+	SortSnapsAlphabetically bool
+
+	// CheckGadgetDefaults if set makes Downloaded fail if the
+	// defaults in the gadget.yaml of the gadget snap are for snaps
+	// that are not part of the seed. See Writer.GadgetDefaults.
+	CheckGadgetDefaults bool
 }
 
 // manifest returns either the manifest already provided by the
@@ -74,6 +224,57 @@ func (opts *Options) manifest() *Manifest {
 	return opts.Manifest
 }
 
+// onAssertion invokes the OnAssertion callback if one is set.
+func (opts *Options) onAssertion(a asserts.Assertion) error {
+	if opts.OnAssertion == nil {
+		return nil
+	}
+	return opts.OnAssertion(a)
+}
+
+// omitRef returns whether the assertion referenced by ref should not be
+// written into the seed because it is part of the key chains the target
+// devices already trust.
+func (opts *Options) omitRef(ref *asserts.Ref) bool {
+	if !opts.OmitTrustedKeyChains {
+		return false
+	}
+	if ref.Type != asserts.AccountType && ref.Type != asserts.AccountKeyType {
+		return false
+	}
+	u := ref.Unique()
+	for _, a := range opts.Trusted {
+		if a.Ref().Unique() == u {
+			return true
+		}
+	}
+	return false
+}
+
+// openSnap opens the snap file at path with the SnapOpener if one is set,
+// or with snapfile.Open otherwise.
+func (opts *Options) openSnap(path string) (snap.Container, error) {
+	if opts.SnapOpener == nil {
+		return snapfile.Open(path)
+	}
+	snapf, err := opts.SnapOpener(path)
+	if err != nil {
+		return nil, err
+	}
+	if snapf == nil {
+		return nil, fmt.Errorf("cannot open snap %q: snap opener returned no container", path)
+	}
+	return snapf, nil
+}
+
+// architecture returns the architecture the seed is built for.
+func (opts *Options) architecture(model *asserts.Model) string {
+	if opts.Architecture != "" {
+		return opts.Architecture
+	}
+	return model.Architecture()
+}
+
 // OptionsComponent represents an options-referred snap with its option values.
 // E.g. a component passed to ubuntu-image via --comp <snap_name>+<comp_name>.
 type OptionsComponent struct {
@@ -87,10 +288,13 @@ type OptionsComponent struct {
 // the components passed via the --comp option. If there is a component option
 // but no matching snap option, an implicit OptionsSnap is created.
 type OptionsSnap struct {
-	Name       string
-	SnapID     string
-	Path       string
-	Channel    string
+	Name    string
+	SnapID  string
+	Path    string
+	Channel string
+	// Revision, if set, is the exact revision of the store snap to
+	// seed, it cannot be combined with Path.
+	Revision   snap.Revision
 	Components []OptionsComponent
 }
 
@@ -123,6 +327,10 @@ type SeedSnap struct {
 	Channel string
 	Path    string
 
+	// Revision, if set, is the revision the snap is pinned to by its
+	// OptionsSnap. The snap must then be fetched at this revision.
+	Revision snap.Revision
+
 	// Components are the components of the snap to be copied to the seed.
 	// If using local components, the slice will be set by
 	// Writer.AddComponentsToSnap(), as we don't know initially which ones
@@ -140,6 +348,12 @@ type SeedSnap struct {
 	local      bool
 	modelSnap  *asserts.ModelSnap
 	optionSnap *OptionsSnap
+	// implicit is set for snaps added by the Writer itself to satisfy
+	// the needs of other seed snaps
+	implicit bool
+	// existing is set for snaps that are already part of the system
+	// the Writer is appending to
+	existing bool
 }
 
 // SeedComponent holds details of a component being added to a seed.
@@ -147,7 +361,15 @@ type SeedComponent struct {
 	naming.ComponentRef
 	Path string
 
+	// Revision, if set, is the revision the component is pinned to by
+	// the validation sets enforced by the model or by the manifest. The
+	// component must then be fetched at this revision.
+	Revision snap.Revision
+
 	Info *snap.ComponentInfo
+	// DownloadInfo is the download information for a component to
+	// fetch, if known.
+	DownloadInfo snap.DownloadInfo
 }
 
 func (sn *SeedSnap) modes() []string {
@@ -222,7 +444,7 @@ type Writer struct {
 	// warnings keep a list of warnings produced during the
 	// process, no more warnings should be produced after
 	// Downloaded signaled complete
-	warnings []string
+	warnings []Warning
 
 	db asserts.RODatabase
 
@@ -246,12 +468,19 @@ type Writer struct {
 
 	availableSnaps  *naming.SnapSet
 	availableByMode map[string]*naming.SnapSet
-	byModeSnaps     map[string][]*SeedSnap
+	// availableByID tracks the available snaps by the snap-id of
+	// their info, to detect option snaps resolving to the same snap
+	// as a differently named one
+	availableByID map[string]*SeedSnap
+	byModeSnaps   map[string][]*SeedSnap
 
 	// toDownload tracks which set of snaps SnapsToDownload should compute
 	// next
 	toDownload              snapsToDownloadSet
 	toDownloadConsideredNum int
+	// pendingDownloads are the snaps returned by the last call to
+	// SnapsToDownload
+	pendingDownloads []*SeedSnap
 
 	snapsFromModel []*SeedSnap
 	extraSnaps     []*SeedSnap
@@ -267,6 +496,17 @@ type Writer struct {
 	// initialized from the one provided in options, or it
 	// may be initialized to a new copy.
 	manifest *Manifest
+	// checksums holds the entries of the checksum manifest
+	// collected by SeedSnaps if Options.ChecksumManifestPath is set
+	checksums []blobChecksum
+	// gadgetDefaults caches the defaults of the gadget snap, see
+	// GadgetDefaults
+	gadgetDefaults     map[string]map[string]any
+	gadgetDefaultsRead bool
+
+	// existing holds the content of the system being appended to
+	// if Options.AppendToSystem is set
+	existing *existingSystem
 }
 
 type policy interface {
@@ -333,13 +573,49 @@ func New(model *asserts.Model, opts *Options) (*Writer, error) {
 		if err := asserts.IsValidSystemLabel(opts.Label); err != nil {
 			return nil, err
 		}
+		if opts.AppendToSystem && opts.Resume {
+			return nil, fmt.Errorf("cannot both resume writing and append to an existing system")
+		}
+		if opts.DryRun && (opts.AppendToSystem || opts.Resume) {
+			return nil, fmt.Errorf("cannot use dry-run mode to append to or resume writing a system")
+		}
+		if opts.SingleAssertionStream {
+			return nil, fmt.Errorf("cannot write a single assertion stream for a UC20+ system")
+		}
+		if opts.AppendToSystem {
+			if err := checkAppendOptions(opts); err != nil {
+				return nil, err
+			}
+			w.existing = &existingSystem{}
+		}
+		if opts.NoSeparateSnapd {
+			return nil, fmt.Errorf("cannot omit the snapd snap from the seed of a UC20+ model")
+		}
 		pol = &policy20{model: model, opts: opts, warningf: w.warningf}
-		treeImpl = &tree20{grade: model.Grade(), opts: opts}
+		treeImpl = &tree20{grade: model.Grade(), opts: opts, existing: w.existing}
 	} else {
-		pol = &policy16{model: model, opts: opts, warningf: w.warningf}
+		if opts.EmitPerModeSnapDirs {
+			return nil, fmt.Errorf("cannot emit per-mode snap directories for a model without a grade")
+		}
+		if opts.AppendToSystem {
+			return nil, fmt.Errorf("cannot append to an existing system for a model without a grade")
+		}
+		if opts.Resume {
+			return nil, fmt.Errorf("cannot resume writing a seed for a model without a grade")
+		}
+		if opts.NoSeparateSnapd {
+			if err := checkNoSeparateSnapd(model); err != nil {
+				return nil, err
+			}
+		}
+		pol = &policy16{model: model, opts: opts, warnf: w.warnf}
 		treeImpl = &tree16{opts: opts}
 	}
 
+	if opts.SnapPoolDir != "" && !osutil.IsDirectory(opts.SnapPoolDir) {
+		return nil, fmt.Errorf("cannot use snap pool directory %q: not a directory", opts.SnapPoolDir)
+	}
+
 	if opts.DefaultChannel != "" {
 		deflCh, err := channel.ParseVerbatim(opts.DefaultChannel, "_")
 		if err != nil {
@@ -350,11 +626,152 @@ func New(model *asserts.Model, opts *Options) (*Writer, error) {
 		}
 	}
 
+	for _, a := range opts.SystemUserAssertions {
+		if err := checkSystemUserAssertion(model, a); err != nil {
+			return nil, err
+		}
+	}
+
 	w.tree = treeImpl
 	w.policy = pol
 	return w, nil
 }
 
+// checkSystemUserAssertion checks that the given assertion is a
+// system-user assertion usable for creating a user on a device with
+// the given model.
+func checkSystemUserAssertion(model *asserts.Model, a asserts.Assertion) error {
+	su, ok := a.(*asserts.SystemUser)
+	if !ok {
+		return fmt.Errorf("cannot use %s assertion as a system-user assertion", a.Type().Name)
+	}
+	errPrefix := fmt.Sprintf("cannot use system-user assertion for %q", su.Email())
+	if su.BrandID() != model.BrandID() {
+		return fmt.Errorf("%s: brand %q does not match the model brand %q", errPrefix, su.BrandID(), model.BrandID())
+	}
+	// this mirrors the checks done when creating the user at runtime
+	sysUserAuths := model.SystemUserAuthority()
+	if len(sysUserAuths) > 0 && !strutil.ListContains(sysUserAuths, su.AuthorityID()) {
+		return fmt.Errorf("%s: %q not in accepted authorities %q", errPrefix, su.AuthorityID(), sysUserAuths)
+	}
+	if len(su.Series()) > 0 && !strutil.ListContains(su.Series(), model.Series()) {
+		return fmt.Errorf("%s: %q not in series %q", errPrefix, model.Series(), su.Series())
+	}
+	if len(su.Models()) > 0 && !strutil.ListContains(su.Models(), model.Model()) {
+		return fmt.Errorf("%s: %q not in models %q", errPrefix, model.Model(), su.Models())
+	}
+	if !su.Until().After(timeNow()) {
+		return fmt.Errorf("%s: assertion expired at %s", errPrefix, su.Until().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// OptionsModelError reports all the ways in which the options of a Writer
+// are not usable with its model, see Writer.ValidateOptionsAgainstModel.
+type OptionsModelError struct {
+	Violations []error
+}
+
+func (e *OptionsModelError) Error() string {
+	if len(e.Violations) == 1 {
+		return fmt.Sprintf("cannot use options with the model: %v", e.Violations[0])
+	}
+	msgs := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		msgs = append(msgs, fmt.Sprintf("- %v", v))
+	}
+	return fmt.Sprintf("cannot use options with the model:\n%s", strings.Join(msgs, "\n"))
+}
+
+// ValidateOptionsAgainstModel checks upfront the default channel, the extra
+// assertions of the Writer options and the given option snaps against the
+// model, in particular against the features reserved to models of grade
+// dangerous. Instead of failing at the first problem, as the later steps of
+// writing the seed do, it returns an *OptionsModelError reporting all of
+// them. It can be invoked right after New, and does not change the state of
+// the Writer.
+func (w *Writer) ValidateOptionsAgainstModel(optSnaps []*OptionsSnap) error {
+	var violations []error
+	addViolation := func(err error) {
+		violations = append(violations, err)
+	}
+
+	if w.opts.DefaultChannel != "" {
+		deflCh, err := channel.ParseVerbatim(w.opts.DefaultChannel, "_")
+		if err != nil {
+			addViolation(fmt.Errorf("cannot use global default option channel: %v", err))
+		} else if err := w.policy.checkDefaultChannel(deflCh); err != nil {
+			addViolation(err)
+		}
+	}
+
+	for _, a := range w.opts.ExtraAssertions {
+		if a.Type() != asserts.SystemUserType {
+			continue
+		}
+		if w.model.Grade() != asserts.ModelGradeUnset && w.model.Grade() != asserts.ModelDangerous {
+			addViolation(fmt.Errorf("cannot use extra system-user assertion for %q with a model of grade higher than dangerous", a.HeaderString("email")))
+			continue
+		}
+		if err := checkSystemUserAssertion(w.model, a); err != nil {
+			addViolation(err)
+		}
+	}
+
+	modelSnaps := make(map[string]*asserts.ModelSnap)
+	for _, modSnap := range w.model.AllSnaps() {
+		modelSnaps[modSnap.SnapName()] = modSnap
+	}
+	for _, sn := range optSnaps {
+		whichSnap := sn.Name
+		if sn.Path != "" {
+			whichSnap = sn.Path
+		}
+		dangerous := func(what string) {
+			if err := w.policy.allowsDangerousFeatures(); err != nil {
+				addViolation(fmt.Errorf("cannot use %s for option snap %q: %v", what, whichSnap, err))
+			}
+		}
+
+		modSnap := modelSnaps[sn.Name]
+		switch {
+		case sn.Path != "":
+			dangerous("a local snap")
+		case modSnap == nil:
+			dangerous("an extra snap")
+		}
+		if !sn.Revision.Unset() {
+			dangerous("a revision")
+		}
+		if sn.Channel != "" {
+			ch, err := channel.ParseVerbatim(sn.Channel, "_")
+			if err != nil {
+				addViolation(fmt.Errorf("cannot use option channel for snap %q: %v", whichSnap, err))
+			} else if err := w.policy.checkSnapChannel(ch, whichSnap); err != nil {
+				addViolation(err)
+			}
+		}
+		for _, comp := range sn.Components {
+			if comp.Path != "" {
+				dangerous(fmt.Sprintf("local component %q", comp.Path))
+				continue
+			}
+			if modSnap == nil {
+				// already reported for the extra snap
+				continue
+			}
+			if _, ok := modSnap.Components[comp.Name]; !ok {
+				dangerous(fmt.Sprintf("extra component %q", comp.Name))
+			}
+		}
+	}
+
+	if len(violations) != 0 {
+		return &OptionsModelError{Violations: violations}
+	}
+	return nil
+}
+
 type writerStep int
 
 const (
@@ -423,7 +840,7 @@ func (w *Writer) checkStep(thisStep writerStep) error {
 
 // warningf adds a warning that can be later retrieved via Warnings.
 func (w *Writer) warningf(format string, a ...any) {
-	w.warnings = append(w.warnings, fmt.Sprintf(format, a...))
+	w.warnf(WarningOther, "", format, a...)
 }
 
 func (w *Writer) validateComponent(optComp *OptionsComponent) error {
@@ -476,8 +893,14 @@ func (w *Writer) SetOptionsSnaps(optSnaps []*OptionsSnap) error {
 			if w.byNameOptSnaps.Contains(sn) {
 				return fmt.Errorf("snap %q is repeated in options", snapName)
 			}
+			if err := w.checkAppendable(sn); err != nil {
+				return err
+			}
 			w.byNameOptSnaps.Add(sn)
 		} else {
+			if !sn.Revision.Unset() {
+				return fmt.Errorf("cannot specify a revision for local option snap %q", sn.Path)
+			}
 			if !strings.HasSuffix(sn.Path, ".snap") && !w.opts.IgnoreOptionFileExtentions {
 				return fmt.Errorf("local option snap %q does not end in .snap", sn.Path)
 			}
@@ -488,6 +911,14 @@ func (w *Writer) SetOptionsSnaps(optSnaps []*OptionsSnap) error {
 			whichSnap = sn.Path
 			local = true
 		}
+		if !sn.Revision.Unset() {
+			if sn.Revision.Local() {
+				return fmt.Errorf("cannot use local revision %s for option snap %q", sn.Revision, whichSnap)
+			}
+			if err := w.policy.allowsDangerousFeatures(); err != nil {
+				return err
+			}
+		}
 		if sn.Channel != "" {
 			ch, err := channel.ParseVerbatim(sn.Channel, "_")
 			if err != nil {
@@ -522,6 +953,45 @@ func (w *Writer) SetOptionsSnaps(optSnaps []*OptionsSnap) error {
 	return nil
 }
 
+// RemoveOptionsSnap removes the option snap with the given name
+// previously set with SetOptionsSnaps, together with the components
+// requested through it. Local option snaps cannot be removed as their
+// names are known only after Start. It is an error to remove a snap
+// required by the model.
+// It can be invoked only before Start.
+func (w *Writer) RemoveOptionsSnap(name string) error {
+	if w.expectedStep != setOptionsSnapsStep && w.expectedStep != startStep {
+		return fmt.Errorf("internal error: seedwriter.Writer cannot remove option snaps after Start")
+	}
+
+	optSnap, _ := w.byNameOptSnaps.Lookup(naming.Snap(name)).(*OptionsSnap)
+	if optSnap == nil {
+		return fmt.Errorf("cannot remove option snap %q: not set in options", name)
+	}
+	for _, modSnap := range w.model.AllSnaps() {
+		if naming.SameSnap(modSnap, optSnap) && modSnap.Presence == "required" {
+			return fmt.Errorf("cannot remove option snap %q: required by the model", name)
+		}
+	}
+
+	// do not modify the slice passed to SetOptionsSnaps
+	optSnaps := make([]*OptionsSnap, 0, len(w.optionsSnaps)-1)
+	byNameOptSnaps := naming.NewSnapSet(nil)
+	for _, sn := range w.optionsSnaps {
+		if sn == optSnap {
+			continue
+		}
+		optSnaps = append(optSnaps, sn)
+		if sn.Name != "" {
+			byNameOptSnaps.Add(sn)
+		}
+	}
+	w.optionsSnaps = optSnaps
+	w.byNameOptSnaps = byNameOptSnaps
+
+	return nil
+}
+
 // SystemAlreadyExistsError is an error returned when given seed system already
 // exists.
 type SystemAlreadyExistsError struct {
@@ -637,11 +1107,15 @@ func (w *Writer) Start(db asserts.RODatabase, f SeedAssertionFetcher) error {
 
 	w.modelRefs = f.Refs()
 
-	if len(w.opts.ExtraAssertions) != 0 {
+	extraAssertions := w.opts.ExtraAssertions
+	if len(w.opts.SystemUserAssertions) != 0 {
+		extraAssertions = append(append([]asserts.Assertion(nil), extraAssertions...), w.opts.SystemUserAssertions...)
+	}
+	if len(extraAssertions) != 0 {
 
-		f.AddExtraAssertions(w.opts.ExtraAssertions)
+		f.AddExtraAssertions(extraAssertions)
 
-		for _, extraAssertion := range w.opts.ExtraAssertions {
+		for _, extraAssertion := range extraAssertions {
 			if err := f.Save(extraAssertion); err != nil {
 				return fmt.Errorf(
 					"cannot fetch and check prerequisites for an injected assertion: %v",
@@ -653,10 +1127,29 @@ func (w *Writer) Start(db asserts.RODatabase, f SeedAssertionFetcher) error {
 		w.extraRefs = f.Refs()[len(w.modelRefs):]
 	}
 
+	if len(w.opts.PrefetchedSnapAssertions) != 0 {
+		var prefetched []asserts.Assertion
+		for snapID, as := range w.opts.PrefetchedSnapAssertions {
+			for _, a := range as {
+				if id := a.HeaderString("snap-id"); id != "" && id != snapID {
+					return fmt.Errorf("cannot use prefetched %s assertion for snap-id %q: assertion is for snap-id %q", a.Type().Name, snapID, id)
+				}
+			}
+			prefetched = append(prefetched, as...)
+		}
+		f.AddPrefetchedAssertions(prefetched)
+	}
+
 	if err := w.tree.mkFixedDirs(); err != nil {
 		return err
 	}
 
+	if w.existing != nil {
+		if err := w.loadExistingSystem(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -684,6 +1177,13 @@ func (w *Writer) LocalSnaps() ([]*SeedSnap, error) {
 	return lsnaps, nil
 }
 
+// OpenSnap opens the snap file at path using Options.SnapOpener if set,
+// or snapfile.Open otherwise. It should be used by the callers to open
+// the local snaps returned by LocalSnaps to derive their metadata.
+func (w *Writer) OpenSnap(path string) (snap.Container, error) {
+	return w.opts.openSnap(path)
+}
+
 // InfoDerived checks the local snaps metadata provided via setting it
 // into the SeedSnaps returned by the previous LocalSnaps.
 func (w *Writer) InfoDerived() error {
@@ -710,15 +1210,26 @@ func (w *Writer) InfoDerived() error {
 			}
 		}
 
+		if err := checkArchitecture(sn, w.opts.architecture(w.model)); err != nil {
+			return err
+		}
+
 		// local snap gets local revision
 		if sn.Info.Revision.Unset() {
 			sn.Info.Revision = snap.R(-1)
 		}
 
-		if w.byRefLocalSnaps.Contains(sn) {
+		if other, _ := w.byRefLocalSnaps.Lookup(sn).(*SeedSnap); other != nil {
+			if other.SnapName() != sn.SnapName() {
+				return fmt.Errorf("cannot add both local snap %q and local snap %q as they have the same snap-id %q", other.SnapName(), sn.SnapName(), sn.ID())
+			}
 			return fmt.Errorf("local snap %q is repeated in options", sn.SnapName())
 		}
 
+		if err := w.checkAppendable(sn); err != nil {
+			return err
+		}
+
 		// in case, merge channel given by name separately
 		optSnap, _ := w.byNameOptSnaps.Lookup(sn).(*OptionsSnap)
 		if optSnap != nil {
@@ -750,6 +1261,9 @@ func (w *Writer) SetInfo(sn *SeedSnap, info *snap.Info, seedComps map[string]*Se
 			return err
 		}
 	}
+	if err := checkModelRequiredComponents(sn, info); err != nil {
+		return err
+	}
 	sn.Info = info
 
 	if sn.local {
@@ -757,13 +1271,23 @@ func (w *Writer) SetInfo(sn *SeedSnap, info *snap.Info, seedComps map[string]*Se
 		return w.assignLocalComponents(sn, seedComps)
 	}
 
+	// local snaps are checked by InfoDerived, the architectures of
+	// store snaps might not be known
+	if len(info.Architectures) != 0 {
+		if err := checkArchitecture(sn, w.opts.architecture(w.model)); err != nil {
+			return err
+		}
+	}
+
 	for i := range sn.Components {
 		seedComp, ok := seedComps[sn.Components[i].ComponentName]
 		if !ok {
 			return fmt.Errorf("store did not return information about %s",
 				sn.Components[i].ComponentName)
 		}
+		pinned := sn.Components[i].Revision
 		sn.Components[i] = *seedComp
+		sn.Components[i].Revision = pinned
 		// Fill the path as this is a non-local component
 		compPath, err := w.tree.componentPath(sn, &sn.Components[i])
 		if err != nil {
@@ -781,6 +1305,27 @@ func (w *Writer) SetInfo(sn *SeedSnap, info *snap.Info, seedComps map[string]*Se
 	return nil
 }
 
+// checkModelRequiredComponents checks that the components the model
+// requires for the seed snap sn are defined by its snap info.
+func checkModelRequiredComponents(sn *SeedSnap, info *snap.Info) error {
+	if sn.modelSnap == nil {
+		return nil
+	}
+	compNames := make([]string, 0, len(sn.modelSnap.Components))
+	for compName, modComp := range sn.modelSnap.Components {
+		if modComp.Presence == "required" {
+			compNames = append(compNames, compName)
+		}
+	}
+	sort.Strings(compNames)
+	for _, compName := range compNames {
+		if _, ok := info.Components[compName]; !ok {
+			return fmt.Errorf("required component %q is not defined by snap %q", compName, info.SnapName())
+		}
+	}
+	return nil
+}
+
 type byCompName []SeedComponent
 
 func (c byCompName) Len() int           { return len(c) }
@@ -839,6 +1384,46 @@ func (w *Writer) Manifest() *Manifest {
 	return w.manifest
 }
 
+// EffectiveOptions returns a copy of the options the Writer operates
+// with, after the defaults were applied by New. The architecture is the
+// one the seed is built for and the default channel is normalized, a
+// risk-only default channel is kept without a track as it is resolved
+// against the tracks of the snaps of the seed. The manifest is not
+// included, see Manifest.
+func (w *Writer) EffectiveOptions() Options {
+	opts := *w.opts
+	opts.Architecture = w.opts.architecture(w.model)
+	opts.DefaultChannel = normalizedDefaultChannel(w.opts.DefaultChannel)
+	opts.Manifest = nil
+	opts.ExtraAssertions = append([]asserts.Assertion(nil), w.opts.ExtraAssertions...)
+	opts.SystemUserAssertions = append([]asserts.Assertion(nil), w.opts.SystemUserAssertions...)
+	opts.Trusted = append([]asserts.Assertion(nil), w.opts.Trusted...)
+	if w.opts.PrefetchedSnapAssertions != nil {
+		opts.PrefetchedSnapAssertions = make(map[string][]asserts.Assertion, len(w.opts.PrefetchedSnapAssertions))
+		for snapID, as := range w.opts.PrefetchedSnapAssertions {
+			opts.PrefetchedSnapAssertions[snapID] = append([]asserts.Assertion(nil), as...)
+		}
+	}
+	return opts
+}
+
+// normalizedDefaultChannel returns the normalized form of the given
+// default channel, which New checked to be valid.
+func normalizedDefaultChannel(defaultChannel string) string {
+	if defaultChannel == "" {
+		return ""
+	}
+	ch, err := channel.ParseVerbatim(defaultChannel, "_")
+	if err != nil {
+		return defaultChannel
+	}
+	clean := ch.Clean()
+	if ch.Track == "" {
+		return clean.String()
+	}
+	return clean.Full()
+}
+
 // snapsToDownloadSet indicates which set of snaps SnapsToDownload should compute
 type snapsToDownloadSet int
 
@@ -887,6 +1472,9 @@ func (w *Writer) modelSnapToSeed(modSnap *asserts.ModelSnap) (*SeedSnap, error)
 				}
 			}
 		}
+		if err := w.pinComponentRevisions(modSnap, seedCompsMap); err != nil {
+			return nil, err
+		}
 		seedComps := make([]SeedComponent, 0, len(seedCompsMap))
 		for _, sc := range seedCompsMap {
 			seedComps = append(seedComps, sc)
@@ -898,6 +1486,9 @@ func (w *Writer) modelSnapToSeed(modSnap *asserts.ModelSnap) (*SeedSnap, error)
 			optionSnap: optSnap,
 			Components: seedComps,
 		}
+		if optSnap != nil {
+			sn.Revision = optSnap.Revision
+		}
 	} else {
 		optSnap = sn.optionSnap
 	}
@@ -907,6 +1498,13 @@ func (w *Writer) modelSnapToSeed(modSnap *asserts.ModelSnap) (*SeedSnap, error)
 		return nil, err
 	}
 	sn.modelSnap = modSnap
+	if sn.local {
+		// the info of local snaps is set before they are
+		// matched with the model
+		if err := checkModelRequiredComponents(sn, sn.Info); err != nil {
+			return nil, err
+		}
+	}
 	sn.Channel = channel
 	return sn, nil
 }
@@ -998,7 +1596,8 @@ func (w *Writer) extraSnapToSeed(optSnap *OptionsSnap) (*SeedSnap, error) {
 			})
 		}
 		sn = &SeedSnap{
-			SnapRef: optSnap,
+			SnapRef:  optSnap,
+			Revision: optSnap.Revision,
 
 			local:      false,
 			optionSnap: optSnap,
@@ -1047,8 +1646,20 @@ func (w *Writer) SnapsToDownload() (snaps []*SeedSnap, err error) {
 		return nil, err
 	}
 
+	snaps, err = w.snapsToDownload()
+	if err != nil {
+		return nil, err
+	}
+	w.pendingDownloads = snaps
+	return snaps, nil
+}
+
+func (w *Writer) snapsToDownload() ([]*SeedSnap, error) {
 	switch w.toDownload {
 	case toDownloadModel:
+		if w.existing != nil {
+			return w.existingSnapsToDownload()
+		}
 		modSnaps, err := w.modSnaps()
 		if err != nil {
 			return nil, err
@@ -1060,6 +1671,9 @@ func (w *Writer) SnapsToDownload() (snaps []*SeedSnap, err error) {
 		if err != nil {
 			return nil, err
 		}
+		if err := w.checkTrackAlignment(); err != nil {
+			return nil, err
+		}
 		if w.extraSnapsGuessNum > 0 {
 			// this check is here in case we relax the checks in
 			// SetOptionsSnaps
@@ -1069,16 +1683,32 @@ func (w *Writer) SnapsToDownload() (snaps []*SeedSnap, err error) {
 		}
 		return toDownload, nil
 	case toDownloadImplicit:
-		return w.modelSnapsToDownload(w.policy.implicitSnaps(w.availableByMode))
+		toDownload, err := w.modelSnapsToDownload(w.policy.implicitSnaps(w.availableByMode))
+		if err != nil {
+			return nil, err
+		}
+		markImplicit(w.snapsFromModel[len(w.snapsFromModel)-w.toDownloadConsideredNum:])
+		return toDownload, nil
 	case toDownloadExtra:
 		return w.extraSnapsToDownload(w.optExtraSnaps())
 	case toDownloadExtraImplicit:
-		return w.extraSnapsToDownload(w.policy.implicitExtraSnaps(w.availableByMode))
+		toDownload, err := w.extraSnapsToDownload(w.policy.implicitExtraSnaps(w.availableByMode))
+		if err != nil {
+			return nil, err
+		}
+		markImplicit(w.extraSnaps[len(w.extraSnaps)-w.toDownloadConsideredNum:])
+		return toDownload, nil
 	default:
 		panic(fmt.Sprintf("unknown to-download set: %d", w.toDownload))
 	}
 }
 
+func markImplicit(snaps []*SeedSnap) {
+	for _, sn := range snaps {
+		sn.implicit = true
+	}
+}
+
 func (w *Writer) resolveChannel(whichSnap string, modSnap *asserts.ModelSnap, optSnap *OptionsSnap) (string, error) {
 	var optChannel string
 	if optSnap != nil {
@@ -1120,6 +1750,57 @@ func (w *Writer) resolveChannel(whichSnap string, modSnap *asserts.ModelSnap, op
 	return resChannel, nil
 }
 
+// baseTrackRegexp matches the conventional names of the core bases,
+// capturing their version.
+var baseTrackRegexp = regexp.MustCompile(`^core([0-9]+)$`)
+
+// checkTrackAlignment checks, if requested, that the numeric tracks of
+// the gadget and kernel snaps match the version of the model base.
+func (w *Writer) checkTrackAlignment() error {
+	if !w.opts.EnforceTrackAlignment {
+		return nil
+	}
+	m := baseTrackRegexp.FindStringSubmatch(w.model.Base())
+	if m == nil {
+		// no base or not following the coreNN convention
+		return nil
+	}
+	baseVersion := m[1]
+	for _, sn := range w.snapsFromModel {
+		if sn.modelSnap == nil {
+			continue
+		}
+		switch sn.modelSnap.SnapType {
+		case "gadget", "kernel":
+		default:
+			continue
+		}
+		ch, err := channel.Parse(sn.Channel, "")
+		if err != nil {
+			return fmt.Errorf("cannot check track of %s snap %q: %v", sn.modelSnap.SnapType, sn.SnapName(), err)
+		}
+		if !isNumericTrack(ch.Track) {
+			continue
+		}
+		if ch.Track != baseVersion {
+			return fmt.Errorf("cannot use %s snap %q from track %q with base %q: expected track %q", sn.modelSnap.SnapType, sn.SnapName(), ch.Track, w.model.Base(), baseVersion)
+		}
+	}
+	return nil
+}
+
+func isNumericTrack(track string) bool {
+	if track == "" {
+		return false
+	}
+	for _, r := range track {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
 func (w *Writer) checkBase(sn *SeedSnap) error {
 	info := sn.Info
 	// Validity check, note that we could support this case
@@ -1136,6 +1817,9 @@ func (w *Writer) checkBase(sn *SeedSnap) error {
 
 	modes := sn.modes()
 	err := w.policy.checkBase(info, modes, w.availableByMode)
+	if err == nil {
+		err = w.checkBaseChain(info, modes)
+	}
 	if err != nil {
 		// in dangerous mode check base only at the end
 		// allowing overrides to provide the new base as well
@@ -1146,6 +1830,34 @@ func (w *Writer) checkBase(sn *SeedSnap) error {
 	return err
 }
 
+// checkBaseChain walks the chain of bases of the snap with the given
+// info, in case its base declares a base itself, and checks that all
+// the ancestors of the direct base, which was already checked, are
+// available as well. Cycles in the chain are reported as errors.
+func (w *Writer) checkBaseChain(info *snap.Info, modes []string) error {
+	chain := []string{info.SnapName()}
+	cur := info
+	for cur.Base != "" && cur.Base != "none" {
+		if strutil.ListContains(chain, cur.Base) {
+			return fmt.Errorf("cannot add snap %q: base chain has a cycle: %s", info.SnapName(), strings.Join(append(chain, cur.Base), " -> "))
+		}
+		if cur != info {
+			if err := w.policy.checkBase(cur, modes, w.availableByMode); err != nil {
+				return fmt.Errorf("cannot add snap %q without also adding its base ancestor %q explicitly (base chain: %s)", info.SnapName(), cur.Base, strings.Join(append(chain, cur.Base), " -> "))
+			}
+		}
+		chain = append(chain, cur.Base)
+		baseSn, _ := w.availableSnaps.Lookup(naming.Snap(cur.Base)).(*SeedSnap)
+		if baseSn == nil || baseSn.Info == nil {
+			// the base is not known yet, its own chain will be
+			// checked once it is
+			return nil
+		}
+		cur = baseSn.Info
+	}
+	return nil
+}
+
 func (w *Writer) recordUsageWithThePolicy(modSnaps []*asserts.ModelSnap) {
 	for _, modSnap := range modSnaps {
 		w.policy.recordSnapNameUsage(modSnap.Name)
@@ -1247,7 +1959,9 @@ func (w *Writer) ensureARefs(upToSnap *SeedSnap, fetchAsserts AssertsFetchFunc)
 	}
 
 	indexAfter, err := applyFromUpTo(w.consideredForAssertionsIndex, func(sn *SeedSnap) error {
-		if sn.Info.ID() == "" {
+		if sn.Info.ID() == "" || sn.existing {
+			// the assertions of existing snaps are already in
+			// the system
 			return nil
 		}
 		aRefs, err := fetchAsserts(sn, w.systemSnap, w.kernelSnap)
@@ -1272,6 +1986,7 @@ func (w *Writer) downloaded(seedSnaps []*SeedSnap, fetchAsserts AssertsFetchFunc
 		w.availableSnaps = naming.NewSnapSet(nil)
 		w.availableByMode = make(map[string]*naming.SnapSet)
 		w.availableByMode["run"] = naming.NewSnapSet(nil)
+		w.availableByID = make(map[string]*SeedSnap)
 		w.byModeSnaps = make(map[string][]*SeedSnap)
 	}
 
@@ -1279,6 +1994,17 @@ func (w *Writer) downloaded(seedSnaps []*SeedSnap, fetchAsserts AssertsFetchFunc
 		if sn.Info == nil {
 			return fmt.Errorf("internal error: before seedwriter.Writer.Downloaded snap %q Info should have been set", sn.SnapName())
 		}
+		if !sn.Revision.Unset() && sn.Info.Revision != sn.Revision {
+			return fmt.Errorf("snap %q was fetched at revision %s instead of the requested revision %s", sn.SnapName(), sn.Info.Revision, sn.Revision)
+		}
+		if snapID := sn.Info.ID(); snapID != "" {
+			other := w.availableByID[snapID]
+			if other == nil {
+				w.availableByID[snapID] = sn
+			} else if other.SnapName() != sn.SnapName() && (other.optionSnap != nil || sn.optionSnap != nil) {
+				return fmt.Errorf("cannot add both snap %q and snap %q as they have the same snap-id %q", other.SnapName(), sn.SnapName(), snapID)
+			}
+		}
 		w.availableSnaps.Add(sn)
 		for _, mode := range sn.modes() {
 			byMode := w.availableByMode[mode]
@@ -1306,6 +2032,10 @@ func (w *Writer) downloaded(seedSnaps []*SeedSnap, fetchAsserts AssertsFetchFunc
 			return err
 		}
 
+		if err := checkPinnedComponents(sn); err != nil {
+			return err
+		}
+
 		if info.ID() != "" {
 			if err := w.ensureARefs(sn, fetchAsserts); err != nil {
 				return err
@@ -1359,6 +2089,11 @@ func (w *Writer) Downloaded(fetchAsserts AssertsFetchFunc) (complete bool, err e
 	}
 
 	considered = considered[len(considered)-w.toDownloadConsideredNum:]
+	if w.existing != nil && w.toDownload == toDownloadModel {
+		// the extra snaps already in the system are available as
+		// well before considering the ones to append
+		considered = append(considered, w.existing.extraSnaps...)
+	}
 	err = w.downloaded(considered, fetchAsserts)
 	if err != nil {
 		return false, err
@@ -1404,18 +2139,38 @@ func (w *Writer) Downloaded(fetchAsserts AssertsFetchFunc) (complete bool, err e
 		return false, err
 	}
 
+	if err := w.warnAboutOldAssertions(); err != nil {
+		return false, err
+	}
+
 	if err := w.checkPrereqs(); err != nil {
 		return false, err
 	}
 
+	if w.opts.CheckGadgetDefaults {
+		if err := w.checkGadgetDefaults(); err != nil {
+			return false, err
+		}
+	}
+
 	return true, nil
 }
 
 func (w *Writer) checkPrereqs() error {
 	// as we error on the first problem we want to check snaps mode by mode
-	// in a fixed order; we start with run then
-	// ephemeral as snaps marked as such need to be self-contained
-	// then specific modes sorted
+	// in a fixed order
+	for _, m := range w.prereqModes() {
+		if err := w.checkPrereqsInMode(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prereqModes returns the modes of the available snaps in a fixed order;
+// we start with run then ephemeral as snaps marked as such need to be
+// self-contained then specific modes sorted.
+func (w *Writer) prereqModes() []string {
 	modes := make([]string, 0, len(w.availableByMode))
 	modes = append(modes, "run")
 	fixed := 1
@@ -1430,15 +2185,11 @@ func (w *Writer) checkPrereqs() error {
 		modes = append(modes, m)
 	}
 	sort.Strings(modes[fixed:])
-	for _, m := range modes {
-		if err := w.checkPrereqsInMode(m); err != nil {
-			return err
-		}
-	}
-	return nil
+	return modes
 }
 
-func (w *Writer) checkPrereqsInMode(mode string) error {
+// snapsInMode returns the infos of the snaps available in the given mode.
+func (w *Writer) snapsInMode(mode string) []*snap.Info {
 	nmode := len(w.byModeSnaps[mode])
 	nephemeral := len(w.byModeSnaps["ephemeral"])
 	var snaps []*snap.Info
@@ -1457,7 +2208,11 @@ func (w *Writer) checkPrereqsInMode(mode string) error {
 	for _, sn := range w.byModeSnaps[mode] {
 		snaps = append(snaps, sn.Info)
 	}
-	warns, errs := snap.ValidateBasesAndProviders(snaps)
+	return snaps
+}
+
+func (w *Writer) checkPrereqsInMode(mode string) error {
+	warns, errs := snap.ValidateBasesAndProviders(w.snapsInMode(mode))
 	if errs != nil {
 		var errPrefix string
 		// XXX TODO: return an error that subsumes all the errors
@@ -1473,6 +2228,13 @@ func (w *Writer) checkPrereqsInMode(mode string) error {
 		wfmt = fmt.Sprintf("prerequisites for mode %s: %%v", mode)
 	}
 	for _, warn := range warns {
+		if pw, ok := warn.(*snap.ProviderWarning); ok {
+			if w.opts.RequireConnectableContentProviders && !pw.HasDefaultProviderSlot() {
+				return fmt.Errorf(wfmt, fmt.Errorf("cannot reconcile content plug %s:%s with slots %s: default-provider %q is missing", pw.Snap, pw.Plug, strings.Join(pw.Slots, ", "), pw.DefaultProvider))
+			}
+			w.warnf(WarningContentProvider, pw.Snap, wfmt, warn)
+			continue
+		}
 		w.warningf(wfmt, warn)
 	}
 	return nil
@@ -1519,9 +2281,17 @@ func (w *Writer) snapDecl(sn *SeedSnap) (*asserts.SnapDeclaration, error) {
 }
 
 // Warnings returns the warning messages produced so far. No warnings
-// should be generated after Downloaded signaled complete.
+// should be generated after Downloaded signaled complete, except by
+// CheckValidationSets.
 func (w *Writer) Warnings() []string {
-	return w.warnings
+	if len(w.warnings) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(w.warnings))
+	for i, warn := range w.warnings {
+		msgs[i] = warn.Message
+	}
+	return msgs
 }
 
 func (w *Writer) resolveValidationSetAssertion(seq *asserts.AtSequence) (asserts.Assertion, error) {
@@ -1552,6 +2322,56 @@ func (w *Writer) validationSetAsserts() (map[*asserts.AtSequence]*asserts.Valida
 	return vsAsserts, nil
 }
 
+// enforcedValidationSets returns the validation sets that the model
+// enforces, ignoring the ones in prefer-enforce mode.
+func (w *Writer) enforcedValidationSets() (*snapasserts.ValidationSets, error) {
+	valsets := snapasserts.NewValidationSets()
+	for _, vs := range w.model.ValidationSets() {
+		if vs.Mode != asserts.ModelValidationSetModeEnforced {
+			continue
+		}
+		atSeq, err := w.finalValidationSetAtSequence(vs)
+		if err != nil {
+			return nil, fmt.Errorf("internal error: %v", err)
+		}
+		a, err := w.resolveValidationSetAssertion(atSeq)
+		if err != nil {
+			return nil, fmt.Errorf("internal error: cannot resolve validation-set: %v", err)
+		}
+		valsets.Add(a.(*asserts.ValidationSet))
+	}
+	return valsets, nil
+}
+
+// pinComponentRevisions sets the revision of the given seed components
+// of a model snap when they are pinned, either by the validation sets
+// enforced by the model or, failing that, by the manifest.
+func (w *Writer) pinComponentRevisions(modSnap *asserts.ModelSnap, seedComps map[string]SeedComponent) error {
+	if len(seedComps) == 0 {
+		return nil
+	}
+	valsets, err := w.enforcedValidationSets()
+	if err != nil {
+		return err
+	}
+	if err := valsets.Conflict(); err != nil {
+		return err
+	}
+	pres, err := valsets.Presence(modSnap)
+	if err != nil {
+		return err
+	}
+	for name, sc := range seedComps {
+		rev := pres.Component(name).Revision
+		if rev.Unset() {
+			rev = w.manifest.AllowedComponentRevision(sc.ComponentRef)
+		}
+		sc.Revision = rev
+		seedComps[name] = sc
+	}
+	return nil
+}
+
 func (w *Writer) validationSets() (*snapasserts.ValidationSets, error) {
 	vss, err := w.validationSetAsserts()
 	if err != nil {
@@ -1567,11 +2387,19 @@ func (w *Writer) validationSets() (*snapasserts.ValidationSets, error) {
 
 func (w *Writer) installedSnaps() []*snapasserts.InstalledSnap {
 	installedSnap := func(snap *SeedSnap) *snapasserts.InstalledSnap {
-		return snapasserts.NewInstalledSnap(snap.SnapName(), snap.ID(), snap.Info.Revision, nil)
+		var comps []snapasserts.InstalledComponent
+		for _, comp := range snap.Components {
+			if comp.Info == nil {
+				continue
+			}
+			comps = append(comps, snapasserts.InstalledComponent{
+				ComponentRef: comp.ComponentRef,
+				Revision:     comp.Info.Revision,
+			})
+		}
+		return snapasserts.NewInstalledSnap(snap.SnapName(), snap.ID(), snap.Info.Revision, comps)
 	}
 
-	// TODO:COMPS: add components
-
 	var installedSnaps []*snapasserts.InstalledSnap
 	for _, sn := range w.snapsFromModel {
 		installedSnaps = append(installedSnaps, installedSnap(sn))
@@ -1614,7 +2442,61 @@ func (w *Writer) CheckValidationSets() error {
 	// Make one aggregated list of snaps we are seeding, then check that
 	// against the validation sets
 	installedSnaps := w.installedSnaps()
-	return valsets.CheckInstalledSnaps(installedSnaps, nil)
+	err = valsets.CheckInstalledSnaps(installedSnaps, nil)
+	if verr, ok := err.(*snapasserts.ValidationSetsValidationError); ok {
+		return w.downgradePreferEnforceMissingSnaps(verr)
+	}
+	return err
+}
+
+// downgradePreferEnforceMissingSnaps turns into warnings the missing
+// snaps of the validation error that are required only by validation
+// sets the model applies in prefer-enforce mode. It returns the error
+// if any other violation is left.
+func (w *Writer) downgradePreferEnforceMissingSnaps(verr *snapasserts.ValidationSetsValidationError) error {
+	preferEnforce := make(map[string]bool)
+	for _, vs := range w.model.ValidationSets() {
+		if vs.Mode == asserts.ModelValidationSetModePreferEnforced {
+			preferEnforce[fmt.Sprintf("%s/%s", vs.AccountID, vs.Name)] = true
+		}
+	}
+
+	snapNames := make([]string, 0, len(verr.MissingSnaps))
+	for snapName := range verr.MissingSnaps {
+		snapNames = append(snapNames, snapName)
+	}
+	sort.Strings(snapNames)
+	for _, snapName := range snapNames {
+		revs := verr.MissingSnaps[snapName]
+		var sets []string
+		for rev, revSets := range revs {
+			enforced := false
+			for _, vs := range revSets {
+				if !preferEnforce[vs] {
+					enforced = true
+					break
+				}
+			}
+			if enforced {
+				continue
+			}
+			sets = append(sets, revSets...)
+			delete(revs, rev)
+		}
+		if len(revs) == 0 {
+			delete(verr.MissingSnaps, snapName)
+		}
+		if len(sets) != 0 {
+			sort.Strings(sets)
+			w.warnf(WarningValidationSet, snapName, "snap %q required by prefer-enforce validation sets (%s) is not part of the seed", snapName, strings.Join(sets, ", "))
+		}
+	}
+
+	if len(verr.MissingSnaps) == 0 && len(verr.InvalidSnaps) == 0 &&
+		len(verr.WrongRevisionSnaps) == 0 && len(verr.ComponentErrors) == 0 {
+		return nil
+	}
+	return verr
 }
 
 // SeedSnaps checks seed snaps and copies local snaps into the seed using copySnap.
@@ -1623,10 +2505,20 @@ func (w *Writer) SeedSnaps(copySnap func(name, src, dst string) error) error {
 		return err
 	}
 
+	if !w.opts.DryRun {
+		if err := w.checkSeedSizeBudget(); err != nil {
+			return err
+		}
+	}
+
 	seedSnaps := func(snaps []*SeedSnap) error {
 		for _, sn := range snaps {
 			info := sn.Info
-			if !sn.local {
+			switch {
+			case sn.existing:
+				// already in the system, only keep the manifest
+				// consistent below
+			case !sn.local:
 				expectedPath, err := w.tree.snapPath(sn)
 				if err != nil {
 					return err
@@ -1634,10 +2526,37 @@ func (w *Writer) SeedSnaps(copySnap func(name, src, dst string) error) error {
 				if sn.Path != expectedPath {
 					return fmt.Errorf("internal error: before seedwriter.Writer.SeedSnaps snap %q Path should have been set to %q", sn.SnapName(), expectedPath)
 				}
-				if !osutil.FileExists(expectedPath) {
+				if w.opts.DryRun {
+					// the blob is not expected to have
+					// been fetched
+					break
+				}
+				if w.opts.SnapPoolDir != "" {
+					if err := w.linkFromPool(sn, nil, "", expectedPath); err != nil {
+						return err
+					}
+					for i := range sn.Components {
+						comp := &sn.Components[i]
+						if err := w.linkFromPool(sn, comp, "", comp.Path); err != nil {
+							return err
+						}
+					}
+				} else if !osutil.FileExists(expectedPath) {
 					return fmt.Errorf("internal error: before seedwriter.Writer.SeedSnaps snap file %q should exist", expectedPath)
+				} else if w.opts.Resume {
+					if err := w.checkResumedSnapFile(sn); err != nil {
+						return err
+					}
 				}
-			} else {
+				if err := w.blobInPlace(info.SnapName(), expectedPath); err != nil {
+					return err
+				}
+				for _, comp := range sn.Components {
+					if err := w.blobInPlace(comp.ComponentRef.String(), comp.Path); err != nil {
+						return err
+					}
+				}
+			default:
 				var snapPath func(*SeedSnap) (string, error)
 				var compPath func(*SeedComponent, string) (string, error)
 				if sn.Info.ID() != "" {
@@ -1651,11 +2570,35 @@ func (w *Writer) SeedSnaps(copySnap func(name, src, dst string) error) error {
 					snapPath = w.tree.localSnapPath
 					compPath = w.tree.localComponentPath
 				}
+				seedBlob := copySnap
+				if w.opts.Resume {
+					seedBlob = func(name, src, dst string) error {
+						return resumeCopySnap(copySnap, name, src, dst)
+					}
+				}
+				if w.opts.SnapPoolDir != "" {
+					seedBlob = func(name, src, dst string) error {
+						var comp *SeedComponent
+						for i := range sn.Components {
+							if sn.Components[i].ComponentRef.String() == name {
+								comp = &sn.Components[i]
+							}
+						}
+						return w.linkFromPool(sn, comp, src, dst)
+					}
+				}
+				if w.opts.DryRun {
+					seedBlob = func(name, src, dst string) error {
+						return nil
+					}
+				} else {
+					seedBlob = w.withCopyProgress(seedBlob)
+				}
 				dst, err := snapPath(sn)
 				if err != nil {
 					return err
 				}
-				if err := copySnap(info.SnapName(), sn.Path, dst); err != nil {
+				if err := seedBlob(info.SnapName(), sn.Path, dst); err != nil {
 					return err
 				}
 				// copy components
@@ -1664,7 +2607,7 @@ func (w *Writer) SeedSnaps(copySnap func(name, src, dst string) error) error {
 					if err != nil {
 						return err
 					}
-					if err := copySnap(comp.ComponentRef.String(), comp.Path, compDst); err != nil {
+					if err := seedBlob(comp.ComponentRef.String(), comp.Path, compDst); err != nil {
 						return err
 					}
 					// record final destination path (for correct options.yaml)
@@ -1678,10 +2621,24 @@ func (w *Writer) SeedSnaps(copySnap func(name, src, dst string) error) error {
 					return fmt.Errorf("cannot record snap for manifest: %s", err)
 				}
 			}
+			for _, comp := range sn.Components {
+				if comp.Info == nil || comp.Info.Revision.Unset() {
+					continue
+				}
+				if err := w.manifest.MarkComponentRevisionSeeded(comp.SnapName, comp.ComponentName, comp.Info.Revision); err != nil {
+					return fmt.Errorf("cannot record component for manifest: %s", err)
+				}
+			}
+			if w.opts.ChecksumManifestPath != "" && !w.opts.DryRun {
+				if err := w.recordChecksums(sn); err != nil {
+					return err
+				}
+			}
 		}
 		return nil
 	}
 
+	w.checksums = nil
 	if err := seedSnaps(w.snapsFromModel); err != nil {
 		return err
 	}
@@ -1689,6 +2646,96 @@ func (w *Writer) SeedSnaps(copySnap func(name, src, dst string) error) error {
 		return err
 	}
 
+	if w.opts.ChecksumManifestPath != "" && !w.opts.DryRun {
+		if err := w.writeChecksumManifest(w.opts.ChecksumManifestPath); err != nil {
+			return fmt.Errorf("cannot write checksum manifest: %v", err)
+		}
+	}
+
+	if w.opts.Resume {
+		return w.removeStaleSystemSnaps()
+	}
+
+	return nil
+}
+
+// poolPath returns the path of the blob in the snap pool corresponding
+// to the given seed path.
+func (w *Writer) poolPath(seedPath string) string {
+	return filepath.Join(w.opts.SnapPoolDir, filepath.Base(seedPath))
+}
+
+// linkFromPool creates a relative symlink at dst in the seed pointing
+// to the blob with the same filename in the snap pool, for the snap sn
+// or if comp is set for its component. The blob is first checked with
+// checkBlob, src is the local file if any the blob comes from.
+func (w *Writer) linkFromPool(sn *SeedSnap, comp *SeedComponent, src, dst string) error {
+	name := sn.SnapName()
+	if comp != nil {
+		name = comp.ComponentRef.String()
+	}
+	target := w.poolPath(dst)
+	if !osutil.FileExists(target) {
+		return fmt.Errorf("cannot find %q in snap pool: %q does not exist", name, target)
+	}
+	if err := w.checkBlob(sn, comp, src, target); err != nil {
+		return fmt.Errorf("cannot use %q from snap pool: %v", name, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+	absDir, err := filepath.Abs(filepath.Dir(dst))
+	if err != nil {
+		return err
+	}
+	// the link must stay valid wherever the seed and the pool are
+	// mounted together
+	relTarget, err := filepath.Rel(absDir, absTarget)
+	if err != nil {
+		return err
+	}
+	// the blob might have been downloaded into the seed, the pool is
+	// authoritative
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Symlink(relTarget, dst)
+}
+
+// checkBlob checks that the blob at path has the digest and size
+// recorded in the snap-revision assertion of sn or, if comp is set, in
+// the snap-resource-revision assertion for the component. The blobs of
+// unasserted snaps and components are compared with the local file src
+// instead, if any.
+func (w *Writer) checkBlob(sn *SeedSnap, comp *SeedComponent, src, path string) error {
+	assertType, resName := asserts.SnapRevisionType, ""
+	if comp != nil {
+		assertType, resName = asserts.SnapResourceRevisionType, comp.ComponentName
+	}
+	expectedDigest, expectedSize, err := w.assertedBlob(sn, assertType, resName)
+	if err != nil {
+		return fmt.Errorf("internal error: lost saved assertion")
+	}
+	if expectedDigest == "" {
+		if src == "" || src == path {
+			return nil
+		}
+		expectedDigest, expectedSize, err = asserts.SnapFileSHA3_384(src)
+		if err != nil {
+			return err
+		}
+	}
+	digest, size, err := asserts.SnapFileSHA3_384(path)
+	if err != nil {
+		return err
+	}
+	if digest != expectedDigest || size != expectedSize {
+		return fmt.Errorf("%q does not have the expected digest and size", path)
+	}
 	return nil
 }
 
@@ -1711,6 +2758,10 @@ func (w *Writer) WriteMeta() error {
 		return err
 	}
 
+	if w.opts.DryRun {
+		return nil
+	}
+
 	if w.opts.ManifestPath != "" {
 		// Mark validation sets seeded in the manifest if the options
 		// are set to produce a manifest.
@@ -1729,9 +2780,47 @@ func (w *Writer) WriteMeta() error {
 		return err
 	}
 
+	if w.opts.SortSnapsAlphabetically {
+		snapsFromModel, extraSnaps = w.sortedSnapsByName()
+	}
+
 	return w.tree.writeMeta(snapsFromModel, extraSnaps)
 }
 
+// sortedSnapsByName returns copies of the model and extra seed snaps
+// sorted by name, with the essential model snaps, which come first,
+// left in place.
+func (w *Writer) sortedSnapsByName() (snapsFromModel, extraSnaps []*SeedSnap) {
+	snapsFromModel = append([]*SeedSnap(nil), w.snapsFromModel...)
+	extraSnaps = append([]*SeedSnap(nil), w.extraSnaps...)
+
+	essential := w.model.EssentialSnaps()
+	if systemSnap := w.policy.systemSnap(); systemSnap != nil {
+		essential = append([]*asserts.ModelSnap{systemSnap}, essential...)
+	}
+	isEssential := func(sn *SeedSnap) bool {
+		for _, modSnap := range essential {
+			if naming.SameSnap(sn, modSnap) {
+				return true
+			}
+		}
+		return false
+	}
+	nEssential := 0
+	for nEssential < len(snapsFromModel) && isEssential(snapsFromModel[nEssential]) {
+		nEssential++
+	}
+
+	byName := func(snaps []*SeedSnap) {
+		sort.SliceStable(snaps, func(i, j int) bool {
+			return snaps[i].SnapName() < snaps[j].SnapName()
+		})
+	}
+	byName(snapsFromModel[nEssential:])
+	byName(extraSnaps)
+	return snapsFromModel, extraSnaps
+}
+
 // query accessors
 
 func (w *Writer) checkSnapsAccessor() error {
@@ -1787,6 +2876,836 @@ func (w *Writer) UnassertedSnaps() ([]naming.SnapRef, error) {
 	return res, nil
 }
 
+// SnapDeclaration returns the snap-declaration assertion fetched for the
+// given seed snap. It can be invoked only after Downloaded returns
+// complete == true. It returns an error for unasserted snaps.
+func (w *Writer) SnapDeclaration(snapName string) (*asserts.SnapDeclaration, error) {
+	if err := w.checkSnapsAccessor(); err != nil {
+		return nil, err
+	}
+	sn := w.seedSnap(snapName)
+	if sn == nil {
+		return nil, fmt.Errorf("snap %q is not part of the seed", snapName)
+	}
+	if sn.Info.ID() == "" {
+		return nil, fmt.Errorf("snap %q is unasserted and has no snap-declaration", snapName)
+	}
+	return w.snapDecl(sn)
+}
+
+// SeedSnapSource describes where the blob of a seed snap came from.
+type SeedSnapSource string
+
+const (
+	// SeedSnapFromStore is used for snaps resolved via and downloaded
+	// from the store.
+	SeedSnapFromStore SeedSnapSource = "store"
+	// SeedSnapFromLocalPath is used for snaps supplied as local files.
+	SeedSnapFromLocalPath SeedSnapSource = "local"
+	// SeedSnapFromPool is used for snaps taken from the snap pool
+	// directory, see Options.SnapPoolDir.
+	SeedSnapFromPool SeedSnapSource = "pool"
+)
+
+// SnapSource returns where the blob of the given seed snap came from.
+// It can be invoked only after Downloaded returns complete == true.
+func (w *Writer) SnapSource(instanceName string) (SeedSnapSource, error) {
+	if err := w.checkSnapsAccessor(); err != nil {
+		return "", err
+	}
+	sn := w.seedSnap(instanceName)
+	if sn == nil {
+		return "", fmt.Errorf("snap %q is not part of the seed", instanceName)
+	}
+	switch {
+	case w.opts.SnapPoolDir != "":
+		return SeedSnapFromPool, nil
+	case sn.local:
+		return SeedSnapFromLocalPath, nil
+	default:
+		return SeedSnapFromStore, nil
+	}
+}
+
+// SnapIDConflict describes a snap-id that is claimed by more than one
+// snap of the seed.
+type SnapIDConflict struct {
+	SnapID string
+	// SnapNames are the names of the seed snaps resolved to SnapID.
+	SnapNames []string
+}
+
+// DetectDuplicateSnapIDs returns the snap-ids that are claimed by more
+// than one snap name in the seed, which points to a misconfiguration of
+// the store or the model. Downloaded already refuses option snaps
+// sharing a snap-id with another snap. It can be invoked only after
+// Downloaded returns complete == true.
+func (w *Writer) DetectDuplicateSnapIDs() []SnapIDConflict {
+	if err := w.checkSnapsAccessor(); err != nil {
+		return nil
+	}
+	var snapIDs []string
+	namesByID := make(map[string][]string)
+	for _, sns := range [][]*SeedSnap{w.snapsFromModel, w.extraSnaps} {
+		for _, sn := range sns {
+			snapID := sn.Info.ID()
+			if snapID == "" {
+				continue
+			}
+			if _, ok := namesByID[snapID]; !ok {
+				snapIDs = append(snapIDs, snapID)
+			}
+			if !strutil.ListContains(namesByID[snapID], sn.SnapName()) {
+				namesByID[snapID] = append(namesByID[snapID], sn.SnapName())
+			}
+		}
+	}
+	var conflicts []SnapIDConflict
+	for _, snapID := range snapIDs {
+		if len(namesByID[snapID]) < 2 {
+			continue
+		}
+		conflicts = append(conflicts, SnapIDConflict{
+			SnapID:    snapID,
+			SnapNames: namesByID[snapID],
+		})
+	}
+	return conflicts
+}
+
+// SelfBasedSnaps returns the names of the seed snaps that do not depend
+// on a separate base snap, i.e. snaps with base "none" and the base,
+// core and snapd snaps themselves, in seed order. It can be invoked only
+// after Downloaded returns complete == true.
+func (w *Writer) SelfBasedSnaps() []string {
+	if err := w.checkSnapsAccessor(); err != nil {
+		return nil
+	}
+	var selfBased []string
+	for _, sns := range [][]*SeedSnap{w.snapsFromModel, w.extraSnaps} {
+		for _, sn := range sns {
+			switch sn.Info.Type() {
+			case snap.TypeBase, snap.TypeOS, snap.TypeSnapd:
+			default:
+				if sn.Info.Base != "none" {
+					continue
+				}
+			}
+			selfBased = append(selfBased, sn.SnapName())
+		}
+	}
+	return selfBased
+}
+
+// seedSnap returns the seed snap with the given name, or nil if there is
+// no such snap in the seed.
+func (w *Writer) seedSnap(snapName string) *SeedSnap {
+	for _, sn := range w.snapsFromModel {
+		if sn.SnapName() == snapName {
+			return sn
+		}
+	}
+	for _, sn := range w.extraSnaps {
+		if sn.SnapName() == snapName {
+			return sn
+		}
+	}
+	return nil
+}
+
+// DevmodeSnaps returns the names of the seed snaps using devmode
+// confinement. Such snaps are only allowed in seeds for models of grade
+// dangerous (or without a grade).
+// It returns nil if invoked before Downloaded returns complete == true.
+func (w *Writer) DevmodeSnaps() []string {
+	if err := w.checkSnapsAccessor(); err != nil {
+		return nil
+	}
+	var res []string
+	for _, sn := range w.snapsFromModel {
+		if sn.Info.NeedsDevMode() {
+			res = append(res, sn.SnapName())
+		}
+	}
+
+	for _, sn := range w.extraSnaps {
+		if sn.Info.NeedsDevMode() {
+			res = append(res, sn.SnapName())
+		}
+	}
+	return res
+}
+
+// InclusionReasons returns a map from the names of the seed snaps to the
+// reasons why they were included in the seed, a snap can have several.
+// The reasons are ordered with the primary reason first, i.e. how the
+// snap was requested, followed by the snaps it is the base of and the
+// content it is the default-provider for.
+// It returns nil if invoked before Downloaded returns complete == true.
+func (w *Writer) InclusionReasons() map[string][]string {
+	if err := w.checkSnapsAccessor(); err != nil {
+		return nil
+	}
+	listedInModel := make(map[*asserts.ModelSnap]bool)
+	for _, modSnap := range w.model.AllSnaps() {
+		listedInModel[modSnap] = true
+	}
+	fromOptions := make(map[*OptionsSnap]bool, len(w.optionsSnaps))
+	for _, optSnap := range w.optionsSnaps {
+		fromOptions[optSnap] = true
+	}
+
+	all := make([]*SeedSnap, 0, len(w.snapsFromModel)+len(w.extraSnaps))
+	all = append(all, w.snapsFromModel...)
+	all = append(all, w.extraSnaps...)
+
+	reasons := make(map[string][]string, len(all))
+	for _, sn := range all {
+		var reason string
+		switch {
+		case sn.implicit:
+			reason = "implicitly required"
+		case sn.modelSnap != nil && !listedInModel[sn.modelSnap]:
+			reason = "system snap"
+		case sn.modelSnap != nil && sn.modelSnap.Presence == "optional":
+			reason = "optional in model, requested by options"
+		case sn.modelSnap != nil:
+			reason = "required by model"
+		case fromOptions[sn.optionSnap]:
+			reason = "requested by options"
+		default:
+			reason = "implicitly required"
+		}
+		reasons[sn.SnapName()] = []string{reason}
+	}
+
+	addReason := func(snapName, reason string) {
+		if _, ok := reasons[snapName]; !ok {
+			// not part of the seed
+			return
+		}
+		reasons[snapName] = append(reasons[snapName], reason)
+	}
+	for _, sn := range all {
+		if base := seedSnapBase(sn.Info); base != "" {
+			addReason(base, fmt.Sprintf("base of %s", sn.SnapName()))
+		}
+	}
+	for _, sn := range all {
+		plugs := make([]*snap.PlugInfo, 0, len(sn.Info.Plugs))
+		for _, plug := range sn.Info.Plugs {
+			plugs = append(plugs, plug)
+		}
+		providers := snap.DefaultContentProviders(plugs)
+		providerNames := make([]string, 0, len(providers))
+		for name := range providers {
+			providerNames = append(providerNames, name)
+		}
+		sort.Strings(providerNames)
+		for _, name := range providerNames {
+			for _, contentTag := range providers[name] {
+				addReason(name, fmt.Sprintf("default-provider for content %q of %s", contentTag, sn.SnapName()))
+			}
+		}
+	}
+	return reasons
+}
+
+// seedSnapBase returns the name of the base the snap needs, if any.
+func seedSnapBase(info *snap.Info) string {
+	if info.Base == "" && (info.Type() == snap.TypeApp || info.Type() == snap.TypeGadget) {
+		// such snaps implicitly need core
+		return "core"
+	}
+	return info.Base
+}
+
+// ImplicitReason is the reason why the Writer added a snap to the seed
+// that was neither listed in the model nor requested via the options.
+type ImplicitReason int
+
+const (
+	// ImplicitBase is the reason of snaps added because other seed
+	// snaps need them as base, i.e. core for snaps without a base.
+	ImplicitBase ImplicitReason = iota
+	// ImplicitSystemSnap is the reason of the system snap added
+	// because the model does not list it.
+	ImplicitSystemSnap
+)
+
+func (r ImplicitReason) String() string {
+	switch r {
+	case ImplicitBase:
+		return "base"
+	case ImplicitSystemSnap:
+		return "system-snap"
+	default:
+		return "unknown"
+	}
+}
+
+// ImplicitSnap describes a seed snap added implicitly by the Writer.
+type ImplicitSnap struct {
+	naming.Snap
+	Reason ImplicitReason
+	// RequiredBy are the names of the seed snaps needing the snap as
+	// base, set for ImplicitBase.
+	RequiredBy []string
+}
+
+// ImplicitSnaps returns the seed snaps that the Writer added on its own
+// because they were neither listed in the model nor requested via the
+// options, together with the reason why. The snaps are in seed order.
+// It can be invoked only after Downloaded returns complete == true.
+func (w *Writer) ImplicitSnaps() ([]ImplicitSnap, error) {
+	if err := w.checkSnapsAccessor(); err != nil {
+		return nil, err
+	}
+	listedInModel := make(map[*asserts.ModelSnap]bool)
+	for _, modSnap := range w.model.AllSnaps() {
+		listedInModel[modSnap] = true
+	}
+
+	all := make([]*SeedSnap, 0, len(w.snapsFromModel)+len(w.extraSnaps))
+	all = append(all, w.snapsFromModel...)
+	all = append(all, w.extraSnaps...)
+
+	var implicit []ImplicitSnap
+	for _, sn := range all {
+		switch {
+		case sn.implicit && sn.SnapName() != "snapd":
+			var requiredBy []string
+			for _, other := range all {
+				if seedSnapBase(other.Info) == sn.SnapName() {
+					requiredBy = append(requiredBy, other.SnapName())
+				}
+			}
+			implicit = append(implicit, ImplicitSnap{
+				Snap:       naming.Snap(sn.SnapName()),
+				Reason:     ImplicitBase,
+				RequiredBy: requiredBy,
+			})
+		case sn.implicit || (sn.modelSnap != nil && !listedInModel[sn.modelSnap]):
+			implicit = append(implicit, ImplicitSnap{
+				Snap:   naming.Snap(sn.SnapName()),
+				Reason: ImplicitSystemSnap,
+			})
+		}
+	}
+	return implicit, nil
+}
+
+// ContentGap describes a content tag that is consumed by snaps in a mode
+// of the seed without any provider of it, or with only providers which
+// are not the default-provider of any of the consumers.
+type ContentGap struct {
+	// Mode is the mode in which the gap exists.
+	Mode string
+	// ContentTag is the content tag of the content interface.
+	ContentTag string
+	// Consumers are the names of the snaps with plugs for the content.
+	Consumers []string
+	// Providers are the names of the snaps with slots for the content
+	// present in the mode, none of them is a default-provider.
+	Providers []string
+}
+
+// contentTag returns the content tag of a content interface plug or slot,
+// which defaults to its name.
+func contentTag(attrer interface {
+	Attr(key string, val any) error
+}, name string) string {
+	var tag string
+	if err := attrer.Attr("content", &tag); err != nil || tag == "" {
+		return name
+	}
+	return tag
+}
+
+// ContentInterfaceReport returns the content tags that are consumed by
+// seed snaps without a provider, or only with providers that are not the
+// default-provider of any consumer, in each of the modes of the seed.
+// It can be invoked only after Downloaded returns complete == true.
+func (w *Writer) ContentInterfaceReport() []ContentGap {
+	if err := w.checkSnapsAccessor(); err != nil {
+		return nil
+	}
+	var gaps []ContentGap
+	for _, mode := range w.prereqModes() {
+		var tags []string
+		consumers := make(map[string][]string)
+		defaultProviders := make(map[string]map[string]bool)
+		providers := make(map[string][]string)
+		for _, info := range w.snapsInMode(mode) {
+			for _, plug := range info.Plugs {
+				if plug.Interface != "content" {
+					continue
+				}
+				tag := contentTag(plug, plug.Name)
+				if _, ok := consumers[tag]; !ok {
+					tags = append(tags, tag)
+					defaultProviders[tag] = make(map[string]bool)
+				}
+				if !strutil.ListContains(consumers[tag], info.InstanceName()) {
+					consumers[tag] = append(consumers[tag], info.InstanceName())
+				}
+				for dprovider := range snap.DefaultContentProviders([]*snap.PlugInfo{plug}) {
+					defaultProviders[tag][dprovider] = true
+				}
+			}
+			for _, slot := range info.Slots {
+				if slot.Interface != "content" {
+					continue
+				}
+				tag := contentTag(slot, slot.Name)
+				if !strutil.ListContains(providers[tag], info.InstanceName()) {
+					providers[tag] = append(providers[tag], info.InstanceName())
+				}
+			}
+		}
+		sort.Strings(tags)
+		for _, tag := range tags {
+			hasDefault := len(defaultProviders[tag]) == 0
+			for _, provider := range providers[tag] {
+				if defaultProviders[tag][provider] {
+					hasDefault = true
+					break
+				}
+			}
+			if len(providers[tag]) != 0 && hasDefault {
+				continue
+			}
+			gaps = append(gaps, ContentGap{
+				Mode:       mode,
+				ContentTag: tag,
+				Consumers:  consumers[tag],
+				Providers:  providers[tag],
+			})
+		}
+	}
+	return gaps
+}
+
+// SlotConflict describes slots declared by different seed snaps that
+// cannot coexist on a system.
+type SlotConflict struct {
+	// Interface is the interface of the conflicting slots.
+	Interface string
+	// Name identifies what the slots conflict over, for example the
+	// bus and well-known name for dbus slots.
+	Name string
+	// Snaps are the names of the snaps declaring the conflicting slots.
+	Snaps []string
+}
+
+// slotConflictKeys maps interfaces to functions returning the key over
+// which slots of that interface conflict, slots with the same key cannot
+// be declared by different snaps.
+var slotConflictKeys = map[string]func(slot *snap.SlotInfo) (key string, ok bool){
+	"dbus": func(slot *snap.SlotInfo) (string, bool) {
+		var bus, name string
+		if err := slot.Attr("bus", &bus); err != nil {
+			return "", false
+		}
+		if err := slot.Attr("name", &name); err != nil {
+			return "", false
+		}
+		return fmt.Sprintf("%s:%s", bus, name), true
+	},
+}
+
+// DetectSlotConflicts returns the conflicts between the slots declared
+// by the seed snaps, e.g. two snaps declaring dbus slots for the same
+// well-known name on the same bus. Such slots would fail to be
+// connected on first boot.
+// It returns nil if invoked before Downloaded returns complete == true.
+func (w *Writer) DetectSlotConflicts() []SlotConflict {
+	if err := w.checkSnapsAccessor(); err != nil {
+		return nil
+	}
+	type conflictKey struct {
+		iface string
+		name  string
+	}
+	var keys []conflictKey
+	declaredBy := make(map[conflictKey][]string)
+	for _, snaps := range [][]*SeedSnap{w.snapsFromModel, w.extraSnaps} {
+		for _, sn := range snaps {
+			for _, slot := range sn.Info.Slots {
+				keyFn := slotConflictKeys[slot.Interface]
+				if keyFn == nil {
+					continue
+				}
+				name, ok := keyFn(slot)
+				if !ok {
+					continue
+				}
+				k := conflictKey{iface: slot.Interface, name: name}
+				declaring := declaredBy[k]
+				if declaring == nil {
+					keys = append(keys, k)
+				}
+				if !strutil.ListContains(declaring, sn.SnapName()) {
+					declaredBy[k] = append(declaring, sn.SnapName())
+				}
+			}
+		}
+	}
+
+	var conflicts []SlotConflict
+	for _, k := range keys {
+		declaring := declaredBy[k]
+		if len(declaring) < 2 {
+			continue
+		}
+		conflicts = append(conflicts, SlotConflict{
+			Interface: k.iface,
+			Name:      k.name,
+			Snaps:     declaring,
+		})
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].Interface != conflicts[j].Interface {
+			return conflicts[i].Interface < conflicts[j].Interface
+		}
+		return conflicts[i].Name < conflicts[j].Name
+	})
+	return conflicts
+}
+
+// AssertionAge describes the age of an assertion embedded in the seed.
+type AssertionAge struct {
+	Type       *asserts.AssertionType
+	PrimaryKey []string
+	Timestamp  time.Time
+	Age        time.Duration
+}
+
+var timeNow = time.Now
+
+// assertionTimestamp returns the timestamp of the given assertion, or
+// false if the assertion type carries none.
+func assertionTimestamp(a asserts.Assertion) (time.Time, bool) {
+	switch a := a.(type) {
+	case interface{ Timestamp() time.Time }:
+		return a.Timestamp(), true
+	case *asserts.AccountKey:
+		return a.Since(), true
+	}
+	return time.Time{}, false
+}
+
+// seedAssertionRefs returns the references to the assertions to be
+// embedded in the seed, without duplicates and in the order they were
+// fetched.
+func (w *Writer) seedAssertionRefs() []*asserts.Ref {
+	var all []*asserts.Ref
+	all = append(all, w.modelRefs...)
+	all = append(all, w.extraRefs...)
+	for _, snaps := range [][]*SeedSnap{w.snapsFromModel, w.extraSnaps} {
+		for _, sn := range snaps {
+			all = append(all, sn.aRefs...)
+		}
+	}
+
+	seen := make(map[string]bool, len(all))
+	refs := make([]*asserts.Ref, 0, len(all))
+	for _, ref := range all {
+		if seen[ref.Unique()] {
+			continue
+		}
+		seen[ref.Unique()] = true
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+func (w *Writer) assertionFreshness() ([]AssertionAge, error) {
+	now := timeNow()
+	var ages []AssertionAge
+	for _, ref := range w.seedAssertionRefs() {
+		a, err := ref.Resolve(w.db.Find)
+		if err != nil {
+			return nil, fmt.Errorf("internal error: lost saved assertion")
+		}
+		timestamp, ok := assertionTimestamp(a)
+		if !ok {
+			continue
+		}
+		ages = append(ages, AssertionAge{
+			Type:       ref.Type,
+			PrimaryKey: ref.PrimaryKey,
+			Timestamp:  timestamp,
+			Age:        now.Sub(timestamp),
+		})
+	}
+	return ages, nil
+}
+
+// AssertionFreshness returns the timestamps and the ages of the
+// assertions to be embedded in the seed which carry a timestamp, in the
+// order they were fetched.
+// It can be invoked only after Downloaded returns complete == true.
+func (w *Writer) AssertionFreshness() ([]AssertionAge, error) {
+	if err := w.checkSnapsAccessor(); err != nil {
+		return nil, err
+	}
+	return w.assertionFreshness()
+}
+
+func (w *Writer) warnAboutOldAssertions() error {
+	if w.opts.MaxAssertionAge <= 0 {
+		return nil
+	}
+	ages, err := w.assertionFreshness()
+	if err != nil {
+		return err
+	}
+	for _, age := range ages {
+		if age.Age > w.opts.MaxAssertionAge {
+			w.warningf("%s assertion %v is older than %s (%s old)", age.Type.Name, age.PrimaryKey, w.opts.MaxAssertionAge, age.Age.Round(time.Second))
+		}
+	}
+	return nil
+}
+
+// AssertionGraph is a view of the assertions embedded in a seed and of
+// how they depend on each other.
+type AssertionGraph struct {
+	// Nodes are the assertions embedded in the seed, in the order they
+	// were fetched.
+	Nodes []*asserts.Ref
+	// Edges maps the unique key (see asserts.Ref.Unique) of each node
+	// to the assertions it depends on, that is its prerequisites
+	// followed by the account-key used to sign it.
+	Edges map[string][]*asserts.Ref
+	// Predefined are the dependencies that are not embedded in the seed
+	// because they are predefined (trusted or not) on devices.
+	Predefined []*asserts.Ref
+}
+
+// Dependencies returns the assertions the given one depends on.
+func (g *AssertionGraph) Dependencies(ref *asserts.Ref) []*asserts.Ref {
+	return g.Edges[ref.Unique()]
+}
+
+// Missing returns the dependencies which are neither nodes of the graph
+// nor predefined, i.e. the gaps in the trust chain of the seed.
+func (g *AssertionGraph) Missing() []*asserts.Ref {
+	nodes := make(map[string]bool, len(g.Nodes)+len(g.Predefined))
+	for _, ref := range g.Nodes {
+		nodes[ref.Unique()] = true
+	}
+	for _, ref := range g.Predefined {
+		nodes[ref.Unique()] = true
+	}
+	seen := make(map[string]bool)
+	var missing []*asserts.Ref
+	for _, ref := range g.Nodes {
+		for _, dep := range g.Edges[ref.Unique()] {
+			if nodes[dep.Unique()] || seen[dep.Unique()] {
+				continue
+			}
+			seen[dep.Unique()] = true
+			missing = append(missing, dep)
+		}
+	}
+	return missing
+}
+
+// AssertionGraph returns the graph of the assertions to be embedded in
+// the seed with edges to their prerequisites and signing keys.
+// It can be invoked only after Downloaded returns complete == true.
+func (w *Writer) AssertionGraph() *AssertionGraph {
+	if err := w.checkSnapsAccessor(); err != nil {
+		return nil
+	}
+	refs := w.seedAssertionRefs()
+	g := &AssertionGraph{
+		Nodes: refs,
+		Edges: make(map[string][]*asserts.Ref, len(refs)),
+	}
+	for _, ref := range refs {
+		a, err := ref.Resolve(w.db.Find)
+		if err != nil {
+			// cannot happen, the assertions were saved in db
+			continue
+		}
+		deps := a.Prerequisites()
+		// self-signed assertions don't have a signing key dependency
+		signKey := &asserts.Ref{Type: asserts.AccountKeyType, PrimaryKey: []string{a.SignKeyID()}}
+		if signKey.Unique() != ref.Unique() {
+			deps = append(deps, signKey)
+		}
+		g.Edges[ref.Unique()] = deps
+	}
+	seen := make(map[string]bool)
+	for _, ref := range refs {
+		seen[ref.Unique()] = true
+	}
+	for _, ref := range refs {
+		for _, dep := range g.Edges[ref.Unique()] {
+			if seen[dep.Unique()] {
+				continue
+			}
+			seen[dep.Unique()] = true
+			if _, err := dep.Resolve(w.db.FindPredefined); err == nil {
+				g.Predefined = append(g.Predefined, dep)
+			}
+		}
+	}
+	return g
+}
+
+// TrustAnchors returns the account-keys embedded in the seed that
+// belong to the signing authorities of the model and of its
+// prerequisites, that is the brand and the store, in the order they were
+// fetched. Account-keys of other accounts, for example of snap
+// publishers, are not reported.
+// It can be invoked only after Downloaded returns complete == true.
+func (w *Writer) TrustAnchors() []*asserts.AccountKey {
+	if err := w.checkSnapsAccessor(); err != nil {
+		return nil
+	}
+	authorities := map[string]bool{
+		w.model.BrandID(): true,
+	}
+	for _, ref := range w.modelRefs {
+		a, err := ref.Resolve(w.db.Find)
+		if err != nil {
+			// cannot happen, the assertions were saved in db
+			continue
+		}
+		authorities[a.AuthorityID()] = true
+	}
+	var anchors []*asserts.AccountKey
+	for _, ref := range w.seedAssertionRefs() {
+		if ref.Type != asserts.AccountKeyType {
+			continue
+		}
+		a, err := ref.Resolve(w.db.Find)
+		if err != nil {
+			continue
+		}
+		accKey := a.(*asserts.AccountKey)
+		if authorities[accKey.AccountID()] {
+			anchors = append(anchors, accKey)
+		}
+	}
+	return anchors
+}
+
+// seedSize returns the total size in bytes of the snap and component
+// blobs of the seed.
+func (w *Writer) seedSize() (int64, error) {
+	if err := w.checkSnapsAccessor(); err != nil {
+		return 0, err
+	}
+	blobSize := func(name, path string) (int64, error) {
+		st, err := os.Stat(path)
+		if err != nil {
+			return 0, fmt.Errorf("cannot determine size of %q: %v", name, err)
+		}
+		return st.Size(), nil
+	}
+	blobPath := func(sn *SeedSnap, path string) string {
+		if w.opts.SnapPoolDir != "" && !sn.local {
+			// snaps to download are only expected in the pool
+			return w.poolPath(path)
+		}
+		return path
+	}
+	var total int64
+	for _, snaps := range [][]*SeedSnap{w.snapsFromModel, w.extraSnaps} {
+		for _, sn := range snaps {
+			sz, err := blobSize(sn.SnapName(), blobPath(sn, sn.Path))
+			if err != nil {
+				return 0, err
+			}
+			total += sz
+			for _, comp := range sn.Components {
+				sz, err := blobSize(comp.ComponentRef.String(), blobPath(sn, comp.Path))
+				if err != nil {
+					return 0, err
+				}
+				total += sz
+			}
+		}
+	}
+	return total, nil
+}
+
+// checkSeedSizeBudget checks the total size of the seed blobs against
+// the MaxSeedSize option if set.
+func (w *Writer) checkSeedSizeBudget() error {
+	if w.opts.MaxSeedSize == 0 {
+		return nil
+	}
+	size, err := w.seedSize()
+	if err != nil {
+		return err
+	}
+	seedSize := quantity.Size(size)
+	if seedSize > w.opts.MaxSeedSize {
+		return fmt.Errorf("seed size %s exceeds budget %s (over by %s)",
+			seedSize.IECString(), w.opts.MaxSeedSize.IECString(),
+			(seedSize - w.opts.MaxSeedSize).IECString())
+	}
+	return nil
+}
+
+// EstimateSeedingTime returns a rough estimate of the time needed to
+// copy and install the seed, based on the total size of its snap and
+// component blobs and the given throughput in bytes per second.
+// It can be invoked only after Downloaded returns complete == true.
+func (w *Writer) EstimateSeedingTime(bytesPerSec int64) (time.Duration, error) {
+	if bytesPerSec <= 0 {
+		return 0, fmt.Errorf("cannot estimate seeding time for invalid throughput %d", bytesPerSec)
+	}
+	size, err := w.seedSize()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(float64(size) / float64(bytesPerSec) * float64(time.Second)), nil
+}
+
+// SnapdVersion returns the version of the snapd that will be active on
+// first boot, as read from the snapd snap of the seed, or from the core
+// snap if there is no snapd snap.
+// It can be invoked only after Downloaded returns complete == true.
+func (w *Writer) SnapdVersion() (string, error) {
+	if err := w.checkSnapsAccessor(); err != nil {
+		return "", err
+	}
+	var snapdSnap, coreSnap *SeedSnap
+	for _, snaps := range [][]*SeedSnap{w.snapsFromModel, w.extraSnaps} {
+		for _, sn := range snaps {
+			switch sn.Info.Type() {
+			case snap.TypeSnapd:
+				snapdSnap = sn
+			case snap.TypeOS:
+				coreSnap = sn
+			}
+		}
+	}
+	sn := snapdSnap
+	if sn == nil {
+		sn = coreSnap
+	}
+	if sn == nil {
+		return "", fmt.Errorf("cannot determine snapd version: no snapd or core snap in the seed")
+	}
+	snapf, err := w.opts.openSnap(sn.Path)
+	if err != nil {
+		return "", fmt.Errorf("cannot read snapd version from %s snap: %v", sn.SnapName(), err)
+	}
+	version, _, err := snap.SnapdInfoFromSnapFile(snapf, sn.Info.Type())
+	if err != nil {
+		return "", fmt.Errorf("cannot read snapd version from %s snap: %v", sn.SnapName(), err)
+	}
+	return version, nil
+}
+
 func (w *Writer) VerifySnapBootstrapCompatibility() error {
 	var kernelSnap, snapdSnap *SeedSnap
 
@@ -1809,11 +3728,19 @@ func (w *Writer) VerifySnapBootstrapCompatibility() error {
 		return nil
 	}
 
-	kernelVersion, _, err := snap.SnapdInfoFromSnapFile(squashfs.New(kernelSnap.Path), snap.TypeKernel)
+	kernelf, err := w.opts.openSnap(kernelSnap.Path)
+	if err != nil {
+		return fmt.Errorf("error while reading snapd-info from kernel snap: %w", err)
+	}
+	kernelVersion, _, err := snap.SnapdInfoFromSnapFile(kernelf, snap.TypeKernel)
 	if err != nil {
 		return fmt.Errorf("error while reading snapd-info from kernel snap: %w", err)
 	}
-	snapdVersion, _, err := snap.SnapdInfoFromSnapFile(squashfs.New(snapdSnap.Path), snap.TypeSnapd)
+	snapdf, err := w.opts.openSnap(snapdSnap.Path)
+	if err != nil {
+		return fmt.Errorf("error while reading snapd-info from snapd snap: %w", err)
+	}
+	snapdVersion, _, err := snap.SnapdInfoFromSnapFile(snapdf, snap.TypeSnapd)
 	if err != nil {
 		return fmt.Errorf("error while reading snapd-info from snapd snap: %w", err)
 	}
@@ -20,9 +20,11 @@
 package seedwriter_test
 
 import (
+	"crypto"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"path/filepath"
@@ -33,15 +35,18 @@ import (
 
 	. "gopkg.in/check.v1"
 
+	"github.com/snapcore/snapd/arch"
 	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/asserts/assertstest"
 	"github.com/snapcore/snapd/asserts/snapasserts"
+	"github.com/snapcore/snapd/gadget/quantity"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/seed/internal"
 	"github.com/snapcore/snapd/seed/seedtest"
 	"github.com/snapcore/snapd/seed/seedwriter"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snap/naming"
+	"github.com/snapcore/snapd/snap/snapdir"
 	"github.com/snapcore/snapd/snap/snapfile"
 	"github.com/snapcore/snapd/snap/snaptest"
 	"github.com/snapcore/snapd/testutil"
@@ -73,7 +78,8 @@ type writerSuite struct {
 var _ = Suite(&writerSuite{})
 
 var (
-	brandPrivKey, _ = assertstest.GenerateKey(752)
+	brandPrivKey, _      = assertstest.GenerateKey(752)
+	otherbrandPrivKey, _ = assertstest.GenerateKey(752)
 )
 
 func (s *writerSuite) createFetcher(db *asserts.Database, c *C) seedwriter.SeedAssertionFetcher {
@@ -165,6 +171,15 @@ plugs:
      interface: content
      content: cont
      default-provider: cont-producer
+`,
+	"cont-consumer-slot-default": `name: cont-consumer-slot-default
+base: core18
+version: 1.0
+plugs:
+   cont:
+     interface: content
+     content: cont
+     default-provider: cont-producer:cont
 `,
 	"my-devmode": `name: my-devmode
 type: app
@@ -179,11 +194,92 @@ slots:
    serve-cont:
      interface: content
      content: cont
+`,
+	"cont-consumer-no-default": `name: cont-consumer-no-default
+base: core18
+version: 1.0
+plugs:
+   other-cont:
+     interface: content
+   cont:
+     interface: content
+     content: cont
 `,
 	"oldlatest": `name: oldlatest
 type: app
 version: 1
  `,
+	"bare-app": `name: bare-app
+type: app
+base: none
+version: 1.0
+`,
+	"arm64-app": `name: arm64-app
+type: app
+base: core18
+version: 1.0
+architectures: [arm64]
+`,
+	"arm64-local": `name: arm64-local
+type: app
+base: core18
+version: 1.0
+architectures: [arm64, armhf]
+`,
+	"amd64-local": `name: amd64-local
+type: app
+base: core18
+version: 1.0
+architectures: [amd64]
+`,
+	"dbus-provider": `name: dbus-provider
+type: app
+base: core18
+version: 1.0
+slots:
+   dbus-svc:
+     interface: dbus
+     bus: system
+     name: org.example.Service
+   dbus-session:
+     interface: dbus
+     bus: session
+     name: org.example.Service
+`,
+	"layered-app": `name: layered-app
+type: app
+base: layered-base
+version: 1.0
+`,
+	"layered-base": `name: layered-base
+type: app
+base: core18
+version: 1.0
+`,
+	"cycle-base-a": `name: cycle-base-a
+type: app
+base: cycle-base-b
+version: 1.0
+`,
+	"cycle-base-b": `name: cycle-base-b
+type: app
+base: cycle-base-a
+version: 1.0
+`,
+	"alt-dbus-provider": `name: alt-dbus-provider
+type: app
+base: core18
+version: 1.0
+slots:
+   dbus-svc:
+     interface: dbus
+     bus: system
+     name: org.example.Service
+   dbus-other:
+     interface: dbus
+     bus: system
+     name: org.example.Other
+`,
 })
 
 const pcGadgetYaml = `
@@ -305,6 +401,127 @@ func (s *writerSuite) TestNewDefaultChannelError(c *C) {
 	c.Check(err, ErrorMatches, `cannot use global default option channel: invalid risk in channel name: foo/bar`)
 }
 
+func (s *writerSuite) TestEffectiveOptions(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core20",
+		"grade":        "dangerous",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+		},
+	})
+
+	s.opts.Label = "20240101"
+	s.opts.DefaultChannel = "latest/stable"
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	eff := w.EffectiveOptions()
+	c.Check(eff.Label, Equals, "20240101")
+	c.Check(eff.DefaultChannel, Equals, "latest/stable")
+	c.Check(eff.SeedDir, Equals, s.opts.SeedDir)
+	// defaults were applied
+	c.Check(eff.Architecture, Equals, "amd64")
+	// the manifest is only available through Manifest
+	c.Check(w.Manifest(), NotNil)
+	c.Check(eff.Manifest, IsNil)
+	// but not to the given options
+	c.Check(s.opts.Architecture, Equals, "")
+	c.Check(s.opts.Manifest, IsNil)
+
+	// the architecture given in the options wins
+	s.opts.Architecture = "arm64"
+	w, err = seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+	c.Check(w.EffectiveOptions().Architecture, Equals, "arm64")
+}
+
+func (s *writerSuite) TestEffectiveOptionsNormalizedDefaultChannel(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"gadget":       "pc",
+		"kernel":       "pc-kernel",
+	})
+
+	for _, t := range []struct {
+		given, normalized string
+	}{
+		{"", ""},
+		{"stable", "stable"},
+		{"edge", "edge"},
+		{"beta/hotfix", "beta/hotfix"},
+		{"latest/stable", "latest/stable"},
+		{"latest", "latest/stable"},
+		{"18", "18/stable"},
+		{"18/edge", "18/edge"},
+		{"18/edge/hotfix", "18/edge/hotfix"},
+	} {
+		s.opts.DefaultChannel = t.given
+		w, err := seedwriter.New(model, s.opts)
+		c.Assert(err, IsNil)
+		c.Check(w.EffectiveOptions().DefaultChannel, Equals, t.normalized, Commentf("%q", t.given))
+	}
+}
+
+func (s *writerSuite) TestEffectiveOptionsIsACopy(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"gadget":       "pc",
+		"kernel":       "pc-kernel",
+	})
+
+	storeAs, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
+		"store":        "my-proxy-store",
+		"operator-id":  "canonical",
+		"authority-id": "canonical",
+		"url":          "https://my-proxy-store.com",
+		"timestamp":    time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	s.opts.ExtraAssertions = []asserts.Assertion{storeAs}
+	s.opts.DefaultChannel = "edge"
+	s.opts.PrefetchedSnapAssertions = map[string][]asserts.Assertion{
+		"some-snap-id": {storeAs},
+	}
+
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	eff := w.EffectiveOptions()
+	// risk-only channels are kept as given
+	c.Check(eff.DefaultChannel, Equals, "edge")
+	c.Check(eff.Label, Equals, "")
+	c.Assert(eff.ExtraAssertions, HasLen, 1)
+
+	eff.DefaultChannel = "beta"
+	eff.SeedDir = "/other"
+	eff.ExtraAssertions[0] = nil
+	eff.PrefetchedSnapAssertions["some-snap-id"][0] = nil
+	eff.PrefetchedSnapAssertions["other-snap-id"] = nil
+
+	eff = w.EffectiveOptions()
+	c.Check(eff.DefaultChannel, Equals, "edge")
+	c.Check(eff.SeedDir, Equals, s.opts.SeedDir)
+	c.Check(eff.ExtraAssertions, DeepEquals, []asserts.Assertion{storeAs})
+	c.Check(eff.PrefetchedSnapAssertions, DeepEquals, map[string][]asserts.Assertion{
+		"some-snap-id": {storeAs},
+	})
+}
+
 func (s writerSuite) TestSetOptionsSnapsErrors(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name":   "my model",
@@ -322,9 +539,13 @@ func (s writerSuite) TestSetOptionsSnapsErrors(c *C) {
 		{[]*seedwriter.OptionsSnap{{Name: "foo_1"}}, `cannot use snap "foo_1", parallel snap instances are unsupported`},
 		{[]*seedwriter.OptionsSnap{{Name: "foo"}, {Name: "foo"}}, `snap "foo" is repeated in options`},
 		{[]*seedwriter.OptionsSnap{{Name: "foo", Channel: "track/foo"}}, `cannot use option channel for snap "foo": invalid risk in channel name: track/foo`},
+		{[]*seedwriter.OptionsSnap{{Name: "foo", Channel: "track/edge/"}}, `cannot use option channel for snap "foo": invalid branch in channel name: track/edge/`},
+		{[]*seedwriter.OptionsSnap{{Name: "foo", Channel: "track/edge/fix/extra"}}, `cannot use option channel for snap "foo": channel name has too many components: track/edge/fix/extra`},
 		{[]*seedwriter.OptionsSnap{{Path: "not-a-snap"}}, `local option snap "not-a-snap" does not end in .snap`},
 		{[]*seedwriter.OptionsSnap{{Path: "not-there.snap"}}, `local option snap "not-there.snap" does not exist`},
 		{[]*seedwriter.OptionsSnap{{Name: "foo", Path: "foo.snap"}}, `cannot specify both name and path for option snap "foo"`},
+		{[]*seedwriter.OptionsSnap{{Path: "foo.snap", Revision: snap.R(2)}}, `cannot specify a revision for local option snap "foo.snap"`},
+		{[]*seedwriter.OptionsSnap{{Name: "foo", Revision: snap.R(-1)}}, `cannot use local revision x1 for option snap "foo"`},
 	}
 
 	for _, t := range tests {
@@ -678,6 +899,71 @@ func (s *writerSuite) TestDownloadedCheckBase(c *C) {
 
 }
 
+func (s *writerSuite) TestDownloadedCheckBaseChain(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"gadget":         "pc",
+		"kernel":         "pc-kernel",
+		"required-snaps": []any{"layered-app", "layered-base"},
+	})
+
+	s.makeSnap(c, "core", "")
+	s.makeSnap(c, "pc-kernel", "")
+	s.makeSnap(c, "pc", "")
+	s.makeSnap(c, "layered-app", "developerid")
+	s.makeSnap(c, "layered-base", "developerid")
+
+	s.expectedSysSnap = "core"
+
+	_, _, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	c.Check(err, ErrorMatches, `cannot add snap "layered-app" without also adding its base ancestor "core18" explicitly \(base chain: layered-app -> layered-base -> core18\)`)
+}
+
+func (s *writerSuite) TestDownloadedCheckBaseChainHappy(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"gadget":         "pc",
+		"kernel":         "pc-kernel",
+		"required-snaps": []any{"layered-app", "layered-base", "core18"},
+	})
+
+	s.makeSnap(c, "core", "")
+	s.makeSnap(c, "pc-kernel", "")
+	s.makeSnap(c, "pc", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "layered-app", "developerid")
+	s.makeSnap(c, "layered-base", "developerid")
+
+	s.expectedSysSnap = "core"
+
+	complete, _, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+}
+
+func (s *writerSuite) TestDownloadedCheckBaseChainCycle(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"gadget":         "pc",
+		"kernel":         "pc-kernel",
+		"required-snaps": []any{"cycle-base-a", "cycle-base-b"},
+	})
+
+	s.makeSnap(c, "core", "")
+	s.makeSnap(c, "pc-kernel", "")
+	s.makeSnap(c, "pc", "")
+	s.makeSnap(c, "cycle-base-a", "developerid")
+	s.makeSnap(c, "cycle-base-b", "developerid")
+
+	s.expectedSysSnap = "core"
+
+	_, _, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	c.Check(err, ErrorMatches, `cannot add snap "cycle-base-a": base chain has a cycle: cycle-base-a -> cycle-base-b -> cycle-base-a`)
+}
+
 func (s *writerSuite) TestOutOfOrder(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name":   "my model",
@@ -1022,7 +1308,17 @@ func (s *writerSuite) TestSeedSnapsWriteMetaCore16(c *C) {
 	seedtest.ValidateSeed(c, s.opts.SeedDir, "", usesSnapd, s.StoreSigning.Trusted)
 }
 
-func (s *writerSuite) TestSeedSnapsWriteMetaCore18(c *C) {
+func (s *writerSuite) fillPoolSnap(poolDir string) func(c *C, w *seedwriter.Writer, sn *seedwriter.SeedSnap) {
+	return func(c *C, w *seedwriter.Writer, sn *seedwriter.SeedSnap) {
+		info := s.doFillMetaDownloadedSnap(c, w, sn)
+
+		// the blob lives in the pool only
+		err := os.Rename(s.AssertedSnap(sn.SnapName()), filepath.Join(poolDir, info.Filename()))
+		c.Assert(err, IsNil)
+	}
+}
+
+func (s *writerSuite) TestSeedSnapsWriteMetaSnapPoolCore18(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name":   "my model",
 		"architecture":   "amd64",
@@ -1039,29 +1335,12 @@ func (s *writerSuite) TestSeedSnapsWriteMetaCore18(c *C) {
 	s.makeSnap(c, "cont-producer", "developerid")
 	s.makeSnap(c, "cont-consumer", "developerid")
 
-	w, err := seedwriter.New(model, s.opts)
-	c.Assert(err, IsNil)
-
-	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "pc", Channel: "edge"}})
-	c.Assert(err, IsNil)
-
-	err = w.Start(s.db, s.rf)
-	c.Assert(err, IsNil)
-
-	snaps, err := w.SnapsToDownload()
-	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 6)
-
-	s.AssertedSnapInfo("cont-producer").EditedLinks = map[string][]string{
-		"contact": {"mailto:author@cont-producer.net"},
-	}
-	for _, sn := range snaps {
-		s.fillDownloadedSnap(c, w, sn)
-	}
+	poolDir := c.MkDir()
+	s.opts.SnapPoolDir = poolDir
 
-	complete, err := w.Downloaded(s.fetchAsserts(c))
+	complete, w, err := s.upToDownloaded(c, model, s.fillPoolSnap(poolDir), s.fetchAsserts(c))
 	c.Assert(err, IsNil)
-	c.Check(complete, Equals, true)
+	c.Assert(complete, Equals, true)
 
 	err = w.SeedSnaps(nil)
 	c.Assert(err, IsNil)
@@ -1069,159 +1348,142 @@ func (s *writerSuite) TestSeedSnapsWriteMetaCore18(c *C) {
 	err = w.WriteMeta()
 	c.Assert(err, IsNil)
 
-	// check seed
 	seedYaml, err := seedwriter.InternalReadSeedYaml(filepath.Join(s.opts.SeedDir, "seed.yaml"))
 	c.Assert(err, IsNil)
+	c.Assert(seedYaml.Snaps, HasLen, 6)
 
-	c.Check(seedYaml.Snaps, HasLen, 6)
-
-	// check the files are in place
+	// the seed refers to the logical filenames, symlinked into the pool
 	for i, name := range []string{"snapd", "pc-kernel", "core18", "pc", "cont-consumer", "cont-producer"} {
-		info := s.AssertedSnapInfo(name)
+		fn := s.AssertedSnapInfo(name).Filename()
+		c.Check(seedYaml.Snaps[i].File, Equals, fn)
 
-		fn := info.Filename()
 		p := filepath.Join(s.opts.SeedDir, "snaps", fn)
-		c.Check(p, testutil.FilePresent)
-
-		channel := "stable"
-		switch name {
-		case "pc-kernel":
-			channel = "18"
-		case "pc":
-			channel = "18/edge"
-		}
-
-		c.Check(seedYaml.Snaps[i], DeepEquals, &seedwriter.InternalSnap16{
-			Name:    info.SnapName(),
-			SnapID:  info.SnapID,
-			Channel: channel,
-			File:    fn,
-			Contact: info.Contact(),
-		})
+		target, err := os.Readlink(p)
+		c.Assert(err, IsNil)
+		c.Check(filepath.IsAbs(target), Equals, false)
+		target, err = filepath.EvalSymlinks(p)
+		c.Assert(err, IsNil)
+		c.Check(target, Equals, filepath.Join(poolDir, fn))
 	}
 
-	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
-	c.Assert(err, IsNil)
-	c.Check(l, HasLen, 6)
+	// the symlink backed seed is valid, snap digests are checked
+	// through the symlinks
+	const usesSnapd = true
+	seedtest.ValidateSeed(c, s.opts.SeedDir, "", usesSnapd, s.StoreSigning.Trusted)
+}
 
-	// check assertions
-	seedAssertsDir := filepath.Join(s.opts.SeedDir, "assertions")
-	storeAccountKeyPK := s.StoreSigning.StoreAccountKey("").PublicKeyID()
-	brandAcctKeyPK := s.Brands.AccountKey("my-brand").PublicKeyID()
+func (s *writerSuite) TestSnapSourcePool(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"required18"},
+	})
 
-	for _, fn := range []string{"model", brandAcctKeyPK + ".account-key", "my-brand.account", storeAccountKeyPK + ".account-key"} {
-		p := filepath.Join(seedAssertsDir, fn)
-		c.Check(p, testutil.FilePresent)
-	}
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "required18", "developerid")
 
-	c.Check(filepath.Join(seedAssertsDir, "model"), testutil.FileEquals, asserts.Encode(model))
+	poolDir := c.MkDir()
+	s.opts.SnapPoolDir = poolDir
 
-	acct := seedtest.ReadAssertions(c, filepath.Join(seedAssertsDir, "my-brand.account"))
-	c.Assert(acct, HasLen, 1)
-	c.Check(acct[0].Type(), Equals, asserts.AccountType)
-	c.Check(acct[0].HeaderString("account-id"), Equals, "my-brand")
+	complete, w, err := s.upToDownloaded(c, model, s.fillPoolSnap(poolDir), s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, true)
 
-	// check the snap assertions are also in place
-	for _, snapName := range []string{"snapd", "pc-kernel", "core18", "pc", "cont-consumer", "cont-producer"} {
-		p := filepath.Join(seedAssertsDir, fmt.Sprintf("16,%s.snap-declaration", s.AssertedSnapID(snapName)))
-		decl := seedtest.ReadAssertions(c, p)
-		c.Assert(decl, HasLen, 1)
-		c.Check(decl[0].Type(), Equals, asserts.SnapDeclarationType)
-		c.Check(decl[0].HeaderString("snap-name"), Equals, snapName)
-		p = filepath.Join(seedAssertsDir, fmt.Sprintf("%s.snap-revision", s.AssertedSnapRevision(snapName).SnapSHA3_384()))
-		rev := seedtest.ReadAssertions(c, p)
-		c.Assert(rev, HasLen, 1)
-		c.Check(rev[0].Type(), Equals, asserts.SnapRevisionType)
-		c.Check(rev[0].HeaderString("snap-id"), Equals, s.AssertedSnapID(snapName))
+	for _, name := range []string{"snapd", "core18", "pc-kernel", "pc", "required18"} {
+		src, err := w.SnapSource(name)
+		c.Assert(err, IsNil)
+		c.Check(src, Equals, seedwriter.SeedSnapFromPool, Commentf(name))
 	}
-
-	// validity check of seedtest helper
-	const usesSnapd = true
-	// core18 seeds do not use system labels
-	seedtest.ValidateSeed(c, s.opts.SeedDir, "", usesSnapd, s.StoreSigning.Trusted)
 }
 
-func (s *writerSuite) TestSeedSnapsWriteMetaCore18StoreAssertion(c *C) {
-	// add store assertion
-	storeAs, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
-		"store":       "my-store",
-		"operator-id": "canonical",
-		"timestamp":   time.Now().UTC().Format(time.RFC3339),
-	}, nil, "")
-	c.Assert(err, IsNil)
-	err = s.StoreSigning.Add(storeAs)
-	c.Assert(err, IsNil)
-
+func (s *writerSuite) TestSeedSnapsSnapPoolMissingSnap(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
-		"display-name": "my model",
-		"architecture": "amd64",
-		"base":         "core18",
-		"gadget":       "pc=18",
-		"kernel":       "pc-kernel=18",
-		"store":        "my-store",
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"required18"},
 	})
 
 	s.makeSnap(c, "snapd", "")
 	s.makeSnap(c, "core18", "")
 	s.makeSnap(c, "pc-kernel=18", "")
 	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "required18", "developerid")
 
-	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
-	c.Assert(err, IsNil)
-	c.Check(complete, Equals, true)
-
-	err = w.SeedSnaps(nil)
-	c.Assert(err, IsNil)
+	poolDir := c.MkDir()
+	s.opts.SnapPoolDir = poolDir
 
-	err = w.WriteMeta()
+	fillPoolSnap := s.fillPoolSnap(poolDir)
+	complete, w, err := s.upToDownloaded(c, model, func(c *C, w *seedwriter.Writer, sn *seedwriter.SeedSnap) {
+		if sn.SnapName() == "required18" {
+			// not in the pool
+			s.doFillMetaDownloadedSnap(c, w, sn)
+			return
+		}
+		fillPoolSnap(c, w, sn)
+	}, s.fetchAsserts(c))
 	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, true)
 
-	// check assertions
-	seedAssertsDir := filepath.Join(s.opts.SeedDir, "assertions")
-	// check the store assertion was fetched
-	p := filepath.Join(seedAssertsDir, "my-store.store")
-	c.Check(p, testutil.FilePresent)
+	err = w.SeedSnaps(nil)
+	c.Check(err, ErrorMatches, fmt.Sprintf(`cannot find "required18" in snap pool: "%s/required18_1.snap" does not exist`, poolDir))
 }
 
-func (s *writerSuite) TestLocalSnaps(c *C) {
+func (s *writerSuite) TestSeedSnapsSnapPoolDigestMismatch(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name":   "my model",
 		"architecture":   "amd64",
 		"base":           "core18",
 		"gadget":         "pc=18",
 		"kernel":         "pc-kernel=18",
-		"required-snaps": []any{"cont-consumer", "cont-producer"},
+		"required-snaps": []any{"required18"},
 	})
 
-	core18Fn := s.makeLocalSnap(c, "core18")
-	pcKernelFn := s.makeLocalSnap(c, "pc-kernel=18")
-	pcFn := s.makeLocalSnap(c, "pc=18")
-	contConsumerFn := s.makeLocalSnap(c, "cont-consumer")
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "required18", "developerid")
 
-	w, err := seedwriter.New(model, s.opts)
-	c.Assert(err, IsNil)
+	poolDir := c.MkDir()
+	s.opts.SnapPoolDir = poolDir
 
-	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{
-		{Path: core18Fn},
-		{Path: pcFn, Channel: "edge"},
-		{Path: pcKernelFn},
-		{Path: contConsumerFn},
-	})
+	complete, w, err := s.upToDownloaded(c, model, s.fillPoolSnap(poolDir), s.fetchAsserts(c))
 	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, true)
 
-	err = w.Start(s.db, s.rf)
+	// the blob in the pool is not the asserted one
+	err = os.WriteFile(filepath.Join(poolDir, "required18_1.snap"), []byte("garbage"), 0644)
 	c.Assert(err, IsNil)
 
-	localSnaps, err := w.LocalSnaps()
-	c.Assert(err, IsNil)
-	c.Assert(localSnaps, HasLen, 4)
-	c.Check(localSnaps[0].Path, Equals, core18Fn)
-	c.Check(localSnaps[1].Path, Equals, pcFn)
-	c.Check(localSnaps[2].Path, Equals, pcKernelFn)
-	c.Check(localSnaps[3].Path, Equals, contConsumerFn)
+	err = w.SeedSnaps(nil)
+	c.Check(err, ErrorMatches, fmt.Sprintf(`cannot use "required18" from snap pool: "%s/required18_1.snap" does not have the expected digest and size`, poolDir))
+	c.Check(filepath.Join(s.opts.SeedDir, "snaps", "required18_1.snap"), testutil.FileAbsent)
 }
 
-func (s *writerSuite) TestLocalSnapsCore18FullUse(c *C) {
+func (s *writerSuite) TestNewSnapPoolDirNotADirectory(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core18",
+		"gadget":       "pc=18",
+		"kernel":       "pc-kernel=18",
+	})
+
+	s.opts.SnapPoolDir = filepath.Join(c.MkDir(), "missing")
+	_, err := seedwriter.New(model, s.opts)
+	c.Check(err, ErrorMatches, `cannot use snap pool directory ".*/missing": not a directory`)
+}
+
+func (s *writerSuite) TestSeedSnapsWriteMetaCore18(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name":   "my model",
 		"architecture":   "amd64",
@@ -1232,54 +1494,28 @@ func (s *writerSuite) TestLocalSnapsCore18FullUse(c *C) {
 	})
 
 	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
 	s.makeSnap(c, "cont-producer", "developerid")
-
-	core18Fn := s.makeLocalSnap(c, "core18")
-	pcKernelFn := s.makeLocalSnap(c, "pc-kernel=18")
-	pcFn := s.makeLocalSnap(c, "pc=18")
-	contConsumerFn := s.makeLocalSnap(c, "cont-consumer")
+	s.makeSnap(c, "cont-consumer", "developerid")
 
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
-	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{
-		{Path: core18Fn},
-		{Name: "pc-kernel", Channel: "candidate"},
-		{Path: pcFn, Channel: "edge"},
-		{Path: pcKernelFn},
-		{Path: s.AssertedSnap("cont-producer")},
-		{Path: contConsumerFn},
-	})
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "pc", Channel: "edge"}})
 	c.Assert(err, IsNil)
 
 	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
 
-	localSnaps, err := w.LocalSnaps()
-	c.Assert(err, IsNil)
-	c.Assert(localSnaps, HasLen, 5)
-
-	for _, sn := range localSnaps {
-		si, aRefs, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
-		if !errors.Is(err, &asserts.NotFoundError{}) {
-			c.Assert(err, IsNil)
-		}
-		f, err := snapfile.Open(sn.Path)
-		c.Assert(err, IsNil)
-		info, err := snap.ReadInfoFromSnapFile(f, si)
-		c.Assert(err, IsNil)
-		w.SetInfo(sn, info, nil)
-		s.aRefs[sn.SnapName()] = aRefs
-	}
-
-	err = w.InfoDerived()
-	c.Assert(err, IsNil)
-
 	snaps, err := w.SnapsToDownload()
 	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 1)
-	c.Check(naming.SameSnap(snaps[0], naming.Snap("snapd")), Equals, true)
+	c.Check(snaps, HasLen, 6)
 
+	s.AssertedSnapInfo("cont-producer").EditedLinks = map[string][]string{
+		"contact": {"mailto:author@cont-producer.net"},
+	}
 	for _, sn := range snaps {
 		s.fillDownloadedSnap(c, w, sn)
 	}
@@ -1288,11 +1524,7 @@ func (s *writerSuite) TestLocalSnapsCore18FullUse(c *C) {
 	c.Assert(err, IsNil)
 	c.Check(complete, Equals, true)
 
-	copySnap := func(name, src, dst string) error {
-		return osutil.CopyFile(src, dst, 0)
-	}
-
-	err = w.SeedSnaps(copySnap)
+	err = w.SeedSnaps(nil)
 	c.Assert(err, IsNil)
 
 	err = w.WriteMeta()
@@ -1304,47 +1536,54 @@ func (s *writerSuite) TestLocalSnapsCore18FullUse(c *C) {
 
 	c.Check(seedYaml.Snaps, HasLen, 6)
 
-	assertedNum := 0
 	// check the files are in place
 	for i, name := range []string{"snapd", "pc-kernel", "core18", "pc", "cont-consumer", "cont-producer"} {
 		info := s.AssertedSnapInfo(name)
-		unasserted := false
-		if info == nil {
-			info = &snap.Info{
-				SuggestedName: name,
-			}
-			info.Revision = snap.R(-1)
-			unasserted = true
-		} else {
-			assertedNum++
-		}
 
 		fn := info.Filename()
 		p := filepath.Join(s.opts.SeedDir, "snaps", fn)
 		c.Check(p, testutil.FilePresent)
 
-		channel := ""
-		if !unasserted {
-			channel = "stable"
+		channel := "stable"
+		switch name {
+		case "pc-kernel":
+			channel = "18"
+		case "pc":
+			channel = "18/edge"
 		}
 
 		c.Check(seedYaml.Snaps[i], DeepEquals, &seedwriter.InternalSnap16{
-			Name:       info.SnapName(),
-			SnapID:     info.SnapID,
-			Channel:    channel,
-			File:       fn,
-			Unasserted: unasserted,
+			Name:    info.SnapName(),
+			SnapID:  info.SnapID,
+			Channel: channel,
+			File:    fn,
+			Contact: info.Contact(),
 		})
 	}
-	c.Check(assertedNum, Equals, 2)
 
 	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
 	c.Assert(err, IsNil)
 	c.Check(l, HasLen, 6)
 
-	// check the snap assertions are in place
+	// check assertions
 	seedAssertsDir := filepath.Join(s.opts.SeedDir, "assertions")
-	for _, snapName := range []string{"snapd", "cont-producer"} {
+	storeAccountKeyPK := s.StoreSigning.StoreAccountKey("").PublicKeyID()
+	brandAcctKeyPK := s.Brands.AccountKey("my-brand").PublicKeyID()
+
+	for _, fn := range []string{"model", brandAcctKeyPK + ".account-key", "my-brand.account", storeAccountKeyPK + ".account-key"} {
+		p := filepath.Join(seedAssertsDir, fn)
+		c.Check(p, testutil.FilePresent)
+	}
+
+	c.Check(filepath.Join(seedAssertsDir, "model"), testutil.FileEquals, asserts.Encode(model))
+
+	acct := seedtest.ReadAssertions(c, filepath.Join(seedAssertsDir, "my-brand.account"))
+	c.Assert(acct, HasLen, 1)
+	c.Check(acct[0].Type(), Equals, asserts.AccountType)
+	c.Check(acct[0].HeaderString("account-id"), Equals, "my-brand")
+
+	// check the snap assertions are also in place
+	for _, snapName := range []string{"snapd", "pc-kernel", "core18", "pc", "cont-consumer", "cont-producer"} {
 		p := filepath.Join(seedAssertsDir, fmt.Sprintf("16,%s.snap-declaration", s.AssertedSnapID(snapName)))
 		decl := seedtest.ReadAssertions(c, p)
 		c.Assert(decl, HasLen, 1)
@@ -1357,23 +1596,20 @@ func (s *writerSuite) TestLocalSnapsCore18FullUse(c *C) {
 		c.Check(rev[0].HeaderString("snap-id"), Equals, s.AssertedSnapID(snapName))
 	}
 
-	unassertedSnaps, err := w.UnassertedSnaps()
-	c.Assert(err, IsNil)
-	c.Check(unassertedSnaps, HasLen, 4)
-	unassertedSet := naming.NewSnapSet(unassertedSnaps)
-	for _, snapName := range []string{"core18", "pc-kernel", "pc", "cont-consumer"} {
-		c.Check(unassertedSet.Contains(naming.Snap(snapName)), Equals, true)
-	}
+	// validity check of seedtest helper
+	const usesSnapd = true
+	// core18 seeds do not use system labels
+	seedtest.ValidateSeed(c, s.opts.SeedDir, "", usesSnapd, s.StoreSigning.Trusted)
 }
 
-func (s *writerSuite) TestSeedSnapsWriteMetaDefaultTrackCore18(c *C) {
+func (s *writerSuite) TestSeedSnapsWriteMetaCore18SortSnapsAlphabetically(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name":   "my model",
 		"architecture":   "amd64",
 		"base":           "core18",
 		"gadget":         "pc=18",
 		"kernel":         "pc-kernel=18",
-		"required-snaps": []any{"required18"},
+		"required-snaps": []any{"required18", "cont-producer", "cont-consumer"},
 	})
 
 	s.makeSnap(c, "snapd", "")
@@ -1381,26 +1617,22 @@ func (s *writerSuite) TestSeedSnapsWriteMetaDefaultTrackCore18(c *C) {
 	s.makeSnap(c, "pc-kernel=18", "")
 	s.makeSnap(c, "pc=18", "")
 	s.makeSnap(c, "required18", "developerid")
+	s.makeSnap(c, "cont-producer", "developerid")
+	s.makeSnap(c, "cont-consumer", "developerid")
 
+	s.opts.SortSnapsAlphabetically = true
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
-	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "required18", Channel: "candidate"}})
-	c.Assert(err, IsNil)
-
 	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
 
 	snaps, err := w.SnapsToDownload()
 	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 5)
+	c.Check(snaps, HasLen, 7)
 
 	for _, sn := range snaps {
 		s.fillDownloadedSnap(c, w, sn)
-		if sn.SnapName() == "required18" {
-			c.Check(sn.Channel, Equals, "candidate")
-			w.SetRedirectChannel(sn, "default-track/candidate")
-		}
 	}
 
 	complete, err := w.Downloaded(s.fetchAsserts(c))
@@ -1413,61 +1645,116 @@ func (s *writerSuite) TestSeedSnapsWriteMetaDefaultTrackCore18(c *C) {
 	err = w.WriteMeta()
 	c.Assert(err, IsNil)
 
-	// check seed
 	seedYaml, err := seedwriter.InternalReadSeedYaml(filepath.Join(s.opts.SeedDir, "seed.yaml"))
 	c.Assert(err, IsNil)
 
-	c.Check(seedYaml.Snaps, HasLen, 5)
-
-	info := s.AssertedSnapInfo("required18")
-	fn := info.Filename()
-	c.Check(filepath.Join(s.opts.SeedDir, "snaps", fn), testutil.FilePresent)
-	c.Check(seedYaml.Snaps[4], DeepEquals, &seedwriter.InternalSnap16{
-		Name:    info.SnapName(),
-		SnapID:  info.SnapID,
-		Channel: "default-track/candidate",
-		File:    fn,
-	})
+	var names []string
+	for _, sn := range seedYaml.Snaps {
+		names = append(names, sn.Name)
+	}
+	// the essential snaps keep their boot order
+	c.Check(names, DeepEquals, []string{"snapd", "pc-kernel", "core18", "pc", "cont-consumer", "cont-producer", "required18"})
+}
 
+func (s *writerSuite) makeGadgetWithDefaults(c *C, defaults string) {
+	files := [][]string{{"meta/gadget.yaml", pcGadgetYaml + defaults}}
+	s.MakeAssertedSnap(c, snapYaml["pc=18"], files, snap.R(1), "canonical", s.StoreSigning.Database)
 }
 
-func (s *writerSuite) TestSetRedirectChannelErrors(c *C) {
+func (s *writerSuite) TestGadgetDefaults(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name":   "my model",
 		"architecture":   "amd64",
 		"base":           "core18",
 		"gadget":         "pc=18",
 		"kernel":         "pc-kernel=18",
-		"required-snaps": []any{"required18"},
+		"required-snaps": []any{"cont-consumer", "cont-producer"},
 	})
 
 	s.makeSnap(c, "snapd", "")
 	s.makeSnap(c, "core18", "")
 	s.makeSnap(c, "pc-kernel=18", "")
-	s.makeSnap(c, "pc=18", "")
-	s.makeSnap(c, "required18", "developerid")
+	s.makeGadgetWithDefaults(c, fmt.Sprintf(`
+defaults:
+  system:
+    service.rsyslog.disable: true
+  %s:
+    foo: bar
+`, s.AssertedSnapID("cont-producer")))
+	s.makeSnap(c, "cont-producer", "developerid")
+	s.makeSnap(c, "cont-consumer", "developerid")
 
+	s.opts.CheckGadgetDefaults = true
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
 	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
 
+	_, err = w.GadgetDefaults()
+	c.Check(err, ErrorMatches, "internal error: seedwriter.Writer cannot query seed snaps before Downloaded signaled complete")
+
 	snaps, err := w.SnapsToDownload()
 	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 5)
-
-	sn := snaps[4]
-	c.Assert(sn.SnapName(), Equals, "required18")
+	c.Check(snaps, HasLen, 6)
 
-	c.Check(w.SetRedirectChannel(sn, "default-track/stable"), ErrorMatches, `internal error: before using seedwriter.Writer.SetRedirectChannel snap "required18" Info should have been set`)
+	for _, sn := range snaps {
+		s.fillDownloadedSnap(c, w, sn)
+	}
 
-	s.fillDownloadedSnap(c, w, sn)
+	complete, err := w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
 
-	c.Check(w.SetRedirectChannel(sn, "default-track//stable"), ErrorMatches, `invalid redirect channel for snap "required18":.*`)
+	defaults, err := w.GadgetDefaults()
+	c.Assert(err, IsNil)
+	c.Check(defaults, DeepEquals, map[string]any{
+		"system": map[string]any{
+			"service.rsyslog.disable": true,
+		},
+		s.AssertedSnapID("cont-producer"): map[string]any{
+			"foo": "bar",
+		},
+	})
 }
 
-func (s *writerSuite) TestInfoDerivedInfosNotSet(c *C) {
+func (s *writerSuite) TestGadgetDefaultsNoDefaults(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core18",
+		"gadget":       "pc=18",
+		"kernel":       "pc-kernel=18",
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+
+	s.opts.CheckGadgetDefaults = true
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	for _, sn := range snaps {
+		s.fillDownloadedSnap(c, w, sn)
+	}
+
+	complete, err := w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	defaults, err := w.GadgetDefaults()
+	c.Assert(err, IsNil)
+	c.Check(defaults, IsNil)
+}
+
+func (s *writerSuite) TestCheckGadgetDefaultsSnapNotSeeded(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name":   "my model",
 		"architecture":   "amd64",
@@ -1477,75 +1764,185 @@ func (s *writerSuite) TestInfoDerivedInfosNotSet(c *C) {
 		"required-snaps": []any{"cont-consumer", "cont-producer"},
 	})
 
-	core18Fn := s.makeLocalSnap(c, "core18")
-	pcKernelFn := s.makeLocalSnap(c, "pc-kernel=18")
-	pcFn := s.makeLocalSnap(c, "pc=18")
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeGadgetWithDefaults(c, fmt.Sprintf(`
+defaults:
+  %s:
+    foo: bar
+  %s:
+    foo: baz
+`, s.AssertedSnapID("cont-producer"), s.AssertedSnapID("required18")))
+	s.makeSnap(c, "cont-producer", "developerid")
+	s.makeSnap(c, "cont-consumer", "developerid")
 
+	s.opts.CheckGadgetDefaults = true
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
-	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{
-		{Path: core18Fn},
-		{Path: pcFn, Channel: "edge"},
-		{Path: pcKernelFn},
-	})
-	c.Assert(err, IsNil)
-
 	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
 
-	_, err = w.LocalSnaps()
+	snaps, err := w.SnapsToDownload()
 	c.Assert(err, IsNil)
+	for _, sn := range snaps {
+		s.fillDownloadedSnap(c, w, sn)
+	}
 
-	err = w.InfoDerived()
-	c.Assert(err, ErrorMatches, `internal error: before seedwriter.Writer.InfoDerived snap ".*/core18.*.snap" Info should have been set`)
+	_, err = w.Downloaded(s.fetchAsserts(c))
+	c.Check(err, ErrorMatches, fmt.Sprintf("gadget defaults are for snaps that are not part of the seed: snap-ids %s", s.AssertedSnapID("required18")))
 }
 
-func (s *writerSuite) TestInfoDerivedRepeatedLocalSnap(c *C) {
+func (s *writerSuite) TestSeedSnapsWriteMetaCore18NoSeparateSnapd(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name":   "my model",
 		"architecture":   "amd64",
 		"base":           "core18",
 		"gadget":         "pc=18",
 		"kernel":         "pc-kernel=18",
-		"required-snaps": []any{"cont-consumer", "cont-producer"},
+		"required-snaps": []any{"required18"},
 	})
 
-	core18Fn := s.makeLocalSnap(c, "core18")
-	pcKernelFn := s.makeLocalSnap(c, "pc-kernel=18")
-	pcFn := s.makeLocalSnap(c, "pc=18")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "required18", "developerid")
 
+	s.opts.NoSeparateSnapd = true
+	// the base carries snapd
+	s.expectedSysSnap = "core18"
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
-	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{
-		{Path: core18Fn},
-		{Path: pcFn, Channel: "edge"},
-		{Path: pcKernelFn},
-		{Path: core18Fn},
-	})
+	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
 
-	err = w.Start(s.db, s.rf)
+	snaps, err := w.SnapsToDownload()
 	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 4)
+	for _, sn := range snaps {
+		c.Check(sn.SnapName(), Not(Equals), "snapd")
+		s.fillDownloadedSnap(c, w, sn)
+	}
 
-	localSnaps, err := w.LocalSnaps()
+	complete, err := w.Downloaded(s.fetchAsserts(c))
 	c.Assert(err, IsNil)
-	c.Check(localSnaps, HasLen, 4)
+	c.Check(complete, Equals, true)
+	c.Check(s.fetchAssertsCalled, Equals, true)
 
-	for _, sn := range localSnaps {
-		f, err := snapfile.Open(sn.Path)
-		c.Assert(err, IsNil)
-		info, err := snap.ReadInfoFromSnapFile(f, nil)
-		c.Assert(err, IsNil)
-		w.SetInfo(sn, info, nil)
+	err = w.SeedSnaps(nil)
+	c.Assert(err, IsNil)
+
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
+
+	seedYaml, err := seedwriter.InternalReadSeedYaml(filepath.Join(s.opts.SeedDir, "seed.yaml"))
+	c.Assert(err, IsNil)
+	var names []string
+	for _, sn := range seedYaml.Snaps {
+		names = append(names, sn.Name)
 	}
+	c.Check(names, DeepEquals, []string{"pc-kernel", "core18", "pc", "required18"})
+}
 
-	err = w.InfoDerived()
-	c.Assert(err, ErrorMatches, `local snap "core18" is repeated in options`)
+func (s *writerSuite) TestNoSeparateSnapdErrors(c *C) {
+	tests := []struct {
+		model map[string]any
+		err   string
+	}{
+		{map[string]any{
+			"gadget": "pc",
+			"kernel": "pc-kernel",
+		}, `cannot omit the snapd snap from the seed of a model without a base or a classic one`},
+		{map[string]any{
+			"classic": "true",
+		}, `cannot omit the snapd snap from the seed of a model without a base or a classic one`},
+		{map[string]any{
+			"base":           "core18",
+			"gadget":         "pc=18",
+			"kernel":         "pc-kernel=18",
+			"required-snaps": []any{"snapd"},
+		}, `cannot omit the snapd snap from the seed, it is listed by the model`},
+		{map[string]any{
+			"base":  "core20",
+			"grade": "dangerous",
+			"snaps": []any{
+				map[string]any{
+					"name":            "pc-kernel",
+					"id":              s.AssertedSnapID("pc-kernel"),
+					"type":            "kernel",
+					"default-channel": "20",
+				},
+				map[string]any{
+					"name":            "pc",
+					"id":              s.AssertedSnapID("pc"),
+					"type":            "gadget",
+					"default-channel": "20",
+				},
+			},
+		}, `cannot omit the snapd snap from the seed of a UC20\+ model`},
+	}
+
+	s.opts.NoSeparateSnapd = true
+	s.opts.Label = "20191030"
+	for _, t := range tests {
+		headers := map[string]any{
+			"display-name": "my model",
+			"architecture": "amd64",
+		}
+		for k, v := range t.model {
+			headers[k] = v
+		}
+		model := s.Brands.Model("my-brand", "my-model", headers)
+		_, err := seedwriter.New(model, s.opts)
+		c.Check(err, ErrorMatches, t.err)
+	}
 }
 
-func (s *writerSuite) TestInfoDerivedInconsistentChannel(c *C) {
+func (s *writerSuite) TestSeedSnapsWriteMetaCore18StoreAssertion(c *C) {
+	// add store assertion
+	storeAs, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
+		"store":       "my-store",
+		"operator-id": "canonical",
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	err = s.StoreSigning.Add(storeAs)
+	c.Assert(err, IsNil)
+
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core18",
+		"gadget":       "pc=18",
+		"kernel":       "pc-kernel=18",
+		"store":        "my-store",
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	err = w.SeedSnaps(nil)
+	c.Assert(err, IsNil)
+
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
+
+	// check assertions
+	seedAssertsDir := filepath.Join(s.opts.SeedDir, "assertions")
+	// check the store assertion was fetched
+	p := filepath.Join(seedAssertsDir, "my-store.store")
+	c.Check(p, testutil.FilePresent)
+}
+
+func (s *writerSuite) TestLocalSnaps(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name":   "my model",
 		"architecture":   "amd64",
@@ -1558,6 +1955,7 @@ func (s *writerSuite) TestInfoDerivedInconsistentChannel(c *C) {
 	core18Fn := s.makeLocalSnap(c, "core18")
 	pcKernelFn := s.makeLocalSnap(c, "pc-kernel=18")
 	pcFn := s.makeLocalSnap(c, "pc=18")
+	contConsumerFn := s.makeLocalSnap(c, "cont-consumer")
 
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
@@ -1566,7 +1964,7 @@ func (s *writerSuite) TestInfoDerivedInconsistentChannel(c *C) {
 		{Path: core18Fn},
 		{Path: pcFn, Channel: "edge"},
 		{Path: pcKernelFn},
-		{Name: "pc", Channel: "beta"},
+		{Path: contConsumerFn},
 	})
 	c.Assert(err, IsNil)
 
@@ -1575,226 +1973,360 @@ func (s *writerSuite) TestInfoDerivedInconsistentChannel(c *C) {
 
 	localSnaps, err := w.LocalSnaps()
 	c.Assert(err, IsNil)
-	c.Check(localSnaps, HasLen, 3)
-
-	for _, sn := range localSnaps {
-		f, err := snapfile.Open(sn.Path)
-		c.Assert(err, IsNil)
-		info, err := snap.ReadInfoFromSnapFile(f, nil)
-		c.Assert(err, IsNil)
-		w.SetInfo(sn, info, nil)
-	}
-
-	err = w.InfoDerived()
-	c.Assert(err, ErrorMatches, `option snap has different channels specified: ".*/pc.*.snap"="edge" vs "pc"="beta"`)
+	c.Assert(localSnaps, HasLen, 4)
+	c.Check(localSnaps[0].Path, Equals, core18Fn)
+	c.Check(localSnaps[1].Path, Equals, pcFn)
+	c.Check(localSnaps[2].Path, Equals, pcKernelFn)
+	c.Check(localSnaps[3].Path, Equals, contConsumerFn)
 }
 
-func (s *writerSuite) TestSetRedirectChannelLocalError(c *C) {
+func (s *writerSuite) TestSnapSourceStoreAndLocal(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
-		"display-name": "my model",
-		"architecture": "amd64",
-		"base":         "core18",
-		"gadget":       "pc=18",
-		"kernel":       "pc-kernel=18",
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"cont-consumer", "cont-producer"},
 	})
 
-	core18Fn := s.makeLocalSnap(c, "core18")
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "cont-producer", "developerid")
+
+	contConsumerFn := s.makeLocalSnap(c, "cont-consumer")
 
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
 	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{
-		{Path: core18Fn},
+		{Path: s.AssertedSnap("cont-producer")},
+		{Path: contConsumerFn},
 	})
 	c.Assert(err, IsNil)
 
 	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
 
+	_, err = w.SnapSource("snapd")
+	c.Check(err, ErrorMatches, "internal error: seedwriter.Writer cannot query seed snaps before Downloaded signaled complete")
+
 	localSnaps, err := w.LocalSnaps()
 	c.Assert(err, IsNil)
-	c.Check(localSnaps, HasLen, 1)
+	c.Assert(localSnaps, HasLen, 2)
 
-	sn := localSnaps[0]
-	f, err := snapfile.Open(sn.Path)
+	for _, sn := range localSnaps {
+		si, aRefs, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
+		if !errors.Is(err, &asserts.NotFoundError{}) {
+			c.Assert(err, IsNil)
+		}
+		f, err := snapfile.Open(sn.Path)
+		c.Assert(err, IsNil)
+		info, err := snap.ReadInfoFromSnapFile(f, si)
+		c.Assert(err, IsNil)
+		w.SetInfo(sn, info, nil)
+		s.aRefs[sn.SnapName()] = aRefs
+	}
+
+	err = w.InfoDerived()
 	c.Assert(err, IsNil)
-	info, err := snap.ReadInfoFromSnapFile(f, nil)
+
+	snaps, err := w.SnapsToDownload()
 	c.Assert(err, IsNil)
-	err = w.SetInfo(sn, info, nil)
+	c.Check(snaps, HasLen, 4)
+
+	for _, sn := range snaps {
+		s.fillDownloadedSnap(c, w, sn)
+	}
+
+	complete, err := w.Downloaded(s.fetchAsserts(c))
 	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
 
-	c.Check(w.SetRedirectChannel(sn, "foo"), ErrorMatches, `internal error: cannot set redirect channel for local snap .*`)
+	for name, expected := range map[string]seedwriter.SeedSnapSource{
+		"snapd":     seedwriter.SeedSnapFromStore,
+		"core18":    seedwriter.SeedSnapFromStore,
+		"pc-kernel": seedwriter.SeedSnapFromStore,
+		"pc":        seedwriter.SeedSnapFromStore,
+		// asserted but supplied as a local file
+		"cont-producer": seedwriter.SeedSnapFromLocalPath,
+		"cont-consumer": seedwriter.SeedSnapFromLocalPath,
+	} {
+		src, err := w.SnapSource(name)
+		c.Assert(err, IsNil)
+		c.Check(src, Equals, expected, Commentf(name))
+	}
 
+	_, err = w.SnapSource("other")
+	c.Check(err, ErrorMatches, `snap "other" is not part of the seed`)
 }
 
-func (s *writerSuite) TestSeedSnapsWriteMetaClassicWithCore(c *C) {
+func (s *writerSuite) TestSelfBasedSnaps(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
-		"classic":        "true",
+		"display-name":   "my model",
 		"architecture":   "amd64",
-		"gadget":         "classic-gadget",
-		"required-snaps": []any{"required"},
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"core", "core20", "required", "required18", "bare-app"},
 	})
 
-	s.makeSnap(c, "core", "")
-	s.makeSnap(c, "classic-gadget", "")
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "core", "")
+	s.makeSnap(c, "core20", "")
 	s.makeSnap(c, "required", "developerid")
+	s.makeSnap(c, "required18", "developerid")
+	s.makeSnap(c, "bare-app", "developerid")
 
-	s.expectedSysSnap = "core"
-	// no kernel
-	s.expectedKernSnap = ""
-
-	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
-	c.Check(complete, Equals, false)
+	c.Check(w.SelfBasedSnaps(), IsNil)
 
-	snaps, err := w.SnapsToDownload()
+	complete, w, err := s.upToDownloaded(c, model, s.fillMetaDownloadedSnap, s.fetchAsserts(c))
 	c.Assert(err, IsNil)
-	c.Assert(snaps, HasLen, 1)
+	c.Assert(complete, Equals, true)
 
-	s.fillDownloadedSnap(c, w, snaps[0])
+	// the kernel, gadget and app snaps depend on a separate base
+	c.Check(w.SelfBasedSnaps(), DeepEquals, []string{"snapd", "core18", "core", "core20", "bare-app"})
+}
 
-	s.expectedSysSnap = "core"
+func (s *writerSuite) upToInfoDerivedCrossArch(c *C, localYamlKey string) (*seedwriter.Writer, error) {
+	// the host is amd64 while the model is for arm64
+	oldArch := arch.DpkgArchitecture()
+	arch.SetArchitecture("amd64")
+	s.AddCleanup(func() { arch.SetArchitecture(arch.ArchitectureType(oldArch)) })
 
-	complete, err = w.Downloaded(s.fetchAsserts(c))
-	c.Assert(err, IsNil)
-	c.Check(complete, Equals, true)
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "arm64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"arm64-app", localYamlKey},
+	})
 
-	_, err = w.BootSnaps()
-	c.Check(err, ErrorMatches, "no snaps participating in boot on classic")
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "arm64-app", "developerid")
 
-	err = w.SeedSnaps(nil)
-	c.Assert(err, IsNil)
+	localFn := s.makeLocalSnap(c, localYamlKey)
 
-	err = w.WriteMeta()
+	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
-	// check seed
-	seedYaml, err := seedwriter.InternalReadSeedYaml(filepath.Join(s.opts.SeedDir, "seed.yaml"))
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Path: localFn}})
 	c.Assert(err, IsNil)
 
-	c.Check(seedYaml.Snaps, HasLen, 3)
-
-	// check the files are in place
-	for i, name := range []string{"core", "classic-gadget", "required"} {
-		info := s.AssertedSnapInfo(name)
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
 
-		fn := info.Filename()
-		p := filepath.Join(s.opts.SeedDir, "snaps", fn)
-		c.Check(p, testutil.FilePresent)
+	localSnaps, err := w.LocalSnaps()
+	c.Assert(err, IsNil)
+	c.Assert(localSnaps, HasLen, 1)
 
-		c.Check(seedYaml.Snaps[i], DeepEquals, &seedwriter.InternalSnap16{
-			Name:    info.SnapName(),
-			SnapID:  info.SnapID,
-			Channel: "stable",
-			File:    fn,
-			Contact: info.Contact(),
-		})
+	for _, sn := range localSnaps {
+		f, err := snapfile.Open(sn.Path)
+		c.Assert(err, IsNil)
+		info, err := snap.ReadInfoFromSnapFile(f, nil)
+		c.Assert(err, IsNil)
+		w.SetInfo(sn, info, nil)
 	}
-}
-
-func (s *writerSuite) TestSeedSnapsWriteMetaClassicSnapdOnly(c *C) {
-	model := s.Brands.Model("my-brand", "my-model", map[string]any{
-		"classic":        "true",
-		"architecture":   "amd64",
-		"gadget":         "classic-gadget18",
-		"required-snaps": []any{"core18", "required18"},
-	})
-
-	s.makeSnap(c, "snapd", "")
-	s.makeSnap(c, "core18", "")
-	s.makeSnap(c, "classic-gadget18", "")
-	s.makeSnap(c, "required18", "developerid")
 
-	// no kernel
-	s.expectedKernSnap = ""
+	return w, w.InfoDerived()
+}
 
-	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+func (s *writerSuite) TestCrossArchSeed(c *C) {
+	w, err := s.upToInfoDerivedCrossArch(c, "arm64-local")
 	c.Assert(err, IsNil)
-	c.Check(complete, Equals, false)
 
 	snaps, err := w.SnapsToDownload()
 	c.Assert(err, IsNil)
-	c.Assert(snaps, HasLen, 1)
+	c.Check(snaps, HasLen, 5)
 
-	s.fillDownloadedSnap(c, w, snaps[0])
+	for _, sn := range snaps {
+		s.fillDownloadedSnap(c, w, sn)
+	}
 
-	complete, err = w.Downloaded(s.fetchAsserts(c))
+	complete, err := w.Downloaded(s.fetchAsserts(c))
 	c.Assert(err, IsNil)
 	c.Check(complete, Equals, true)
 
-	err = w.SeedSnaps(nil)
+	copySnap := func(name, src, dst string) error {
+		return osutil.CopyFile(src, dst, 0)
+	}
+
+	err = w.SeedSnaps(copySnap)
 	c.Assert(err, IsNil)
 
 	err = w.WriteMeta()
 	c.Assert(err, IsNil)
 
-	// check seed
 	seedYaml, err := seedwriter.InternalReadSeedYaml(filepath.Join(s.opts.SeedDir, "seed.yaml"))
 	c.Assert(err, IsNil)
-	c.Assert(seedYaml.Snaps, HasLen, 4)
+	var names []string
+	for _, sn := range seedYaml.Snaps {
+		names = append(names, sn.Name)
+	}
+	c.Check(names, DeepEquals, []string{"snapd", "pc-kernel", "core18", "pc", "arm64-app", "arm64-local"})
+	c.Check(filepath.Join(s.opts.SeedDir, "snaps", "arm64-app_1.snap"), testutil.FilePresent)
+	c.Check(filepath.Join(s.opts.SeedDir, "snaps", "arm64-local_x1.snap"), testutil.FilePresent)
+}
 
-	// check the files are in place
-	for i, name := range []string{"snapd", "core18", "classic-gadget18", "required18"} {
-		info := s.AssertedSnapInfo(name)
+func (s *writerSuite) TestCrossArchSeedLocalSnapForHostArch(c *C) {
+	// a local snap only for the host architecture is not usable for
+	// the model
+	_, err := s.upToInfoDerivedCrossArch(c, "amd64-local")
+	c.Assert(err, ErrorMatches, `snap "amd64-local" supported architectures \(amd64\) are incompatible with the model architecture \(arm64\)`)
+}
 
-		fn := info.Filename()
-		p := filepath.Join(s.opts.SeedDir, "snaps", fn)
-		c.Check(p, testutil.FilePresent)
+func (s *writerSuite) TestCrossArchSeedStoreSnapForOtherArch(c *C) {
+	w, err := s.upToInfoDerivedCrossArch(c, "arm64-local")
+	c.Assert(err, IsNil)
 
-		c.Check(seedYaml.Snaps[i], DeepEquals, &seedwriter.InternalSnap16{
-			Name:    info.SnapName(),
-			SnapID:  info.SnapID,
-			Channel: "stable",
-			File:    fn,
-			Contact: info.Contact(),
-		})
-	}
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 5)
+	sn := snaps[4]
+	c.Assert(sn.SnapName(), Equals, "arm64-app")
+
+	info := *s.AssertedSnapInfo("arm64-app")
+	info.Architectures = []string{"amd64", "armhf"}
+	err = w.SetInfo(sn, &info, nil)
+	c.Assert(err, ErrorMatches, `snap "arm64-app" supported architectures \(amd64, armhf\) are incompatible with the model architecture \(arm64\)`)
 }
 
-func (s *writerSuite) TestSeedSnapsWriteMetaClassicMinModelNoSysSnap(c *C) {
-	// this is a degenerate case but has been historically supported,
-	// see image_test.go TestPrepareClassicModelNoModelAssertion
-	model := s.Brands.Model("my-brand", "my-min-model", map[string]any{
-		"classic": "true",
+func (s *writerSuite) TestCrossArchSeedArchitectureFromOptions(c *C) {
+	// the option takes precedence over the model architecture
+	s.opts.Architecture = "amd64"
+	_, err := s.upToInfoDerivedCrossArch(c, "amd64-local")
+	c.Assert(err, IsNil)
+}
+
+func (s *writerSuite) testDetectDuplicateSnapIDs(c *C, sharedID bool) []seedwriter.SnapIDConflict {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"cont-producer", "dbus-provider"},
 	})
 
-	s.makeSnap(c, "required18", "developerid")
+	s.makeSnap(c, "snapd", "")
 	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "cont-producer", "developerid")
+	s.makeSnap(c, "dbus-provider", "developerid")
 
-	// no sys snap
-	s.expectedSysSnap = ""
-	// no kernel
-	s.expectedKernSnap = ""
+	fill := func(c *C, w *seedwriter.Writer, sn *seedwriter.SeedSnap) {
+		s.fillDownloadedSnap(c, w, sn)
+		if sharedID && sn.SnapName() == "dbus-provider" {
+			// simulate a misconfigured store resolving both
+			// snaps to the same snap-id
+			sn.Info.SnapID = s.AssertedSnapID("cont-producer")
+		}
+	}
 
-	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c), &seedwriter.OptionsSnap{Name: "required18"}, &seedwriter.OptionsSnap{Name: "core18"})
+	complete, w, err := s.upToDownloaded(c, model, fill, s.fetchAsserts(c))
 	c.Assert(err, IsNil)
-	c.Check(complete, Equals, false)
+	c.Assert(complete, Equals, true)
 
-	snaps, err := w.SnapsToDownload()
+	return w.DetectDuplicateSnapIDs()
+}
+
+func (s *writerSuite) TestDetectDuplicateSnapIDs(c *C) {
+	conflicts := s.testDetectDuplicateSnapIDs(c, true)
+	c.Check(conflicts, DeepEquals, []seedwriter.SnapIDConflict{{
+		SnapID:    s.AssertedSnapID("cont-producer"),
+		SnapNames: []string{"cont-producer", "dbus-provider"},
+	}})
+}
+
+func (s *writerSuite) TestDetectDuplicateSnapIDsNone(c *C) {
+	conflicts := s.testDetectDuplicateSnapIDs(c, false)
+	c.Check(conflicts, HasLen, 0)
+}
+
+func (s *writerSuite) TestLocalSnapsCore18FullUse(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"cont-consumer", "cont-producer"},
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "cont-producer", "developerid")
+
+	core18Fn := s.makeLocalSnap(c, "core18")
+	pcKernelFn := s.makeLocalSnap(c, "pc-kernel=18")
+	pcFn := s.makeLocalSnap(c, "pc=18")
+	contConsumerFn := s.makeLocalSnap(c, "cont-consumer")
+
+	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
-	c.Assert(snaps, HasLen, 2)
 
-	s.fillDownloadedSnap(c, w, snaps[0])
-	s.fillDownloadedSnap(c, w, snaps[1])
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{
+		{Path: core18Fn},
+		{Name: "pc-kernel", Channel: "candidate"},
+		{Path: pcFn, Channel: "edge"},
+		{Path: pcKernelFn},
+		{Path: s.AssertedSnap("cont-producer")},
+		{Path: contConsumerFn},
+	})
+	c.Assert(err, IsNil)
 
-	complete, err = w.Downloaded(s.fetchAsserts(c))
+	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
-	c.Check(complete, Equals, false)
 
-	snaps, err = w.SnapsToDownload()
+	localSnaps, err := w.LocalSnaps()
 	c.Assert(err, IsNil)
-	c.Assert(snaps, HasLen, 0)
+	c.Assert(localSnaps, HasLen, 5)
 
-	complete, err = w.Downloaded(s.fetchAsserts(c))
+	for _, sn := range localSnaps {
+		si, aRefs, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
+		if !errors.Is(err, &asserts.NotFoundError{}) {
+			c.Assert(err, IsNil)
+		}
+		f, err := snapfile.Open(sn.Path)
+		c.Assert(err, IsNil)
+		info, err := snap.ReadInfoFromSnapFile(f, si)
+		c.Assert(err, IsNil)
+		w.SetInfo(sn, info, nil)
+		s.aRefs[sn.SnapName()] = aRefs
+	}
+
+	err = w.InfoDerived()
 	c.Assert(err, IsNil)
-	c.Check(complete, Equals, true)
 
-	c.Check(s.fetchAssertsCalled, Equals, true)
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Check(snaps, HasLen, 1)
+	c.Check(naming.SameSnap(snaps[0], naming.Snap("snapd")), Equals, true)
 
-	_, err = w.BootSnaps()
-	c.Check(err, ErrorMatches, "no snaps participating in boot on classic")
+	for _, sn := range snaps {
+		s.fillDownloadedSnap(c, w, sn)
+	}
 
-	err = w.SeedSnaps(nil)
+	complete, err := w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	copySnap := func(name, src, dst string) error {
+		return osutil.CopyFile(src, dst, 0)
+	}
+
+	err = w.SeedSnaps(copySnap)
 	c.Assert(err, IsNil)
 
 	err = w.WriteMeta()
@@ -1804,66 +2336,111 @@ func (s *writerSuite) TestSeedSnapsWriteMetaClassicMinModelNoSysSnap(c *C) {
 	seedYaml, err := seedwriter.InternalReadSeedYaml(filepath.Join(s.opts.SeedDir, "seed.yaml"))
 	c.Assert(err, IsNil)
 
-	c.Check(seedYaml.Snaps, HasLen, 2)
+	c.Check(seedYaml.Snaps, HasLen, 6)
 
+	assertedNum := 0
 	// check the files are in place
-	for i, name := range []string{"core18", "required18"} {
+	for i, name := range []string{"snapd", "pc-kernel", "core18", "pc", "cont-consumer", "cont-producer"} {
 		info := s.AssertedSnapInfo(name)
+		unasserted := false
+		if info == nil {
+			info = &snap.Info{
+				SuggestedName: name,
+			}
+			info.Revision = snap.R(-1)
+			unasserted = true
+		} else {
+			assertedNum++
+		}
 
 		fn := info.Filename()
 		p := filepath.Join(s.opts.SeedDir, "snaps", fn)
 		c.Check(p, testutil.FilePresent)
 
-		c.Check(seedYaml.Snaps[i], DeepEquals, &seedwriter.InternalSnap16{
-			Name:    info.SnapName(),
-			SnapID:  info.SnapID,
-			Channel: "stable",
-			File:    fn,
-			Contact: info.Contact(),
+		channel := ""
+		if !unasserted {
+			channel = "stable"
+		}
+
+		c.Check(seedYaml.Snaps[i], DeepEquals, &seedwriter.InternalSnap16{
+			Name:       info.SnapName(),
+			SnapID:     info.SnapID,
+			Channel:    channel,
+			File:       fn,
+			Unasserted: unasserted,
 		})
 	}
+	c.Check(assertedNum, Equals, 2)
+
+	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
+	c.Assert(err, IsNil)
+	c.Check(l, HasLen, 6)
+
+	// check the snap assertions are in place
+	seedAssertsDir := filepath.Join(s.opts.SeedDir, "assertions")
+	for _, snapName := range []string{"snapd", "cont-producer"} {
+		p := filepath.Join(seedAssertsDir, fmt.Sprintf("16,%s.snap-declaration", s.AssertedSnapID(snapName)))
+		decl := seedtest.ReadAssertions(c, p)
+		c.Assert(decl, HasLen, 1)
+		c.Check(decl[0].Type(), Equals, asserts.SnapDeclarationType)
+		c.Check(decl[0].HeaderString("snap-name"), Equals, snapName)
+		p = filepath.Join(seedAssertsDir, fmt.Sprintf("%s.snap-revision", s.AssertedSnapRevision(snapName).SnapSHA3_384()))
+		rev := seedtest.ReadAssertions(c, p)
+		c.Assert(rev, HasLen, 1)
+		c.Check(rev[0].Type(), Equals, asserts.SnapRevisionType)
+		c.Check(rev[0].HeaderString("snap-id"), Equals, s.AssertedSnapID(snapName))
+	}
+
+	unassertedSnaps, err := w.UnassertedSnaps()
+	c.Assert(err, IsNil)
+	c.Check(unassertedSnaps, HasLen, 4)
+	unassertedSet := naming.NewSnapSet(unassertedSnaps)
+	for _, snapName := range []string{"core18", "pc-kernel", "pc", "cont-consumer"} {
+		c.Check(unassertedSet.Contains(naming.Snap(snapName)), Equals, true)
+	}
 }
 
-func (s *writerSuite) TestSeedSnapsWriteMetaClassicMinModelCore(c *C) {
-	model := s.Brands.Model("my-brand", "my-min-model", map[string]any{
-		"classic": "true",
+func (s *writerSuite) TestSeedSnapsWriteMetaDefaultTrackCore18(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"required18"},
 	})
 
-	s.makeSnap(c, "required", "developerid")
-	s.makeSnap(c, "core", "")
-
-	s.expectedSysSnap = "core"
-	// no kernel
-	s.expectedKernSnap = ""
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "required18", "developerid")
 
-	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c), &seedwriter.OptionsSnap{Name: "core"}, &seedwriter.OptionsSnap{Name: "required"})
+	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
-	c.Check(complete, Equals, false)
 
-	snaps, err := w.SnapsToDownload()
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "required18", Channel: "candidate"}})
 	c.Assert(err, IsNil)
-	c.Assert(snaps, HasLen, 2)
-
-	s.fillDownloadedSnap(c, w, snaps[0])
-	s.fillDownloadedSnap(c, w, snaps[1])
 
-	complete, err = w.Downloaded(s.fetchAsserts(c))
+	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
-	c.Check(complete, Equals, false)
 
-	snaps, err = w.SnapsToDownload()
+	snaps, err := w.SnapsToDownload()
 	c.Assert(err, IsNil)
-	c.Assert(snaps, HasLen, 0)
+	c.Check(snaps, HasLen, 5)
 
-	complete, err = w.Downloaded(s.fetchAsserts(c))
+	for _, sn := range snaps {
+		s.fillDownloadedSnap(c, w, sn)
+		if sn.SnapName() == "required18" {
+			c.Check(sn.Channel, Equals, "candidate")
+			w.SetRedirectChannel(sn, "default-track/candidate")
+		}
+	}
+
+	complete, err := w.Downloaded(s.fetchAsserts(c))
 	c.Assert(err, IsNil)
 	c.Check(complete, Equals, true)
 
-	c.Check(s.fetchAssertsCalled, Equals, true)
-
-	_, err = w.BootSnaps()
-	c.Check(err, ErrorMatches, "no snaps participating in boot on classic")
-
 	err = w.SeedSnaps(nil)
 	c.Assert(err, IsNil)
 
@@ -1874,285 +2451,218 @@ func (s *writerSuite) TestSeedSnapsWriteMetaClassicMinModelCore(c *C) {
 	seedYaml, err := seedwriter.InternalReadSeedYaml(filepath.Join(s.opts.SeedDir, "seed.yaml"))
 	c.Assert(err, IsNil)
 
-	c.Check(seedYaml.Snaps, HasLen, 2)
-
-	// check the files are in place
-	for i, name := range []string{"core", "required"} {
-		info := s.AssertedSnapInfo(name)
+	c.Check(seedYaml.Snaps, HasLen, 5)
 
-		fn := info.Filename()
-		p := filepath.Join(s.opts.SeedDir, "snaps", fn)
-		c.Check(p, testutil.FilePresent)
+	info := s.AssertedSnapInfo("required18")
+	fn := info.Filename()
+	c.Check(filepath.Join(s.opts.SeedDir, "snaps", fn), testutil.FilePresent)
+	c.Check(seedYaml.Snaps[4], DeepEquals, &seedwriter.InternalSnap16{
+		Name:    info.SnapName(),
+		SnapID:  info.SnapID,
+		Channel: "default-track/candidate",
+		File:    fn,
+	})
 
-		c.Check(seedYaml.Snaps[i], DeepEquals, &seedwriter.InternalSnap16{
-			Name:    info.SnapName(),
-			SnapID:  info.SnapID,
-			Channel: "stable",
-			File:    fn,
-			Contact: info.Contact(),
-		})
-	}
 }
 
-func (s *writerSuite) TestSeedSnapsWriteMetaClassicMinModelSnapdFromOptionsWins(c *C) {
-	model := s.Brands.Model("my-brand", "my-min-model", map[string]any{
-		"classic": "true",
+func (s *writerSuite) TestSetRedirectChannelErrors(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"required18"},
 	})
 
 	s.makeSnap(c, "snapd", "")
-	s.makeSnap(c, "required", "developerid")
-	s.makeSnap(c, "core", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "required18", "developerid")
 
-	s.expectedSysSnap = "snapd"
-	// no kernel
-	s.expectedKernSnap = ""
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
 
-	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c), &seedwriter.OptionsSnap{Name: "core"}, &seedwriter.OptionsSnap{Name: "required"}, &seedwriter.OptionsSnap{Name: "snapd"})
+	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
-	c.Check(complete, Equals, false)
 
 	snaps, err := w.SnapsToDownload()
 	c.Assert(err, IsNil)
-	c.Assert(snaps, HasLen, 3)
+	c.Check(snaps, HasLen, 5)
 
-	s.fillDownloadedSnap(c, w, snaps[0])
-	s.fillDownloadedSnap(c, w, snaps[1])
-	s.fillDownloadedSnap(c, w, snaps[2])
+	sn := snaps[4]
+	c.Assert(sn.SnapName(), Equals, "required18")
 
-	complete, err = w.Downloaded(s.fetchAsserts(c))
-	c.Assert(err, IsNil)
-	c.Check(complete, Equals, false)
+	c.Check(w.SetRedirectChannel(sn, "default-track/stable"), ErrorMatches, `internal error: before using seedwriter.Writer.SetRedirectChannel snap "required18" Info should have been set`)
 
-	snaps, err = w.SnapsToDownload()
-	c.Assert(err, IsNil)
-	c.Assert(snaps, HasLen, 0)
+	s.fillDownloadedSnap(c, w, sn)
 
-	complete, err = w.Downloaded(s.fetchAsserts(c))
-	c.Assert(err, IsNil)
-	c.Check(complete, Equals, true)
+	c.Check(w.SetRedirectChannel(sn, "default-track//stable"), ErrorMatches, `invalid redirect channel for snap "required18":.*`)
+}
 
-	c.Check(s.fetchAssertsCalled, Equals, true)
+func (s *writerSuite) TestInfoDerivedInfosNotSet(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"cont-consumer", "cont-producer"},
+	})
 
-	_, err = w.BootSnaps()
-	c.Check(err, ErrorMatches, "no snaps participating in boot on classic")
+	core18Fn := s.makeLocalSnap(c, "core18")
+	pcKernelFn := s.makeLocalSnap(c, "pc-kernel=18")
+	pcFn := s.makeLocalSnap(c, "pc=18")
 
-	err = w.SeedSnaps(nil)
+	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
-	err = w.WriteMeta()
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{
+		{Path: core18Fn},
+		{Path: pcFn, Channel: "edge"},
+		{Path: pcKernelFn},
+	})
 	c.Assert(err, IsNil)
 
-	// check seed
-	seedYaml, err := seedwriter.InternalReadSeedYaml(filepath.Join(s.opts.SeedDir, "seed.yaml"))
+	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
 
-	c.Check(seedYaml.Snaps, HasLen, 3)
-
-	// check the files are in place
-	for i, name := range []string{"snapd", "core", "required"} {
-		info := s.AssertedSnapInfo(name)
-
-		fn := info.Filename()
-		p := filepath.Join(s.opts.SeedDir, "snaps", fn)
-		c.Check(p, testutil.FilePresent)
+	_, err = w.LocalSnaps()
+	c.Assert(err, IsNil)
 
-		c.Check(seedYaml.Snaps[i], DeepEquals, &seedwriter.InternalSnap16{
-			Name:    info.SnapName(),
-			SnapID:  info.SnapID,
-			Channel: "stable",
-			File:    fn,
-			Contact: info.Contact(),
-		})
-	}
+	err = w.InfoDerived()
+	c.Assert(err, ErrorMatches, `internal error: before seedwriter.Writer.InfoDerived snap ".*/core18.*.snap" Info should have been set`)
 }
 
-func (s *writerSuite) TestSeedSnapsWriteMetaClassicMinModelSnapdFromModelWins(c *C) {
-	model := s.Brands.Model("my-brand", "my-min-model", map[string]any{
-		"classic":        "true",
-		"required-snaps": []any{"core", "required", "snapd"},
+func (s *writerSuite) TestInfoDerivedRepeatedLocalSnap(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"cont-consumer", "cont-producer"},
 	})
 
-	s.makeSnap(c, "snapd", "")
-	s.makeSnap(c, "required", "developerid")
-	s.makeSnap(c, "core", "")
-
-	s.expectedSysSnap = "snapd"
-	// no kernel
-	s.expectedKernSnap = ""
+	core18Fn := s.makeLocalSnap(c, "core18")
+	pcKernelFn := s.makeLocalSnap(c, "pc-kernel=18")
+	pcFn := s.makeLocalSnap(c, "pc=18")
 
-	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
-	c.Check(complete, Equals, false)
 
-	snaps, err := w.SnapsToDownload()
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{
+		{Path: core18Fn},
+		{Path: pcFn, Channel: "edge"},
+		{Path: pcKernelFn},
+		{Path: core18Fn},
+	})
 	c.Assert(err, IsNil)
-	c.Assert(snaps, HasLen, 0)
 
-	complete, err = w.Downloaded(s.fetchAsserts(c))
+	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
-	c.Check(complete, Equals, true)
 
-	c.Check(s.fetchAssertsCalled, Equals, true)
-
-	_, err = w.BootSnaps()
-	c.Check(err, ErrorMatches, "no snaps participating in boot on classic")
-
-	err = w.SeedSnaps(nil)
+	localSnaps, err := w.LocalSnaps()
 	c.Assert(err, IsNil)
+	c.Check(localSnaps, HasLen, 4)
 
-	err = w.WriteMeta()
-	c.Assert(err, IsNil)
-
-	// check seed
-	seedYaml, err := seedwriter.InternalReadSeedYaml(filepath.Join(s.opts.SeedDir, "seed.yaml"))
-	c.Assert(err, IsNil)
-
-	c.Check(seedYaml.Snaps, HasLen, 3)
-
-	// check the files are in place
-	for i, name := range []string{"snapd", "core", "required"} {
-		info := s.AssertedSnapInfo(name)
-
-		fn := info.Filename()
-		p := filepath.Join(s.opts.SeedDir, "snaps", fn)
-		c.Check(p, testutil.FilePresent)
-
-		c.Check(seedYaml.Snaps[i], DeepEquals, &seedwriter.InternalSnap16{
-			Name:    info.SnapName(),
-			SnapID:  info.SnapID,
-			Channel: "stable",
-			File:    fn,
-			Contact: info.Contact(),
-		})
+	for _, sn := range localSnaps {
+		f, err := snapfile.Open(sn.Path)
+		c.Assert(err, IsNil)
+		info, err := snap.ReadInfoFromSnapFile(f, nil)
+		c.Assert(err, IsNil)
+		w.SetInfo(sn, info, nil)
 	}
+
+	err = w.InfoDerived()
+	c.Assert(err, ErrorMatches, `local snap "core18" is repeated in options`)
 }
 
-func (s *writerSuite) TestSeedSnapsWriteMetaExtraSnaps(c *C) {
+func (s *writerSuite) TestInfoDerivedRepeatedLocalSnapID(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
-		"display-name":   "my model",
-		"architecture":   "amd64",
-		"base":           "core18",
-		"gadget":         "pc=18",
-		"kernel":         "pc-kernel=18",
-		"required-snaps": []any{"cont-consumer", "cont-producer"},
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core18",
+		"gadget":       "pc=18",
+		"kernel":       "pc-kernel=18",
 	})
 
-	s.makeSnap(c, "snapd", "")
-	s.makeSnap(c, "core18", "")
-	s.makeSnap(c, "pc-kernel=18", "")
-	s.makeSnap(c, "pc=18", "")
-	s.makeSnap(c, "cont-producer", "developerid")
-	s.makeSnap(c, "cont-consumer", "developerid")
-	s.makeSnap(c, "core", "")
-	s.makeSnap(c, "required", "developerid")
+	producerFn := s.makeLocalSnap(c, "cont-producer")
+	consumerFn := s.makeLocalSnap(c, "cont-consumer")
 
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
-	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "required", Channel: "beta"}})
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{
+		{Path: producerFn},
+		{Path: consumerFn},
+	})
 	c.Assert(err, IsNil)
 
 	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
 
-	snaps, err := w.SnapsToDownload()
+	localSnaps, err := w.LocalSnaps()
 	c.Assert(err, IsNil)
-	c.Assert(snaps, HasLen, 6)
+	c.Check(localSnaps, HasLen, 2)
 
-	s.AssertedSnapInfo("cont-producer").EditedLinks = map[string][]string{
-		"contact": {"mailto:author@cont-producer.net"},
-	}
-	for _, sn := range snaps {
-		s.fillDownloadedSnap(c, w, sn)
+	for _, sn := range localSnaps {
+		f, err := snapfile.Open(sn.Path)
+		c.Assert(err, IsNil)
+		info, err := snap.ReadInfoFromSnapFile(f, nil)
+		c.Assert(err, IsNil)
+		// both resolve to the same snap-id
+		info.SnapID = "snapidsnapidsnapidsnapidsnapidsn"
+		w.SetInfo(sn, info, nil)
 	}
 
-	complete, err := w.Downloaded(s.fetchAsserts(c))
-	c.Assert(err, IsNil)
-	c.Assert(complete, Equals, false)
+	err = w.InfoDerived()
+	c.Assert(err, ErrorMatches, `cannot add both local snap "cont-producer" and local snap "cont-consumer" as they have the same snap-id "snapidsnapidsnapidsnapidsnapidsn"`)
+}
 
-	snaps, err = w.SnapsToDownload()
-	c.Assert(err, IsNil)
-	c.Assert(snaps, HasLen, 1)
-	c.Check(naming.SameSnap(snaps[0], naming.Snap("required")), Equals, true)
+func (s *writerSuite) TestDownloadedRepeatedSnapID(c *C) {
+	model := s.appendModel()
 
-	s.fillDownloadedSnap(c, w, snaps[0])
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
 
-	complete, err = w.Downloaded(s.fetchAsserts(c))
+	s.opts.Label = "20191122"
+	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
-	c.Assert(complete, Equals, false)
 
-	snaps, err = w.SnapsToDownload()
+	// old-pc is a former name of pc, the store resolves it to the
+	// same snap
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "old-pc"}})
 	c.Assert(err, IsNil)
-	c.Assert(snaps, HasLen, 1)
-	c.Check(naming.SameSnap(snaps[0], naming.Snap("core")), Equals, true)
-
-	s.fillDownloadedSnap(c, w, snaps[0])
 
-	complete, err = w.Downloaded(s.fetchAsserts(c))
+	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
-	c.Assert(complete, Equals, true)
 
-	err = w.SeedSnaps(nil)
+	snaps, err := w.SnapsToDownload()
 	c.Assert(err, IsNil)
-
-	err = w.WriteMeta()
+	c.Assert(snaps, HasLen, 4)
+	for _, sn := range snaps {
+		s.fillDownloadedSnap(c, w, sn)
+	}
+	complete, err := w.Downloaded(s.fetchAsserts(c))
 	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, false)
 
-	// check seed
-	seedYaml, err := seedwriter.InternalReadSeedYaml(filepath.Join(s.opts.SeedDir, "seed.yaml"))
+	snaps, err = w.SnapsToDownload()
 	c.Assert(err, IsNil)
-	c.Assert(seedYaml.Snaps, HasLen, 8)
-
-	// check the files are in place
-	for i, name := range []string{"snapd", "core", "pc-kernel", "core18", "pc", "cont-consumer", "cont-producer", "required"} {
-		info := s.AssertedSnapInfo(name)
-
-		fn := info.Filename()
-		p := filepath.Join(s.opts.SeedDir, "snaps", fn)
-		c.Check(osutil.FileExists(p), Equals, true)
-
-		channel := "stable"
-		switch name {
-		case "pc-kernel", "pc":
-			channel = "18"
-		case "required":
-			channel = "beta"
-		}
-
-		c.Check(seedYaml.Snaps[i], DeepEquals, &seedwriter.InternalSnap16{
-			Name:    info.SnapName(),
-			SnapID:  info.SnapID,
-			Channel: channel,
-			File:    fn,
-			Contact: info.Contact(),
-		})
-	}
-
-	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
+	c.Assert(snaps, HasLen, 1)
+	c.Check(snaps[0].SnapName(), Equals, "old-pc")
+	err = w.SetInfo(snaps[0], s.AssertedSnapInfo("pc"), nil)
 	c.Assert(err, IsNil)
-	c.Check(l, HasLen, 8)
-
-	// check the snap assertions are also in place
-	seedAssertsDir := filepath.Join(s.opts.SeedDir, "assertions")
-	for _, snapName := range []string{"snapd", "core", "pc-kernel", "core18", "pc", "cont-consumer", "cont-producer", "required"} {
-		p := filepath.Join(seedAssertsDir, fmt.Sprintf("16,%s.snap-declaration", s.AssertedSnapID(snapName)))
-		decl := seedtest.ReadAssertions(c, p)
-		c.Assert(decl, HasLen, 1)
-		c.Check(decl[0].Type(), Equals, asserts.SnapDeclarationType)
-		c.Check(decl[0].HeaderString("snap-name"), Equals, snapName)
-		p = filepath.Join(seedAssertsDir, fmt.Sprintf("%s.snap-revision", s.AssertedSnapRevision(snapName).SnapSHA3_384()))
-		rev := seedtest.ReadAssertions(c, p)
-		c.Assert(rev, HasLen, 1)
-		c.Check(rev[0].Type(), Equals, asserts.SnapRevisionType)
-		c.Check(rev[0].HeaderString("snap-id"), Equals, s.AssertedSnapID(snapName))
-	}
 
-	c.Check(w.Warnings(), DeepEquals, []string{
-		`model has base "core18" but some snaps ("required") require "core" as base as well, for compatibility it was added implicitly, adding "core" explicitly is recommended`,
-	})
+	_, err = w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, ErrorMatches, `cannot add both snap "pc" and snap "old-pc" as they have the same snap-id "`+s.AssertedSnapID("pc")+`"`)
 }
 
-func (s *writerSuite) TestSeedSnapsWriteMetaLocalExtraSnaps(c *C) {
+func (s *writerSuite) TestInfoDerivedInconsistentChannel(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name":   "my model",
 		"architecture":   "amd64",
@@ -2162,19 +2672,19 @@ func (s *writerSuite) TestSeedSnapsWriteMetaLocalExtraSnaps(c *C) {
 		"required-snaps": []any{"cont-consumer", "cont-producer"},
 	})
 
-	s.makeSnap(c, "snapd", "")
-	s.makeSnap(c, "core18", "")
-	s.makeSnap(c, "pc-kernel=18", "")
-	s.makeSnap(c, "pc=18", "")
-	s.makeSnap(c, "cont-producer", "developerid")
-	s.makeSnap(c, "cont-consumer", "developerid")
-	s.makeSnap(c, "core", "")
-	requiredFn := s.makeLocalSnap(c, "required")
+	core18Fn := s.makeLocalSnap(c, "core18")
+	pcKernelFn := s.makeLocalSnap(c, "pc-kernel=18")
+	pcFn := s.makeLocalSnap(c, "pc=18")
 
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
-	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Path: requiredFn}})
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{
+		{Path: core18Fn},
+		{Path: pcFn, Channel: "edge"},
+		{Path: pcKernelFn},
+		{Name: "pc", Channel: "beta"},
+	})
 	c.Assert(err, IsNil)
 
 	err = w.Start(s.db, s.rf)
@@ -2182,63 +2692,94 @@ func (s *writerSuite) TestSeedSnapsWriteMetaLocalExtraSnaps(c *C) {
 
 	localSnaps, err := w.LocalSnaps()
 	c.Assert(err, IsNil)
-	c.Assert(localSnaps, HasLen, 1)
+	c.Check(localSnaps, HasLen, 3)
 
 	for _, sn := range localSnaps {
-		si, aRefs, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
-		if !errors.Is(err, &asserts.NotFoundError{}) {
-			c.Assert(err, IsNil)
-		}
 		f, err := snapfile.Open(sn.Path)
 		c.Assert(err, IsNil)
-		info, err := snap.ReadInfoFromSnapFile(f, si)
+		info, err := snap.ReadInfoFromSnapFile(f, nil)
 		c.Assert(err, IsNil)
 		w.SetInfo(sn, info, nil)
-		s.aRefs[sn.SnapName()] = aRefs
 	}
 
 	err = w.InfoDerived()
+	c.Assert(err, ErrorMatches, `option snap has different channels specified: ".*/pc.*.snap"="edge" vs "pc"="beta"`)
+}
+
+func (s *writerSuite) TestSetRedirectChannelLocalError(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core18",
+		"gadget":       "pc=18",
+		"kernel":       "pc-kernel=18",
+	})
+
+	core18Fn := s.makeLocalSnap(c, "core18")
+
+	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
-	snaps, err := w.SnapsToDownload()
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{
+		{Path: core18Fn},
+	})
 	c.Assert(err, IsNil)
-	c.Assert(snaps, HasLen, 6)
 
-	s.AssertedSnapInfo("cont-producer").EditedLinks = map[string][]string{
-		"contact": {"mailto:author@cont-producer.net"},
-	}
-	for _, sn := range snaps {
-		s.fillDownloadedSnap(c, w, sn)
-	}
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
 
-	complete, err := w.Downloaded(s.fetchAsserts(c))
+	localSnaps, err := w.LocalSnaps()
 	c.Assert(err, IsNil)
-	c.Assert(complete, Equals, false)
+	c.Check(localSnaps, HasLen, 1)
 
-	snaps, err = w.SnapsToDownload()
+	sn := localSnaps[0]
+	f, err := snapfile.Open(sn.Path)
+	c.Assert(err, IsNil)
+	info, err := snap.ReadInfoFromSnapFile(f, nil)
+	c.Assert(err, IsNil)
+	err = w.SetInfo(sn, info, nil)
 	c.Assert(err, IsNil)
-	c.Assert(snaps, HasLen, 0)
 
-	complete, err = w.Downloaded(s.fetchAsserts(c))
+	c.Check(w.SetRedirectChannel(sn, "foo"), ErrorMatches, `internal error: cannot set redirect channel for local snap .*`)
+
+}
+
+func (s *writerSuite) TestSeedSnapsWriteMetaClassicWithCore(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"classic":        "true",
+		"architecture":   "amd64",
+		"gadget":         "classic-gadget",
+		"required-snaps": []any{"required"},
+	})
+
+	s.makeSnap(c, "core", "")
+	s.makeSnap(c, "classic-gadget", "")
+	s.makeSnap(c, "required", "developerid")
+
+	s.expectedSysSnap = "core"
+	// no kernel
+	s.expectedKernSnap = ""
+
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
 	c.Assert(err, IsNil)
-	c.Assert(complete, Equals, false)
+	c.Check(complete, Equals, false)
 
-	snaps, err = w.SnapsToDownload()
+	snaps, err := w.SnapsToDownload()
 	c.Assert(err, IsNil)
 	c.Assert(snaps, HasLen, 1)
-	c.Check(naming.SameSnap(snaps[0], naming.Snap("core")), Equals, true)
 
 	s.fillDownloadedSnap(c, w, snaps[0])
 
+	s.expectedSysSnap = "core"
+
 	complete, err = w.Downloaded(s.fetchAsserts(c))
 	c.Assert(err, IsNil)
-	c.Assert(complete, Equals, true)
+	c.Check(complete, Equals, true)
 
-	copySnap := func(name, src, dst string) error {
-		return osutil.CopyFile(src, dst, 0)
-	}
+	_, err = w.BootSnaps()
+	c.Check(err, ErrorMatches, "no snaps participating in boot on classic")
 
-	err = w.SeedSnaps(copySnap)
+	err = w.SeedSnaps(nil)
 	c.Assert(err, IsNil)
 
 	err = w.WriteMeta()
@@ -2247,139 +2788,54 @@ func (s *writerSuite) TestSeedSnapsWriteMetaLocalExtraSnaps(c *C) {
 	// check seed
 	seedYaml, err := seedwriter.InternalReadSeedYaml(filepath.Join(s.opts.SeedDir, "seed.yaml"))
 	c.Assert(err, IsNil)
-	c.Assert(seedYaml.Snaps, HasLen, 8)
+
+	c.Check(seedYaml.Snaps, HasLen, 3)
 
 	// check the files are in place
-	for i, name := range []string{"snapd", "core", "pc-kernel", "core18", "pc", "cont-consumer", "cont-producer", "required"} {
+	for i, name := range []string{"core", "classic-gadget", "required"} {
 		info := s.AssertedSnapInfo(name)
-		unasserted := false
-		if info == nil {
-			info = &snap.Info{
-				SuggestedName: name,
-			}
-			info.Revision = snap.R(-1)
-			unasserted = true
-		}
 
 		fn := info.Filename()
 		p := filepath.Join(s.opts.SeedDir, "snaps", fn)
-		c.Check(osutil.FileExists(p), Equals, true)
-
-		channel := ""
-		if !unasserted {
-			switch name {
-			case "pc-kernel", "pc":
-				channel = "18"
-			default:
-				channel = "stable"
-			}
-		}
+		c.Check(p, testutil.FilePresent)
 
 		c.Check(seedYaml.Snaps[i], DeepEquals, &seedwriter.InternalSnap16{
-			Name:       info.SnapName(),
-			SnapID:     info.SnapID,
-			Channel:    channel,
-			File:       fn,
-			Contact:    info.Contact(),
-			Unasserted: unasserted,
+			Name:    info.SnapName(),
+			SnapID:  info.SnapID,
+			Channel: "stable",
+			File:    fn,
+			Contact: info.Contact(),
 		})
 	}
-
-	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
-	c.Assert(err, IsNil)
-	c.Check(l, HasLen, 8)
-
-	unassertedSnaps, err := w.UnassertedSnaps()
-	c.Assert(err, IsNil)
-	c.Check(unassertedSnaps, HasLen, 1)
-	c.Check(naming.SameSnap(unassertedSnaps[0], naming.Snap("required")), Equals, true)
 }
 
-func (s *writerSuite) TestSeedSnapsWriteMetaCore20(c *C) {
-	// add store assertion
-	storeAs, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
-		"store":       "my-store",
-		"operator-id": "canonical",
-		"timestamp":   time.Now().UTC().Format(time.RFC3339),
-	}, nil, "")
-	c.Assert(err, IsNil)
-	err = s.StoreSigning.Add(storeAs)
-	c.Assert(err, IsNil)
-
+func (s *writerSuite) TestSeedSnapsWriteMetaClassicSnapdOnly(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
-		"display-name": "my model",
-		"architecture": "amd64",
-		"store":        "my-store",
-		"base":         "core20",
-		"snaps": []any{
-			map[string]any{
-				"name":            "pc-kernel",
-				"id":              s.AssertedSnapID("pc-kernel"),
-				"type":            "kernel",
-				"default-channel": "20",
-			},
-			map[string]any{
-				"name":            "pc",
-				"id":              s.AssertedSnapID("pc"),
-				"type":            "gadget",
-				"default-channel": "20",
-			},
-			map[string]any{
-				"name": "core18",
-				"id":   s.AssertedSnapID("core18"),
-				"type": "base",
-			},
-			map[string]any{
-				"name": "cont-consumer",
-				"id":   s.AssertedSnapID("cont-consumer"),
-			},
-			map[string]any{
-				"name": "cont-producer",
-				"id":   s.AssertedSnapID("cont-producer"),
-			},
-		},
+		"classic":        "true",
+		"architecture":   "amd64",
+		"gadget":         "classic-gadget18",
+		"required-snaps": []any{"core18", "required18"},
 	})
 
-	// validity
-	c.Assert(model.Grade(), Equals, asserts.ModelSigned)
-
 	s.makeSnap(c, "snapd", "")
-	s.makeSnap(c, "core20", "")
 	s.makeSnap(c, "core18", "")
-	s.makeSnap(c, "pc-kernel=20", "")
-	s.makeSnap(c, "pc=20", "")
-	s.makeSnap(c, "cont-producer", "developerid")
-	s.makeSnap(c, "cont-consumer", "developerid")
+	s.makeSnap(c, "classic-gadget18", "")
+	s.makeSnap(c, "required18", "developerid")
 
-	s.opts.Label = "20191003"
-	w, err := seedwriter.New(model, s.opts)
-	c.Assert(err, IsNil)
+	// no kernel
+	s.expectedKernSnap = ""
 
-	err = w.Start(s.db, s.rf)
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
 	c.Assert(err, IsNil)
+	c.Check(complete, Equals, false)
 
 	snaps, err := w.SnapsToDownload()
 	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 7)
+	c.Assert(snaps, HasLen, 1)
 
-	s.AssertedSnapInfo("cont-producer").EditedLinks = map[string][]string{
-		"contact": {"mailto:author@cont-producer.net"},
-	}
-	s.AssertedSnapInfo("cont-consumer").Private = true
-	for _, sn := range snaps {
-		// check the used channel at this level because in the
-		// non-dangerous case is not written anywhere (it
-		// reflects the model or default)
-		channel := "latest/stable"
-		switch sn.SnapName() {
-		case "pc", "pc-kernel":
-			channel = "20"
-		}
-		c.Check(sn.Channel, Equals, channel)
-		s.fillDownloadedSnap(c, w, sn)
-	}
+	s.fillDownloadedSnap(c, w, snaps[0])
 
-	complete, err := w.Downloaded(s.fetchAsserts(c))
+	complete, err = w.Downloaded(s.fetchAsserts(c))
 	c.Assert(err, IsNil)
 	c.Check(complete, Equals, true)
 
@@ -2390,123 +2846,3153 @@ func (s *writerSuite) TestSeedSnapsWriteMetaCore20(c *C) {
 	c.Assert(err, IsNil)
 
 	// check seed
-	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
-	c.Check(systemDir, testutil.FilePresent)
+	seedYaml, err := seedwriter.InternalReadSeedYaml(filepath.Join(s.opts.SeedDir, "seed.yaml"))
+	c.Assert(err, IsNil)
+	c.Assert(seedYaml.Snaps, HasLen, 4)
 
-	// check the snaps are in place
-	for _, name := range []string{"snapd", "pc-kernel", "core20", "pc", "core18", "cont-consumer", "cont-producer"} {
+	// check the files are in place
+	for i, name := range []string{"snapd", "core18", "classic-gadget18", "required18"} {
 		info := s.AssertedSnapInfo(name)
 
 		fn := info.Filename()
 		p := filepath.Join(s.opts.SeedDir, "snaps", fn)
 		c.Check(p, testutil.FilePresent)
+
+		c.Check(seedYaml.Snaps[i], DeepEquals, &seedwriter.InternalSnap16{
+			Name:    info.SnapName(),
+			SnapID:  info.SnapID,
+			Channel: "stable",
+			File:    fn,
+			Contact: info.Contact(),
+		})
 	}
+}
 
-	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
+func (s *writerSuite) TestSeedSnapsWriteMetaClassicMinModelNoSysSnap(c *C) {
+	// this is a degenerate case but has been historically supported,
+	// see image_test.go TestPrepareClassicModelNoModelAssertion
+	model := s.Brands.Model("my-brand", "my-min-model", map[string]any{
+		"classic": "true",
+	})
+
+	s.makeSnap(c, "required18", "developerid")
+	s.makeSnap(c, "core18", "")
+
+	// no sys snap
+	s.expectedSysSnap = ""
+	// no kernel
+	s.expectedKernSnap = ""
+
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c), &seedwriter.OptionsSnap{Name: "required18"}, &seedwriter.OptionsSnap{Name: "core18"})
 	c.Assert(err, IsNil)
-	c.Check(l, HasLen, 7)
+	c.Check(complete, Equals, false)
 
-	// check assertions
-	c.Check(filepath.Join(systemDir, "model"), testutil.FileEquals, asserts.Encode(model))
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 2)
 
-	assertsDir := filepath.Join(systemDir, "assertions")
-	modelEtc := seedtest.ReadAssertions(c, filepath.Join(assertsDir, "model-etc"))
-	c.Check(modelEtc, HasLen, 4)
+	s.fillDownloadedSnap(c, w, snaps[0])
+	s.fillDownloadedSnap(c, w, snaps[1])
 
-	keyPKs := make(map[string]bool)
-	for _, a := range modelEtc {
-		switch a.Type() {
-		case asserts.AccountType:
-			c.Check(a.HeaderString("account-id"), Equals, "my-brand")
-		case asserts.StoreType:
-			c.Check(a.HeaderString("store"), Equals, "my-store")
-		case asserts.AccountKeyType:
-			keyPKs[a.HeaderString("public-key-sha3-384")] = true
-		default:
-			c.Fatalf("unexpected assertion %s", a.Type().Name)
-		}
-	}
-	c.Check(keyPKs, DeepEquals, map[string]bool{
-		s.StoreSigning.StoreAccountKey("").PublicKeyID(): true,
-		s.Brands.AccountKey("my-brand").PublicKeyID():    true,
-	})
+	complete, err = w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, false)
 
-	// check snap assertions
-	snapAsserts := seedtest.ReadAssertions(c, filepath.Join(assertsDir, "snaps"))
-	seen := make(map[string]bool)
+	snaps, err = w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 0)
 
-	for _, a := range snapAsserts {
-		uniq := a.Ref().Unique()
-		if a.Type() == asserts.SnapRevisionType {
-			rev := a.(*asserts.SnapRevision)
-			uniq = fmt.Sprintf("%s@%d", rev.SnapID(), rev.SnapRevision())
-		}
-		seen[uniq] = true
-	}
+	complete, err = w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
 
-	snapRevUniq := func(snapName string, revno int) string {
-		return fmt.Sprintf("%s@%d", s.AssertedSnapID(snapName), revno)
-	}
-	snapDeclUniq := func(snapName string) string {
-		return "snap-declaration/16/" + s.AssertedSnapID(snapName)
-	}
+	c.Check(s.fetchAssertsCalled, Equals, true)
 
-	c.Check(seen, DeepEquals, map[string]bool{
-		"account/developerid":           true,
-		snapDeclUniq("snapd"):           true,
-		snapDeclUniq("pc-kernel"):       true,
-		snapDeclUniq("pc"):              true,
-		snapDeclUniq("core20"):          true,
-		snapDeclUniq("core18"):          true,
-		snapDeclUniq("cont-consumer"):   true,
-		snapDeclUniq("cont-producer"):   true,
-		snapRevUniq("snapd", 1):         true,
-		snapRevUniq("pc-kernel", 1):     true,
-		snapRevUniq("pc", 1):            true,
-		snapRevUniq("core20", 1):        true,
-		snapRevUniq("core18", 1):        true,
-		snapRevUniq("cont-consumer", 1): true,
-		snapRevUniq("cont-producer", 1): true,
-	})
+	_, err = w.BootSnaps()
+	c.Check(err, ErrorMatches, "no snaps participating in boot on classic")
 
-	c.Check(filepath.Join(systemDir, "extra-snaps"), testutil.FileAbsent)
+	err = w.SeedSnaps(nil)
+	c.Assert(err, IsNil)
 
-	// check auxiliary store info
-	l, err = os.ReadDir(filepath.Join(systemDir, "snaps"))
+	err = w.WriteMeta()
 	c.Assert(err, IsNil)
-	c.Check(l, HasLen, 1)
+
+	// check seed
+	seedYaml, err := seedwriter.InternalReadSeedYaml(filepath.Join(s.opts.SeedDir, "seed.yaml"))
+	c.Assert(err, IsNil)
+
+	c.Check(seedYaml.Snaps, HasLen, 2)
+
+	// check the files are in place
+	for i, name := range []string{"core18", "required18"} {
+		info := s.AssertedSnapInfo(name)
+
+		fn := info.Filename()
+		p := filepath.Join(s.opts.SeedDir, "snaps", fn)
+		c.Check(p, testutil.FilePresent)
+
+		c.Check(seedYaml.Snaps[i], DeepEquals, &seedwriter.InternalSnap16{
+			Name:    info.SnapName(),
+			SnapID:  info.SnapID,
+			Channel: "stable",
+			File:    fn,
+			Contact: info.Contact(),
+		})
+	}
+}
+
+func (s *writerSuite) TestSeedSnapsWriteMetaClassicMinModelCore(c *C) {
+	model := s.Brands.Model("my-brand", "my-min-model", map[string]any{
+		"classic": "true",
+	})
+
+	s.makeSnap(c, "required", "developerid")
+	s.makeSnap(c, "core", "")
+
+	s.expectedSysSnap = "core"
+	// no kernel
+	s.expectedKernSnap = ""
+
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c), &seedwriter.OptionsSnap{Name: "core"}, &seedwriter.OptionsSnap{Name: "required"})
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, false)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 2)
+
+	s.fillDownloadedSnap(c, w, snaps[0])
+	s.fillDownloadedSnap(c, w, snaps[1])
+
+	complete, err = w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, false)
+
+	snaps, err = w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 0)
+
+	complete, err = w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	c.Check(s.fetchAssertsCalled, Equals, true)
+
+	_, err = w.BootSnaps()
+	c.Check(err, ErrorMatches, "no snaps participating in boot on classic")
+
+	err = w.SeedSnaps(nil)
+	c.Assert(err, IsNil)
+
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
+
+	// check seed
+	seedYaml, err := seedwriter.InternalReadSeedYaml(filepath.Join(s.opts.SeedDir, "seed.yaml"))
+	c.Assert(err, IsNil)
+
+	c.Check(seedYaml.Snaps, HasLen, 2)
+
+	// check the files are in place
+	for i, name := range []string{"core", "required"} {
+		info := s.AssertedSnapInfo(name)
+
+		fn := info.Filename()
+		p := filepath.Join(s.opts.SeedDir, "snaps", fn)
+		c.Check(p, testutil.FilePresent)
+
+		c.Check(seedYaml.Snaps[i], DeepEquals, &seedwriter.InternalSnap16{
+			Name:    info.SnapName(),
+			SnapID:  info.SnapID,
+			Channel: "stable",
+			File:    fn,
+			Contact: info.Contact(),
+		})
+	}
+}
+
+func (s *writerSuite) TestSeedSnapsWriteMetaClassicMinModelSnapdFromOptionsWins(c *C) {
+	model := s.Brands.Model("my-brand", "my-min-model", map[string]any{
+		"classic": "true",
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "required", "developerid")
+	s.makeSnap(c, "core", "")
+
+	s.expectedSysSnap = "snapd"
+	// no kernel
+	s.expectedKernSnap = ""
+
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c), &seedwriter.OptionsSnap{Name: "core"}, &seedwriter.OptionsSnap{Name: "required"}, &seedwriter.OptionsSnap{Name: "snapd"})
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, false)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 3)
+
+	s.fillDownloadedSnap(c, w, snaps[0])
+	s.fillDownloadedSnap(c, w, snaps[1])
+	s.fillDownloadedSnap(c, w, snaps[2])
+
+	complete, err = w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, false)
+
+	snaps, err = w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 0)
+
+	complete, err = w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	c.Check(s.fetchAssertsCalled, Equals, true)
+
+	_, err = w.BootSnaps()
+	c.Check(err, ErrorMatches, "no snaps participating in boot on classic")
+
+	err = w.SeedSnaps(nil)
+	c.Assert(err, IsNil)
+
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
+
+	// check seed
+	seedYaml, err := seedwriter.InternalReadSeedYaml(filepath.Join(s.opts.SeedDir, "seed.yaml"))
+	c.Assert(err, IsNil)
+
+	c.Check(seedYaml.Snaps, HasLen, 3)
+
+	// check the files are in place
+	for i, name := range []string{"snapd", "core", "required"} {
+		info := s.AssertedSnapInfo(name)
+
+		fn := info.Filename()
+		p := filepath.Join(s.opts.SeedDir, "snaps", fn)
+		c.Check(p, testutil.FilePresent)
+
+		c.Check(seedYaml.Snaps[i], DeepEquals, &seedwriter.InternalSnap16{
+			Name:    info.SnapName(),
+			SnapID:  info.SnapID,
+			Channel: "stable",
+			File:    fn,
+			Contact: info.Contact(),
+		})
+	}
+}
+
+func (s *writerSuite) TestSeedSnapsWriteMetaClassicMinModelSnapdFromModelWins(c *C) {
+	model := s.Brands.Model("my-brand", "my-min-model", map[string]any{
+		"classic":        "true",
+		"required-snaps": []any{"core", "required", "snapd"},
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "required", "developerid")
+	s.makeSnap(c, "core", "")
+
+	s.expectedSysSnap = "snapd"
+	// no kernel
+	s.expectedKernSnap = ""
+
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, false)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 0)
+
+	complete, err = w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	c.Check(s.fetchAssertsCalled, Equals, true)
+
+	_, err = w.BootSnaps()
+	c.Check(err, ErrorMatches, "no snaps participating in boot on classic")
+
+	err = w.SeedSnaps(nil)
+	c.Assert(err, IsNil)
+
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
+
+	// check seed
+	seedYaml, err := seedwriter.InternalReadSeedYaml(filepath.Join(s.opts.SeedDir, "seed.yaml"))
+	c.Assert(err, IsNil)
+
+	c.Check(seedYaml.Snaps, HasLen, 3)
+
+	// check the files are in place
+	for i, name := range []string{"snapd", "core", "required"} {
+		info := s.AssertedSnapInfo(name)
+
+		fn := info.Filename()
+		p := filepath.Join(s.opts.SeedDir, "snaps", fn)
+		c.Check(p, testutil.FilePresent)
+
+		c.Check(seedYaml.Snaps[i], DeepEquals, &seedwriter.InternalSnap16{
+			Name:    info.SnapName(),
+			SnapID:  info.SnapID,
+			Channel: "stable",
+			File:    fn,
+			Contact: info.Contact(),
+		})
+	}
+}
+
+func (s *writerSuite) TestSeedSnapsWriteMetaExtraSnaps(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"cont-consumer", "cont-producer"},
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "cont-producer", "developerid")
+	s.makeSnap(c, "cont-consumer", "developerid")
+	s.makeSnap(c, "core", "")
+	s.makeSnap(c, "required", "developerid")
+
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "required", Channel: "beta"}})
+	c.Assert(err, IsNil)
+
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
+
+	_, err = w.ImplicitSnaps()
+	c.Check(err, ErrorMatches, "internal error: seedwriter.Writer cannot query seed snaps before Downloaded signaled complete")
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 6)
+
+	s.AssertedSnapInfo("cont-producer").EditedLinks = map[string][]string{
+		"contact": {"mailto:author@cont-producer.net"},
+	}
+	for _, sn := range snaps {
+		s.fillDownloadedSnap(c, w, sn)
+	}
+
+	complete, err := w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, false)
+
+	snaps, err = w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 1)
+	c.Check(naming.SameSnap(snaps[0], naming.Snap("required")), Equals, true)
+
+	s.fillDownloadedSnap(c, w, snaps[0])
+
+	complete, err = w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, false)
+
+	snaps, err = w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 1)
+	c.Check(naming.SameSnap(snaps[0], naming.Snap("core")), Equals, true)
+
+	s.fillDownloadedSnap(c, w, snaps[0])
+
+	complete, err = w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, true)
+
+	err = w.SeedSnaps(nil)
+	c.Assert(err, IsNil)
+
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
+
+	// check seed
+	seedYaml, err := seedwriter.InternalReadSeedYaml(filepath.Join(s.opts.SeedDir, "seed.yaml"))
+	c.Assert(err, IsNil)
+	c.Assert(seedYaml.Snaps, HasLen, 8)
+
+	// check the files are in place
+	for i, name := range []string{"snapd", "core", "pc-kernel", "core18", "pc", "cont-consumer", "cont-producer", "required"} {
+		info := s.AssertedSnapInfo(name)
+
+		fn := info.Filename()
+		p := filepath.Join(s.opts.SeedDir, "snaps", fn)
+		c.Check(osutil.FileExists(p), Equals, true)
+
+		channel := "stable"
+		switch name {
+		case "pc-kernel", "pc":
+			channel = "18"
+		case "required":
+			channel = "beta"
+		}
+
+		c.Check(seedYaml.Snaps[i], DeepEquals, &seedwriter.InternalSnap16{
+			Name:    info.SnapName(),
+			SnapID:  info.SnapID,
+			Channel: channel,
+			File:    fn,
+			Contact: info.Contact(),
+		})
+	}
+
+	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
+	c.Assert(err, IsNil)
+	c.Check(l, HasLen, 8)
+
+	// check the snap assertions are also in place
+	seedAssertsDir := filepath.Join(s.opts.SeedDir, "assertions")
+	for _, snapName := range []string{"snapd", "core", "pc-kernel", "core18", "pc", "cont-consumer", "cont-producer", "required"} {
+		p := filepath.Join(seedAssertsDir, fmt.Sprintf("16,%s.snap-declaration", s.AssertedSnapID(snapName)))
+		decl := seedtest.ReadAssertions(c, p)
+		c.Assert(decl, HasLen, 1)
+		c.Check(decl[0].Type(), Equals, asserts.SnapDeclarationType)
+		c.Check(decl[0].HeaderString("snap-name"), Equals, snapName)
+		p = filepath.Join(seedAssertsDir, fmt.Sprintf("%s.snap-revision", s.AssertedSnapRevision(snapName).SnapSHA3_384()))
+		rev := seedtest.ReadAssertions(c, p)
+		c.Assert(rev, HasLen, 1)
+		c.Check(rev[0].Type(), Equals, asserts.SnapRevisionType)
+		c.Check(rev[0].HeaderString("snap-id"), Equals, s.AssertedSnapID(snapName))
+	}
+
+	c.Check(w.Warnings(), DeepEquals, []string{
+		`model has base "core18" but some snaps ("required") require "core" as base as well, for compatibility it was added implicitly, adding "core" explicitly is recommended`,
+	})
+	c.Check(w.StructuredWarnings(), DeepEquals, []seedwriter.Warning{{
+		Kind:     seedwriter.WarningImplicitCore,
+		SnapName: "core",
+		Message:  `model has base "core18" but some snaps ("required") require "core" as base as well, for compatibility it was added implicitly, adding "core" explicitly is recommended`,
+	}})
+
+	implicit, err := w.ImplicitSnaps()
+	c.Assert(err, IsNil)
+	c.Check(implicit, DeepEquals, []seedwriter.ImplicitSnap{
+		{Snap: "snapd", Reason: seedwriter.ImplicitSystemSnap},
+		{Snap: "core", Reason: seedwriter.ImplicitBase, RequiredBy: []string{"required"}},
+	})
+}
+
+func (s *writerSuite) TestSeedSnapsWriteMetaLocalExtraSnaps(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"cont-consumer", "cont-producer"},
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "cont-producer", "developerid")
+	s.makeSnap(c, "cont-consumer", "developerid")
+	s.makeSnap(c, "core", "")
+	requiredFn := s.makeLocalSnap(c, "required")
+
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Path: requiredFn}})
+	c.Assert(err, IsNil)
+
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
+
+	localSnaps, err := w.LocalSnaps()
+	c.Assert(err, IsNil)
+	c.Assert(localSnaps, HasLen, 1)
+
+	for _, sn := range localSnaps {
+		si, aRefs, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
+		if !errors.Is(err, &asserts.NotFoundError{}) {
+			c.Assert(err, IsNil)
+		}
+		f, err := snapfile.Open(sn.Path)
+		c.Assert(err, IsNil)
+		info, err := snap.ReadInfoFromSnapFile(f, si)
+		c.Assert(err, IsNil)
+		w.SetInfo(sn, info, nil)
+		s.aRefs[sn.SnapName()] = aRefs
+	}
+
+	err = w.InfoDerived()
+	c.Assert(err, IsNil)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 6)
+
+	s.AssertedSnapInfo("cont-producer").EditedLinks = map[string][]string{
+		"contact": {"mailto:author@cont-producer.net"},
+	}
+	for _, sn := range snaps {
+		s.fillDownloadedSnap(c, w, sn)
+	}
+
+	complete, err := w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, false)
+
+	snaps, err = w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 0)
+
+	complete, err = w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, false)
+
+	snaps, err = w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 1)
+	c.Check(naming.SameSnap(snaps[0], naming.Snap("core")), Equals, true)
+
+	s.fillDownloadedSnap(c, w, snaps[0])
+
+	complete, err = w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, true)
+
+	copySnap := func(name, src, dst string) error {
+		return osutil.CopyFile(src, dst, 0)
+	}
+
+	err = w.SeedSnaps(copySnap)
+	c.Assert(err, IsNil)
+
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
+
+	// check seed
+	seedYaml, err := seedwriter.InternalReadSeedYaml(filepath.Join(s.opts.SeedDir, "seed.yaml"))
+	c.Assert(err, IsNil)
+	c.Assert(seedYaml.Snaps, HasLen, 8)
+
+	// check the files are in place
+	for i, name := range []string{"snapd", "core", "pc-kernel", "core18", "pc", "cont-consumer", "cont-producer", "required"} {
+		info := s.AssertedSnapInfo(name)
+		unasserted := false
+		if info == nil {
+			info = &snap.Info{
+				SuggestedName: name,
+			}
+			info.Revision = snap.R(-1)
+			unasserted = true
+		}
+
+		fn := info.Filename()
+		p := filepath.Join(s.opts.SeedDir, "snaps", fn)
+		c.Check(osutil.FileExists(p), Equals, true)
+
+		channel := ""
+		if !unasserted {
+			switch name {
+			case "pc-kernel", "pc":
+				channel = "18"
+			default:
+				channel = "stable"
+			}
+		}
+
+		c.Check(seedYaml.Snaps[i], DeepEquals, &seedwriter.InternalSnap16{
+			Name:       info.SnapName(),
+			SnapID:     info.SnapID,
+			Channel:    channel,
+			File:       fn,
+			Contact:    info.Contact(),
+			Unasserted: unasserted,
+		})
+	}
+
+	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
+	c.Assert(err, IsNil)
+	c.Check(l, HasLen, 8)
+
+	unassertedSnaps, err := w.UnassertedSnaps()
+	c.Assert(err, IsNil)
+	c.Check(unassertedSnaps, HasLen, 1)
+	c.Check(naming.SameSnap(unassertedSnaps[0], naming.Snap("required")), Equals, true)
+}
+
+func (s *writerSuite) TestSeedSnapsWriteMetaCore20(c *C) {
+	// add store assertion
+	storeAs, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
+		"store":       "my-store",
+		"operator-id": "canonical",
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	err = s.StoreSigning.Add(storeAs)
+	c.Assert(err, IsNil)
+
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"store":        "my-store",
+		"base":         "core20",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name": "core18",
+				"id":   s.AssertedSnapID("core18"),
+				"type": "base",
+			},
+			map[string]any{
+				"name": "cont-consumer",
+				"id":   s.AssertedSnapID("cont-consumer"),
+			},
+			map[string]any{
+				"name": "cont-producer",
+				"id":   s.AssertedSnapID("cont-producer"),
+			},
+		},
+	})
+
+	// validity
+	c.Assert(model.Grade(), Equals, asserts.ModelSigned)
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "cont-producer", "developerid")
+	s.makeSnap(c, "cont-consumer", "developerid")
+
+	s.opts.Label = "20191003"
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Check(snaps, HasLen, 7)
+
+	s.AssertedSnapInfo("cont-producer").EditedLinks = map[string][]string{
+		"contact": {"mailto:author@cont-producer.net"},
+	}
+	s.AssertedSnapInfo("cont-consumer").Private = true
+	for _, sn := range snaps {
+		// check the used channel at this level because in the
+		// non-dangerous case is not written anywhere (it
+		// reflects the model or default)
+		channel := "latest/stable"
+		switch sn.SnapName() {
+		case "pc", "pc-kernel":
+			channel = "20"
+		}
+		c.Check(sn.Channel, Equals, channel)
+		s.fillDownloadedSnap(c, w, sn)
+	}
+
+	complete, err := w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	err = w.SeedSnaps(nil)
+	c.Assert(err, IsNil)
+
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
+
+	// check seed
+	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
+	c.Check(systemDir, testutil.FilePresent)
+
+	// check the snaps are in place
+	for _, name := range []string{"snapd", "pc-kernel", "core20", "pc", "core18", "cont-consumer", "cont-producer"} {
+		info := s.AssertedSnapInfo(name)
+
+		fn := info.Filename()
+		p := filepath.Join(s.opts.SeedDir, "snaps", fn)
+		c.Check(p, testutil.FilePresent)
+	}
+
+	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
+	c.Assert(err, IsNil)
+	c.Check(l, HasLen, 7)
+
+	// check assertions
+	c.Check(filepath.Join(systemDir, "model"), testutil.FileEquals, asserts.Encode(model))
+
+	assertsDir := filepath.Join(systemDir, "assertions")
+	modelEtc := seedtest.ReadAssertions(c, filepath.Join(assertsDir, "model-etc"))
+	c.Check(modelEtc, HasLen, 4)
+
+	keyPKs := make(map[string]bool)
+	for _, a := range modelEtc {
+		switch a.Type() {
+		case asserts.AccountType:
+			c.Check(a.HeaderString("account-id"), Equals, "my-brand")
+		case asserts.StoreType:
+			c.Check(a.HeaderString("store"), Equals, "my-store")
+		case asserts.AccountKeyType:
+			keyPKs[a.HeaderString("public-key-sha3-384")] = true
+		default:
+			c.Fatalf("unexpected assertion %s", a.Type().Name)
+		}
+	}
+	c.Check(keyPKs, DeepEquals, map[string]bool{
+		s.StoreSigning.StoreAccountKey("").PublicKeyID(): true,
+		s.Brands.AccountKey("my-brand").PublicKeyID():    true,
+	})
+
+	// check snap assertions
+	snapAsserts := seedtest.ReadAssertions(c, filepath.Join(assertsDir, "snaps"))
+	seen := make(map[string]bool)
+
+	for _, a := range snapAsserts {
+		uniq := a.Ref().Unique()
+		if a.Type() == asserts.SnapRevisionType {
+			rev := a.(*asserts.SnapRevision)
+			uniq = fmt.Sprintf("%s@%d", rev.SnapID(), rev.SnapRevision())
+		}
+		seen[uniq] = true
+	}
+
+	snapRevUniq := func(snapName string, revno int) string {
+		return fmt.Sprintf("%s@%d", s.AssertedSnapID(snapName), revno)
+	}
+	snapDeclUniq := func(snapName string) string {
+		return "snap-declaration/16/" + s.AssertedSnapID(snapName)
+	}
+
+	c.Check(seen, DeepEquals, map[string]bool{
+		"account/developerid":           true,
+		snapDeclUniq("snapd"):           true,
+		snapDeclUniq("pc-kernel"):       true,
+		snapDeclUniq("pc"):              true,
+		snapDeclUniq("core20"):          true,
+		snapDeclUniq("core18"):          true,
+		snapDeclUniq("cont-consumer"):   true,
+		snapDeclUniq("cont-producer"):   true,
+		snapRevUniq("snapd", 1):         true,
+		snapRevUniq("pc-kernel", 1):     true,
+		snapRevUniq("pc", 1):            true,
+		snapRevUniq("core20", 1):        true,
+		snapRevUniq("core18", 1):        true,
+		snapRevUniq("cont-consumer", 1): true,
+		snapRevUniq("cont-producer", 1): true,
+	})
+
+	c.Check(filepath.Join(systemDir, "extra-snaps"), testutil.FileAbsent)
+
+	// check auxiliary store info
+	l, err = os.ReadDir(filepath.Join(systemDir, "snaps"))
+	c.Assert(err, IsNil)
+	c.Check(l, HasLen, 1)
 
 	b, err := os.ReadFile(filepath.Join(systemDir, "snaps", "aux-info.json"))
 	c.Assert(err, IsNil)
-	var auxInfos map[string]map[string]any
-	err = json.Unmarshal(b, &auxInfos)
+	var auxInfos map[string]map[string]any
+	err = json.Unmarshal(b, &auxInfos)
+	c.Assert(err, IsNil)
+	c.Check(auxInfos, DeepEquals, map[string]map[string]any{
+		s.AssertedSnapID("cont-consumer"): {
+			"private": true,
+		},
+		s.AssertedSnapID("cont-producer"): {
+			"links": map[string]any{
+				"contact": []any{"mailto:author@cont-producer.net"},
+			},
+			"contact": "mailto:author@cont-producer.net",
+		},
+	})
+
+	c.Check(filepath.Join(systemDir, "options.yaml"), testutil.FileAbsent)
+
+	// validity check of seedtest helper
+	const usesSnapd = true
+	seedtest.ValidateSeed(c, s.opts.SeedDir, s.opts.Label, usesSnapd,
+		s.StoreSigning.Trusted)
+}
+
+func (s *writerSuite) TestSeedSnapsWriteMetaCore20AuxInfoHook(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core20",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name": "core18",
+				"id":   s.AssertedSnapID("core18"),
+				"type": "base",
+			},
+			map[string]any{
+				"name": "cont-consumer",
+				"id":   s.AssertedSnapID("cont-consumer"),
+			},
+			map[string]any{
+				"name": "cont-producer",
+				"id":   s.AssertedSnapID("cont-producer"),
+			},
+		},
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "cont-producer", "developerid")
+	s.makeSnap(c, "cont-consumer", "developerid")
+
+	s.AssertedSnapInfo("cont-producer").EditedLinks = map[string][]string{
+		"contact": {"mailto:author@cont-producer.net"},
+		"website": {"https://cont-producer.net"},
+	}
+	s.AssertedSnapInfo("cont-consumer").Private = true
+
+	var called []string
+	s.opts.AuxInfoHook = func(snapID string, aux map[string]any) map[string]any {
+		called = append(called, snapID)
+		switch snapID {
+		case s.AssertedSnapID("cont-producer"):
+			// drop the contact, keep only the website
+			c.Check(aux["contact"], Equals, "mailto:author@cont-producer.net")
+			delete(aux, "contact")
+			links := aux["links"].(map[string][]string)
+			aux["links"] = map[string][]string{"website": links["website"]}
+		case s.AssertedSnapID("cont-consumer"):
+			c.Check(aux, DeepEquals, map[string]any{"private": true})
+			return nil
+		case s.AssertedSnapID("pc"):
+			c.Check(aux, HasLen, 0)
+			aux["private"] = true
+		}
+		return aux
+	}
+
+	s.opts.Label = "20191003"
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+	c.Assert(w.SeedSnaps(nil), IsNil)
+	c.Assert(w.WriteMeta(), IsNil)
+
+	c.Check(called, HasLen, 7)
+
+	b, err := os.ReadFile(filepath.Join(s.opts.SeedDir, "systems", s.opts.Label, "snaps", "aux-info.json"))
+	c.Assert(err, IsNil)
+	var auxInfos map[string]map[string]any
+	c.Assert(json.Unmarshal(b, &auxInfos), IsNil)
+	c.Check(auxInfos, DeepEquals, map[string]map[string]any{
+		s.AssertedSnapID("cont-producer"): {
+			"links": map[string]any{
+				"website": []any{"https://cont-producer.net"},
+			},
+		},
+		s.AssertedSnapID("pc"): {
+			"private": true,
+		},
+	})
+}
+
+func (s *writerSuite) TestCore20InvalidLabel(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"store":        "my-store",
+		"base":         "core20",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+		},
+	})
+
+	invalid := []string{
+		"-",
+		"a.b",
+		"aa--b",
+	}
+
+	for _, inv := range invalid {
+		s.opts.Label = inv
+		w, err := seedwriter.New(model, s.opts)
+		c.Assert(w, IsNil)
+		c.Check(err, ErrorMatches, fmt.Sprintf(`invalid seed system label: %q`, inv))
+	}
+}
+
+func (s *writerSuite) TestDownloadedCore20CheckBase(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"store":        "my-store",
+		"base":         "core20",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name": "cont-producer",
+				"id":   s.AssertedSnapID("cont-producer"),
+			},
+		},
+	})
+
+	// validity
+	c.Assert(model.Grade(), Equals, asserts.ModelSigned)
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "cont-producer", "developerid")
+
+	s.opts.Label = "20191003"
+	_, _, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	c.Check(err, ErrorMatches, `cannot add snap "cont-producer" without also adding its base "core18" explicitly`)
+}
+
+func (s *writerSuite) TestDownloadedCore20CheckBaseModes(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"store":        "my-store",
+		"base":         "core20",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name": "core18",
+				"id":   s.AssertedSnapID("core18"),
+				"type": "base",
+			},
+			map[string]any{
+				"name":  "cont-producer",
+				"id":    s.AssertedSnapID("cont-producer"),
+				"modes": []any{"run", "ephemeral"},
+			},
+		},
+	})
+
+	// validity
+	c.Assert(model.Grade(), Equals, asserts.ModelSigned)
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "cont-producer", "developerid")
+
+	s.opts.Label = "20191003"
+	_, _, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	c.Check(err, ErrorMatches, `cannot add snap "cont-producer" without also adding its base "core18" explicitly for all relevant modes \(run, ephemeral\)`)
+}
+
+func (s *writerSuite) TestDownloadedCore20CheckBaseEphemeralOK(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"store":        "my-store",
+		"base":         "core20",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":  "core18",
+				"id":    s.AssertedSnapID("core18"),
+				"type":  "base",
+				"modes": []any{"ephemeral"},
+			},
+			map[string]any{
+				"name":  "cont-producer",
+				"id":    s.AssertedSnapID("cont-producer"),
+				"modes": []any{"recover"},
+			},
+		},
+	})
+
+	// validity
+	c.Assert(model.Grade(), Equals, asserts.ModelSigned)
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "cont-producer", "developerid")
+
+	s.opts.Label = "20191003"
+	_, _, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	c.Check(err, IsNil)
+}
+
+func (s *writerSuite) TestDownloadedCore20CheckBaseCoreXX(c *C) {
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "core", "")
+	s.makeSnap(c, "required", "")
+
+	coreEnt := map[string]any{
+		"name": "core",
+		"id":   s.AssertedSnapID("core"),
+		"type": "core",
+	}
+	requiredEnt := map[string]any{
+		"name": "required",
+		"id":   s.AssertedSnapID("required"),
+	}
+
+	tests := []struct {
+		snaps []any
+		err   string
+	}{
+		{[]any{coreEnt, requiredEnt}, ""},
+		{[]any{requiredEnt}, `cannot add snap "required" without also adding its base "core" explicitly`},
+	}
+
+	baseLabel := "20191003"
+	for idx, t := range tests {
+		s.opts.Label = fmt.Sprintf("%s%d", baseLabel, idx)
+		snaps := []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+		}
+
+		snaps = append(snaps, t.snaps...)
+
+		model := s.Brands.Model("my-brand", "my-model", map[string]any{
+			"display-name": "my model",
+			"architecture": "amd64",
+			"store":        "my-store",
+			"base":         "core20",
+			"snaps":        snaps,
+		})
+
+		_, _, err := s.upToDownloaded(c, model, s.fillMetaDownloadedSnap, s.fetchAsserts(c))
+		if t.err == "" {
+			c.Check(err, IsNil)
+		} else {
+			c.Check(err, ErrorMatches, t.err)
+		}
+	}
+}
+func (s *writerSuite) TestDownloadedCore20MissingDefaultProviderModes(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"store":        "my-store",
+		"base":         "core20",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":  "core18",
+				"id":    s.AssertedSnapID("core18"),
+				"type":  "base",
+				"modes": []any{"run", "ephemeral"},
+			},
+			map[string]any{
+				"name": "cont-producer",
+				"id":   s.AssertedSnapID("cont-producer"),
+			},
+			map[string]any{
+				"name":  "cont-consumer",
+				"id":    s.AssertedSnapID("cont-consumer"),
+				"modes": []any{"recover"},
+			},
+		},
+	})
+
+	// validity
+	c.Assert(model.Grade(), Equals, asserts.ModelSigned)
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "cont-producer", "developerid")
+	s.makeSnap(c, "cont-consumer", "developerid")
+
+	s.opts.Label = "20191003"
+	_, _, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	c.Check(err, ErrorMatches, `prerequisites need to be added explicitly for relevant mode recover: cannot use snap "cont-consumer": default provider "cont-producer" or any alternative provider for content "cont" is missing`)
+}
+
+func (s *writerSuite) TestDownloadedCore20AlternativeProviderModes(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"store":        "my-store",
+		"base":         "core20",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":  "core18",
+				"id":    s.AssertedSnapID("core18"),
+				"type":  "base",
+				"modes": []any{"run", "ephemeral"},
+			},
+			map[string]any{
+				"name": "cont-producer",
+				"id":   s.AssertedSnapID("cont-producer"),
+			},
+			map[string]any{
+				"name":  "cont-consumer",
+				"id":    s.AssertedSnapID("cont-consumer"),
+				"modes": []any{"recover"},
+			},
+			map[string]any{
+				"name":  "alt-cont-producer",
+				"id":    s.AssertedSnapID("alt-cont-producer"),
+				"modes": []any{"recover"},
+			},
+		},
+	})
+
+	// validity
+	c.Assert(model.Grade(), Equals, asserts.ModelSigned)
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "cont-producer", "developerid")
+	s.makeSnap(c, "cont-consumer", "developerid")
+	s.makeSnap(c, "alt-cont-producer", "developerid")
+
+	s.opts.Label = "20191003"
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+	warns := w.Warnings()
+	c.Assert(warns, HasLen, 1)
+	c.Check(warns[0], Matches, `prerequisites for mode recover: snap "cont-consumer" requires a provider for content "cont", a candidate slot is available \(alt-cont-producer:serve-cont\) but not the default-provider, ensure a single auto-connection \(or possibly a connection\) is in-place`)
+	structured := w.StructuredWarnings()
+	c.Assert(structured, HasLen, 1)
+	c.Check(structured[0].Kind, Equals, seedwriter.WarningContentProvider)
+	c.Check(structured[0].SnapName, Equals, "cont-consumer")
+	c.Check(structured[0].Message, Equals, warns[0])
+}
+
+func (s *writerSuite) TestDownloadedCore20RequireConnectableContentProviders(c *C) {
+	mkModel := func(consumerModes, altModes []any) *asserts.Model {
+		return s.Brands.Model("my-brand", "my-model", map[string]any{
+			"display-name": "my model",
+			"architecture": "amd64",
+			"store":        "my-store",
+			"base":         "core20",
+			"snaps": []any{
+				map[string]any{
+					"name":            "pc-kernel",
+					"id":              s.AssertedSnapID("pc-kernel"),
+					"type":            "kernel",
+					"default-channel": "20",
+				},
+				map[string]any{
+					"name":            "pc",
+					"id":              s.AssertedSnapID("pc"),
+					"type":            "gadget",
+					"default-channel": "20",
+				},
+				map[string]any{
+					"name":  "core18",
+					"id":    s.AssertedSnapID("core18"),
+					"type":  "base",
+					"modes": []any{"run", "ephemeral"},
+				},
+				map[string]any{
+					"name": "cont-producer",
+					"id":   s.AssertedSnapID("cont-producer"),
+				},
+				map[string]any{
+					"name":  "cont-consumer",
+					"id":    s.AssertedSnapID("cont-consumer"),
+					"modes": consumerModes,
+				},
+				map[string]any{
+					"name":  "alt-cont-producer",
+					"id":    s.AssertedSnapID("alt-cont-producer"),
+					"modes": altModes,
+				},
+			},
+		})
+	}
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "cont-producer", "developerid")
+	s.makeSnap(c, "cont-consumer", "developerid")
+	s.makeSnap(c, "alt-cont-producer", "developerid")
+
+	s.opts.Label = "20191003"
+	s.opts.RequireConnectableContentProviders = true
+
+	// only the alternative provider is available in recover mode
+	_, _, err := s.upToDownloaded(c, mkModel([]any{"recover"}, []any{"recover"}), s.fillMetaDownloadedSnap, s.fetchAsserts(c))
+	c.Check(err, ErrorMatches, `prerequisites for mode recover: cannot reconcile content plug cont-consumer:cont with slots alt-cont-producer:serve-cont: default-provider "cont-producer" is missing`)
+
+	// the default-provider is available alongside the alternative
+	// one, this is still only a warning
+	s.opts.Label = "20191004"
+	complete, w, err := s.upToDownloaded(c, mkModel([]any{"run"}, []any{"run"}), s.fillMetaDownloadedSnap, s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+	warns := w.StructuredWarnings()
+	c.Assert(warns, HasLen, 1)
+	c.Check(warns[0].Kind, Equals, seedwriter.WarningContentProvider)
+	c.Check(warns[0].Message, Matches, `snap "cont-consumer" requires a provider for content "cont", many candidates slots are available \(alt-cont-producer:serve-cont\) including from default-provider cont-producer:cont, .*`)
+}
+
+func (s *writerSuite) TestCore20NonDangerousDisallowedDevmodeSnaps(c *C) {
+
+	s.makeSnap(c, "my-devmode", "canonical")
+
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"store":        "my-store",
+		"base":         "core20",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name": "my-devmode",
+				"id":   s.AssertedSnapID("my-devmode"),
+				"type": "app",
+			},
+		},
+	})
+
+	s.opts.Label = "20191107"
+
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
+
+	localSnaps, err := w.LocalSnaps()
+	c.Assert(err, IsNil)
+	c.Assert(localSnaps, HasLen, 0)
+
+	snaps, err := w.SnapsToDownload()
+	c.Check(err, IsNil)
+	c.Assert(snaps, HasLen, 5)
+
+	c.Assert(snaps[4].SnapName(), Equals, "my-devmode")
+	sn := snaps[4]
+
+	info := s.AssertedSnapInfo(sn.SnapName())
+	c.Assert(info, NotNil, Commentf("%s not defined", sn.SnapName()))
+	err = w.SetInfo(sn, info, nil)
+	c.Assert(err, ErrorMatches, "cannot override channels, add devmode snaps, local snaps, or extra snaps/components with a model of grade higher than dangerous")
+	c.Check(sn.Info, Not(Equals), info)
+}
+
+func (s *writerSuite) TestCore20NonDangerousDisallowedOptionsSnaps(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"store":        "my-store",
+		"base":         "core20",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+		},
+	})
+
+	pcFn := s.makeLocalSnap(c, "pc")
+
+	baseLabel := "20191107"
+
+	tests := []struct {
+		optSnap            *seedwriter.OptionsSnap
+		expectedErrVariant string
+	}{
+		{optSnap: &seedwriter.OptionsSnap{Name: "extra"}},
+		{optSnap: &seedwriter.OptionsSnap{Path: pcFn}},
+		{
+			optSnap:            &seedwriter.OptionsSnap{Name: "pc", Channel: "edge"},
+			expectedErrVariant: "cannot override channels with a model of grade higher than dangerous but --snap=<snap-name> is allowed to select optional snaps to include",
+		},
+	}
+
+	const expectedErr = `cannot override channels, add devmode snaps, local snaps, or extra snaps/components with a model of grade higher than dangerous`
+
+	for idx, t := range tests {
+		s.opts.Label = fmt.Sprintf("%s%d", baseLabel, idx)
+		w, err := seedwriter.New(model, s.opts)
+		c.Assert(err, IsNil)
+
+		err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{t.optSnap})
+		if err != nil {
+			if t.expectedErrVariant != "" {
+				c.Check(err, ErrorMatches, t.expectedErrVariant)
+			} else {
+				c.Check(err, ErrorMatches, expectedErr)
+			}
+			continue
+		}
+
+		err = w.Start(s.db, s.rf)
+		c.Assert(err, IsNil)
+
+		if t.optSnap.Path != "" {
+			localSnaps, err := w.LocalSnaps()
+			c.Assert(err, IsNil)
+			c.Assert(localSnaps, HasLen, 1)
+
+			for _, sn := range localSnaps {
+				si, _, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
+				if !errors.Is(err, &asserts.NotFoundError{}) {
+					c.Assert(err, IsNil)
+				}
+				f, err := snapfile.Open(sn.Path)
+				c.Assert(err, IsNil)
+				info, err := snap.ReadInfoFromSnapFile(f, si)
+				c.Assert(err, IsNil)
+				w.SetInfo(sn, info, nil)
+			}
+
+			err = w.InfoDerived()
+			c.Check(err, ErrorMatches, expectedErr)
+			continue
+		}
+
+		_, err = w.SnapsToDownload()
+		c.Check(err, ErrorMatches, expectedErr)
+	}
+}
+
+func (s *writerSuite) TestCore20NonDangerousNoChannelOverride(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"store":        "my-store",
+		"base":         "core20",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+		},
+	})
+
+	s.opts.DefaultChannel = "stable"
+	s.opts.Label = "20191107"
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(w, IsNil)
+	c.Check(err, ErrorMatches, `cannot override channels, add devmode snaps, local snaps, or extra snaps/components with a model of grade higher than dangerous`)
+}
+
+func (s *writerSuite) TestSeedSnapsWriteMetaCore20LocalSnaps(c *C) {
+	withComps := false
+	s.testSeedSnapsWriteMetaCore20LocalSnaps(c, withComps)
+}
+
+func (s *writerSuite) TestSeedSnapsWriteMetaCore20LocalSnapsWithComps(c *C) {
+	withComps := true
+	s.testSeedSnapsWriteMetaCore20LocalSnaps(c, withComps)
+}
+
+func (s *writerSuite) testSeedSnapsWriteMetaCore20LocalSnaps(c *C, withComps bool) {
+	// add store assertion
+	storeAs, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
+		"store":       "my-store",
+		"operator-id": "canonical",
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	err = s.StoreSigning.Add(storeAs)
+	c.Assert(err, IsNil)
+
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"store":        "my-store",
+		"base":         "core20",
+		"grade":        "dangerous",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name": "required20",
+				"id":   s.AssertedSnapID("required20"),
+			},
+		},
+	})
+
+	// validity
+	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	requiredFn := s.makeLocalSnap(c, "required20")
+
+	s.opts.Label = "20191030"
+	s.opts.ChecksumManifestPath = filepath.Join(c.MkDir(), "seed.sha3-384")
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Path: requiredFn}})
+	c.Assert(err, IsNil)
+
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
+
+	localSnaps, err := w.LocalSnaps()
+	c.Assert(err, IsNil)
+	c.Assert(localSnaps, HasLen, 1)
+
+	var pathComp1, pathComp2 string
+	for _, sn := range localSnaps {
+		_, _, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
+		c.Assert(errors.Is(err, &asserts.NotFoundError{}), Equals, true)
+		f, err := snapfile.Open(sn.Path)
+		c.Assert(err, IsNil)
+		info, err := snap.ReadInfoFromSnapFile(f, nil)
+		c.Assert(err, IsNil)
+		seedComps := map[string]*seedwriter.SeedComponent{}
+		if withComps {
+			cref1 := naming.NewComponentRef("required20", "comp1")
+			cinfo1 := snap.NewComponentInfo(cref1, snap.StandardComponent, "1.5", "", "", "", nil)
+			pathComp1 = s.makeLocalComponent(c, "required20+comp1")
+			cref2 := naming.NewComponentRef("required20", "comp2")
+			cinfo2 := snap.NewComponentInfo(cref2, snap.StandardComponent, "", "", "", "", nil)
+			pathComp2 = s.makeLocalComponent(c, "required20+comp2")
+			seedComps["comp1"] = &seedwriter.SeedComponent{
+				ComponentRef: cref1,
+				Path:         pathComp1,
+				Info:         cinfo1,
+			}
+			seedComps["comp2"] = &seedwriter.SeedComponent{
+				ComponentRef: cref2,
+				Path:         pathComp2,
+				Info:         cinfo2,
+			}
+		}
+		c.Assert(w.SetInfo(sn, info, seedComps), IsNil)
+	}
+
+	err = w.InfoDerived()
+	c.Assert(err, IsNil)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Check(snaps, HasLen, 4)
+
+	for _, sn := range snaps {
+		// check the used channel at this level because in the
+		// non-dangerous case is not written anywhere (it
+		// reflects the model or default)
+		channel := "latest/stable"
+		switch sn.SnapName() {
+		case "pc", "pc-kernel":
+			channel = "20"
+		}
+		c.Check(sn.Channel, Equals, channel)
+		s.fillDownloadedSnap(c, w, sn)
+	}
+
+	complete, err := w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	copySnap := func(name, src, dst string) error {
+		return osutil.CopyFile(src, dst, 0)
+	}
+
+	err = w.SeedSnaps(copySnap)
+	c.Assert(err, IsNil)
+
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
+
+	// check seed
+	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
+	c.Check(systemDir, testutil.FilePresent)
+
+	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
+	c.Assert(err, IsNil)
+	c.Check(l, HasLen, 4)
+
+	// local unasserted snap/component were put in system snaps dir
+	c.Check(filepath.Join(systemDir, "snaps", "required20_1.0.snap"), testutil.FilePresent)
+	if withComps {
+		c.Check(filepath.Join(systemDir, "snaps", "required20+comp1_1.5.comp"), testutil.FilePresent)
+		// Note that the component version is here the one for the snap
+		// as it was not specified in the component itself.
+		c.Check(filepath.Join(systemDir, "snaps", "required20+comp2_1.0.comp"), testutil.FilePresent)
+	}
+
+	blobs := []string{
+		"snaps/snapd_1.snap",
+		"snaps/core20_1.snap",
+		"snaps/pc-kernel_1.snap",
+		"snaps/pc_1.snap",
+		"systems/20191030/snaps/required20_1.0.snap",
+	}
+	if withComps {
+		blobs = append(blobs,
+			"systems/20191030/snaps/required20+comp1_1.5.comp",
+			"systems/20191030/snaps/required20+comp2_1.0.comp")
+	}
+	s.checkChecksumManifest(c, blobs)
+
+	options20, err := seedwriter.InternalReadOptions20(filepath.Join(systemDir, "options.yaml"))
+	c.Assert(err, IsNil)
+
+	var compOpts []internal.Component20
+	if withComps {
+		compOpts = []internal.Component20{
+			{
+				Name:       "comp1",
+				Unasserted: "required20+comp1_1.5.comp",
+			},
+			{
+				Name:       "comp2",
+				Unasserted: "required20+comp2_1.0.comp",
+			},
+		}
+	}
+	c.Check(options20.Snaps, DeepEquals, []*seedwriter.InternalSnap20{
+		{
+			Name:       "required20",
+			SnapID:     s.AssertedSnapID("required20"),
+			Unasserted: "required20_1.0.snap",
+			Components: compOpts,
+		},
+	})
+}
+
+func (s *writerSuite) TestSetComponentOptionsBad(c *C) {
+	// add store assertion
+	storeAs, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
+		"store":       "my-store",
+		"operator-id": "canonical",
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	err = s.StoreSigning.Add(storeAs)
+	c.Assert(err, IsNil)
+
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"store":        "my-store",
+		"base":         "core20",
+		"grade":        "dangerous",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name": "required20",
+				"id":   s.AssertedSnapID("required20"),
+				"components": map[string]any{
+					"comp1": "required",
+					"comp2": "optional",
+				},
+			},
+		},
+	})
+
+	// validity
+	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
+
+	requiredFn := s.makeLocalSnap(c, "required20")
+	pathComp1 := s.makeLocalComponent(c, "required20+comp1")
+	s.opts.Label = "20240630"
+
+	for i, tc := range []struct {
+		comps []seedwriter.OptionsComponent
+		err   string
+	}{
+		{
+			comps: []seedwriter.OptionsComponent{
+				{Name: "comp1", Path: "comp1_25.comp"},
+			},
+			err: `cannot specify both name and path for component "comp1"`,
+		},
+		{
+			comps: []seedwriter.OptionsComponent{
+				{Name: "comp_1", Path: ""},
+			},
+			err: `invalid snap name: "comp_1"`,
+		},
+		{
+			comps: []seedwriter.OptionsComponent{
+				{Name: "comp1", Path: ""},
+			},
+			err: "",
+		},
+		{
+			comps: []seedwriter.OptionsComponent{
+				{Name: "", Path: "comp1_25.snap"},
+			},
+			err: `local option component "comp1_25.snap" does not end in .comp`,
+		},
+		{
+			comps: []seedwriter.OptionsComponent{
+				{Name: "", Path: "comp1_25.comp"},
+			},
+			err: `local option component "comp1_25.comp" does not exist`,
+		},
+		{
+			comps: []seedwriter.OptionsComponent{
+				{Name: "", Path: pathComp1},
+			},
+			err: "",
+		},
+	} {
+		c.Logf("test %d", i)
+		w, err := seedwriter.New(model, s.opts)
+		c.Assert(err, IsNil)
+
+		err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{
+			Path:       requiredFn,
+			Components: tc.comps,
+		}})
+		if tc.err == "" {
+			c.Check(err, IsNil)
+		} else {
+			c.Check(err.Error(), Equals, tc.err)
+		}
+	}
+}
+
+func (s *writerSuite) TestSeedSnapsWriteMetaCore20ChannelOverrides(c *C) {
+	// add store assertion
+	storeAs, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
+		"store":       "my-store",
+		"operator-id": "canonical",
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	err = s.StoreSigning.Add(storeAs)
+	c.Assert(err, IsNil)
+
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"store":        "my-store",
+		"base":         "core20",
+		"grade":        "dangerous",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name": "required20",
+				"id":   s.AssertedSnapID("required20"),
+			},
+		},
+	})
+
+	// validity
+	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "required20", "developerid")
+
+	s.opts.Label = "20191030"
+	s.opts.DefaultChannel = "candidate"
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "pc", Channel: "edge"}})
+	c.Assert(err, IsNil)
+
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Check(snaps, HasLen, 5)
+
+	for _, sn := range snaps {
+		s.fillDownloadedSnap(c, w, sn)
+	}
+
+	complete, err := w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	err = w.SeedSnaps(nil)
+	c.Assert(err, IsNil)
+
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
+
+	// check seed
+	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
+	c.Check(systemDir, testutil.FilePresent)
+
+	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
+	c.Assert(err, IsNil)
+	c.Check(l, HasLen, 5)
+
+	options20, err := seedwriter.InternalReadOptions20(filepath.Join(systemDir, "options.yaml"))
+	c.Assert(err, IsNil)
+
+	c.Check(options20.Snaps, DeepEquals, []*seedwriter.InternalSnap20{
+		{
+			Name:    "snapd",
+			SnapID:  s.AssertedSnapID("snapd"), // inferred
+			Channel: "latest/candidate",
+		},
+		{
+			Name:    "pc-kernel",
+			SnapID:  s.AssertedSnapID("pc-kernel"),
+			Channel: "20/candidate",
+		},
+		{
+			Name:    "core20",
+			SnapID:  s.AssertedSnapID("core20"), // inferred
+			Channel: "latest/candidate",
+		},
+		{
+			Name:    "pc",
+			SnapID:  s.AssertedSnapID("pc"),
+			Channel: "20/edge",
+		},
+		{
+			Name:    "required20",
+			SnapID:  s.AssertedSnapID("required20"),
+			Channel: "latest/candidate",
+		},
+	})
+}
+
+func (s *writerSuite) TestSeedSnapsWriteMetaCore20BranchChannels(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core20",
+		"grade":        "dangerous",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name": "required20",
+				"id":   s.AssertedSnapID("required20"),
+			},
+		},
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "required20", "developerid")
+
+	s.opts.Label = "20191030"
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{
+		{Name: "pc", Channel: "edge/hotfix-1"},
+		{Name: "required20", Channel: "latest/beta/fix"},
+	})
+	c.Assert(err, IsNil)
+
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Check(snaps, HasLen, 5)
+
+	channels := make(map[string]string)
+	for _, sn := range snaps {
+		channels[sn.SnapName()] = sn.Channel
+		s.fillDownloadedSnap(c, w, sn)
+	}
+	c.Check(channels, DeepEquals, map[string]string{
+		"snapd":      "latest/stable",
+		"pc-kernel":  "20",
+		"core20":     "latest/stable",
+		"pc":         "20/edge/hotfix-1",
+		"required20": "latest/beta/fix",
+	})
+
+	complete, err := w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	err = w.SeedSnaps(nil)
+	c.Assert(err, IsNil)
+
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
+
+	// the branches are preserved in options.yaml
+	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
+	options20, err := seedwriter.InternalReadOptions20(filepath.Join(systemDir, "options.yaml"))
+	c.Assert(err, IsNil)
+	c.Check(options20.Snaps, DeepEquals, []*seedwriter.InternalSnap20{
+		{
+			Name:    "pc",
+			SnapID:  s.AssertedSnapID("pc"),
+			Channel: "20/edge/hotfix-1",
+		},
+		{
+			Name:    "required20",
+			SnapID:  s.AssertedSnapID("required20"),
+			Channel: "latest/beta/fix",
+		},
+	})
+}
+
+func (s *writerSuite) TestSeedSnapsWriteMetaCore20ModelOverrideSnapd(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core20",
+		"snaps": []any{
+			map[string]any{
+				"name":            "snapd",
+				"id":              s.AssertedSnapID("snapd"),
+				"type":            "snapd",
+				"default-channel": "latest/edge",
+			},
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			}},
+	})
+
+	// validity
+	c.Assert(model.Grade(), Equals, asserts.ModelSigned)
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+
+	s.opts.Label = "20191121"
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Check(snaps, HasLen, 4)
+
+	for _, sn := range snaps {
+		// check the used channel at this level because in the
+		// non-dangerous case is not written anywhere (it
+		// reflects the model or default)
+		channel := "latest/stable"
+		switch sn.SnapName() {
+		case "snapd":
+			channel = "latest/edge"
+		case "pc", "pc-kernel":
+			channel = "20"
+		}
+		c.Check(sn.Channel, Equals, channel)
+		s.fillDownloadedSnap(c, w, sn)
+	}
+
+	complete, err := w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	err = w.SeedSnaps(nil)
+	c.Assert(err, IsNil)
+
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
+
+	// check seed
+	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
+	c.Check(systemDir, testutil.FilePresent)
+
+	// check the snaps are in place
+	for _, name := range []string{"snapd", "pc-kernel", "core20", "pc"} {
+		info := s.AssertedSnapInfo(name)
+
+		fn := info.Filename()
+		p := filepath.Join(s.opts.SeedDir, "snaps", fn)
+		c.Check(p, testutil.FilePresent)
+	}
+
+	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
+	c.Assert(err, IsNil)
+	c.Check(l, HasLen, 4)
+
+	c.Check(filepath.Join(systemDir, "extra-snaps"), testutil.FileAbsent)
+	c.Check(filepath.Join(systemDir, "options.yaml"), testutil.FileAbsent)
+}
+
+func (s *writerSuite) TestSeedSnapsWriteMetaCore20AlwaysWriteOptions(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core20",
+		"grade":        "dangerous",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			}},
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+
+	s.opts.Label = "20191121"
+	s.opts.AlwaysWriteOptions = true
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	err = w.SeedSnaps(nil)
+	c.Assert(err, IsNil)
+
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
+
+	// there are no overrides but options.yaml is written nevertheless
+	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
+	c.Check(filepath.Join(systemDir, "options.yaml"), testutil.FileEquals, "snaps: []\n")
+
+	options20, err := seedwriter.InternalReadOptions20(filepath.Join(systemDir, "options.yaml"))
+	c.Assert(err, IsNil)
+	c.Check(options20.Snaps, HasLen, 0)
+
+	// the seed with the empty options.yaml can be loaded
+	const usesSnapd = true
+	seedtest.ValidateSeed(c, s.opts.SeedDir, s.opts.Label, usesSnapd,
+		s.StoreSigning.Trusted)
+}
+
+func (s *writerSuite) TestSnapsToDownloadCore20OptionalSnaps(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core20",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name": "core18",
+				"id":   s.AssertedSnapID("core18"),
+				"type": "base",
+			},
+			map[string]any{
+				"name":     "optional20-a",
+				"id":       s.AssertedSnapID("optional20-a"),
+				"presence": "optional",
+			},
+			map[string]any{
+				"name":     "optional20-b",
+				"id":       s.AssertedSnapID("optional20-b"),
+				"presence": "optional",
+			}},
+	})
+
+	// validity
+	c.Assert(model.Grade(), Equals, asserts.ModelSigned)
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "optional20-a", "developerid")
+	s.makeSnap(c, "optional20-b", "developerid")
+
+	s.opts.Label = "20191122"
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "optional20-b"}})
+	c.Assert(err, IsNil)
+
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Check(snaps, HasLen, 6)
+	c.Check(snaps[5].SnapName(), Equals, "optional20-b")
+}
+
+func (s *writerSuite) TestRemoveOptionsSnapCore20(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core20",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":     "optional20-a",
+				"id":       s.AssertedSnapID("optional20-a"),
+				"presence": "optional",
+			},
+			map[string]any{
+				"name":     "optional20-b",
+				"id":       s.AssertedSnapID("optional20-b"),
+				"presence": "optional",
+			}},
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "optional20-a", "developerid")
+	s.makeSnap(c, "optional20-b", "developerid")
+
+	s.opts.Label = "20191122"
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	optSnaps := []*seedwriter.OptionsSnap{
+		{Name: "optional20-a"},
+		{Name: "optional20-b", Components: []seedwriter.OptionsComponent{{Name: "comp1"}}},
+	}
+	err = w.SetOptionsSnaps(optSnaps)
+	c.Assert(err, IsNil)
+
+	err = w.RemoveOptionsSnap("optional20-b")
+	c.Assert(err, IsNil)
+	// the slice given to SetOptionsSnaps is left untouched
+	c.Check(optSnaps, HasLen, 2)
+
+	err = w.RemoveOptionsSnap("optional20-b")
+	c.Check(err, ErrorMatches, `cannot remove option snap "optional20-b": not set in options`)
+
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 5)
+	c.Check(snaps[4].SnapName(), Equals, "optional20-a")
+}
+
+func (s *writerSuite) TestRemoveOptionsSnapErrors(c *C) {
+	model := s.appendModel()
+
+	s.opts.Label = "20191122"
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	err = w.RemoveOptionsSnap("pc")
+	c.Check(err, ErrorMatches, `cannot remove option snap "pc": not set in options`)
+
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "pc", Channel: "edge"}})
+	c.Assert(err, IsNil)
+
+	err = w.RemoveOptionsSnap("pc")
+	c.Check(err, ErrorMatches, `cannot remove option snap "pc": required by the model`)
+
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
+
+	err = w.RemoveOptionsSnap("pc")
+	c.Check(err, ErrorMatches, `internal error: seedwriter.Writer cannot remove option snaps after Start`)
+}
+
+func (s *writerSuite) TestSeedSnapsWriteMetaCore20ExtraSnaps(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core20",
+		"grade":        "dangerous",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name": "component-test",
+				"id":   s.AssertedSnapID("component-test"),
+			},
+		},
+	})
+
+	// validity
+	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "cont-producer", "developerid")
+	contConsumerFn := s.makeLocalSnap(c, "cont-consumer")
+	comRevs := map[string]snap.Revision{
+		"comp1": snap.R(22),
+		"comp2": snap.R(33),
+	}
+	s.MakeAssertedSnapWithComps(c, seedtest.SampleSnapYaml["required20"], nil,
+		snap.R(21), comRevs, "canonical", s.StoreSigning.Database)
+
+	s.MakeAssertedSnapWithComps(c, seedtest.SampleSnapYaml["component-test"], nil,
+		snap.R(31), nil, "canonical", s.StoreSigning.Database)
+
+	s.opts.Label = "20191122"
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{
+		{Name: "cont-producer", Channel: "edge"},
+		{Name: "core18"}, {Path: contConsumerFn},
+		{Name: "required20", Components: []seedwriter.OptionsComponent{
+			{Name: "comp1"}, {Name: "comp2"},
+		}},
+		{Name: "component-test", Components: []seedwriter.OptionsComponent{
+			{Name: "comp1"},
+		}},
+	})
+	c.Assert(err, IsNil)
+
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
+
+	localSnaps, err := w.LocalSnaps()
+	c.Assert(err, IsNil)
+	c.Assert(localSnaps, HasLen, 1)
+
+	for _, sn := range localSnaps {
+		_, _, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
+		c.Assert(errors.Is(err, &asserts.NotFoundError{}), Equals, true)
+		f, err := snapfile.Open(sn.Path)
+		c.Assert(err, IsNil)
+		info, err := snap.ReadInfoFromSnapFile(f, nil)
+		c.Assert(err, IsNil)
+		w.SetInfo(sn, info, nil)
+	}
+
+	err = w.InfoDerived()
+	c.Assert(err, IsNil)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Check(snaps, HasLen, 5)
+
+	for _, sn := range snaps {
+		channel := "latest/stable"
+		switch sn.SnapName() {
+		case "pc", "pc-kernel":
+			channel = "20"
+		}
+		c.Check(sn.Channel, Equals, channel)
+		s.fillDownloadedSnap(c, w, sn)
+	}
+
+	complete, err := w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, false)
+
+	snaps, err = w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 3)
+	c.Check(snaps[0].SnapName(), Equals, "cont-producer")
+	c.Check(snaps[1].SnapName(), Equals, "core18")
+	c.Check(snaps[2].SnapName(), Equals, "required20")
+
+	for _, sn := range snaps {
+		channel := "latest/stable"
+		switch sn.SnapName() {
+		case "cont-producer":
+			channel = "latest/edge"
+		}
+		c.Check(sn.Channel, Equals, channel)
+
+		info := s.doFillMetaDownloadedSnap(c, w, sn)
+
+		c.Assert(sn.Path, Equals, filepath.Join(s.opts.SeedDir, "systems", s.opts.Label, "snaps", info.Filename()))
+		err := os.Rename(s.AssertedSnap(sn.SnapName()), sn.Path)
+		c.Assert(err, IsNil)
+		for _, seedComp := range sn.Components {
+			err := os.Rename(s.AssertedSnap(seedComp.String()), seedComp.Path)
+			c.Assert(err, IsNil)
+		}
+	}
+
+	complete, err = w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	copySnap := func(name, src, dst string) error {
+		return osutil.CopyFile(src, dst, 0)
+	}
+
+	err = w.SeedSnaps(copySnap)
+	c.Assert(err, IsNil)
+
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
+
+	// check seed
+	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
+	c.Check(systemDir, testutil.FilePresent)
+
+	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
+	c.Assert(err, IsNil)
+	c.Check(l, HasLen, 5)
+
+	// this snap is part of the model, so it should be in the seed's snap dir
+	c.Check(filepath.Join(s.opts.SeedDir, "snaps", "component-test_31.snap"), testutil.FilePresent)
+
+	// extra containers were put in system snaps dir
+	c.Check(filepath.Join(systemDir, "snaps", "core18_1.snap"), testutil.FilePresent)
+	c.Check(filepath.Join(systemDir, "snaps", "cont-producer_1.snap"), testutil.FilePresent)
+	c.Check(filepath.Join(systemDir, "snaps", "cont-consumer_1.0.snap"), testutil.FilePresent)
+	c.Check(filepath.Join(systemDir, "snaps", "required20_21.snap"), testutil.FilePresent)
+	c.Check(filepath.Join(systemDir, "snaps", "required20+comp1_22.comp"), testutil.FilePresent)
+	c.Check(filepath.Join(systemDir, "snaps", "required20+comp2_33.comp"), testutil.FilePresent)
+
+	// although this component's snap is in the model, the component itself is
+	// not. that is why it ends up in this directory
+	c.Check(filepath.Join(systemDir, "snaps", "component-test+comp1_77.comp"), testutil.FilePresent)
+
+	uniqID := func(a asserts.Assertion) string {
+		uniq := a.Ref().Unique()
+		if a.Type() == asserts.SnapRevisionType {
+			rev := a.(*asserts.SnapRevision)
+			uniq = fmt.Sprintf("%s@%d", rev.SnapID(), rev.SnapRevision())
+		} else if a.Type() == asserts.SnapResourceRevisionType {
+			rev := a.(*asserts.SnapResourceRevision)
+			uniq = fmt.Sprintf("%s+%s@%d", rev.SnapID(),
+				rev.ResourceName(), rev.ResourceRevision())
+		}
+		return uniq
+	}
+
+	// check extra-snaps in assertions
+	extraAssertions := seedtest.ReadAssertions(c, filepath.Join(systemDir, "assertions", "extra-snaps"))
+	seenExtra := make(map[string]bool)
+	for _, a := range extraAssertions {
+		seenExtra[uniqID(a)] = true
+	}
+
+	assertions := seedtest.ReadAssertions(c, filepath.Join(systemDir, "assertions", "snaps"))
+	seen := make(map[string]bool)
+	for _, a := range assertions {
+		seen[uniqID(a)] = true
+	}
+
+	snapRevUniq := func(snapName string, revno int) string {
+		return fmt.Sprintf("%s@%d", s.AssertedSnapID(snapName), revno)
+	}
+	resRevUniq := func(snapName, compName string, resRev int) string {
+		return fmt.Sprintf("%s+%s@%d", s.AssertedSnapID(snapName), compName, resRev)
+	}
+	snapDeclUniq := func(snapName string) string {
+		return "snap-declaration/16/" + s.AssertedSnapID(snapName)
+	}
+	snapResPairUniq := func(snapName, compName string, resRev, snapRev int) string {
+		return fmt.Sprintf("snap-resource-pair/%s/%s/%d/%d", s.AssertedSnapID(snapName), compName, resRev, snapRev)
+	}
+
+	c.Check(seenExtra, DeepEquals, map[string]bool{
+		"account/developerid":                          true,
+		snapDeclUniq("core18"):                         true,
+		snapDeclUniq("cont-producer"):                  true,
+		snapDeclUniq("required20"):                     true,
+		snapRevUniq("core18", 1):                       true,
+		snapRevUniq("cont-producer", 1):                true,
+		snapRevUniq("required20", 21):                  true,
+		resRevUniq("required20", "comp1", 22):          true,
+		resRevUniq("required20", "comp2", 33):          true,
+		snapResPairUniq("required20", "comp1", 22, 21): true,
+		snapResPairUniq("required20", "comp2", 33, 21): true,
+	})
+
+	// all of these end up in the main assertions file since the snap is
+	// asserted and in the model, despite the component not being in the model.
+	// this might be something we want to change
+	c.Check(seen[snapRevUniq("component-test", 31)], Equals, true)
+	c.Check(seen[resRevUniq("component-test", "comp1", 77)], Equals, true)
+	c.Check(seen[snapDeclUniq("component-test")], Equals, true)
+	c.Check(seen[snapResPairUniq("component-test", "comp1", 77, 31)], Equals, true)
+
+	options20, err := seedwriter.InternalReadOptions20(filepath.Join(systemDir, "options.yaml"))
+	c.Assert(err, IsNil)
+
+	c.Check(options20.Snaps, DeepEquals, []*seedwriter.InternalSnap20{
+		{
+			Name:       "component-test",
+			SnapID:     s.AssertedSnapID("component-test"),
+			Components: []internal.Component20{{Name: "comp1"}},
+		},
+		{
+			Name:    "cont-producer",
+			SnapID:  s.AssertedSnapID("cont-producer"),
+			Channel: "latest/edge",
+		},
+		{
+			Name:    "core18",
+			SnapID:  s.AssertedSnapID("core18"),
+			Channel: "latest/stable",
+		},
+		{
+			Name:       "cont-consumer",
+			Unasserted: "cont-consumer_1.0.snap",
+		},
+		{
+			Name:       "required20",
+			SnapID:     s.AssertedSnapID("required20"),
+			Channel:    "latest/stable",
+			Components: []internal.Component20{{Name: "comp1"}, {Name: "comp2"}},
+		},
+	})
+}
+
+func (s *writerSuite) TestSeedSnapsWriteMetaCore20LocalAssertedSnaps(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core20",
+		"grade":        "dangerous",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			}},
+	})
+
+	// validity
+	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "required20", "developerid")
+
+	s.opts.Label = "20191122"
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Path: s.AssertedSnap("pc"), Channel: "edge"}, {Path: s.AssertedSnap("required20")}})
+	c.Assert(err, IsNil)
+
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
+
+	localSnaps, err := w.LocalSnaps()
+	c.Assert(err, IsNil)
+	c.Assert(localSnaps, HasLen, 2)
+
+	for _, sn := range localSnaps {
+		si, aRefs, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
+		c.Assert(err, IsNil)
+		f, err := snapfile.Open(sn.Path)
+		c.Assert(err, IsNil)
+		info, err := snap.ReadInfoFromSnapFile(f, si)
+		c.Assert(err, IsNil)
+		w.SetInfo(sn, info, nil)
+		s.aRefs[sn.SnapName()] = aRefs
+	}
+
+	err = w.InfoDerived()
+	c.Assert(err, IsNil)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Check(snaps, HasLen, 3)
+
+	for _, sn := range snaps {
+		channel := "latest/stable"
+		switch sn.SnapName() {
+		case "pc", "pc-kernel":
+			channel = "20"
+		}
+		c.Check(sn.Channel, Equals, channel)
+		s.fillDownloadedSnap(c, w, sn)
+	}
+
+	complete, err := w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, false)
+
+	snaps, err = w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 0)
+
+	complete, err = w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	copySnap := func(name, src, dst string) error {
+		return osutil.CopyFile(src, dst, 0)
+	}
+
+	err = w.SeedSnaps(copySnap)
+	c.Assert(err, IsNil)
+
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
+
+	// check seed
+	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
+	c.Check(systemDir, testutil.FilePresent)
+
+	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
+	c.Assert(err, IsNil)
+	c.Check(l, HasLen, 4)
+
+	// local asserted model snap was put in /snaps
+	c.Check(filepath.Join(s.opts.SeedDir, "snaps", "pc_1.snap"), testutil.FilePresent)
+	// extra snaps were put in system snaps dir
+	c.Check(filepath.Join(systemDir, "snaps", "required20_1.snap"), testutil.FilePresent)
+
+	options20, err := seedwriter.InternalReadOptions20(filepath.Join(systemDir, "options.yaml"))
+	c.Assert(err, IsNil)
+
+	c.Check(options20.Snaps, DeepEquals, []*seedwriter.InternalSnap20{
+		{
+			Name:    "pc",
+			SnapID:  s.AssertedSnapID("pc"),
+			Channel: "20/edge",
+		},
+		{
+			Name:    "required20",
+			SnapID:  s.AssertedSnapID("required20"),
+			Channel: "latest/stable",
+		},
+	})
+}
+
+func (s *writerSuite) TestSeedSnapsWriteMetaCore20SignedLocalAssertedSnaps(c *C) {
+	withComps := false
+	s.testSeedSnapsWriteMetaCore20SignedLocalAssertedSnaps(c, withComps)
+}
+
+func (s *writerSuite) TestSeedSnapsWriteMetaCore20SignedLocalAssertedSnapsWithComps(c *C) {
+	withComps := true
+	s.testSeedSnapsWriteMetaCore20SignedLocalAssertedSnaps(c, withComps)
+}
+
+func (s *writerSuite) testSeedSnapsWriteMetaCore20SignedLocalAssertedSnaps(c *C, withComps bool) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core20",
+		"grade":        "signed",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name": "required20",
+				"id":   s.AssertedSnapID("required20"),
+				"components": map[string]any{
+					"comp1": "optional",
+					"comp2": "optional",
+				},
+			},
+		},
+	})
+
+	// soundness
+	c.Assert(model.Grade(), Equals, asserts.ModelSigned)
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	comRevs := map[string]snap.Revision{
+		"comp1": snap.R(22),
+		"comp2": snap.R(33),
+	}
+	s.SeedSnaps.MakeAssertedSnapWithComps(c, seedtest.SampleSnapYaml["required20"], nil,
+		snap.R(21), comRevs, "canonical", s.StoreSigning.Database)
+
+	s.opts.Label = "20191122"
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	// use local asserted snaps with signed, which is supported
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Path: s.AssertedSnap("pc")},
+		{Path: s.AssertedSnap("required20")}})
+	c.Assert(err, IsNil)
+
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
+
+	localSnaps, err := w.LocalSnaps()
+	c.Assert(err, IsNil)
+	c.Assert(localSnaps, HasLen, 2)
+
+	for _, sn := range localSnaps {
+		si, aRefs, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
+		c.Assert(err, IsNil)
+		f, err := snapfile.Open(sn.Path)
+		c.Assert(err, IsNil)
+		info, err := snap.ReadInfoFromSnapFile(f, si)
+		c.Assert(err, IsNil)
+
+		seedComps := map[string]*seedwriter.SeedComponent{}
+		if withComps && info.SnapName() == "required20" {
+			for _, comp := range []string{"comp1", "comp2"} {
+				cref := naming.NewComponentRef("required20", comp)
+				cinfo := snap.NewComponentInfo(cref, snap.StandardComponent,
+					"1.0", "", "", "", nil)
+				pathComp := s.AssertedSnap(cref.String())
+				csi, _, err := seedwriter.DeriveComponentSideInfo(
+					pathComp, cinfo, info, model, s.rf, s.db)
+				c.Assert(err, IsNil)
+				cinfo.ComponentSideInfo = *csi
+				seedComps[comp] = &seedwriter.SeedComponent{
+					ComponentRef: cref,
+					Path:         pathComp,
+					Info:         cinfo,
+				}
+			}
+		}
+
+		w.SetInfo(sn, info, seedComps)
+		s.aRefs[sn.SnapName()] = aRefs
+	}
+
+	err = w.InfoDerived()
+	c.Assert(err, IsNil)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Check(snaps, HasLen, 3)
+
+	for _, sn := range snaps {
+		channel := "latest/stable"
+		switch sn.SnapName() {
+		case "pc", "pc-kernel":
+			channel = "20"
+		}
+		c.Check(sn.Channel, Equals, channel)
+		s.fillDownloadedSnap(c, w, sn)
+	}
+
+	complete, err := w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	copySnap := func(name, src, dst string) error {
+		return osutil.CopyFile(src, dst, 0)
+	}
+
+	err = w.SeedSnaps(copySnap)
+	c.Assert(err, IsNil)
+
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
+
+	// check seed
+	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
+	c.Check(systemDir, testutil.FilePresent)
+
+	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
+	c.Assert(err, IsNil)
+	expectLen := 5
+	if withComps {
+		expectLen += 2
+	}
+	c.Check(l, HasLen, expectLen)
+
+	// local asserted snaps/components were put in /snaps
+	c.Check(filepath.Join(s.opts.SeedDir, "snaps", "pc_1.snap"), testutil.FilePresent)
+	c.Check(filepath.Join(s.opts.SeedDir, "snaps", "required20_21.snap"), testutil.FilePresent)
+	if withComps {
+		c.Check(filepath.Join(s.opts.SeedDir, "snaps", "required20+comp1_22.comp"), testutil.FilePresent)
+		c.Check(filepath.Join(s.opts.SeedDir, "snaps", "required20+comp2_33.comp"), testutil.FilePresent)
+	}
+
+	// no options file was created
+	c.Check(filepath.Join(systemDir, "options.yaml"), testutil.FileAbsent)
+}
+
+func (s *writerSuite) TestSeedSnapsWriteCore20ErrWhenDirExists(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core20",
+		"grade":        "signed",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			}},
+	})
+
+	err := os.MkdirAll(filepath.Join(s.opts.SeedDir, "systems", "1234"), 0755)
+	c.Assert(err, IsNil)
+	s.opts.Label = "1234"
+	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
-	c.Check(auxInfos, DeepEquals, map[string]map[string]any{
-		s.AssertedSnapID("cont-consumer"): {
-			"private": true,
+	c.Assert(w, NotNil)
+
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, ErrorMatches, `system "1234" already exists`)
+	c.Assert(seedwriter.IsSytemDirectoryExistsError(err), Equals, true)
+}
+
+func (s *writerSuite) testDownloadedCore20CheckClassic(c *C, modelGrade asserts.ModelGrade, classicFlag bool) error {
+	classicSnap := map[string]any{
+		"name":  "classic-snap",
+		"id":    s.AssertedSnapID("classic-snap"),
+		"modes": []any{"run"},
+	}
+	if classicFlag {
+		classicSnap["classic"] = "true"
+	}
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"store":        "my-store",
+		"base":         "core20",
+		"classic":      "true",
+		"distribution": "ubuntu",
+		"grade":        string(modelGrade),
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name": "core",
+				"id":   s.AssertedSnapID("core"),
+				"type": "core",
+			},
+			classicSnap,
+		},
+	})
+
+	// validity
+	c.Assert(model.Grade(), Equals, modelGrade)
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "core", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "classic-snap", "developerid")
+
+	s.opts.Label = "20221125"
+	_, _, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	return err
+}
+
+func (s *writerSuite) TestDownloadedCore20CheckClassicDangerous(c *C) {
+	err := s.testDownloadedCore20CheckClassic(c, asserts.ModelDangerous, false)
+	c.Check(err, IsNil)
+}
+
+func (s *writerSuite) TestDownloadedCore20CheckClassicSignedNoFlag(c *C) {
+	err := s.testDownloadedCore20CheckClassic(c, asserts.ModelSigned, false)
+	c.Check(err, ErrorMatches, `cannot use classic snap "classic-snap" with a model of grade higher than dangerous that does not allow it explicitly \(missing classic: true in snap stanza\)`)
+}
+
+func (s *writerSuite) TestDownloadedCore20CheckClassicSignedWithFlag(c *C) {
+	err := s.testDownloadedCore20CheckClassic(c, asserts.ModelSigned, true)
+	c.Check(err, IsNil)
+}
+
+func (s *writerSuite) setupValidationSets(c *C) {
+	valSetA, err := s.StoreSigning.Sign(asserts.ValidationSetType, map[string]any{
+		"type":         "validation-set",
+		"authority-id": "canonical",
+		"series":       "16",
+		"account-id":   "canonical",
+		"name":         "base-set",
+		"sequence":     "1",
+		"snaps": []any{
+			map[string]any{
+				"name":     "pc-kernel",
+				"id":       s.AssertedSnapID("pc-kernel"),
+				"presence": "required",
+				"revision": "7",
+			},
+			map[string]any{
+				"name":     "pc",
+				"id":       s.AssertedSnapID("pc"),
+				"presence": "required",
+				"revision": "7",
+			},
+		},
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	err = s.StoreSigning.Add(valSetA)
+	c.Check(err, IsNil)
+
+	valSetB, err := s.StoreSigning.Sign(asserts.ValidationSetType, map[string]any{
+		"type":         "validation-set",
+		"authority-id": "canonical",
+		"series":       "16",
+		"account-id":   "canonical",
+		"name":         "base-set",
+		"sequence":     "2",
+		"snaps": []any{
+			map[string]any{
+				"name":     "pc-kernel",
+				"id":       s.AssertedSnapID("pc-kernel"),
+				"presence": "required",
+				"revision": "1",
+			},
+			map[string]any{
+				"name":     "pc",
+				"id":       s.AssertedSnapID("pc"),
+				"presence": "required",
+				"revision": "1",
+			},
+		},
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	err = s.StoreSigning.Add(valSetB)
+	c.Check(err, IsNil)
+
+	valSetC, err := s.StoreSigning.Sign(asserts.ValidationSetType, map[string]any{
+		"type":         "validation-set",
+		"authority-id": "canonical",
+		"series":       "16",
+		"account-id":   "canonical",
+		"name":         "opt-set",
+		"sequence":     "2",
+		"snaps": []any{
+			map[string]any{
+				"name":     "my-snap",
+				"id":       "mysnapididididididididididididid",
+				"presence": "required",
+				"revision": "8",
+			},
+		},
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	err = s.StoreSigning.Add(valSetC)
+	c.Check(err, IsNil)
+}
+
+func (s *writerSuite) TestValidateValidationSetsCore20EnforcedInvalid(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core20",
+		"grade":        "dangerous",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			}},
+		"validation-sets": []any{
+			map[string]any{
+				"account-id": "canonical",
+				"name":       "base-set",
+				"sequence":   "1",
+				"mode":       "enforce",
+			},
+			map[string]any{
+				"account-id": "canonical",
+				"name":       "opt-set",
+				"mode":       "prefer-enforce",
+			},
+		},
+	})
+
+	// validity
+	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
+
+	// setup a few validation set assertions in store
+	s.setupValidationSets(c)
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+
+	s.opts.Label = "20191122"
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
+
+	localSnaps, err := w.LocalSnaps()
+	c.Assert(err, IsNil)
+	c.Assert(localSnaps, HasLen, 0)
+
+	for _, sn := range localSnaps {
+		_, _, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
+		c.Assert(errors.Is(err, &asserts.NotFoundError{}), Equals, true)
+		f, err := snapfile.Open(sn.Path)
+		c.Assert(err, IsNil)
+		info, err := snap.ReadInfoFromSnapFile(f, nil)
+		c.Assert(err, IsNil)
+		w.SetInfo(sn, info, nil)
+	}
+
+	err = w.InfoDerived()
+	c.Assert(err, IsNil)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Check(snaps, HasLen, 4)
+
+	for _, sn := range snaps {
+		channel := "latest/stable"
+		switch sn.SnapName() {
+		case "pc", "pc-kernel":
+			channel = "20"
+		}
+		c.Check(sn.Channel, Equals, channel)
+		s.fillDownloadedSnap(c, w, sn)
+	}
+
+	complete, err := w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	err = w.CheckValidationSets()
+	c.Assert(err, NotNil)
+	valErr := err.(*snapasserts.ValidationSetsValidationError)
+	// the snap missing only from the prefer-enforce set is a warning
+	c.Check(valErr.MissingSnaps, HasLen, 0)
+	c.Check(valErr.InvalidSnaps, HasLen, 0)
+	c.Check(valErr.WrongRevisionSnaps, DeepEquals, map[string]map[snap.Revision][]string{
+		"pc": {
+			snap.Revision{N: 7}: []string{"canonical/base-set"},
 		},
-		s.AssertedSnapID("cont-producer"): {
-			"links": map[string]any{
-				"contact": []any{"mailto:author@cont-producer.net"},
+		"pc-kernel": {
+			snap.Revision{N: 7}: []string{"canonical/base-set"},
+		},
+	})
+	c.Check(w.StructuredWarnings(), DeepEquals, []seedwriter.Warning{
+		{Kind: seedwriter.WarningValidationSet, SnapName: "my-snap", Message: `snap "my-snap" required by prefer-enforce validation sets (canonical/opt-set) is not part of the seed`},
+	})
+}
+
+func (s *writerSuite) TestValidateValidationSetsCore20PreferEnforceMissing(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core20",
+		"grade":        "dangerous",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			}},
+		"validation-sets": []any{
+			map[string]any{
+				"account-id": "canonical",
+				"name":       "opt-set",
+				"mode":       "prefer-enforce",
 			},
-			"contact": "mailto:author@cont-producer.net",
 		},
 	})
 
-	c.Check(filepath.Join(systemDir, "options.yaml"), testutil.FileAbsent)
+	s.setupValidationSets(c)
 
-	// validity check of seedtest helper
-	const usesSnapd = true
-	seedtest.ValidateSeed(c, s.opts.SeedDir, s.opts.Label, usesSnapd,
-		s.StoreSigning.Trusted)
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+
+	s.opts.Label = "20191122"
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	// my-snap is required only by the prefer-enforce set
+	err = w.CheckValidationSets()
+	c.Assert(err, IsNil)
+	c.Check(w.Warnings(), DeepEquals, []string{
+		`snap "my-snap" required by prefer-enforce validation sets (canonical/opt-set) is not part of the seed`,
+	})
 }
 
-func (s *writerSuite) TestCore20InvalidLabel(c *C) {
+func (s *writerSuite) TestValidateValidationSetsCore20EnforcedHappy(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
-		"store":        "my-store",
 		"base":         "core20",
+		"grade":        "dangerous",
 		"snaps": []any{
 			map[string]any{
 				"name":            "pc-kernel",
@@ -2519,71 +6005,261 @@ func (s *writerSuite) TestCore20InvalidLabel(c *C) {
 				"id":              s.AssertedSnapID("pc"),
 				"type":            "gadget",
 				"default-channel": "20",
+			}},
+		"validation-sets": []any{
+			map[string]any{
+				"account-id": "canonical",
+				"name":       "base-set",
+				// Enforce sequence 2 instead, which requires revision
+				// 1 of pc-kernel and pc
+				"sequence": "2",
+				"mode":     "enforce",
 			},
 		},
 	})
 
-	invalid := []string{
-		"-",
-		"a.b",
-		"aa--b",
+	// validity
+	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
+
+	// setup a few validation set assertions in store
+	s.setupValidationSets(c)
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+
+	s.opts.Label = "20191122"
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
+
+	localSnaps, err := w.LocalSnaps()
+	c.Assert(err, IsNil)
+	c.Assert(localSnaps, HasLen, 0)
+
+	for _, sn := range localSnaps {
+		_, _, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
+		c.Assert(errors.Is(err, &asserts.NotFoundError{}), Equals, true)
+		f, err := snapfile.Open(sn.Path)
+		c.Assert(err, IsNil)
+		info, err := snap.ReadInfoFromSnapFile(f, nil)
+		c.Assert(err, IsNil)
+		w.SetInfo(sn, info, nil)
+	}
+
+	err = w.InfoDerived()
+	c.Assert(err, IsNil)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Check(snaps, HasLen, 4)
+
+	for _, sn := range snaps {
+		channel := "latest/stable"
+		switch sn.SnapName() {
+		case "pc", "pc-kernel":
+			channel = "20"
+		}
+		c.Check(sn.Channel, Equals, channel)
+		s.fillDownloadedSnap(c, w, sn)
+	}
+
+	complete, err := w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	err = w.CheckValidationSets()
+	c.Assert(err, IsNil)
+
+	err = w.SeedSnaps(func(name, src, dst string) error {
+		return osutil.CopyFile(src, dst, 0)
+	})
+	c.Assert(err, IsNil)
+
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
+
+	// check seed
+	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
+	c.Check(systemDir, testutil.FilePresent)
+
+	// check snaps
+	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
+	c.Assert(err, IsNil)
+	c.Check(l, HasLen, 4)
+
+	// check model-etc contains the validation set assertion
+	assertsDir := filepath.Join(systemDir, "assertions")
+	modelEtc := seedtest.ReadAssertions(c, filepath.Join(assertsDir, "model-etc"))
+	c.Check(modelEtc, HasLen, 4)
+	var vsFound bool
+	for _, a := range modelEtc {
+		if a.Type() == asserts.ValidationSetType {
+			vsFound = true
+			vsa := a.(*asserts.ValidationSet)
+			c.Check(vsa.AccountID(), Equals, "canonical")
+			c.Check(vsa.Name(), Equals, "base-set")
+			c.Check(vsa.Sequence(), Equals, 2)
+		}
+	}
+	c.Check(vsFound, Equals, true)
+}
+
+func (s *writerSuite) TestValidateValidationSetsCore18EnforcedHappy(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core18",
+		"gadget":       "pc=18",
+		"kernel":       "pc-kernel=18",
+		"validation-sets": []any{
+			map[string]any{
+				"account-id": "canonical",
+				"name":       "base-set",
+				// Enforce sequence 2, which requires revision
+				// 1 of pc-kernel and pc
+				"sequence": "2",
+				"mode":     "enforce",
+			},
+		},
+	})
+
+	// validity of the core18 model
+	c.Assert(model.Grade(), Equals, asserts.ModelGradeUnset)
+
+	// setup a few validation set assertions in store
+	s.setupValidationSets(c)
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+
+	s.opts.Label = "20191122"
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
+
+	localSnaps, err := w.LocalSnaps()
+	c.Assert(err, IsNil)
+	c.Assert(localSnaps, HasLen, 0)
+
+	for _, sn := range localSnaps {
+		_, _, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
+		c.Assert(errors.Is(err, &asserts.NotFoundError{}), Equals, true)
+		f, err := snapfile.Open(sn.Path)
+		c.Assert(err, IsNil)
+		info, err := snap.ReadInfoFromSnapFile(f, nil)
+		c.Assert(err, IsNil)
+		w.SetInfo(sn, info, nil)
+	}
+
+	err = w.InfoDerived()
+	c.Assert(err, IsNil)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Check(snaps, HasLen, 4)
+
+	for _, sn := range snaps {
+		channel := "stable"
+		switch sn.SnapName() {
+		case "pc", "pc-kernel":
+			channel = "18"
+		}
+		c.Check(sn.Channel, Equals, channel)
+		s.fillDownloadedSnap(c, w, sn)
 	}
 
-	for _, inv := range invalid {
-		s.opts.Label = inv
-		w, err := seedwriter.New(model, s.opts)
-		c.Assert(w, IsNil)
-		c.Check(err, ErrorMatches, fmt.Sprintf(`invalid seed system label: %q`, inv))
-	}
+	complete, err := w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	err = w.CheckValidationSets()
+	c.Assert(err, IsNil)
+
+	err = w.SeedSnaps(func(name, src, dst string) error {
+		return osutil.CopyFile(src, dst, 0)
+	})
+	c.Assert(err, IsNil)
+
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
+
+	// check seed
+	seedYaml, err := seedwriter.InternalReadSeedYaml(filepath.Join(s.opts.SeedDir, "seed.yaml"))
+	c.Assert(err, IsNil)
+	c.Assert(seedYaml.Snaps, HasLen, 4)
+
+	// check snaps
+	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
+	c.Assert(err, IsNil)
+	c.Check(l, HasLen, 4)
+
+	// check assertions directory contains the validation set assertion
+	seedAssertsDir := filepath.Join(s.opts.SeedDir, "assertions")
+	p := filepath.Join(seedAssertsDir, fmt.Sprintf("16,canonical,%s,2.validation-set", "base-set"))
+	decl := seedtest.ReadAssertions(c, p)
+	c.Assert(decl, HasLen, 1)
+	c.Check(decl[0].Type(), Equals, asserts.ValidationSetType)
+	c.Check(decl[0].HeaderString("account-id"), Equals, "canonical")
+	c.Check(decl[0].HeaderString("name"), Equals, "base-set")
+	c.Check(decl[0].HeaderString("sequence"), Equals, "2")
 }
 
-func (s *writerSuite) TestDownloadedCore20CheckBase(c *C) {
+func (s *writerSuite) TestCheckValidateValidationSetsToEarly(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
-		"store":        "my-store",
-		"base":         "core20",
-		"snaps": []any{
-			map[string]any{
-				"name":            "pc-kernel",
-				"id":              s.AssertedSnapID("pc-kernel"),
-				"type":            "kernel",
-				"default-channel": "20",
-			},
-			map[string]any{
-				"name":            "pc",
-				"id":              s.AssertedSnapID("pc"),
-				"type":            "gadget",
-				"default-channel": "20",
-			},
+		"base":         "core18",
+		"gadget":       "pc=18",
+		"kernel":       "pc-kernel=18",
+		"validation-sets": []any{
 			map[string]any{
-				"name": "cont-producer",
-				"id":   s.AssertedSnapID("cont-producer"),
+				"account-id": "canonical",
+				"name":       "base-set",
+				// Enforce sequence 2, which requires revision
+				// 1 of pc-kernel and pc
+				"sequence": "2",
+				"mode":     "enforce",
 			},
 		},
 	})
 
-	// validity
-	c.Assert(model.Grade(), Equals, asserts.ModelSigned)
+	// validity of the core18 model
+	c.Assert(model.Grade(), Equals, asserts.ModelGradeUnset)
+
+	// setup a few validation set assertions in store
+	s.setupValidationSets(c)
 
 	s.makeSnap(c, "snapd", "")
-	s.makeSnap(c, "core20", "")
 	s.makeSnap(c, "core18", "")
-	s.makeSnap(c, "pc-kernel=20", "")
-	s.makeSnap(c, "pc=20", "")
-	s.makeSnap(c, "cont-producer", "developerid")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
 
-	s.opts.Label = "20191003"
-	_, _, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
-	c.Check(err, ErrorMatches, `cannot add snap "cont-producer" without also adding its base "core18" explicitly`)
+	s.opts.Label = "20191122"
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	// Perform the test after starting
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
+
+	err = w.CheckValidationSets()
+	c.Check(err, ErrorMatches, `internal error: seedwriter.Writer cannot check validation-sets before Downloaded signaled complete`)
 }
 
-func (s *writerSuite) TestDownloadedCore20CheckBaseModes(c *C) {
+func (s *writerSuite) TestManifestCorrectlyProduced(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
-		"store":        "my-store",
 		"base":         "core20",
+		"grade":        "dangerous",
 		"snaps": []any{
 			map[string]any{
 				"name":            "pc-kernel",
@@ -2596,41 +6272,81 @@ func (s *writerSuite) TestDownloadedCore20CheckBaseModes(c *C) {
 				"id":              s.AssertedSnapID("pc"),
 				"type":            "gadget",
 				"default-channel": "20",
-			},
-			map[string]any{
-				"name": "core18",
-				"id":   s.AssertedSnapID("core18"),
-				"type": "base",
-			},
-			map[string]any{
-				"name":  "cont-producer",
-				"id":    s.AssertedSnapID("cont-producer"),
-				"modes": []any{"run", "ephemeral"},
-			},
-		},
+			}},
 	})
-
-	// validity
-	c.Assert(model.Grade(), Equals, asserts.ModelSigned)
+	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
 
 	s.makeSnap(c, "snapd", "")
 	s.makeSnap(c, "core20", "")
-	s.makeSnap(c, "core18", "")
 	s.makeSnap(c, "pc-kernel=20", "")
 	s.makeSnap(c, "pc=20", "")
-	s.makeSnap(c, "cont-producer", "developerid")
 
-	s.opts.Label = "20191003"
-	_, _, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
-	c.Check(err, ErrorMatches, `cannot add snap "cont-producer" without also adding its base "core18" explicitly for all relevant modes \(run, ephemeral\)`)
+	s.opts.Label = "20191122"
+	s.opts.ManifestPath = path.Join(s.opts.SeedDir, "seed.manifest")
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
+
+	localSnaps, err := w.LocalSnaps()
+	c.Assert(err, IsNil)
+	c.Assert(localSnaps, HasLen, 0)
+
+	for _, sn := range localSnaps {
+		_, _, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
+		c.Assert(errors.Is(err, &asserts.NotFoundError{}), Equals, true)
+		f, err := snapfile.Open(sn.Path)
+		c.Assert(err, IsNil)
+		info, err := snap.ReadInfoFromSnapFile(f, nil)
+		c.Assert(err, IsNil)
+		w.SetInfo(sn, info, nil)
+	}
+
+	err = w.InfoDerived()
+	c.Assert(err, IsNil)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Check(snaps, HasLen, 4)
+
+	for _, sn := range snaps {
+		channel := "latest/stable"
+		switch sn.SnapName() {
+		case "pc", "pc-kernel":
+			channel = "20"
+		}
+		c.Check(sn.Channel, Equals, channel)
+		s.fillDownloadedSnap(c, w, sn)
+	}
+
+	complete, err := w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	err = w.SeedSnaps(func(name, src, dst string) error {
+		return osutil.CopyFile(src, dst, 0)
+	})
+	c.Assert(err, IsNil)
+
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
+
+	b, err := os.ReadFile(path.Join(s.opts.SeedDir, "seed.manifest"))
+	c.Assert(err, IsNil)
+	c.Check(string(b), Equals, `core20 1
+pc 1
+pc-kernel 1
+snapd 1
+`)
 }
 
-func (s *writerSuite) TestDownloadedCore20CheckBaseEphemeralOK(c *C) {
+func (s *writerSuite) TestManifestCorrectlyProducedWithComponents(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
-		"store":        "my-store",
 		"base":         "core20",
+		"grade":        "dangerous",
 		"snaps": []any{
 			map[string]any{
 				"name":            "pc-kernel",
@@ -2645,64 +6361,107 @@ func (s *writerSuite) TestDownloadedCore20CheckBaseEphemeralOK(c *C) {
 				"default-channel": "20",
 			},
 			map[string]any{
-				"name":  "core18",
-				"id":    s.AssertedSnapID("core18"),
-				"type":  "base",
-				"modes": []any{"ephemeral"},
-			},
-			map[string]any{
-				"name":  "cont-producer",
-				"id":    s.AssertedSnapID("cont-producer"),
-				"modes": []any{"recover"},
+				"name": "required20",
+				"id":   s.AssertedSnapID("required20"),
+				"components": map[string]any{
+					"comp2": "required",
+					"comp1": "required",
+				},
 			},
 		},
 	})
 
-	// validity
-	c.Assert(model.Grade(), Equals, asserts.ModelSigned)
-
 	s.makeSnap(c, "snapd", "")
 	s.makeSnap(c, "core20", "")
-	s.makeSnap(c, "core18", "")
 	s.makeSnap(c, "pc-kernel=20", "")
 	s.makeSnap(c, "pc=20", "")
-	s.makeSnap(c, "cont-producer", "developerid")
+	comRevs := map[string]snap.Revision{
+		"comp1": snap.R(22),
+		"comp2": snap.R(33),
+	}
+	s.MakeAssertedSnapWithComps(c, seedtest.SampleSnapYaml["required20"], nil,
+		snap.R(21), comRevs, "canonical", s.StoreSigning.Database)
 
-	s.opts.Label = "20191003"
-	_, _, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
-	c.Check(err, IsNil)
-}
+	s.opts.Label = "20191122"
+	s.opts.ManifestPath = path.Join(s.opts.SeedDir, "seed.manifest")
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
 
-func (s *writerSuite) TestDownloadedCore20CheckBaseCoreXX(c *C) {
-	s.makeSnap(c, "snapd", "")
-	s.makeSnap(c, "core20", "")
-	s.makeSnap(c, "pc-kernel=20", "")
-	s.makeSnap(c, "pc=20", "")
-	s.makeSnap(c, "core", "")
-	s.makeSnap(c, "required", "")
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
 
-	coreEnt := map[string]any{
-		"name": "core",
-		"id":   s.AssertedSnapID("core"),
-		"type": "core",
-	}
-	requiredEnt := map[string]any{
-		"name": "required",
-		"id":   s.AssertedSnapID("required"),
+	localSnaps, err := w.LocalSnaps()
+	c.Assert(err, IsNil)
+	c.Assert(localSnaps, HasLen, 0)
+
+	err = w.InfoDerived()
+	c.Assert(err, IsNil)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Check(snaps, HasLen, 5)
+
+	for _, sn := range snaps {
+		s.fillDownloadedSnap(c, w, sn)
 	}
 
-	tests := []struct {
-		snaps []any
-		err   string
-	}{
-		{[]any{coreEnt, requiredEnt}, ""},
-		{[]any{requiredEnt}, `cannot add snap "required" without also adding its base "core" explicitly`},
+	complete, err := w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	err = w.SeedSnaps(func(name, src, dst string) error {
+		return osutil.CopyFile(src, dst, 0)
+	})
+	c.Assert(err, IsNil)
+
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
+
+	b, err := os.ReadFile(path.Join(s.opts.SeedDir, "seed.manifest"))
+	c.Assert(err, IsNil)
+	c.Check(string(b), Equals, `core20 1
+pc 1
+pc-kernel 1
+required20 21
+required20+comp1 22
+required20+comp2 33
+snapd 1
+`)
+
+	// the grouped form can be read back
+	manifest, err := seedwriter.ReadManifest(path.Join(s.opts.SeedDir, "seed.manifest"))
+	c.Assert(err, IsNil)
+	c.Check(manifest.AllowedSnapRevision("required20"), Equals, snap.R(21))
+	c.Check(manifest.AllowedComponentRevision(naming.NewComponentRef("required20", "comp1")), Equals, snap.R(22))
+	c.Check(manifest.AllowedComponentRevision(naming.NewComponentRef("required20", "comp2")), Equals, snap.R(33))
+}
+
+// checkChecksumManifest checks that the checksum manifest lists
+// exactly the given seed blobs with their actual digests.
+func (s *writerSuite) checkChecksumManifest(c *C, relPaths []string) {
+	b, err := os.ReadFile(s.opts.ChecksumManifestPath)
+	c.Assert(err, IsNil)
+	var seen []string
+	for _, l := range strings.Split(strings.TrimSuffix(string(b), "\n"), "\n") {
+		digest, relPath, ok := strings.Cut(l, "  ")
+		c.Assert(ok, Equals, true, Commentf("bad line %q", l))
+		seen = append(seen, relPath)
+		dgst, _, err := osutil.FileDigest(filepath.Join(s.opts.SeedDir, relPath), crypto.SHA3_384)
+		c.Assert(err, IsNil)
+		c.Check(digest, Equals, fmt.Sprintf("%x", dgst), Commentf("digest mismatch for %s", relPath))
 	}
+	sort.Strings(seen)
+	sort.Strings(relPaths)
+	c.Check(seen, DeepEquals, relPaths)
+}
 
-	baseLabel := "20191003"
-	for idx, t := range tests {
-		s.opts.Label = fmt.Sprintf("%s%d", baseLabel, idx)
-		snaps := []any{
+func (s *writerSuite) TestChecksumManifestWithComponents(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core20",
+		"grade":        "dangerous",
+		"snaps": []any{
 			map[string]any{
 				"name":            "pc-kernel",
 				"id":              s.AssertedSnapID("pc-kernel"),
@@ -2715,32 +6474,103 @@ func (s *writerSuite) TestDownloadedCore20CheckBaseCoreXX(c *C) {
 				"type":            "gadget",
 				"default-channel": "20",
 			},
-		}
+			map[string]any{
+				"name": "required20",
+				"id":   s.AssertedSnapID("required20"),
+				"components": map[string]any{
+					"comp1": "required",
+					"comp2": "required",
+				},
+			},
+		},
+	})
 
-		snaps = append(snaps, t.snaps...)
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	comRevs := map[string]snap.Revision{
+		"comp1": snap.R(22),
+		"comp2": snap.R(33),
+	}
+	s.MakeAssertedSnapWithComps(c, seedtest.SampleSnapYaml["required20"], nil,
+		snap.R(21), comRevs, "canonical", s.StoreSigning.Database)
 
-		model := s.Brands.Model("my-brand", "my-model", map[string]any{
-			"display-name": "my model",
-			"architecture": "amd64",
-			"store":        "my-store",
-			"base":         "core20",
-			"snaps":        snaps,
-		})
+	s.opts.Label = "20191122"
+	s.opts.ChecksumManifestPath = filepath.Join(c.MkDir(), "seed.sha3-384")
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
 
-		_, _, err := s.upToDownloaded(c, model, s.fillMetaDownloadedSnap, s.fetchAsserts(c))
-		if t.err == "" {
-			c.Check(err, IsNil)
-		} else {
-			c.Check(err, ErrorMatches, t.err)
-		}
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
+
+	localSnaps, err := w.LocalSnaps()
+	c.Assert(err, IsNil)
+	c.Assert(localSnaps, HasLen, 0)
+
+	err = w.InfoDerived()
+	c.Assert(err, IsNil)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Check(snaps, HasLen, 5)
+
+	for _, sn := range snaps {
+		s.fillDownloadedSnap(c, w, sn)
 	}
+
+	complete, err := w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	err = w.SeedSnaps(func(name, src, dst string) error {
+		return osutil.CopyFile(src, dst, 0)
+	})
+	c.Assert(err, IsNil)
+
+	s.checkChecksumManifest(c, []string{
+		"snaps/snapd_1.snap",
+		"snaps/core20_1.snap",
+		"snaps/pc-kernel_1.snap",
+		"snaps/pc_1.snap",
+		"snaps/required20_21.snap",
+		"snaps/required20+comp1_22.comp",
+		"snaps/required20+comp2_33.comp",
+	})
 }
-func (s *writerSuite) TestDownloadedCore20MissingDefaultProviderModes(c *C) {
-	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+
+func (s *writerSuite) pinnedComponentsModel(c *C, comp1Rev string) *asserts.Model {
+	vs, err := s.StoreSigning.Sign(asserts.ValidationSetType, map[string]any{
+		"type":         "validation-set",
+		"authority-id": "canonical",
+		"series":       "16",
+		"account-id":   "canonical",
+		"name":         "comps-set",
+		"sequence":     "1",
+		"snaps": []any{
+			map[string]any{
+				"name":     "required20",
+				"id":       s.AssertedSnapID("required20"),
+				"presence": "required",
+				"revision": "21",
+				"components": map[string]any{
+					"comp1": map[string]any{
+						"presence": "required",
+						"revision": comp1Rev,
+					},
+				},
+			},
+		},
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	c.Assert(s.StoreSigning.Add(vs), IsNil)
+
+	return s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
-		"store":        "my-store",
 		"base":         "core20",
+		"grade":        "dangerous",
 		"snaps": []any{
 			map[string]any{
 				"name":            "pc-kernel",
@@ -2755,45 +6585,122 @@ func (s *writerSuite) TestDownloadedCore20MissingDefaultProviderModes(c *C) {
 				"default-channel": "20",
 			},
 			map[string]any{
-				"name":  "core18",
-				"id":    s.AssertedSnapID("core18"),
-				"type":  "base",
-				"modes": []any{"run", "ephemeral"},
-			},
-			map[string]any{
-				"name": "cont-producer",
-				"id":   s.AssertedSnapID("cont-producer"),
+				"name": "required20",
+				"id":   s.AssertedSnapID("required20"),
+				"components": map[string]any{
+					"comp1": "required",
+					"comp2": "required",
+				},
 			},
+		},
+		"validation-sets": []any{
 			map[string]any{
-				"name":  "cont-consumer",
-				"id":    s.AssertedSnapID("cont-consumer"),
-				"modes": []any{"recover"},
+				"account-id": "canonical",
+				"name":       "comps-set",
+				"sequence":   "1",
+				"mode":       "enforce",
 			},
 		},
 	})
+}
 
-	// validity
-	c.Assert(model.Grade(), Equals, asserts.ModelSigned)
-
+func (s *writerSuite) makePinnedComponentsSnaps(c *C) {
 	s.makeSnap(c, "snapd", "")
 	s.makeSnap(c, "core20", "")
-	s.makeSnap(c, "core18", "")
 	s.makeSnap(c, "pc-kernel=20", "")
 	s.makeSnap(c, "pc=20", "")
-	s.makeSnap(c, "cont-producer", "developerid")
-	s.makeSnap(c, "cont-consumer", "developerid")
+	s.MakeAssertedSnapWithComps(c, seedtest.SampleSnapYaml["required20"], nil,
+		snap.R(21), map[string]snap.Revision{
+			"comp1": snap.R(22),
+			"comp2": snap.R(33),
+		}, "canonical", s.StoreSigning.Database)
+}
 
-	s.opts.Label = "20191003"
+func (s *writerSuite) TestSnapsToDownloadPinnedComponentRevisions(c *C) {
+	s.makePinnedComponentsSnaps(c)
+	model := s.pinnedComponentsModel(c, "22")
+
+	s.opts.Label = "20191122"
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+	c.Assert(w.Start(s.db, s.rf), IsNil)
+	_, err = w.LocalSnaps()
+	c.Assert(err, IsNil)
+	c.Assert(w.InfoDerived(), IsNil)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 5)
+
+	var required20 *seedwriter.SeedSnap
+	for _, sn := range snaps {
+		if sn.SnapName() == "required20" {
+			required20 = sn
+		}
+	}
+	c.Assert(required20, NotNil)
+	pins := make(map[string]snap.Revision, len(required20.Components))
+	for _, comp := range required20.Components {
+		pins[comp.ComponentName] = comp.Revision
+	}
+	c.Check(pins, DeepEquals, map[string]snap.Revision{
+		"comp1": snap.R(22),
+		"comp2": {},
+	})
+
+	for _, sn := range snaps {
+		s.fillDownloadedSnap(c, w, sn)
+	}
+
+	complete, err := w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+	c.Assert(w.CheckValidationSets(), IsNil)
+
+	err = w.SeedSnaps(func(name, src, dst string) error {
+		return osutil.CopyFile(src, dst, 0)
+	})
+	c.Assert(err, IsNil)
+	c.Assert(w.WriteMeta(), IsNil)
+
+	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
+	c.Check(filepath.Join(systemDir, "model"), testutil.FilePresent)
+	c.Check(filepath.Join(s.opts.SeedDir, "snaps", "required20+comp1_22.comp"), testutil.FilePresent)
+	c.Check(filepath.Join(s.opts.SeedDir, "snaps", "required20+comp2_33.comp"), testutil.FilePresent)
+}
+
+func (s *writerSuite) TestDownloadedPinnedComponentRevisionMismatch(c *C) {
+	s.makePinnedComponentsSnaps(c)
+	model := s.pinnedComponentsModel(c, "23")
+
+	s.opts.Label = "20191122"
 	_, _, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
-	c.Check(err, ErrorMatches, `prerequisites need to be added explicitly for relevant mode recover: cannot use snap "cont-consumer": default provider "cont-producer" or any alternative provider for content "cont" is missing`)
+	c.Check(err, ErrorMatches, `cannot use component required20\+comp1 revision 22: pinned to revision 23`)
 }
 
-func (s *writerSuite) TestDownloadedCore20AlternativeProviderModes(c *C) {
+func (s *writerSuite) TestDownloadedPinnedComponentRevisionFromManifest(c *C) {
+	s.makePinnedComponentsSnaps(c)
+	model := s.pinnedComponentsModel(c, "22")
+
+	s.opts.Manifest = seedwriter.NewManifest()
+	seedwriter.MockManifestComponents(s.opts.Manifest, map[string]*seedwriter.ManifestComponentRevision{
+		"required20+comp2": {
+			Component: naming.NewComponentRef("required20", "comp2"),
+			Revision:  snap.R(34),
+		},
+	}, nil)
+
+	s.opts.Label = "20191122"
+	_, _, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	c.Check(err, ErrorMatches, `cannot use component required20\+comp2 revision 33: pinned to revision 34`)
+}
+
+func (s *writerSuite) TestManifestPreProvidedFailsMarkSeeding(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
-		"store":        "my-store",
 		"base":         "core20",
+		"grade":        "dangerous",
 		"snaps": []any{
 			map[string]any{
 				"name":            "pc-kernel",
@@ -2806,113 +6713,133 @@ func (s *writerSuite) TestDownloadedCore20AlternativeProviderModes(c *C) {
 				"id":              s.AssertedSnapID("pc"),
 				"type":            "gadget",
 				"default-channel": "20",
-			},
-			map[string]any{
-				"name":  "core18",
-				"id":    s.AssertedSnapID("core18"),
-				"type":  "base",
-				"modes": []any{"run", "ephemeral"},
-			},
-			map[string]any{
-				"name": "cont-producer",
-				"id":   s.AssertedSnapID("cont-producer"),
-			},
-			map[string]any{
-				"name":  "cont-consumer",
-				"id":    s.AssertedSnapID("cont-consumer"),
-				"modes": []any{"recover"},
-			},
-			map[string]any{
-				"name":  "alt-cont-producer",
-				"id":    s.AssertedSnapID("alt-cont-producer"),
-				"modes": []any{"recover"},
-			},
-		},
+			}},
 	})
-
-	// validity
-	c.Assert(model.Grade(), Equals, asserts.ModelSigned)
+	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
 
 	s.makeSnap(c, "snapd", "")
 	s.makeSnap(c, "core20", "")
-	s.makeSnap(c, "core18", "")
 	s.makeSnap(c, "pc-kernel=20", "")
 	s.makeSnap(c, "pc=20", "")
-	s.makeSnap(c, "cont-producer", "developerid")
-	s.makeSnap(c, "cont-consumer", "developerid")
-	s.makeSnap(c, "alt-cont-producer", "developerid")
 
-	s.opts.Label = "20191003"
-	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	s.opts.Manifest = seedwriter.MockManifest(map[string]*seedwriter.ManifestSnapRevision{
+		"core20": {
+			SnapName: "core20",
+			Revision: snap.R(20),
+		},
+	}, nil, nil, nil)
+
+	s.opts.Label = "20191122"
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
+
+	localSnaps, err := w.LocalSnaps()
+	c.Assert(err, IsNil)
+	c.Assert(localSnaps, HasLen, 0)
+
+	for _, sn := range localSnaps {
+		_, _, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
+		c.Assert(errors.Is(err, &asserts.NotFoundError{}), Equals, true)
+		f, err := snapfile.Open(sn.Path)
+		c.Assert(err, IsNil)
+		info, err := snap.ReadInfoFromSnapFile(f, nil)
+		c.Assert(err, IsNil)
+		w.SetInfo(sn, info, nil)
+	}
+
+	err = w.InfoDerived()
+	c.Assert(err, IsNil)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Check(snaps, HasLen, 4)
+
+	for _, sn := range snaps {
+		channel := "latest/stable"
+		switch sn.SnapName() {
+		case "pc", "pc-kernel":
+			channel = "20"
+		}
+		c.Check(sn.Channel, Equals, channel)
+		s.fillDownloadedSnap(c, w, sn)
+	}
+
+	complete, err := w.Downloaded(s.fetchAsserts(c))
 	c.Assert(err, IsNil)
 	c.Check(complete, Equals, true)
-	warns := w.Warnings()
-	c.Assert(warns, HasLen, 1)
-	c.Check(warns[0], Matches, `prerequisites for mode recover: snap "cont-consumer" requires a provider for content "cont", a candidate slot is available \(alt-cont-producer:serve-cont\) but not the default-provider, ensure a single auto-connection \(or possibly a connection\) is in-place`)
+
+	err = w.SeedSnaps(func(name, src, dst string) error {
+		return osutil.CopyFile(src, dst, 0)
+	})
+	c.Assert(err, ErrorMatches, `cannot record snap for manifest: snap "core20" \(1\) does not match the allowed revision 20`)
 }
 
-func (s *writerSuite) TestCore20NonDangerousDisallowedDevmodeSnaps(c *C) {
-
-	s.makeSnap(c, "my-devmode", "canonical")
+func (s *writerSuite) TestManifestPreProvidedFailsMarkSeedingComponent(c *C) {
+	model := s.appendModel()
 
-	model := s.Brands.Model("my-brand", "my-model", map[string]any{
-		"display-name": "my model",
-		"architecture": "amd64",
-		"store":        "my-store",
-		"base":         "core20",
-		"snaps": []any{
-			map[string]any{
-				"name":            "pc-kernel",
-				"id":              s.AssertedSnapID("pc-kernel"),
-				"type":            "kernel",
-				"default-channel": "20",
-			},
-			map[string]any{
-				"name":            "pc",
-				"id":              s.AssertedSnapID("pc"),
-				"type":            "gadget",
-				"default-channel": "20",
-			},
-			map[string]any{
-				"name": "my-devmode",
-				"id":   s.AssertedSnapID("my-devmode"),
-				"type": "app",
-			},
-		},
-	})
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	comRevs := map[string]snap.Revision{
+		"comp1": snap.R(22),
+		"comp2": snap.R(33),
+	}
+	s.MakeAssertedSnapWithComps(c, seedtest.SampleSnapYaml["required20"], nil,
+		snap.R(21), comRevs, "canonical", s.StoreSigning.Database)
 
-	s.opts.Label = "20191107"
+	manifest := seedwriter.NewManifest()
+	err := manifest.SetAllowedComponentRevision("required20", "comp1", snap.R(20))
+	c.Assert(err, IsNil)
+	s.opts.Manifest = manifest
 
+	s.opts.Label = "20191122"
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
-	err = w.Start(s.db, s.rf)
+	// the components of extra snaps are not pinned by the manifest
+	// when downloading
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{
+		{Name: "required20", Components: []seedwriter.OptionsComponent{
+			{Name: "comp1"}, {Name: "comp2"},
+		}},
+	})
 	c.Assert(err, IsNil)
 
-	localSnaps, err := w.LocalSnaps()
+	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
-	c.Assert(localSnaps, HasLen, 0)
-
-	snaps, err := w.SnapsToDownload()
-	c.Check(err, IsNil)
-	c.Assert(snaps, HasLen, 5)
 
-	c.Assert(snaps[4].SnapName(), Equals, "my-devmode")
-	sn := snaps[4]
+	for complete := false; !complete; {
+		snaps, err := w.SnapsToDownload()
+		c.Assert(err, IsNil)
+		for _, sn := range snaps {
+			s.doFillMetaDownloadedSnap(c, w, sn)
+			err := os.Rename(s.AssertedSnap(sn.SnapName()), sn.Path)
+			c.Assert(err, IsNil)
+			for _, seedComp := range sn.Components {
+				err := os.Rename(s.AssertedSnap(seedComp.String()), seedComp.Path)
+				c.Assert(err, IsNil)
+			}
+		}
+		complete, err = w.Downloaded(s.fetchAsserts(c))
+		c.Assert(err, IsNil)
+	}
 
-	info := s.AssertedSnapInfo(sn.SnapName())
-	c.Assert(info, NotNil, Commentf("%s not defined", sn.SnapName()))
-	err = w.SetInfo(sn, info, nil)
-	c.Assert(err, ErrorMatches, "cannot override channels, add devmode snaps, local snaps, or extra snaps/components with a model of grade higher than dangerous")
-	c.Check(sn.Info, Not(Equals), info)
+	err = w.SeedSnaps(func(name, src, dst string) error {
+		return osutil.CopyFile(src, dst, 0)
+	})
+	c.Assert(err, ErrorMatches, `cannot record component for manifest: component "required20\+comp1" \(22\) does not match the allowed revision 20`)
 }
 
-func (s *writerSuite) TestCore20NonDangerousDisallowedOptionsSnaps(c *C) {
+func (s *writerSuite) TestManifestPreProvidedSequenceNotMatchingModelSequence(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
-		"store":        "my-store",
 		"base":         "core20",
+		"grade":        "dangerous",
 		"snaps": []any{
 			map[string]any{
 				"name":            "pc-kernel",
@@ -2925,79 +6852,35 @@ func (s *writerSuite) TestCore20NonDangerousDisallowedOptionsSnaps(c *C) {
 				"id":              s.AssertedSnapID("pc"),
 				"type":            "gadget",
 				"default-channel": "20",
+			}},
+		"validation-sets": []any{
+			map[string]any{
+				"account-id": "canonical",
+				"name":       "base-set",
+				"sequence":   "2",
+				"mode":       "enforce",
 			},
 		},
 	})
+	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
 
-	pcFn := s.makeLocalSnap(c, "pc")
-
-	baseLabel := "20191107"
-
-	tests := []struct {
-		optSnap            *seedwriter.OptionsSnap
-		expectedErrVariant string
-	}{
-		{optSnap: &seedwriter.OptionsSnap{Name: "extra"}},
-		{optSnap: &seedwriter.OptionsSnap{Path: pcFn}},
-		{
-			optSnap:            &seedwriter.OptionsSnap{Name: "pc", Channel: "edge"},
-			expectedErrVariant: "cannot override channels with a model of grade higher than dangerous but --snap=<snap-name> is allowed to select optional snaps to include",
-		},
-	}
-
-	const expectedErr = `cannot override channels, add devmode snaps, local snaps, or extra snaps/components with a model of grade higher than dangerous`
-
-	for idx, t := range tests {
-		s.opts.Label = fmt.Sprintf("%s%d", baseLabel, idx)
-		w, err := seedwriter.New(model, s.opts)
-		c.Assert(err, IsNil)
-
-		err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{t.optSnap})
-		if err != nil {
-			if t.expectedErrVariant != "" {
-				c.Check(err, ErrorMatches, t.expectedErrVariant)
-			} else {
-				c.Check(err, ErrorMatches, expectedErr)
-			}
-			continue
-		}
-
-		err = w.Start(s.db, s.rf)
-		c.Assert(err, IsNil)
-
-		if t.optSnap.Path != "" {
-			localSnaps, err := w.LocalSnaps()
-			c.Assert(err, IsNil)
-			c.Assert(localSnaps, HasLen, 1)
-
-			for _, sn := range localSnaps {
-				si, _, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
-				if !errors.Is(err, &asserts.NotFoundError{}) {
-					c.Assert(err, IsNil)
-				}
-				f, err := snapfile.Open(sn.Path)
-				c.Assert(err, IsNil)
-				info, err := snap.ReadInfoFromSnapFile(f, si)
-				c.Assert(err, IsNil)
-				w.SetInfo(sn, info, nil)
-			}
+	s.opts.Manifest = seedwriter.NewManifest()
+	s.opts.Manifest.SetAllowedValidationSet("canonical", "base-set", 1, true)
 
-			err = w.InfoDerived()
-			c.Check(err, ErrorMatches, expectedErr)
-			continue
-		}
+	s.opts.Label = "20191122"
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
 
-		_, err = w.SnapsToDownload()
-		c.Check(err, ErrorMatches, expectedErr)
-	}
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, ErrorMatches, `cannot use sequence 1 of "canonical/base-set": model requires sequence 2`)
 }
 
-func (s *writerSuite) TestCore20NonDangerousNoChannelOverride(c *C) {
+func (s *writerSuite) TestManifestPreProvidedSequenceNotMatchingModelPinned(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
-		"store":        "my-store",
 		"base":         "core20",
+		"grade":        "dangerous",
 		"snaps": []any{
 			map[string]any{
 				"name":            "pc-kernel",
@@ -3010,42 +6893,32 @@ func (s *writerSuite) TestCore20NonDangerousNoChannelOverride(c *C) {
 				"id":              s.AssertedSnapID("pc"),
 				"type":            "gadget",
 				"default-channel": "20",
+			}},
+		"validation-sets": []any{
+			map[string]any{
+				"account-id": "canonical",
+				"name":       "base-set",
+				"mode":       "enforce",
 			},
 		},
 	})
+	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
 
-	s.opts.DefaultChannel = "stable"
-	s.opts.Label = "20191107"
-	w, err := seedwriter.New(model, s.opts)
-	c.Assert(w, IsNil)
-	c.Check(err, ErrorMatches, `cannot override channels, add devmode snaps, local snaps, or extra snaps/components with a model of grade higher than dangerous`)
-}
+	s.opts.Manifest = seedwriter.NewManifest()
+	s.opts.Manifest.SetAllowedValidationSet("canonical", "base-set", 1, true)
 
-func (s *writerSuite) TestSeedSnapsWriteMetaCore20LocalSnaps(c *C) {
-	withComps := false
-	s.testSeedSnapsWriteMetaCore20LocalSnaps(c, withComps)
-}
+	s.opts.Label = "20191122"
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
 
-func (s *writerSuite) TestSeedSnapsWriteMetaCore20LocalSnapsWithComps(c *C) {
-	withComps := true
-	s.testSeedSnapsWriteMetaCore20LocalSnaps(c, withComps)
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, ErrorMatches, `pinning of "canonical/base-set" is not allowed by the model`)
 }
 
-func (s *writerSuite) testSeedSnapsWriteMetaCore20LocalSnaps(c *C, withComps bool) {
-	// add store assertion
-	storeAs, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
-		"store":       "my-store",
-		"operator-id": "canonical",
-		"timestamp":   time.Now().UTC().Format(time.RFC3339),
-	}, nil, "")
-	c.Assert(err, IsNil)
-	err = s.StoreSigning.Add(storeAs)
-	c.Assert(err, IsNil)
-
+func (s *writerSuite) TestValidateValidationSetsManifestsCorrectly(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
-		"store":        "my-store",
 		"base":         "core20",
 		"grade":        "dangerous",
 		"snaps": []any{
@@ -3060,10 +6933,12 @@ func (s *writerSuite) testSeedSnapsWriteMetaCore20LocalSnaps(c *C, withComps boo
 				"id":              s.AssertedSnapID("pc"),
 				"type":            "gadget",
 				"default-channel": "20",
-			},
+			}},
+		"validation-sets": []any{
 			map[string]any{
-				"name": "required20",
-				"id":   s.AssertedSnapID("required20"),
+				"account-id": "canonical",
+				"name":       "base-set",
+				"mode":       "enforce",
 			},
 		},
 	})
@@ -3071,17 +6946,26 @@ func (s *writerSuite) testSeedSnapsWriteMetaCore20LocalSnaps(c *C, withComps boo
 	// validity
 	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
 
+	// setup a few validation set assertions in store
+	s.setupValidationSets(c)
+
 	s.makeSnap(c, "snapd", "")
 	s.makeSnap(c, "core20", "")
-	s.makeSnap(c, "pc-kernel=20", "")
-	s.makeSnap(c, "pc=20", "")
-	requiredFn := s.makeLocalSnap(c, "required20")
 
-	s.opts.Label = "20191030"
-	w, err := seedwriter.New(model, s.opts)
-	c.Assert(err, IsNil)
+	// The first sequence of base-set requires revision 7 of
+	// the snaps
+	s.MakeAssertedSnap(c, snapYaml["pc-kernel=20"], snapFiles["pc-kernel=20"], snap.R(7), "canonical", s.StoreSigning.Database)
+	s.MakeAssertedSnap(c, snapYaml["pc=20"], snapFiles["pc=20"], snap.R(7), "canonical", s.StoreSigning.Database)
 
-	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Path: requiredFn}})
+	// Set up the manifest we need, and specifically ask for sequence
+	// 1 of the base-set, to avoid getting the newest.
+	manifest := seedwriter.NewManifest()
+	manifest.SetAllowedValidationSet("canonical", "base-set", 1, false)
+	s.opts.Manifest = manifest
+	s.opts.ManifestPath = path.Join(s.opts.SeedDir, "seed.manifest")
+
+	s.opts.Label = "20191122"
+	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
 	err = w.Start(s.db, s.rf)
@@ -3089,36 +6973,16 @@ func (s *writerSuite) testSeedSnapsWriteMetaCore20LocalSnaps(c *C, withComps boo
 
 	localSnaps, err := w.LocalSnaps()
 	c.Assert(err, IsNil)
-	c.Assert(localSnaps, HasLen, 1)
+	c.Assert(localSnaps, HasLen, 0)
 
-	var pathComp1, pathComp2 string
 	for _, sn := range localSnaps {
 		_, _, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
-		c.Assert(errors.Is(err, &asserts.NotFoundError{}), Equals, true)
-		f, err := snapfile.Open(sn.Path)
-		c.Assert(err, IsNil)
-		info, err := snap.ReadInfoFromSnapFile(f, nil)
-		c.Assert(err, IsNil)
-		seedComps := map[string]*seedwriter.SeedComponent{}
-		if withComps {
-			cref1 := naming.NewComponentRef("required20", "comp1")
-			cinfo1 := snap.NewComponentInfo(cref1, snap.StandardComponent, "1.5", "", "", "", nil)
-			pathComp1 = s.makeLocalComponent(c, "required20+comp1")
-			cref2 := naming.NewComponentRef("required20", "comp2")
-			cinfo2 := snap.NewComponentInfo(cref2, snap.StandardComponent, "", "", "", "", nil)
-			pathComp2 = s.makeLocalComponent(c, "required20+comp2")
-			seedComps["comp1"] = &seedwriter.SeedComponent{
-				ComponentRef: cref1,
-				Path:         pathComp1,
-				Info:         cinfo1,
-			}
-			seedComps["comp2"] = &seedwriter.SeedComponent{
-				ComponentRef: cref2,
-				Path:         pathComp2,
-				Info:         cinfo2,
-			}
-		}
-		c.Assert(w.SetInfo(sn, info, seedComps), IsNil)
+		c.Assert(errors.Is(err, &asserts.NotFoundError{}), Equals, true)
+		f, err := snapfile.Open(sn.Path)
+		c.Assert(err, IsNil)
+		info, err := snap.ReadInfoFromSnapFile(f, nil)
+		c.Assert(err, IsNil)
+		w.SetInfo(sn, info, nil)
 	}
 
 	err = w.InfoDerived()
@@ -3129,9 +6993,6 @@ func (s *writerSuite) testSeedSnapsWriteMetaCore20LocalSnaps(c *C, withComps boo
 	c.Check(snaps, HasLen, 4)
 
 	for _, sn := range snaps {
-		// check the used channel at this level because in the
-		// non-dangerous case is not written anywhere (it
-		// reflects the model or default)
 		channel := "latest/stable"
 		switch sn.SnapName() {
 		case "pc", "pc-kernel":
@@ -3145,11 +7006,12 @@ func (s *writerSuite) testSeedSnapsWriteMetaCore20LocalSnaps(c *C, withComps boo
 	c.Assert(err, IsNil)
 	c.Check(complete, Equals, true)
 
-	copySnap := func(name, src, dst string) error {
-		return osutil.CopyFile(src, dst, 0)
-	}
+	err = w.CheckValidationSets()
+	c.Assert(err, IsNil)
 
-	err = w.SeedSnaps(copySnap)
+	err = w.SeedSnaps(func(name, src, dst string) error {
+		return osutil.CopyFile(src, dst, 0)
+	})
 	c.Assert(err, IsNil)
 
 	err = w.WriteMeta()
@@ -3159,151 +7021,127 @@ func (s *writerSuite) testSeedSnapsWriteMetaCore20LocalSnaps(c *C, withComps boo
 	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
 	c.Check(systemDir, testutil.FilePresent)
 
-	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
-	c.Assert(err, IsNil)
-	c.Check(l, HasLen, 4)
-
-	// local unasserted snap/component were put in system snaps dir
-	c.Check(filepath.Join(systemDir, "snaps", "required20_1.0.snap"), testutil.FilePresent)
-	if withComps {
-		c.Check(filepath.Join(systemDir, "snaps", "required20+comp1_1.5.comp"), testutil.FilePresent)
-		// Note that the component version is here the one for the snap
-		// as it was not specified in the component itself.
-		c.Check(filepath.Join(systemDir, "snaps", "required20+comp2_1.0.comp"), testutil.FilePresent)
-	}
+	// check that model-etc contains the correct validation-set assert
+	seedAssertsDir := filepath.Join(systemDir, "assertions")
+	c.Check(filepath.Join(seedAssertsDir, "model-etc"), testutil.FileContains, `type: validation-set
+authority-id: canonical
+series: 16
+account-id: canonical
+name: base-set
+sequence: 1`)
 
-	options20, err := seedwriter.InternalReadOptions20(filepath.Join(systemDir, "options.yaml"))
+	// verify that the manifest was correctly produced, now that
+	// the manifest is tracking validation-sets, then we should not
+	// see pc/pc-kernel in the manifest, instead it should just show
+	// the validation-set tracking those.
+	m, err := os.ReadFile(s.opts.ManifestPath)
 	c.Assert(err, IsNil)
-
-	var compOpts []internal.Component20
-	if withComps {
-		compOpts = []internal.Component20{
-			{
-				Name:       "comp1",
-				Unasserted: "required20+comp1_1.5.comp",
-			},
-			{
-				Name:       "comp2",
-				Unasserted: "required20+comp2_1.0.comp",
-			},
-		}
-	}
-	c.Check(options20.Snaps, DeepEquals, []*seedwriter.InternalSnap20{
-		{
-			Name:       "required20",
-			SnapID:     s.AssertedSnapID("required20"),
-			Unasserted: "required20_1.0.snap",
-			Components: compOpts,
-		},
-	})
+	c.Check(string(m), Equals, `canonical/base-set 1
+core20 1
+snapd 1
+`)
 }
 
-func (s *writerSuite) TestSetComponentOptionsBad(c *C) {
-	// add store assertion
-	storeAs, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
-		"store":       "my-store",
-		"operator-id": "canonical",
-		"timestamp":   time.Now().UTC().Format(time.RFC3339),
-	}, nil, "")
-	c.Assert(err, IsNil)
-	err = s.StoreSigning.Add(storeAs)
-	c.Assert(err, IsNil)
-
+func (s *writerSuite) TestOptionalComponentNotIncluded(c *C) {
+	comps := map[string]any{
+		"comp1": "required",
+		"comp2": "optional",
+	}
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
 		"store":        "my-store",
-		"base":         "core20",
-		"grade":        "dangerous",
+		"base":         "core24",
 		"snaps": []any{
 			map[string]any{
 				"name":            "pc-kernel",
 				"id":              s.AssertedSnapID("pc-kernel"),
 				"type":            "kernel",
-				"default-channel": "20",
+				"default-channel": "24",
 			},
 			map[string]any{
 				"name":            "pc",
 				"id":              s.AssertedSnapID("pc"),
 				"type":            "gadget",
-				"default-channel": "20",
+				"default-channel": "24",
 			},
 			map[string]any{
-				"name": "required20",
-				"id":   s.AssertedSnapID("required20"),
-				"components": map[string]any{
-					"comp1": "required",
-					"comp2": "optional",
-				},
+				"name":       "required20",
+				"id":         s.AssertedSnapID("required20"),
+				"components": comps,
 			},
 		},
 	})
 
-	// validity
-	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
+	// No options
+	s.opts.Label = "20240712"
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
 
-	requiredFn := s.makeLocalSnap(c, "required20")
-	pathComp1 := s.makeLocalComponent(c, "required20+comp1")
-	s.opts.Label = "20240630"
+	err = w.SetOptionsSnaps(nil)
+	c.Assert(err, IsNil)
 
-	for i, tc := range []struct {
-		comps []seedwriter.OptionsComponent
-		err   string
-	}{
-		{
-			comps: []seedwriter.OptionsComponent{
-				{Name: "comp1", Path: "comp1_25.comp"},
-			},
-			err: `cannot specify both name and path for component "comp1"`,
-		},
-		{
-			comps: []seedwriter.OptionsComponent{
-				{Name: "comp_1", Path: ""},
-			},
-			err: `invalid snap name: "comp_1"`,
-		},
-		{
-			comps: []seedwriter.OptionsComponent{
-				{Name: "comp1", Path: ""},
-			},
-			err: "",
-		},
-		{
-			comps: []seedwriter.OptionsComponent{
-				{Name: "", Path: "comp1_25.snap"},
-			},
-			err: `local option component "comp1_25.snap" does not end in .comp`,
-		},
-		{
-			comps: []seedwriter.OptionsComponent{
-				{Name: "", Path: "comp1_25.comp"},
-			},
-			err: `local option component "comp1_25.comp" does not exist`,
-		},
-		{
-			comps: []seedwriter.OptionsComponent{
-				{Name: "", Path: pathComp1},
-			},
-			err: "",
-		},
-	} {
-		c.Logf("test %d", i)
-		w, err := seedwriter.New(model, s.opts)
-		c.Assert(err, IsNil)
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
 
-		err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{
-			Path:       requiredFn,
-			Components: tc.comps,
-		}})
-		if tc.err == "" {
-			c.Check(err, IsNil)
-		} else {
-			c.Check(err.Error(), Equals, tc.err)
-		}
-	}
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Check(snaps, HasLen, 5)
+	cref1 := naming.NewComponentRef("required20", "comp1")
+	c.Check(snaps[4].Components, DeepEquals, []seedwriter.SeedComponent{{
+		ComponentRef: cref1,
+	}})
+
+	// Options contains the already required snap
+	s.opts.Label = "20240713"
+	w, err = seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{
+		Name:       "required20",
+		Components: []seedwriter.OptionsComponent{{Name: "comp1"}},
+	}})
+	c.Assert(err, IsNil)
+
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
+
+	snaps, err = w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Check(snaps, HasLen, 5)
+	c.Check(snaps[4].Components, DeepEquals, []seedwriter.SeedComponent{{
+		ComponentRef: cref1,
+	}})
+
+	// Ask for optional component to be included
+	s.opts.Label = "20240714"
+	w, err = seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{
+		Name:       "required20",
+		Components: []seedwriter.OptionsComponent{{Name: "comp2"}},
+	}})
+	c.Assert(err, IsNil)
+
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
+
+	snaps, err = w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Check(snaps, HasLen, 5)
+	cref2 := naming.NewComponentRef("required20", "comp2")
+	compsSl := snaps[4].Components
+	sort.Slice(compsSl, func(i, j int) bool {
+		return compsSl[i].ComponentName < compsSl[j].ComponentName
+	})
+	c.Check(compsSl, DeepEquals, []seedwriter.SeedComponent{
+		{ComponentRef: cref1},
+		{ComponentRef: cref2},
+	})
 }
 
-func (s *writerSuite) TestSeedSnapsWriteMetaCore20ChannelOverrides(c *C) {
+func (s *writerSuite) TestSeedSnapsWriteMetaCore20BadLocalComps(c *C) {
 	// add store assertion
 	storeAs, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
 		"store":       "my-store",
@@ -3347,89 +7185,60 @@ func (s *writerSuite) TestSeedSnapsWriteMetaCore20ChannelOverrides(c *C) {
 	s.makeSnap(c, "core20", "")
 	s.makeSnap(c, "pc-kernel=20", "")
 	s.makeSnap(c, "pc=20", "")
-	s.makeSnap(c, "required20", "developerid")
+	requiredFn := s.makeLocalSnap(c, "required20")
 
 	s.opts.Label = "20191030"
-	s.opts.DefaultChannel = "candidate"
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
-	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "pc", Channel: "edge"}})
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Path: requiredFn}})
 	c.Assert(err, IsNil)
 
 	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
 
-	snaps, err := w.SnapsToDownload()
-	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 5)
-
-	for _, sn := range snaps {
-		s.fillDownloadedSnap(c, w, sn)
-	}
-
-	complete, err := w.Downloaded(s.fetchAsserts(c))
-	c.Assert(err, IsNil)
-	c.Check(complete, Equals, true)
-
-	err = w.SeedSnaps(nil)
-	c.Assert(err, IsNil)
-
-	err = w.WriteMeta()
-	c.Assert(err, IsNil)
-
-	// check seed
-	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
-	c.Check(systemDir, testutil.FilePresent)
-
-	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
+	localSnaps, err := w.LocalSnaps()
 	c.Assert(err, IsNil)
-	c.Check(l, HasLen, 5)
+	c.Assert(localSnaps, HasLen, 1)
 
-	options20, err := seedwriter.InternalReadOptions20(filepath.Join(systemDir, "options.yaml"))
+	sn := localSnaps[0]
+	_, _, err = seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
+	c.Assert(errors.Is(err, &asserts.NotFoundError{}), Equals, true)
+	f, err := snapfile.Open(sn.Path)
+	c.Assert(err, IsNil)
+	info, err := snap.ReadInfoFromSnapFile(f, nil)
 	c.Assert(err, IsNil)
 
-	c.Check(options20.Snaps, DeepEquals, []*seedwriter.InternalSnap20{
-		{
-			Name:    "snapd",
-			SnapID:  s.AssertedSnapID("snapd"), // inferred
-			Channel: "latest/candidate",
-		},
-		{
-			Name:    "pc-kernel",
-			SnapID:  s.AssertedSnapID("pc-kernel"),
-			Channel: "20/candidate",
-		},
-		{
-			Name:    "core20",
-			SnapID:  s.AssertedSnapID("core20"), // inferred
-			Channel: "latest/candidate",
-		},
-		{
-			Name:    "pc",
-			SnapID:  s.AssertedSnapID("pc"),
-			Channel: "20/edge",
-		},
-		{
-			Name:    "required20",
-			SnapID:  s.AssertedSnapID("required20"),
-			Channel: "latest/candidate",
-		},
-	})
+	seedComps := map[string]*seedwriter.SeedComponent{}
+	cref1 := naming.NewComponentRef("required20", "comp-undefined")
+	cinfo1 := snap.NewComponentInfo(cref1, snap.StandardComponent, "1.0", "", "", "", nil)
+	seedComps["comp-undefined"] = &seedwriter.SeedComponent{
+		ComponentRef: cref1,
+		Path:         "/some/path/file.comp",
+		Info:         cinfo1,
+	}
+	c.Assert(w.SetInfo(sn, info, seedComps), ErrorMatches,
+		`component comp-undefined is not defined by snap required20`)
+
+	seedComps = map[string]*seedwriter.SeedComponent{}
+	cref1 = naming.NewComponentRef("required20", "comp1")
+	cinfo1 = snap.NewComponentInfo(cref1, snap.KernelModulesComponent, "1.0", "", "", "", nil)
+	seedComps["comp1"] = &seedwriter.SeedComponent{
+		ComponentRef: cref1,
+		Path:         "/some/path/file.comp",
+		Info:         cinfo1,
+	}
+	c.Assert(w.SetInfo(sn, info, seedComps), ErrorMatches,
+		`component comp1 has type kernel-modules while snap required20 defines type standard for it`)
 }
 
-func (s *writerSuite) TestSeedSnapsWriteMetaCore20ModelOverrideSnapd(c *C) {
+func (s *writerSuite) TestSetInfoModelRequiredComponentNotDefined(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
 		"base":         "core20",
+		"grade":        "dangerous",
 		"snaps": []any{
-			map[string]any{
-				"name":            "snapd",
-				"id":              s.AssertedSnapID("snapd"),
-				"type":            "snapd",
-				"default-channel": "latest/edge",
-			},
 			map[string]any{
 				"name":            "pc-kernel",
 				"id":              s.AssertedSnapID("pc-kernel"),
@@ -3441,532 +7250,539 @@ func (s *writerSuite) TestSeedSnapsWriteMetaCore20ModelOverrideSnapd(c *C) {
 				"id":              s.AssertedSnapID("pc"),
 				"type":            "gadget",
 				"default-channel": "20",
-			}},
+			},
+			map[string]any{
+				"name": "required20",
+				"id":   s.AssertedSnapID("required20"),
+				"components": map[string]any{
+					"comp1":          "required",
+					"comp-undefined": "required",
+					"comp-optional":  "optional",
+				},
+			},
+		},
 	})
 
-	// validity
-	c.Assert(model.Grade(), Equals, asserts.ModelSigned)
-
 	s.makeSnap(c, "snapd", "")
 	s.makeSnap(c, "core20", "")
 	s.makeSnap(c, "pc-kernel=20", "")
 	s.makeSnap(c, "pc=20", "")
+	s.MakeAssertedSnapWithComps(c, seedtest.SampleSnapYaml["required20"], nil,
+		snap.R(21), map[string]snap.Revision{"comp1": snap.R(22), "comp2": snap.R(33)}, "canonical", s.StoreSigning.Database)
 
-	s.opts.Label = "20191121"
+	// store snap
+	s.opts.Label = "20191030"
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
 	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
 
-	snaps, err := w.SnapsToDownload()
+	localSnaps, err := w.LocalSnaps()
 	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 4)
+	c.Assert(localSnaps, HasLen, 0)
 
-	for _, sn := range snaps {
-		// check the used channel at this level because in the
-		// non-dangerous case is not written anywhere (it
-		// reflects the model or default)
-		channel := "latest/stable"
-		switch sn.SnapName() {
-		case "snapd":
-			channel = "latest/edge"
-		case "pc", "pc-kernel":
-			channel = "20"
-		}
-		c.Check(sn.Channel, Equals, channel)
-		s.fillDownloadedSnap(c, w, sn)
-	}
+	err = w.InfoDerived()
+	c.Assert(err, IsNil)
 
-	complete, err := w.Downloaded(s.fetchAsserts(c))
+	snaps, err := w.SnapsToDownload()
 	c.Assert(err, IsNil)
-	c.Check(complete, Equals, true)
+	c.Assert(snaps, HasLen, 5)
+	sn := snaps[4]
+	c.Assert(sn.SnapName(), Equals, "required20")
+	err = w.SetInfo(sn, s.AssertedSnapInfo("required20"), nil)
+	c.Check(err, ErrorMatches, `required component "comp-undefined" is not defined by snap "required20"`)
 
-	err = w.SeedSnaps(nil)
+	// local snap
+	requiredFn := s.makeLocalSnap(c, "required20")
+
+	s.opts.Label = "20191031"
+	w, err = seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
-	err = w.WriteMeta()
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Path: requiredFn}})
 	c.Assert(err, IsNil)
 
-	// check seed
-	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
-	c.Check(systemDir, testutil.FilePresent)
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
 
-	// check the snaps are in place
-	for _, name := range []string{"snapd", "pc-kernel", "core20", "pc"} {
-		info := s.AssertedSnapInfo(name)
+	localSnaps, err = w.LocalSnaps()
+	c.Assert(err, IsNil)
+	c.Assert(localSnaps, HasLen, 1)
 
-		fn := info.Filename()
-		p := filepath.Join(s.opts.SeedDir, "snaps", fn)
-		c.Check(p, testutil.FilePresent)
-	}
+	sn = localSnaps[0]
+	f, err := snapfile.Open(sn.Path)
+	c.Assert(err, IsNil)
+	info, err := snap.ReadInfoFromSnapFile(f, nil)
+	c.Assert(err, IsNil)
+	c.Assert(w.SetInfo(sn, info, nil), IsNil)
 
-	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
+	err = w.InfoDerived()
 	c.Assert(err, IsNil)
-	c.Check(l, HasLen, 4)
 
-	c.Check(filepath.Join(systemDir, "extra-snaps"), testutil.FileAbsent)
-	c.Check(filepath.Join(systemDir, "options.yaml"), testutil.FileAbsent)
+	// local snaps are matched with the model only now
+	_, err = w.SnapsToDownload()
+	c.Check(err, ErrorMatches, `required component "comp-undefined" is not defined by snap "required20"`)
 }
 
-func (s *writerSuite) TestSnapsToDownloadCore20OptionalSnaps(c *C) {
+func (s *writerSuite) TestVerifySnapBootstrapCompatibility(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
-		"base":         "core20",
+		"store":        "my-store",
+		"base":         "core24",
 		"snaps": []any{
 			map[string]any{
 				"name":            "pc-kernel",
 				"id":              s.AssertedSnapID("pc-kernel"),
 				"type":            "kernel",
-				"default-channel": "20",
+				"default-channel": "24/stable",
 			},
 			map[string]any{
 				"name":            "pc",
 				"id":              s.AssertedSnapID("pc"),
 				"type":            "gadget",
-				"default-channel": "20",
+				"default-channel": "24/stable",
 			},
 			map[string]any{
-				"name": "core18",
-				"id":   s.AssertedSnapID("core18"),
-				"type": "base",
+				"name":            "snapd",
+				"id":              s.AssertedSnapID("snapd"),
+				"type":            "snapd",
+				"default-channel": "latest/stable",
 			},
 			map[string]any{
-				"name":     "optional20-a",
-				"id":       s.AssertedSnapID("optional20-a"),
-				"presence": "optional",
+				"name":            "core24",
+				"id":              s.AssertedSnapID("core24"),
+				"type":            "base",
+				"default-channel": "latest/stable",
 			},
-			map[string]any{
-				"name":     "optional20-b",
-				"id":       s.AssertedSnapID("optional20-b"),
-				"presence": "optional",
-			}},
+		},
 	})
 
-	// validity
-	c.Assert(model.Grade(), Equals, asserts.ModelSigned)
-
-	s.makeSnap(c, "snapd", "")
-	s.makeSnap(c, "core20", "")
-	s.makeSnap(c, "core18", "")
-	s.makeSnap(c, "pc-kernel=20", "")
-	s.makeSnap(c, "pc=20", "")
-	s.makeSnap(c, "optional20-a", "developerid")
-	s.makeSnap(c, "optional20-b", "developerid")
+	s.opts.Label = "20250220"
 
-	s.opts.Label = "20191122"
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
-	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "optional20-b"}})
-	c.Assert(err, IsNil)
+	newSnapd := `VERSION=2.68`
+	oldSnapd := `VERSION=2.67+git123`
+
+	snapdFiles := [][]string{
+		{"/usr/lib/snapd/info", newSnapd},
+	}
+	kernelFiles := [][]string{
+		{"/snapd-info", oldSnapd},
+	}
+
+	s.MakeAssertedSnap(c, snapYaml["snapd"], snapdFiles, snap.R(1), "canonical", s.StoreSigning.Database)
+	s.MakeAssertedSnap(c, snapYaml["pc-kernel"], kernelFiles, snap.R(1), "canonical", s.StoreSigning.Database)
+	s.makeSnap(c, "core24", "")
+	s.makeSnap(c, "pc", "")
 
 	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
 
 	snaps, err := w.SnapsToDownload()
 	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 6)
-	c.Check(snaps[5].SnapName(), Equals, "optional20-b")
+	c.Check(snaps, HasLen, 4)
+
+	for _, sn := range snaps {
+		s.fillDownloadedSnap(c, w, sn)
+	}
+
+	err = w.VerifySnapBootstrapCompatibility()
+	c.Check(err, ErrorMatches, `snapd 2.68[+] is not compatible with a kernel containing snapd prior to 2.68`)
 }
 
-func (s *writerSuite) TestSeedSnapsWriteMetaCore20ExtraSnaps(c *C) {
-	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+func (s *writerSuite) trackAlignmentModel(base, kernelChannel, gadgetChannel string) *asserts.Model {
+	return s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
-		"base":         "core20",
+		"base":         base,
 		"grade":        "dangerous",
 		"snaps": []any{
 			map[string]any{
 				"name":            "pc-kernel",
 				"id":              s.AssertedSnapID("pc-kernel"),
 				"type":            "kernel",
-				"default-channel": "20",
+				"default-channel": kernelChannel,
 			},
 			map[string]any{
 				"name":            "pc",
 				"id":              s.AssertedSnapID("pc"),
 				"type":            "gadget",
-				"default-channel": "20",
-			},
-			map[string]any{
-				"name": "component-test",
-				"id":   s.AssertedSnapID("component-test"),
+				"default-channel": gadgetChannel,
 			},
 		},
 	})
+}
 
-	// validity
-	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
+func (s *writerSuite) TestEnforceTrackAlignmentAligned(c *C) {
+	s.opts.EnforceTrackAlignment = true
 
-	s.makeSnap(c, "snapd", "")
-	s.makeSnap(c, "core20", "")
-	s.makeSnap(c, "pc-kernel=20", "")
-	s.makeSnap(c, "pc=20", "")
-	s.makeSnap(c, "core18", "")
-	s.makeSnap(c, "cont-producer", "developerid")
-	contConsumerFn := s.makeLocalSnap(c, "cont-consumer")
-	comRevs := map[string]snap.Revision{
-		"comp1": snap.R(22),
-		"comp2": snap.R(33),
+	for i, t := range []struct {
+		base, kernelChannel, gadgetChannel string
+	}{
+		{"core20", "20", "20/edge"},
+		{"core22", "22/stable", "22"},
+		// non-numeric tracks are not checked
+		{"core22", "latest/stable", "22"},
+		{"core22", "22", "my-track/beta"},
+	} {
+		s.opts.Label = fmt.Sprintf("2019110%d", i)
+		model := s.trackAlignmentModel(t.base, t.kernelChannel, t.gadgetChannel)
+
+		w, err := seedwriter.New(model, s.opts)
+		c.Assert(err, IsNil)
+		c.Assert(w.Start(s.db, s.rf), IsNil)
+
+		_, err = w.SnapsToDownload()
+		c.Check(err, IsNil, Commentf("%v", t))
 	}
-	s.MakeAssertedSnapWithComps(c, seedtest.SampleSnapYaml["required20"], nil,
-		snap.R(21), comRevs, "canonical", s.StoreSigning.Database)
+}
 
-	s.MakeAssertedSnapWithComps(c, seedtest.SampleSnapYaml["component-test"], nil,
-		snap.R(31), nil, "canonical", s.StoreSigning.Database)
+func (s *writerSuite) TestEnforceTrackAlignmentMisaligned(c *C) {
+	s.opts.EnforceTrackAlignment = true
+
+	for i, t := range []struct {
+		base, kernelChannel, gadgetChannel string
+		err                                string
+	}{
+		{"core22", "22", "20", `cannot use gadget snap "pc" from track "20" with base "core22": expected track "22"`},
+		{"core22", "20/stable", "22", `cannot use kernel snap "pc-kernel" from track "20" with base "core22": expected track "22"`},
+	} {
+		s.opts.Label = fmt.Sprintf("2019110%d", i)
+		model := s.trackAlignmentModel(t.base, t.kernelChannel, t.gadgetChannel)
+
+		w, err := seedwriter.New(model, s.opts)
+		c.Assert(err, IsNil)
+		c.Assert(w.Start(s.db, s.rf), IsNil)
+
+		_, err = w.SnapsToDownload()
+		c.Check(err, ErrorMatches, t.err)
+	}
+}
+
+func (s *writerSuite) TestEnforceTrackAlignmentMisalignedFromOptions(c *C) {
+	s.opts.Label = "20191107"
+	s.opts.EnforceTrackAlignment = true
+
+	model := s.trackAlignmentModel("core20", "20", "20")
+
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+	c.Assert(w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "pc", Channel: "22/edge"}}), IsNil)
+	c.Assert(w.Start(s.db, s.rf), IsNil)
+
+	_, err = w.SnapsToDownload()
+	c.Check(err, ErrorMatches, `cannot use gadget snap "pc" from track "22" with base "core20": expected track "20"`)
+}
+
+func (s *writerSuite) TestEnforceTrackAlignmentUnset(c *C) {
+	s.opts.Label = "20191107"
+
+	model := s.trackAlignmentModel("core22", "20", "20")
 
-	s.opts.Label = "20191122"
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
+	c.Assert(w.Start(s.db, s.rf), IsNil)
 
-	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{
-		{Name: "cont-producer", Channel: "edge"},
-		{Name: "core18"}, {Path: contConsumerFn},
-		{Name: "required20", Components: []seedwriter.OptionsComponent{
-			{Name: "comp1"}, {Name: "comp2"},
-		}},
-		{Name: "component-test", Components: []seedwriter.OptionsComponent{
-			{Name: "comp1"},
-		}},
+	_, err = w.SnapsToDownload()
+	c.Check(err, IsNil)
+}
+
+func (s *writerSuite) TestOpenSnap(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core18",
+		"gadget":       "pc=18",
+		"kernel":       "pc-kernel=18",
 	})
-	c.Assert(err, IsNil)
 
-	err = w.Start(s.db, s.rf)
-	c.Assert(err, IsNil)
+	snapPath := snaptest.MakeTestSnapWithFiles(c, snapYaml["required18"], nil)
 
-	localSnaps, err := w.LocalSnaps()
+	// snapfile.Open is used by default
+	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
-	c.Assert(localSnaps, HasLen, 1)
-
-	for _, sn := range localSnaps {
-		_, _, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
-		c.Assert(errors.Is(err, &asserts.NotFoundError{}), Equals, true)
-		f, err := snapfile.Open(sn.Path)
-		c.Assert(err, IsNil)
-		info, err := snap.ReadInfoFromSnapFile(f, nil)
-		c.Assert(err, IsNil)
-		w.SetInfo(sn, info, nil)
-	}
-
-	err = w.InfoDerived()
+	snapf, err := w.OpenSnap(snapPath)
 	c.Assert(err, IsNil)
-
-	snaps, err := w.SnapsToDownload()
+	info, err := snap.ReadInfoFromSnapFile(snapf, nil)
 	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 5)
+	c.Check(info.SnapName(), Equals, "required18")
 
-	for _, sn := range snaps {
-		channel := "latest/stable"
-		switch sn.SnapName() {
-		case "pc", "pc-kernel":
-			channel = "20"
+	_, err = w.OpenSnap(filepath.Join(c.MkDir(), "not-a-snap"))
+	c.Check(err, ErrorMatches, `cannot process snap or snapdir: .*`)
+}
+
+func (s *writerSuite) TestOpenSnapWithSnapOpener(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core18",
+		"gadget":       "pc=18",
+		"kernel":       "pc-kernel=18",
+	})
+
+	// a custom format the default opener does not know about
+	customPath := filepath.Join(c.MkDir(), "required18.custom")
+	c.Assert(os.WriteFile(customPath, []byte("custom container"), 0644), IsNil)
+	unpacked := c.MkDir()
+	snaptest.PopulateDir(unpacked, [][]string{{"meta/snap.yaml", snapYaml["required18"]}})
+
+	var opened []string
+	var openErr error
+	var returnNil bool
+	s.opts.SnapOpener = func(path string) (snap.Container, error) {
+		opened = append(opened, path)
+		if openErr != nil {
+			return nil, openErr
 		}
-		c.Check(sn.Channel, Equals, channel)
-		s.fillDownloadedSnap(c, w, sn)
+		if returnNil {
+			return nil, nil
+		}
+		return snapdir.New(unpacked), nil
 	}
 
-	complete, err := w.Downloaded(s.fetchAsserts(c))
+	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
-	c.Check(complete, Equals, false)
 
-	snaps, err = w.SnapsToDownload()
+	snapf, err := w.OpenSnap(customPath)
 	c.Assert(err, IsNil)
-	c.Assert(snaps, HasLen, 3)
-	c.Check(snaps[0].SnapName(), Equals, "cont-producer")
-	c.Check(snaps[1].SnapName(), Equals, "core18")
-	c.Check(snaps[2].SnapName(), Equals, "required20")
+	info, err := snap.ReadInfoFromSnapFile(snapf, nil)
+	c.Assert(err, IsNil)
+	c.Check(info.SnapName(), Equals, "required18")
+	c.Check(opened, DeepEquals, []string{customPath})
 
-	for _, sn := range snaps {
-		channel := "latest/stable"
-		switch sn.SnapName() {
-		case "cont-producer":
-			channel = "latest/edge"
-		}
-		c.Check(sn.Channel, Equals, channel)
+	openErr = errors.New("boom")
+	_, err = w.OpenSnap(customPath)
+	c.Check(err, ErrorMatches, "boom")
 
-		info := s.doFillMetaDownloadedSnap(c, w, sn)
+	openErr = nil
+	returnNil = true
+	_, err = w.OpenSnap(customPath)
+	c.Check(err, ErrorMatches, `cannot open snap ".*/required18.custom": snap opener returned no container`)
+}
 
-		c.Assert(sn.Path, Equals, filepath.Join(s.opts.SeedDir, "systems", s.opts.Label, "snaps", info.Filename()))
-		err := os.Rename(s.AssertedSnap(sn.SnapName()), sn.Path)
-		c.Assert(err, IsNil)
-		for _, seedComp := range sn.Components {
-			err := os.Rename(s.AssertedSnap(seedComp.String()), seedComp.Path)
-			c.Assert(err, IsNil)
-		}
-	}
+func (s *writerSuite) TestSnapdVersion(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core18",
+		"gadget":       "pc=18",
+		"kernel":       "pc-kernel=18",
+	})
 
-	complete, err = w.Downloaded(s.fetchAsserts(c))
-	c.Assert(err, IsNil)
-	c.Check(complete, Equals, true)
+	s.MakeAssertedSnap(c, snapYaml["snapd"], [][]string{
+		{"/usr/lib/snapd/info", "VERSION=2.70.1\nSNAPD_APPARMOR_REEXEC=1\n"},
+	}, snap.R(1), "canonical", s.StoreSigning.Database)
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
 
-	copySnap := func(name, src, dst string) error {
-		return osutil.CopyFile(src, dst, 0)
-	}
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+	_, err = w.SnapdVersion()
+	c.Check(err, ErrorMatches, "internal error: seedwriter.Writer cannot query seed snaps before Downloaded signaled complete")
 
-	err = w.SeedSnaps(copySnap)
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
 	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, true)
 
-	err = w.WriteMeta()
+	version, err := w.SnapdVersion()
 	c.Assert(err, IsNil)
+	c.Check(version, Equals, "2.70.1")
+}
 
-	// check seed
-	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
-	c.Check(systemDir, testutil.FilePresent)
+func (s *writerSuite) TestSnapdVersionWithSnapOpener(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core18",
+		"gadget":       "pc=18",
+		"kernel":       "pc-kernel=18",
+	})
 
-	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
-	c.Assert(err, IsNil)
-	c.Check(l, HasLen, 5)
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
 
-	// this snap is part of the model, so it should be in the seed's snap dir
-	c.Check(filepath.Join(s.opts.SeedDir, "snaps", "component-test_31.snap"), testutil.FilePresent)
+	// the stub opener presents the snapd snap as an unpacked directory
+	snapdDir := c.MkDir()
+	snaptest.PopulateDir(snapdDir, [][]string{
+		{"meta/snap.yaml", snapYaml["snapd"]},
+		{"/usr/lib/snapd/info", "VERSION=2.71\n"},
+	})
+	var opened []string
+	s.opts.SnapOpener = func(path string) (snap.Container, error) {
+		opened = append(opened, filepath.Base(path))
+		return snapdir.New(snapdDir), nil
+	}
 
-	// extra containers were put in system snaps dir
-	c.Check(filepath.Join(systemDir, "snaps", "core18_1.snap"), testutil.FilePresent)
-	c.Check(filepath.Join(systemDir, "snaps", "cont-producer_1.snap"), testutil.FilePresent)
-	c.Check(filepath.Join(systemDir, "snaps", "cont-consumer_1.0.snap"), testutil.FilePresent)
-	c.Check(filepath.Join(systemDir, "snaps", "required20_21.snap"), testutil.FilePresent)
-	c.Check(filepath.Join(systemDir, "snaps", "required20+comp1_22.comp"), testutil.FilePresent)
-	c.Check(filepath.Join(systemDir, "snaps", "required20+comp2_33.comp"), testutil.FilePresent)
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, true)
 
-	// although this component's snap is in the model, the component itself is
-	// not. that is why it ends up in this directory
-	c.Check(filepath.Join(systemDir, "snaps", "component-test+comp1_77.comp"), testutil.FilePresent)
+	version, err := w.SnapdVersion()
+	c.Assert(err, IsNil)
+	c.Check(version, Equals, "2.71")
+	c.Check(opened, DeepEquals, []string{"snapd_1.snap"})
+}
 
-	uniqID := func(a asserts.Assertion) string {
-		uniq := a.Ref().Unique()
-		if a.Type() == asserts.SnapRevisionType {
-			rev := a.(*asserts.SnapRevision)
-			uniq = fmt.Sprintf("%s@%d", rev.SnapID(), rev.SnapRevision())
-		} else if a.Type() == asserts.SnapResourceRevisionType {
-			rev := a.(*asserts.SnapResourceRevision)
-			uniq = fmt.Sprintf("%s+%s@%d", rev.SnapID(),
-				rev.ResourceName(), rev.ResourceRevision())
-		}
-		return uniq
-	}
+func (s *writerSuite) TestSnapdVersionFromCore(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"classic":        "true",
+		"architecture":   "amd64",
+		"gadget":         "classic-gadget",
+		"required-snaps": []any{"required"},
+	})
 
-	// check extra-snaps in assertions
-	extraAssertions := seedtest.ReadAssertions(c, filepath.Join(systemDir, "assertions", "extra-snaps"))
-	seenExtra := make(map[string]bool)
-	for _, a := range extraAssertions {
-		seenExtra[uniqID(a)] = true
-	}
+	s.MakeAssertedSnap(c, snapYaml["core"], [][]string{
+		{"/usr/lib/snapd/info", "VERSION=2.45\n"},
+	}, snap.R(1), "canonical", s.StoreSigning.Database)
+	s.makeSnap(c, "classic-gadget", "")
+	s.makeSnap(c, "required", "developerid")
 
-	assertions := seedtest.ReadAssertions(c, filepath.Join(systemDir, "assertions", "snaps"))
-	seen := make(map[string]bool)
-	for _, a := range assertions {
-		seen[uniqID(a)] = true
-	}
+	s.expectedSysSnap = "core"
+	s.expectedKernSnap = ""
 
-	snapRevUniq := func(snapName string, revno int) string {
-		return fmt.Sprintf("%s@%d", s.AssertedSnapID(snapName), revno)
-	}
-	resRevUniq := func(snapName, compName string, resRev int) string {
-		return fmt.Sprintf("%s+%s@%d", s.AssertedSnapID(snapName), compName, resRev)
-	}
-	snapDeclUniq := func(snapName string) string {
-		return "snap-declaration/16/" + s.AssertedSnapID(snapName)
-	}
-	snapResPairUniq := func(snapName, compName string, resRev, snapRev int) string {
-		return fmt.Sprintf("snap-resource-pair/%s/%s/%d/%d", s.AssertedSnapID(snapName), compName, resRev, snapRev)
-	}
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, false)
 
-	c.Check(seenExtra, DeepEquals, map[string]bool{
-		"account/developerid":                          true,
-		snapDeclUniq("core18"):                         true,
-		snapDeclUniq("cont-producer"):                  true,
-		snapDeclUniq("required20"):                     true,
-		snapRevUniq("core18", 1):                       true,
-		snapRevUniq("cont-producer", 1):                true,
-		snapRevUniq("required20", 21):                  true,
-		resRevUniq("required20", "comp1", 22):          true,
-		resRevUniq("required20", "comp2", 33):          true,
-		snapResPairUniq("required20", "comp1", 22, 21): true,
-		snapResPairUniq("required20", "comp2", 33, 21): true,
-	})
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 1)
+	s.fillDownloadedSnap(c, w, snaps[0])
 
-	// all of these end up in the main assertions file since the snap is
-	// asserted and in the model, despite the component not being in the model.
-	// this might be something we want to change
-	c.Check(seen[snapRevUniq("component-test", 31)], Equals, true)
-	c.Check(seen[resRevUniq("component-test", "comp1", 77)], Equals, true)
-	c.Check(seen[snapDeclUniq("component-test")], Equals, true)
-	c.Check(seen[snapResPairUniq("component-test", "comp1", 77, 31)], Equals, true)
+	complete, err = w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, true)
 
-	options20, err := seedwriter.InternalReadOptions20(filepath.Join(systemDir, "options.yaml"))
+	version, err := w.SnapdVersion()
 	c.Assert(err, IsNil)
+	c.Check(version, Equals, "2.45")
+}
 
-	c.Check(options20.Snaps, DeepEquals, []*seedwriter.InternalSnap20{
-		{
-			Name:       "component-test",
-			SnapID:     s.AssertedSnapID("component-test"),
-			Components: []internal.Component20{{Name: "comp1"}},
-		},
-		{
-			Name:    "cont-producer",
-			SnapID:  s.AssertedSnapID("cont-producer"),
-			Channel: "latest/edge",
-		},
-		{
-			Name:    "core18",
-			SnapID:  s.AssertedSnapID("core18"),
-			Channel: "latest/stable",
-		},
-		{
-			Name:       "cont-consumer",
-			Unasserted: "cont-consumer_1.0.snap",
-		},
-		{
-			Name:       "required20",
-			SnapID:     s.AssertedSnapID("required20"),
-			Channel:    "latest/stable",
-			Components: []internal.Component20{{Name: "comp1"}, {Name: "comp2"}},
-		},
+func (s *writerSuite) TestSnapdVersionMissingInfo(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core18",
+		"gadget":       "pc=18",
+		"kernel":       "pc-kernel=18",
 	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, true)
+
+	_, err = w.SnapdVersion()
+	c.Check(err, ErrorMatches, `cannot read snapd version from snapd snap: .*`)
 }
 
-func (s *writerSuite) TestSeedSnapsWriteMetaCore20LocalAssertedSnaps(c *C) {
+func (s *writerSuite) testSeedWriterExtraAssertionsCore18(c *C, reverseOrder bool) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
-		"base":         "core20",
-		"grade":        "dangerous",
-		"snaps": []any{
-			map[string]any{
-				"name":            "pc-kernel",
-				"id":              s.AssertedSnapID("pc-kernel"),
-				"type":            "kernel",
-				"default-channel": "20",
-			},
-			map[string]any{
-				"name":            "pc",
-				"id":              s.AssertedSnapID("pc"),
-				"type":            "gadget",
-				"default-channel": "20",
-			}},
+		"gadget":       "pc=18",
+		"kernel":       "pc-kernel=18",
+		"base":         "core18",
 	})
 
-	// validity
-	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
-
 	s.makeSnap(c, "snapd", "")
-	s.makeSnap(c, "core20", "")
-	s.makeSnap(c, "pc-kernel=20", "")
-	s.makeSnap(c, "pc=20", "")
-	s.makeSnap(c, "required20", "developerid")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
 
-	s.opts.Label = "20191122"
-	w, err := seedwriter.New(model, s.opts)
+	proxyStoreAssertion, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
+		"store":        "my-proxy-store",
+		"operator-id":  "other-brand",
+		"authority-id": "canonical",
+		"url":          "https://my-proxy-store.com",
+		"timestamp":    time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
 	c.Assert(err, IsNil)
 
-	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Path: s.AssertedSnap("pc"), Channel: "edge"}, {Path: s.AssertedSnap("required20")}})
+	accountAssertion, err := s.StoreSigning.Sign(asserts.AccountType, map[string]any{
+		"type":         "account",
+		"authority-id": "canonical",
+		"account-id":   "other-brand",
+		"validation":   "verified",
+		"display-name": "Predef",
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}, nil, "")
 	c.Assert(err, IsNil)
 
-	err = w.Start(s.db, s.rf)
-	c.Assert(err, IsNil)
+	if reverseOrder {
+		s.opts.ExtraAssertions = []asserts.Assertion{proxyStoreAssertion, accountAssertion}
+	} else {
+		s.opts.ExtraAssertions = []asserts.Assertion{accountAssertion, proxyStoreAssertion}
+	}
 
-	localSnaps, err := w.LocalSnaps()
+	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
-	c.Assert(localSnaps, HasLen, 2)
-
-	for _, sn := range localSnaps {
-		si, aRefs, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
-		c.Assert(err, IsNil)
-		f, err := snapfile.Open(sn.Path)
-		c.Assert(err, IsNil)
-		info, err := snap.ReadInfoFromSnapFile(f, si)
-		c.Assert(err, IsNil)
-		w.SetInfo(sn, info, nil)
-		s.aRefs[sn.SnapName()] = aRefs
-	}
 
-	err = w.InfoDerived()
+	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
 
 	snaps, err := w.SnapsToDownload()
 	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 3)
+	c.Check(snaps, HasLen, 4)
+
+	c.Check(naming.SameSnap(snaps[0], naming.Snap("snapd")), Equals, true)
+	c.Check(naming.SameSnap(snaps[1], naming.Snap("pc-kernel")), Equals, true)
+	c.Check(naming.SameSnap(snaps[2], naming.Snap("core18")), Equals, true)
+	c.Check(naming.SameSnap(snaps[3], naming.Snap("pc")), Equals, true)
 
 	for _, sn := range snaps {
-		channel := "latest/stable"
-		switch sn.SnapName() {
-		case "pc", "pc-kernel":
-			channel = "20"
-		}
-		c.Check(sn.Channel, Equals, channel)
 		s.fillDownloadedSnap(c, w, sn)
 	}
 
 	complete, err := w.Downloaded(s.fetchAsserts(c))
 	c.Assert(err, IsNil)
-	c.Check(complete, Equals, false)
-
-	snaps, err = w.SnapsToDownload()
-	c.Assert(err, IsNil)
-	c.Assert(snaps, HasLen, 0)
+	c.Check(complete, Equals, true)
 
-	complete, err = w.Downloaded(s.fetchAsserts(c))
+	essSnaps, err := w.BootSnaps()
 	c.Assert(err, IsNil)
-	c.Check(complete, Equals, true)
+	c.Check(essSnaps, DeepEquals, snaps[:4])
 
-	copySnap := func(name, src, dst string) error {
-		return osutil.CopyFile(src, dst, 0)
-	}
+	c.Check(w.Warnings(), HasLen, 0)
 
-	err = w.SeedSnaps(copySnap)
+	err = w.SeedSnaps(nil)
 	c.Assert(err, IsNil)
 
 	err = w.WriteMeta()
 	c.Assert(err, IsNil)
 
-	// check seed
-	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
-	c.Check(systemDir, testutil.FilePresent)
-
-	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
-	c.Assert(err, IsNil)
-	c.Check(l, HasLen, 4)
-
-	// local asserted model snap was put in /snaps
-	c.Check(filepath.Join(s.opts.SeedDir, "snaps", "pc_1.snap"), testutil.FilePresent)
-	// extra snaps were put in system snaps dir
-	c.Check(filepath.Join(systemDir, "snaps", "required20_1.snap"), testutil.FilePresent)
-
-	options20, err := seedwriter.InternalReadOptions20(filepath.Join(systemDir, "options.yaml"))
-	c.Assert(err, IsNil)
+	// check assertions
+	seedAssertsDir := filepath.Join(s.opts.SeedDir, "assertions")
 
-	c.Check(options20.Snaps, DeepEquals, []*seedwriter.InternalSnap20{
-		{
-			Name:    "pc",
-			SnapID:  s.AssertedSnapID("pc"),
-			Channel: "20/edge",
-		},
-		{
-			Name:    "required20",
-			SnapID:  s.AssertedSnapID("required20"),
-			Channel: "latest/stable",
-		},
-	})
+	c.Assert(filepath.Join(seedAssertsDir, "my-proxy-store.store"), testutil.FilePresent)
+	c.Assert(filepath.Join(seedAssertsDir, "other-brand.account"), testutil.FilePresent)
 }
 
-func (s *writerSuite) TestSeedSnapsWriteMetaCore20SignedLocalAssertedSnaps(c *C) {
-	withComps := false
-	s.testSeedSnapsWriteMetaCore20SignedLocalAssertedSnaps(c, withComps)
+func (s *writerSuite) TestSeedWriterExtraAssertionsCore18(c *C) {
+	const reverseOrder = false
+	s.testSeedWriterExtraAssertionsCore18(c, reverseOrder)
 }
 
-func (s *writerSuite) TestSeedSnapsWriteMetaCore20SignedLocalAssertedSnapsWithComps(c *C) {
-	withComps := true
-	s.testSeedSnapsWriteMetaCore20SignedLocalAssertedSnaps(c, withComps)
+func (s *writerSuite) TestSeedWriterExtraAssertionsCore18ReverseOrder(c *C) {
+	const reverseOrder = true
+	s.testSeedWriterExtraAssertionsCore18(c, reverseOrder)
 }
 
-func (s *writerSuite) testSeedSnapsWriteMetaCore20SignedLocalAssertedSnaps(c *C, withComps bool) {
+func (s *writerSuite) testSeedWriterExtraAssertionsCore20(c *C, addProxyStore, reverseOrder, fileExistError bool, numberSystemUsers int) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
 		"base":         "core20",
-		"grade":        "signed",
 		"snaps": []any{
 			map[string]any{
 				"name":            "pc-kernel",
@@ -3981,91 +7797,94 @@ func (s *writerSuite) testSeedSnapsWriteMetaCore20SignedLocalAssertedSnaps(c *C,
 				"default-channel": "20",
 			},
 			map[string]any{
-				"name": "required20",
-				"id":   s.AssertedSnapID("required20"),
-				"components": map[string]any{
-					"comp1": "optional",
-					"comp2": "optional",
-				},
+				"name":            "snapd",
+				"id":              s.AssertedSnapID("snapd"),
+				"type":            "snapd",
+				"default-channel": "20",
 			},
 		},
 	})
 
-	// soundness
-	c.Assert(model.Grade(), Equals, asserts.ModelSigned)
-
 	s.makeSnap(c, "snapd", "")
 	s.makeSnap(c, "core20", "")
 	s.makeSnap(c, "pc-kernel=20", "")
 	s.makeSnap(c, "pc=20", "")
-	comRevs := map[string]snap.Revision{
-		"comp1": snap.R(22),
-		"comp2": snap.R(33),
-	}
-	s.SeedSnaps.MakeAssertedSnapWithComps(c, seedtest.SampleSnapYaml["required20"], nil,
-		snap.R(21), comRevs, "canonical", s.StoreSigning.Database)
 
-	s.opts.Label = "20191122"
-	w, err := seedwriter.New(model, s.opts)
+	proxyStoreAssertion, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
+		"store":        "my-proxy-store",
+		"operator-id":  "other-brand",
+		"authority-id": "canonical",
+		"url":          "https://my-proxy-store.com",
+		"timestamp":    time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
 	c.Assert(err, IsNil)
 
-	// use local asserted snaps with signed, which is supported
-	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Path: s.AssertedSnap("pc")},
-		{Path: s.AssertedSnap("required20")}})
+	accountAssertion, err := s.StoreSigning.Sign(asserts.AccountType, map[string]any{
+		"type":         "account",
+		"authority-id": "canonical",
+		"account-id":   "other-brand",
+		"validation":   "verified",
+		"display-name": "Predef",
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}, nil, "")
 	c.Assert(err, IsNil)
 
-	err = w.Start(s.db, s.rf)
+	systemUserGuyAssertion, err := s.Brands.Signing("my-brand").Sign(asserts.SystemUserType, map[string]any{
+		"authority-id": "my-brand",
+		"brand-id":     "my-brand",
+		"email":        "foo@bar.com",
+		"series":       []any{"16", "18"},
+		"models":       []any{"my-model"},
+		"name":         "Boring Guy",
+		"username":     "guy",
+		"ssh-key":      []any{"ecdsa-sha2-nistp384 AAAAE2VjZHNhLXNoYTItbmlzdHAzODQAAAAIbmlzdHAzODQAAABhBPwPDyLV/40kHdKQb4xq8EyfEaEUiXFui1bs4omabB0cwfVSYPZql+qJG22aBZjsEv4ESkc5u9lgaNbzsRDRUTYtJWzUJYIaObihMgi7U48kkBsf7TBxGOOy+t9pFatmEQ=="},
+		"since":        time.Now().Format(time.RFC3339),
+		"until":        time.Now().Add(24 * 30 * time.Hour).Format(time.RFC3339),
+	}, nil, "")
 	c.Assert(err, IsNil)
 
-	localSnaps, err := w.LocalSnaps()
+	systemUserBillAssertion, err := s.Brands.Signing("my-brand").Sign(asserts.SystemUserType, map[string]any{
+		"authority-id": "my-brand",
+		"brand-id":     "my-brand",
+		"email":        "foo@baz.com",
+		"series":       []any{"16", "18"},
+		"models":       []any{"my-model"},
+		"name":         "Expensive Bill",
+		"username":     "bill",
+		"ssh-key":      []any{"ecdsa-sha2-nistp384 AAAAE2VjZHNhLXNoTTItbmlzdHAzODQAAAAIbmlzdHAzODQAAABhBPwPDyLV/40kHdKQb4xq8EyfEaEUiXFui1bs4omabB0cwfVSYPZql+qJG22aBZjsEv4ESkc5u9lgaNbzsRDRUTYtJWzUJYIaObihMgi7U48kkBsf7TBxGOOy+t9pFatmEQ=="},
+		"since":        time.Now().Format(time.RFC3339),
+		"until":        time.Now().Add(24 * 30 * time.Hour).Format(time.RFC3339),
+	}, nil, "")
 	c.Assert(err, IsNil)
-	c.Assert(localSnaps, HasLen, 2)
-
-	for _, sn := range localSnaps {
-		si, aRefs, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
-		c.Assert(err, IsNil)
-		f, err := snapfile.Open(sn.Path)
-		c.Assert(err, IsNil)
-		info, err := snap.ReadInfoFromSnapFile(f, si)
-		c.Assert(err, IsNil)
 
-		seedComps := map[string]*seedwriter.SeedComponent{}
-		if withComps && info.SnapName() == "required20" {
-			for _, comp := range []string{"comp1", "comp2"} {
-				cref := naming.NewComponentRef("required20", comp)
-				cinfo := snap.NewComponentInfo(cref, snap.StandardComponent,
-					"1.0", "", "", "", nil)
-				pathComp := s.AssertedSnap(cref.String())
-				csi, _, err := seedwriter.DeriveComponentSideInfo(
-					pathComp, cinfo, info, model, s.rf, s.db)
-				c.Assert(err, IsNil)
-				cinfo.ComponentSideInfo = *csi
-				seedComps[comp] = &seedwriter.SeedComponent{
-					ComponentRef: cref,
-					Path:         pathComp,
-					Info:         cinfo,
-				}
-			}
+	s.opts.ExtraAssertions = []asserts.Assertion{}
+	if addProxyStore {
+		if reverseOrder {
+			s.opts.ExtraAssertions = append(s.opts.ExtraAssertions, proxyStoreAssertion, accountAssertion)
+		} else {
+			s.opts.ExtraAssertions = append(s.opts.ExtraAssertions, accountAssertion, proxyStoreAssertion)
 		}
+	}
 
-		w.SetInfo(sn, info, seedComps)
-		s.aRefs[sn.SnapName()] = aRefs
+	switch numberSystemUsers {
+	case 1:
+		s.opts.ExtraAssertions = append(s.opts.ExtraAssertions, systemUserGuyAssertion)
+	case 2:
+		s.opts.ExtraAssertions = append(s.opts.ExtraAssertions, systemUserGuyAssertion, systemUserBillAssertion)
 	}
 
-	err = w.InfoDerived()
+	s.opts.Label = "20250326"
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
 
 	snaps, err := w.SnapsToDownload()
 	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 3)
+	c.Check(snaps, HasLen, 4)
 
 	for _, sn := range snaps {
-		channel := "latest/stable"
-		switch sn.SnapName() {
-		case "pc", "pc-kernel":
-			channel = "20"
-		}
-		c.Check(sn.Channel, Equals, channel)
 		s.fillDownloadedSnap(c, w, sn)
 	}
 
@@ -4073,225 +7892,148 @@ func (s *writerSuite) testSeedSnapsWriteMetaCore20SignedLocalAssertedSnaps(c *C,
 	c.Assert(err, IsNil)
 	c.Check(complete, Equals, true)
 
-	copySnap := func(name, src, dst string) error {
-		return osutil.CopyFile(src, dst, 0)
-	}
-
-	err = w.SeedSnaps(copySnap)
-	c.Assert(err, IsNil)
-
-	err = w.WriteMeta()
+	err = w.SeedSnaps(nil)
 	c.Assert(err, IsNil)
 
 	// check seed
 	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
-	c.Check(systemDir, testutil.FilePresent)
-
-	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
-	c.Assert(err, IsNil)
-	expectLen := 5
-	if withComps {
-		expectLen += 2
+	assertsDir := filepath.Join(systemDir, "assertions")
+	// Trigger some errors by writing files prior to seeding
+	if addProxyStore && fileExistError {
+		err := os.MkdirAll(assertsDir, 0755)
+		c.Assert(err, IsNil)
+		f, err := os.OpenFile(filepath.Join(assertsDir, "extra-assertions"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		c.Assert(err, IsNil)
+		defer f.Close()
 	}
-	c.Check(l, HasLen, expectLen)
-
-	// local asserted snaps/components were put in /snaps
-	c.Check(filepath.Join(s.opts.SeedDir, "snaps", "pc_1.snap"), testutil.FilePresent)
-	c.Check(filepath.Join(s.opts.SeedDir, "snaps", "required20_21.snap"), testutil.FilePresent)
-	if withComps {
-		c.Check(filepath.Join(s.opts.SeedDir, "snaps", "required20+comp1_22.comp"), testutil.FilePresent)
-		c.Check(filepath.Join(s.opts.SeedDir, "snaps", "required20+comp2_33.comp"), testutil.FilePresent)
+	if numberSystemUsers > 0 && fileExistError {
+		f, err := os.OpenFile(filepath.Join(systemDir, "auto-import.assert"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		c.Assert(err, IsNil)
+		defer f.Close()
 	}
 
-	// no options file was created
-	c.Check(filepath.Join(systemDir, "options.yaml"), testutil.FileAbsent)
-}
-
-func (s *writerSuite) TestSeedSnapsWriteCore20ErrWhenDirExists(c *C) {
-	model := s.Brands.Model("my-brand", "my-model", map[string]any{
-		"display-name": "my model",
-		"architecture": "amd64",
-		"base":         "core20",
-		"grade":        "signed",
-		"snaps": []any{
-			map[string]any{
-				"name":            "pc-kernel",
-				"id":              s.AssertedSnapID("pc-kernel"),
-				"type":            "kernel",
-				"default-channel": "20",
-			},
-			map[string]any{
-				"name":            "pc",
-				"id":              s.AssertedSnapID("pc"),
-				"type":            "gadget",
-				"default-channel": "20",
-			}},
-	})
+	err = w.WriteMeta()
+	if fileExistError {
+		c.Assert(errors.Is(err, os.ErrExist), Equals, true)
+		return
+	} else {
+		c.Assert(err, IsNil)
+	}
 
-	err := os.MkdirAll(filepath.Join(s.opts.SeedDir, "systems", "1234"), 0755)
-	c.Assert(err, IsNil)
-	s.opts.Label = "1234"
-	w, err := seedwriter.New(model, s.opts)
-	c.Assert(err, IsNil)
-	c.Assert(w, NotNil)
+	// check assertions
+	c.Check(filepath.Join(systemDir, "model"), testutil.FileEquals, asserts.Encode(model))
 
-	err = w.Start(s.db, s.rf)
-	c.Assert(err, ErrorMatches, `system "1234" already exists`)
-	c.Assert(seedwriter.IsSytemDirectoryExistsError(err), Equals, true)
-}
+	modelEtc := seedtest.ReadAssertions(c, filepath.Join(assertsDir, "model-etc"))
+	c.Check(modelEtc, HasLen, 3)
 
-func (s *writerSuite) testDownloadedCore20CheckClassic(c *C, modelGrade asserts.ModelGrade, classicFlag bool) error {
-	classicSnap := map[string]any{
-		"name":  "classic-snap",
-		"id":    s.AssertedSnapID("classic-snap"),
-		"modes": []any{"run"},
-	}
-	if classicFlag {
-		classicSnap["classic"] = "true"
+	keyPKs := make(map[string]bool)
+	for _, a := range modelEtc {
+		switch a.Type() {
+		case asserts.AccountType:
+			c.Check(a.HeaderString("account-id"), Equals, "my-brand")
+		case asserts.StoreType:
+			c.Check(a.HeaderString("store"), Equals, "my-store")
+		case asserts.AccountKeyType:
+			keyPKs[a.HeaderString("public-key-sha3-384")] = true
+		default:
+			c.Fatalf("unexpected assertion %s", a.Type().Name)
+		}
 	}
-	model := s.Brands.Model("my-brand", "my-model", map[string]any{
-		"display-name": "my model",
-		"architecture": "amd64",
-		"store":        "my-store",
-		"base":         "core20",
-		"classic":      "true",
-		"distribution": "ubuntu",
-		"grade":        string(modelGrade),
-		"snaps": []any{
-			map[string]any{
-				"name":            "pc-kernel",
-				"id":              s.AssertedSnapID("pc-kernel"),
-				"type":            "kernel",
-				"default-channel": "20",
-			},
-			map[string]any{
-				"name":            "pc",
-				"id":              s.AssertedSnapID("pc"),
-				"type":            "gadget",
-				"default-channel": "20",
-			},
-			map[string]any{
-				"name": "core",
-				"id":   s.AssertedSnapID("core"),
-				"type": "core",
-			},
-			classicSnap,
-		},
+	c.Check(keyPKs, DeepEquals, map[string]bool{
+		s.StoreSigning.StoreAccountKey("").PublicKeyID(): true,
+		s.Brands.AccountKey("my-brand").PublicKeyID():    true,
 	})
 
-	// validity
-	c.Assert(model.Grade(), Equals, modelGrade)
+	// check extra assertions if any (not type System User)
+	if addProxyStore {
+		extraAssertions := seedtest.ReadAssertions(c, filepath.Join(assertsDir, "extra-assertions"))
+		c.Check(extraAssertions, HasLen, 2)
 
-	s.makeSnap(c, "snapd", "")
-	s.makeSnap(c, "core20", "")
-	s.makeSnap(c, "core", "")
-	s.makeSnap(c, "pc-kernel=20", "")
-	s.makeSnap(c, "pc=20", "")
-	s.makeSnap(c, "classic-snap", "developerid")
+		for _, a := range extraAssertions {
+			switch a.Type() {
+			case asserts.AccountType:
+				c.Check(a.HeaderString("account-id"), Equals, "other-brand")
+			case asserts.StoreType:
+				c.Check(a.HeaderString("store"), Equals, "my-proxy-store")
+			default:
+				c.Fatalf("unexpected assertion %s", a.Type().Name)
+			}
+		}
+	} else {
+		c.Assert(filepath.Join(assertsDir, "extra-assertions"), testutil.FileAbsent)
+	}
 
-	s.opts.Label = "20221125"
-	_, _, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
-	return err
-}
+	// system user extra assertions
+	if numberSystemUsers > 0 {
+		extraAssertions := seedtest.ReadAssertions(c, filepath.Join(systemDir, "auto-import.assert"))
+		c.Check(extraAssertions, HasLen, numberSystemUsers)
 
-func (s *writerSuite) TestDownloadedCore20CheckClassicDangerous(c *C) {
-	err := s.testDownloadedCore20CheckClassic(c, asserts.ModelDangerous, false)
-	c.Check(err, IsNil)
+		for _, a := range extraAssertions {
+			switch a.Type() {
+			case asserts.SystemUserType:
+				switch a.HeaderString("username") {
+				case "guy":
+				case "bill":
+					if numberSystemUsers != 2 {
+						c.Fatalf("unexpected user")
+					}
+				default:
+					c.Fatalf("unexpected user %s", a.HeaderString("username"))
+				}
+			default:
+				c.Fatalf("unexpected assertion %s", a.Type().Name)
+			}
+		}
+	} else {
+		c.Assert(filepath.Join(systemDir, "auto-import.assert"), testutil.FileAbsent)
+	}
 }
 
-func (s *writerSuite) TestDownloadedCore20CheckClassicSignedNoFlag(c *C) {
-	err := s.testDownloadedCore20CheckClassic(c, asserts.ModelSigned, false)
-	c.Check(err, ErrorMatches, `cannot use classic snap "classic-snap" with a model of grade higher than dangerous that does not allow it explicitly \(missing classic: true in snap stanza\)`)
+func (s *writerSuite) TestSeedWriterExtraAssertionsCore20(c *C) {
+	const addProxyStore = true
+	const reverseOrder = false
+	const fileExistError = false
+	const numberSystemUsers = 0
+	s.testSeedWriterExtraAssertionsCore20(c, addProxyStore, reverseOrder, fileExistError, numberSystemUsers)
 }
 
-func (s *writerSuite) TestDownloadedCore20CheckClassicSignedWithFlag(c *C) {
-	err := s.testDownloadedCore20CheckClassic(c, asserts.ModelSigned, true)
-	c.Check(err, IsNil)
+func (s *writerSuite) TestSeedWriterExtraAssertionsCore20ReverseOrder(c *C) {
+	const addProxyStore = true
+	const reverseOrder = true
+	const fileExistError = false
+	const numberSystemUsers = 0
+	s.testSeedWriterExtraAssertionsCore20(c, addProxyStore, reverseOrder, fileExistError, numberSystemUsers)
 }
 
-func (s *writerSuite) setupValidationSets(c *C) {
-	valSetA, err := s.StoreSigning.Sign(asserts.ValidationSetType, map[string]any{
-		"type":         "validation-set",
-		"authority-id": "canonical",
-		"series":       "16",
-		"account-id":   "canonical",
-		"name":         "base-set",
-		"sequence":     "1",
-		"snaps": []any{
-			map[string]any{
-				"name":     "pc-kernel",
-				"id":       s.AssertedSnapID("pc-kernel"),
-				"presence": "required",
-				"revision": "7",
-			},
-			map[string]any{
-				"name":     "pc",
-				"id":       s.AssertedSnapID("pc"),
-				"presence": "required",
-				"revision": "7",
-			},
-		},
-		"timestamp": time.Now().UTC().Format(time.RFC3339),
-	}, nil, "")
-	c.Assert(err, IsNil)
-	err = s.StoreSigning.Add(valSetA)
-	c.Check(err, IsNil)
+func (s *writerSuite) TestSeedWriterExtraAssertionsCore20SingleSystemUser(c *C) {
+	const addProxyStore = false
+	const reverseOrder = false
+	const fileExistError = false
+	const numberSystemUsers = 1
+	s.testSeedWriterExtraAssertionsCore20(c, addProxyStore, reverseOrder, fileExistError, numberSystemUsers)
+}
 
-	valSetB, err := s.StoreSigning.Sign(asserts.ValidationSetType, map[string]any{
-		"type":         "validation-set",
-		"authority-id": "canonical",
-		"series":       "16",
-		"account-id":   "canonical",
-		"name":         "base-set",
-		"sequence":     "2",
-		"snaps": []any{
-			map[string]any{
-				"name":     "pc-kernel",
-				"id":       s.AssertedSnapID("pc-kernel"),
-				"presence": "required",
-				"revision": "1",
-			},
-			map[string]any{
-				"name":     "pc",
-				"id":       s.AssertedSnapID("pc"),
-				"presence": "required",
-				"revision": "1",
-			},
-		},
-		"timestamp": time.Now().UTC().Format(time.RFC3339),
-	}, nil, "")
-	c.Assert(err, IsNil)
-	err = s.StoreSigning.Add(valSetB)
-	c.Check(err, IsNil)
+func (s *writerSuite) TestSeedWriterExtraAssertionsCore20MultipleSystemUsers(c *C) {
+	const addProxyStore = false
+	const reverseOrder = false
+	const fileExistError = false
+	const numberSystemUsers = 2
+	s.testSeedWriterExtraAssertionsCore20(c, addProxyStore, reverseOrder, fileExistError, numberSystemUsers)
+}
 
-	valSetC, err := s.StoreSigning.Sign(asserts.ValidationSetType, map[string]any{
-		"type":         "validation-set",
-		"authority-id": "canonical",
-		"series":       "16",
-		"account-id":   "canonical",
-		"name":         "opt-set",
-		"sequence":     "2",
-		"snaps": []any{
-			map[string]any{
-				"name":     "my-snap",
-				"id":       "mysnapididididididididididididid",
-				"presence": "required",
-				"revision": "8",
-			},
-		},
-		"timestamp": time.Now().UTC().Format(time.RFC3339),
-	}, nil, "")
-	c.Assert(err, IsNil)
-	err = s.StoreSigning.Add(valSetC)
-	c.Check(err, IsNil)
+func (s *writerSuite) TestSeedWriterExtraAssertionsCore20ProxyStoreAndMultipleSystemUsers(c *C) {
+	const addProxyStore = true
+	const reverseOrder = false
+	const fileExistError = false
+	const numberSystemUsers = 2
+	s.testSeedWriterExtraAssertionsCore20(c, addProxyStore, reverseOrder, fileExistError, numberSystemUsers)
 }
 
-func (s *writerSuite) TestValidateValidationSetsCore20EnforcedInvalid(c *C) {
-	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+func (s *writerSuite) systemUserCore20Model() *asserts.Model {
+	return s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
 		"base":         "core20",
-		"grade":        "dangerous",
 		"snaps": []any{
 			map[string]any{
 				"name":            "pc-kernel",
@@ -4304,365 +8046,482 @@ func (s *writerSuite) TestValidateValidationSetsCore20EnforcedInvalid(c *C) {
 				"id":              s.AssertedSnapID("pc"),
 				"type":            "gadget",
 				"default-channel": "20",
-			}},
-		"validation-sets": []any{
-			map[string]any{
-				"account-id": "canonical",
-				"name":       "base-set",
-				"sequence":   "1",
-				"mode":       "enforce",
-			},
-			map[string]any{
-				"account-id": "canonical",
-				"name":       "opt-set",
-				"mode":       "prefer-enforce",
 			},
 		},
 	})
+}
 
-	// validity
-	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
+func (s *writerSuite) makeSystemUser(c *C, authorityID string, extra map[string]any) asserts.Assertion {
+	headers := map[string]any{
+		"authority-id": authorityID,
+		"brand-id":     "my-brand",
+		"email":        "foo@bar.com",
+		"series":       []any{"16"},
+		"models":       []any{"my-model"},
+		"name":         "Boring Guy",
+		"username":     "guy",
+		"since":        time.Now().Add(-time.Hour).Format(time.RFC3339),
+		"until":        time.Now().Add(24 * 30 * time.Hour).Format(time.RFC3339),
+	}
+	for k, v := range extra {
+		headers[k] = v
+	}
+	su, err := s.Brands.Signing(authorityID).Sign(asserts.SystemUserType, headers, nil, "")
+	c.Assert(err, IsNil)
+	return su
+}
 
-	// setup a few validation set assertions in store
-	s.setupValidationSets(c)
+func (s *writerSuite) TestSeedWriterSystemUserAssertions(c *C) {
+	model := s.systemUserCore20Model()
 
 	s.makeSnap(c, "snapd", "")
 	s.makeSnap(c, "core20", "")
 	s.makeSnap(c, "pc-kernel=20", "")
 	s.makeSnap(c, "pc=20", "")
 
-	s.opts.Label = "20191122"
+	su := s.makeSystemUser(c, "my-brand", nil)
+	s.opts.SystemUserAssertions = []asserts.Assertion{su}
+	s.opts.Label = "20250326"
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
 	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
 
-	localSnaps, err := w.LocalSnaps()
-	c.Assert(err, IsNil)
-	c.Assert(localSnaps, HasLen, 0)
-
-	for _, sn := range localSnaps {
-		_, _, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
-		c.Assert(errors.Is(err, &asserts.NotFoundError{}), Equals, true)
-		f, err := snapfile.Open(sn.Path)
-		c.Assert(err, IsNil)
-		info, err := snap.ReadInfoFromSnapFile(f, nil)
-		c.Assert(err, IsNil)
-		w.SetInfo(sn, info, nil)
-	}
-
-	err = w.InfoDerived()
-	c.Assert(err, IsNil)
-
 	snaps, err := w.SnapsToDownload()
 	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 4)
-
 	for _, sn := range snaps {
-		channel := "latest/stable"
-		switch sn.SnapName() {
-		case "pc", "pc-kernel":
-			channel = "20"
-		}
-		c.Check(sn.Channel, Equals, channel)
 		s.fillDownloadedSnap(c, w, sn)
 	}
-
 	complete, err := w.Downloaded(s.fetchAsserts(c))
 	c.Assert(err, IsNil)
 	c.Check(complete, Equals, true)
 
-	err = w.CheckValidationSets()
-	c.Assert(err, NotNil)
-	valErr := err.(*snapasserts.ValidationSetsValidationError)
-	c.Check(valErr.MissingSnaps, DeepEquals, map[string]map[snap.Revision][]string{
-		"my-snap": {
-			snap.Revision{N: 8}: []string{"canonical/opt-set"},
-		},
-	})
-	c.Check(valErr.InvalidSnaps, HasLen, 0)
-	c.Check(valErr.WrongRevisionSnaps, DeepEquals, map[string]map[snap.Revision][]string{
-		"pc": {
-			snap.Revision{N: 7}: []string{"canonical/base-set"},
-		},
-		"pc-kernel": {
-			snap.Revision{N: 7}: []string{"canonical/base-set"},
-		},
-	})
+	c.Assert(w.SeedSnaps(nil), IsNil)
+	c.Assert(w.WriteMeta(), IsNil)
+
+	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
+	autoImport := seedtest.ReadAssertions(c, filepath.Join(systemDir, "auto-import.assert"))
+	c.Assert(autoImport, HasLen, 1)
+	c.Check(autoImport[0].Type(), Equals, asserts.SystemUserType)
+	c.Check(autoImport[0].HeaderString("username"), Equals, "guy")
+	c.Check(filepath.Join(systemDir, "assertions", "extra-assertions"), testutil.FileAbsent)
+	// the option was not modified
+	c.Check(s.opts.ExtraAssertions, HasLen, 0)
 }
 
-func (s *writerSuite) TestValidateValidationSetsCore20EnforcedHappy(c *C) {
+func (s *writerSuite) TestSeedWriterSystemUserAssertionsUntrustedAuthority(c *C) {
+	s.Brands.Register("other-brand", otherbrandPrivKey, nil)
+	model := s.systemUserCore20Model()
+
+	su := s.makeSystemUser(c, "other-brand", nil)
+	s.opts.SystemUserAssertions = []asserts.Assertion{su}
+	s.opts.Label = "20250326"
+	_, err := seedwriter.New(model, s.opts)
+	c.Assert(err, ErrorMatches, `cannot use system-user assertion for "foo@bar.com": "other-brand" not in accepted authorities \["my-brand"\]`)
+}
+
+func (s *writerSuite) TestSeedWriterSystemUserAssertionsNotForModel(c *C) {
+	model := s.systemUserCore20Model()
+	s.opts.Label = "20250326"
+
+	tests := []struct {
+		headers map[string]any
+		err     string
+	}{
+		{map[string]any{"models": []any{"other-model"}}, `.*: "my-model" not in models \["other-model"\]`},
+		{map[string]any{"series": []any{"18"}}, `.*: "16" not in series \["18"\]`},
+		{map[string]any{
+			"since": time.Now().Add(-48 * time.Hour).Format(time.RFC3339),
+			"until": time.Now().Add(-24 * time.Hour).Format(time.RFC3339),
+		}, `.*: assertion expired at .*`},
+	}
+	for _, t := range tests {
+		s.opts.SystemUserAssertions = []asserts.Assertion{s.makeSystemUser(c, "my-brand", t.headers)}
+		_, err := seedwriter.New(model, s.opts)
+		c.Check(err, ErrorMatches, t.err)
+	}
+
+	s.opts.SystemUserAssertions = []asserts.Assertion{model}
+	_, err := seedwriter.New(model, s.opts)
+	c.Check(err, ErrorMatches, `cannot use model assertion as a system-user assertion`)
+}
+
+func (s *writerSuite) TestSeedWriterExtraAssertionsCore20StoreFileError(c *C) {
+	const addProxyStore = true
+	const reverseOrder = false
+	const fileExistError = true
+	const numberSystemUsers = 0
+	s.testSeedWriterExtraAssertionsCore20(c, addProxyStore, reverseOrder, fileExistError, numberSystemUsers)
+}
+
+func (s *writerSuite) TestSeedWriterExtraAssertionsCore20SingleSystemUserFileError(c *C) {
+	const addProxyStore = false
+	const reverseOrder = false
+	const fileExistError = true
+	const numberSystemUsers = 1
+	s.testSeedWriterExtraAssertionsCore20(c, addProxyStore, reverseOrder, fileExistError, numberSystemUsers)
+}
+
+func (s *writerSuite) TestSeedWriterExtraAssertionsErrorPrerequisites(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
+		"gadget":       "pc=20",
+		"kernel":       "pc-kernel=20",
 		"base":         "core20",
-		"grade":        "dangerous",
-		"snaps": []any{
-			map[string]any{
-				"name":            "pc-kernel",
-				"id":              s.AssertedSnapID("pc-kernel"),
-				"type":            "kernel",
-				"default-channel": "20",
-			},
-			map[string]any{
-				"name":            "pc",
-				"id":              s.AssertedSnapID("pc"),
-				"type":            "gadget",
-				"default-channel": "20",
-			}},
-		"validation-sets": []any{
-			map[string]any{
-				"account-id": "canonical",
-				"name":       "base-set",
-				// Enforce sequence 2 instead, which requires revision
-				// 1 of pc-kernel and pc
-				"sequence": "2",
-				"mode":     "enforce",
-			},
-		},
 	})
 
-	// validity
-	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
-
-	// setup a few validation set assertions in store
-	s.setupValidationSets(c)
-
 	s.makeSnap(c, "snapd", "")
 	s.makeSnap(c, "core20", "")
 	s.makeSnap(c, "pc-kernel=20", "")
 	s.makeSnap(c, "pc=20", "")
 
-	s.opts.Label = "20191122"
-	w, err := seedwriter.New(model, s.opts)
-	c.Assert(err, IsNil)
-
-	err = w.Start(s.db, s.rf)
-	c.Assert(err, IsNil)
-
-	localSnaps, err := w.LocalSnaps()
-	c.Assert(err, IsNil)
-	c.Assert(localSnaps, HasLen, 0)
-
-	for _, sn := range localSnaps {
-		_, _, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
-		c.Assert(errors.Is(err, &asserts.NotFoundError{}), Equals, true)
-		f, err := snapfile.Open(sn.Path)
-		c.Assert(err, IsNil)
-		info, err := snap.ReadInfoFromSnapFile(f, nil)
-		c.Assert(err, IsNil)
-		w.SetInfo(sn, info, nil)
-	}
-
-	err = w.InfoDerived()
-	c.Assert(err, IsNil)
-
-	snaps, err := w.SnapsToDownload()
-	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 4)
-
-	for _, sn := range snaps {
-		channel := "latest/stable"
-		switch sn.SnapName() {
-		case "pc", "pc-kernel":
-			channel = "20"
-		}
-		c.Check(sn.Channel, Equals, channel)
-		s.fillDownloadedSnap(c, w, sn)
-	}
-
-	complete, err := w.Downloaded(s.fetchAsserts(c))
-	c.Assert(err, IsNil)
-	c.Check(complete, Equals, true)
-
-	err = w.CheckValidationSets()
-	c.Assert(err, IsNil)
-
-	err = w.SeedSnaps(func(name, src, dst string) error {
-		return osutil.CopyFile(src, dst, 0)
-	})
-	c.Assert(err, IsNil)
-
-	err = w.WriteMeta()
+	proxyStoreAssertion, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
+		"store":        "my-proxy-store",
+		"operator-id":  "other-brand",
+		"authority-id": "canonical",
+		"url":          "https://my-proxy-store.com",
+		"timestamp":    time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
 	c.Assert(err, IsNil)
 
-	// check seed
-	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
-	c.Check(systemDir, testutil.FilePresent)
+	s.opts.ExtraAssertions = []asserts.Assertion{proxyStoreAssertion}
 
-	// check snaps
-	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
+	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
-	c.Check(l, HasLen, 4)
 
-	// check model-etc contains the validation set assertion
-	assertsDir := filepath.Join(systemDir, "assertions")
-	modelEtc := seedtest.ReadAssertions(c, filepath.Join(assertsDir, "model-etc"))
-	c.Check(modelEtc, HasLen, 4)
-	var vsFound bool
-	for _, a := range modelEtc {
-		if a.Type() == asserts.ValidationSetType {
-			vsFound = true
-			vsa := a.(*asserts.ValidationSet)
-			c.Check(vsa.AccountID(), Equals, "canonical")
-			c.Check(vsa.Name(), Equals, "base-set")
-			c.Check(vsa.Sequence(), Equals, 2)
-		}
-	}
-	c.Check(vsFound, Equals, true)
+	err = w.Start(s.db, s.rf)
+	c.Assert(err.Error(), testutil.Contains, "cannot fetch and check prerequisites for an injected assertion: account (other-brand) not found")
 }
 
-func (s *writerSuite) TestValidateValidationSetsCore18EnforcedHappy(c *C) {
+func (s *writerSuite) TestSeedWriterExtraAssertionsPrerequisitesError(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
-		"base":         "core18",
-		"gadget":       "pc=18",
-		"kernel":       "pc-kernel=18",
-		"validation-sets": []any{
-			map[string]any{
-				"account-id": "canonical",
-				"name":       "base-set",
-				// Enforce sequence 2, which requires revision
-				// 1 of pc-kernel and pc
-				"sequence": "2",
-				"mode":     "enforce",
-			},
-		},
+		"gadget":       "pc=20",
+		"kernel":       "pc-kernel=20",
+		"base":         "core20",
 	})
 
-	// validity of the core18 model
-	c.Assert(model.Grade(), Equals, asserts.ModelGradeUnset)
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
 
-	// setup a few validation set assertions in store
-	s.setupValidationSets(c)
+	proxyStoreAssertion, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
+		"store":        "my-proxy-store",
+		"operator-id":  "other-brand",
+		"authority-id": "canonical",
+		"url":          "https://my-proxy-store.com",
+		"timestamp":    time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
 
-	s.makeSnap(c, "snapd", "")
-	s.makeSnap(c, "core18", "")
-	s.makeSnap(c, "pc-kernel=18", "")
-	s.makeSnap(c, "pc=18", "")
+	accountAssertion, err := s.StoreSigning.Sign(asserts.AccountType, map[string]any{
+		"type":         "account",
+		"authority-id": "not-canonical",
+		"account-id":   "other-brand",
+		"validation":   "verified",
+		"display-name": "Predef",
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+
+	s.opts.ExtraAssertions = []asserts.Assertion{proxyStoreAssertion, accountAssertion}
 
-	s.opts.Label = "20191122"
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
 	err = w.Start(s.db, s.rf)
-	c.Assert(err, IsNil)
+	c.Assert(err.Error(), testutil.Contains, "cannot fetch and check prerequisites for an injected assertion: "+
+		"prerequisite injected assertion: error finding matching public key for signature: found public key \""+
+		s.StoreSigning.KeyID+"\" from \"canonical\" but expected it from: not-canonical")
+}
 
-	localSnaps, err := w.LocalSnaps()
-	c.Assert(err, IsNil)
-	c.Assert(localSnaps, HasLen, 0)
+func (s *writerSuite) TestSeedWriterPrefetchedSnapAssertionsWrongSnapID(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"gadget":       "pc=20",
+		"kernel":       "pc-kernel=20",
+		"base":         "core20",
+	})
 
-	for _, sn := range localSnaps {
-		_, _, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
-		c.Assert(errors.Is(err, &asserts.NotFoundError{}), Equals, true)
-		f, err := snapfile.Open(sn.Path)
-		c.Assert(err, IsNil)
-		info, err := snap.ReadInfoFromSnapFile(f, nil)
-		c.Assert(err, IsNil)
-		w.SetInfo(sn, info, nil)
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+
+	s.opts.PrefetchedSnapAssertions = map[string][]asserts.Assertion{
+		s.AssertedSnapID("pc"): {s.AssertedSnapRevision("pc-kernel")},
 	}
 
-	err = w.InfoDerived()
+	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
-	snaps, err := w.SnapsToDownload()
-	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 4)
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, ErrorMatches, fmt.Sprintf(`cannot use prefetched snap-revision assertion for snap-id %q: assertion is for snap-id %q`, s.AssertedSnapID("pc"), s.AssertedSnapID("pc-kernel")))
+}
 
-	for _, sn := range snaps {
-		channel := "stable"
-		switch sn.SnapName() {
-		case "pc", "pc-kernel":
-			channel = "18"
+// readSeedAssertions decodes all the assertions in the files under dir.
+func readSeedAssertions(c *C, dir string) []asserts.Assertion {
+	var as []asserts.Assertion
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
 		}
-		c.Check(sn.Channel, Equals, channel)
-		s.fillDownloadedSnap(c, w, sn)
-	}
-
-	complete, err := w.Downloaded(s.fetchAsserts(c))
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		dec := asserts.NewDecoder(f)
+		for {
+			a, err := dec.Decode()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			as = append(as, a)
+		}
+	})
 	c.Assert(err, IsNil)
-	c.Check(complete, Equals, true)
+	return as
+}
 
-	err = w.CheckValidationSets()
-	c.Assert(err, IsNil)
+func (s *writerSuite) checkOmittedTrustedKeyChains(c *C, as []asserts.Assertion, snaps int) {
+	omitted := make(map[string]bool)
+	for _, a := range s.opts.Trusted {
+		omitted[a.Ref().Unique()] = true
+	}
+	counts := make(map[string]int)
+	for _, a := range as {
+		c.Check(omitted[a.Ref().Unique()], Equals, false, Commentf("%v", a.Ref()))
+		counts[a.Type().Name]++
+	}
+	c.Check(counts["model"], Equals, 1)
+	c.Check(counts["snap-declaration"], Equals, snaps)
+	c.Check(counts["snap-revision"], Equals, snaps)
+	// the chain of the developer is not trusted and still written
+	c.Check(counts["account"], Equals, 1)
+	c.Check(counts["account-key"], Equals, 0)
+}
 
-	err = w.SeedSnaps(func(name, src, dst string) error {
-		return osutil.CopyFile(src, dst, 0)
+func (s *writerSuite) deviceTrustedKeyChains() []asserts.Assertion {
+	return []asserts.Assertion{
+		s.StoreSigning.StoreAccountKey(""),
+		s.Brands.Account("my-brand"),
+		s.Brands.AccountKey("my-brand"),
+	}
+}
+
+func (s *writerSuite) TestSeedWriterOmitTrustedKeyChainsCore18(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"cont-consumer", "cont-producer"},
 	})
-	c.Assert(err, IsNil)
 
-	err = w.WriteMeta()
-	c.Assert(err, IsNil)
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "cont-producer", "developerid")
+	s.makeSnap(c, "cont-consumer", "developerid")
 
-	// check seed
-	seedYaml, err := seedwriter.InternalReadSeedYaml(filepath.Join(s.opts.SeedDir, "seed.yaml"))
+	s.opts.OmitTrustedKeyChains = true
+	s.opts.Trusted = s.deviceTrustedKeyChains()
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
 	c.Assert(err, IsNil)
-	c.Assert(seedYaml.Snaps, HasLen, 4)
+	c.Check(complete, Equals, true)
 
-	// check snaps
-	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
-	c.Assert(err, IsNil)
-	c.Check(l, HasLen, 4)
+	c.Assert(w.SeedSnaps(nil), IsNil)
+	c.Assert(w.WriteMeta(), IsNil)
 
-	// check assertions directory contains the validation set assertion
-	seedAssertsDir := filepath.Join(s.opts.SeedDir, "assertions")
-	p := filepath.Join(seedAssertsDir, fmt.Sprintf("16,canonical,%s,2.validation-set", "base-set"))
-	decl := seedtest.ReadAssertions(c, p)
-	c.Assert(decl, HasLen, 1)
-	c.Check(decl[0].Type(), Equals, asserts.ValidationSetType)
-	c.Check(decl[0].HeaderString("account-id"), Equals, "canonical")
-	c.Check(decl[0].HeaderString("name"), Equals, "base-set")
-	c.Check(decl[0].HeaderString("sequence"), Equals, "2")
+	s.checkOmittedTrustedKeyChains(c, readSeedAssertions(c, filepath.Join(s.opts.SeedDir, "assertions")), 6)
+
+	// the seed can be loaded by a device trusting the omitted key chains
+	const usesSnapd = true
+	seedtest.ValidateSeed(c, s.opts.SeedDir, "", usesSnapd,
+		append(append([]asserts.Assertion(nil), s.StoreSigning.Trusted...), s.opts.Trusted...))
 }
 
-func (s *writerSuite) TestCheckValidateValidationSetsToEarly(c *C) {
+func (s *writerSuite) TestSeedWriterOmitTrustedKeyChainsCore20(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
-		"base":         "core18",
-		"gadget":       "pc=18",
-		"kernel":       "pc-kernel=18",
-		"validation-sets": []any{
+		"base":         "core20",
+		"snaps": []any{
 			map[string]any{
-				"account-id": "canonical",
-				"name":       "base-set",
-				// Enforce sequence 2, which requires revision
-				// 1 of pc-kernel and pc
-				"sequence": "2",
-				"mode":     "enforce",
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name": "core18",
+				"id":   s.AssertedSnapID("core18"),
+				"type": "base",
+			},
+			map[string]any{
+				"name": "cont-consumer",
+				"id":   s.AssertedSnapID("cont-consumer"),
+			},
+			map[string]any{
+				"name": "cont-producer",
+				"id":   s.AssertedSnapID("cont-producer"),
 			},
 		},
 	})
 
-	// validity of the core18 model
-	c.Assert(model.Grade(), Equals, asserts.ModelGradeUnset)
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "cont-producer", "developerid")
+	s.makeSnap(c, "cont-consumer", "developerid")
+
+	s.opts.Label = "20191003"
+	s.opts.OmitTrustedKeyChains = true
+	s.opts.Trusted = s.deviceTrustedKeyChains()
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	c.Assert(w.SeedSnaps(nil), IsNil)
+	c.Assert(w.WriteMeta(), IsNil)
+
+	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
+	as := readSeedAssertions(c, filepath.Join(systemDir, "assertions"))
+	as = append(as, readSeedAssertions(c, filepath.Join(systemDir, "model"))...)
+	s.checkOmittedTrustedKeyChains(c, as, 7)
+
+	// the seed can be loaded by a device trusting the omitted key chains
+	const usesSnapd = true
+	seedtest.ValidateSeed(c, s.opts.SeedDir, s.opts.Label, usesSnapd,
+		append(append([]asserts.Assertion(nil), s.StoreSigning.Trusted...), s.opts.Trusted...))
+}
+
+func (s *writerSuite) validateOptionsModel(grade string) *asserts.Model {
+	return s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core20",
+		"grade":        grade,
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name": "required20",
+				"id":   s.AssertedSnapID("required20"),
+				"components": map[string]any{
+					"comp1": "optional",
+				},
+			},
+		},
+	})
+}
 
-	// setup a few validation set assertions in store
-	s.setupValidationSets(c)
+func (s *writerSuite) validateOptionsSnaps(c *C) []*seedwriter.OptionsSnap {
+	localSnap := filepath.Join(c.MkDir(), "local.snap")
+	c.Assert(os.WriteFile(localSnap, nil, 0644), IsNil)
+	return []*seedwriter.OptionsSnap{
+		{Path: localSnap},
+		{Name: "extra"},
+		{Name: "pc", Channel: "edge"},
+		{Name: "pc-kernel", Revision: snap.R(7)},
+		{Name: "required20", Components: []seedwriter.OptionsComponent{{Name: "comp1"}, {Name: "comp2"}}},
+	}
+}
 
-	s.makeSnap(c, "snapd", "")
-	s.makeSnap(c, "core18", "")
-	s.makeSnap(c, "pc-kernel=18", "")
-	s.makeSnap(c, "pc=18", "")
+func (s *writerSuite) TestValidateOptionsAgainstModelAllViolations(c *C) {
+	model := s.validateOptionsModel("signed")
 
-	s.opts.Label = "20191122"
+	s.opts.Label = "20191003"
+	s.opts.ExtraAssertions = []asserts.Assertion{s.makeSystemUser(c, "my-brand", nil)}
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
-	// Perform the test after starting
-	err = w.Start(s.db, s.rf)
+	optSnaps := s.validateOptionsSnaps(c)
+	err = w.ValidateOptionsAgainstModel(optSnaps)
+	c.Assert(err, FitsTypeOf, &seedwriter.OptionsModelError{})
+	c.Check(err.(*seedwriter.OptionsModelError).Violations, HasLen, 6)
+	c.Check(err, ErrorMatches, `cannot use options with the model:
+- cannot use extra system-user assertion for "foo@bar.com" with a model of grade higher than dangerous
+- cannot use a local snap for option snap ".*/local.snap": cannot override channels, .* with a model of grade higher than dangerous
+- cannot use an extra snap for option snap "extra": cannot override channels, .* with a model of grade higher than dangerous
+- cannot override channels with a model of grade higher than dangerous but --snap=<snap-name> is allowed to select optional snaps to include
+- cannot use a revision for option snap "pc-kernel": cannot override channels, .* with a model of grade higher than dangerous
+- cannot use extra component "comp2" for option snap "required20": cannot override channels, .* with a model of grade higher than dangerous`)
+
+	// the writer can still be used
+	c.Assert(w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "pc"}}), IsNil)
+
+	// a single violation is reported inline
+	s.opts.ExtraAssertions = nil
+	err = w.ValidateOptionsAgainstModel([]*seedwriter.OptionsSnap{{Name: "extra"}})
+	c.Check(err, ErrorMatches, `cannot use options with the model: cannot use an extra snap for option snap "extra": .*`)
+}
+
+func (s *writerSuite) TestValidateOptionsAgainstModelDangerous(c *C) {
+	model := s.validateOptionsModel("dangerous")
+
+	s.opts.Label = "20191003"
+	s.opts.DefaultChannel = "edge"
+	s.opts.ExtraAssertions = []asserts.Assertion{s.makeSystemUser(c, "my-brand", nil)}
+	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
-	err = w.CheckValidationSets()
-	c.Check(err, ErrorMatches, `internal error: seedwriter.Writer cannot check validation-sets before Downloaded signaled complete`)
+	c.Check(w.ValidateOptionsAgainstModel(s.validateOptionsSnaps(c)), IsNil)
+
+	// other checks are still performed
+	s.opts.ExtraAssertions = []asserts.Assertion{s.makeSystemUser(c, "my-brand", map[string]any{
+		"models": []any{"other-model"},
+	})}
+	err = w.ValidateOptionsAgainstModel([]*seedwriter.OptionsSnap{{Name: "pc", Channel: "latest/foo/bar/baz"}})
+	c.Check(err, ErrorMatches, `cannot use options with the model:
+- cannot use system-user assertion for "foo@bar.com": "my-model" not in models \["other-model"\]
+- cannot use option channel for snap "pc": .*`)
 }
 
-func (s *writerSuite) TestManifestCorrectlyProduced(c *C) {
+func (s *writerSuite) TestSeedSnapsWriteMetaCore20OptionsOldLatest(c *C) {
+	// add store assertion
+	storeAs, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
+		"store":       "my-store",
+		"operator-id": "canonical",
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	err = s.StoreSigning.Add(storeAs)
+	c.Assert(err, IsNil)
+
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
+		"store":        "my-store",
 		"base":         "core20",
 		"grade":        "dangerous",
 		"snaps": []any{
@@ -4677,79 +8536,107 @@ func (s *writerSuite) TestManifestCorrectlyProduced(c *C) {
 				"id":              s.AssertedSnapID("pc"),
 				"type":            "gadget",
 				"default-channel": "20",
-			}},
+			},
+		},
 	})
+
+	// validity
 	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
 
 	s.makeSnap(c, "snapd", "")
 	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "core", "")
 	s.makeSnap(c, "pc-kernel=20", "")
 	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "oldlatest", "developerid")
 
-	s.opts.Label = "20191122"
-	s.opts.ManifestPath = path.Join(s.opts.SeedDir, "seed.manifest")
+	s.opts.Label = "20240621"
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "oldlatest", Channel: "latest/stable"}, {Name: "core"}})
+	c.Assert(err, IsNil)
+
 	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
 
-	localSnaps, err := w.LocalSnaps()
+	snaps, err := w.SnapsToDownload()
 	c.Assert(err, IsNil)
-	c.Assert(localSnaps, HasLen, 0)
+	c.Check(snaps, HasLen, 4)
 
-	for _, sn := range localSnaps {
-		_, _, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
-		c.Assert(errors.Is(err, &asserts.NotFoundError{}), Equals, true)
-		f, err := snapfile.Open(sn.Path)
-		c.Assert(err, IsNil)
-		info, err := snap.ReadInfoFromSnapFile(f, nil)
-		c.Assert(err, IsNil)
-		w.SetInfo(sn, info, nil)
+	for _, sn := range snaps {
+		s.fillDownloadedSnap(c, w, sn)
 	}
 
-	err = w.InfoDerived()
+	complete, err := w.Downloaded(s.fetchAsserts(c))
 	c.Assert(err, IsNil)
+	c.Check(complete, Equals, false)
 
-	snaps, err := w.SnapsToDownload()
+	snaps, err = w.SnapsToDownload()
 	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 4)
+	c.Check(snaps, HasLen, 2)
 
 	for _, sn := range snaps {
-		channel := "latest/stable"
-		switch sn.SnapName() {
-		case "pc", "pc-kernel":
-			channel = "20"
-		}
-		c.Check(sn.Channel, Equals, channel)
-		s.fillDownloadedSnap(c, w, sn)
+		info := s.doFillMetaDownloadedSnap(c, w, sn)
+
+		c.Assert(sn.Path, Equals, filepath.Join(s.opts.SeedDir, "systems", s.opts.Label, "snaps", info.Filename()))
+		err := os.Rename(s.AssertedSnap(sn.SnapName()), sn.Path)
+		c.Assert(err, IsNil)
 	}
 
-	complete, err := w.Downloaded(s.fetchAsserts(c))
+	complete, err = w.Downloaded(s.fetchAsserts(c))
 	c.Assert(err, IsNil)
 	c.Check(complete, Equals, true)
 
-	err = w.SeedSnaps(func(name, src, dst string) error {
-		return osutil.CopyFile(src, dst, 0)
-	})
+	err = w.SeedSnaps(nil)
 	c.Assert(err, IsNil)
 
 	err = w.WriteMeta()
 	c.Assert(err, IsNil)
 
-	b, err := os.ReadFile(path.Join(s.opts.SeedDir, "seed.manifest"))
+	// check seed
+	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
+	c.Check(systemDir, testutil.FilePresent)
+
+	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
 	c.Assert(err, IsNil)
-	c.Check(string(b), Equals, `core20 1
-pc 1
-pc-kernel 1
-snapd 1
-`)
+	c.Check(l, HasLen, 4)
+	l, err = os.ReadDir(filepath.Join(s.opts.SeedDir, "systems", s.opts.Label, "snaps"))
+	c.Assert(err, IsNil)
+	c.Check(l, HasLen, 2)
+
+	options20, err := seedwriter.InternalReadOptions20(filepath.Join(systemDir, "options.yaml"))
+	c.Assert(err, IsNil)
+
+	c.Check(options20.Snaps, DeepEquals, []*seedwriter.InternalSnap20{
+		{
+			Name:    "oldlatest",
+			SnapID:  s.AssertedSnapID("oldlatest"),
+			Channel: "latest/stable",
+		},
+		{
+			Name:    "core",
+			SnapID:  s.AssertedSnapID("core"),
+			Channel: "latest/stable",
+		},
+	})
 }
 
-func (s *writerSuite) TestManifestPreProvidedFailsMarkSeeding(c *C) {
+func (s *writerSuite) TestSeedSnapsWriteMetaCore20RequiredOldLatestOverride(c *C) {
+	// add store assertion
+	storeAs, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
+		"store":       "my-store",
+		"operator-id": "canonical",
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	err = s.StoreSigning.Add(storeAs)
+	c.Assert(err, IsNil)
+
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
+		"store":        "my-store",
 		"base":         "core20",
 		"grade":        "dangerous",
 		"snaps": []any{
@@ -4764,115 +8651,112 @@ func (s *writerSuite) TestManifestPreProvidedFailsMarkSeeding(c *C) {
 				"id":              s.AssertedSnapID("pc"),
 				"type":            "gadget",
 				"default-channel": "20",
-			}},
+			},
+			map[string]any{
+				"name":            "oldlatest",
+				"id":              s.AssertedSnapID("oldlatest"),
+				"default-channel": "20/stable",
+			},
+		},
 	})
+
+	// validity
 	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
 
 	s.makeSnap(c, "snapd", "")
 	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "core", "")
 	s.makeSnap(c, "pc-kernel=20", "")
 	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "oldlatest", "developerid")
 
-	s.opts.Manifest = seedwriter.MockManifest(map[string]*seedwriter.ManifestSnapRevision{
-		"core20": {
-			SnapName: "core20",
-			Revision: snap.R(20),
-		},
-	}, nil, nil, nil)
-
-	s.opts.Label = "20191122"
+	s.opts.Label = "20240621"
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "oldlatest", Channel: "latest/stable"}, {Name: "core"}})
+	c.Assert(err, IsNil)
+
 	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
 
-	localSnaps, err := w.LocalSnaps()
+	snaps, err := w.SnapsToDownload()
 	c.Assert(err, IsNil)
-	c.Assert(localSnaps, HasLen, 0)
+	c.Check(snaps, HasLen, 5)
 
-	for _, sn := range localSnaps {
-		_, _, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
-		c.Assert(errors.Is(err, &asserts.NotFoundError{}), Equals, true)
-		f, err := snapfile.Open(sn.Path)
-		c.Assert(err, IsNil)
-		info, err := snap.ReadInfoFromSnapFile(f, nil)
-		c.Assert(err, IsNil)
-		w.SetInfo(sn, info, nil)
+	for _, sn := range snaps {
+		s.fillDownloadedSnap(c, w, sn)
 	}
 
-	err = w.InfoDerived()
+	complete, err := w.Downloaded(s.fetchAsserts(c))
 	c.Assert(err, IsNil)
+	c.Check(complete, Equals, false)
 
-	snaps, err := w.SnapsToDownload()
+	snaps, err = w.SnapsToDownload()
 	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 4)
+	c.Check(snaps, HasLen, 1)
 
 	for _, sn := range snaps {
-		channel := "latest/stable"
-		switch sn.SnapName() {
-		case "pc", "pc-kernel":
-			channel = "20"
-		}
-		c.Check(sn.Channel, Equals, channel)
-		s.fillDownloadedSnap(c, w, sn)
+		info := s.doFillMetaDownloadedSnap(c, w, sn)
+
+		c.Assert(sn.Path, Equals, filepath.Join(s.opts.SeedDir, "systems", s.opts.Label, "snaps", info.Filename()))
+		err := os.Rename(s.AssertedSnap(sn.SnapName()), sn.Path)
+		c.Assert(err, IsNil)
 	}
 
-	complete, err := w.Downloaded(s.fetchAsserts(c))
+	complete, err = w.Downloaded(s.fetchAsserts(c))
 	c.Assert(err, IsNil)
 	c.Check(complete, Equals, true)
 
-	err = w.SeedSnaps(func(name, src, dst string) error {
-		return osutil.CopyFile(src, dst, 0)
-	})
-	c.Assert(err, ErrorMatches, `cannot record snap for manifest: snap "core20" \(1\) does not match the allowed revision 20`)
-}
+	err = w.SeedSnaps(nil)
+	c.Assert(err, IsNil)
 
-func (s *writerSuite) TestManifestPreProvidedSequenceNotMatchingModelSequence(c *C) {
-	model := s.Brands.Model("my-brand", "my-model", map[string]any{
-		"display-name": "my model",
-		"architecture": "amd64",
-		"base":         "core20",
-		"grade":        "dangerous",
-		"snaps": []any{
-			map[string]any{
-				"name":            "pc-kernel",
-				"id":              s.AssertedSnapID("pc-kernel"),
-				"type":            "kernel",
-				"default-channel": "20",
-			},
-			map[string]any{
-				"name":            "pc",
-				"id":              s.AssertedSnapID("pc"),
-				"type":            "gadget",
-				"default-channel": "20",
-			}},
-		"validation-sets": []any{
-			map[string]any{
-				"account-id": "canonical",
-				"name":       "base-set",
-				"sequence":   "2",
-				"mode":       "enforce",
-			},
-		},
-	})
-	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
 
-	s.opts.Manifest = seedwriter.NewManifest()
-	s.opts.Manifest.SetAllowedValidationSet("canonical", "base-set", 1, true)
+	// check seed
+	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
+	c.Check(systemDir, testutil.FilePresent)
 
-	s.opts.Label = "20191122"
-	w, err := seedwriter.New(model, s.opts)
+	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
+	c.Assert(err, IsNil)
+	c.Check(l, HasLen, 5)
+	l, err = os.ReadDir(filepath.Join(s.opts.SeedDir, "systems", s.opts.Label, "snaps"))
 	c.Assert(err, IsNil)
+	c.Check(l, HasLen, 1)
 
-	err = w.Start(s.db, s.rf)
-	c.Assert(err, ErrorMatches, `cannot use sequence 1 of "canonical/base-set": model requires sequence 2`)
+	options20, err := seedwriter.InternalReadOptions20(filepath.Join(systemDir, "options.yaml"))
+	c.Assert(err, IsNil)
+
+	c.Check(options20.Snaps, DeepEquals, []*seedwriter.InternalSnap20{
+		{
+			Name:    "oldlatest",
+			SnapID:  s.AssertedSnapID("oldlatest"),
+			Channel: "latest/stable",
+		},
+		{
+			Name:    "core",
+			SnapID:  s.AssertedSnapID("core"),
+			Channel: "latest/stable",
+		},
+	})
 }
 
-func (s *writerSuite) TestManifestPreProvidedSequenceNotMatchingModelPinned(c *C) {
+func (s *writerSuite) TestSeedSnapsWriteMetaCore20RequiredOldLatestOverrideMissingCore(c *C) {
+	// add store assertion
+	storeAs, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
+		"store":       "my-store",
+		"operator-id": "canonical",
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	err = s.StoreSigning.Add(storeAs)
+	c.Assert(err, IsNil)
+
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
+		"store":        "my-store",
 		"base":         "core20",
 		"grade":        "dangerous",
 		"snaps": []any{
@@ -4887,32 +8771,61 @@ func (s *writerSuite) TestManifestPreProvidedSequenceNotMatchingModelPinned(c *C
 				"id":              s.AssertedSnapID("pc"),
 				"type":            "gadget",
 				"default-channel": "20",
-			}},
-		"validation-sets": []any{
+			},
 			map[string]any{
-				"account-id": "canonical",
-				"name":       "base-set",
-				"mode":       "enforce",
+				"name":            "oldlatest",
+				"id":              s.AssertedSnapID("oldlatest"),
+				"default-channel": "20/stable",
 			},
 		},
 	})
+
+	// validity
 	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
 
-	s.opts.Manifest = seedwriter.NewManifest()
-	s.opts.Manifest.SetAllowedValidationSet("canonical", "base-set", 1, true)
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "oldlatest", "developerid")
 
-	s.opts.Label = "20191122"
+	s.opts.Label = "20240621"
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "oldlatest", Channel: "latest/stable"}})
+	c.Assert(err, IsNil)
+
 	err = w.Start(s.db, s.rf)
-	c.Assert(err, ErrorMatches, `pinning of "canonical/base-set" is not allowed by the model`)
+	c.Assert(err, IsNil)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Check(snaps, HasLen, 5)
+
+	for _, sn := range snaps {
+		s.fillDownloadedSnap(c, w, sn)
+	}
+
+	_, err = w.Downloaded(s.fetchAsserts(c))
+	c.Check(err, ErrorMatches, `prerequisites need to be added explicitly: cannot use snap "oldlatest": required snap "core" missing`)
 }
 
-func (s *writerSuite) TestValidateValidationSetsManifestsCorrectly(c *C) {
+func (s *writerSuite) TestSeedSnapsWriteMetaCore20RequiredOldLatestOverrideLocalCore(c *C) {
+	// add store assertion
+	storeAs, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
+		"store":       "my-store",
+		"operator-id": "canonical",
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	err = s.StoreSigning.Add(storeAs)
+	c.Assert(err, IsNil)
+
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
+		"store":        "my-store",
 		"base":         "core20",
 		"grade":        "dangerous",
 		"snaps": []any{
@@ -4927,12 +8840,11 @@ func (s *writerSuite) TestValidateValidationSetsManifestsCorrectly(c *C) {
 				"id":              s.AssertedSnapID("pc"),
 				"type":            "gadget",
 				"default-channel": "20",
-			}},
-		"validation-sets": []any{
+			},
 			map[string]any{
-				"account-id": "canonical",
-				"name":       "base-set",
-				"mode":       "enforce",
+				"name":            "oldlatest",
+				"id":              s.AssertedSnapID("oldlatest"),
+				"default-channel": "20/stable",
 			},
 		},
 	})
@@ -4940,43 +8852,38 @@ func (s *writerSuite) TestValidateValidationSetsManifestsCorrectly(c *C) {
 	// validity
 	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
 
-	// setup a few validation set assertions in store
-	s.setupValidationSets(c)
-
 	s.makeSnap(c, "snapd", "")
 	s.makeSnap(c, "core20", "")
+	corePath := s.makeLocalSnap(c, "core")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "oldlatest", "developerid")
 
-	// The first sequence of base-set requires revision 7 of
-	// the snaps
-	s.MakeAssertedSnap(c, snapYaml["pc-kernel=20"], snapFiles["pc-kernel=20"], snap.R(7), "canonical", s.StoreSigning.Database)
-	s.MakeAssertedSnap(c, snapYaml["pc=20"], snapFiles["pc=20"], snap.R(7), "canonical", s.StoreSigning.Database)
-
-	// Set up the manifest we need, and specifically ask for sequence
-	// 1 of the base-set, to avoid getting the newest.
-	manifest := seedwriter.NewManifest()
-	manifest.SetAllowedValidationSet("canonical", "base-set", 1, false)
-	s.opts.Manifest = manifest
-	s.opts.ManifestPath = path.Join(s.opts.SeedDir, "seed.manifest")
-
-	s.opts.Label = "20191122"
+	s.opts.Label = "20240621"
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "oldlatest", Channel: "latest/stable"}, {Path: corePath}})
+	c.Assert(err, IsNil)
+
 	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
 
 	localSnaps, err := w.LocalSnaps()
 	c.Assert(err, IsNil)
-	c.Assert(localSnaps, HasLen, 0)
+	c.Assert(localSnaps, HasLen, 1)
 
 	for _, sn := range localSnaps {
-		_, _, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
-		c.Assert(errors.Is(err, &asserts.NotFoundError{}), Equals, true)
+		si, aRefs, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
+		if !errors.Is(err, &asserts.NotFoundError{}) {
+			c.Assert(err, IsNil)
+		}
 		f, err := snapfile.Open(sn.Path)
 		c.Assert(err, IsNil)
-		info, err := snap.ReadInfoFromSnapFile(f, nil)
+		info, err := snap.ReadInfoFromSnapFile(f, si)
 		c.Assert(err, IsNil)
 		w.SetInfo(sn, info, nil)
+		s.aRefs[sn.SnapName()] = aRefs
 	}
 
 	err = w.InfoDerived()
@@ -4984,28 +8891,29 @@ func (s *writerSuite) TestValidateValidationSetsManifestsCorrectly(c *C) {
 
 	snaps, err := w.SnapsToDownload()
 	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 4)
+	c.Check(snaps, HasLen, 5)
 
 	for _, sn := range snaps {
-		channel := "latest/stable"
-		switch sn.SnapName() {
-		case "pc", "pc-kernel":
-			channel = "20"
-		}
-		c.Check(sn.Channel, Equals, channel)
 		s.fillDownloadedSnap(c, w, sn)
 	}
 
 	complete, err := w.Downloaded(s.fetchAsserts(c))
 	c.Assert(err, IsNil)
-	c.Check(complete, Equals, true)
+	c.Check(complete, Equals, false)
 
-	err = w.CheckValidationSets()
+	snaps, err = w.SnapsToDownload()
 	c.Assert(err, IsNil)
+	c.Check(snaps, HasLen, 0)
 
-	err = w.SeedSnaps(func(name, src, dst string) error {
+	complete, err = w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	copySnap := func(name, src, dst string) error {
 		return osutil.CopyFile(src, dst, 0)
-	})
+	}
+
+	err = w.SeedSnaps(copySnap)
 	c.Assert(err, IsNil)
 
 	err = w.WriteMeta()
@@ -5015,141 +8923,183 @@ func (s *writerSuite) TestValidateValidationSetsManifestsCorrectly(c *C) {
 	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
 	c.Check(systemDir, testutil.FilePresent)
 
-	// check that model-etc contains the correct validation-set assert
-	seedAssertsDir := filepath.Join(systemDir, "assertions")
-	c.Check(filepath.Join(seedAssertsDir, "model-etc"), testutil.FileContains, `type: validation-set
-authority-id: canonical
-series: 16
-account-id: canonical
-name: base-set
-sequence: 1`)
+	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
+	c.Assert(err, IsNil)
+	c.Check(l, HasLen, 5)
+	l, err = os.ReadDir(filepath.Join(s.opts.SeedDir, "systems", s.opts.Label, "snaps"))
+	c.Assert(err, IsNil)
+	c.Check(l, HasLen, 1)
 
-	// verify that the manifest was correctly produced, now that
-	// the manifest is tracking validation-sets, then we should not
-	// see pc/pc-kernel in the manifest, instead it should just show
-	// the validation-set tracking those.
-	m, err := os.ReadFile(s.opts.ManifestPath)
+	options20, err := seedwriter.InternalReadOptions20(filepath.Join(systemDir, "options.yaml"))
 	c.Assert(err, IsNil)
-	c.Check(string(m), Equals, `canonical/base-set 1
-core20 1
-snapd 1
-`)
+
+	c.Check(options20.Snaps, DeepEquals, []*seedwriter.InternalSnap20{
+		{
+			Name:    "oldlatest",
+			SnapID:  s.AssertedSnapID("oldlatest"),
+			Channel: "latest/stable",
+		},
+		{
+			Name:       "core",
+			Unasserted: "core_1.0.snap",
+		},
+	})
 }
 
-func (s *writerSuite) TestOptionalComponentNotIncluded(c *C) {
-	comps := map[string]any{
-		"comp1": "required",
-		"comp2": "optional",
-	}
+func (s *writerSuite) TestDevmodeSnapsCore20Dangerous(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
-		"store":        "my-store",
-		"base":         "core24",
+		"base":         "core20",
+		"grade":        "dangerous",
 		"snaps": []any{
 			map[string]any{
 				"name":            "pc-kernel",
 				"id":              s.AssertedSnapID("pc-kernel"),
 				"type":            "kernel",
-				"default-channel": "24",
+				"default-channel": "20",
 			},
 			map[string]any{
 				"name":            "pc",
 				"id":              s.AssertedSnapID("pc"),
 				"type":            "gadget",
-				"default-channel": "24",
+				"default-channel": "20",
 			},
 			map[string]any{
-				"name":       "required20",
-				"id":         s.AssertedSnapID("required20"),
-				"components": comps,
+				"name": "test-devmode",
+				"id":   s.AssertedSnapID("test-devmode"),
 			},
 		},
 	})
 
-	// No options
-	s.opts.Label = "20240712"
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "test-devmode=20", "")
+
+	s.opts.Label = "20191107"
+
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
-	err = w.SetOptionsSnaps(nil)
-	c.Assert(err, IsNil)
+	// not available before Downloaded signaled complete
+	c.Check(w.DevmodeSnaps(), IsNil)
 
 	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
 
 	snaps, err := w.SnapsToDownload()
 	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 5)
-	cref1 := naming.NewComponentRef("required20", "comp1")
-	c.Check(snaps[4].Components, DeepEquals, []seedwriter.SeedComponent{{
-		ComponentRef: cref1,
-	}})
+	c.Assert(snaps, HasLen, 5)
 
-	// Options contains the already required snap
-	s.opts.Label = "20240713"
-	w, err = seedwriter.New(model, s.opts)
-	c.Assert(err, IsNil)
+	for _, sn := range snaps {
+		s.fillDownloadedSnap(c, w, sn)
+	}
 
-	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{
-		Name:       "required20",
-		Components: []seedwriter.OptionsComponent{{Name: "comp1"}},
-	}})
+	complete, err := w.Downloaded(s.fetchAsserts(c))
 	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, true)
 
-	err = w.Start(s.db, s.rf)
-	c.Assert(err, IsNil)
+	c.Check(w.DevmodeSnaps(), DeepEquals, []string{"test-devmode"})
+}
 
-	snaps, err = w.SnapsToDownload()
+func (s *writerSuite) TestDevmodeSnapsNone(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"required18"},
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "required18", "developerid")
+
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
 	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 5)
-	c.Check(snaps[4].Components, DeepEquals, []seedwriter.SeedComponent{{
-		ComponentRef: cref1,
-	}})
+	c.Assert(complete, Equals, true)
+
+	c.Check(w.DevmodeSnaps(), HasLen, 0)
+}
+
+func (s *writerSuite) TestInclusionReasonsCore18(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"cont-consumer", "cont-producer"},
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "cont-producer", "developerid")
+	s.makeSnap(c, "cont-consumer", "developerid")
+	s.makeSnap(c, "core", "")
+	s.makeSnap(c, "required", "developerid")
 
-	// Ask for optional component to be included
-	s.opts.Label = "20240714"
-	w, err = seedwriter.New(model, s.opts)
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c), &seedwriter.OptionsSnap{Name: "required"})
 	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, false)
 
-	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{
-		Name:       "required20",
-		Components: []seedwriter.OptionsComponent{{Name: "comp2"}},
-	}})
+	// not available before Downloaded signaled complete
+	c.Check(w.InclusionReasons(), IsNil)
+
+	snaps, err := w.SnapsToDownload()
 	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 1)
+	s.fillDownloadedSnap(c, w, snaps[0])
 
-	err = w.Start(s.db, s.rf)
+	complete, err = w.Downloaded(s.fetchAsserts(c))
 	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, false)
 
+	// core is pulled in implicitly for required
 	snaps, err = w.SnapsToDownload()
 	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 5)
-	cref2 := naming.NewComponentRef("required20", "comp2")
-	compsSl := snaps[4].Components
-	sort.Slice(compsSl, func(i, j int) bool {
-		return compsSl[i].ComponentName < compsSl[j].ComponentName
-	})
-	c.Check(compsSl, DeepEquals, []seedwriter.SeedComponent{
-		{ComponentRef: cref1},
-		{ComponentRef: cref2},
-	})
-}
+	c.Assert(snaps, HasLen, 1)
+	c.Check(snaps[0].SnapName(), Equals, "core")
+	s.fillDownloadedSnap(c, w, snaps[0])
 
-func (s *writerSuite) TestSeedSnapsWriteMetaCore20BadLocalComps(c *C) {
-	// add store assertion
-	storeAs, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
-		"store":       "my-store",
-		"operator-id": "canonical",
-		"timestamp":   time.Now().UTC().Format(time.RFC3339),
-	}, nil, "")
-	c.Assert(err, IsNil)
-	err = s.StoreSigning.Add(storeAs)
+	complete, err = w.Downloaded(s.fetchAsserts(c))
 	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, true)
+
+	c.Check(w.InclusionReasons(), DeepEquals, map[string][]string{
+		"snapd":     {"system snap"},
+		"pc-kernel": {"required by model"},
+		"core18": {
+			"required by model",
+			"base of pc",
+			"base of cont-consumer",
+			"base of cont-producer",
+		},
+		"pc":            {"required by model"},
+		"cont-consumer": {"required by model"},
+		"cont-producer": {
+			"required by model",
+			`default-provider for content "cont" of cont-consumer`,
+		},
+		"required": {"requested by options"},
+		"core": {
+			"implicitly required",
+			"base of required",
+		},
+	})
+}
 
+func (s *writerSuite) TestInclusionReasonsCore20Optional(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
-		"store":        "my-store",
 		"base":         "core20",
 		"grade":        "dangerous",
 		"snaps": []any{
@@ -5166,331 +9116,585 @@ func (s *writerSuite) TestSeedSnapsWriteMetaCore20BadLocalComps(c *C) {
 				"default-channel": "20",
 			},
 			map[string]any{
-				"name": "required20",
-				"id":   s.AssertedSnapID("required20"),
+				"name":     "optional20-a",
+				"id":       s.AssertedSnapID("optional20-a"),
+				"presence": "optional",
+			},
+			map[string]any{
+				"name":     "optional20-b",
+				"id":       s.AssertedSnapID("optional20-b"),
+				"presence": "optional",
 			},
 		},
 	})
 
-	// validity
-	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
-
 	s.makeSnap(c, "snapd", "")
 	s.makeSnap(c, "core20", "")
 	s.makeSnap(c, "pc-kernel=20", "")
 	s.makeSnap(c, "pc=20", "")
-	requiredFn := s.makeLocalSnap(c, "required20")
-
-	s.opts.Label = "20191030"
-	w, err := seedwriter.New(model, s.opts)
-	c.Assert(err, IsNil)
-
-	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Path: requiredFn}})
-	c.Assert(err, IsNil)
-
-	err = w.Start(s.db, s.rf)
-	c.Assert(err, IsNil)
+	s.makeSnap(c, "optional20-a", "developerid")
+	s.makeSnap(c, "optional20-b", "developerid")
 
-	localSnaps, err := w.LocalSnaps()
-	c.Assert(err, IsNil)
-	c.Assert(localSnaps, HasLen, 1)
+	s.opts.Label = "20191107"
 
-	sn := localSnaps[0]
-	_, _, err = seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
-	c.Assert(errors.Is(err, &asserts.NotFoundError{}), Equals, true)
-	f, err := snapfile.Open(sn.Path)
-	c.Assert(err, IsNil)
-	info, err := snap.ReadInfoFromSnapFile(f, nil)
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c), &seedwriter.OptionsSnap{Name: "optional20-a"})
 	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, true)
 
-	seedComps := map[string]*seedwriter.SeedComponent{}
-	cref1 := naming.NewComponentRef("required20", "comp-undefined")
-	cinfo1 := snap.NewComponentInfo(cref1, snap.StandardComponent, "1.0", "", "", "", nil)
-	seedComps["comp-undefined"] = &seedwriter.SeedComponent{
-		ComponentRef: cref1,
-		Path:         "/some/path/file.comp",
-		Info:         cinfo1,
-	}
-	c.Assert(w.SetInfo(sn, info, seedComps), ErrorMatches,
-		`component comp-undefined is not defined by snap required20`)
-
-	seedComps = map[string]*seedwriter.SeedComponent{}
-	cref1 = naming.NewComponentRef("required20", "comp1")
-	cinfo1 = snap.NewComponentInfo(cref1, snap.KernelModulesComponent, "1.0", "", "", "", nil)
-	seedComps["comp1"] = &seedwriter.SeedComponent{
-		ComponentRef: cref1,
-		Path:         "/some/path/file.comp",
-		Info:         cinfo1,
-	}
-	c.Assert(w.SetInfo(sn, info, seedComps), ErrorMatches,
-		`component comp1 has type kernel-modules while snap required20 defines type standard for it`)
+	c.Check(w.InclusionReasons(), DeepEquals, map[string][]string{
+		"snapd":        {"system snap"},
+		"pc-kernel":    {"required by model"},
+		"core20":       {"required by model", "base of pc", "base of optional20-a"},
+		"pc":           {"required by model"},
+		"optional20-a": {"optional in model, requested by options"},
+	})
 }
 
-func (s *writerSuite) TestVerifySnapBootstrapCompatibility(c *C) {
+func (s *writerSuite) TestContentInterfaceReportCore20Modes(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
 		"store":        "my-store",
-		"base":         "core24",
+		"base":         "core20",
 		"snaps": []any{
 			map[string]any{
 				"name":            "pc-kernel",
 				"id":              s.AssertedSnapID("pc-kernel"),
 				"type":            "kernel",
-				"default-channel": "24/stable",
+				"default-channel": "20",
 			},
 			map[string]any{
 				"name":            "pc",
 				"id":              s.AssertedSnapID("pc"),
 				"type":            "gadget",
-				"default-channel": "24/stable",
+				"default-channel": "20",
 			},
 			map[string]any{
-				"name":            "snapd",
-				"id":              s.AssertedSnapID("snapd"),
-				"type":            "snapd",
-				"default-channel": "latest/stable",
+				"name":  "core18",
+				"id":    s.AssertedSnapID("core18"),
+				"type":  "base",
+				"modes": []any{"run", "ephemeral"},
 			},
 			map[string]any{
-				"name":            "core24",
-				"id":              s.AssertedSnapID("core24"),
-				"type":            "base",
-				"default-channel": "latest/stable",
+				"name": "cont-producer",
+				"id":   s.AssertedSnapID("cont-producer"),
+			},
+			map[string]any{
+				"name":  "cont-consumer",
+				"id":    s.AssertedSnapID("cont-consumer"),
+				"modes": []any{"run", "recover"},
+			},
+			map[string]any{
+				"name":  "alt-cont-producer",
+				"id":    s.AssertedSnapID("alt-cont-producer"),
+				"modes": []any{"recover"},
 			},
 		},
 	})
 
-	s.opts.Label = "20250220"
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "cont-producer", "developerid")
+	s.makeSnap(c, "cont-consumer", "developerid")
+	s.makeSnap(c, "alt-cont-producer", "developerid")
+
+	s.opts.Label = "20191003"
+
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+	// not available before Downloaded signaled complete
+	c.Check(w.ContentInterfaceReport(), IsNil)
+
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	// the default provider is present in run mode but in recover mode
+	// only an alternative provider is
+	c.Check(w.ContentInterfaceReport(), DeepEquals, []seedwriter.ContentGap{{
+		Mode:       "recover",
+		ContentTag: "cont",
+		Consumers:  []string{"cont-consumer"},
+		Providers:  []string{"alt-cont-producer"},
+	}})
+}
+
+func (s *writerSuite) TestContentInterfaceReportNoProvider(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"cont-consumer-no-default", "cont-consumer", "alt-cont-producer"},
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "cont-consumer-no-default", "developerid")
+	s.makeSnap(c, "cont-consumer", "developerid")
+	s.makeSnap(c, "alt-cont-producer", "developerid")
+
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	c.Check(w.ContentInterfaceReport(), DeepEquals, []seedwriter.ContentGap{{
+		Mode:       "run",
+		ContentTag: "cont",
+		Consumers:  []string{"cont-consumer-no-default", "cont-consumer"},
+		Providers:  []string{"alt-cont-producer"},
+	}, {
+		Mode:       "run",
+		ContentTag: "other-cont",
+		Consumers:  []string{"cont-consumer-no-default"},
+	}})
+}
+
+func (s *writerSuite) TestContentInterfaceReportNoGaps(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"cont-consumer", "cont-producer", "alt-cont-producer"},
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "cont-consumer", "developerid")
+	s.makeSnap(c, "cont-producer", "developerid")
+	s.makeSnap(c, "alt-cont-producer", "developerid")
+
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	c.Check(w.ContentInterfaceReport(), HasLen, 0)
+}
+
+func (s *writerSuite) TestContentInterfaceReportDefaultProviderSlot(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"cont-consumer-slot-default", "cont-producer", "alt-cont-producer"},
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "cont-consumer-slot-default", "developerid")
+	s.makeSnap(c, "cont-producer", "developerid")
+	s.makeSnap(c, "alt-cont-producer", "developerid")
+
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	// default-provider in the snap:slot form is matched by snap name
+	c.Check(w.ContentInterfaceReport(), HasLen, 0)
+}
+
+func (s *writerSuite) TestContentInterfaceReportDefaultProviderSlotMissing(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"cont-consumer-slot-default", "alt-cont-producer"},
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "cont-consumer-slot-default", "developerid")
+	s.makeSnap(c, "alt-cont-producer", "developerid")
+
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	c.Check(w.ContentInterfaceReport(), DeepEquals, []seedwriter.ContentGap{{
+		Mode:       "run",
+		ContentTag: "cont",
+		Consumers:  []string{"cont-consumer-slot-default"},
+		Providers:  []string{"alt-cont-producer"},
+	}})
+}
+
+func (s *writerSuite) TestDetectSlotConflicts(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"dbus-provider", "alt-dbus-provider"},
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "dbus-provider", "developerid")
+	s.makeSnap(c, "alt-dbus-provider", "developerid")
 
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
-	newSnapd := `VERSION=2.68`
-	oldSnapd := `VERSION=2.67+git123`
-
-	snapdFiles := [][]string{
-		{"/usr/lib/snapd/info", newSnapd},
-	}
-	kernelFiles := [][]string{
-		{"/snapd-info", oldSnapd},
-	}
-
-	s.MakeAssertedSnap(c, snapYaml["snapd"], snapdFiles, snap.R(1), "canonical", s.StoreSigning.Database)
-	s.MakeAssertedSnap(c, snapYaml["pc-kernel"], kernelFiles, snap.R(1), "canonical", s.StoreSigning.Database)
-	s.makeSnap(c, "core24", "")
-	s.makeSnap(c, "pc", "")
-
-	err = w.Start(s.db, s.rf)
-	c.Assert(err, IsNil)
+	// not available before Downloaded signaled complete
+	c.Check(w.DetectSlotConflicts(), IsNil)
 
-	snaps, err := w.SnapsToDownload()
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
 	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 4)
-
-	for _, sn := range snaps {
-		s.fillDownloadedSnap(c, w, sn)
-	}
+	c.Assert(complete, Equals, true)
 
-	err = w.VerifySnapBootstrapCompatibility()
-	c.Check(err, ErrorMatches, `snapd 2.68[+] is not compatible with a kernel containing snapd prior to 2.68`)
+	c.Check(w.DetectSlotConflicts(), DeepEquals, []seedwriter.SlotConflict{
+		{
+			Interface: "dbus",
+			Name:      "system:org.example.Service",
+			Snaps:     []string{"dbus-provider", "alt-dbus-provider"},
+		},
+	})
 }
 
-func (s *writerSuite) testSeedWriterExtraAssertionsCore18(c *C, reverseOrder bool) {
+func (s *writerSuite) TestDetectSlotConflictsNone(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
-		"display-name": "my model",
-		"architecture": "amd64",
-		"gadget":       "pc=18",
-		"kernel":       "pc-kernel=18",
-		"base":         "core18",
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"dbus-provider"},
 	})
 
 	s.makeSnap(c, "snapd", "")
 	s.makeSnap(c, "core18", "")
 	s.makeSnap(c, "pc-kernel=18", "")
 	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "dbus-provider", "developerid")
 
-	proxyStoreAssertion, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
-		"store":        "my-proxy-store",
-		"operator-id":  "other-brand",
-		"authority-id": "canonical",
-		"url":          "https://my-proxy-store.com",
-		"timestamp":    time.Now().UTC().Format(time.RFC3339),
-	}, nil, "")
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
 	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, true)
 
-	accountAssertion, err := s.StoreSigning.Sign(asserts.AccountType, map[string]any{
-		"type":         "account",
-		"authority-id": "canonical",
-		"account-id":   "other-brand",
-		"validation":   "verified",
-		"display-name": "Predef",
-		"timestamp":    time.Now().Format(time.RFC3339),
-	}, nil, "")
-	c.Assert(err, IsNil)
+	// the same name on different buses does not conflict
+	c.Check(w.DetectSlotConflicts(), HasLen, 0)
+}
 
-	if reverseOrder {
-		s.opts.ExtraAssertions = []asserts.Assertion{proxyStoreAssertion, accountAssertion}
-	} else {
-		s.opts.ExtraAssertions = []asserts.Assertion{accountAssertion, proxyStoreAssertion}
-	}
+func (s *writerSuite) TestAssertionFreshness(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"required18"},
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "required18", "developerid")
+
+	now := time.Now().Add(24 * time.Hour)
+	defer seedwriter.MockTimeNow(func() time.Time { return now })()
 
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
+	_, err = w.AssertionFreshness()
+	c.Check(err, ErrorMatches, "internal error: seedwriter.Writer cannot query seed snaps before Downloaded signaled complete")
 
-	err = w.Start(s.db, s.rf)
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
 	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, true)
 
-	snaps, err := w.SnapsToDownload()
+	ages, err := w.AssertionFreshness()
 	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 4)
+	c.Assert(ages, Not(HasLen), 0)
 
-	c.Check(naming.SameSnap(snaps[0], naming.Snap("snapd")), Equals, true)
-	c.Check(naming.SameSnap(snaps[1], naming.Snap("pc-kernel")), Equals, true)
-	c.Check(naming.SameSnap(snaps[2], naming.Snap("core18")), Equals, true)
-	c.Check(naming.SameSnap(snaps[3], naming.Snap("pc")), Equals, true)
+	byType := make(map[string]int)
+	for _, age := range ages {
+		byType[age.Type.Name]++
+		c.Check(age.Timestamp.IsZero(), Equals, false)
+		c.Check(age.Age, Equals, now.Sub(age.Timestamp))
+		c.Check(age.Age > 0, Equals, true)
+	}
+	c.Check(byType["model"], Equals, 1)
+	// one snap-declaration and one snap-revision per seed snap
+	c.Check(byType["snap-declaration"], Equals, 5)
+	c.Check(byType["snap-revision"], Equals, 5)
+	c.Check(byType["account-key"] > 0, Equals, true)
+	c.Check(byType["account"] > 0, Equals, true)
 
-	for _, sn := range snaps {
-		s.fillDownloadedSnap(c, w, sn)
+	for _, age := range ages {
+		if age.Type != asserts.ModelType {
+			continue
+		}
+		c.Check(age.PrimaryKey, DeepEquals, []string{"16", "my-brand", "my-model"})
+		c.Check(age.Timestamp.Equal(model.Timestamp()), Equals, true)
 	}
 
-	complete, err := w.Downloaded(s.fetchAsserts(c))
-	c.Assert(err, IsNil)
-	c.Check(complete, Equals, true)
+	// no warnings without MaxAssertionAge
+	c.Check(w.Warnings(), HasLen, 0)
+}
 
-	essSnaps, err := w.BootSnaps()
-	c.Assert(err, IsNil)
-	c.Check(essSnaps, DeepEquals, snaps[:4])
+func (s *writerSuite) TestAssertionGraph(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"required18"},
+	})
 
-	c.Check(w.Warnings(), HasLen, 0)
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "required18", "developerid")
 
-	err = w.SeedSnaps(nil)
+	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
+	c.Check(w.AssertionGraph(), IsNil)
 
-	err = w.WriteMeta()
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
 	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, true)
 
-	// check assertions
-	seedAssertsDir := filepath.Join(s.opts.SeedDir, "assertions")
+	g := w.AssertionGraph()
+	c.Assert(g, NotNil)
 
-	c.Assert(filepath.Join(seedAssertsDir, "my-proxy-store.store"), testutil.FilePresent)
-	c.Assert(filepath.Join(seedAssertsDir, "other-brand.account"), testutil.FilePresent)
+	inGraph := func(ref *asserts.Ref) bool {
+		for _, n := range g.Nodes {
+			if n.Unique() == ref.Unique() {
+				return true
+			}
+		}
+		return false
+	}
+
+	snapID := s.AssertedSnapID("required18")
+	snapRev := s.AssertedSnapRevision("required18")
+	revRef := snapRev.Ref()
+	declRef := &asserts.Ref{Type: asserts.SnapDeclarationType, PrimaryKey: []string{"16", snapID}}
+	devRef := &asserts.Ref{Type: asserts.AccountType, PrimaryKey: []string{"developerid"}}
+	storeKeyRef := &asserts.Ref{Type: asserts.AccountKeyType, PrimaryKey: []string{snapRev.SignKeyID()}}
+	c.Check(inGraph(revRef), Equals, true)
+	c.Check(inGraph(declRef), Equals, true)
+	c.Check(inGraph(devRef), Equals, true)
+
+	// snap-revision -> snap-declaration, developer account and store key
+	c.Check(g.Dependencies(revRef), DeepEquals, []*asserts.Ref{declRef, devRef, storeKeyRef})
+	// snap-declaration -> publisher account and store key
+	c.Check(g.Dependencies(declRef), DeepEquals, []*asserts.Ref{devRef, storeKeyRef})
+	// developer account -> store key
+	c.Check(g.Dependencies(devRef), DeepEquals, []*asserts.Ref{storeKeyRef})
+
+	// model -> brand account-key
+	modelDeps := g.Dependencies(model.Ref())
+	c.Assert(modelDeps, HasLen, 1)
+	c.Check(modelDeps[0].Type, Equals, asserts.AccountKeyType)
+	c.Check(modelDeps[0].PrimaryKey, DeepEquals, []string{model.SignKeyID()})
+	c.Check(inGraph(modelDeps[0]), Equals, true)
+
+	// the chain ends with trusted assertions
+	c.Check(g.Predefined, Not(HasLen), 0)
+	for _, ref := range g.Predefined {
+		c.Check(inGraph(ref), Equals, false)
+	}
+	c.Check(g.Missing(), HasLen, 0)
 }
 
-func (s *writerSuite) TestSeedWriterExtraAssertionsCore18(c *C) {
-	const reverseOrder = false
-	s.testSeedWriterExtraAssertionsCore18(c, reverseOrder)
+func (s *writerSuite) TestAssertionGraphMissing(c *C) {
+	acctRef := &asserts.Ref{Type: asserts.AccountType, PrimaryKey: []string{"acct"}}
+	keyRef := &asserts.Ref{Type: asserts.AccountKeyType, PrimaryKey: []string{"key"}}
+	rootKeyRef := &asserts.Ref{Type: asserts.AccountKeyType, PrimaryKey: []string{"root-key"}}
+	declRef := &asserts.Ref{Type: asserts.SnapDeclarationType, PrimaryKey: []string{"16", "snap-id"}}
+	g := &seedwriter.AssertionGraph{
+		Nodes: []*asserts.Ref{declRef, keyRef},
+		Edges: map[string][]*asserts.Ref{
+			declRef.Unique(): {acctRef, keyRef},
+			keyRef.Unique():  {acctRef, rootKeyRef},
+		},
+		Predefined: []*asserts.Ref{rootKeyRef},
+	}
+	c.Check(g.Missing(), DeepEquals, []*asserts.Ref{acctRef})
 }
 
-func (s *writerSuite) TestSeedWriterExtraAssertionsCore18ReverseOrder(c *C) {
-	const reverseOrder = true
-	s.testSeedWriterExtraAssertionsCore18(c, reverseOrder)
+func (s *writerSuite) TestTrustAnchors(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"required18"},
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "required18", "developerid")
+
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+	c.Check(w.TrustAnchors(), IsNil)
+
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, true)
+
+	var keyIDs []string
+	for _, accKey := range w.TrustAnchors() {
+		keyIDs = append(keyIDs, accKey.PublicKeyID())
+	}
+	c.Check(keyIDs, testutil.DeepUnsortedMatches, []string{
+		s.StoreSigning.StoreAccountKey("").PublicKeyID(),
+		s.Brands.AccountKey("my-brand").PublicKeyID(),
+	})
 }
 
-func (s *writerSuite) testSeedWriterExtraAssertionsCore20(c *C, addProxyStore, reverseOrder, fileExistError bool, numberSystemUsers int) {
+func (s *writerSuite) TestTrustAnchorsExtraAssertions(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
-		"base":         "core20",
-		"snaps": []any{
-			map[string]any{
-				"name":            "pc-kernel",
-				"id":              s.AssertedSnapID("pc-kernel"),
-				"type":            "kernel",
-				"default-channel": "20",
-			},
-			map[string]any{
-				"name":            "pc",
-				"id":              s.AssertedSnapID("pc"),
-				"type":            "gadget",
-				"default-channel": "20",
-			},
-			map[string]any{
-				"name":            "snapd",
-				"id":              s.AssertedSnapID("snapd"),
-				"type":            "snapd",
-				"default-channel": "20",
-			},
-		},
+		"base":         "core18",
+		"gadget":       "pc=18",
+		"kernel":       "pc-kernel=18",
 	})
 
 	s.makeSnap(c, "snapd", "")
-	s.makeSnap(c, "core20", "")
-	s.makeSnap(c, "pc-kernel=20", "")
-	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
 
-	proxyStoreAssertion, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
-		"store":        "my-proxy-store",
-		"operator-id":  "other-brand",
-		"authority-id": "canonical",
-		"url":          "https://my-proxy-store.com",
-		"timestamp":    time.Now().UTC().Format(time.RFC3339),
-	}, nil, "")
+	// an additional key of the brand is a trust anchor
+	brandKey2 := assertstest.NewAccountKey(s.StoreSigning, s.Brands.Account("my-brand"), map[string]any{
+		"name": "second",
+	}, otherbrandPrivKey.PublicKey(), "")
+	// a key of a publisher is not
+	devPrivKey, _ := assertstest.GenerateKey(752)
+	devKey := assertstest.NewAccountKey(s.StoreSigning, s.devAcct, nil, devPrivKey.PublicKey(), "")
+	s.opts.ExtraAssertions = []asserts.Assertion{brandKey2, devKey}
+
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
 	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, true)
 
-	accountAssertion, err := s.StoreSigning.Sign(asserts.AccountType, map[string]any{
-		"type":         "account",
-		"authority-id": "canonical",
-		"account-id":   "other-brand",
-		"validation":   "verified",
-		"display-name": "Predef",
-		"timestamp":    time.Now().Format(time.RFC3339),
-	}, nil, "")
+	var keyIDs []string
+	for _, accKey := range w.TrustAnchors() {
+		keyIDs = append(keyIDs, accKey.PublicKeyID())
+	}
+	c.Check(keyIDs, testutil.DeepUnsortedMatches, []string{
+		s.StoreSigning.StoreAccountKey("").PublicKeyID(),
+		s.Brands.AccountKey("my-brand").PublicKeyID(),
+		brandKey2.PublicKeyID(),
+	})
+	c.Check(keyIDs, Not(testutil.Contains), devKey.PublicKeyID())
+}
+
+func (s *writerSuite) TestMaxAssertionAgeWarnings(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"required18"},
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "required18", "developerid")
+
+	s.opts.MaxAssertionAge = 180 * 24 * time.Hour
+
+	// pretend the seed is being built a year later
+	now := time.Now().Add(365 * 24 * time.Hour)
+	defer seedwriter.MockTimeNow(func() time.Time { return now })()
+
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
 	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, true)
 
-	systemUserGuyAssertion, err := s.Brands.Signing("my-brand").Sign(asserts.SystemUserType, map[string]any{
-		"authority-id": "my-brand",
-		"brand-id":     "my-brand",
-		"email":        "foo@bar.com",
-		"series":       []any{"16", "18"},
-		"models":       []any{"my-model"},
-		"name":         "Boring Guy",
-		"username":     "guy",
-		"ssh-key":      []any{"ecdsa-sha2-nistp384 AAAAE2VjZHNhLXNoYTItbmlzdHAzODQAAAAIbmlzdHAzODQAAABhBPwPDyLV/40kHdKQb4xq8EyfEaEUiXFui1bs4omabB0cwfVSYPZql+qJG22aBZjsEv4ESkc5u9lgaNbzsRDRUTYtJWzUJYIaObihMgi7U48kkBsf7TBxGOOy+t9pFatmEQ=="},
-		"since":        time.Now().Format(time.RFC3339),
-		"until":        time.Now().Add(24 * 30 * time.Hour).Format(time.RFC3339),
-	}, nil, "")
+	ages, err := w.AssertionFreshness()
 	c.Assert(err, IsNil)
+	warns := w.Warnings()
+	c.Assert(warns, HasLen, len(ages))
+	c.Check(warns, testutil.Contains, fmt.Sprintf("model assertion [16 my-brand my-model] is older than 4320h0m0s (%s old)", now.Sub(model.Timestamp()).Round(time.Second)))
+}
+
+func (s *writerSuite) TestMaxAssertionAgeNoWarnings(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"required18"},
+	})
 
-	systemUserBillAssertion, err := s.Brands.Signing("my-brand").Sign(asserts.SystemUserType, map[string]any{
-		"authority-id": "my-brand",
-		"brand-id":     "my-brand",
-		"email":        "foo@baz.com",
-		"series":       []any{"16", "18"},
-		"models":       []any{"my-model"},
-		"name":         "Expensive Bill",
-		"username":     "bill",
-		"ssh-key":      []any{"ecdsa-sha2-nistp384 AAAAE2VjZHNhLXNoTTItbmlzdHAzODQAAAAIbmlzdHAzODQAAABhBPwPDyLV/40kHdKQb4xq8EyfEaEUiXFui1bs4omabB0cwfVSYPZql+qJG22aBZjsEv4ESkc5u9lgaNbzsRDRUTYtJWzUJYIaObihMgi7U48kkBsf7TBxGOOy+t9pFatmEQ=="},
-		"since":        time.Now().Format(time.RFC3339),
-		"until":        time.Now().Add(24 * 30 * time.Hour).Format(time.RFC3339),
-	}, nil, "")
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "required18", "developerid")
+
+	s.opts.MaxAssertionAge = 180 * 24 * time.Hour
+
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
 	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, true)
+	c.Check(w.Warnings(), HasLen, 0)
+}
 
-	s.opts.ExtraAssertions = []asserts.Assertion{}
-	if addProxyStore {
-		if reverseOrder {
-			s.opts.ExtraAssertions = append(s.opts.ExtraAssertions, proxyStoreAssertion, accountAssertion)
-		} else {
-			s.opts.ExtraAssertions = append(s.opts.ExtraAssertions, accountAssertion, proxyStoreAssertion)
-		}
-	}
+func (s *writerSuite) TestSnapDeclaration(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []any{"required18"},
+	})
 
-	switch numberSystemUsers {
-	case 1:
-		s.opts.ExtraAssertions = append(s.opts.ExtraAssertions, systemUserGuyAssertion)
-	case 2:
-		s.opts.ExtraAssertions = append(s.opts.ExtraAssertions, systemUserGuyAssertion, systemUserBillAssertion)
-	}
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "required18", "developerid")
 
-	s.opts.Label = "20250326"
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
+	_, err = w.SnapDeclaration("required18")
+	c.Check(err, ErrorMatches, `internal error: seedwriter.Writer cannot query seed snaps before Downloaded signaled complete`)
+
 	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
 
 	snaps, err := w.SnapsToDownload()
 	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 4)
 
 	for _, sn := range snaps {
 		s.fillDownloadedSnap(c, w, sn)
@@ -5498,200 +9702,105 @@ func (s *writerSuite) testSeedWriterExtraAssertionsCore20(c *C, addProxyStore, r
 
 	complete, err := w.Downloaded(s.fetchAsserts(c))
 	c.Assert(err, IsNil)
-	c.Check(complete, Equals, true)
+	c.Assert(complete, Equals, true)
 
-	err = w.SeedSnaps(nil)
+	decl, err := w.SnapDeclaration("required18")
 	c.Assert(err, IsNil)
+	c.Check(decl.SnapName(), Equals, "required18")
+	c.Check(decl.SnapID(), Equals, s.AssertedSnapID("required18"))
+	c.Check(decl.PublisherID(), Equals, "developerid")
 
-	// check seed
-	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
-	assertsDir := filepath.Join(systemDir, "assertions")
-	// Trigger some errors by writing files prior to seeding
-	if addProxyStore && fileExistError {
-		err := os.MkdirAll(assertsDir, 0755)
-		c.Assert(err, IsNil)
-		f, err := os.OpenFile(filepath.Join(assertsDir, "extra-assertions"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
-		c.Assert(err, IsNil)
-		defer f.Close()
-	}
-	if numberSystemUsers > 0 && fileExistError {
-		f, err := os.OpenFile(filepath.Join(systemDir, "auto-import.assert"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
-		c.Assert(err, IsNil)
-		defer f.Close()
-	}
-
-	err = w.WriteMeta()
-	if fileExistError {
-		c.Assert(errors.Is(err, os.ErrExist), Equals, true)
-		return
-	} else {
-		c.Assert(err, IsNil)
-	}
-
-	// check assertions
-	c.Check(filepath.Join(systemDir, "model"), testutil.FileEquals, asserts.Encode(model))
-
-	modelEtc := seedtest.ReadAssertions(c, filepath.Join(assertsDir, "model-etc"))
-	c.Check(modelEtc, HasLen, 3)
-
-	keyPKs := make(map[string]bool)
-	for _, a := range modelEtc {
-		switch a.Type() {
-		case asserts.AccountType:
-			c.Check(a.HeaderString("account-id"), Equals, "my-brand")
-		case asserts.StoreType:
-			c.Check(a.HeaderString("store"), Equals, "my-store")
-		case asserts.AccountKeyType:
-			keyPKs[a.HeaderString("public-key-sha3-384")] = true
-		default:
-			c.Fatalf("unexpected assertion %s", a.Type().Name)
-		}
-	}
-	c.Check(keyPKs, DeepEquals, map[string]bool{
-		s.StoreSigning.StoreAccountKey("").PublicKeyID(): true,
-		s.Brands.AccountKey("my-brand").PublicKeyID():    true,
-	})
-
-	// check extra assertions if any (not type System User)
-	if addProxyStore {
-		extraAssertions := seedtest.ReadAssertions(c, filepath.Join(assertsDir, "extra-assertions"))
-		c.Check(extraAssertions, HasLen, 2)
-
-		for _, a := range extraAssertions {
-			switch a.Type() {
-			case asserts.AccountType:
-				c.Check(a.HeaderString("account-id"), Equals, "other-brand")
-			case asserts.StoreType:
-				c.Check(a.HeaderString("store"), Equals, "my-proxy-store")
-			default:
-				c.Fatalf("unexpected assertion %s", a.Type().Name)
-			}
-		}
-	} else {
-		c.Assert(filepath.Join(assertsDir, "extra-assertions"), testutil.FileAbsent)
-	}
-
-	// system user extra assertions
-	if numberSystemUsers > 0 {
-		extraAssertions := seedtest.ReadAssertions(c, filepath.Join(systemDir, "auto-import.assert"))
-		c.Check(extraAssertions, HasLen, numberSystemUsers)
-
-		for _, a := range extraAssertions {
-			switch a.Type() {
-			case asserts.SystemUserType:
-				switch a.HeaderString("username") {
-				case "guy":
-				case "bill":
-					if numberSystemUsers != 2 {
-						c.Fatalf("unexpected user")
-					}
-				default:
-					c.Fatalf("unexpected user %s", a.HeaderString("username"))
-				}
-			default:
-				c.Fatalf("unexpected assertion %s", a.Type().Name)
-			}
-		}
-	} else {
-		c.Assert(filepath.Join(systemDir, "auto-import.assert"), testutil.FileAbsent)
-	}
-}
-
-func (s *writerSuite) TestSeedWriterExtraAssertionsCore20(c *C) {
-	const addProxyStore = true
-	const reverseOrder = false
-	const fileExistError = false
-	const numberSystemUsers = 0
-	s.testSeedWriterExtraAssertionsCore20(c, addProxyStore, reverseOrder, fileExistError, numberSystemUsers)
-}
-
-func (s *writerSuite) TestSeedWriterExtraAssertionsCore20ReverseOrder(c *C) {
-	const addProxyStore = true
-	const reverseOrder = true
-	const fileExistError = false
-	const numberSystemUsers = 0
-	s.testSeedWriterExtraAssertionsCore20(c, addProxyStore, reverseOrder, fileExistError, numberSystemUsers)
-}
-
-func (s *writerSuite) TestSeedWriterExtraAssertionsCore20SingleSystemUser(c *C) {
-	const addProxyStore = false
-	const reverseOrder = false
-	const fileExistError = false
-	const numberSystemUsers = 1
-	s.testSeedWriterExtraAssertionsCore20(c, addProxyStore, reverseOrder, fileExistError, numberSystemUsers)
-}
-
-func (s *writerSuite) TestSeedWriterExtraAssertionsCore20MultipleSystemUsers(c *C) {
-	const addProxyStore = false
-	const reverseOrder = false
-	const fileExistError = false
-	const numberSystemUsers = 2
-	s.testSeedWriterExtraAssertionsCore20(c, addProxyStore, reverseOrder, fileExistError, numberSystemUsers)
-}
-
-func (s *writerSuite) TestSeedWriterExtraAssertionsCore20ProxyStoreAndMultipleSystemUsers(c *C) {
-	const addProxyStore = true
-	const reverseOrder = false
-	const fileExistError = false
-	const numberSystemUsers = 2
-	s.testSeedWriterExtraAssertionsCore20(c, addProxyStore, reverseOrder, fileExistError, numberSystemUsers)
-}
-
-func (s *writerSuite) TestSeedWriterExtraAssertionsCore20StoreFileError(c *C) {
-	const addProxyStore = true
-	const reverseOrder = false
-	const fileExistError = true
-	const numberSystemUsers = 0
-	s.testSeedWriterExtraAssertionsCore20(c, addProxyStore, reverseOrder, fileExistError, numberSystemUsers)
-}
+	decl, err = w.SnapDeclaration("pc")
+	c.Assert(err, IsNil)
+	c.Check(decl.SnapName(), Equals, "pc")
+	c.Check(decl.PublisherID(), Equals, "canonical")
 
-func (s *writerSuite) TestSeedWriterExtraAssertionsCore20SingleSystemUserFileError(c *C) {
-	const addProxyStore = false
-	const reverseOrder = false
-	const fileExistError = true
-	const numberSystemUsers = 1
-	s.testSeedWriterExtraAssertionsCore20(c, addProxyStore, reverseOrder, fileExistError, numberSystemUsers)
+	_, err = w.SnapDeclaration("not-in-seed")
+	c.Check(err, ErrorMatches, `snap "not-in-seed" is not part of the seed`)
 }
 
-func (s *writerSuite) TestSeedWriterExtraAssertionsErrorPrerequisites(c *C) {
+func (s *writerSuite) TestSnapDeclarationUnasserted(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
-		"gadget":       "pc=20",
-		"kernel":       "pc-kernel=20",
-		"base":         "core20",
+		"base":         "core18",
+		"gadget":       "pc=18",
+		"kernel":       "pc-kernel=18",
 	})
 
 	s.makeSnap(c, "snapd", "")
-	s.makeSnap(c, "core20", "")
-	s.makeSnap(c, "pc-kernel=20", "")
-	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	requiredFn := s.makeLocalSnap(c, "required18")
 
-	proxyStoreAssertion, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
-		"store":        "my-proxy-store",
-		"operator-id":  "other-brand",
-		"authority-id": "canonical",
-		"url":          "https://my-proxy-store.com",
-		"timestamp":    time.Now().UTC().Format(time.RFC3339),
-	}, nil, "")
+	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
-	s.opts.ExtraAssertions = []asserts.Assertion{proxyStoreAssertion}
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Path: requiredFn}})
+	c.Assert(err, IsNil)
 
-	w, err := seedwriter.New(model, s.opts)
+	err = w.Start(s.db, s.rf)
+	c.Assert(err, IsNil)
+
+	localSnaps, err := w.LocalSnaps()
+	c.Assert(err, IsNil)
+	c.Assert(localSnaps, HasLen, 1)
+
+	for _, sn := range localSnaps {
+		si, aRefs, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
+		if !errors.Is(err, &asserts.NotFoundError{}) {
+			c.Assert(err, IsNil)
+		}
+		f, err := snapfile.Open(sn.Path)
+		c.Assert(err, IsNil)
+		info, err := snap.ReadInfoFromSnapFile(f, si)
+		c.Assert(err, IsNil)
+		w.SetInfo(sn, info, nil)
+		s.aRefs[sn.SnapName()] = aRefs
+	}
+
+	err = w.InfoDerived()
 	c.Assert(err, IsNil)
 
-	err = w.Start(s.db, s.rf)
-	c.Assert(err.Error(), testutil.Contains, "cannot fetch and check prerequisites for an injected assertion: account (other-brand) not found")
+	for {
+		snaps, err := w.SnapsToDownload()
+		c.Assert(err, IsNil)
+
+		for _, sn := range snaps {
+			s.fillDownloadedSnap(c, w, sn)
+		}
+
+		complete, err := w.Downloaded(s.fetchAsserts(c))
+		c.Assert(err, IsNil)
+		if complete {
+			break
+		}
+	}
+
+	_, err = w.SnapDeclaration("required18")
+	c.Check(err, ErrorMatches, `snap "required18" is unasserted and has no snap-declaration`)
 }
 
-func (s *writerSuite) TestSeedWriterExtraAssertionsPrerequisitesError(c *C) {
+func (s *writerSuite) upToWriteMetaCore20OnAssertion(c *C) (*seedwriter.Writer, *asserts.Model) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
-		"gadget":       "pc=20",
-		"kernel":       "pc-kernel=20",
 		"base":         "core20",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+		},
 	})
 
 	s.makeSnap(c, "snapd", "")
@@ -5701,51 +9810,73 @@ func (s *writerSuite) TestSeedWriterExtraAssertionsPrerequisitesError(c *C) {
 
 	proxyStoreAssertion, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
 		"store":        "my-proxy-store",
-		"operator-id":  "other-brand",
+		"operator-id":  "canonical",
 		"authority-id": "canonical",
 		"url":          "https://my-proxy-store.com",
 		"timestamp":    time.Now().UTC().Format(time.RFC3339),
 	}, nil, "")
 	c.Assert(err, IsNil)
+	s.opts.ExtraAssertions = []asserts.Assertion{proxyStoreAssertion}
 
-	accountAssertion, err := s.StoreSigning.Sign(asserts.AccountType, map[string]any{
-		"type":         "account",
-		"authority-id": "not-canonical",
-		"account-id":   "other-brand",
-		"validation":   "verified",
-		"display-name": "Predef",
-		"timestamp":    time.Now().Format(time.RFC3339),
-	}, nil, "")
+	s.opts.Label = "20191122"
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
 	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, true)
 
-	s.opts.ExtraAssertions = []asserts.Assertion{proxyStoreAssertion, accountAssertion}
+	err = w.SeedSnaps(nil)
+	c.Assert(err, IsNil)
+	return w, model
+}
 
-	w, err := seedwriter.New(model, s.opts)
+func (s *writerSuite) TestOnAssertionCore20(c *C) {
+	var seen []string
+	s.opts.OnAssertion = func(a asserts.Assertion) error {
+		seen = append(seen, a.Ref().Unique())
+		return nil
+	}
+	w, model := s.upToWriteMetaCore20OnAssertion(c)
+
+	err := w.WriteMeta()
 	c.Assert(err, IsNil)
 
-	err = w.Start(s.db, s.rf)
-	c.Assert(err.Error(), testutil.Contains, "cannot fetch and check prerequisites for an injected assertion: "+
-		"prerequisite injected assertion: error finding matching public key for signature: found public key \""+
-		s.StoreSigning.KeyID+"\" from \"canonical\" but expected it from: not-canonical")
+	// the callback saw every written assertion, in the written order
+	assertsDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label, "assertions")
+	expected := []string{model.Ref().Unique()}
+	for _, fn := range []string{"model-etc", "extra-assertions", "snaps"} {
+		for _, a := range seedtest.ReadAssertions(c, filepath.Join(assertsDir, fn)) {
+			expected = append(expected, a.Ref().Unique())
+		}
+	}
+	c.Check(seen, HasLen, 1+3+1+4*2)
+	c.Check(seen, DeepEquals, expected)
 }
 
-func (s *writerSuite) TestSeedSnapsWriteMetaCore20OptionsOldLatest(c *C) {
-	// add store assertion
-	storeAs, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
-		"store":       "my-store",
-		"operator-id": "canonical",
-		"timestamp":   time.Now().UTC().Format(time.RFC3339),
-	}, nil, "")
-	c.Assert(err, IsNil)
-	err = s.StoreSigning.Add(storeAs)
-	c.Assert(err, IsNil)
+func (s *writerSuite) TestOnAssertionVeto(c *C) {
+	n := 0
+	s.opts.OnAssertion = func(a asserts.Assertion) error {
+		n++
+		if a.Type() == asserts.SnapDeclarationType {
+			return fmt.Errorf("vetoed %s", a.Ref().Unique())
+		}
+		return nil
+	}
+	w, _ := s.upToWriteMetaCore20OnAssertion(c)
+
+	err := w.WriteMeta()
+	c.Assert(err, ErrorMatches, `vetoed snap-declaration/16/.*`)
+	// model, model-etc and extra-assertions were seen before the veto
+	c.Check(n, Equals, 1+3+1+1)
 
+	// the vetoed assertion was not written
+	assertsDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label, "assertions")
+	c.Check(seedtest.ReadAssertions(c, filepath.Join(assertsDir, "snaps")), HasLen, 0)
+}
+
+func (s *writerSuite) TestEstimateSeedingTime(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
-		"store":        "my-store",
 		"base":         "core20",
-		"grade":        "dangerous",
 		"snaps": []any{
 			map[string]any{
 				"name":            "pc-kernel",
@@ -5762,103 +9893,200 @@ func (s *writerSuite) TestSeedSnapsWriteMetaCore20OptionsOldLatest(c *C) {
 		},
 	})
 
-	// validity
-	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
-
 	s.makeSnap(c, "snapd", "")
 	s.makeSnap(c, "core20", "")
-	s.makeSnap(c, "core", "")
 	s.makeSnap(c, "pc-kernel=20", "")
 	s.makeSnap(c, "pc=20", "")
-	s.makeSnap(c, "oldlatest", "developerid")
 
-	s.opts.Label = "20240621"
+	s.opts.Label = "20191122"
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
-	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "oldlatest", Channel: "latest/stable"}, {Name: "core"}})
-	c.Assert(err, IsNil)
-
 	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
 
 	snaps, err := w.SnapsToDownload()
 	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 4)
+	c.Assert(snaps, HasLen, 4)
+
+	_, err = w.EstimateSeedingTime(1000)
+	c.Check(err, ErrorMatches, `internal error: seedwriter.Writer cannot query seed snaps before Downloaded signaled complete`)
 
 	for _, sn := range snaps {
 		s.fillDownloadedSnap(c, w, sn)
+		// give the blobs known sizes
+		c.Assert(os.Truncate(sn.Path, 2500), IsNil)
 	}
 
 	complete, err := w.Downloaded(s.fetchAsserts(c))
 	c.Assert(err, IsNil)
-	c.Check(complete, Equals, false)
+	c.Check(complete, Equals, true)
 
-	snaps, err = w.SnapsToDownload()
+	d, err := w.EstimateSeedingTime(1000)
 	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 2)
+	c.Check(d, Equals, 10*time.Second)
 
-	for _, sn := range snaps {
-		info := s.doFillMetaDownloadedSnap(c, w, sn)
+	d, err = w.EstimateSeedingTime(4000)
+	c.Assert(err, IsNil)
+	c.Check(d, Equals, 2500*time.Millisecond)
 
-		c.Assert(sn.Path, Equals, filepath.Join(s.opts.SeedDir, "systems", s.opts.Label, "snaps", info.Filename()))
-		err := os.Rename(s.AssertedSnap(sn.SnapName()), sn.Path)
-		c.Assert(err, IsNil)
-	}
+	_, err = w.EstimateSeedingTime(0)
+	c.Check(err, ErrorMatches, `cannot estimate seeding time for invalid throughput 0`)
+}
 
-	complete, err = w.Downloaded(s.fetchAsserts(c))
-	c.Assert(err, IsNil)
-	c.Check(complete, Equals, true)
+func (s *writerSuite) upToDownloadedSizedCore20(c *C, blobSize int64) *seedwriter.Writer {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core20",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+		},
+	})
 
-	err = w.SeedSnaps(nil)
-	c.Assert(err, IsNil)
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
 
-	err = w.WriteMeta()
+	s.opts.Label = "20191122"
+	fill := func(c *C, w *seedwriter.Writer, sn *seedwriter.SeedSnap) {
+		s.fillDownloadedSnap(c, w, sn)
+		c.Assert(os.Truncate(sn.Path, blobSize), IsNil)
+	}
+	complete, w, err := s.upToDownloaded(c, model, fill, s.fetchAsserts(c))
 	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, true)
+	return w
+}
 
-	// check seed
-	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
-	c.Check(systemDir, testutil.FilePresent)
+func (s *writerSuite) TestSeedSnapsMaxSeedSizeOverBudget(c *C) {
+	s.opts.MaxSeedSize = 6 * quantity.SizeKiB
+	w := s.upToDownloadedSizedCore20(c, 2*1024)
 
-	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
-	c.Assert(err, IsNil)
-	c.Check(l, HasLen, 4)
-	l, err = os.ReadDir(filepath.Join(s.opts.SeedDir, "systems", s.opts.Label, "snaps"))
+	err := w.SeedSnaps(nil)
+	c.Assert(err, ErrorMatches, `seed size 8 KiB exceeds budget 6 KiB \(over by 2 KiB\)`)
+}
+
+func (s *writerSuite) TestSeedSnapsMaxSeedSizeUnderBudget(c *C) {
+	s.opts.MaxSeedSize = 8 * quantity.SizeKiB
+	w := s.upToDownloadedSizedCore20(c, 2*1024)
+
+	err := w.SeedSnaps(nil)
 	c.Assert(err, IsNil)
-	c.Check(l, HasLen, 2)
 
-	options20, err := seedwriter.InternalReadOptions20(filepath.Join(systemDir, "options.yaml"))
+	err = w.WriteMeta()
 	c.Assert(err, IsNil)
+}
 
-	c.Check(options20.Snaps, DeepEquals, []*seedwriter.InternalSnap20{
-		{
-			Name:    "oldlatest",
-			SnapID:  s.AssertedSnapID("oldlatest"),
-			Channel: "latest/stable",
-		},
-		{
-			Name:    "core",
-			SnapID:  s.AssertedSnapID("core"),
-			Channel: "latest/stable",
+func (s *writerSuite) TestSeedSnapsWriteMetaCore20PerModeSnapDirs(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"store":        "my-store",
+		"base":         "core20",
+		"snaps": []any{
+			map[string]any{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+			map[string]any{
+				"name":  "core18",
+				"id":    s.AssertedSnapID("core18"),
+				"type":  "base",
+				"modes": []any{"ephemeral"},
+			},
+			map[string]any{
+				"name":  "cont-producer",
+				"id":    s.AssertedSnapID("cont-producer"),
+				"modes": []any{"recover"},
+			},
 		},
 	})
-}
 
-func (s *writerSuite) TestSeedSnapsWriteMetaCore20RequiredOldLatestOverride(c *C) {
-	// add store assertion
-	storeAs, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
-		"store":       "my-store",
-		"operator-id": "canonical",
-		"timestamp":   time.Now().UTC().Format(time.RFC3339),
-	}, nil, "")
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "cont-producer", "developerid")
+
+	s.opts.Label = "20191003"
+	s.opts.EmitPerModeSnapDirs = true
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c))
 	c.Assert(err, IsNil)
-	err = s.StoreSigning.Add(storeAs)
+	c.Assert(complete, Equals, true)
+
+	err = w.SeedSnaps(nil)
 	c.Assert(err, IsNil)
 
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
+
+	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
+	essential := []string{"core20_1.snap", "pc-kernel_1.snap", "pc_1.snap", "snapd_1.snap"}
+	ephemeral := append([]string{"core18_1.snap"}, essential...)
+	expected := map[string][]string{
+		"run":           essential,
+		"install":       ephemeral,
+		"recover":       append([]string{"cont-producer_1.snap"}, ephemeral...),
+		"factory-reset": ephemeral,
+	}
+	for mode, names := range expected {
+		modeSnapsDir := filepath.Join(systemDir, mode, "snaps")
+		entries, err := os.ReadDir(modeSnapsDir)
+		c.Assert(err, IsNil)
+		var linked []string
+		for _, e := range entries {
+			linked = append(linked, e.Name())
+			// links point to the blobs in the canonical layout
+			p := filepath.Join(modeSnapsDir, e.Name())
+			c.Check(osutil.IsSymlink(p), Equals, true)
+			target, err := filepath.EvalSymlinks(p)
+			c.Assert(err, IsNil)
+			c.Check(target, Equals, filepath.Join(s.opts.SeedDir, "snaps", e.Name()))
+		}
+		c.Check(linked, DeepEquals, names, Commentf("mode %s", mode))
+	}
+}
+
+func (s *writerSuite) TestPerModeSnapDirsUnsupportedCore18(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
-		"store":        "my-store",
+		"base":         "core18",
+		"gadget":       "pc=18",
+		"kernel":       "pc-kernel=18",
+	})
+
+	s.opts.EmitPerModeSnapDirs = true
+	_, err := seedwriter.New(model, s.opts)
+	c.Assert(err, ErrorMatches, `cannot emit per-mode snap directories for a model without a grade`)
+}
+
+func (s *writerSuite) appendModel() *asserts.Model {
+	return s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
 		"base":         "core20",
 		"grade":        "dangerous",
 		"snaps": []any{
@@ -5874,41 +10102,78 @@ func (s *writerSuite) TestSeedSnapsWriteMetaCore20RequiredOldLatestOverride(c *C
 				"type":            "gadget",
 				"default-channel": "20",
 			},
-			map[string]any{
-				"name":            "oldlatest",
-				"id":              s.AssertedSnapID("oldlatest"),
-				"default-channel": "20/stable",
-			},
 		},
 	})
+}
 
-	// validity
-	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
-
+// writeSystemForAppend writes a core20 system with core18 as extra snap
+func (s *writerSuite) writeSystemForAppend(c *C, model *asserts.Model) {
 	s.makeSnap(c, "snapd", "")
 	s.makeSnap(c, "core20", "")
-	s.makeSnap(c, "core", "")
 	s.makeSnap(c, "pc-kernel=20", "")
 	s.makeSnap(c, "pc=20", "")
-	s.makeSnap(c, "oldlatest", "developerid")
+	s.makeSnap(c, "core18", "")
 
-	s.opts.Label = "20240621"
+	s.opts.Label = "20260101"
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c), &seedwriter.OptionsSnap{Name: "core18"})
+	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, false)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 1)
+	for _, sn := range snaps {
+		info := s.doFillMetaDownloadedSnap(c, w, sn)
+		c.Assert(sn.Path, Equals, filepath.Join(s.opts.SeedDir, "systems", s.opts.Label, "snaps", info.Filename()))
+		c.Assert(os.Rename(s.AssertedSnap(sn.SnapName()), sn.Path), IsNil)
+	}
+
+	complete, err = w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, true)
+
+	c.Assert(w.SeedSnaps(nil), IsNil)
+	c.Assert(w.WriteMeta(), IsNil)
+}
+
+func (s *writerSuite) TestAppendToSystemCore20(c *C) {
+	model := s.appendModel()
+	s.writeSystemForAppend(c, model)
+	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
+	modelSnapsAsserts := seedtest.ReadAssertions(c, filepath.Join(systemDir, "assertions", "snaps"))
+
+	s.makeSnap(c, "cont-producer", "developerid")
+	contConsumerFn := s.makeLocalSnap(c, "cont-consumer")
+
+	s.opts.AppendToSystem = true
+	s.opts.ManifestPath = filepath.Join(s.opts.SeedDir, "seed.manifest")
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
 
-	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "oldlatest", Channel: "latest/stable"}, {Name: "core"}})
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{
+		{Name: "cont-producer"}, {Path: contConsumerFn},
+	})
 	c.Assert(err, IsNil)
 
 	err = w.Start(s.db, s.rf)
 	c.Assert(err, IsNil)
 
+	localSnaps, err := w.LocalSnaps()
+	c.Assert(err, IsNil)
+	c.Assert(localSnaps, HasLen, 1)
+	for _, sn := range localSnaps {
+		f, err := snapfile.Open(sn.Path)
+		c.Assert(err, IsNil)
+		info, err := snap.ReadInfoFromSnapFile(f, nil)
+		c.Assert(err, IsNil)
+		w.SetInfo(sn, info, nil)
+	}
+	c.Assert(w.InfoDerived(), IsNil)
+
+	// nothing to download for the model, the snaps are in the system
 	snaps, err := w.SnapsToDownload()
 	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 5)
-
-	for _, sn := range snaps {
-		s.fillDownloadedSnap(c, w, sn)
-	}
+	c.Check(snaps, HasLen, 0)
 
 	complete, err := w.Downloaded(s.fetchAsserts(c))
 	c.Assert(err, IsNil)
@@ -5916,69 +10181,126 @@ func (s *writerSuite) TestSeedSnapsWriteMetaCore20RequiredOldLatestOverride(c *C
 
 	snaps, err = w.SnapsToDownload()
 	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 1)
-
+	c.Assert(snaps, HasLen, 1)
+	c.Check(snaps[0].SnapName(), Equals, "cont-producer")
 	for _, sn := range snaps {
 		info := s.doFillMetaDownloadedSnap(c, w, sn)
-
-		c.Assert(sn.Path, Equals, filepath.Join(s.opts.SeedDir, "systems", s.opts.Label, "snaps", info.Filename()))
-		err := os.Rename(s.AssertedSnap(sn.SnapName()), sn.Path)
-		c.Assert(err, IsNil)
+		c.Assert(sn.Path, Equals, filepath.Join(systemDir, "snaps", info.Filename()))
+		c.Assert(os.Rename(s.AssertedSnap(sn.SnapName()), sn.Path), IsNil)
 	}
 
 	complete, err = w.Downloaded(s.fetchAsserts(c))
 	c.Assert(err, IsNil)
 	c.Check(complete, Equals, true)
 
-	err = w.SeedSnaps(nil)
-	c.Assert(err, IsNil)
+	copySnap := func(name, src, dst string) error {
+		return osutil.CopyFile(src, dst, 0)
+	}
+	c.Assert(w.SeedSnaps(copySnap), IsNil)
+	c.Assert(w.WriteMeta(), IsNil)
 
-	err = w.WriteMeta()
-	c.Assert(err, IsNil)
+	c.Check(filepath.Join(systemDir, "snaps", "core18_1.snap"), testutil.FilePresent)
+	c.Check(filepath.Join(systemDir, "snaps", "cont-producer_1.snap"), testutil.FilePresent)
+	c.Check(filepath.Join(systemDir, "snaps", "cont-consumer_1.0.snap"), testutil.FilePresent)
 
-	// check seed
-	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
-	c.Check(systemDir, testutil.FilePresent)
+	// the model snap assertions are untouched
+	c.Check(seedtest.ReadAssertions(c, filepath.Join(systemDir, "assertions", "snaps")), DeepEquals, modelSnapsAsserts)
 
-	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
-	c.Assert(err, IsNil)
-	c.Check(l, HasLen, 5)
-	l, err = os.ReadDir(filepath.Join(s.opts.SeedDir, "systems", s.opts.Label, "snaps"))
-	c.Assert(err, IsNil)
-	c.Check(l, HasLen, 1)
+	// the assertions of the appended snap are added to the existing ones
+	extraAssertions := seedtest.ReadAssertions(c, filepath.Join(systemDir, "assertions", "extra-snaps"))
+	seen := make(map[string]bool)
+	var snapDecls []string
+	for _, a := range extraAssertions {
+		u := a.Ref().Unique()
+		c.Check(seen[u], Equals, false, Commentf("%s repeated", u))
+		seen[u] = true
+		if decl, ok := a.(*asserts.SnapDeclaration); ok {
+			snapDecls = append(snapDecls, decl.SnapName())
+		}
+	}
+	c.Check(snapDecls, DeepEquals, []string{"core18", "cont-producer"})
+	c.Check(seen[s.devAcct.Ref().Unique()], Equals, true)
 
 	options20, err := seedwriter.InternalReadOptions20(filepath.Join(systemDir, "options.yaml"))
 	c.Assert(err, IsNil)
-
 	c.Check(options20.Snaps, DeepEquals, []*seedwriter.InternalSnap20{
 		{
-			Name:    "oldlatest",
-			SnapID:  s.AssertedSnapID("oldlatest"),
+			Name:    "core18",
+			SnapID:  s.AssertedSnapID("core18"),
 			Channel: "latest/stable",
 		},
 		{
-			Name:    "core",
-			SnapID:  s.AssertedSnapID("core"),
+			Name:    "cont-producer",
+			SnapID:  s.AssertedSnapID("cont-producer"),
 			Channel: "latest/stable",
 		},
+		{
+			Name:       "cont-consumer",
+			Unasserted: "cont-consumer_1.0.snap",
+		},
 	})
+
+	c.Check(s.opts.ManifestPath, testutil.FileEquals, `cont-consumer x1
+cont-producer 1
+core18 1
+core20 1
+pc 1
+pc-kernel 1
+snapd 1
+`)
 }
 
-func (s *writerSuite) TestSeedSnapsWriteMetaCore20RequiredOldLatestOverrideMissingCore(c *C) {
-	// add store assertion
-	storeAs, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
-		"store":       "my-store",
-		"operator-id": "canonical",
-		"timestamp":   time.Now().UTC().Format(time.RFC3339),
-	}, nil, "")
+func (s *writerSuite) TestAppendToSystemCore20Errors(c *C) {
+	model := s.appendModel()
+
+	s.opts.Label = "20260101"
+	s.opts.AppendToSystem = true
+	s.opts.EmitPerModeSnapDirs = true
+	_, err := seedwriter.New(model, s.opts)
+	c.Check(err, ErrorMatches, `cannot emit per-mode snap directories when appending to an existing system`)
+	s.opts.EmitPerModeSnapDirs = false
+
+	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
-	err = s.StoreSigning.Add(storeAs)
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "pc"}})
+	c.Check(err, ErrorMatches, `cannot append snap "pc" to system "20260101": snaps of the model cannot be changed`)
+
+	w, err = seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "snapd"}})
+	c.Check(err, ErrorMatches, `cannot append snap "snapd" to system "20260101": snaps of the model cannot be changed`)
 
-	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+	// the system must exist
+	w, err = seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+	err = w.Start(s.db, s.rf)
+	c.Check(err, ErrorMatches, `cannot append to system "20260101": system does not exist`)
+}
+
+func (s *writerSuite) TestAppendToSystemCore20AlreadyPresent(c *C) {
+	model := s.appendModel()
+	s.writeSystemForAppend(c, model)
+
+	s.opts.AppendToSystem = true
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+	c.Assert(w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "core18"}}), IsNil)
+	c.Assert(w.Start(s.db, s.rf), IsNil)
+	_, err = w.LocalSnaps()
+	c.Assert(err, IsNil)
+	c.Assert(w.InfoDerived(), IsNil)
+
+	_, err = w.SnapsToDownload()
+	c.Check(err, ErrorMatches, `cannot append snap "core18" to system "20260101": snap is already part of the system`)
+}
+
+func (s *writerSuite) TestAppendToSystemCore20DifferentModel(c *C) {
+	model := s.appendModel()
+	s.writeSystemForAppend(c, model)
+
+	otherModel := s.Brands.Model("my-brand", "my-other-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
-		"store":        "my-store",
 		"base":         "core20",
 		"grade":        "dangerous",
 		"snaps": []any{
@@ -5994,62 +10316,90 @@ func (s *writerSuite) TestSeedSnapsWriteMetaCore20RequiredOldLatestOverrideMissi
 				"type":            "gadget",
 				"default-channel": "20",
 			},
-			map[string]any{
-				"name":            "oldlatest",
-				"id":              s.AssertedSnapID("oldlatest"),
-				"default-channel": "20/stable",
-			},
 		},
 	})
 
-	// validity
-	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
+	s.opts.AppendToSystem = true
+	w, err := seedwriter.New(otherModel, s.opts)
+	c.Assert(err, IsNil)
+	err = w.Start(s.db, s.rf)
+	c.Check(err, ErrorMatches, `cannot append to system "20260101": system was created for a different model`)
+}
+
+func (s *writerSuite) TestAppendToSystemModelWithoutGrade(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]any{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"gadget":       "pc",
+		"kernel":       "pc-kernel",
+	})
+
+	s.opts.AppendToSystem = true
+	_, err := seedwriter.New(model, s.opts)
+	c.Check(err, ErrorMatches, `cannot append to an existing system for a model without a grade`)
+}
+
+func (s *writerSuite) TestOptionsSnapRevisionCore20(c *C) {
+	model := s.appendModel()
 
 	s.makeSnap(c, "snapd", "")
 	s.makeSnap(c, "core20", "")
 	s.makeSnap(c, "pc-kernel=20", "")
 	s.makeSnap(c, "pc=20", "")
-	s.makeSnap(c, "oldlatest", "developerid")
-
-	s.opts.Label = "20240621"
-	w, err := seedwriter.New(model, s.opts)
-	c.Assert(err, IsNil)
+	s.makeSnap(c, "core18", "")
 
-	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "oldlatest", Channel: "latest/stable"}})
-	c.Assert(err, IsNil)
+	revisions := make(map[string]snap.Revision)
+	fill := func(c *C, w *seedwriter.Writer, sn *seedwriter.SeedSnap) {
+		revisions[sn.SnapName()] = sn.Revision
+		s.doFillMetaDownloadedSnap(c, w, sn)
+		c.Assert(os.Rename(s.AssertedSnap(sn.SnapName()), sn.Path), IsNil)
+	}
 
-	err = w.Start(s.db, s.rf)
+	s.opts.Label = "20260101"
+	complete, w, err := s.upToDownloaded(c, model, fill, s.fetchAsserts(c),
+		&seedwriter.OptionsSnap{Name: "pc", Revision: snap.R(1)},
+		&seedwriter.OptionsSnap{Name: "core18", Revision: snap.R(1)})
 	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, false)
 
 	snaps, err := w.SnapsToDownload()
 	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 5)
-
 	for _, sn := range snaps {
-		s.fillDownloadedSnap(c, w, sn)
+		fill(c, w, sn)
 	}
+	complete, err = w.Downloaded(s.fetchAsserts(c))
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
 
-	_, err = w.Downloaded(s.fetchAsserts(c))
-	c.Check(err, ErrorMatches, `prerequisites need to be added explicitly: cannot use snap "oldlatest": required snap "core" missing`)
+	c.Check(revisions, DeepEquals, map[string]snap.Revision{
+		"snapd":     {},
+		"pc-kernel": {},
+		"core20":    {},
+		"pc":        snap.R(1),
+		"core18":    snap.R(1),
+	})
 }
 
-func (s *writerSuite) TestSeedSnapsWriteMetaCore20RequiredOldLatestOverrideLocalCore(c *C) {
-	// add store assertion
-	storeAs, err := s.StoreSigning.Sign(asserts.StoreType, map[string]any{
-		"store":       "my-store",
-		"operator-id": "canonical",
-		"timestamp":   time.Now().UTC().Format(time.RFC3339),
-	}, nil, "")
-	c.Assert(err, IsNil)
-	err = s.StoreSigning.Add(storeAs)
-	c.Assert(err, IsNil)
+func (s *writerSuite) TestOptionsSnapRevisionMismatch(c *C) {
+	model := s.appendModel()
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
 
+	s.opts.Label = "20260101"
+	_, _, err := s.upToDownloaded(c, model, s.fillDownloadedSnap, s.fetchAsserts(c),
+		&seedwriter.OptionsSnap{Name: "pc", Revision: snap.R(7)})
+	c.Check(err, ErrorMatches, `snap "pc" was fetched at revision 1 instead of the requested revision 7`)
+}
+
+func (s *writerSuite) TestOptionsSnapRevisionSignedModel(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]any{
 		"display-name": "my model",
 		"architecture": "amd64",
-		"store":        "my-store",
 		"base":         "core20",
-		"grade":        "dangerous",
+		"grade":        "signed",
 		"snaps": []any{
 			map[string]any{
 				"name":            "pc-kernel",
@@ -6063,107 +10413,12 @@ func (s *writerSuite) TestSeedSnapsWriteMetaCore20RequiredOldLatestOverrideLocal
 				"type":            "gadget",
 				"default-channel": "20",
 			},
-			map[string]any{
-				"name":            "oldlatest",
-				"id":              s.AssertedSnapID("oldlatest"),
-				"default-channel": "20/stable",
-			},
 		},
 	})
 
-	// validity
-	c.Assert(model.Grade(), Equals, asserts.ModelDangerous)
-
-	s.makeSnap(c, "snapd", "")
-	s.makeSnap(c, "core20", "")
-	corePath := s.makeLocalSnap(c, "core")
-	s.makeSnap(c, "pc-kernel=20", "")
-	s.makeSnap(c, "pc=20", "")
-	s.makeSnap(c, "oldlatest", "developerid")
-
-	s.opts.Label = "20240621"
+	s.opts.Label = "20260101"
 	w, err := seedwriter.New(model, s.opts)
 	c.Assert(err, IsNil)
-
-	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "oldlatest", Channel: "latest/stable"}, {Path: corePath}})
-	c.Assert(err, IsNil)
-
-	err = w.Start(s.db, s.rf)
-	c.Assert(err, IsNil)
-
-	localSnaps, err := w.LocalSnaps()
-	c.Assert(err, IsNil)
-	c.Assert(localSnaps, HasLen, 1)
-
-	for _, sn := range localSnaps {
-		si, aRefs, err := seedwriter.DeriveSideInfo(sn.Path, model, s.rf, s.db)
-		if !errors.Is(err, &asserts.NotFoundError{}) {
-			c.Assert(err, IsNil)
-		}
-		f, err := snapfile.Open(sn.Path)
-		c.Assert(err, IsNil)
-		info, err := snap.ReadInfoFromSnapFile(f, si)
-		c.Assert(err, IsNil)
-		w.SetInfo(sn, info, nil)
-		s.aRefs[sn.SnapName()] = aRefs
-	}
-
-	err = w.InfoDerived()
-	c.Assert(err, IsNil)
-
-	snaps, err := w.SnapsToDownload()
-	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 5)
-
-	for _, sn := range snaps {
-		s.fillDownloadedSnap(c, w, sn)
-	}
-
-	complete, err := w.Downloaded(s.fetchAsserts(c))
-	c.Assert(err, IsNil)
-	c.Check(complete, Equals, false)
-
-	snaps, err = w.SnapsToDownload()
-	c.Assert(err, IsNil)
-	c.Check(snaps, HasLen, 0)
-
-	complete, err = w.Downloaded(s.fetchAsserts(c))
-	c.Assert(err, IsNil)
-	c.Check(complete, Equals, true)
-
-	copySnap := func(name, src, dst string) error {
-		return osutil.CopyFile(src, dst, 0)
-	}
-
-	err = w.SeedSnaps(copySnap)
-	c.Assert(err, IsNil)
-
-	err = w.WriteMeta()
-	c.Assert(err, IsNil)
-
-	// check seed
-	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
-	c.Check(systemDir, testutil.FilePresent)
-
-	l, err := os.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
-	c.Assert(err, IsNil)
-	c.Check(l, HasLen, 5)
-	l, err = os.ReadDir(filepath.Join(s.opts.SeedDir, "systems", s.opts.Label, "snaps"))
-	c.Assert(err, IsNil)
-	c.Check(l, HasLen, 1)
-
-	options20, err := seedwriter.InternalReadOptions20(filepath.Join(systemDir, "options.yaml"))
-	c.Assert(err, IsNil)
-
-	c.Check(options20.Snaps, DeepEquals, []*seedwriter.InternalSnap20{
-		{
-			Name:    "oldlatest",
-			SnapID:  s.AssertedSnapID("oldlatest"),
-			Channel: "latest/stable",
-		},
-		{
-			Name:       "core",
-			Unasserted: "core_1.0.snap",
-		},
-	})
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "pc", Revision: snap.R(1)}})
+	c.Check(err, ErrorMatches, `cannot override channels, add devmode snaps, local snaps, or extra snaps/components with a model of grade higher than dangerous`)
 }
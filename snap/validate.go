@@ -1359,6 +1359,75 @@ func (prqt *SelfContainedSetPrereqTracker) MissingProviderContentTags(info *Info
 	return nil
 }
 
+// CumulativePrereqTracker is a stateful helper to track prerequisites
+// of snaps across multiple snap operations, for example when
+// provisioning a device through several sequential installs.
+// Default-providers that have already been added to the tracker, as
+// well as content tags provided by their slots, are not reported as
+// missing anymore, so that the same tracker can be passed to later
+// operations to avoid setting up redundant prerequisite installs.
+// CumulativePrereqTracker implements snapstate.PrereqTracker.
+type CumulativePrereqTracker struct {
+	snaps []*Info
+	all   *naming.SnapSet
+}
+
+// NewCumulativePrereqTracker returns a new CumulativePrereqTracker.
+func NewCumulativePrereqTracker() *CumulativePrereqTracker {
+	return &CumulativePrereqTracker{
+		all: naming.NewSnapSet(nil),
+	}
+}
+
+// Add adds a snap to track. Add implements snapstate.PrereqTracker.
+func (prqt *CumulativePrereqTracker) Add(info *Info) {
+	if !prqt.all.Contains(info) {
+		prqt.all.Add(info)
+		prqt.snaps = append(prqt.snaps, info)
+	}
+}
+
+// Snaps returns all snaps that have been added to the tracker.
+func (prqt *CumulativePrereqTracker) Snaps() []*Info {
+	return append([]*Info{}, prqt.snaps...)
+}
+
+// MissingProviderContentTags implements snapstate.PrereqTracker.
+// It behaves like SimplePrereqTracker.MissingProviderContentTags but
+// additionally considers any default-provider already added to the
+// tracker, and any content tag provided by the snaps added to it, as
+// available.
+func (prqt *CumulativePrereqTracker) MissingProviderContentTags(info *Info, repo InterfaceRepo) map[string][]string {
+	trackedTags := make(map[string]bool)
+	for _, tracked := range prqt.snaps {
+		for _, slot := range tracked.Slots {
+			if contentTag := maybeContentSlot(slot); contentTag != "" {
+				trackedTags[contentTag] = true
+			}
+		}
+	}
+
+	providerSnapsToContentTag := SimplePrereqTracker{}.MissingProviderContentTags(info, repo)
+	for provider, contentTags := range providerSnapsToContentTag {
+		if prqt.all.Contains(naming.Snap(provider)) {
+			delete(providerSnapsToContentTag, provider)
+			continue
+		}
+		missing := make([]string, 0, len(contentTags))
+		for _, contentTag := range contentTags {
+			if !trackedTags[contentTag] {
+				missing = append(missing, contentTag)
+			}
+		}
+		if len(missing) == 0 {
+			delete(providerSnapsToContentTag, provider)
+			continue
+		}
+		providerSnapsToContentTag[provider] = missing
+	}
+	return providerSnapsToContentTag
+}
+
 func maybeContentSlot(slot *SlotInfo) (contentTag string) {
 	if slot.Interface != "content" {
 		return ""
@@ -1397,6 +1466,13 @@ func (w *ProviderWarning) defaultProviderAvailable() (defaultProviderSlot string
 	return "", w.Slots
 }
 
+// HasDefaultProviderSlot returns whether one of the candidate slots is from
+// the default-provider.
+func (w *ProviderWarning) HasDefaultProviderSlot() bool {
+	defaultSlot, _ := w.defaultProviderAvailable()
+	return defaultSlot != ""
+}
+
 func (w *ProviderWarning) Error() string {
 	defaultSlot, otherSlots := w.defaultProviderAvailable()
 	slotsStr := strings.Join(otherSlots, ", ")
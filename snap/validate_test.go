@@ -2558,6 +2558,7 @@ slots:
 	c.Assert(warns, HasLen, 2)
 	c.Check(warns[0], ErrorMatches, `snap "need-df" requires a provider for content "gtk-3-themes", a candidate slot is available \(themes-provider:serve-gtk-3-themes\) but not the default-provider, ensure a single auto-connection \(or possibly a connection\) is in-place`)
 	c.Check(warns[1], ErrorMatches, `snap "need-df" requires a provider for content "icon-themes", a candidate slot is available \(icons-provider:serve-icon-themes\) but not the default-provider, ensure a single auto-connection \(or possibly a connection\) is in-place`)
+	c.Check(warns[1].(*ProviderWarning).HasDefaultProviderSlot(), Equals, false)
 }
 
 func (s *validateSuite) TestSelfContainedSetPrereqTrackerDefaultProviderAlternativeProviderThroughValidateBasesAndProviders(c *C) {
@@ -2601,6 +2602,7 @@ slots:
 	c.Assert(errors, HasLen, 0)
 	c.Assert(warns, HasLen, 1)
 	c.Check(warns[0], ErrorMatches, `snap "need-df" requires a provider for content "gtk-3-themes", many candidates slots are available \(themes-provider:serve-gtk-3-themes\) including from default-provider gtk-common-themes:gtk-3-themes, ensure a single auto-connection \(or possibly a connection\) is in-place`)
+	c.Check(warns[0].(*ProviderWarning).HasDefaultProviderSlot(), Equals, true)
 }
 
 func (s *validateSuite) TestSelfContainedSetPrereqTrackerDoubleAlternativeProviders(c *C) {
@@ -2665,6 +2667,63 @@ slots:
 	c.Check(warns[1], ErrorMatches, `snap "need-df" requires a provider for content "icon-themes", a candidate slot is available \(icons-provider:serve-icon-themes\) but not the default-provider, ensure a single auto-connection \(or possibly a connection\) is in-place`)
 }
 
+func (s *validateSuite) TestCumulativePrereqTrackerMissingProviders(c *C) {
+	strk := NewScopedTracker()
+	snapInfo, err := InfoFromSnapYamlWithSideInfo([]byte(yamlNeedDf), nil, strk)
+	c.Assert(err, IsNil)
+
+	prqt := NewCumulativePrereqTracker()
+	// nothing tracked yet, behaves like SimplePrereqTracker
+	c.Check(prqt.MissingProviderContentTags(snapInfo, nil), DeepEquals, map[string][]string{
+		"gtk-common-themes": {"gtk-3-themes", "icon-themes"},
+	})
+
+	const gtkCommonThemesYaml = `name: gtk-common-themes
+version: 1.0
+slots:
+  gtk-3-themes:
+    interface: content
+    content: gtk-3-themes
+    read: [$SNAP/themes]
+`
+	gtkCommonThemesInfo, err := InfoFromSnapYamlWithSideInfo([]byte(gtkCommonThemesYaml), nil, strk)
+	c.Assert(err, IsNil)
+
+	// a provider added in an earlier operation is not missing anymore
+	prqt.Add(gtkCommonThemesInfo)
+	prqt.Add(snapInfo)
+	c.Check(prqt.MissingProviderContentTags(snapInfo, nil), HasLen, 0)
+
+	// adding again does not duplicate
+	prqt.Add(gtkCommonThemesInfo)
+	c.Check(prqt.Snaps(), DeepEquals, []*Info{gtkCommonThemesInfo, snapInfo})
+}
+
+func (s *validateSuite) TestCumulativePrereqTrackerContentProvidedByTrackedSnap(c *C) {
+	strk := NewScopedTracker()
+	snapInfo, err := InfoFromSnapYamlWithSideInfo([]byte(yamlNeedDf), nil, strk)
+	c.Assert(err, IsNil)
+
+	const altThemesYaml = `name: alt-themes
+version: 1.0
+slots:
+  gtk-3-themes:
+    interface: content
+    content: gtk-3-themes
+    read: [$SNAP/themes]
+`
+	altThemesInfo, err := InfoFromSnapYamlWithSideInfo([]byte(altThemesYaml), nil, strk)
+	c.Assert(err, IsNil)
+
+	prqt := NewCumulativePrereqTracker()
+	prqt.Add(altThemesInfo)
+
+	// only the content tag not provided by a tracked snap is missing
+	c.Check(prqt.MissingProviderContentTags(snapInfo, nil), DeepEquals, map[string][]string{
+		"gtk-common-themes": {"icon-themes"},
+	})
+}
+
 func (s *ValidateSuite) TestValidateComponentNames(c *C) {
 	info, err := InfoFromSnapYaml([]byte(`name: foo
 version: 1.0
@@ -360,7 +360,10 @@ type CurrentSnap struct {
 }
 
 type DownloadManyOptions struct {
-	BeforeDownloadFunc func(*snap.Info, map[string]*snap.ComponentInfo) (targetPath string, compPaths map[string]string, err error)
+	// BeforeDownloadFunc is called before downloading each snap with
+	// its info and the infos and download information of the
+	// components to download by component name.
+	BeforeDownloadFunc func(*snap.Info, map[string]*snap.ComponentInfo, map[string]snap.DownloadInfo) (targetPath string, compPaths map[string]string, err error)
 	EnforceValidation  bool
 }
 
@@ -430,6 +433,7 @@ func (tsto *ToolingStore) DownloadMany(toDownload []SnapToDownload, curSnaps []*
 
 		// Create component infos from resource data for the components we will download
 		cinfos := make(map[string]*snap.ComponentInfo, len(sar.Resources))
+		compDownloadInfos := make(map[string]snap.DownloadInfo, len(sar.Resources))
 		for _, res := range sar.Resources {
 			if !strutil.ListContains(snapToDownload.CompsToDownload, res.Name) {
 				continue
@@ -444,9 +448,10 @@ func (tsto *ToolingStore) DownloadMany(toDownload []SnapToDownload, curSnaps []*
 			csi := snap.NewComponentSideInfo(cref, snap.R(res.Revision))
 			cinfos[res.Name] = snap.NewComponentInfo(
 				cref, ctyp, res.Version, "", "", sar.Provenance(), csi)
+			compDownloadInfos[res.Name] = res.DownloadInfo
 		}
 
-		targetPath, compPaths, err := opts.BeforeDownloadFunc(sar.Info, cinfos)
+		targetPath, compPaths, err := opts.BeforeDownloadFunc(sar.Info, cinfos, compDownloadInfos)
 		if err != nil {
 			return nil, err
 		}
@@ -517,11 +517,12 @@ func (s *toolingSuite) TestDownloadManySnapWithComps(c *C) {
 	}
 	dlDir := c.MkDir()
 	var numCore, numReq int
-	bdf := func(si *snap.Info, cinfos map[string]*snap.ComponentInfo) (targetPath string, compPaths map[string]string, err error) {
+	bdf := func(si *snap.Info, cinfos map[string]*snap.ComponentInfo, compDownloadInfos map[string]snap.DownloadInfo) (targetPath string, compPaths map[string]string, err error) {
 		compPaths = make(map[string]string, len(cinfos))
 		switch si.SnapName() {
 		case "core":
 			c.Check(len(cinfos), Equals, 0)
+			c.Check(len(compDownloadInfos), Equals, 0)
 			numCore++
 		case "required20":
 			cref1 := naming.NewComponentRef(si.SnapName(), "comp1")
@@ -540,6 +541,13 @@ func (s *toolingSuite) TestDownloadManySnapWithComps(c *C) {
 					ComponentSideInfo:   *snap.NewComponentSideInfo(cref2, snap.R(33)),
 				},
 			})
+			res := s.AssertedSnapComponents(si.SnapName())
+			c.Assert(res, HasLen, 2)
+			c.Check(compDownloadInfos, DeepEquals, map[string]snap.DownloadInfo{
+				res[0].Name: res[0].DownloadInfo,
+				res[1].Name: res[1].DownloadInfo,
+			})
+			c.Check(compDownloadInfos["comp1"].Size, Not(Equals), int64(0))
 			numReq++
 			compPaths[cref1.ComponentName] = filepath.Join(dlDir, fmt.Sprintf("%s.comp", cref1.String()))
 			compPaths[cref2.ComponentName] = filepath.Join(dlDir, fmt.Sprintf("%s.comp", cref2.String()))
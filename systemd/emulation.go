@@ -80,6 +80,10 @@ func (s *emulation) Stop(services []string) error {
 	return nil
 }
 
+func (s *emulation) StopWithTimeout(services []string, timeout time.Duration) error {
+	return nil
+}
+
 func (s *emulation) Kill(service, signal, who string) error {
 	return &notImplementedError{"Kill"}
 }
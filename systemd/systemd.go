@@ -391,6 +391,11 @@ type Systemd interface {
 	StartNoBlock(service []string) error
 	// Stop the given service, and wait until it has stopped.
 	Stop(services []string) error
+	// StopWithTimeout requests to stop the given services and waits up
+	// to timeout for them to stop. If some services are still running
+	// when the timeout expires a *StopTimeoutError is returned, systemd
+	// carries on with stopping them.
+	StopWithTimeout(services []string, timeout time.Duration) error
 	// Kill all processes of the unit with the given signal.
 	Kill(service, signal, who string) error
 	// Restart the service, waiting for it to stop before starting it again.
@@ -1164,6 +1169,55 @@ func (s *systemd) Stop(serviceNames []string) error {
 	return nil
 }
 
+// StopTimeoutError is returned by StopWithTimeout when some services
+// did not stop in time.
+type StopTimeoutError struct {
+	Services []string
+	Timeout  time.Duration
+}
+
+func (e *StopTimeoutError) Error() string {
+	return fmt.Sprintf("%s did not stop within %s", strutil.Quoted(e.Services), e.Timeout)
+}
+
+func (s *systemd) StopWithTimeout(serviceNames []string, timeout time.Duration) error {
+	if s.mode == GlobalUserMode {
+		panic("cannot call stop with GlobalUserMode")
+	}
+
+	if _, err := s.systemctl(append([]string{"stop", "--no-block"}, serviceNames...)...); err != nil {
+		return err
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	check := time.NewTicker(stopCheckDelay)
+	defer check.Stop()
+
+	for {
+		stillRunningServices := []string{}
+		for _, service := range serviceNames {
+			bs, err := s.systemctl("show", "--property=ActiveState", service)
+			if err != nil {
+				return err
+			}
+			if !isStopDone(bs) {
+				stillRunningServices = append(stillRunningServices, service)
+			}
+		}
+		serviceNames = stillRunningServices
+		if len(serviceNames) == 0 {
+			return nil
+		}
+
+		select {
+		case <-check.C:
+		case <-deadline.C:
+			return &StopTimeoutError{Services: serviceNames, Timeout: timeout}
+		}
+	}
+}
+
 func (s *systemd) Kill(serviceName, signal, who string) error {
 	if s.mode == GlobalUserMode {
 		panic("cannot call kill with GlobalUserMode")
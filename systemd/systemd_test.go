@@ -441,6 +441,54 @@ func (s *SystemdTestSuite) TestStopMany(c *C) {
 	c.Check(s.rep.msgs[1], Equals, `Waiting for "bar" to stop.`)
 }
 
+func (s *SystemdTestSuite) TestStopWithTimeout(c *C) {
+	restore := MockStopDelays(2*time.Millisecond, 4*time.Millisecond)
+	defer restore()
+
+	// 'systemctl show'
+	s.outs = [][]byte{
+		[]byte("ActiveState=deactivating\n"), // foo
+		[]byte("ActiveState=inactive\n"),     // bar
+		[]byte("ActiveState=failed\n"),       // foo
+	}
+	err := New(SystemMode, s.rep).StopWithTimeout([]string{"foo", "bar"}, time.Second)
+	c.Assert(err, IsNil)
+	// 'systemctl stop'
+	c.Assert(s.stopArgses, HasLen, 1)
+	c.Check(s.stopArgses[0], DeepEquals, []string{"stop", "--no-block", "foo", "bar"})
+	// 'systemctl show'
+	c.Check(s.argses, DeepEquals, [][]string{
+		{"show", "--property=ActiveState", "foo"},
+		{"show", "--property=ActiveState", "bar"},
+		{"show", "--property=ActiveState", "foo"},
+	})
+}
+
+func (s *SystemdTestSuite) TestStopWithTimeoutExpires(c *C) {
+	restore := MockStopDelays(2*time.Millisecond, 4*time.Millisecond)
+	defer restore()
+
+	// 'systemctl show' keeps reporting the service as active
+	for i := 0; i < 1000; i++ {
+		s.outs = append(s.outs, []byte("ActiveState=active\n"))
+	}
+	err := New(SystemMode, s.rep).StopWithTimeout([]string{"foo"}, 20*time.Millisecond)
+	c.Assert(err, ErrorMatches, `"foo" did not stop within 20ms`)
+	var stopErr *StopTimeoutError
+	c.Assert(errors.As(err, &stopErr), Equals, true)
+	c.Check(stopErr.Services, DeepEquals, []string{"foo"})
+	c.Check(stopErr.Timeout, Equals, 20*time.Millisecond)
+	c.Check(s.stopArgses, DeepEquals, [][]string{{"stop", "--no-block", "foo"}})
+	c.Check(len(s.argses) > 1, Equals, true)
+}
+
+func (s *SystemdTestSuite) TestStopWithTimeoutStopError(c *C) {
+	s.stopErrors = []error{errors.New("mock error")}
+	err := New(SystemMode, s.rep).StopWithTimeout([]string{"foo"}, time.Second)
+	c.Assert(err, ErrorMatches, "mock error")
+	c.Check(s.argses, HasLen, 0)
+}
+
 func (s *SystemdTestSuite) TestStatus(c *C) {
 	s.outs = [][]byte{
 		[]byte(`
@@ -209,8 +209,16 @@ func EnsureSnapBinaries(s *snap.Info) (err error) {
 	if s == nil {
 		return fmt.Errorf("internal error: snap info cannot be nil")
 	}
-	binariesContent := map[string]osutil.FileState{}
-	completersContent := map[string]osutil.FileState{}
+	binariesContent, completersContent, completionVariant := deriveSnapBinariesContent(s)
+	return ensureSnapBinariesWithContent(s, binariesContent, completersContent, completionVariant)
+}
+
+// deriveSnapBinariesContent returns the expected content of the wrapper
+// binaries and completers for the applications from the snap which aren't
+// services, keyed by base name, together with the completion mode in use.
+func deriveSnapBinariesContent(s *snap.Info) (binariesContent, completersContent map[string]osutil.FileState, completionVariant completionMode) {
+	binariesContent = map[string]osutil.FileState{}
+	completersContent = map[string]osutil.FileState{}
 
 	completeSh, completionVariant := detectCompletion(s.Base)
 
@@ -226,8 +234,7 @@ func EnsureSnapBinaries(s *snap.Info) (err error) {
 			completersContent[appBase] = &osutil.SymlinkFileState{Target: completeSh}
 		}
 	}
-
-	return ensureSnapBinariesWithContent(s, binariesContent, completersContent, completionVariant)
+	return binariesContent, completersContent, completionVariant
 }
 
 // RemoveSnapBinaries removes the wrapper binaries for the applications from the snap which aren't services from.
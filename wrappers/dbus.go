@@ -97,27 +97,12 @@ func snapServiceActivationFiles(dir, snapName string) (services []string, err er
 	return services, nil
 }
 
-func AddSnapDBusActivationFiles(s *snap.Info) error {
-	if err := os.MkdirAll(dirs.SnapDBusSessionServicesDir, 0755); err != nil {
-		return err
-	}
-	if err := os.MkdirAll(dirs.SnapDBusSystemServicesDir, 0755); err != nil {
-		return err
-	}
-
-	// Make sure we include any service files that claim to have
-	// been written by the snap.
-	sessionServices, err := snapServiceActivationFiles(dirs.SnapDBusSessionServicesDir, s.InstanceName())
-	if err != nil {
-		return err
-	}
-	systemServices, err := snapServiceActivationFiles(dirs.SnapDBusSystemServicesDir, s.InstanceName())
-	if err != nil {
-		return err
-	}
-
-	sessionContent := make(map[string]osutil.FileState)
-	systemContent := make(map[string]osutil.FileState)
+// deriveDBusActivationContent returns the expected content of the session
+// and system D-Bus service activation files for the snap, keyed by file
+// name.
+func deriveDBusActivationContent(s *snap.Info) (sessionContent, systemContent map[string]osutil.FileState, err error) {
+	sessionContent = make(map[string]osutil.FileState)
+	systemContent = make(map[string]osutil.FileState)
 
 	for _, app := range s.Apps {
 		if !app.IsService() {
@@ -127,12 +112,12 @@ func AddSnapDBusActivationFiles(s *snap.Info) error {
 		for _, slot := range app.ActivatesOn {
 			var busName string
 			if err := slot.Attr("name", &busName); err != nil {
-				return err
+				return nil, nil, err
 			}
 
 			content, err := generateDBusActivationFile(app, busName)
 			if err != nil {
-				return err
+				return nil, nil, err
 			}
 			filename := busName + ".service"
 			fileState := &osutil.MemoryFileState{
@@ -142,13 +127,43 @@ func AddSnapDBusActivationFiles(s *snap.Info) error {
 			switch app.DaemonScope {
 			case snap.SystemDaemon:
 				systemContent[filename] = fileState
-				systemServices = append(systemServices, filename)
 			case snap.UserDaemon:
 				sessionContent[filename] = fileState
-				sessionServices = append(sessionServices, filename)
 			}
 		}
 	}
+	return sessionContent, systemContent, nil
+}
+
+func AddSnapDBusActivationFiles(s *snap.Info) error {
+	if err := os.MkdirAll(dirs.SnapDBusSessionServicesDir, 0755); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dirs.SnapDBusSystemServicesDir, 0755); err != nil {
+		return err
+	}
+
+	// Make sure we include any service files that claim to have
+	// been written by the snap.
+	sessionServices, err := snapServiceActivationFiles(dirs.SnapDBusSessionServicesDir, s.InstanceName())
+	if err != nil {
+		return err
+	}
+	systemServices, err := snapServiceActivationFiles(dirs.SnapDBusSystemServicesDir, s.InstanceName())
+	if err != nil {
+		return err
+	}
+
+	sessionContent, systemContent, err := deriveDBusActivationContent(s)
+	if err != nil {
+		return err
+	}
+	for filename := range sessionContent {
+		sessionServices = append(sessionServices, filename)
+	}
+	for filename := range systemContent {
+		systemServices = append(systemServices, filename)
+	}
 
 	if _, _, err = osutil.EnsureDirStateGlobs(dirs.SnapDBusSessionServicesDir, sessionServices, sessionContent); err != nil {
 		return err
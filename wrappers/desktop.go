@@ -28,6 +28,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/snapcore/snapd/desktop/desktopentry"
 	"github.com/snapcore/snapd/dirs"
@@ -225,18 +226,72 @@ func sanitizeDesktopFile(s *snap.Info, desktopFile string, rawcontent []byte) []
 	return newContent.Bytes()
 }
 
-func updateDesktopDatabase(desktopFiles []string) error {
+// desktopDBUpdate is a run of update-desktop-database for a directory
+// shared by all the updates requested before it started.
+type desktopDBUpdate struct {
+	done chan struct{}
+	err  error
+}
+
+// desktopDBUpdates tracks, by directory, the running and the next
+// update-desktop-database runs, so that concurrent updates of the desktop
+// files of several snaps trigger only a single further run.
+var desktopDBUpdates = struct {
+	mu      sync.Mutex
+	running map[string]*desktopDBUpdate
+	next    map[string]*desktopDBUpdate
+}{
+	running: make(map[string]*desktopDBUpdate),
+	next:    make(map[string]*desktopDBUpdate),
+}
+
+// waitDesktopDBUpdate waits for the given update-desktop-database run to
+// finish and returns its error.
+var waitDesktopDBUpdate = func(upd *desktopDBUpdate) error {
+	<-upd.done
+	return upd.err
+}
+
+func updateDesktopDatabase(dir string, desktopFiles []string) error {
 	if len(desktopFiles) == 0 {
 		return nil
 	}
 
-	if _, err := exec.LookPath("update-desktop-database"); err == nil {
-		if output, err := exec.Command("update-desktop-database", dirs.SnapDesktopFilesDir).CombinedOutput(); err != nil {
-			return fmt.Errorf("cannot update-desktop-database %q: %s", output, err)
-		}
+	if _, err := exec.LookPath("update-desktop-database"); err != nil {
+		return nil
+	}
+
+	updates := &desktopDBUpdates
+	updates.mu.Lock()
+	if upd := updates.next[dir]; upd != nil {
+		// a run that has not started yet covers our changes as well
+		updates.mu.Unlock()
+		return waitDesktopDBUpdate(upd)
+	}
+	upd := &desktopDBUpdate{done: make(chan struct{})}
+	updates.next[dir] = upd
+	// a run in progress might have missed our changes, wait for it to
+	// finish before starting the next one
+	if running := updates.running[dir]; running != nil {
+		updates.mu.Unlock()
+		<-running.done
+		updates.mu.Lock()
+	}
+	delete(updates.next, dir)
+	updates.running[dir] = upd
+	updates.mu.Unlock()
+
+	if output, err := exec.Command("update-desktop-database", dir).CombinedOutput(); err != nil {
+		upd.err = fmt.Errorf("cannot update-desktop-database %q: %s", output, err)
+	} else {
 		logger.Debugf("update-desktop-database successful")
 	}
-	return nil
+
+	updates.mu.Lock()
+	delete(updates.running, dir)
+	close(upd.done)
+	updates.mu.Unlock()
+	return upd.err
 }
 
 func findDesktopFiles(rootDir string) ([]string, error) {
@@ -250,7 +305,7 @@ func findDesktopFiles(rootDir string) ([]string, error) {
 	return desktopFiles, nil
 }
 
-func deriveDesktopFilesContent(s *snap.Info) (map[string]osutil.FileState, error) {
+func deriveDesktopFilesContent(s *snap.Info, dir string) (map[string]osutil.FileState, error) {
 	desktopFiles, err := s.DesktopFilesFromInstalledSnap(snap.DesktopFilesFromInstalledSnapOptions{})
 	if err != nil {
 		return nil, err
@@ -271,7 +326,7 @@ func deriveDesktopFilesContent(s *snap.Info) (map[string]osutil.FileState, error
 		if err != nil {
 			return nil, err
 		}
-		installedDesktopFileName := filepath.Join(dirs.SnapDesktopFilesDir, base)
+		installedDesktopFileName := filepath.Join(dir, base)
 		fileContent = sanitizeDesktopFile(s, installedDesktopFileName, fileContent)
 		content[base] = &osutil.MemoryFileState{
 			Content: fileContent,
@@ -287,7 +342,13 @@ func deriveDesktopFilesContent(s *snap.Info) (map[string]osutil.FileState, error
 // Only the desktop file base and parsed instance name are passed to the
 // callback function.
 func forAllDesktopFiles(cb func(base, instanceName string) error) error {
-	installedDesktopFiles, err := findDesktopFiles(dirs.SnapDesktopFilesDir)
+	return forAllDesktopFilesInDir(dirs.SnapDesktopFilesDir, cb)
+}
+
+// forAllDesktopFilesInDir is like forAllDesktopFiles, but loops over the
+// desktop files installed under the given directory.
+func forAllDesktopFilesInDir(dir string, cb func(base, instanceName string) error) error {
+	installedDesktopFiles, err := findDesktopFiles(dir)
 	if err != nil {
 		return err
 	}
@@ -330,7 +391,13 @@ func hasDesktopPrefix(s *snap.Info, desktopFile string) bool {
 // It also removes desktop files from the applications of the old snap revision to ensure
 // that only new snap desktop files exist.
 func EnsureSnapDesktopFiles(snaps []*snap.Info) error {
-	if err := os.MkdirAll(dirs.SnapDesktopFilesDir, 0755); err != nil {
+	return EnsureSnapDesktopFilesInDir(dirs.SnapDesktopFilesDir, snaps)
+}
+
+// EnsureSnapDesktopFilesInDir is like EnsureSnapDesktopFiles, but puts the
+// desktop files in the given directory instead of dirs.SnapDesktopFilesDir.
+func EnsureSnapDesktopFilesInDir(dir string, snaps []*snap.Info) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
 	}
 
@@ -348,7 +415,7 @@ func EnsureSnapDesktopFiles(snaps []*snap.Info) error {
 		for _, desktopFileID := range desktopFileIDs {
 			desktopFilesGlobs = append(desktopFilesGlobs, desktopFileID+".desktop")
 		}
-		content, err := deriveDesktopFilesContent(info)
+		content, err := deriveDesktopFilesContent(info, dir)
 		if err != nil {
 			return err
 		}
@@ -357,7 +424,7 @@ func EnsureSnapDesktopFiles(snaps []*snap.Info) error {
 			// Check if a target desktop file belongs to another snap
 			_, hasTarget := content[base]
 			if hasTarget && instanceName != info.InstanceName() {
-				return fmt.Errorf("cannot install %q: %q already exists for another snap", base, filepath.Join(dirs.SnapDesktopFilesDir, base))
+				return fmt.Errorf("cannot install %q: %q already exists for another snap", base, filepath.Join(dir, base))
 			}
 			if instanceName == info.InstanceName() && !hasTarget && !hasDesktopPrefix(info, base) {
 				// An unmangled desktop file exists for the snap, add to glob
@@ -366,11 +433,11 @@ func EnsureSnapDesktopFiles(snaps []*snap.Info) error {
 			}
 			return nil
 		}
-		if err := forAllDesktopFiles(addGlobPatternAndConflictCheck); err != nil {
+		if err := forAllDesktopFilesInDir(dir, addGlobPatternAndConflictCheck); err != nil {
 			return err
 		}
 
-		changed, removed, err := osutil.EnsureDirStateGlobs(dirs.SnapDesktopFilesDir, desktopFilesGlobs, content)
+		changed, removed, err := osutil.EnsureDirStateGlobs(dir, desktopFilesGlobs, content)
 		if err != nil {
 			return err
 		}
@@ -379,7 +446,7 @@ func EnsureSnapDesktopFiles(snaps []*snap.Info) error {
 	}
 
 	// updates mime info etc
-	if err := updateDesktopDatabase(updated); err != nil {
+	if err := updateDesktopDatabase(dir, updated); err != nil {
 		return err
 	}
 
@@ -388,7 +455,14 @@ func EnsureSnapDesktopFiles(snaps []*snap.Info) error {
 
 // RemoveSnapDesktopFiles removes the added desktop files for the applications in the snap.
 func RemoveSnapDesktopFiles(s *snap.Info) error {
-	if !osutil.IsDirectory(dirs.SnapDesktopFilesDir) {
+	return RemoveSnapDesktopFilesFromDir(dirs.SnapDesktopFilesDir, s)
+}
+
+// RemoveSnapDesktopFilesFromDir is like RemoveSnapDesktopFiles, but removes
+// the desktop files from the given directory instead of
+// dirs.SnapDesktopFilesDir.
+func RemoveSnapDesktopFilesFromDir(dir string, s *snap.Info) error {
+	if !osutil.IsDirectory(dir) {
 		return nil
 	}
 
@@ -403,17 +477,17 @@ func RemoveSnapDesktopFiles(s *snap.Info) error {
 
 		return nil
 	}
-	if err := forAllDesktopFiles(addGlobPattern); err != nil {
+	if err := forAllDesktopFilesInDir(dir, addGlobPattern); err != nil {
 		return err
 	}
 
-	_, removed, err := osutil.EnsureDirStateGlobs(dirs.SnapDesktopFilesDir, desktopFilesGlobs, nil)
+	_, removed, err := osutil.EnsureDirStateGlobs(dir, desktopFilesGlobs, nil)
 	if err != nil {
 		return err
 	}
 
 	// updates mime info etc
-	if err := updateDesktopDatabase(removed); err != nil {
+	if err := updateDesktopDatabase(dir, removed); err != nil {
 		return err
 	}
 
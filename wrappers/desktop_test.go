@@ -25,6 +25,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	. "gopkg.in/check.v1"
 
@@ -105,6 +106,82 @@ func (s *desktopSuite) TestEnsurePackageDesktopFiles(c *C) {
 	c.Assert(osutil.FileExists(oldDesktopFilePath), Equals, false)
 }
 
+func (s *desktopSuite) TestUpdateDesktopDatabaseCoalesced(c *C) {
+	dir := c.MkDir()
+	started := filepath.Join(dir, "started")
+	release := filepath.Join(dir, "release")
+	cmd := testutil.MockLockedCommand(c, "update-desktop-database", fmt.Sprintf(`
+touch %[1]q
+while [ ! -e %[2]q ]; do sleep 0.01; done
+`, started, release))
+	defer cmd.Restore()
+
+	joined := make(chan struct{}, 1)
+	restore := wrappers.MockDesktopDBUpdateJoined(func() {
+		joined <- struct{}{}
+	})
+	defer restore()
+
+	errs := make(chan error, 3)
+	update := func() {
+		errs <- wrappers.UpdateDesktopDatabase(dir, []string{"foo_foo.desktop"})
+	}
+
+	// a first update is running
+	go update()
+	for !osutil.FileExists(started) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// further updates requested meanwhile wait for a single next run,
+	// the second one joins the run queued by the first
+	go update()
+	go update()
+	<-joined
+
+	c.Assert(os.WriteFile(release, nil, 0644), IsNil)
+	for i := 0; i < 3; i++ {
+		c.Check(<-errs, IsNil)
+	}
+	c.Check(cmd.Calls(), DeepEquals, [][]string{
+		{"update-desktop-database", dir},
+		{"update-desktop-database", dir},
+	})
+}
+
+func (s *desktopSuite) TestUpdateDesktopDatabaseNothingChanged(c *C) {
+	err := wrappers.UpdateDesktopDatabase(dirs.SnapDesktopFilesDir, nil)
+	c.Assert(err, IsNil)
+	c.Check(s.mockUpdateDesktopDatabase.Calls(), HasLen, 0)
+}
+
+func (s *desktopSuite) TestEnsureAndRemovePackageDesktopFilesInDir(c *C) {
+	dir := filepath.Join(c.MkDir(), "applications")
+	expectedDesktopFilePath := filepath.Join(dir, "foo_foobar.desktop")
+
+	info := snaptest.MockSnap(c, desktopAppYaml, &snap.SideInfo{Revision: snap.R(11)})
+	baseDir := info.MountDir()
+	c.Assert(os.MkdirAll(filepath.Join(baseDir, "meta", "gui"), 0755), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(baseDir, "meta", "gui", "foobar.desktop"), mockDesktopFile, 0644), IsNil)
+
+	err := wrappers.EnsureSnapDesktopFilesInDir(dir, []*snap.Info{info})
+	c.Assert(err, IsNil)
+	c.Check(expectedDesktopFilePath, testutil.FilePresent)
+	// nothing is put in the default directory
+	c.Check(filepath.Join(dirs.SnapDesktopFilesDir, "foo_foobar.desktop"), testutil.FileAbsent)
+	c.Assert(s.mockUpdateDesktopDatabase.Calls(), DeepEquals, [][]string{
+		{"update-desktop-database", dir},
+	})
+	s.mockUpdateDesktopDatabase.ForgetCalls()
+
+	err = wrappers.RemoveSnapDesktopFilesFromDir(dir, info)
+	c.Assert(err, IsNil)
+	c.Check(expectedDesktopFilePath, testutil.FileAbsent)
+	c.Assert(s.mockUpdateDesktopDatabase.Calls(), DeepEquals, [][]string{
+		{"update-desktop-database", dir},
+	})
+}
+
 func (s *desktopSuite) TestEnsurePackageDesktopFilesMangledDuplicate(c *C) {
 	expectedDesktopFilePath := filepath.Join(dirs.SnapDesktopFilesDir, "foo_foobar._.desktop")
 	c.Assert(osutil.FileExists(expectedDesktopFilePath), Equals, false)
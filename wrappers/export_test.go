@@ -60,3 +60,21 @@ func MockEnsureDirState(f func(dir string, glob string, content map[string]osuti
 		ensureDirState = oldEnsureDirState
 	}
 }
+
+func UpdateDesktopDatabase(dir string, desktopFiles []string) error {
+	return updateDesktopDatabase(dir, desktopFiles)
+}
+
+// MockDesktopDBUpdateJoined mocks waiting for the next run of
+// update-desktop-database so that joined is called whenever an update joins
+// a run that has not started yet.
+func MockDesktopDBUpdateJoined(joined func()) (restore func()) {
+	old := waitDesktopDBUpdate
+	waitDesktopDBUpdate = func(upd *desktopDBUpdate) error {
+		joined()
+		return old(upd)
+	}
+	return func() {
+		waitDesktopDBUpdate = old
+	}
+}
@@ -21,10 +21,12 @@ package wrappers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/snapcore/snapd/dirs"
@@ -445,8 +447,19 @@ type SnapServiceOptions struct {
 
 	// QuotaGroup is the quota group for the specified snap.
 	QuotaGroup *quota.Group
+
+	// ServiceUnitMutator, if set, can rewrite the generated .service units
+	// of the specified snap before they are written.
+	ServiceUnitMutator ServiceUnitMutator
 }
 
+// ServiceUnitMutator can rewrite the generated content of the .service unit
+// of a service before it is written, e.g. to add Slice= or After= directives
+// for external service managers. The X-Snappy=yes marker in the [Unit]
+// section of the unit must be kept. The name of the unit file cannot be
+// changed.
+type ServiceUnitMutator func(app *snap.AppInfo, unit string) (string, error)
+
 // ObserveChangeCallback can be invoked by EnsureSnapServices to observe
 // the previous content of a unit and the new on a change.
 // unitType can be "service", "socket", "timer". name is empty for a timer.
@@ -556,7 +569,7 @@ func (es *ensureSnapServicesContext) reloadModified() error {
 
 // ensureSnapServiceSystemdUnits takes care of writing .service files for all services
 // registered in snap.Info apps.
-func (es *ensureSnapServicesContext) ensureSnapServiceSystemdUnits(snapInfo *snap.Info, opts *internal.SnapServicesUnitOptions) error {
+func (es *ensureSnapServicesContext) ensureSnapServiceSystemdUnits(snapInfo *snap.Info, opts *internal.SnapServicesUnitOptions, mutate ServiceUnitMutator) error {
 	handleFileModification := func(app *snap.AppInfo, unitType string, name, path string, content []byte) error {
 		old, modifiedFile, err := tryFileUpdate(path, content)
 		if err != nil {
@@ -586,6 +599,15 @@ func (es *ensureSnapServicesContext) ensureSnapServiceSystemdUnits(snapInfo *sna
 		return nil
 	}
 
+	return generateSnapServiceUnits(snapInfo, opts, es.opts.IncludeServices, mutate, handleFileModification)
+}
+
+// generateSnapServiceUnits generates the content of the .service, .socket
+// and .timer units for the services registered in snap.Info apps and passes
+// each of them to the given callback. If includeServices is not empty only
+// the listed services (in the format my-snap.my-service) are considered. If
+// mutate is set, the content of the .service units is rewritten with it.
+func generateSnapServiceUnits(snapInfo *snap.Info, opts *internal.SnapServicesUnitOptions, includeServices []string, mutate ServiceUnitMutator, unitCb func(app *snap.AppInfo, unitType string, name, path string, content []byte) error) error {
 	// lets sort the service list before generating them for
 	// consistency when testing
 	services := snapInfo.Services()
@@ -604,7 +626,7 @@ func (es *ensureSnapServicesContext) ensureSnapServiceSystemdUnits(snapInfo *sna
 		// is included.
 		// TODO: add an AppInfo.FullName member
 		fullServiceName := fmt.Sprintf("%s.%s", snapInfo.InstanceName(), svc.Name)
-		if len(es.opts.IncludeServices) > 0 && !strutil.ListContains(es.opts.IncludeServices, fullServiceName) {
+		if len(includeServices) > 0 && !strutil.ListContains(includeServices, fullServiceName) {
 			continue
 		}
 
@@ -632,9 +654,15 @@ func (es *ensureSnapServicesContext) ensureSnapServiceSystemdUnits(snapInfo *sna
 		if err != nil {
 			return err
 		}
+		if mutate != nil {
+			content, err = mutateServiceUnit(svc, content, mutate)
+			if err != nil {
+				return err
+			}
+		}
 
 		path := svc.ServiceFile()
-		if err := handleFileModification(svc, "service", svc.Name, path, content); err != nil {
+		if err := unitCb(svc, "service", svc.Name, path, content); err != nil {
 			return err
 		}
 
@@ -645,7 +673,7 @@ func (es *ensureSnapServicesContext) ensureSnapServiceSystemdUnits(snapInfo *sna
 		}
 		for name, content := range socketFiles {
 			path := svc.Sockets[name].File()
-			if err := handleFileModification(svc, "socket", name, path, content); err != nil {
+			if err := unitCb(svc, "socket", name, path, content); err != nil {
 				return err
 			}
 		}
@@ -656,7 +684,7 @@ func (es *ensureSnapServicesContext) ensureSnapServiceSystemdUnits(snapInfo *sna
 				return err
 			}
 			path := svc.Timer.File()
-			if err := handleFileModification(svc, "timer", "", path, content); err != nil {
+			if err := unitCb(svc, "timer", "", path, content); err != nil {
 				return err
 			}
 		}
@@ -664,6 +692,37 @@ func (es *ensureSnapServicesContext) ensureSnapServiceSystemdUnits(snapInfo *sna
 	return nil
 }
 
+// mutateServiceUnit rewrites the generated content of the .service unit of
+// the given service with mutate, checking that the result is still marked as
+// a unit generated by snapd.
+func mutateServiceUnit(app *snap.AppInfo, content []byte, mutate ServiceUnitMutator) ([]byte, error) {
+	mutated, err := mutate(app, string(content))
+	if err != nil {
+		return nil, fmt.Errorf("cannot rewrite service unit %s: %v", app.ServiceName(), err)
+	}
+	if !hasSnappyUnitMarker(mutated) {
+		return nil, fmt.Errorf("cannot rewrite service unit %s: X-Snappy=yes marker missing from the [Unit] section", app.ServiceName())
+	}
+	return []byte(mutated), nil
+}
+
+// hasSnappyUnitMarker returns whether the [Unit] section of the given unit
+// contains the X-Snappy=yes marker.
+func hasSnappyUnitMarker(unit string) bool {
+	section := ""
+	for _, line := range strings.Split(unit, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = line
+			continue
+		}
+		if section == "[Unit]" && line == "X-Snappy=yes" {
+			return true
+		}
+	}
+	return false
+}
+
 // ensureSnapsSystemdServices takes care of writing .service files for all apps in the provided snaps
 // list, and also returns a quota group set that represents all quota groups for the set of snaps
 // provided if they are a part of any.
@@ -701,7 +760,7 @@ func (es *ensureSnapServicesContext) ensureSnapsSystemdServices() (*quota.QuotaG
 			}
 		}
 
-		if err := es.ensureSnapServiceSystemdUnits(s, genServiceOpts); err != nil {
+		if err := es.ensureSnapServiceSystemdUnits(s, genServiceOpts, snapSvcOpts.ServiceUnitMutator); err != nil {
 			return nil, err
 		}
 	}
@@ -970,6 +1029,10 @@ func filterAppsForStop(apps []*snap.AppInfo, reason snap.ServiceStopReason, opts
 // StopServicesOptions carries additional parameters for StopServices.
 type StopServicesOptions struct {
 	Disable bool
+	// Timeout, if set, is how long to wait for each of the system
+	// services to stop gracefully. Services still running when it
+	// expires are killed with SIGKILL and waited for to stop.
+	Timeout time.Duration
 	ScopeOptions
 }
 
@@ -1012,10 +1075,28 @@ func StopServices(apps []*snap.AppInfo, opts *StopServicesOptions, reason snap.S
 		}
 	}
 
+	stop := sysd.Stop
+	if opts.Timeout > 0 {
+		stop = func(services []string) error {
+			err := sysd.StopWithTimeout(services, opts.Timeout)
+			var timeoutErr *systemd.StopTimeoutError
+			if !errors.As(err, &timeoutErr) {
+				return err
+			}
+			logger.Noticef("cannot stop services gracefully, killing them: %v", err)
+			for _, srv := range timeoutErr.Services {
+				if err := sysd.Kill(srv, "KILL", ""); err != nil {
+					return err
+				}
+			}
+			// wait for the killed services to become inactive
+			return sysd.Stop(timeoutErr.Services)
+		}
+	}
 	timings.Run(tm, "stop-services", "stop services", func(nestedTm timings.Measurer) {
 		for _, srv := range systemServices {
 			timings.Run(nestedTm, "stop-service", fmt.Sprintf("stop service %q", srv), func(_ timings.Measurer) {
-				err = sysd.Stop([]string{srv})
+				err = stop([]string{srv})
 			})
 			if err != nil {
 				// Sometimes, services can fail to stop for weird reasons due to weird host setup. For instance,
@@ -1098,6 +1179,13 @@ func RemoveQuotaGroup(grp *quota.Group, inter Interacter) error {
 // from the snap which are services. The optional flag indicates whether
 // services are removed as part of undoing of first install of a given snap.
 func RemoveSnapServices(s *snap.Info, inter Interacter) error {
+	return RemoveSnapServicesInScope(s, ServiceScopeAll, inter)
+}
+
+// RemoveSnapServicesInScope is like RemoveSnapServices but only disables and
+// removes the service units of the services of the snap matching the scope,
+// leaving the other ones in place.
+func RemoveSnapServicesInScope(s *snap.Info, scope ServiceScope, inter Interacter) error {
 	if s.Type() == snap.TypeSnapd {
 		return fmt.Errorf("internal error: removing explicit services for snapd snap is unexpected")
 	}
@@ -1110,7 +1198,7 @@ func RemoveSnapServices(s *snap.Info, inter Interacter) error {
 
 	// collect list of system units to disable and remove
 	for _, app := range s.Apps {
-		if !app.IsService() || !osutil.FileExists(app.ServiceFile()) {
+		if !app.IsService() || !scope.matches(app.DaemonScope) || !osutil.FileExists(app.ServiceFile()) {
 			continue
 		}
 
@@ -1805,6 +1805,75 @@ func (s *servicesTestSuite) TestEnsureSnapServiceEnsureError(c *C) {
 	c.Assert(filepath.Join(svcFileDir, "snap.hello-snap.svc1.service"), testutil.FileAbsent)
 }
 
+func (s *servicesTestSuite) TestEnsureSnapServicesServiceUnitMutator(c *C) {
+	info := snaptest.MockSnap(c, packageHello, &snap.SideInfo{Revision: snap.R(12)})
+	svcFile := filepath.Join(dirs.GlobalRootDir, "/etc/systemd/system/snap.hello-snap.svc1.service")
+
+	var mutated []string
+	m := map[*snap.Info]*wrappers.SnapServiceOptions{
+		info: {
+			ServiceUnitMutator: func(app *snap.AppInfo, unit string) (string, error) {
+				mutated = append(mutated, app.Name)
+				return strings.Replace(unit, "[Service]\n", "[Service]\nSlice=external.slice\n", 1), nil
+			},
+		},
+	}
+
+	seen := make(map[string]string)
+	cb := func(app *snap.AppInfo, grp *quota.Group, unitType, name string, old, new string) {
+		seen[fmt.Sprintf("%s:%s:%s", app.Name, unitType, name)] = new
+	}
+
+	err := wrappers.EnsureSnapServices(m, nil, cb, progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(mutated, DeepEquals, []string{"svc1"})
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"daemon-reload"},
+	})
+	c.Check(svcFile, testutil.FileContains, "[Service]\nSlice=external.slice\n")
+	c.Check(seen["svc1:service:svc1"], testutil.Contains, "[Service]\nSlice=external.slice\n")
+
+	// the mutated unit is up to date
+	missing, err := wrappers.VerifySnapWrappers(info, m[info], nil)
+	c.Assert(err, IsNil)
+	c.Check(strutil.ListContains(missing, svcFile), Equals, false)
+}
+
+func (s *servicesTestSuite) TestEnsureSnapServicesServiceUnitMutatorErrors(c *C) {
+	info := snaptest.MockSnap(c, packageHello, &snap.SideInfo{Revision: snap.R(12)})
+	svcFile := filepath.Join(dirs.GlobalRootDir, "/etc/systemd/system/snap.hello-snap.svc1.service")
+
+	for _, tc := range []struct {
+		mutate wrappers.ServiceUnitMutator
+		err    string
+	}{{
+		mutate: func(app *snap.AppInfo, unit string) (string, error) {
+			return "", fmt.Errorf("boom")
+		},
+		err: `cannot rewrite service unit snap.hello-snap.svc1.service: boom`,
+	}, {
+		mutate: func(app *snap.AppInfo, unit string) (string, error) {
+			return strings.Replace(unit, "X-Snappy=yes\n", "", 1), nil
+		},
+		err: `cannot rewrite service unit snap.hello-snap.svc1.service: X-Snappy=yes marker missing from the \[Unit\] section`,
+	}, {
+		// the marker must stay in the [Unit] section
+		mutate: func(app *snap.AppInfo, unit string) (string, error) {
+			unit = strings.Replace(unit, "X-Snappy=yes\n", "", 1)
+			return strings.Replace(unit, "[Service]\n", "[Service]\nX-Snappy=yes\n", 1), nil
+		},
+		err: `cannot rewrite service unit snap.hello-snap.svc1.service: X-Snappy=yes marker missing from the \[Unit\] section`,
+	}} {
+		m := map[*snap.Info]*wrappers.SnapServiceOptions{
+			info: {ServiceUnitMutator: tc.mutate},
+		}
+		err := wrappers.EnsureSnapServices(m, nil, nil, progress.Null)
+		c.Check(err, ErrorMatches, tc.err)
+		c.Check(svcFile, testutil.FileAbsent)
+		c.Check(s.sysdLog, HasLen, 0)
+	}
+}
+
 func (s *servicesTestSuite) TestEnsureSnapServicesPreseedingHappy(c *C) {
 	// map unit -> new
 	seen := make(map[string]bool)
@@ -2784,6 +2853,43 @@ func (s *servicesTestSuite) TestAddSnapServicesAndRemoveUserDaemons(c *C) {
 	})
 }
 
+func (s *servicesTestSuite) TestRemoveSnapServicesInScopeSystem(c *C) {
+	info := snaptest.MockSnap(c, packageHelloNoSrv+`
+ svc1:
+  daemon: simple
+ svc2:
+  daemon: simple
+  daemon-scope: user
+`, &snap.SideInfo{Revision: snap.R(12)})
+	sysSvcFile := filepath.Join(dirs.SnapServicesDir, "snap.hello-snap.svc1.service")
+	userSvcFile := filepath.Join(dirs.SnapUserServicesDir, "snap.hello-snap.svc2.service")
+
+	err := s.addSnapServices(info, false)
+	c.Assert(err, IsNil)
+	c.Check(sysSvcFile, testutil.FilePresent)
+	c.Check(userSvcFile, testutil.FilePresent)
+
+	s.sysdLog = nil
+	err = wrappers.RemoveSnapServicesInScope(info, wrappers.ServiceScopeSystem, progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(sysSvcFile, testutil.FileAbsent)
+	c.Check(userSvcFile, testutil.FilePresent)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--no-reload", "disable", filepath.Base(sysSvcFile)},
+		{"daemon-reload"},
+	})
+
+	// the user services are removed when asked for
+	s.sysdLog = nil
+	err = wrappers.RemoveSnapServicesInScope(info, wrappers.ServiceScopeUser, progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(userSvcFile, testutil.FileAbsent)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--user", "--global", "--no-reload", "disable", filepath.Base(userSvcFile)},
+		{"--user", "daemon-reload"},
+	})
+}
+
 var snapdYaml = `name: snapd
 version: 2.62
 type: snapd
@@ -3273,6 +3379,115 @@ func (s *servicesTestSuite) TestStopServicesWithSockets(c *C) {
 	})
 }
 
+func (s *servicesTestSuite) TestStopServicesWithTimeout(c *C) {
+	var sysdLog [][]string
+	r := systemd.MockSystemctl(func(cmd ...string) ([]byte, error) {
+		sysdLog = append(sysdLog, cmd)
+		return []byte("ActiveState=inactive\n"), nil
+	})
+	defer r()
+
+	info := snaptest.MockSnap(c, packageHello, &snap.SideInfo{Revision: snap.R(12)})
+	svcFile := "snap.hello-snap.svc1.service"
+	c.Assert(s.addSnapServices(info, false), IsNil)
+	sysdLog = nil
+
+	opts := &wrappers.StopServicesOptions{Timeout: 10 * time.Second}
+	err := wrappers.StopServices(info.Services(), opts, snap.StopReasonRefresh, &progress.Null, s.perfTimings)
+	c.Assert(err, IsNil)
+	c.Check(sysdLog, DeepEquals, [][]string{
+		{"stop", "--no-block", svcFile},
+		{"show", "--property=ActiveState", svcFile},
+	})
+}
+
+func (s *servicesTestSuite) TestStopServicesWithTimeoutExpired(c *C) {
+	var sysdLog [][]string
+	r := systemd.MockSystemctl(func(cmd ...string) ([]byte, error) {
+		sysdLog = append(sysdLog, cmd)
+		return []byte("ActiveState=deactivating\n"), nil
+	})
+	defer r()
+
+	info := snaptest.MockSnap(c, packageHello, &snap.SideInfo{Revision: snap.R(12)})
+	svcFile := "snap.hello-snap.svc1.service"
+	c.Assert(s.addSnapServices(info, false), IsNil)
+	sysdLog = nil
+
+	// services that are still stopping when the timeout expires are
+	// killed and then waited for
+	opts := &wrappers.StopServicesOptions{Timeout: 10 * time.Millisecond}
+	err := wrappers.StopServices(info.Services(), opts, snap.StopReasonRefresh, &progress.Null, s.perfTimings)
+	c.Assert(err, IsNil)
+	var ops [][]string
+	for _, cmd := range sysdLog {
+		if cmd[0] == "show" {
+			c.Check(cmd, DeepEquals, []string{"show", "--property=ActiveState", svcFile})
+			continue
+		}
+		ops = append(ops, cmd)
+	}
+	c.Check(ops, DeepEquals, [][]string{
+		{"stop", "--no-block", svcFile},
+		{"kill", svcFile, "-s", "KILL", "--kill-who=all"},
+		{"stop", svcFile},
+	})
+}
+
+func (s *servicesTestSuite) TestStopServicesWithTimeoutStopFailedButInactive(c *C) {
+	info := snaptest.MockSnap(c, packageHello, &snap.SideInfo{Revision: snap.R(12)})
+	svcFile := "snap.hello-snap.svc1.service"
+	c.Assert(s.addSnapServices(info, false), IsNil)
+
+	var sysdLog [][]string
+	r := systemd.MockSystemctl(func(cmd ...string) ([]byte, error) {
+		sysdLog = append(sysdLog, cmd)
+		if cmd[0] == "stop" {
+			return nil, fmt.Errorf("mock stop error")
+		}
+		return []byte(`Type=simple
+Id=snap.hello-snap.svc1.service
+Names=snap.hello-snap.svc1.service
+ActiveState=inactive
+UnitFileState=enabled
+NeedDaemonReload=no
+`), nil
+	})
+	defer r()
+
+	// the failure to stop is tolerated as the service is not running,
+	// as without a timeout
+	opts := &wrappers.StopServicesOptions{Timeout: 10 * time.Second}
+	err := wrappers.StopServices(info.Services(), opts, snap.StopReasonRemove, &progress.Null, s.perfTimings)
+	c.Assert(err, IsNil)
+	c.Assert(len(sysdLog) >= 2, Equals, true)
+	c.Check(sysdLog[0], DeepEquals, []string{"stop", "--no-block", svcFile})
+	c.Check(sysdLog[1][0], Equals, "show")
+}
+
+func (s *servicesTestSuite) TestStopServicesWithTimeoutStopFailedAndActive(c *C) {
+	info := snaptest.MockSnap(c, packageHello, &snap.SideInfo{Revision: snap.R(12)})
+	c.Assert(s.addSnapServices(info, false), IsNil)
+
+	r := systemd.MockSystemctl(func(cmd ...string) ([]byte, error) {
+		if cmd[0] == "stop" {
+			return nil, fmt.Errorf("mock stop error")
+		}
+		return []byte(`Type=simple
+Id=snap.hello-snap.svc1.service
+Names=snap.hello-snap.svc1.service
+ActiveState=active
+UnitFileState=enabled
+NeedDaemonReload=no
+`), nil
+	})
+	defer r()
+
+	opts := &wrappers.StopServicesOptions{Timeout: 10 * time.Second}
+	err := wrappers.StopServices(info.Services(), opts, snap.StopReasonRemove, &progress.Null, s.perfTimings)
+	c.Assert(err, ErrorMatches, "mock stop error")
+}
+
 func (s *servicesTestSuite) TestStopStartServicesWithSocketsDisableAndEnable(c *C) {
 	info := snaptest.MockSnap(c, packageHelloNoSrv+`
  svc1:
@@ -0,0 +1,247 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package wrappers
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/wrappers/internal"
+)
+
+// snapWrappersContent holds the wrapper files of a snap, grouped by kind
+// and keyed by their full path.
+type snapWrappersContent struct {
+	binaries     map[string]osutil.FileState
+	services     map[string]osutil.FileState
+	userServices map[string]osutil.FileState
+	dbusSystem   map[string]osutil.FileState
+	dbusSession  map[string]osutil.FileState
+	desktop      map[string]osutil.FileState
+	icons        map[string]osutil.FileState
+}
+
+func (c *snapWrappersContent) all() []map[string]osutil.FileState {
+	return []map[string]osutil.FileState{
+		c.binaries, c.services, c.userServices, c.dbusSystem, c.dbusSession, c.desktop, c.icons,
+	}
+}
+
+// deriveSnapWrappersContent generates in memory the wrappers of the snap,
+// that is the binaries and completers, service units, D-Bus activation
+// files, desktop files and icons.
+func deriveSnapWrappersContent(s *snap.Info, snapOpts *SnapServiceOptions, opts *SnapWrappersOptions) (*snapWrappersContent, error) {
+	if snapOpts == nil {
+		snapOpts = &SnapServiceOptions{}
+	}
+	if opts == nil {
+		opts = &SnapWrappersOptions{}
+	}
+
+	content := &snapWrappersContent{
+		binaries:     make(map[string]osutil.FileState),
+		services:     make(map[string]osutil.FileState),
+		userServices: make(map[string]osutil.FileState),
+		dbusSystem:   make(map[string]osutil.FileState),
+		dbusSession:  make(map[string]osutil.FileState),
+		desktop:      make(map[string]osutil.FileState),
+		icons:        make(map[string]osutil.FileState),
+	}
+	addContent := func(to map[string]osutil.FileState, dir string, from map[string]osutil.FileState) {
+		for base, state := range from {
+			to[filepath.Join(dir, base)] = state
+		}
+	}
+
+	// binaries and completers
+	binariesContent, completersContent, completionVariant := deriveSnapBinariesContent(s)
+	addContent(content.binaries, dirs.SnapBinariesDir, binariesContent)
+	switch completionVariant {
+	case normalCompletion:
+		addContent(content.binaries, dirs.CompletersDir, completersContent)
+	case legacyCompletion:
+		addContent(content.binaries, dirs.LegacyCompletersDir, completersContent)
+	}
+
+	// service units
+	genServiceOpts := &internal.SnapServicesUnitOptions{
+		VitalityRank: snapOpts.VitalityRank,
+		QuotaGroup:   snapOpts.QuotaGroup,
+	}
+	if opts.RequireMountedSnapdSnap {
+		genServiceOpts.CoreMountedSnapdSnapDep = SnapdToolingMountUnit
+	}
+	err := generateSnapServiceUnits(s, genServiceOpts, opts.IncludeServices, snapOpts.ServiceUnitMutator, func(app *snap.AppInfo, unitType string, name, path string, unitContent []byte) error {
+		state := &osutil.MemoryFileState{Content: unitContent, Mode: 0644}
+		if app.DaemonScope == snap.UserDaemon {
+			content.userServices[path] = state
+		} else {
+			content.services[path] = state
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// D-Bus activation files
+	if !opts.SkipDBusActivation {
+		sessionContent, systemContent, err := deriveDBusActivationContent(s)
+		if err != nil {
+			return nil, err
+		}
+		addContent(content.dbusSession, dirs.SnapDBusSessionServicesDir, sessionContent)
+		addContent(content.dbusSystem, dirs.SnapDBusSystemServicesDir, systemContent)
+	}
+
+	// desktop files
+	desktopFilesDir := dirs.SnapDesktopFilesDir
+	if opts.DesktopFilesDir != "" {
+		desktopFilesDir = opts.DesktopFilesDir
+	}
+	desktopContent, err := deriveDesktopFilesContent(s, desktopFilesDir)
+	if err != nil {
+		return nil, err
+	}
+	addContent(content.desktop, desktopFilesDir, desktopContent)
+
+	// icons
+	iconsRootDir := filepath.Join(s.MountDir(), "meta", "gui", "icons")
+	icons, err := findIconFiles(s.SnapName(), iconsRootDir)
+	if err != nil {
+		return nil, err
+	}
+	iconsContent, err := deriveIconContent(s.InstanceName(), iconsRootDir, icons)
+	if err != nil {
+		return nil, err
+	}
+	for dir, dirContent := range iconsContent {
+		addContent(content.icons, filepath.Join(dirs.SnapDesktopIconsDir, dir), dirContent)
+	}
+
+	return content, nil
+}
+
+// SnapWrappersOptions holds the options for VerifySnapWrappers and
+// PlanSnapWrappers.
+type SnapWrappersOptions struct {
+	EnsureSnapServicesOptions
+
+	// SkipDBusActivation if set leaves out the D-Bus activation files.
+	SkipDBusActivation bool
+
+	// DesktopFilesDir if set is the directory of the desktop files
+	// instead of dirs.SnapDesktopFilesDir.
+	DesktopFilesDir string
+}
+
+// VerifySnapWrappers regenerates in memory the wrappers of the snap, that is
+// the binaries and completers, service units, D-Bus activation files,
+// desktop files and icons, and compares them against what is on disk. It
+// returns the sorted paths of the wrapper files that are missing or whose
+// content does not match. Nothing on disk is modified.
+func VerifySnapWrappers(s *snap.Info, snapOpts *SnapServiceOptions, opts *SnapWrappersOptions) (mismatched []string, err error) {
+	if s == nil {
+		return nil, fmt.Errorf("internal error: snap info cannot be nil")
+	}
+	if s.Type() == snap.TypeSnapd {
+		return nil, fmt.Errorf("internal error: verifying wrappers of the snapd snap is unsupported")
+	}
+
+	content, err := deriveSnapWrappersContent(s, snapOpts, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, expected := range content.all() {
+		for path, state := range expected {
+			equal, err := osutil.FileStateEqualTo(path, state)
+			if err != nil {
+				return nil, err
+			}
+			if !equal {
+				mismatched = append(mismatched, path)
+			}
+		}
+	}
+	sort.Strings(mismatched)
+	return mismatched, nil
+}
+
+// SnapWrappersPlan lists the sorted paths of the wrapper files of a snap,
+// grouped by kind.
+type SnapWrappersPlan struct {
+	// Binaries holds the binaries and completers.
+	Binaries []string
+	// Services holds the system service, socket and timer units.
+	Services []string
+	// UserServices holds the user service, socket and timer units.
+	UserServices []string
+	// DBusSystem holds the system bus D-Bus activation files.
+	DBusSystem []string
+	// DBusSession holds the session bus D-Bus activation files.
+	DBusSession []string
+	// Desktop holds the desktop files.
+	Desktop []string
+	// Icons holds the desktop icons.
+	Icons []string
+}
+
+// PlanSnapWrappers returns the paths of the wrapper files that would be
+// generated for the snap, without modifying anything on disk.
+func PlanSnapWrappers(s *snap.Info, snapOpts *SnapServiceOptions, opts *SnapWrappersOptions) (*SnapWrappersPlan, error) {
+	if s == nil {
+		return nil, fmt.Errorf("internal error: snap info cannot be nil")
+	}
+	if s.Type() == snap.TypeSnapd {
+		return nil, fmt.Errorf("internal error: planning wrappers of the snapd snap is unsupported")
+	}
+
+	content, err := deriveSnapWrappersContent(s, snapOpts, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SnapWrappersPlan{
+		Binaries:     sortedPaths(content.binaries),
+		Services:     sortedPaths(content.services),
+		UserServices: sortedPaths(content.userServices),
+		DBusSystem:   sortedPaths(content.dbusSystem),
+		DBusSession:  sortedPaths(content.dbusSession),
+		Desktop:      sortedPaths(content.desktop),
+		Icons:        sortedPaths(content.icons),
+	}, nil
+}
+
+func sortedPaths(content map[string]osutil.FileState) []string {
+	if len(content) == 0 {
+		return nil
+	}
+	paths := make([]string, 0, len(content))
+	for path := range content {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
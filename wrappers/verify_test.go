@@ -0,0 +1,232 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package wrappers_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/progress"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/strutil"
+	"github.com/snapcore/snapd/testutil"
+	"github.com/snapcore/snapd/wrappers"
+)
+
+type verifyTestSuite struct {
+	testutil.BaseTest
+}
+
+var _ = Suite(&verifyTestSuite{})
+
+func (s *verifyTestSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+	s.BaseTest.AddCleanup(snap.MockSanitizePlugsSlots(func(snapInfo *snap.Info) {}))
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+}
+
+const verifySnapYaml = `name: hello-snap
+version: 1.0
+apps:
+ hello:
+   command: bin/hello
+ svc:
+   command: bin/svc
+   daemon: simple
+   plugs: [network-bind]
+   sockets:
+     sock:
+       listen-stream: $SNAP_DATA/sock.socket
+`
+
+func (s *verifyTestSuite) TestVerifySnapWrappers(c *C) {
+	info := snaptest.MockSnap(c, verifySnapYaml, &snap.SideInfo{Revision: snap.R(11)})
+
+	// nothing generated yet
+	mismatched, err := wrappers.VerifySnapWrappers(info, nil, nil)
+	c.Assert(err, IsNil)
+	binFile := filepath.Join(dirs.SnapBinariesDir, "hello-snap.hello")
+	svcFile := filepath.Join(dirs.SnapServicesDir, "snap.hello-snap.svc.service")
+	sockFile := filepath.Join(dirs.SnapServicesDir, "snap.hello-snap.svc.sock.socket")
+	c.Check(mismatched, DeepEquals, []string{svcFile, sockFile, binFile})
+
+	c.Assert(wrappers.EnsureSnapBinaries(info), IsNil)
+	ensureOpts := &wrappers.EnsureSnapServicesOptions{Preseeding: true, RequireMountedSnapdSnap: true}
+	err = wrappers.EnsureSnapServices(map[*snap.Info]*wrappers.SnapServiceOptions{info: nil}, ensureOpts, nil, progress.Null)
+	c.Assert(err, IsNil)
+
+	mismatched, err = wrappers.VerifySnapWrappers(info, nil, &wrappers.SnapWrappersOptions{EnsureSnapServicesOptions: *ensureOpts})
+	c.Assert(err, IsNil)
+	c.Check(mismatched, HasLen, 0)
+
+	// units generated with different options do not match
+	mismatched, err = wrappers.VerifySnapWrappers(info, nil, &wrappers.SnapWrappersOptions{})
+	c.Assert(err, IsNil)
+	c.Check(mismatched, DeepEquals, []string{svcFile})
+
+	// tampered files are reported but left untouched
+	c.Assert(os.WriteFile(sockFile, []byte("tampered"), 0644), IsNil)
+	mismatched, err = wrappers.VerifySnapWrappers(info, nil, &wrappers.SnapWrappersOptions{EnsureSnapServicesOptions: *ensureOpts})
+	c.Assert(err, IsNil)
+	c.Check(mismatched, DeepEquals, []string{sockFile})
+	c.Check(sockFile, testutil.FileEquals, "tampered")
+}
+
+func (s *verifyTestSuite) TestVerifySnapWrappersNilInfo(c *C) {
+	_, err := wrappers.VerifySnapWrappers(nil, nil, nil)
+	c.Assert(err, ErrorMatches, "internal error: snap info cannot be nil")
+}
+
+func (s *verifyTestSuite) TestPlanSnapWrappers(c *C) {
+	const yaml = `name: hello-snap
+version: 1.0
+slots:
+  session-slot:
+    interface: dbus
+    bus: session
+    name: org.example.Session
+apps:
+ hello:
+   command: bin/hello
+ svc:
+   command: bin/svc
+   daemon: simple
+   plugs: [network-bind]
+   sockets:
+     sock:
+       listen-stream: $SNAP_DATA/sock.socket
+ user-svc:
+   command: bin/user-svc
+   daemon: simple
+   daemon-scope: user
+   activates-on: [session-slot]
+`
+	info := snaptest.MockSnap(c, yaml, &snap.SideInfo{Revision: snap.R(11)})
+	guiDir := filepath.Join(info.MountDir(), "meta", "gui")
+	c.Assert(os.MkdirAll(filepath.Join(guiDir, "icons"), 0755), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(guiDir, "hello.desktop"), []byte("[Desktop Entry]\nName=hello\n"), 0644), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(guiDir, "icons", "snap.hello-snap.png"), nil, 0644), IsNil)
+
+	plan, err := wrappers.PlanSnapWrappers(info, nil, nil)
+	c.Assert(err, IsNil)
+	c.Check(plan, DeepEquals, &wrappers.SnapWrappersPlan{
+		Binaries: []string{
+			filepath.Join(dirs.SnapBinariesDir, "hello-snap.hello"),
+		},
+		Services: []string{
+			filepath.Join(dirs.SnapServicesDir, "snap.hello-snap.svc.service"),
+			filepath.Join(dirs.SnapServicesDir, "snap.hello-snap.svc.sock.socket"),
+		},
+		UserServices: []string{
+			filepath.Join(dirs.SnapUserServicesDir, "snap.hello-snap.user-svc.service"),
+		},
+		DBusSession: []string{
+			filepath.Join(dirs.SnapDBusSessionServicesDir, "org.example.Session.service"),
+		},
+		Desktop: []string{
+			filepath.Join(dirs.SnapDesktopFilesDir, "hello-snap_hello.desktop"),
+		},
+		Icons: []string{
+			filepath.Join(dirs.SnapDesktopIconsDir, "snap.hello-snap.png"),
+		},
+	})
+
+	// nothing was written
+	for _, dir := range []string{dirs.SnapBinariesDir, dirs.SnapServicesDir, dirs.SnapUserServicesDir, dirs.SnapDBusSessionServicesDir, dirs.SnapDesktopFilesDir, dirs.SnapDesktopIconsDir} {
+		c.Check(dir, testutil.FileAbsent)
+	}
+
+	// D-Bus activation files can be left out
+	plan, err = wrappers.PlanSnapWrappers(info, nil, &wrappers.SnapWrappersOptions{SkipDBusActivation: true})
+	c.Assert(err, IsNil)
+	c.Check(plan.DBusSession, HasLen, 0)
+	c.Check(plan.UserServices, HasLen, 1)
+}
+
+func (s *verifyTestSuite) TestVerifySnapWrappersDesktopFilesDir(c *C) {
+	info := snaptest.MockSnap(c, verifySnapYaml, &snap.SideInfo{Revision: snap.R(11)})
+	guiDir := filepath.Join(info.MountDir(), "meta", "gui")
+	c.Assert(os.MkdirAll(guiDir, 0755), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(guiDir, "hello.desktop"), []byte("[Desktop Entry]\nName=hello\nExec=hello-snap.hello\n"), 0644), IsNil)
+
+	desktopDir := filepath.Join(c.MkDir(), "applications")
+	c.Assert(wrappers.EnsureSnapDesktopFilesInDir(desktopDir, []*snap.Info{info}), IsNil)
+
+	opts := &wrappers.SnapWrappersOptions{DesktopFilesDir: desktopDir}
+	plan, err := wrappers.PlanSnapWrappers(info, nil, opts)
+	c.Assert(err, IsNil)
+	c.Check(plan.Desktop, DeepEquals, []string{filepath.Join(desktopDir, "hello-snap_hello.desktop")})
+
+	mismatched, err := wrappers.VerifySnapWrappers(info, nil, opts)
+	c.Assert(err, IsNil)
+	c.Check(strutil.ListContains(mismatched, filepath.Join(desktopDir, "hello-snap_hello.desktop")), Equals, false)
+	c.Check(strutil.ListContains(mismatched, filepath.Join(dirs.SnapDesktopFilesDir, "hello-snap_hello.desktop")), Equals, false)
+
+	// the desktop file is expected in the default directory otherwise
+	mismatched, err = wrappers.VerifySnapWrappers(info, nil, nil)
+	c.Assert(err, IsNil)
+	c.Check(strutil.ListContains(mismatched, filepath.Join(dirs.SnapDesktopFilesDir, "hello-snap_hello.desktop")), Equals, true)
+}
+
+func (s *verifyTestSuite) TestVerifySnapWrappersSkipDBusActivation(c *C) {
+	const yaml = `name: hello-snap
+version: 1.0
+slots:
+  system-slot:
+    interface: dbus
+    bus: system
+    name: org.example.System
+apps:
+ svc:
+   command: bin/svc
+   daemon: simple
+   activates-on: [system-slot]
+`
+	info := snaptest.MockSnap(c, yaml, &snap.SideInfo{Revision: snap.R(11)})
+	ensureOpts := &wrappers.EnsureSnapServicesOptions{Preseeding: true}
+	err := wrappers.EnsureSnapServices(map[*snap.Info]*wrappers.SnapServiceOptions{info: nil}, ensureOpts, nil, progress.Null)
+	c.Assert(err, IsNil)
+
+	// the activation files are expected by default
+	mismatched, err := wrappers.VerifySnapWrappers(info, nil, &wrappers.SnapWrappersOptions{EnsureSnapServicesOptions: *ensureOpts})
+	c.Assert(err, IsNil)
+	c.Check(mismatched, DeepEquals, []string{filepath.Join(dirs.SnapDBusSystemServicesDir, "org.example.System.service")})
+
+	mismatched, err = wrappers.VerifySnapWrappers(info, nil, &wrappers.SnapWrappersOptions{
+		EnsureSnapServicesOptions: *ensureOpts,
+		SkipDBusActivation:        true,
+	})
+	c.Assert(err, IsNil)
+	c.Check(mismatched, HasLen, 0)
+}
+
+func (s *verifyTestSuite) TestPlanSnapWrappersErrors(c *C) {
+	_, err := wrappers.PlanSnapWrappers(nil, nil, nil)
+	c.Assert(err, ErrorMatches, "internal error: snap info cannot be nil")
+
+	info := snaptest.MockSnap(c, "name: snapd\nversion: 1.0\ntype: snapd", &snap.SideInfo{Revision: snap.R(1)})
+	_, err = wrappers.PlanSnapWrappers(info, nil, nil)
+	c.Assert(err, ErrorMatches, "internal error: planning wrappers of the snapd snap is unsupported")
+}